@@ -0,0 +1,52 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// bodyCounter counts the bytes read from the request body.
+type bodyCounter struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *bodyCounter) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return n, err
+}
+
+// countBody replaces the body of the request with a bodyCounter.
+func (c *logContext) countBody(r *http.Request) {
+	if r.Body != nil && r.Body != http.NoBody {
+		c.body = &bodyCounter{ReadCloser: r.Body}
+		r.Body = c.body
+	}
+}
+
+// bytesRead returns the content length of the request or, if unknown
+// (e.g. chunked transfer encoding), the bytes read from the body.
+func (c *logContext) bytesRead(r *http.Request) int64 {
+	if r.ContentLength >= 0 {
+		return r.ContentLength
+	} else if c != nil && c.body != nil {
+		return atomic.LoadInt64(&c.body.n)
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestMiddlewareClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var logBuf = bytes.NewBuffer(nil)
+
+	clk := clock.NewMock(start)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+		ctx = clock.WithContext(ctx, clk)
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(AccessLogger{}.Middleware)
+	router.GET("/test", func(c *gin.Context) {
+		clk.Advance(1500 * time.Millisecond)
+		c.Status(http.StatusNoContent)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), `ts="2024-01-01T12:00:00Z"`)
+	assert.Contains(t, logBuf.String(), "responsetime=1.5s")
+
+	// The legacy middleware
+	logBuf.Reset()
+	clk = clock.NewMock(start)
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			clk.Advance(250 * time.Millisecond)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(
+		func(h rest.HandlerFunc) rest.HandlerFunc {
+			return func(w rest.ResponseWriter, r *rest.Request) {
+				ctx := log.WithContext(r.Request.Context(), newTestLogger(logBuf))
+				ctx = clock.WithContext(ctx, clk)
+				r.Request = r.Request.WithContext(ctx)
+				h(w, r)
+			}
+		}))
+	api.Use(&AccessLogMiddleware{})
+	api.SetApp(app)
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	api.MakeHandler().ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), `ts="2024-01-01T12:00:00Z"`)
+	assert.Contains(t, logBuf.String(), "responsetime=250ms")
+}
@@ -36,6 +36,7 @@ type logContext struct {
 	mu        sync.Mutex
 	maxErrors int
 	fields    map[string]interface{}
+	body      *bodyCounter
 }
 
 func (c *logContext) SetField(key string, value interface{}) {
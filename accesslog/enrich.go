@@ -0,0 +1,167 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const (
+	// IPRangeFieldName is the log field set by IPRanges.
+	IPRangeFieldName = "iprange"
+
+	IPRangeInternal = "internal"
+	IPRangeExternal = "external"
+)
+
+// Enricher adds context to the access log entries.
+type Enricher interface {
+	// Enrich returns the fields to add to the log entry of the request.
+	// clientIP is the address returned by the ClientIPHook, or the
+	// remote address of the connection if the hook is not set, and may
+	// be nil.
+	Enrich(r *http.Request, clientIP net.IP) map[string]interface{}
+}
+
+// EnricherFunc is an adapter for using a function as an Enricher.
+type EnricherFunc func(r *http.Request, clientIP net.IP) map[string]interface{}
+
+func (f EnricherFunc) Enrich(r *http.Request, clientIP net.IP) map[string]interface{} {
+	return f(r, clientIP)
+}
+
+// DefaultInternalRanges are the private, loopback and link-local address
+// ranges.
+var DefaultInternalRanges = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"fc00::/7",
+	"::1/128",
+	"fe80::/10",
+}
+
+type ipRange struct {
+	name string
+	net  *net.IPNet
+}
+
+// IPRanges is an Enricher classifying the client IP by named sets of
+// CIDR ranges, e.g. "internal", "vpn" or the ranges published by the
+// cloud provider, and logging the name as the "iprange" field. If the
+// client IP is in multiple ranges, the most specific one (the longest
+// prefix) is logged. Addresses outside of all ranges are logged as
+// Default ("external" if empty).
+//
+// IPRanges must not be modified after it is passed to the middleware.
+type IPRanges struct {
+	ranges []ipRange
+
+	// Default is logged if the client IP is not in any of the ranges.
+	Default string
+}
+
+func NewIPRanges() *IPRanges {
+	return &IPRanges{}
+}
+
+// ParseIPRanges creates IPRanges from a map of names to CIDR ranges.
+func ParseIPRanges(ranges map[string][]string) (*IPRanges, error) {
+	r := NewIPRanges()
+	for name, cidrs := range ranges {
+		if err := r.Add(name, cidrs...); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds the CIDR ranges to the set with the given name.
+func (r *IPRanges) Add(name string, cidrs ...string) error {
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf(
+				"accesslog: invalid range for %q: %w", name, err,
+			)
+		}
+		r.ranges = append(r.ranges, ipRange{name: name, net: ipNet})
+	}
+	return nil
+}
+
+// Classify returns the name of the most specific range containing ip.
+func (r *IPRanges) Classify(ip net.IP) string {
+	var (
+		name   string
+		prefix = -1
+	)
+	for _, rng := range r.ranges {
+		if !rng.net.Contains(ip) {
+			continue
+		}
+		if ones, _ := rng.net.Mask.Size(); ones > prefix {
+			name, prefix = rng.name, ones
+		}
+	}
+	if prefix < 0 {
+		if r.Default != "" {
+			return r.Default
+		}
+		return IPRangeExternal
+	}
+	return name
+}
+
+func (r *IPRanges) Enrich(_ *http.Request, clientIP net.IP) map[string]interface{} {
+	if clientIP == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		IPRangeFieldName: r.Classify(clientIP),
+	}
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// addEnricherFields adds the fields of the enrichers to the fields.
+func addEnricherFields(
+	fields map[string]interface{},
+	r *http.Request,
+	clientIP net.IP,
+	enrichers []Enricher,
+) {
+	if len(enrichers) == 0 {
+		return
+	}
+	if clientIP == nil {
+		clientIP = remoteIP(r)
+	}
+	for _, enricher := range enrichers {
+		for key, value := range enricher.Enrich(r, clientIP) {
+			fields[key] = value
+		}
+	}
+}
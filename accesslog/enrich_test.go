@@ -0,0 +1,132 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestIPRanges(t *testing.T) {
+	t.Parallel()
+	ranges, err := ParseIPRanges(map[string][]string{
+		IPRangeInternal: DefaultInternalRanges,
+		"vpn":           {"10.8.0.0/16"},
+		"cloud":         {"203.0.113.0/24", "2001:db8::/32"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	testCases := []struct {
+		IP    string
+		Range string
+	}{
+		{IP: "10.1.2.3", Range: IPRangeInternal},
+		{IP: "10.8.2.3", Range: "vpn"},
+		{IP: "192.168.1.1", Range: IPRangeInternal},
+		{IP: "::1", Range: IPRangeInternal},
+		{IP: "203.0.113.7", Range: "cloud"},
+		{IP: "2001:db8::1", Range: "cloud"},
+		{IP: "198.51.100.1", Range: IPRangeExternal},
+		{IP: "::ffff:10.1.2.3", Range: IPRangeInternal},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Range, ranges.Classify(net.ParseIP(tc.IP)), tc.IP)
+	}
+
+	ranges.Default = "unknown"
+	assert.Equal(t, "unknown", ranges.Classify(net.ParseIP("198.51.100.1")))
+	assert.Nil(t, ranges.Enrich(nil, nil))
+
+	_, err = ParseIPRanges(map[string][]string{"foo": {"10.0.0.0"}})
+	assert.Error(t, err)
+}
+
+func TestEnrichersMiddleware(t *testing.T) {
+	ranges := NewIPRanges()
+	_ = ranges.Add(IPRangeInternal, DefaultInternalRanges...)
+	enrichers := []Enricher{
+		ranges,
+		EnricherFunc(func(r *http.Request, _ net.IP) map[string]interface{} {
+			return map[string]interface{}{"tls": r.TLS != nil}
+		}),
+	}
+	var logBuf = bytes.NewBuffer(nil)
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+		req.RemoteAddr = "192.168.1.10:4242"
+		return req
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(AccessLogger{Enrichers: enrichers}.Middleware)
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), newRequest())
+	assert.Contains(t, logBuf.String(), "iprange=internal")
+	assert.Contains(t, logBuf.String(), "tls=false")
+
+	// The client IP of the ClientIPHook takes precedence
+	logBuf.Reset()
+	handler := AccessLogger{
+		Enrichers: enrichers,
+		ClientIPHook: func(*http.Request) net.IP {
+			return net.ParseIP("198.51.100.1")
+		},
+	}.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := newRequest()
+	req = req.WithContext(log.WithContext(req.Context(), newTestLogger(logBuf)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), "iprange=external")
+
+	// The legacy middleware
+	logBuf.Reset()
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(
+		func(h rest.HandlerFunc) rest.HandlerFunc {
+			return func(w rest.ResponseWriter, r *rest.Request) {
+				ctx := log.WithContext(r.Request.Context(), newTestLogger(logBuf))
+				r.Request = r.Request.WithContext(ctx)
+				h(w, r)
+			}
+		}))
+	api.Use(&AccessLogMiddleware{Enrichers: enrichers})
+	api.SetApp(app)
+	api.MakeHandler().ServeHTTP(httptest.NewRecorder(), newRequest())
+	assert.Contains(t, logBuf.String(), "iprange=internal")
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/errreport"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+func newTestReporter(events *[]*errreport.Event) errreport.Reporter {
+	return errreport.ReporterFunc(
+		func(_ context.Context, event *errreport.Event) error {
+			*events = append(*events, event)
+			return nil
+		})
+}
+
+func withReportContext(ctx context.Context, logBuf *bytes.Buffer,
+	r errreport.Reporter) context.Context {
+	ctx = log.WithContext(ctx, newTestLogger(logBuf))
+	ctx = errreport.WithContext(ctx, r)
+	ctx = requestid.WithContext(ctx, "1234")
+	return identity.WithContext(ctx, &identity.Identity{
+		Subject: "user-1",
+		Tenant:  "tenant-1",
+		IsUser:  true,
+	})
+}
+
+func assertPanicEvent(t *testing.T, events []*errreport.Event) {
+	if !assert.Len(t, events, 1) {
+		return
+	}
+	event := events[0]
+	assert.Equal(t, "!!!!!", event.Panic)
+	assert.Equal(t, "1234", event.RequestID)
+	if assert.NotNil(t, event.Identity) {
+		assert.Equal(t, "tenant-1", event.Identity.Tenant)
+	}
+	assert.NotEmpty(t, event.Stack)
+}
+
+func TestMiddlewareReportsPanic(t *testing.T) {
+	var (
+		logBuf = bytes.NewBuffer(nil)
+		events []*errreport.Event
+	)
+	reporter := newTestReporter(&events)
+	router := gin.New()
+	router.Use(AccessLogger{}.Middleware)
+	router.Use(func(c *gin.Context) {
+		ctx := withReportContext(c.Request.Context(), logBuf, reporter)
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.GET("/test", func(c *gin.Context) {
+		panic("!!!!!")
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assertPanicEvent(t, events)
+
+	// The legacy middleware
+	events = nil
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			panic("!!!!!")
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(
+		func(h rest.HandlerFunc) rest.HandlerFunc {
+			return func(w rest.ResponseWriter, r *rest.Request) {
+				ctx := withReportContext(r.Request.Context(), logBuf, reporter)
+				r.Request = r.Request.WithContext(ctx)
+				h(w, r)
+			}
+		}))
+	api.Use(&AccessLogMiddleware{})
+	api.SetApp(app)
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	api.MakeHandler().ServeHTTP(httptest.NewRecorder(), req)
+	assertPanicEvent(t, events)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// RequestHeaderFieldPrefix is the prefix of the log fields for the
+	// captured request headers.
+	RequestHeaderFieldPrefix = "reqheader_"
+	// ResponseHeaderFieldPrefix is the prefix of the log fields for the
+	// captured response headers.
+	ResponseHeaderFieldPrefix = "rspheader_"
+
+	redacted = "[REDACTED]"
+)
+
+// sensitiveHeaders are never logged in clear text even if they are
+// allow-listed.
+var sensitiveHeaders = map[string]struct{}{
+	"Authorization":       {},
+	"Cookie":              {},
+	"Proxy-Authorization": {},
+	"Set-Cookie":          {},
+}
+
+// HeaderFieldName returns the log field name for the header with the
+// given field prefix: the header name is lower-cased and dashes are
+// replaced with underscores, e.g. "reqheader_content_type".
+func HeaderFieldName(prefix, header string) string {
+	return prefix + strings.ReplaceAll(strings.ToLower(header), "-", "_")
+}
+
+// addHeaderFields adds the allow-listed headers present in hdr to the
+// fields.
+func addHeaderFields(
+	fields map[string]interface{},
+	prefix string,
+	hdr http.Header,
+	allowList []string,
+) {
+	for _, name := range allowList {
+		key := http.CanonicalHeaderKey(name)
+		values, ok := hdr[key]
+		if !ok {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if _, sensitive := sensitiveHeaders[key]; sensitive {
+			value = redacted
+		}
+		fields[HeaderFieldName(prefix, key)] = value
+	}
+}
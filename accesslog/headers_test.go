@@ -0,0 +1,131 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+var testRequestHeaders = []string{
+	"X-MEN-RequestID",
+	"origin",
+	"Authorization",
+	"X-Not-Present",
+}
+
+var testResponseHeaders = []string{
+	"X-RateLimit-Remaining",
+	"deprecation",
+	"Set-Cookie",
+}
+
+func setTestResponseHeaders(hdr http.Header) {
+	hdr.Set("X-Ratelimit-Remaining", "42")
+	hdr.Set("Deprecation", "true")
+	hdr.Set("Set-Cookie", "session=secret")
+	hdr.Set("X-Not-Logged", "foo")
+}
+
+func newHeaderTestRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	req.Header.Set("X-Men-Requestid", "1234")
+	req.Header.Add("Origin", "https://a.example.com")
+	req.Header.Add("Origin", "https://b.example.com")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func assertHeaderFields(t *testing.T, logEntry string) {
+	assert.Contains(t, logEntry, "reqheader_x_men_requestid=1234")
+	assert.Contains(t, logEntry,
+		`reqheader_origin="https://a.example.com, https://b.example.com"`)
+	assert.Contains(t, logEntry, `reqheader_authorization="[REDACTED]"`)
+	assert.NotContains(t, logEntry, "secret")
+	assert.NotContains(t, logEntry, "reqheader_content_type")
+	assert.NotContains(t, logEntry, "reqheader_x_not_present")
+
+	assert.Contains(t, logEntry, "rspheader_x_ratelimit_remaining=42")
+	assert.Contains(t, logEntry, "rspheader_deprecation=true")
+	assert.Contains(t, logEntry, `rspheader_set_cookie="[REDACTED]"`)
+	assert.NotContains(t, logEntry, "rspheader_x_not_logged")
+}
+
+func newTestLogger(buf *bytes.Buffer) *log.Logger {
+	logger := log.NewEmpty()
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	logger.Logger.SetOutput(buf)
+	logger.Logger.SetFormatter(&logrus.TextFormatter{
+		DisableColors: true,
+	})
+	return logger
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var logBuf = bytes.NewBuffer(nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(AccessLogger{
+		RequestHeaders:  testRequestHeaders,
+		ResponseHeaders: testResponseHeaders,
+	}.Middleware)
+	router.GET("/test", func(c *gin.Context) {
+		setTestResponseHeaders(c.Writer.Header())
+		c.Status(http.StatusNoContent)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), newHeaderTestRequest())
+	assertHeaderFields(t, logBuf.String())
+}
+
+func TestRequestHeadersLegacy(t *testing.T) {
+	var logBuf = bytes.NewBuffer(nil)
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			setTestResponseHeaders(w.Header())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(
+		func(h rest.HandlerFunc) rest.HandlerFunc {
+			return func(w rest.ResponseWriter, r *rest.Request) {
+				ctx := log.WithContext(r.Request.Context(), newTestLogger(logBuf))
+				r.Request = r.Request.WithContext(ctx)
+				h(w, r)
+			}
+		}))
+	api.Use(&AccessLogMiddleware{
+		RequestHeaders:  testRequestHeaders,
+		ResponseHeaders: testResponseHeaders,
+	})
+	api.SetApp(app)
+	api.MakeHandler().ServeHTTP(httptest.NewRecorder(), newHeaderTestRequest())
+	assertHeaderFields(t, logBuf.String())
+}
@@ -29,6 +29,8 @@ import (
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/sirupsen/logrus"
 
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/errreport"
 	"github.com/mendersoftware/go-lib-micro/netutils"
 	"github.com/mendersoftware/go-lib-micro/requestlog"
 )
@@ -51,9 +53,27 @@ type AccessLogMiddleware struct {
 	Format AccessLogFormat // nolint:unused
 
 	ClientIPHook func(req *http.Request) net.IP
-	DisableLog   func(statusCode int, r *rest.Request) bool
-
-	recorder *rest.RecorderMiddleware
+	// DisableLog disables the log entry if it returns true.
+	//
+	// Deprecated: use Routes for declaring the routes to mute.
+	DisableLog func(statusCode int, r *rest.Request) bool
+
+	// Routes overrides the log level for matching request paths.
+	Routes *RouteLevels
+
+	// RequestHeaders is an allow-list of request headers to log. The
+	// headers are logged as "reqheader_<name>" fields (see
+	// HeaderFieldName). Credentials (e.g. Authorization) are redacted.
+	RequestHeaders []string
+
+	// ResponseHeaders is an allow-list of response headers to log, e.g.
+	// "X-RateLimit-Remaining" or "Deprecation". The headers are logged
+	// as "rspheader_<name>" fields.
+	ResponseHeaders []string
+
+	// Enrichers add context to the log entries, e.g. IPRanges
+	// classifying the client IP.
+	Enrichers []Enricher
 }
 
 func getClientIPFromEnv() func(r *http.Request) net.IP {
@@ -115,14 +135,32 @@ func (mw *AccessLogMiddleware) LogFunc(
 		"useragent": r.UserAgent(),
 		"qs":        r.URL.RawQuery,
 	}
+	var clientIP net.IP
 	if mw.ClientIPHook != nil {
-		fields["clientip"] = mw.ClientIPHook(r.Request)
+		clientIP = mw.ClientIPHook(r.Request)
+		fields["clientip"] = clientIP
 	}
+	addEnricherFields(fields, r.Request, clientIP, mw.Enrichers)
+	addHeaderFields(fields, RequestHeaderFieldPrefix,
+		r.Header, mw.RequestHeaders)
 	lc := fromContext(ctx)
 	if lc != nil {
 		lc.addFields(fields)
 	}
-	statusCode, _ := r.Env["STATUS_CODE"].(int)
+	var (
+		statusCode   int
+		bytesWritten int64
+	)
+	recorder, recorded := w.(*responseRecorder)
+	if recorded {
+		statusCode = recorder.statusCode
+		bytesWritten = recorder.bytesWritten
+	} else {
+		// Called outside of MiddlewareFunc: fall back on the values
+		// of rest.RecorderMiddleware.
+		statusCode, _ = r.Env["STATUS_CODE"].(int)
+		bytesWritten, _ = r.Env["BYTES_WRITTEN"].(int64)
+	}
 	select {
 	case <-ctx.Done():
 		if errors.Is(ctx.Err(), context.Canceled) {
@@ -131,19 +169,22 @@ func (mw *AccessLogMiddleware) LogFunc(
 	default:
 	}
 
+	var panicked bool
 	if panic := recover(); panic != nil {
+		panicked = true
 		trace := collectTrace()
 		fields["panic"] = panic
 		fields["trace"] = trace
-		// Wrap in recorder middleware to make sure the response is recorded
-		mw.recorder.MiddlewareFunc(func(w rest.ResponseWriter, r *rest.Request) {
-			rest.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		})(w, r)
+		errreport.CapturePanic(r.Request.Context(), panic, trace)
+		rest.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		statusCode = http.StatusInternalServerError
+		if recorded {
+			bytesWritten = recorder.bytesWritten
+		}
 	} else if mw.DisableLog != nil && mw.DisableLog(statusCode, r) {
 		return
 	}
-	rspTime := time.Since(startTime)
+	rspTime := clock.Since(ctx, startTime)
 	// We do not need more than 3 digit fraction
 	if rspTime > time.Second {
 		rspTime = rspTime.Round(time.Millisecond)
@@ -151,8 +192,10 @@ func (mw *AccessLogMiddleware) LogFunc(
 		rspTime = rspTime.Round(time.Microsecond)
 	}
 	fields["responsetime"] = rspTime.String()
-	fields["byteswritten"], _ = r.Env["BYTES_WRITTEN"].(int64)
+	fields["byteswritten"] = bytesWritten
 	fields["status"] = statusCode
+	addHeaderFields(fields, ResponseHeaderFieldPrefix,
+		w.Header(), mw.ResponseHeaders)
 
 	logger := requestlog.GetRequestLogger(r)
 	var level logrus.Level = logrus.InfoLevel
@@ -161,6 +204,9 @@ func (mw *AccessLogMiddleware) LogFunc(
 	} else if statusCode >= 300 {
 		level = logrus.WarnLevel
 	}
+	if !panicked && !mw.Routes.Enabled(r.URL.Path, level) {
+		return
+	}
 	logger.WithFields(fields).
 		Log(level)
 }
@@ -171,16 +217,13 @@ func (mw *AccessLogMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFu
 		// If not set, try get it from env
 		mw.ClientIPHook = getClientIPFromEnv()
 	}
-
-	// This middleware depends on RecorderMiddleware to work
-	mw.recorder = new(rest.RecorderMiddleware)
 	return func(w rest.ResponseWriter, r *rest.Request) {
 		ctx := r.Request.Context()
-		startTime := time.Now()
+		startTime := clock.Now(ctx)
 		ctx = withContext(ctx, &logContext{maxErrors: DefaultMaxErrors})
 		r.Request = r.Request.WithContext(ctx)
-		defer mw.LogFunc(ctx, startTime, w, r)
-		// call the handler inside recorder context
-		mw.recorder.MiddlewareFunc(h)(w, r)
+		recorder := newResponseRecorder(w)
+		defer mw.LogFunc(ctx, startTime, recorder, r)
+		h(recorder, r)
 	}
 }
@@ -25,13 +25,41 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/errreport"
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/mendersoftware/go-lib-micro/rest.utils"
 )
 
 type AccessLogger struct {
+	// DisableLog disables the log entry if it returns true.
+	//
+	// Deprecated: use Routes for declaring the routes to mute.
 	DisableLog   func(c *gin.Context) bool
 	ClientIPHook func(r *http.Request) net.IP
+
+	// Routes overrides the log level for matching request paths.
+	Routes *RouteLevels
+
+	// RequestHeaders is an allow-list of request headers to log. The
+	// headers are logged as "reqheader_<name>" fields (see
+	// HeaderFieldName). Credentials (e.g. Authorization) are redacted.
+	RequestHeaders []string
+
+	// ResponseHeaders is an allow-list of response headers to log, e.g.
+	// "X-RateLimit-Remaining" or "Deprecation". The headers are logged
+	// as "rspheader_<name>" fields.
+	ResponseHeaders []string
+
+	// RoutePatternHook returns the route pattern matched by the request
+	// for the "route" field of the net/http middleware (see Handler),
+	// e.g. chimw.RoutePattern. The gin middleware always logs the route
+	// pattern.
+	RoutePatternHook func(r *http.Request) string
+
+	// Enrichers add context to the log entries, e.g. IPRanges
+	// classifying the client IP.
+	Enrichers []Enricher
 }
 
 func (a AccessLogger) LogFunc(
@@ -49,17 +77,28 @@ func (a AccessLogger) LogFunc(
 		"type":      c.Request.Proto,
 		"useragent": c.Request.UserAgent(),
 	}
+	var clientIP net.IP
 	if a.ClientIPHook != nil {
-		logCtx["clientip"] = a.ClientIPHook(c.Request)
+		clientIP = a.ClientIPHook(c.Request)
+		logCtx["clientip"] = clientIP
 	}
+	addEnricherFields(logCtx, c.Request, clientIP, a.Enrichers)
+	if route := c.FullPath(); route != "" {
+		logCtx["route"] = route
+	}
+	addHeaderFields(logCtx, RequestHeaderFieldPrefix,
+		c.Request.Header, a.RequestHeaders)
 	lc := fromContext(ctx)
 	if lc != nil {
 		lc.addFields(logCtx)
 	}
+	var panicked bool
 	if r := recover(); r != nil {
+		panicked = true
 		trace := collectTrace()
 		logCtx["trace"] = trace
 		logCtx["panic"] = r
+		errreport.CapturePanic(c.Request.Context(), r, trace)
 
 		func() {
 			// Try to respond with an internal server error.
@@ -73,7 +112,7 @@ func (a AccessLogger) LogFunc(
 	} else if a.DisableLog != nil && a.DisableLog(c) {
 		return
 	}
-	latency := time.Since(startTime)
+	latency := clock.Since(ctx, startTime)
 	// We do not need more than 3 digit fraction
 	if latency > time.Second {
 		latency = latency.Round(time.Millisecond)
@@ -81,16 +120,28 @@ func (a AccessLogger) LogFunc(
 		latency = latency.Round(time.Microsecond)
 	}
 	code := c.Writer.Status()
-	select {
-	case <-ctx.Done():
-		if errors.Is(ctx.Err(), context.Canceled) {
-			code = StatusClientClosedConnection
+	if !panicked {
+		// The request context is canceled if the client disconnects
+		// before the handler completes.
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				code = StatusClientClosedConnection
+			}
+		default:
 		}
-	default:
 	}
 	logCtx["responsetime"] = latency.String()
-	logCtx["status"] = c.Writer.Status()
-	logCtx["byteswritten"] = c.Writer.Size()
+	logCtx["status"] = code
+	// gin reports -1 if nothing is written
+	bytesWritten := c.Writer.Size()
+	if bytesWritten < 0 {
+		bytesWritten = 0
+	}
+	logCtx["byteswritten"] = bytesWritten
+	logCtx["bytesread"] = lc.bytesRead(c.Request)
+	addHeaderFields(logCtx, ResponseHeaderFieldPrefix,
+		c.Writer.Header(), a.ResponseHeaders)
 
 	var logLevel logrus.Level = logrus.InfoLevel
 	if code >= 500 {
@@ -98,6 +149,9 @@ func (a AccessLogger) LogFunc(
 	} else if code >= 400 {
 		logLevel = logrus.WarnLevel
 	}
+	if !panicked && !a.Routes.Enabled(c.Request.URL.Path, logLevel) {
+		return
+	}
 	if len(c.Errors) > 0 {
 		errs := c.Errors.Errors()
 		var errMsg string
@@ -119,9 +173,11 @@ func (a AccessLogger) LogFunc(
 
 func (a AccessLogger) Middleware(c *gin.Context) {
 	ctx := c.Request.Context()
-	startTime := time.Now()
-	ctx = withContext(ctx, &logContext{maxErrors: DefaultMaxErrors})
+	startTime := clock.Now(ctx)
+	lc := &logContext{maxErrors: DefaultMaxErrors}
+	ctx = withContext(ctx, lc)
 	c.Request = c.Request.WithContext(ctx)
+	lc.countBody(c.Request)
 	defer a.LogFunc(ctx, c, startTime)
 	c.Next()
 }
@@ -129,7 +185,8 @@ func (a AccessLogger) Middleware(c *gin.Context) {
 // Middleware provides accesslog middleware for the gin-gonic framework.
 // This middleware will recover any panic from occurring in the API
 // handler and log it to error level with panic and trace showing the panic
-// message and traceback respectively.
+// message and traceback respectively. The panic is also reported to the
+// errreport.Reporter of the request context.
 // If an error status is returned in the response, the middleware tries
 // to pop the topmost error from the gin.Context (c.Error) and puts it in
 // the "error" context to the final log entry.
@@ -16,8 +16,11 @@ package accesslog
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -48,6 +51,8 @@ func TestMiddleware(t *testing.T) {
 			"method=GET",
 			"useragent=tester",
 			"responsetime=",
+			"byteswritten=0",
+			"bytesread=0",
 			"ts=",
 		},
 	}, {
@@ -158,3 +163,72 @@ func TestMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddlewareBytesRead(t *testing.T) {
+	testCases := []struct {
+		Name string
+
+		ContentLength int64
+		Read          bool
+
+		BytesRead string
+	}{{
+		Name:          "content length",
+		ContentLength: 11,
+		BytesRead:     "bytesread=11",
+	}, {
+		Name:          "chunked",
+		ContentLength: -1,
+		Read:          true,
+		BytesRead:     "bytesread=11",
+	}, {
+		Name:          "chunked, not read",
+		ContentLength: -1,
+		BytesRead:     "bytesread=0",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			var logBuf = bytes.NewBuffer(nil)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+				c.Request = c.Request.WithContext(ctx)
+			})
+			router.Use(Middleware())
+			router.POST("/test", func(c *gin.Context) {
+				if tc.Read {
+					_, _ = io.Copy(io.Discard, c.Request.Body)
+				}
+				c.Status(http.StatusNoContent)
+			})
+			req, _ := http.NewRequest(http.MethodPost, "http://localhost/test",
+				strings.NewReader("hello world"))
+			req.ContentLength = tc.ContentLength
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			assert.Contains(t, logBuf.String(), tc.BytesRead)
+			assert.Contains(t, logBuf.String(), "byteswritten=0")
+		})
+	}
+}
+
+func TestMiddlewareClientClosedConnection(t *testing.T) {
+	var logBuf = bytes.NewBuffer(nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(Middleware())
+	ctx, cancel := context.WithCancel(context.Background())
+	router.GET("/test", func(c *gin.Context) {
+		// The client disconnects while the request is processed.
+		cancel()
+		c.Status(http.StatusOK)
+	})
+	req, _ := http.NewRequestWithContext(ctx,
+		http.MethodGet, "http://localhost/test", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), "status=499")
+	assert.Contains(t, logBuf.String(), "level=warning")
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/errreport"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+// responseWriter records the status and size of the response for the
+// net/http middleware. It implements PushError such that
+// rest.WriteError adds the errors to the access log.
+type responseWriter struct {
+	http.ResponseWriter
+	lc     *logContext
+	status int
+	size   int64
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("accesslog: ResponseWriter does not support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter (see http.ResponseController).
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) PushError(err error) bool {
+	return w.lc.PushError(err)
+}
+
+func (a AccessLogger) logHTTP(
+	ctx context.Context,
+	w *responseWriter,
+	r *http.Request,
+	startTime time.Time,
+) {
+	logCtx := logrus.Fields{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"qs":     r.URL.RawQuery,
+		"ts": startTime.
+			Truncate(time.Millisecond).
+			Format(time.RFC3339Nano),
+		"type":      r.Proto,
+		"useragent": r.UserAgent(),
+	}
+	var clientIP net.IP
+	if a.ClientIPHook != nil {
+		clientIP = a.ClientIPHook(r)
+		logCtx["clientip"] = clientIP
+	}
+	addEnricherFields(logCtx, r, clientIP, a.Enrichers)
+	addHeaderFields(logCtx, RequestHeaderFieldPrefix,
+		r.Header, a.RequestHeaders)
+	var panicked bool
+	if p := recover(); p != nil {
+		panicked = true
+		trace := collectTrace()
+		logCtx["trace"] = trace
+		logCtx["panic"] = p
+		errreport.CapturePanic(ctx, p, trace)
+		if w.status == 0 {
+			func() {
+				// If the connection is broken it might panic again.
+				defer func() { recover() }() // nolint:errcheck
+				rest.WriteError(w, r,
+					http.StatusInternalServerError,
+					errors.New("internal error"),
+				)
+			}()
+		}
+	}
+	w.lc.addFields(logCtx)
+	if a.RoutePatternHook != nil {
+		// The pattern is only known once the request is routed.
+		if route := a.RoutePatternHook(r); route != "" {
+			logCtx["route"] = route
+		}
+	}
+	latency := clock.Since(ctx, startTime)
+	// We do not need more than 3 digit fraction
+	if latency > time.Second {
+		latency = latency.Round(time.Millisecond)
+	} else if latency > time.Millisecond {
+		latency = latency.Round(time.Microsecond)
+	}
+	code := w.status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.Canceled) {
+			code = StatusClientClosedConnection
+		}
+	default:
+	}
+	logCtx["responsetime"] = latency.String()
+	logCtx["status"] = code
+	logCtx["byteswritten"] = w.size
+	logCtx["bytesread"] = w.lc.bytesRead(r)
+	addHeaderFields(logCtx, ResponseHeaderFieldPrefix,
+		w.Header(), a.ResponseHeaders)
+
+	var logLevel logrus.Level = logrus.InfoLevel
+	if code >= 500 {
+		logLevel = logrus.ErrorLevel
+	} else if code >= 400 {
+		logLevel = logrus.WarnLevel
+	}
+	if !panicked && !a.Routes.Enabled(r.URL.Path, logLevel) {
+		return
+	}
+	log.FromContext(ctx).
+		WithFields(logCtx).
+		Log(logLevel)
+}
+
+// Handler is the net/http equivalent of Middleware: it recovers panics
+// and logs the requests served by next. DisableLog is not supported, use
+// Routes instead. Errors written with rest.WriteError are included in the
+// log entry. The entry is logged with the logger of the request context
+// passed to the handler; unlike with gin, the log fields added by inner
+// middlewares are not included, so wrap the handler in the requestid
+// middleware rather than the other way around.
+func (a AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		startTime := clock.Now(ctx)
+		lc := &logContext{maxErrors: DefaultMaxErrors}
+		ctx = withContext(ctx, lc)
+		rw := &responseWriter{ResponseWriter: w, lc: lc}
+		r = r.WithContext(ctx)
+		lc.countBody(r)
+		defer a.logHTTP(ctx, rw, r, startTime)
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// HTTPMiddleware provides the accesslog middleware for net/http handlers,
+// see Middleware.
+func HTTPMiddleware() func(http.Handler) http.Handler {
+	return AccessLogger{ClientIPHook: getClientIPFromEnv()}.Handler
+}
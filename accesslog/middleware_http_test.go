@@ -0,0 +1,85 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	var logBuf = bytes.NewBuffer(nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		rest.WriteError(w, r, http.StatusBadRequest, errors.New("bad input"))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/alive", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := AccessLogger{
+		Routes:          NewRouteLevels().Suppress("/alive"),
+		ResponseHeaders: []string{"X-RateLimit-Remaining"},
+	}.Handler(mux)
+	handler = func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := log.WithContext(r.Context(), newTestLogger(logBuf))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}(handler)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		logBuf.Reset()
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/ok")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, logBuf.String(), "status=200")
+	assert.Contains(t, logBuf.String(), "byteswritten=5")
+	assert.Contains(t, logBuf.String(), "rspheader_x_ratelimit_remaining=42")
+
+	w = serve("/fail")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"bad input"}`, w.Body.String())
+	assert.Contains(t, logBuf.String(), "level=warning")
+	assert.Contains(t, logBuf.String(), `error="bad input"`)
+
+	w = serve("/panic")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, logBuf.String(), "panic=boom")
+	assert.Contains(t, logBuf.String(), "level=error")
+
+	w = serve("/alive")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, logBuf.String())
+}
@@ -53,6 +53,30 @@ func TestMiddlewareLegacy(t *testing.T) {
 			"responsetime=",
 			"ts=",
 		},
+	}, {
+		Name: "ok, json body",
+
+		HandlerFunc: func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_ = w.WriteJson(map[string]string{"foo": "bar"})
+		},
+		Fields: []string{
+			"status=201",
+			"byteswritten=13",
+			`path=/test`,
+			"method=GET",
+		},
+		ExpectedBody: `{"foo": "bar"}`,
+	}, {
+		Name: "ok, implicit status",
+
+		HandlerFunc: func(w rest.ResponseWriter, r *rest.Request) {
+			_, _ = w.(http.ResponseWriter).Write([]byte("hello"))
+		},
+		Fields: []string{
+			"status=200",
+			"byteswritten=5",
+		},
 	}, {
 		Name: "canceled context",
 
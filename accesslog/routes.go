@@ -0,0 +1,205 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LevelOff is the level name used by ParseRouteLevels to suppress
+	// logging completely.
+	LevelOff = "off"
+
+	wildcardSegment = "*"
+	wildcardRest    = "**"
+)
+
+type routeRule struct {
+	pattern  string
+	level    logrus.Level
+	suppress bool
+}
+
+type routeNode struct {
+	children map[string]*routeNode
+	// wildcard matches any single path segment ("*" or ":param").
+	wildcard *routeNode
+	// rest matches the remainder of the path ("**").
+	rest *routeRule
+	rule *routeRule
+}
+
+// RouteLevels maps URL path patterns to the minimum level of the access
+// log entries for the matching requests, or suppresses the entries
+// completely. A pattern consists of slash separated segments where "*" or
+// ":<name>" matches a single segment and a trailing "**" matches the rest
+// of the path (including nothing). When multiple patterns match a path,
+// literal segments take precedence over wildcards.
+//
+// The zero value is not usable; create it with NewRouteLevels or
+// ParseRouteLevels. RouteLevels must not be modified after it is passed to
+// the middleware.
+type RouteLevels struct {
+	exact map[string]*routeRule
+	root  *routeNode
+}
+
+func NewRouteLevels() *RouteLevels {
+	return &RouteLevels{
+		exact: make(map[string]*routeRule),
+		root:  &routeNode{},
+	}
+}
+
+// ParseRouteLevels creates RouteLevels from a map of patterns to level
+// names (as accepted by logrus.ParseLevel) or LevelOff.
+func ParseRouteLevels(levels map[string]string) (*RouteLevels, error) {
+	r := NewRouteLevels()
+	for pattern, levelName := range levels {
+		if strings.EqualFold(levelName, LevelOff) {
+			r.Suppress(pattern)
+			continue
+		}
+		level, err := logrus.ParseLevel(levelName)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"accesslog: invalid level for route %q: %w", pattern, err,
+			)
+		}
+		r.SetMinLevel(pattern, level)
+	}
+	return r, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func isWildcard(segment string) bool {
+	return segment == wildcardSegment || strings.HasPrefix(segment, ":")
+}
+
+func (r *RouteLevels) add(rule *routeRule) *RouteLevels {
+	segments := splitPath(rule.pattern)
+	var hasWildcard bool
+	for _, segment := range segments {
+		if isWildcard(segment) || segment == wildcardRest {
+			hasWildcard = true
+			break
+		}
+	}
+	if !hasWildcard {
+		r.exact["/"+strings.Join(segments, "/")] = rule
+		return r
+	}
+	node := r.root
+	for i, segment := range segments {
+		if segment == wildcardRest && i == len(segments)-1 {
+			node.rest = rule
+			return r
+		}
+		var next *routeNode
+		if isWildcard(segment) {
+			if node.wildcard == nil {
+				node.wildcard = &routeNode{}
+			}
+			next = node.wildcard
+		} else {
+			if node.children == nil {
+				node.children = make(map[string]*routeNode)
+			}
+			next = node.children[segment]
+			if next == nil {
+				next = &routeNode{}
+				node.children[segment] = next
+			}
+		}
+		node = next
+	}
+	node.rule = rule
+	return r
+}
+
+// SetMinLevel only logs requests matching the pattern if the log entry
+// is at least as severe as level. For example, logrus.WarnLevel only logs
+// requests with a client or server error status.
+func (r *RouteLevels) SetMinLevel(pattern string, level logrus.Level) *RouteLevels {
+	return r.add(&routeRule{pattern: pattern, level: level})
+}
+
+// Suppress disables logging requests matching the patterns. Panics are
+// logged regardless.
+func (r *RouteLevels) Suppress(patterns ...string) *RouteLevels {
+	for _, pattern := range patterns {
+		r.add(&routeRule{pattern: pattern, suppress: true})
+	}
+	return r
+}
+
+func (node *routeNode) match(segments []string) *routeRule {
+	if len(segments) == 0 {
+		if node.rule != nil {
+			return node.rule
+		}
+		return node.rest
+	}
+	if child, ok := node.children[segments[0]]; ok {
+		if rule := child.match(segments[1:]); rule != nil {
+			return rule
+		}
+	}
+	if node.wildcard != nil {
+		if rule := node.wildcard.match(segments[1:]); rule != nil {
+			return rule
+		}
+	}
+	return node.rest
+}
+
+func (r *RouteLevels) lookup(path string) *routeRule {
+	if r == nil {
+		return nil
+	}
+	if rule, ok := r.exact[path]; ok {
+		return rule
+	}
+	if trimmed := strings.TrimRight(path, "/"); trimmed != path && trimmed != "" {
+		if rule, ok := r.exact[trimmed]; ok {
+			return rule
+		}
+	}
+	return r.root.match(splitPath(path))
+}
+
+// Enabled returns true if a log entry with the given level should be
+// written for a request to path.
+func (r *RouteLevels) Enabled(path string, level logrus.Level) bool {
+	rule := r.lookup(path)
+	if rule == nil {
+		return true
+	} else if rule.suppress {
+		return false
+	}
+	// logrus levels are ordered by decreasing severity.
+	return level <= rule.level
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestRouteLevels(t *testing.T) {
+	t.Parallel()
+	routes, err := ParseRouteLevels(map[string]string{
+		"/alive":                        "off",
+		"/metrics/":                     "OFF",
+		"/api/internal/**":              "warn",
+		"/api/devices/:id/status":       "error",
+		"/api/devices/*/status/verbose": "debug",
+		"/api/devices/123/status":       "info",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	testCases := []struct {
+		Path  string
+		Level logrus.Level
+
+		Enabled bool
+	}{
+		{Path: "/alive", Level: logrus.InfoLevel, Enabled: false},
+		{Path: "/alive", Level: logrus.ErrorLevel, Enabled: false},
+		{Path: "/alive/", Level: logrus.InfoLevel, Enabled: false},
+		{Path: "/alive/foo", Level: logrus.InfoLevel, Enabled: true},
+		{Path: "/metrics", Level: logrus.InfoLevel, Enabled: false},
+		{Path: "/api/internal", Level: logrus.InfoLevel, Enabled: false},
+		{Path: "/api/internal/v1/foo", Level: logrus.InfoLevel, Enabled: false},
+		{Path: "/api/internal/v1/foo", Level: logrus.WarnLevel, Enabled: true},
+		{Path: "/api/internal/v1/foo", Level: logrus.ErrorLevel, Enabled: true},
+		{Path: "/api/devices/abc/status", Level: logrus.WarnLevel, Enabled: false},
+		{Path: "/api/devices/abc/status", Level: logrus.ErrorLevel, Enabled: true},
+		{Path: "/api/devices/123/status", Level: logrus.InfoLevel, Enabled: true},
+		{Path: "/api/devices/abc/status/verbose", Level: logrus.DebugLevel, Enabled: true},
+		{Path: "/api/devices/abc", Level: logrus.InfoLevel, Enabled: true},
+		{Path: "/", Level: logrus.InfoLevel, Enabled: true},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Enabled, routes.Enabled(tc.Path, tc.Level),
+			"%s (%s)", tc.Path, tc.Level)
+	}
+
+	var nilRoutes *RouteLevels
+	assert.True(t, nilRoutes.Enabled("/alive", logrus.InfoLevel))
+
+	_, err = ParseRouteLevels(map[string]string{"/alive": "loud"})
+	assert.Error(t, err)
+}
+
+func TestRouteLevelsMiddleware(t *testing.T) {
+	routes := NewRouteLevels().
+		Suppress("/alive").
+		SetMinLevel("/api/**", logrus.WarnLevel)
+	var logBuf = bytes.NewBuffer(nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newTestLogger(logBuf))
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(AccessLogger{Routes: routes}.Middleware)
+	router.GET("/alive", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/api/:status", func(c *gin.Context) {
+		if c.Param("status") == "fail" {
+			c.Status(http.StatusBadRequest)
+		} else {
+			c.Status(http.StatusOK)
+		}
+	})
+
+	for _, path := range []string{"/alive", "/api/ok"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Empty(t, logBuf.String())
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/api/fail", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Contains(t, logBuf.String(), "status=400")
+	assert.Contains(t, logBuf.String(), "route=\"/api/:status\"")
+
+	// The legacy middleware
+	logBuf.Reset()
+	app, err := rest.MakeRouter(rest.Get("/alive",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(rest.MiddlewareSimple(
+		func(h rest.HandlerFunc) rest.HandlerFunc {
+			return func(w rest.ResponseWriter, r *rest.Request) {
+				ctx := log.WithContext(r.Request.Context(), newTestLogger(logBuf))
+				r.Request = r.Request.WithContext(ctx)
+				h(w, r)
+			}
+		}))
+	api.Use(&AccessLogMiddleware{Routes: routes})
+	api.SetApp(app)
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/alive", nil)
+	api.MakeHandler().ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, logBuf.String())
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package apikey authenticates requests with API keys for programmatic
+// access by integrations which can not use JWTs.
+//
+// An API key has the format "<id>.<secret>": the ID selects the key in the
+// Store and is logged, the secret is stored as a SHA256 hash or, for
+// static keys from the configuration, as is. Secrets are compared in
+// constant time.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/addons"
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const (
+	idSize     = 8
+	secretSize = 32
+)
+
+var (
+	ErrKeyNotFound = errors.New("apikey: API key not found")
+	ErrInvalidKey  = errors.New("apikey: invalid API key")
+	ErrKeyExpired  = errors.New("apikey: API key expired")
+)
+
+// Key is a stored API key.
+type Key struct {
+	// ID identifies the key.
+	ID string `json:"id" bson:"_id"`
+	// Hash is the SHA256 hash of the secret of the key, see Hash.
+	Hash []byte `json:"-" bson:"hash"`
+	// Secret is the plain secret of static keys, see StaticKey; it is
+	// only used if Hash is empty and is never persisted.
+	Secret string `json:"-" bson:"-"`
+	// ExpiresAt is the expiration time of the key; the key does not
+	// expire if nil.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
+	// Subject is the subject of the identity of the key, defaults to
+	// "apikey:<id>".
+	Subject string `json:"subject,omitempty" bson:"subject,omitempty"`
+	// Tenant is the tenant of the identity of the key.
+	Tenant string `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	// Plan and Addons are the plan and the addons of the tenant.
+	Plan   string         `json:"plan,omitempty" bson:"plan,omitempty"`
+	Addons []addons.Addon `json:"addons,omitempty" bson:"addons,omitempty"`
+	// IsDevice sets the device flag of the identity instead of the user
+	// flag.
+	IsDevice bool `json:"device,omitempty" bson:"device,omitempty"`
+}
+
+// Identity returns the synthetic identity of requests authenticated with
+// the key. The identity does not share memory with the key.
+func (key *Key) Identity() identity.Identity {
+	subject := key.Subject
+	if subject == "" {
+		subject = "apikey:" + key.ID
+	}
+	return identity.Identity{
+		Subject:  subject,
+		Tenant:   key.Tenant,
+		IsUser:   !key.IsDevice,
+		IsDevice: key.IsDevice,
+		Plan:     key.Plan,
+		Addons:   append([]addons.Addon(nil), key.Addons...),
+	}
+}
+
+// Verify checks the secret and the expiration of the key.
+func (key *Key) Verify(secret string, now time.Time) error {
+	expected := key.Hash
+	if len(expected) == 0 {
+		if key.Secret == "" {
+			return ErrInvalidKey
+		}
+		// Comparing the hashes does not leak the length of the
+		// secret.
+		expected = Hash(key.Secret)
+	}
+	if subtle.ConstantTimeCompare(Hash(secret), expected) != 1 {
+		return ErrInvalidKey
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+// Hash returns the hash of the secret stored in Key.Hash.
+func Hash(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// Parse splits the API key into the ID and the secret.
+func Parse(apiKey string) (id, secret string, err error) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidKey
+	}
+	return id, secret, nil
+}
+
+// StaticKey returns the Key of a static API key, e.g. from the
+// configuration, with the given identity fields; the ID and the Secret of
+// key are replaced.
+func StaticKey(apiKey string, key Key) (Key, error) {
+	id, secret, err := Parse(apiKey)
+	if err != nil {
+		return key, err
+	}
+	key.ID = id
+	key.Hash = nil
+	key.Secret = secret
+	return key, nil
+}
+
+// Generate generates a new API key returning the key to hand to the client
+// and the Key to store with the given identity fields; the ID and the Hash
+// of key are replaced.
+func Generate(key Key) (apiKey string, stored Key, err error) {
+	b := make([]byte, idSize+secretSize)
+	if _, err = rand.Read(b); err != nil {
+		return "", key, errors.Wrap(err, "apikey: failed to generate key")
+	}
+	key.ID = hex.EncodeToString(b[:idSize])
+	secret := base64.RawURLEncoding.EncodeToString(b[idSize:])
+	key.Hash = Hash(secret)
+	key.Secret = ""
+	return key.ID + "." + secret, key, nil
+}
+
+// Store looks up the API keys.
+type Store interface {
+	// GetKey returns the key with the given ID or ErrKeyNotFound.
+	GetKey(ctx context.Context, id string) (*Key, error)
+}
+
+// StaticStore is a Store of a fixed set of keys, e.g. from the
+// configuration.
+type StaticStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+func NewStaticStore(keys ...Key) *StaticStore {
+	store := &StaticStore{keys: make(map[string]*Key, len(keys))}
+	for i := range keys {
+		store.Add(keys[i])
+	}
+	return store
+}
+
+// Add adds or replaces the key.
+func (store *StaticStore) Add(key Key) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.keys[key.ID] = &key
+}
+
+// Remove removes the key with the given ID.
+func (store *StaticStore) Remove(id string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.keys, id)
+}
+
+func (store *StaticStore) GetKey(_ context.Context, id string) (*Key, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	key, ok := store.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	ret := *key
+	ret.Hash = append([]byte(nil), key.Hash...)
+	ret.Addons = append([]addons.Addon(nil), key.Addons...)
+	return &ret, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package apikey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/addons"
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	apiKey, key, err := Generate(Key{Tenant: "tenant", Plan: "enterprise"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	id, secret, err := Parse(apiKey)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key.ID, id)
+		assert.NoError(t, key.Verify(secret, time.Now()))
+		assert.ErrorIs(t, key.Verify(secret+"x", time.Now()), ErrInvalidKey)
+	}
+	assert.Equal(t, identity.Identity{
+		Subject: "apikey:" + key.ID,
+		Tenant:  "tenant",
+		IsUser:  true,
+		Plan:    "enterprise",
+	}, key.Identity())
+
+	other, _, _ := Generate(Key{})
+	assert.NotEqual(t, apiKey, other)
+
+	for _, invalid := range []string{"", "id", "id.", ".secret"} {
+		_, _, err = Parse(invalid)
+		assert.ErrorIs(t, err, ErrInvalidKey, invalid)
+	}
+}
+
+func TestKeyVerifyExpired(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	expires := now.Add(time.Minute)
+	key := Key{ID: "id", Hash: Hash("secret"), ExpiresAt: &expires}
+	assert.NoError(t, key.Verify("secret", now))
+	assert.ErrorIs(t, key.Verify("secret", expires), ErrKeyExpired)
+}
+
+func TestStaticKey(t *testing.T) {
+	t.Parallel()
+	key, err := StaticKey("ci.s3cr3t", Key{Tenant: "tenant"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ci", key.ID)
+	assert.Equal(t, "tenant", key.Tenant)
+	assert.NoError(t, key.Verify("s3cr3t", time.Now()))
+	assert.ErrorIs(t, key.Verify("s3cr3", time.Now()), ErrInvalidKey)
+	assert.ErrorIs(t, key.Verify("", time.Now()), ErrInvalidKey)
+
+	_, err = StaticKey("s3cr3t", Key{})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	empty := Key{ID: "empty"}
+	assert.ErrorIs(t, empty.Verify("", time.Now()), ErrInvalidKey,
+		"keys without a secret never verify")
+}
+
+func TestStaticStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := NewStaticStore(Key{ID: "a", Tenant: "tenant"})
+	key, err := store.GetKey(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "tenant", key.Tenant)
+		key.Tenant = "modified"
+	}
+	key, _ = store.GetKey(ctx, "a")
+	assert.Equal(t, "tenant", key.Tenant, "the stored key must not be modified")
+
+	addon := addons.Addon{Name: "configure", Enabled: true}
+	store.Add(Key{ID: "b", Addons: []addons.Addon{addon}})
+	key, _ = store.GetKey(ctx, "b")
+	idty := key.Identity()
+	idty.Addons[0].Enabled = false
+	key, _ = store.GetKey(ctx, "b")
+	assert.Equal(t, []addons.Addon{addon}, key.Addons,
+		"the identity must not share the addons of the key")
+
+	store.Remove("a")
+	_, err = store.GetKey(ctx, "a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
@@ -0,0 +1,205 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package apikey
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const (
+	// DefaultHeader is the default header carrying the API key.
+	DefaultHeader = "X-MEN-API-Key"
+
+	// LogFieldKeyID is the log field of the ID of the API key.
+	LogFieldKeyID = "api_key_id"
+)
+
+type MiddlewareOptions struct {
+	// Header is the request header carrying the API key.
+	// (default: DefaultHeader)
+	Header *string
+
+	// UpdateLogger adds the key ID and the identity to the log
+	// context. (default: true)
+	UpdateLogger *bool
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetHeader(header string) *MiddlewareOptions {
+	opts.Header = &header
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetUpdateLogger(updateLogger bool) *MiddlewareOptions {
+	opts.UpdateLogger = &updateLogger
+	return opts
+}
+
+func mergeOptions(opts []*MiddlewareOptions) *MiddlewareOptions {
+	opt := NewMiddlewareOptions().
+		SetHeader(DefaultHeader).
+		SetUpdateLogger(true)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Header != nil {
+			opt.Header = o.Header
+		}
+		if o.UpdateLogger != nil {
+			opt.UpdateLogger = o.UpdateLogger
+		}
+	}
+	return opt
+}
+
+type extractor struct {
+	store  Store
+	header string
+}
+
+// NewExtractor returns an identity.IdentityExtractor authenticating the
+// API key of the request, e.g. to accept both JWTs and API keys with the
+// identity middleware (see identity.Extractors). The errors of invalid,
+// unknown and expired keys are ErrInvalidKey or ErrKeyExpired; other
+// errors are errors of the store.
+func NewExtractor(store Store, opts ...*MiddlewareOptions) identity.IdentityExtractor {
+	return &extractor{
+		store:  store,
+		header: *mergeOptions(opts).Header,
+	}
+}
+
+func (ex *extractor) ExtractIdentity(r *http.Request) (identity.Identity, error) {
+	idty, _, err := ex.extract(r)
+	return idty, err
+}
+
+func (ex *extractor) extract(r *http.Request) (identity.Identity, string, error) {
+	apiKey := r.Header.Get(ex.header)
+	if apiKey == "" {
+		return identity.Identity{}, "", errors.Wrap(identity.ErrNoCredentials,
+			"apikey: API key not present in header")
+	}
+	id, secret, err := Parse(apiKey)
+	if err != nil {
+		return identity.Identity{}, "", err
+	}
+	ctx := r.Context()
+	key, err := ex.store.GetKey(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		log.FromContext(ctx).
+			F(log.Ctx{LogFieldKeyID: id}).
+			Warn("apikey: unknown API key")
+		return identity.Identity{}, id, ErrInvalidKey
+	} else if err != nil {
+		return identity.Identity{}, id, errors.Wrap(err,
+			"apikey: failed to look up API key")
+	}
+	if err = key.Verify(secret, clock.Now(ctx)); err != nil {
+		log.FromContext(ctx).
+			F(log.Ctx{LogFieldKeyID: id}).
+			Warnf("apikey: authentication failed: %s", err)
+		return identity.Identity{}, id, err
+	}
+	return key.Identity(), id, nil
+}
+
+// status returns the status of the response to the extraction error.
+func status(err error) int {
+	if errors.Is(err, identity.ErrNoCredentials) ||
+		errors.Is(err, ErrInvalidKey) ||
+		errors.Is(err, ErrKeyExpired) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func updateLogger(r *http.Request, idty *identity.Identity, id string) *http.Request {
+	ctx := r.Context()
+	fields := log.Ctx{LogFieldKeyID: id}
+	if idty.IsDevice {
+		fields["device_id"] = idty.Subject
+	} else {
+		fields["user_id"] = idty.Subject
+	}
+	if idty.Tenant != "" {
+		fields["tenant_id"] = idty.Tenant
+	}
+	if idty.Plan != "" {
+		fields["plan"] = idty.Plan
+	}
+	return r.WithContext(log.WithContext(ctx, log.FromContext(ctx).F(fields)))
+}
+
+// Middleware authenticates the API key of the requests and adds the
+// identity of the key to the request context (see identity.FromContext).
+// Requests without a valid key are rejected with status 401.
+func Middleware(store Store, opts ...*MiddlewareOptions) gin.HandlerFunc {
+	opt := mergeOptions(opts)
+	ex := &extractor{store: store, header: *opt.Header}
+	return func(c *gin.Context) {
+		idty, id, err := ex.extract(c.Request)
+		if err != nil {
+			if code := status(err); code == http.StatusUnauthorized {
+				urest.RenderError(c, code, err)
+			} else {
+				urest.RenderErrorStatus(c, err)
+			}
+			c.Abort()
+			return
+		}
+		if *opt.UpdateLogger {
+			c.Request = updateLogger(c.Request, &idty, id)
+		}
+		c.Request = c.Request.WithContext(
+			identity.WithContext(c.Request.Context(), &idty))
+	}
+}
+
+// HTTPMiddleware is the net/http equivalent of Middleware.
+func HTTPMiddleware(store Store, opts ...*MiddlewareOptions) func(http.Handler) http.Handler {
+	opt := mergeOptions(opts)
+	ex := &extractor{store: store, header: *opt.Header}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idty, id, err := ex.extract(r)
+			if err != nil {
+				if code := status(err); code == http.StatusUnauthorized {
+					urest.WriteError(w, r, code, err)
+				} else {
+					urest.WriteErrorStatus(w, r, err)
+				}
+				return
+			}
+			if *opt.UpdateLogger {
+				r = updateLogger(r, &idty, id)
+			}
+			next.ServeHTTP(w, r.WithContext(
+				identity.WithContext(r.Context(), &idty)))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+type storeFunc func(ctx context.Context, id string) (*Key, error)
+
+func (f storeFunc) GetKey(ctx context.Context, id string) (*Key, error) {
+	return f(ctx, id)
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	apiKey, key, _ := Generate(Key{Tenant: "tenant", IsDevice: true})
+	store := NewStaticStore(key)
+
+	testCases := []struct {
+		Name string
+
+		Store  Store
+		APIKey string
+
+		Status   int
+		Identity *identity.Identity
+		Log      string
+	}{{
+		Name: "ok",
+
+		Store:  store,
+		APIKey: apiKey,
+
+		Status: http.StatusNoContent,
+		Identity: &identity.Identity{
+			Subject:  "apikey:" + key.ID,
+			Tenant:   "tenant",
+			IsDevice: true,
+		},
+		Log: "api_key_id=" + key.ID,
+	}, {
+		Name: "no key",
+
+		Store:  store,
+		Status: http.StatusUnauthorized,
+	}, {
+		Name: "wrong secret",
+
+		Store:  store,
+		APIKey: key.ID + ".wrong",
+		Status: http.StatusUnauthorized,
+		Log:    "api_key_id=" + key.ID,
+	}, {
+		Name: "unknown key",
+
+		Store:  store,
+		APIKey: "unknown." + "secret",
+		Status: http.StatusUnauthorized,
+		Log:    "api_key_id=unknown",
+	}, {
+		Name: "store error",
+
+		Store: storeFunc(func(ctx context.Context, id string) (*Key, error) {
+			return nil, errors.New("connection refused")
+		}),
+		APIKey: apiKey,
+		Status: http.StatusInternalServerError,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			logBuf := bytes.NewBuffer(nil)
+			logger := log.NewEmpty()
+			logger.Logger.SetOutput(logBuf)
+			logger.Logger.SetLevel(logrus.InfoLevel)
+			logger.Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+			var got *identity.Identity
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Request = c.Request.WithContext(
+					log.WithContext(c.Request.Context(), logger))
+			})
+			router.Use(Middleware(tc.Store))
+			router.GET("/test", func(c *gin.Context) {
+				got = identity.FromContext(c.Request.Context())
+				log.FromContext(c.Request.Context()).Info("handler")
+				c.Status(http.StatusNoContent)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tc.APIKey != "" {
+				req.Header.Set(DefaultHeader, tc.APIKey)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Status, w.Code)
+			assert.Equal(t, tc.Identity, got)
+			if tc.Log != "" {
+				assert.Contains(t, logBuf.String(), tc.Log)
+			}
+			assert.NotContains(t, w.Body.String(), "connection refused")
+		})
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+	apiKey, key, _ := Generate(Key{Subject: "integration"})
+	var got *identity.Identity
+	handler := HTTPMiddleware(NewStaticStore(key),
+		NewMiddlewareOptions().SetHeader("X-Api-Key"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = identity.FromContext(r.Context())
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Api-Key", apiKey)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "integration", got.Subject)
+		assert.True(t, got.IsUser)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(DefaultHeader, apiKey)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestExtractor(t *testing.T) {
+	t.Parallel()
+	apiKey, key, _ := Generate(Key{})
+	extractor := identity.Extractors(
+		identity.JWTExtractor(nil, nil),
+		NewExtractor(NewStaticStore(key)),
+	)
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(DefaultHeader, apiKey)
+	idty, err := extractor.ExtractIdentity(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "apikey:"+key.ID, idty.Subject)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	_, err = extractor.ExtractIdentity(req)
+	assert.ErrorIs(t, err, identity.ErrNoCredentials)
+}
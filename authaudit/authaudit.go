@@ -0,0 +1,197 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package authaudit emits structured security events for the requests
+// rejected by the authentication and authorization middlewares, such that
+// security monitoring does not depend on parsing the access logs.
+package authaudit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/notify"
+)
+
+// EventType is the notify.Event type of the security events.
+const EventType = "security.auth_failure"
+
+// Reason classifies the failure.
+type Reason string
+
+const (
+	ReasonNoCredentials      Reason = "no_credentials"
+	ReasonInvalidCredentials Reason = "invalid_credentials"
+	ReasonExpiredCredentials Reason = "expired_credentials"
+	ReasonUntrustedIssuer    Reason = "untrusted_issuer"
+	ReasonInvalidSignature   Reason = "invalid_signature"
+	ReasonInvalidAudience    Reason = "invalid_audience"
+	ReasonScopeLimit         Reason = "scope_limit"
+	ReasonForbidden          Reason = "forbidden"
+)
+
+// Event is the security event of a rejected request.
+type Event struct {
+	// Source is the component rejecting the request, e.g. "identity".
+	Source string `json:"source"`
+	// Status is the HTTP status of the response, e.g. 401 or 403.
+	Status int    `json:"status"`
+	Reason Reason `json:"reason"`
+	// Message is the error message.
+	Message string `json:"message,omitempty"`
+	// Subject and Tenant are the (unverified) subject and tenant of the
+	// credentials, if they could be parsed.
+	Subject string `json:"subject,omitempty"`
+	Tenant  string `json:"tenant_id,omitempty"`
+
+	ClientIP string `json:"client_ip,omitempty"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	// Route is the route pattern matched by the request, if known.
+	Route string `json:"route,omitempty"`
+
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Metrics counts the security events, e.g. to export the counters to a
+// metrics backend. Implementations must be safe for concurrent use.
+type Metrics interface {
+	AuthFailure(source string, status int, reason Reason)
+}
+
+// MetricsLabels identifies a counter of Counters.
+type MetricsLabels struct {
+	Source string
+	Status int
+	Reason Reason
+}
+
+// Counters is an in-memory Metrics implementation counting the events per
+// labels.
+type Counters struct {
+	mu     sync.Mutex
+	counts map[MetricsLabels]uint64
+}
+
+func NewCounters() *Counters {
+	return &Counters{counts: make(map[MetricsLabels]uint64)}
+}
+
+func (c *Counters) AuthFailure(source string, status int, reason Reason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[MetricsLabels{Source: source, Status: status, Reason: reason}]++
+}
+
+// Snapshot returns a copy of the counters.
+func (c *Counters) Snapshot() map[MetricsLabels]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make(map[MetricsLabels]uint64, len(c.counts))
+	for labels, n := range c.counts {
+		ret[labels] = n
+	}
+	return ret
+}
+
+// Auditor emits the security events. The nil Auditor discards the events.
+type Auditor struct {
+	// Dispatcher delivers the events as notifications of type
+	// EventType. The events are sent synchronously while handling the
+	// request, prefer a dispatcher which does not block.
+	Dispatcher notify.Dispatcher
+	// Metrics counts the events.
+	Metrics Metrics
+	// ClientIPHook returns the IP of the client, defaults to the remote
+	// address of the connection (see accesslog).
+	ClientIPHook func(r *http.Request) net.IP
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// NewEvent initializes the event of the request rejected by source.
+func (a *Auditor) NewEvent(
+	r *http.Request,
+	source string,
+	status int,
+	reason Reason,
+	err error,
+) Event {
+	event := Event{
+		Source:     source,
+		Status:     status,
+		Reason:     reason,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		OccurredAt: clock.Now(r.Context()),
+	}
+	if err != nil {
+		event.Message = err.Error()
+	}
+	var ip net.IP
+	if a != nil && a.ClientIPHook != nil {
+		ip = a.ClientIPHook(r)
+	} else {
+		ip = remoteIP(r)
+	}
+	if ip != nil {
+		event.ClientIP = ip.String()
+	}
+	return event
+}
+
+// Emit counts the event and dispatches it. Dispatch errors are logged.
+func (a *Auditor) Emit(ctx context.Context, event Event) {
+	if a == nil {
+		return
+	}
+	if a.Metrics != nil {
+		a.Metrics.AuthFailure(event.Source, event.Status, event.Reason)
+	}
+	if a.Dispatcher == nil {
+		return
+	}
+	err := a.Dispatcher.Send(ctx, notify.Event{
+		Type:     EventType,
+		TenantID: event.Tenant,
+		Subject:  "authorization failure: " + string(event.Reason),
+		Message:  event.Message,
+		Data: map[string]interface{}{
+			"source":    event.Source,
+			"status":    event.Status,
+			"reason":    string(event.Reason),
+			"subject":   event.Subject,
+			"client_ip": event.ClientIP,
+			"method":    event.Method,
+			"path":      event.Path,
+			"route":     event.Route,
+		},
+		OccurredAt: event.OccurredAt,
+	}, nil)
+	if err != nil {
+		log.FromContext(ctx).
+			Errorf("authaudit: failed to dispatch security event: %s", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package authaudit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/notify"
+)
+
+func TestAuditor(t *testing.T) {
+	t.Parallel()
+	var (
+		sent       []notify.Event
+		dispatcher = notify.DispatcherFunc(func(
+			_ context.Context, event notify.Event, _ []notify.Recipient,
+		) error {
+			sent = append(sent, event)
+			return nil
+		})
+		counters = NewCounters()
+		now      = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	auditor := &Auditor{Dispatcher: dispatcher, Metrics: counters}
+
+	ctx := clock.WithContext(context.Background(), clock.NewMock(now))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://localhost/api/management/v1/devices", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	event := auditor.NewEvent(req, "identity", http.StatusUnauthorized,
+		ReasonExpiredCredentials, errors.New("token is expired"))
+	assert.Equal(t, Event{
+		Source:     "identity",
+		Status:     http.StatusUnauthorized,
+		Reason:     ReasonExpiredCredentials,
+		Message:    "token is expired",
+		ClientIP:   "192.0.2.1",
+		Method:     http.MethodGet,
+		Path:       "/api/management/v1/devices",
+		OccurredAt: now,
+	}, event)
+	event.Subject, event.Tenant = "user", "tenant"
+	auditor.Emit(ctx, event)
+	auditor.Emit(ctx, event)
+
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, EventType, sent[0].Type)
+		assert.Equal(t, "tenant", sent[0].TenantID)
+		assert.Equal(t, now, sent[0].OccurredAt)
+		assert.Equal(t, "user", sent[0].Data["subject"])
+		assert.Equal(t, "192.0.2.1", sent[0].Data["client_ip"])
+		assert.Equal(t, http.StatusUnauthorized, sent[0].Data["status"])
+	}
+	assert.Equal(t, map[MetricsLabels]uint64{{
+		Source: "identity",
+		Status: http.StatusUnauthorized,
+		Reason: ReasonExpiredCredentials,
+	}: 2}, counters.Snapshot())
+
+	// ClientIPHook takes precedence over the remote address
+	auditor.ClientIPHook = func(*http.Request) net.IP {
+		return net.ParseIP("198.51.100.1")
+	}
+	event = auditor.NewEvent(req, "identity", http.StatusForbidden,
+		ReasonForbidden, nil)
+	assert.Equal(t, "198.51.100.1", event.ClientIP)
+	assert.Empty(t, event.Message)
+
+	// The nil Auditor discards the events
+	var nilAuditor *Auditor
+	event = nilAuditor.NewEvent(req, "identity", http.StatusForbidden,
+		ReasonForbidden, nil)
+	assert.Equal(t, "192.0.2.1", event.ClientIP)
+	nilAuditor.Emit(ctx, event)
+	assert.Len(t, sent, 2)
+}
@@ -0,0 +1,175 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package cache keeps the services serving when the cache layer fails:
+// while the cache is unavailable the lookups fall through to the data
+// source as if the cache missed.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// ErrDegraded is returned by DegradedMode.Do when the cache is skipped.
+var ErrDegraded = errors.New("cache: degraded mode, cache is unavailable")
+
+const DefaultRetryInterval = 5 * time.Second
+
+type Options struct {
+	// RetryInterval is the time since entering degraded mode after which
+	// the cache is tried again (default: DefaultRetryInterval).
+	RetryInterval *time.Duration
+	// IsFailure decides which errors mean the cache is unavailable, the
+	// default is all errors. Return false for cache misses such as
+	// redis.Nil.
+	IsFailure func(err error) bool
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetRetryInterval(interval time.Duration) *Options {
+	opts.RetryInterval = &interval
+	return opts
+}
+
+func (opts *Options) SetIsFailure(isFailure func(err error) bool) *Options {
+	opts.IsFailure = isFailure
+	return opts
+}
+
+// DegradedMode tracks the availability of the cache. When an operation
+// fails, the cache is skipped until the retry interval has passed; the
+// next operation after that probes the cache and leaves degraded mode if
+// it succeeds. DegradedMode is safe for concurrent use.
+type DegradedMode struct {
+	retryInterval time.Duration
+	isFailure     func(err error) bool
+	now           func() time.Time
+
+	mu       sync.Mutex
+	degraded bool
+	retryAt  time.Time
+}
+
+func NewDegradedMode(opts ...*Options) *DegradedMode {
+	d := &DegradedMode{
+		retryInterval: DefaultRetryInterval,
+		isFailure:     func(error) bool { return true },
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.RetryInterval != nil {
+			d.retryInterval = *opt.RetryInterval
+		}
+		if opt.IsFailure != nil {
+			d.isFailure = opt.IsFailure
+		}
+	}
+	return d
+}
+
+// Degraded returns true while the cache is considered unavailable.
+func (d *DegradedMode) Degraded() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.degraded
+}
+
+// allow returns true if the cache should be used: the cache is available
+// or it is time to probe it. Only one caller probes the cache per retry
+// interval.
+func (d *DegradedMode) allow() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.degraded {
+		return true
+	}
+	now := d.now()
+	if now.Before(d.retryAt) {
+		return false
+	}
+	d.retryAt = now.Add(d.retryInterval)
+	return true
+}
+
+func (d *DegradedMode) report(ctx context.Context, err error) {
+	failed := err != nil && d.isFailure(err)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case failed && !d.degraded:
+		d.degraded = true
+		d.retryAt = d.now().Add(d.retryInterval)
+		log.FromContext(ctx).
+			Warnf("cache: entering degraded mode: %s", err.Error())
+	case failed:
+		d.retryAt = d.now().Add(d.retryInterval)
+	case d.degraded:
+		d.degraded = false
+		log.FromContext(ctx).Info("cache: leaving degraded mode")
+	}
+}
+
+// Do runs the cache operation fn unless the cache is degraded, in which
+// case ErrDegraded is returned. Errors of fn considered failures enter
+// degraded mode.
+func (d *DegradedMode) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !d.allow() {
+		return ErrDegraded
+	}
+	err := fn(ctx)
+	d.report(ctx, err)
+	return err
+}
+
+// GetOrLoad is a read-through lookup: the value is read from the cache
+// with get and, on a cache miss, any cache error or in degraded mode,
+// loaded from the data source with load. Loaded values are stored with
+// set, unless the cache is degraded; errors storing the value only affect
+// the degraded mode. Only errors of load are returned.
+func GetOrLoad[T any](
+	ctx context.Context,
+	d *DegradedMode,
+	get func(ctx context.Context) (T, error),
+	set func(ctx context.Context, value T) error,
+	load func(ctx context.Context) (T, error),
+) (T, error) {
+	var value T
+	err := d.Do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = get(ctx)
+		return err
+	})
+	if err == nil {
+		return value, nil
+	}
+	value, err = load(ctx)
+	if err != nil {
+		return value, err
+	}
+	_ = d.Do(ctx, func(ctx context.Context) error {
+		return set(ctx, value)
+	})
+	return value, nil
+}
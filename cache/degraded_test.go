@@ -0,0 +1,120 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	errMiss = errors.New("miss")
+	errDown = errors.New("connection refused")
+)
+
+func TestDegradedMode(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDegradedMode(NewOptions().
+		SetRetryInterval(time.Minute).
+		SetIsFailure(func(err error) bool { return err != errMiss }))
+	d.now = func() time.Time { return now }
+
+	var calls int
+	op := func(err error) func(context.Context) error {
+		return func(context.Context) error {
+			calls++
+			return err
+		}
+	}
+	assert.ErrorIs(t, d.Do(ctx, op(errMiss)), errMiss)
+	assert.False(t, d.Degraded())
+	assert.ErrorIs(t, d.Do(ctx, op(errDown)), errDown)
+	assert.True(t, d.Degraded())
+
+	// The cache is skipped until the retry interval has passed
+	assert.ErrorIs(t, d.Do(ctx, op(nil)), ErrDegraded)
+	assert.Equal(t, 2, calls)
+
+	// The probe fails
+	now = now.Add(time.Minute)
+	assert.ErrorIs(t, d.Do(ctx, op(errDown)), errDown)
+	assert.ErrorIs(t, d.Do(ctx, op(nil)), ErrDegraded)
+	assert.Equal(t, 3, calls)
+
+	// The probe succeeds
+	now = now.Add(time.Minute)
+	assert.NoError(t, d.Do(ctx, op(nil)))
+	assert.False(t, d.Degraded())
+	assert.NoError(t, d.Do(ctx, op(nil)))
+	assert.Equal(t, 5, calls)
+}
+
+func TestGetOrLoad(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	d := NewDegradedMode(NewOptions().
+		SetIsFailure(func(err error) bool { return err != errMiss }))
+
+	cache := map[string]string{}
+	var getErr error
+	get := func(ctx context.Context) (string, error) {
+		if getErr != nil {
+			return "", getErr
+		}
+		if v, ok := cache["key"]; ok {
+			return v, nil
+		}
+		return "", errMiss
+	}
+	set := func(ctx context.Context, v string) error {
+		cache["key"] = v
+		return nil
+	}
+	var loads int
+	load := func(ctx context.Context) (string, error) {
+		loads++
+		return "value", nil
+	}
+
+	value, err := GetOrLoad(ctx, d, get, set, load)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	value, err = GetOrLoad(ctx, d, get, set, load)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	assert.Equal(t, 1, loads)
+
+	// The cache fails: the values are loaded from the source
+	getErr = errDown
+	value, err = GetOrLoad(ctx, d, get, set, load)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", value)
+	assert.True(t, d.Degraded())
+	getErr = nil
+	_, _ = GetOrLoad(ctx, d, get, set, load)
+	assert.Equal(t, 3, loads)
+
+	errLoad := errors.New("not found")
+	_, err = GetOrLoad(ctx, d, get, set, func(context.Context) (string, error) {
+		return "", errLoad
+	})
+	assert.ErrorIs(t, err, errLoad)
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package chimw adapts the shared middlewares to the chi router.
+package chimw
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// RoutePattern returns the pattern of the chi route matched by the
+// request, e.g. "/devices/{id}".
+func RoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// AccessLog returns the access log middleware logging the matched route
+// pattern in the "route" field. Use it after RequestID such that the
+// entries include the request ID.
+func AccessLog(logger accesslog.AccessLogger) func(http.Handler) http.Handler {
+	if logger.RoutePatternHook == nil {
+		logger.RoutePatternHook = RoutePattern
+	}
+	return logger.Handler
+}
+
+// Identity returns identity.HTTPMiddleware. The PathRegex is matched
+// against the request path, not the route pattern, since the middlewares
+// of a chi router run before the request is routed.
+func Identity(opts ...*identity.MiddlewareOptions) func(http.Handler) http.Handler {
+	return identity.HTTPMiddleware(opts...)
+}
+
+// RequestID returns requestid.HTTPMiddleware.
+func RequestID(opts ...*requestid.MiddlewareOptions) func(http.Handler) http.Handler {
+	return requestid.HTTPMiddleware(opts...)
+}
+
+// RBAC returns rbac.HTTPMiddleware.
+func RBAC(opts ...*rbac.MiddlewareOptions) func(http.Handler) http.Handler {
+	return rbac.HTTPMiddleware(opts...)
+}
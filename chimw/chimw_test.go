@@ -0,0 +1,75 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package chimw
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+func TestMiddlewares(t *testing.T) {
+	logBuf := bytes.NewBuffer(nil)
+	logger := log.NewEmpty()
+	logger.Logger.SetOutput(logBuf)
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	logger.Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := log.WithContext(r.Context(), logger)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Use(RequestID())
+	r.Use(AccessLog(accesslog.AccessLogger{}))
+	r.Use(Identity())
+	r.Use(RBAC())
+	r.Get("/devices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		assert.Equal(t, "user", identity.FromContext(ctx).Subject)
+		assert.Equal(t, []string{"production"}, rbac.FromContext(ctx).DeviceGroups)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	claims, _ := json.Marshal(identity.Identity{Subject: "user", IsUser: true})
+	token := "aGVhZGVy." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbg"
+	req := httptest.NewRequest(http.MethodGet, "/devices/1234", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(requestid.RequestIdHeader, "req-1")
+	req.Header.Set(rbac.ScopeHeader, "production")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, logBuf.String(), "route=\"/devices/{id}\"")
+	assert.Contains(t, logBuf.String(), "path=/devices/1234")
+	assert.Contains(t, logBuf.String(), "request_id=req-1")
+	assert.Contains(t, logBuf.String(), "status=204")
+}
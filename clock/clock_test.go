@@ -0,0 +1,129 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestReal(t *testing.T) {
+	t.Parallel()
+	assert.WithinDuration(t, time.Now(), Real.Now(), time.Second)
+	assert.Equal(t, Real, OrReal(nil))
+	mock := NewMock(time.Now())
+	assert.Equal(t, Clock(mock), OrReal(mock))
+
+	timer := Real.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+
+	ticker := Real.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	<-Real.After(time.Millisecond)
+}
+
+func TestMock(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewMock(start)
+	assert.Equal(t, start, clk.Now())
+
+	after := clk.After(time.Minute)
+	timer := clk.NewTimer(2 * time.Minute)
+	stopped := clk.NewTimer(time.Minute)
+	ticker := clk.NewTicker(time.Minute)
+	assert.Equal(t, 4, clk.Waiters())
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clk.Advance(30 * time.Second)
+	assert.Equal(t, 30*time.Second, clk.Since(start))
+	_, ok := receive(after)
+	assert.False(t, ok)
+
+	clk.Advance(30 * time.Second)
+	ts, ok := receive(after)
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Minute), ts)
+	_, ok = receive(ticker.C())
+	assert.True(t, ok)
+	_, ok = receive(timer.C())
+	assert.False(t, ok)
+	_, ok = receive(stopped.C())
+	assert.False(t, ok)
+
+	// Ticks are dropped for slow receivers.
+	clk.Advance(3 * time.Minute)
+	_, ok = receive(timer.C())
+	assert.True(t, ok)
+	assert.False(t, timer.Stop())
+	ts, ok = receive(ticker.C())
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(2*time.Minute), ts)
+	_, ok = receive(ticker.C())
+	assert.False(t, ok)
+	assert.Equal(t, 1, clk.Waiters())
+
+	assert.False(t, timer.Reset(time.Second))
+	clk.Set(start.Add(time.Hour))
+	_, ok = receive(timer.C())
+	assert.True(t, ok)
+	_, ok = receive(ticker.C())
+	assert.True(t, ok)
+
+	ticker.Reset(time.Second)
+	clk.Advance(time.Second)
+	ts, ok = receive(ticker.C())
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Hour+time.Second), ts)
+	ticker.Stop()
+	assert.Equal(t, 0, clk.Waiters())
+
+	// Zero duration timers fire immediately.
+	_, ok = receive(clk.After(0))
+	assert.True(t, ok)
+	assert.Panics(t, func() { clk.NewTicker(0) })
+}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert.Equal(t, Real, FromContext(ctx))
+	assert.WithinDuration(t, time.Now(), Now(ctx), time.Second)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := NewMock(start)
+	ctx = WithContext(ctx, clk)
+	assert.Equal(t, Clock(clk), FromContext(ctx))
+	assert.Equal(t, start, Now(ctx))
+	clk.Advance(time.Second)
+	assert.Equal(t, time.Second, Since(ctx, start))
+
+	assert.Equal(t, Real, FromContext(WithContext(ctx, nil)))
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+type clockContextKeyType struct{}
+
+var clockContextKey clockContextKeyType
+
+// WithContext returns a context carrying the clock.
+func WithContext(ctx context.Context, clk Clock) context.Context {
+	return context.WithValue(ctx, clockContextKey, clk)
+}
+
+// FromContext returns the clock of the context, or Real if the context
+// does not carry a clock.
+func FromContext(ctx context.Context) Clock {
+	if clk, ok := ctx.Value(clockContextKey).(Clock); ok && clk != nil {
+		return clk
+	}
+	return Real
+}
+
+// Now returns the current time of the clock of the context.
+func Now(ctx context.Context) time.Time {
+	return FromContext(ctx).Now()
+}
+
+// Since returns the time elapsed since t according to the clock of the
+// context.
+func Since(ctx context.Context, t time.Time) time.Duration {
+	return FromContext(ctx).Since(t)
+}
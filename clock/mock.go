@@ -0,0 +1,202 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mock is a Clock which only moves when told to. Timers and tickers fire
+// when the clock is advanced past their deadline. A Mock is safe for
+// concurrent use.
+type Mock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*mockWaiter
+}
+
+type mockWaiter struct {
+	clock    *Mock
+	deadline time.Time
+	// period is non-zero for tickers.
+	period time.Duration
+	c      chan time.Time
+	active bool
+}
+
+// NewMock creates a Mock clock set to now.
+func NewMock(now time.Time) *Mock {
+	return &Mock{now: now}
+}
+
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *Mock) Since(t time.Time) time.Duration {
+	return m.Now().Sub(t)
+}
+
+// Set moves the clock to now, firing the timers and tickers due. The
+// clock can be moved backwards, in which case nothing fires.
+func (m *Mock) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+	m.fire()
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers
+// due.
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+	m.fire()
+}
+
+// Waiters returns the number of active timers and tickers; useful for
+// synchronizing with goroutines which are about to wait on the clock.
+func (m *Mock) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
+
+func (m *Mock) fire() {
+	sort.SliceStable(m.waiters, func(i, j int) bool {
+		return m.waiters[i].deadline.Before(m.waiters[j].deadline)
+	})
+	var pending []*mockWaiter
+	for _, w := range m.waiters {
+		if w.deadline.After(m.now) {
+			pending = append(pending, w)
+			continue
+		}
+		// Like time.Ticker, drop ticks for slow receivers.
+		select {
+		case w.c <- w.deadline:
+		default:
+		}
+		if w.period > 0 {
+			for !w.deadline.After(m.now) {
+				w.deadline = w.deadline.Add(w.period)
+			}
+			pending = append(pending, w)
+		} else {
+			w.active = false
+		}
+	}
+	m.waiters = pending
+}
+
+func (m *Mock) add(w *mockWaiter) {
+	w.active = true
+	m.waiters = append(m.waiters, w)
+	m.fire()
+}
+
+func (m *Mock) remove(w *mockWaiter) bool {
+	if !w.active {
+		return false
+	}
+	w.active = false
+	for i, other := range m.waiters {
+		if other == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (m *Mock) newWaiter(d, period time.Duration) *mockWaiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := &mockWaiter{
+		clock:    m,
+		deadline: m.now.Add(d),
+		period:   period,
+		c:        make(chan time.Time, 1),
+	}
+	m.add(w)
+	return w
+}
+
+func (m *Mock) After(d time.Duration) <-chan time.Time {
+	return m.newWaiter(d, 0).c
+}
+
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	return (*mockTimer)(m.newWaiter(d, 0))
+}
+
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return (*mockTicker)(m.newWaiter(d, d))
+}
+
+type mockTimer mockWaiter
+
+func (t *mockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *mockTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove((*mockWaiter)(t))
+}
+
+func (t *mockTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	w := (*mockWaiter)(t)
+	active := t.clock.remove(w)
+	w.deadline = t.clock.now.Add(d)
+	t.clock.add(w)
+	return active
+}
+
+type mockTicker mockWaiter
+
+func (t *mockTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *mockTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.remove((*mockWaiter)(t))
+}
+
+func (t *mockTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	w := (*mockWaiter)(t)
+	t.clock.remove(w)
+	w.period = d
+	w.deadline = t.clock.now.Add(d)
+	t.clock.add(w)
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package concurrency provides middlewares limiting the number of requests
+// processed concurrently on behalf of a single tenant.
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const (
+	DefaultMaxInFlight  = 16
+	DefaultBurst        = 16
+	DefaultQueueTimeout = time.Second * 5
+)
+
+var (
+	// ErrQueueFull is returned when both the in-flight and burst capacity
+	// of the tenant is exhausted.
+	ErrQueueFull = errors.New("too many concurrent requests")
+	// ErrQueueTimeout is returned when the request did not get a slot
+	// within the queue timeout.
+	ErrQueueTimeout = errors.New("timeout waiting for request slot")
+)
+
+// KeyFunc returns the key used for grouping requests. Requests with an
+// empty key are not limited.
+type KeyFunc func(c *gin.Context) string
+
+// TenantKey returns the tenant ID from the identity in the request context.
+func TenantKey(c *gin.Context) string {
+	if id := identity.FromContext(c.Request.Context()); id != nil {
+		return id.Tenant
+	}
+	return ""
+}
+
+type MiddlewareOptions struct {
+	// MaxInFlight is the maximum number of requests processed concurrently
+	// per key (default: DefaultMaxInFlight).
+	MaxInFlight *int
+
+	// Burst is the number of requests allowed to queue up waiting for a
+	// slot when MaxInFlight is reached. Requests exceeding the burst are
+	// rejected with 429 Too Many Requests (default: DefaultBurst).
+	Burst *int
+
+	// QueueTimeout is the maximum duration a request will wait in queue
+	// before it is rejected with 503 Service Unavailable
+	// (default: DefaultQueueTimeout).
+	QueueTimeout *time.Duration
+
+	// KeyFunc selects the key for grouping requests (default: TenantKey).
+	KeyFunc KeyFunc
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetMaxInFlight(n int) *MiddlewareOptions {
+	opts.MaxInFlight = &n
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetBurst(n int) *MiddlewareOptions {
+	opts.Burst = &n
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetQueueTimeout(timeout time.Duration) *MiddlewareOptions {
+	opts.QueueTimeout = &timeout
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetKeyFunc(keyFunc KeyFunc) *MiddlewareOptions {
+	opts.KeyFunc = keyFunc
+	return opts
+}
+
+// Middleware limits the number of requests processed concurrently for each
+// tenant. This middleware must be installed after the identity middleware.
+func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
+	opt := NewMiddlewareOptions().
+		SetMaxInFlight(DefaultMaxInFlight).
+		SetBurst(DefaultBurst).
+		SetQueueTimeout(DefaultQueueTimeout).
+		SetKeyFunc(TenantKey)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.MaxInFlight != nil {
+			opt.MaxInFlight = o.MaxInFlight
+		}
+		if o.Burst != nil {
+			opt.Burst = o.Burst
+		}
+		if o.QueueTimeout != nil {
+			opt.QueueTimeout = o.QueueTimeout
+		}
+		if o.KeyFunc != nil {
+			opt.KeyFunc = o.KeyFunc
+		}
+	}
+	l := newLimiter(*opt.MaxInFlight, *opt.Burst)
+	queueTimeout := *opt.QueueTimeout
+	keyFunc := opt.KeyFunc
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		if key == "" {
+			return
+		}
+		release, err := l.acquire(c.Request.Context(), key, queueTimeout)
+		switch {
+		case err == nil:
+			defer release()
+			c.Next()
+
+		case errors.Is(err, ErrQueueFull):
+			rest.RenderError(c, http.StatusTooManyRequests, err)
+			c.Abort()
+
+		case errors.Is(err, ErrQueueTimeout):
+			rest.RenderError(c, http.StatusServiceUnavailable, err)
+			c.Abort()
+
+		default:
+			// Context canceled while waiting
+			c.Abort()
+		}
+	}
+}
+
+type semaphore struct {
+	slots chan struct{}
+	refs  int
+}
+
+type limiter struct {
+	mu          sync.Mutex
+	sems        map[string]*semaphore
+	maxInFlight int
+	burst       int
+}
+
+func newLimiter(maxInFlight, burst int) *limiter {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	if burst < 0 {
+		burst = 0
+	}
+	return &limiter{
+		sems:        make(map[string]*semaphore),
+		maxInFlight: maxInFlight,
+		burst:       burst,
+	}
+}
+
+func (l *limiter) unref(key string, sem *semaphore) {
+	l.mu.Lock()
+	sem.refs--
+	if sem.refs == 0 {
+		delete(l.sems, key)
+	}
+	l.mu.Unlock()
+}
+
+func (l *limiter) acquire(
+	ctx context.Context,
+	key string,
+	timeout time.Duration,
+) (func(), error) {
+	l.mu.Lock()
+	sem, ok := l.sems[key]
+	if !ok {
+		sem = &semaphore{slots: make(chan struct{}, l.maxInFlight)}
+		l.sems[key] = sem
+	} else if sem.refs >= l.maxInFlight+l.burst {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	sem.refs++
+	l.mu.Unlock()
+
+	release := func() {
+		<-sem.slots
+		l.unref(key, sem)
+	}
+	select {
+	case sem.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case sem.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		l.unref(key, sem)
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		l.unref(key, sem)
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package concurrency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func newRouter(
+	opts *MiddlewareOptions,
+	handler gin.HandlerFunc,
+) *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if tenant := c.GetHeader("X-Tenant"); tenant != "" {
+			ctx := identity.WithContext(
+				c.Request.Context(),
+				&identity.Identity{Subject: "user", Tenant: tenant},
+			)
+			c.Request = c.Request.WithContext(ctx)
+		}
+	})
+	router.Use(Middleware(opts))
+	router.GET("/test", handler)
+	return router
+}
+
+func doRequest(router http.Handler, tenant string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	if tenant != "" {
+		req.Header.Set("X-Tenant", tenant)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	t.Run("limits per tenant", func(t *testing.T) {
+		t.Parallel()
+		var (
+			block   = make(chan struct{})
+			started = make(chan struct{}, 4)
+			wg      sync.WaitGroup
+		)
+		router := newRouter(NewMiddlewareOptions().
+			SetMaxInFlight(1).
+			SetBurst(1).
+			SetQueueTimeout(time.Second*10),
+			func(c *gin.Context) {
+				started <- struct{}{}
+				<-block
+				c.Status(http.StatusNoContent)
+			})
+
+		codes := make(chan int, 2)
+		wg.Add(2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				defer wg.Done()
+				codes <- doRequest(router, "tenant1").Code
+			}()
+		}
+		<-started
+		// Wait for the second request to be queued
+		time.Sleep(time.Millisecond * 50)
+
+		// Third request exceeds burst
+		w := doRequest(router, "tenant1")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.JSONEq(t,
+			`{"error": "too many concurrent requests"}`,
+			w.Body.String(),
+		)
+
+		// Other tenants and requests without identity are not affected
+		close(block)
+		assert.Equal(t, http.StatusNoContent, doRequest(router, "tenant2").Code)
+		assert.Equal(t, http.StatusNoContent, doRequest(router, "").Code)
+
+		wg.Wait()
+		close(codes)
+		for code := range codes {
+			assert.Equal(t, http.StatusNoContent, code)
+		}
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		t.Parallel()
+		block := make(chan struct{})
+		started := make(chan struct{})
+		router := newRouter(NewMiddlewareOptions().
+			SetMaxInFlight(1).
+			SetQueueTimeout(time.Millisecond*10),
+			func(c *gin.Context) {
+				close(started)
+				<-block
+				c.Status(http.StatusNoContent)
+			})
+		done := make(chan struct{})
+		go func() {
+			doRequest(router, "tenant")
+			close(done)
+		}()
+		<-started
+		w := doRequest(router, "tenant")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		close(block)
+		<-done
+	})
+}
+
+func TestLimiterRelease(t *testing.T) {
+	t.Parallel()
+	l := newLimiter(2, 0)
+	ctx := context.Background()
+	r1, err := l.acquire(ctx, "key", time.Second)
+	assert.NoError(t, err)
+	r2, err := l.acquire(ctx, "key", time.Second)
+	assert.NoError(t, err)
+	_, err = l.acquire(ctx, "key", time.Second)
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	r1()
+	r2()
+	l.mu.Lock()
+	assert.Empty(t, l.sems, "idle semaphores are not released")
+	l.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	l = newLimiter(1, 1)
+	r1, _ = l.acquire(ctx, "key", time.Second)
+	_, err = l.acquire(ctx, "key", time.Second)
+	assert.ErrorIs(t, err, context.Canceled)
+	r1()
+}
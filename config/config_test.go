@@ -17,6 +17,9 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
 )
 
 type MockConfigReader struct{}
@@ -107,3 +110,35 @@ func TestFromConfigFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestGetUnits(t *testing.T) {
+	c := viper.New()
+	c.Set("retention", "7d")
+	c.Set("timeout", time.Minute)
+	c.Set("max_size", "1.5GiB")
+	c.Set("chunk_size", 4096)
+	c.Set("invalid", "forever")
+
+	d, err := GetDuration(c, "retention")
+	assert.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, d)
+	d, err = GetDuration(c, "timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, d)
+	_, err = GetDuration(c, "invalid")
+	assert.ErrorContains(t, err, `invalid value of "invalid"`)
+
+	n, err := GetByteSize(c, "max_size")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1536*1024*1024), n)
+	n, err = GetByteSize(c, "chunk_size")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4096), n)
+	n, err = GetByteSize(c, "missing")
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	assert.NoError(t, ValidateConfig(c,
+		ValidateDuration("retention"), ValidateByteSize("max_size")))
+	assert.Error(t, ValidateConfig(c, ValidateByteSize("invalid")))
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/units"
+)
+
+// GetDuration returns the duration at key, accepting the units of
+// units.ParseDuration (e.g. "7d"). Numeric values are interpreted like
+// Reader.GetDuration.
+func GetDuration(c Reader, key string) (time.Duration, error) {
+	s, ok := c.Get(key).(string)
+	if !ok {
+		return c.GetDuration(key), nil
+	}
+	d, err := units.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid value of %q", key)
+	}
+	return d, nil
+}
+
+// GetByteSize returns the byte size at key, accepting the units of
+// units.ParseByteSize (e.g. "1.5GB"). Numeric values are bytes.
+func GetByteSize(c Reader, key string) (int64, error) {
+	switch v := c.Get(key).(type) {
+	case nil:
+		return 0, nil
+	case string:
+		n, err := units.ParseByteSize(v)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid value of %q", key)
+		}
+		return n, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	default:
+		return int64(c.GetInt(key)), nil
+	}
+}
+
+// ValidateDuration returns a Validator checking that the value at key is
+// a valid duration.
+func ValidateDuration(key string) Validator {
+	return func(c Reader) error {
+		_, err := GetDuration(c, key)
+		return err
+	}
+}
+
+// ValidateByteSize returns a Validator checking that the value at key is
+// a valid byte size.
+func ValidateByteSize(key string) Validator {
+	return func(c Reader) error {
+		_, err := GetByteSize(c, key)
+		return err
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Value is an atomically updated snapshot of a configuration value, safe
+// for concurrent use.
+type Value[T any] struct {
+	v atomic.Value
+}
+
+type valueBox[T any] struct {
+	value T
+}
+
+func NewValue[T any](value T) *Value[T] {
+	ret := new(Value[T])
+	ret.Store(value)
+	return ret
+}
+
+// Load returns the current value.
+func (v *Value[T]) Load() T {
+	box, _ := v.v.Load().(valueBox[T])
+	return box.value
+}
+
+func (v *Value[T]) Store(value T) {
+	v.v.Store(valueBox[T]{value: value})
+}
+
+// ReloadErrors collects the errors of the listeners failing to apply the
+// reloaded configuration.
+type ReloadErrors []error
+
+func (errs ReloadErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return "config: failed to apply configuration: " + strings.Join(msgs, "; ")
+}
+
+// Watcher propagates the changes of the configuration to the registered
+// components at runtime, e.g. the log level, rate limits or maintenance
+// mode:
+//
+//	watcher := config.NewWatcher(config.Config, validators...)
+//	maintenance, err := config.Watch(watcher, func(c config.Reader) (bool, error) {
+//		return c.GetBool(SettingMaintenance), nil
+//	})
+//	...
+//	config.WatchFile(config.Config, watcher, onError)
+//	...
+//	if maintenance.Load() {
+type Watcher struct {
+	mu         sync.Mutex
+	config     Reader
+	validators []Validator
+	listeners  []func(c Reader) error
+}
+
+// NewWatcher creates a watcher of the configuration; reloaded
+// configurations failing the validators are not propagated.
+func NewWatcher(c Reader, validators ...Validator) *Watcher {
+	return &Watcher{
+		config:     c,
+		validators: validators,
+	}
+}
+
+// OnChange registers the listener called with the configuration on every
+// Reload. The listener is called immediately with the current
+// configuration and is not registered if it returns an error.
+func (w *Watcher) OnChange(listener func(c Reader) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := listener(w.config); err != nil {
+		return err
+	}
+	w.listeners = append(w.listeners, listener)
+	return nil
+}
+
+// Watch returns the snapshot of the value parsed from the configuration,
+// updated on every Reload. If parsing the reloaded configuration fails,
+// the previous value is kept.
+func Watch[T any](w *Watcher, parse func(c Reader) (T, error)) (*Value[T], error) {
+	value := new(Value[T])
+	err := w.OnChange(func(c Reader) error {
+		v, err := parse(c)
+		if err != nil {
+			return err
+		}
+		value.Store(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Reload validates the current configuration and propagates it to the
+// listeners. All the listeners are called even if some of them fail; the
+// errors are returned as ReloadErrors.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := ValidateConfig(w.config, w.validators...); err != nil {
+		return errors.Wrap(err, "config: failed to validate configuration")
+	}
+	var errs ReloadErrors
+	for _, listener := range w.listeners {
+		if err := listener(w.config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// WatchFile reloads the watcher whenever the configuration file of v
+// changes. onError, if not nil, receives the errors of the reloads.
+func WatchFile(v *viper.Viper, w *Watcher, onError func(err error)) {
+	v.OnConfigChange(func(fsnotify.Event) {
+		if err := w.Reload(); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+	v.WatchConfig()
+}
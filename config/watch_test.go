@@ -0,0 +1,128 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+	var zero Value[int]
+	assert.Equal(t, 0, zero.Load())
+	v := NewValue("foo")
+	assert.Equal(t, "foo", v.Load())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Store("bar")
+			_ = v.Load()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, "bar", v.Load())
+}
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+	errNegative := errors.New("rate must not be negative")
+	c := viper.New()
+	c.Set("rate", 10)
+	c.Set("maintenance", false)
+	w := NewWatcher(c, func(c Reader) error {
+		if c.GetInt("limit") < 0 {
+			return errors.New("invalid limit")
+		}
+		return nil
+	})
+
+	rate, err := Watch(w, func(c Reader) (int, error) {
+		if rate := c.GetInt("rate"); rate >= 0 {
+			return rate, nil
+		}
+		return 0, errNegative
+	})
+	require.NoError(t, err)
+	var changes []bool
+	err = w.OnChange(func(c Reader) error {
+		changes = append(changes, c.GetBool("maintenance"))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, rate.Load())
+	assert.Equal(t, []bool{false}, changes)
+
+	c.Set("rate", 20)
+	c.Set("maintenance", true)
+	assert.NoError(t, w.Reload())
+	assert.Equal(t, 20, rate.Load())
+	assert.Equal(t, []bool{false, true}, changes)
+
+	// The previous value is kept if the new value is invalid
+	c.Set("rate", -1)
+	err = w.Reload()
+	var errs ReloadErrors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Equal(t, ReloadErrors{errNegative}, errs)
+	}
+	assert.Equal(t, 20, rate.Load())
+	assert.Equal(t, []bool{false, true, true}, changes)
+
+	// Invalid configurations are not propagated
+	c.Set("limit", -1)
+	assert.Error(t, w.Reload())
+	assert.Len(t, changes, 3)
+
+	// Listeners failing the initial configuration are not registered
+	_, err = Watch(w, func(c Reader) (int, error) {
+		return 0, errNegative
+	})
+	assert.ErrorIs(t, err, errNegative)
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("level: info\n"), 0600))
+	c := viper.New()
+	c.SetConfigFile(path)
+	require.NoError(t, c.ReadInConfig())
+
+	w := NewWatcher(c)
+	level, err := Watch(w, func(c Reader) (string, error) {
+		return c.GetString("level"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "info", level.Load())
+
+	WatchFile(c, w, func(err error) {
+		t.Errorf("unexpected reload error: %s", err)
+	})
+	require.NoError(t, os.WriteFile(path, []byte("level: debug\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return level.Load() == "debug"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package debug serves the runtime diagnostics of the service (pprof
+// profiles, expvar variables and goroutine dumps) on a separate internal
+// listener. The server is disabled unless enabled in the configuration.
+//
+// Note that net/http/pprof and expvar also register their handlers on
+// http.DefaultServeMux, which must therefore not be exposed publicly.
+package debug
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	rpprof "runtime/pprof"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+)
+
+const (
+	SettingEnabled      = "debug_enabled"
+	SettingListen       = "debug_listen"
+	SettingTraceEnabled = "debug_trace_enabled"
+
+	DefaultListen = "localhost:6060"
+
+	PathPrefix     = "/debug/pprof/"
+	PathVars       = "/debug/vars"
+	PathGoroutines = "/debug/goroutines"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+type Options struct {
+	// Enabled starts the debug server (default: false).
+	Enabled *bool
+	// Listen is the address of the debug server (default: DefaultListen).
+	Listen *string
+	// TraceEnabled serves on-demand execution traces on
+	// /debug/pprof/trace (default: false). Tracing has a significant
+	// overhead while active.
+	TraceEnabled *bool
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+// NewOptionsFromConfig reads the options from the settings SettingEnabled,
+// SettingListen and SettingTraceEnabled.
+func NewOptionsFromConfig(c config.Reader) *Options {
+	opts := NewOptions()
+	if c.IsSet(SettingEnabled) {
+		opts.SetEnabled(c.GetBool(SettingEnabled))
+	}
+	if c.IsSet(SettingListen) {
+		opts.SetListen(c.GetString(SettingListen))
+	}
+	if c.IsSet(SettingTraceEnabled) {
+		opts.SetTraceEnabled(c.GetBool(SettingTraceEnabled))
+	}
+	return opts
+}
+
+func (opts *Options) SetEnabled(enabled bool) *Options {
+	opts.Enabled = &enabled
+	return opts
+}
+
+func (opts *Options) SetListen(addr string) *Options {
+	opts.Listen = &addr
+	return opts
+}
+
+func (opts *Options) SetTraceEnabled(enabled bool) *Options {
+	opts.TraceEnabled = &enabled
+	return opts
+}
+
+func mergeOptions(opts ...*Options) *Options {
+	opt := &Options{
+		Enabled:      new(bool),
+		TraceEnabled: new(bool),
+	}
+	listen := DefaultListen
+	opt.Listen = &listen
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Enabled != nil {
+			opt.Enabled = o.Enabled
+		}
+		if o.Listen != nil {
+			opt.Listen = o.Listen
+		}
+		if o.TraceEnabled != nil {
+			opt.TraceEnabled = o.TraceEnabled
+		}
+	}
+	return opt
+}
+
+func goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// NewHandler returns the handler serving the diagnostics endpoints:
+//
+//	/debug/pprof/            the pprof profiles
+//	/debug/pprof/trace       execution traces (if TraceEnabled)
+//	/debug/vars              the expvar variables
+//	/debug/goroutines        the stack traces of all goroutines
+func NewHandler(opts ...*Options) http.Handler {
+	opt := mergeOptions(opts...)
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathPrefix, pprof.Index)
+	mux.HandleFunc(PathPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PathPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(PathPrefix+"symbol", pprof.Symbol)
+	if *opt.TraceEnabled {
+		mux.HandleFunc(PathPrefix+"trace", pprof.Trace)
+	} else {
+		mux.Handle(PathPrefix+"trace", http.NotFoundHandler())
+	}
+	mux.Handle(PathVars, expvar.Handler())
+	mux.HandleFunc(PathGoroutines, goroutines)
+	return mux
+}
+
+// Serve serves the diagnostics endpoints until the context is canceled.
+// It returns immediately if the server is not enabled.
+func Serve(ctx context.Context, opts ...*Options) error {
+	opt := mergeOptions(opts...)
+	if !*opt.Enabled {
+		return nil
+	}
+	listener, err := net.Listen("tcp", *opt.Listen)
+	if err != nil {
+		return errors.Wrap(err, "debug: failed to listen")
+	}
+	return serve(ctx, listener, NewHandler(opt))
+}
+
+func serve(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Serve(listener)
+	}()
+	select {
+	case err := <-errChan:
+		return errors.Wrap(err, "debug: server failed")
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHandler(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Options *Options
+
+		Path   string
+		Status int
+		Body   string
+	}{{
+		Name:   "pprof index",
+		Path:   PathPrefix,
+		Status: http.StatusOK,
+		Body:   "goroutine",
+	}, {
+		Name:   "heap profile",
+		Path:   PathPrefix + "heap?debug=1",
+		Status: http.StatusOK,
+		Body:   "heap profile",
+	}, {
+		Name:   "goroutines",
+		Path:   PathGoroutines,
+		Status: http.StatusOK,
+		Body:   "goroutine",
+	}, {
+		Name:   "trace disabled",
+		Path:   PathPrefix + "trace?seconds=0.01",
+		Status: http.StatusNotFound,
+	}, {
+		Name:    "trace enabled",
+		Options: NewOptions().SetTraceEnabled(true),
+		Path:    PathPrefix + "trace?seconds=0.01",
+		Status:  http.StatusOK,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.Path, nil)
+			NewHandler(tc.Options).ServeHTTP(w, req)
+			assert.Equal(t, tc.Status, w.Code)
+			assert.Contains(t, w.Body.String(), tc.Body)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, PathVars, nil))
+	var vars map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &vars)) {
+		assert.Contains(t, vars, "memstats")
+	}
+}
+
+func TestNewOptionsFromConfig(t *testing.T) {
+	c := viper.New()
+	opts := mergeOptions(NewOptionsFromConfig(c))
+	assert.False(t, *opts.Enabled)
+	assert.Equal(t, DefaultListen, *opts.Listen)
+	assert.False(t, *opts.TraceEnabled)
+
+	c.Set(SettingEnabled, true)
+	c.Set(SettingListen, ":6061")
+	c.Set(SettingTraceEnabled, true)
+	opts = mergeOptions(NewOptionsFromConfig(c))
+	assert.True(t, *opts.Enabled)
+	assert.Equal(t, ":6061", *opts.Listen)
+	assert.True(t, *opts.TraceEnabled)
+}
+
+func TestServe(t *testing.T) {
+	// Disabled by default
+	assert.NoError(t, Serve(context.Background()))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- serve(ctx, listener, NewHandler())
+	}()
+	rsp, err := http.Get("http://" + listener.Addr().String() + PathGoroutines)
+	if assert.NoError(t, err) {
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	}
+	cancel()
+	select {
+	case err := <-errChan:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Error("server did not shut down")
+	}
+
+	err = Serve(context.Background(), NewOptions().
+		SetEnabled(true).
+		SetListen("256.0.0.1:0"))
+	assert.Error(t, err)
+}
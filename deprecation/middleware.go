@@ -0,0 +1,241 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package deprecation provides a middleware marking routes as deprecated
+// with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers and
+// counting the remaining usage per client.
+package deprecation
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+const (
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+	HeaderLink        = "Link"
+
+	// DefaultMaxClients is the default number of clients tracked per
+	// route by the UsageCounter.
+	DefaultMaxClients = 10000
+
+	// OtherClients is the client key counting the usage of the clients
+	// exceeding the limit of the UsageCounter.
+	OtherClients = "other"
+
+	fieldDeprecatedRoute = "deprecated_route"
+	fieldDeprecatedUsage = "deprecated_usage"
+	fieldClient          = "deprecated_client"
+)
+
+// ClientKeyFunc identifies the client of a request for the usage counter.
+type ClientKeyFunc func(c *gin.Context) string
+
+// DefaultClientKey identifies the client by the identity subject and
+// tenant or, for unauthenticated requests, by the client IP.
+func DefaultClientKey(c *gin.Context) string {
+	if id := identity.FromContext(c.Request.Context()); id != nil {
+		if id.Tenant != "" {
+			return id.Tenant + "/" + id.Subject
+		}
+		return id.Subject
+	}
+	return c.ClientIP()
+}
+
+// UsageCounter counts the calls to deprecated routes per client. It is
+// safe for concurrent use and may be shared between middlewares.
+type UsageCounter struct {
+	// MaxClients limits the number of clients tracked per route, the
+	// usage by additional clients is counted as OtherClients. The
+	// default is DefaultMaxClients.
+	MaxClients int
+
+	mu     sync.Mutex
+	routes map[string]map[string]uint64
+}
+
+func NewUsageCounter() *UsageCounter {
+	return &UsageCounter{MaxClients: DefaultMaxClients}
+}
+
+// Add increments and returns the usage count of the route by the client.
+func (u *UsageCounter) Add(route, client string) uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.routes == nil {
+		u.routes = make(map[string]map[string]uint64)
+	}
+	clients, ok := u.routes[route]
+	if !ok {
+		clients = make(map[string]uint64)
+		u.routes[route] = clients
+	}
+	maxClients := u.MaxClients
+	if maxClients <= 0 {
+		maxClients = DefaultMaxClients
+	}
+	if _, ok := clients[client]; !ok && len(clients) >= maxClients {
+		client = OtherClients
+	}
+	clients[client]++
+	return clients[client]
+}
+
+// Snapshot returns a copy of the usage counts by route and client.
+func (u *UsageCounter) Snapshot() map[string]map[string]uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ret := make(map[string]map[string]uint64, len(u.routes))
+	for route, clients := range u.routes {
+		cpy := make(map[string]uint64, len(clients))
+		for client, n := range clients {
+			cpy[client] = n
+		}
+		ret[route] = cpy
+	}
+	return ret
+}
+
+type MiddlewareOptions struct {
+	// Since is the time the route was deprecated. If nil, the
+	// Deprecation header is set to "true".
+	Since *time.Time
+	// Sunset is the time the route is expected to be removed.
+	Sunset *time.Time
+	// Link is the URL of the deprecation notice or migration guide.
+	Link *string
+	// ClientKey identifies the client of the request, the default is
+	// DefaultClientKey.
+	ClientKey ClientKeyFunc
+	// Counter counts the usage; the default is a new counter for the
+	// middleware.
+	Counter *UsageCounter
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetSince(since time.Time) *MiddlewareOptions {
+	opts.Since = &since
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetSunset(sunset time.Time) *MiddlewareOptions {
+	opts.Sunset = &sunset
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetLink(link string) *MiddlewareOptions {
+	opts.Link = &link
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetClientKey(fn ClientKeyFunc) *MiddlewareOptions {
+	opts.ClientKey = fn
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetCounter(counter *UsageCounter) *MiddlewareOptions {
+	opts.Counter = counter
+	return opts
+}
+
+// Middleware marks the routes it is applied to as deprecated. It adds the
+// Deprecation, Sunset and Link headers to the response and logs the
+// route, the client and its usage count with the access log entry (or a
+// separate entry if there is no access log).
+func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
+	opt := NewMiddlewareOptions()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Since != nil {
+			opt.Since = o.Since
+		}
+		if o.Sunset != nil {
+			opt.Sunset = o.Sunset
+		}
+		if o.Link != nil {
+			opt.Link = o.Link
+		}
+		if o.ClientKey != nil {
+			opt.ClientKey = o.ClientKey
+		}
+		if o.Counter != nil {
+			opt.Counter = o.Counter
+		}
+	}
+	deprecation := "true"
+	if opt.Since != nil {
+		deprecation = "@" + strconv.FormatInt(opt.Since.Unix(), 10)
+	}
+	var sunset, link string
+	if opt.Sunset != nil {
+		sunset = opt.Sunset.UTC().Format(http.TimeFormat)
+	}
+	if opt.Link != nil {
+		link = fmt.Sprintf(`<%s>; rel="deprecation"`, *opt.Link)
+	}
+	clientKey := opt.ClientKey
+	if clientKey == nil {
+		clientKey = DefaultClientKey
+	}
+	counter := opt.Counter
+	if counter == nil {
+		counter = NewUsageCounter()
+	}
+
+	return func(c *gin.Context) {
+		hdr := c.Writer.Header()
+		hdr.Set(HeaderDeprecation, deprecation)
+		if sunset != "" {
+			hdr.Set(HeaderSunset, sunset)
+		}
+		if link != "" {
+			hdr.Add(HeaderLink, link)
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		client := clientKey(c)
+		usage := counter.Add(route, client)
+
+		ctx := c.Request.Context()
+		if lc := accesslog.GetContext(ctx); lc != nil {
+			lc.SetField(fieldDeprecatedRoute, route)
+			lc.SetField(fieldClient, client)
+			lc.SetField(fieldDeprecatedUsage, usage)
+		} else {
+			log.FromContext(ctx).F(log.Ctx{
+				fieldDeprecatedRoute: route,
+				fieldClient:          client,
+				fieldDeprecatedUsage: usage,
+			}).Info("deprecated route called")
+		}
+	}
+}
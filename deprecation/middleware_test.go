@@ -0,0 +1,135 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package deprecation
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logBuf = bytes.NewBuffer(nil)
+	logger := log.NewEmpty()
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	logger.Logger.SetOutput(logBuf)
+	logger.Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+	counter := NewUsageCounter()
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), logger)
+		if tenant := c.GetHeader("X-Tenant"); tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Subject: "user-1",
+				Tenant:  tenant,
+			})
+		}
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.GET("/v1/devices/:id", Middleware(NewMiddlewareOptions().
+		SetSince(since).
+		SetSunset(sunset).
+		SetLink("https://docs.example.com/migrate").
+		SetCounter(counter)),
+		func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/v2/devices/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	do := func(path, tenant string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/v1/devices/1", "tenant-1")
+	assert.Equal(t, "@1704067200", w.Header().Get(HeaderDeprecation))
+	assert.Equal(t, "Wed, 01 Jan 2025 00:00:00 GMT", w.Header().Get(HeaderSunset))
+	assert.Equal(t, `<https://docs.example.com/migrate>; rel="deprecation"`,
+		w.Header().Get(HeaderLink))
+	assert.Contains(t, logBuf.String(), "deprecated_route=\"/v1/devices/:id\"")
+	assert.Contains(t, logBuf.String(), "deprecated_client=tenant-1/user-1")
+	assert.Contains(t, logBuf.String(), "deprecated_usage=1")
+
+	do("/v1/devices/2", "tenant-1")
+	do("/v1/devices/1", "")
+	w = do("/v2/devices/1", "tenant-1")
+	assert.Empty(t, w.Header().Get(HeaderDeprecation))
+
+	assert.Equal(t, map[string]map[string]uint64{
+		"/v1/devices/:id": {
+			"tenant-1/user-1": 2,
+			"192.0.2.1":       1,
+		},
+	}, counter.Snapshot())
+}
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logBuf = bytes.NewBuffer(nil)
+	logger := log.NewEmpty()
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	logger.Logger.SetOutput(logBuf)
+	logger.Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), logger)
+		c.Request = c.Request.WithContext(ctx)
+	})
+	router.Use(accesslog.Middleware())
+	router.GET("/old", Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/old", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "true", w.Header().Get(HeaderDeprecation))
+	// The fields are added to the single access log entry.
+	assert.Equal(t, 1, bytes.Count(logBuf.Bytes(), []byte("\n")))
+	assert.Contains(t, logBuf.String(), "deprecated_usage=1")
+	assert.Contains(t, logBuf.String(), "status=204")
+}
+
+func TestUsageCounterMaxClients(t *testing.T) {
+	counter := &UsageCounter{MaxClients: 2}
+	counter.Add("/r", "a")
+	counter.Add("/r", "b")
+	counter.Add("/r", "c")
+	assert.Equal(t, uint64(2), counter.Add("/r", "d"))
+	assert.Equal(t, uint64(2), counter.Add("/r", "a"))
+	assert.Equal(t, map[string]uint64{"a": 2, "b": 1, OtherClients: 2},
+		counter.Snapshot()["/r"])
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package echomw adapts the shared middlewares to the Echo framework.
+package echomw
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// Identity adapts identity.HTTPMiddleware.
+func Identity(opts ...*identity.MiddlewareOptions) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(identity.HTTPMiddleware(opts...))
+}
+
+// RequestID adapts requestid.HTTPMiddleware.
+func RequestID(opts ...*requestid.MiddlewareOptions) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(requestid.HTTPMiddleware(opts...))
+}
+
+// RBAC adapts rbac.HTTPMiddleware.
+func RBAC(opts ...*rbac.MiddlewareOptions) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(rbac.HTTPMiddleware(opts...))
+}
+
+// AccessLog adapts accesslog.AccessLogger.Handler. Errors returned by the
+// handlers are added to the access log and rendered by the Echo error
+// handler before the entry is logged, such that the entry has the final
+// status. Use it after RequestID such that the entries include the
+// request ID.
+func AccessLog(logger accesslog.AccessLogger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			logger.Handler(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					c.SetRequest(r)
+					c.SetResponse(echo.NewResponse(w, c.Echo()))
+					if err := next(c); err != nil {
+						if lc := accesslog.GetContext(r.Context()); lc != nil {
+							lc.PushError(err)
+						}
+						c.Error(err)
+					}
+				})).ServeHTTP(c.Response(), c.Request())
+			return nil
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package echomw
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+func makeToken(id identity.Identity) string {
+	claims, _ := json.Marshal(id)
+	return "aGVhZGVy." + base64.RawURLEncoding.EncodeToString(claims) + ".c2lnbg"
+}
+
+func TestMiddlewares(t *testing.T) {
+	logBuf := bytes.NewBuffer(nil)
+	logger := log.NewEmpty()
+	logger.Logger.SetOutput(logBuf)
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	logger.Logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := log.WithContext(c.Request().Context(), logger)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+	e.Use(RequestID())
+	e.Use(AccessLog(accesslog.AccessLogger{}))
+	e.Use(Identity())
+	e.Use(RBAC())
+	e.GET("/devices", func(c echo.Context) error {
+		ctx := c.Request().Context()
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"subject":    identity.FromContext(ctx).Subject,
+			"request_id": requestid.FromContext(ctx),
+			"groups":     rbac.FromContext(ctx).DeviceGroups,
+		})
+	})
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "no such device")
+	})
+
+	token := makeToken(identity.Identity{Subject: "user", Tenant: "tenant", IsUser: true})
+	req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(requestid.RequestIdHeader, "req-1")
+	req.Header.Set(rbac.ScopeHeader, "production")
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t,
+		`{"subject":"user","request_id":"req-1","groups":["production"]}`,
+		w.Body.String())
+	assert.Contains(t, logBuf.String(), "status=200")
+	assert.Contains(t, logBuf.String(), "request_id=req-1")
+
+	logBuf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, logBuf.String(), "status=404")
+	assert.Contains(t, logBuf.String(), "no such device")
+
+	logBuf.Reset()
+	req = httptest.NewRequest(http.MethodGet, "/devices", nil)
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, logBuf.String(), "status=401")
+}
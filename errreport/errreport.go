@@ -0,0 +1,142 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package errreport reports errors and panics to an error tracker such as
+// Sentry with the request ID and identity of the request.
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// Event is a reported error or panic.
+type Event struct {
+	// Err is the reported error; for panics it describes the panic
+	// value.
+	Err error
+	// Panic is the recovered value if the event is a panic.
+	Panic interface{}
+	// Stack is the traceback of the goroutine.
+	Stack string
+	// RequestID is the ID of the request, if any.
+	RequestID string
+	// Identity is the identity of the request, if any.
+	Identity *identity.Identity
+	// Tags are additional key/value pairs to index the event by.
+	Tags map[string]string
+	Time time.Time
+}
+
+// Reporter sends events to an error tracker. Report must not block the
+// caller for long, since it is called from the request path.
+type Reporter interface {
+	Report(ctx context.Context, event *Event) error
+}
+
+// ReporterFunc is a function implementing the Reporter interface.
+type ReporterFunc func(ctx context.Context, event *Event) error
+
+func (f ReporterFunc) Report(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(context.Context, *Event) error {
+	return nil
+}
+
+var defaultReporter = struct {
+	sync.RWMutex
+	Reporter
+}{Reporter: nopReporter{}}
+
+// SetDefault sets the reporter used when the context does not carry one.
+// A nil reporter disables reporting.
+func SetDefault(r Reporter) {
+	if r == nil {
+		r = nopReporter{}
+	}
+	defaultReporter.Lock()
+	defaultReporter.Reporter = r
+	defaultReporter.Unlock()
+}
+
+type reporterContextKeyType int
+
+const reporterContextKey reporterContextKeyType = 0
+
+// WithContext returns a context carrying the reporter.
+func WithContext(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterContextKey, r)
+}
+
+// FromContext returns the reporter from the context or the default
+// reporter.
+func FromContext(ctx context.Context) Reporter {
+	if r, ok := ctx.Value(reporterContextKey).(Reporter); ok && r != nil {
+		return r
+	}
+	defaultReporter.RLock()
+	defer defaultReporter.RUnlock()
+	return defaultReporter.Reporter
+}
+
+// Capture completes the event with the request ID, identity and time from
+// the context and reports it. Reporting errors are logged.
+func Capture(ctx context.Context, event *Event) {
+	if event.RequestID == "" {
+		event.RequestID = requestid.FromContext(ctx)
+	}
+	if event.Identity == nil {
+		event.Identity = identity.FromContext(ctx)
+	}
+	if event.Time.IsZero() {
+		event.Time = clock.Now(ctx)
+	}
+	if err := FromContext(ctx).Report(ctx, event); err != nil {
+		log.FromContext(ctx).
+			WithField("error", err.Error()).
+			Warn("errreport: failed to report event")
+	}
+}
+
+// CaptureError reports the error.
+func CaptureError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	Capture(ctx, &Event{Err: err})
+}
+
+// CapturePanic reports the recovered panic value with the traceback.
+func CapturePanic(ctx context.Context, value interface{}, stack string) {
+	err, ok := value.(error)
+	if !ok {
+		err = fmt.Errorf("panic: %v", value)
+	}
+	Capture(ctx, &Event{
+		Err:   err,
+		Panic: value,
+		Stack: stack,
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package errreport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+func TestCapture(t *testing.T) {
+	var events []*Event
+	reporter := ReporterFunc(func(_ context.Context, event *Event) error {
+		events = append(events, event)
+		return nil
+	})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := WithContext(context.Background(), reporter)
+	ctx = clock.WithContext(ctx, clock.NewMock(now))
+	ctx = requestid.WithContext(ctx, "1234")
+	ctx = identity.WithContext(ctx, &identity.Identity{Subject: "dev-1", IsDevice: true})
+
+	CaptureError(ctx, nil)
+	assert.Empty(t, events)
+
+	CaptureError(ctx, errors.New("failed"))
+	CapturePanic(ctx, "boom", "trace")
+	require.Len(t, events, 2)
+	assert.EqualError(t, events[0].Err, "failed")
+	assert.Equal(t, "1234", events[0].RequestID)
+	assert.Equal(t, "dev-1", events[0].Identity.Subject)
+	assert.Equal(t, now, events[0].Time)
+	assert.EqualError(t, events[1].Err, "panic: boom")
+	assert.Equal(t, "boom", events[1].Panic)
+	assert.Equal(t, "trace", events[1].Stack)
+
+	// The default reporter is used without a reporter in the context.
+	events = nil
+	SetDefault(reporter)
+	defer SetDefault(nil)
+	CaptureError(context.Background(), errors.New("failed"))
+	assert.Len(t, events, 1)
+}
+
+func TestNewSentryReporterDSN(t *testing.T) {
+	for _, dsn := range []string{
+		"",
+		"https://sentry.example.com/1",
+		"https://key@sentry.example.com/",
+		"ftp://key@sentry.example.com/1",
+		"://",
+	} {
+		_, err := NewSentryReporter(dsn)
+		assert.ErrorIs(t, err, ErrInvalidDSN, dsn)
+	}
+}
+
+func TestSentryReporter(t *testing.T) {
+	type request struct {
+		path, auth string
+		lines      []string
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path, auth: r.Header.Get("X-Sentry-Auth")}
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			req.lines = append(req.lines, s.Text())
+		}
+		requests <- req
+	}))
+	defer srv.Close()
+
+	dsn := strings.Replace(srv.URL, "://", "://public@", 1) + "/prefix/42"
+	reporter, err := NewSentryReporter(dsn, NewSentryOptions().
+		SetEnvironment("test").
+		SetRelease("1.0.0").
+		SetServerName("host-1"))
+	require.NoError(t, err)
+
+	err = reporter.Report(context.Background(), &Event{
+		Err:       errors.New("failed"),
+		Panic:     "failed",
+		Stack:     "main.main@main.go:1",
+		RequestID: "1234",
+		Identity:  &identity.Identity{Subject: "user-1", Tenant: "tenant-1"},
+		Time:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, reporter.Flush(ctx))
+
+	req := <-requests
+	assert.Equal(t, "/prefix/api/42/envelope/", req.path)
+	assert.Contains(t, req.auth, "sentry_key=public")
+	require.Len(t, req.lines, 3)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(req.lines[2]), &event))
+	assert.Contains(t, req.lines[0], event["event_id"].(string))
+	assert.Equal(t, "fatal", event["level"])
+	assert.Equal(t, "2024-01-01T00:00:00Z", event["timestamp"])
+	assert.Equal(t, "test", event["environment"])
+	assert.Equal(t, "1.0.0", event["release"])
+	assert.Equal(t, "host-1", event["server_name"])
+	assert.Equal(t, map[string]interface{}{
+		"request_id": "1234",
+		"tenant_id":  "tenant-1",
+	}, event["tags"])
+	assert.Equal(t, map[string]interface{}{"id": "user-1"}, event["user"])
+	assert.Equal(t, "main.main@main.go:1",
+		event["extra"].(map[string]interface{})["traceback"])
+
+	require.NoError(t, reporter.Close(ctx))
+	assert.ErrorIs(t, reporter.Report(ctx, &Event{}), ErrClosed)
+}
@@ -0,0 +1,349 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+const (
+	DefaultSentryQueueSize = 64
+	DefaultSentryTimeout   = 5 * time.Second
+
+	sentryClient  = "go-lib-micro/errreport"
+	sentryVersion = "7"
+)
+
+var (
+	ErrInvalidDSN = errors.New("errreport: invalid Sentry DSN")
+	ErrQueueFull  = errors.New("errreport: event queue is full")
+	ErrClosed     = errors.New("errreport: reporter is closed")
+)
+
+type SentryOptions struct {
+	// Environment is the environment of the events, e.g. "production".
+	Environment *string
+	// Release is the version of the service.
+	Release *string
+	// ServerName defaults to the hostname.
+	ServerName *string
+	// HTTPClient sends the events, the default is a client with
+	// DefaultSentryTimeout.
+	HTTPClient *http.Client
+	// QueueSize is the number of events buffered for sending, the
+	// default is DefaultSentryQueueSize. Events are dropped when the
+	// queue is full.
+	QueueSize *int
+}
+
+func NewSentryOptions() *SentryOptions {
+	return new(SentryOptions)
+}
+
+func (opts *SentryOptions) SetEnvironment(env string) *SentryOptions {
+	opts.Environment = &env
+	return opts
+}
+
+func (opts *SentryOptions) SetRelease(release string) *SentryOptions {
+	opts.Release = &release
+	return opts
+}
+
+func (opts *SentryOptions) SetServerName(name string) *SentryOptions {
+	opts.ServerName = &name
+	return opts
+}
+
+func (opts *SentryOptions) SetHTTPClient(client *http.Client) *SentryOptions {
+	opts.HTTPClient = client
+	return opts
+}
+
+func (opts *SentryOptions) SetQueueSize(size int) *SentryOptions {
+	opts.QueueSize = &size
+	return opts
+}
+
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Exception   *sentryExceptions      `json:"exception,omitempty"`
+	User        *sentryUser            `json:"user,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sentryUser struct {
+	ID string `json:"id"`
+}
+
+// SentryReporter sends the events to Sentry from a background goroutine
+// using the envelope endpoint of the Sentry HTTP API.
+type SentryReporter struct {
+	dsn        string
+	endpoint   string
+	auth       string
+	serverName string
+	env        string
+	release    string
+	client     *http.Client
+
+	queue chan sentryItem
+	done  chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type sentryItem struct {
+	event *sentryEvent
+	// flushed is closed when the events queued before are sent; set for
+	// flush markers only.
+	flushed chan struct{}
+}
+
+// NewSentryReporter creates a reporter sending to the project of the DSN
+// (https://<public key>@<host>/<project ID>).
+func NewSentryReporter(dsn string, opts ...*SentryOptions) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidDSN, err.Error())
+	}
+	key := u.User.Username()
+	idx := strings.LastIndexByte(u.Path, '/')
+	if (u.Scheme != "http" && u.Scheme != "https") ||
+		key == "" || u.Host == "" || idx < 0 || idx == len(u.Path)-1 {
+		return nil, ErrInvalidDSN
+	}
+	projectPath, projectID := u.Path[:idx], u.Path[idx+1:]
+
+	r := &SentryReporter{
+		dsn: dsn,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/",
+			u.Scheme, u.Host, projectPath, projectID),
+		auth: fmt.Sprintf("Sentry sentry_version=%s, sentry_client=%s, sentry_key=%s",
+			sentryVersion, sentryClient, key),
+		client: &http.Client{Timeout: DefaultSentryTimeout},
+	}
+	queueSize := DefaultSentryQueueSize
+	r.serverName, _ = os.Hostname()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Environment != nil {
+			r.env = *opt.Environment
+		}
+		if opt.Release != nil {
+			r.release = *opt.Release
+		}
+		if opt.ServerName != nil {
+			r.serverName = *opt.ServerName
+		}
+		if opt.HTTPClient != nil {
+			r.client = opt.HTTPClient
+		}
+		if opt.QueueSize != nil && *opt.QueueSize > 0 {
+			queueSize = *opt.QueueSize
+		}
+	}
+	r.queue = make(chan sentryItem, queueSize)
+	r.done = make(chan struct{})
+	go r.run()
+	return r, nil
+}
+
+func newEventID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (r *SentryReporter) newEvent(event *Event) *sentryEvent {
+	ret := &sentryEvent{
+		EventID:     newEventID(),
+		Timestamp:   event.Time.UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		ServerName:  r.serverName,
+		Environment: r.env,
+		Release:     r.release,
+		Tags:        make(map[string]string, len(event.Tags)+2),
+		Extra:       make(map[string]interface{}),
+	}
+	for k, v := range event.Tags {
+		ret.Tags[k] = v
+	}
+	if event.Panic != nil {
+		ret.Level = "fatal"
+	}
+	if event.Err != nil {
+		ret.Exception = &sentryExceptions{Values: []sentryException{{
+			Type:  fmt.Sprintf("%T", errors.Cause(event.Err)),
+			Value: event.Err.Error(),
+		}}}
+	}
+	if event.Stack != "" {
+		ret.Extra["traceback"] = event.Stack
+	}
+	if event.RequestID != "" {
+		ret.Tags["request_id"] = event.RequestID
+	}
+	if id := event.Identity; id != nil {
+		if id.Tenant != "" {
+			ret.Tags["tenant_id"] = id.Tenant
+		}
+		if id.IsDevice {
+			ret.Tags["device_id"] = id.Subject
+		} else {
+			ret.User = &sentryUser{ID: id.Subject}
+		}
+	}
+	return ret
+}
+
+// Report queues the event for sending; it returns ErrQueueFull if the
+// event was dropped.
+func (r *SentryReporter) Report(ctx context.Context, event *Event) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrClosed
+	}
+	select {
+	case r.queue <- sentryItem{event: r.newEvent(event)}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (r *SentryReporter) run() {
+	defer close(r.done)
+	for item := range r.queue {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+		if err := r.send(item.event); err != nil {
+			log.NewEmpty().
+				WithField("error", err.Error()).
+				Warn("errreport: failed to send event to Sentry")
+		}
+	}
+}
+
+func (r *SentryReporter) send(event *sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"dsn":      r.dsn,
+	})
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	rsp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	if rsp.StatusCode >= 300 {
+		return errors.Errorf("errreport: unexpected Sentry status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// Flush waits until the queued events are sent or the context is done.
+func (r *SentryReporter) Flush(ctx context.Context) error {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return nil
+	}
+	flushed := make(chan struct{})
+	select {
+	case r.queue <- sentryItem{flushed: flushed}:
+		r.mu.RUnlock()
+	case <-ctx.Done():
+		r.mu.RUnlock()
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the queued events and stops the reporter.
+func (r *SentryReporter) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
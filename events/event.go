@@ -0,0 +1,158 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package events defines the envelope for events exchanged between the
+// services over a message broker (e.g. NATS or Redis) and a registry of the
+// known event payload types.
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	ErrTypeRequired   = errors.New("events: event type is required")
+	ErrInvalidVersion = errors.New("events: event version must be positive")
+)
+
+// Envelope wraps an event payload with the metadata required to decode
+// it.
+type Envelope struct {
+	// Type is the event type, e.g. "deviceauth.device.accepted".
+	Type string `json:"type" msgpack:"type"`
+	// Version is the version of the payload schema.
+	Version int `json:"version" msgpack:"version"`
+	// TenantID is the tenant the event belongs to.
+	TenantID string `json:"tenant_id,omitempty" msgpack:"tenant_id,omitempty"`
+	// OccurredAt is the time the event occurred.
+	OccurredAt time.Time `json:"occurred_at" msgpack:"occurred_at"`
+	// Payload is the event payload. When decoded using a Registry, the
+	// payload is the value returned by the registered Factory.
+	Payload interface{} `json:"payload" msgpack:"payload"`
+}
+
+// NewEnvelope returns an envelope for the payload occurring now.
+func NewEnvelope(
+	eventType string,
+	version int,
+	tenantID string,
+	payload interface{},
+) *Envelope {
+	return &Envelope{
+		Type:       eventType,
+		Version:    version,
+		TenantID:   tenantID,
+		OccurredAt: time.Now().UTC(),
+		Payload:    payload,
+	}
+}
+
+// Validate checks that the envelope has a type and a valid version.
+func (env Envelope) Validate() error {
+	if env.Type == "" {
+		return ErrTypeRequired
+	}
+	if env.Version <= 0 {
+		return ErrInvalidVersion
+	}
+	return nil
+}
+
+// Codec encodes and decodes envelopes and payloads.
+type Codec interface {
+	// ContentType returns the MIME type of the encoded data.
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes events as JSON.
+	JSON Codec = jsonCodec{}
+	// Msgpack encodes events as MessagePack.
+	Msgpack Codec = msgpackCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// RawPayload holds the encoded payload of an event for which no payload
+// type is registered.
+type RawPayload []byte
+
+// MarshalJSON implements json.Marshaler.
+func (raw RawPayload) MarshalJSON() ([]byte, error) {
+	if raw == nil {
+		return []byte("null"), nil
+	}
+	return raw, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (raw *RawPayload) UnmarshalJSON(b []byte) error {
+	*raw = append((*raw)[:0], b...)
+	return nil
+}
+
+// MarshalMsgpack implements msgpack.Marshaler.
+func (raw RawPayload) MarshalMsgpack() ([]byte, error) {
+	if raw == nil {
+		return msgpack.Marshal(nil)
+	}
+	return raw, nil
+}
+
+// UnmarshalMsgpack implements msgpack.Unmarshaler.
+func (raw *RawPayload) UnmarshalMsgpack(b []byte) error {
+	*raw = append((*raw)[:0], b...)
+	return nil
+}
+
+// Encode validates and encodes the envelope using codec.
+func Encode(codec Codec, env *Envelope) ([]byte, error) {
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := codec.Marshal(env)
+	return b, errors.Wrap(err, "events: failed to encode event")
+}
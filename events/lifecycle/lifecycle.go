@@ -0,0 +1,216 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package lifecycle defines the device lifecycle events shared between the
+// services, such that e.g. the cleanup after decommissioning a device is
+// triggered consistently in deviceauth, inventory and deployments.
+package lifecycle
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/events"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/model/device"
+)
+
+const (
+	TypeProvisioned    = "device.provisioned"
+	TypeDecommissioned = "device.decommissioned"
+	TypeStatusChanged  = "device.status_changed"
+
+	// Version is the payload version of the lifecycle events.
+	Version = 1
+)
+
+// Device authentication statuses.
+const (
+	StatusPending       = "pending"
+	StatusAccepted      = "accepted"
+	StatusRejected      = "rejected"
+	StatusPreauthorized = "preauthorized"
+	StatusNoAuth        = "noauth"
+)
+
+var ErrDeviceIDRequired = errors.New("lifecycle: device ID is required")
+
+// Provisioned is the payload of TypeProvisioned, emitted when a device is
+// accepted (or preauthorized) for the first time.
+type Provisioned struct {
+	DeviceID     string              `json:"device_id" msgpack:"device_id"`
+	IdentityData device.IdentityData `json:"identity_data,omitempty" msgpack:"identity_data,omitempty"`
+	Status       string              `json:"status" msgpack:"status"`
+}
+
+// Decommissioned is the payload of TypeDecommissioned, emitted when a
+// device is removed; consumers delete the data of the device.
+type Decommissioned struct {
+	DeviceID string `json:"device_id" msgpack:"device_id"`
+}
+
+// StatusChanged is the payload of TypeStatusChanged.
+type StatusChanged struct {
+	DeviceID       string `json:"device_id" msgpack:"device_id"`
+	PreviousStatus string `json:"previous_status,omitempty" msgpack:"previous_status,omitempty"`
+	Status         string `json:"status" msgpack:"status"`
+}
+
+// Register registers the lifecycle payloads with the registry.
+func Register(reg *events.Registry) error {
+	for eventType, factory := range map[string]events.Factory{
+		TypeProvisioned:    func() interface{} { return new(Provisioned) },
+		TypeDecommissioned: func() interface{} { return new(Decommissioned) },
+		TypeStatusChanged:  func() interface{} { return new(StatusChanged) },
+	} {
+		if err := reg.Register(eventType, Version, factory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publisher sends the encoded events to the bus.
+type Publisher interface {
+	Publish(ctx context.Context, eventType string, data []byte) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, eventType string, data []byte) error
+
+func (f PublisherFunc) Publish(ctx context.Context, eventType string, data []byte) error {
+	return f(ctx, eventType, data)
+}
+
+// Emitter emits the lifecycle events for the tenant of the context.
+type Emitter struct {
+	publisher Publisher
+	codec     events.Codec
+}
+
+// NewEmitter returns an Emitter encoding the events with codec (default:
+// events.JSON).
+func NewEmitter(publisher Publisher, codec events.Codec) *Emitter {
+	if codec == nil {
+		codec = events.JSON
+	}
+	return &Emitter{publisher: publisher, codec: codec}
+}
+
+func (e *Emitter) emit(ctx context.Context, eventType, deviceID string, payload interface{}) error {
+	if deviceID == "" {
+		return ErrDeviceIDRequired
+	}
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	env := events.NewEnvelope(eventType, Version, tenantID, payload)
+	env.OccurredAt = clock.Now(ctx).UTC()
+	data, err := events.Encode(e.codec, env)
+	if err != nil {
+		return err
+	}
+	err = e.publisher.Publish(ctx, eventType, data)
+	return errors.Wrapf(err, "lifecycle: failed to publish %s", eventType)
+}
+
+func (e *Emitter) Provisioned(ctx context.Context, payload Provisioned) error {
+	return e.emit(ctx, TypeProvisioned, payload.DeviceID, &payload)
+}
+
+func (e *Emitter) Decommissioned(ctx context.Context, deviceID string) error {
+	return e.emit(ctx, TypeDecommissioned, deviceID, &Decommissioned{DeviceID: deviceID})
+}
+
+func (e *Emitter) StatusChanged(ctx context.Context, payload StatusChanged) error {
+	return e.emit(ctx, TypeStatusChanged, payload.DeviceID, &payload)
+}
+
+// Handlers consume the lifecycle events. The handlers are called with a
+// context carrying the identity of the device (in the tenant of the
+// event), such that tenant scoped stores can be used directly. Nil
+// handlers skip the events.
+type Handlers struct {
+	Provisioned    func(ctx context.Context, event *Provisioned) error
+	Decommissioned func(ctx context.Context, event *Decommissioned) error
+	StatusChanged  func(ctx context.Context, event *StatusChanged) error
+}
+
+// Consumer decodes the lifecycle events and dispatches them to the
+// handlers.
+type Consumer struct {
+	handlers Handlers
+	codec    events.Codec
+	registry *events.Registry
+}
+
+// NewConsumer returns a Consumer decoding the events with codec (default:
+// events.JSON).
+func NewConsumer(handlers Handlers, codec events.Codec) *Consumer {
+	if codec == nil {
+		codec = events.JSON
+	}
+	reg := events.NewRegistry()
+	// The registry is empty; registration cannot fail.
+	_ = Register(reg)
+	return &Consumer{handlers: handlers, codec: codec, registry: reg}
+}
+
+// Handle decodes the event and calls the matching handler. Events that
+// are not lifecycle events, or have no handler, are skipped.
+func (c *Consumer) Handle(ctx context.Context, data []byte) error {
+	env, err := c.registry.Decode(c.codec, data)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var deviceID string
+	dispatch := func(context.Context) error { return nil }
+	switch payload := env.Payload.(type) {
+	case *Provisioned:
+		deviceID = payload.DeviceID
+		if c.handlers.Provisioned != nil {
+			dispatch = func(ctx context.Context) error {
+				return c.handlers.Provisioned(ctx, payload)
+			}
+		}
+	case *Decommissioned:
+		deviceID = payload.DeviceID
+		if c.handlers.Decommissioned != nil {
+			dispatch = func(ctx context.Context) error {
+				return c.handlers.Decommissioned(ctx, payload)
+			}
+		}
+	case *StatusChanged:
+		deviceID = payload.DeviceID
+		if c.handlers.StatusChanged != nil {
+			dispatch = func(ctx context.Context) error {
+				return c.handlers.StatusChanged(ctx, payload)
+			}
+		}
+	}
+	if deviceID == "" {
+		return ErrDeviceIDRequired
+	}
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject:  deviceID,
+		Tenant:   env.TenantID,
+		IsDevice: true,
+	})
+	return dispatch(ctx)
+}
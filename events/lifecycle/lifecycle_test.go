@@ -0,0 +1,125 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/events"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/model/device"
+)
+
+type message struct {
+	eventType string
+	data      []byte
+}
+
+func TestEmitConsume(t *testing.T) {
+	t.Parallel()
+	for _, codec := range []events.Codec{events.JSON, events.Msgpack} {
+		codec := codec
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			t.Parallel()
+			var bus []message
+			emitter := NewEmitter(PublisherFunc(
+				func(ctx context.Context, eventType string, data []byte) error {
+					bus = append(bus, message{eventType: eventType, data: data})
+					return nil
+				}), codec)
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Subject: "user", Tenant: "tenant1", IsUser: true})
+
+			require.NoError(t, emitter.Provisioned(ctx, Provisioned{
+				DeviceID:     "dev-1",
+				IdentityData: device.IdentityData{"mac": "00:11:22:33:44:55"},
+				Status:       StatusAccepted,
+			}))
+			require.NoError(t, emitter.StatusChanged(ctx, StatusChanged{
+				DeviceID:       "dev-1",
+				PreviousStatus: StatusAccepted,
+				Status:         StatusRejected,
+			}))
+			require.NoError(t, emitter.Decommissioned(ctx, "dev-1"))
+			assert.ErrorIs(t, emitter.Decommissioned(ctx, ""), ErrDeviceIDRequired)
+			if !assert.Len(t, bus, 3) {
+				return
+			}
+			assert.Equal(t, TypeProvisioned, bus[0].eventType)
+
+			var (
+				provisioned *Provisioned
+				changed     *StatusChanged
+				removed     []string
+			)
+			consumer := NewConsumer(Handlers{
+				Provisioned: func(ctx context.Context, event *Provisioned) error {
+					provisioned = event
+					return nil
+				},
+				StatusChanged: func(ctx context.Context, event *StatusChanged) error {
+					changed = event
+					return nil
+				},
+				Decommissioned: func(ctx context.Context, event *Decommissioned) error {
+					id := identity.FromContext(ctx)
+					assert.Equal(t, &identity.Identity{
+						Subject:  "dev-1",
+						Tenant:   "tenant1",
+						IsDevice: true,
+					}, id)
+					removed = append(removed, event.DeviceID)
+					return errors.New("retry later")
+				},
+			}, codec)
+			assert.NoError(t, consumer.Handle(context.Background(), bus[0].data))
+			assert.NoError(t, consumer.Handle(context.Background(), bus[1].data))
+			assert.EqualError(t,
+				consumer.Handle(context.Background(), bus[2].data), "retry later")
+
+			if assert.NotNil(t, provisioned) {
+				assert.Equal(t, "00:11:22:33:44:55", provisioned.IdentityData["mac"])
+			}
+			if assert.NotNil(t, changed) {
+				assert.Equal(t, StatusRejected, changed.Status)
+			}
+			assert.Equal(t, []string{"dev-1"}, removed)
+
+			// Other events and events without handlers are skipped.
+			other, err := events.Encode(codec,
+				events.NewEnvelope("deployment.finished", 1, "tenant1", nil))
+			require.NoError(t, err)
+			assert.NoError(t, consumer.Handle(context.Background(), other))
+			assert.NoError(t, NewConsumer(Handlers{}, codec).
+				Handle(context.Background(), bus[0].data))
+		})
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	t.Parallel()
+	emitter := NewEmitter(PublisherFunc(
+		func(context.Context, string, []byte) error {
+			return errors.New("broker down")
+		}), nil)
+	err := emitter.Decommissioned(context.Background(), "dev-1")
+	assert.EqualError(t, err,
+		"lifecycle: failed to publish device.decommissioned: broker down")
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrAlreadyRegistered = errors.New("events: event type already registered")
+	ErrUnknownEvent      = errors.New("events: unknown event type")
+	ErrNilFactory        = errors.New("events: factory is nil")
+)
+
+// Factory returns a pointer to a new (zero) payload value to decode the
+// event payload into.
+type Factory func() interface{}
+
+type registryKey struct {
+	eventType string
+	version   int
+}
+
+// Registry maps event types and versions to payload types.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[registryKey]Factory
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[registryKey]Factory),
+	}
+}
+
+// Register registers the payload factory for the event type and version.
+func (r *Registry) Register(eventType string, version int, factory Factory) error {
+	if eventType == "" {
+		return ErrTypeRequired
+	} else if version <= 0 {
+		return ErrInvalidVersion
+	} else if factory == nil {
+		return ErrNilFactory
+	}
+	key := registryKey{eventType: eventType, version: version}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[key]; ok {
+		return errors.Wrapf(ErrAlreadyRegistered, "%s (version %d)",
+			eventType, version)
+	}
+	r.factories[key] = factory
+	return nil
+}
+
+// Lookup returns the payload factory for the event type and version.
+func (r *Registry) Lookup(eventType string, version int) (Factory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.factories[registryKey{eventType: eventType, version: version}]
+	return factory, ok
+}
+
+type envelope struct {
+	Type       string     `json:"type" msgpack:"type"`
+	Version    int        `json:"version" msgpack:"version"`
+	TenantID   string     `json:"tenant_id,omitempty" msgpack:"tenant_id,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at" msgpack:"occurred_at"`
+	Payload    RawPayload `json:"payload" msgpack:"payload"`
+}
+
+// Decode decodes an event encoded with codec. The payload is decoded into
+// the value returned by the Factory registered for the event type and
+// version. If no Factory is registered, the envelope is returned with the
+// payload as RawPayload together with an error wrapping ErrUnknownEvent,
+// allowing consumers to skip events they do not know.
+func (r *Registry) Decode(codec Codec, data []byte) (*Envelope, error) {
+	var raw envelope
+	if err := codec.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "events: failed to decode event")
+	}
+	env := &Envelope{
+		Type:       raw.Type,
+		Version:    raw.Version,
+		TenantID:   raw.TenantID,
+		OccurredAt: raw.OccurredAt.UTC(),
+		Payload:    raw.Payload,
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	factory, ok := r.Lookup(raw.Type, raw.Version)
+	if !ok {
+		return env, errors.Wrapf(ErrUnknownEvent, "%s (version %d)",
+			raw.Type, raw.Version)
+	}
+	payload := factory()
+	if err := codec.Unmarshal(raw.Payload, payload); err != nil {
+		return nil, errors.Wrapf(err,
+			"events: failed to decode %s (version %d) payload",
+			raw.Type, raw.Version)
+	}
+	env.Payload = payload
+	return env, nil
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register registers the payload factory with the default registry. It
+// panics if the event type and version is already registered; it is meant
+// to be called from init functions.
+func Register(eventType string, version int, factory Factory) {
+	if err := defaultRegistry.Register(eventType, version, factory); err != nil {
+		panic(fmt.Sprintf("events.Register: %s", err.Error()))
+	}
+}
+
+// Decode decodes an event with the default registry.
+func Decode(codec Codec, data []byte) (*Envelope, error) {
+	return defaultRegistry.Decode(codec, data)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type deviceAccepted struct {
+	DeviceID string `json:"device_id" msgpack:"device_id"`
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	reg := NewRegistry()
+	factory := func() interface{} { return &deviceAccepted{} }
+	assert.NoError(t, reg.Register("device.accepted", 1, factory))
+	assert.ErrorIs(t,
+		reg.Register("device.accepted", 1, factory),
+		ErrAlreadyRegistered)
+	assert.ErrorIs(t, reg.Register("", 1, factory), ErrTypeRequired)
+	assert.ErrorIs(t, reg.Register("foo", 0, factory), ErrInvalidVersion)
+	assert.ErrorIs(t, reg.Register("foo", 1, nil), ErrNilFactory)
+
+	occurredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, codec := range []Codec{JSON, Msgpack} {
+		codec := codec
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			t.Parallel()
+			env := NewEnvelope("device.accepted", 1, "tenant",
+				deviceAccepted{DeviceID: "foo"})
+			env.OccurredAt = occurredAt
+			b, err := Encode(codec, env)
+			if !assert.NoError(t, err) {
+				return
+			}
+			decoded, err := reg.Decode(codec, b)
+			if assert.NoError(t, err) {
+				assert.Equal(t, &Envelope{
+					Type:       "device.accepted",
+					Version:    1,
+					TenantID:   "tenant",
+					OccurredAt: occurredAt,
+					Payload:    &deviceAccepted{DeviceID: "foo"},
+				}, decoded)
+			}
+
+			// Unknown version
+			env.Version = 2
+			b, err = Encode(codec, env)
+			if !assert.NoError(t, err) {
+				return
+			}
+			decoded, err = reg.Decode(codec, b)
+			assert.ErrorIs(t, err, ErrUnknownEvent)
+			if assert.NotNil(t, decoded) {
+				assert.IsType(t, RawPayload{}, decoded.Payload)
+				var payload deviceAccepted
+				err = codec.Unmarshal(decoded.Payload.(RawPayload), &payload)
+				assert.NoError(t, err)
+				assert.Equal(t, "foo", payload.DeviceID)
+			}
+
+			_, err = Encode(codec, &Envelope{Version: 1})
+			assert.ErrorIs(t, err, ErrTypeRequired)
+
+			_, err = reg.Decode(codec, []byte("garbage"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	factory := func() interface{} { return &deviceAccepted{} }
+	Register("test.register", 1, factory)
+	assert.Panics(t, func() {
+		Register("test.register", 1, factory)
+	})
+
+	b, err := Encode(JSON, NewEnvelope("test.register", 1, "",
+		deviceAccepted{DeviceID: "bar"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	env, err := Decode(JSON, b)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &deviceAccepted{DeviceID: "bar"}, env.Payload)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/authaudit"
+)
+
+// AuditSource is the source of the security events of the middlewares.
+const AuditSource = "identity"
+
+func auditReason(err error) authaudit.Reason {
+	switch {
+	case errors.Is(err, ErrNoCredentials):
+		return authaudit.ReasonNoCredentials
+	case errors.Is(err, ErrTokenExpired),
+		errors.Is(err, ErrTokenNotValidYet):
+		return authaudit.ReasonExpiredCredentials
+	case errors.Is(err, ErrUnknownIssuer):
+		return authaudit.ReasonUntrustedIssuer
+	case errors.Is(err, ErrInvalidSignature):
+		return authaudit.ReasonInvalidSignature
+	case errors.Is(err, ErrInvalidAudience):
+		return authaudit.ReasonInvalidAudience
+	default:
+		return authaudit.ReasonInvalidCredentials
+	}
+}
+
+// audit emits the security event of the request rejected with err. The
+// subject and tenant are decoded from the token extracted with the source
+// of the middleware (without verification) if possible.
+func audit(
+	auditor *authaudit.Auditor,
+	source TokenSource,
+	r *http.Request,
+	route string,
+	err error,
+) {
+	if auditor == nil {
+		return
+	}
+	event := auditor.NewEvent(r, AuditSource,
+		http.StatusUnauthorized, auditReason(err), err)
+	event.Route = route
+	if token, err := source.ExtractToken(r); err == nil {
+		if idty, err := ExtractIdentity(token); err == nil {
+			event.Subject = idty.Subject
+			event.Tenant = idty.Tenant
+		}
+	}
+	auditor.Emit(r.Context(), event)
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/authaudit"
+	"github.com/mendersoftware/go-lib-micro/notify"
+)
+
+func TestAuditReason(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Err    error
+		Reason authaudit.Reason
+	}{
+		{Err: noCredentialsError{errors.New("no header")},
+			Reason: authaudit.ReasonNoCredentials},
+		{Err: ErrTokenExpired, Reason: authaudit.ReasonExpiredCredentials},
+		{Err: ErrTokenNotValidYet, Reason: authaudit.ReasonExpiredCredentials},
+		{Err: errors.Wrap(ErrUnknownIssuer, "issuer \"foo\""),
+			Reason: authaudit.ReasonUntrustedIssuer},
+		{Err: ErrInvalidSignature, Reason: authaudit.ReasonInvalidSignature},
+		{Err: ErrInvalidAudience, Reason: authaudit.ReasonInvalidAudience},
+		{Err: errors.New("identity: incorrect token format"),
+			Reason: authaudit.ReasonInvalidCredentials},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Reason, auditReason(tc.Err), tc.Err.Error())
+	}
+}
+
+func TestMiddlewareAudit(t *testing.T) {
+	t.Parallel()
+	issuers, err := NewIssuers(&Issuer{
+		Name: "mender",
+		Keys: StaticKeySet{},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	counters := authaudit.NewCounters()
+	opts := NewMiddlewareOptions().
+		SetIssuers(issuers).
+		SetAuditor(&authaudit.Auditor{Metrics: counters})
+
+	router := gin.New()
+	router.Use(Middleware(opts))
+	router.GET("/api/management/v1/devices/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	handler := HTTPMiddleware(opts)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`)) +
+		"." + base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"sub":"user","iss":"untrusted","exp":4102444800}`)) +
+		".c2lnbg"
+	for _, h := range []http.Handler{router, handler} {
+		req, _ := http.NewRequest(http.MethodGet,
+			"http://localhost/api/management/v1/devices/123", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	assert.Equal(t, map[authaudit.MetricsLabels]uint64{{
+		Source: AuditSource,
+		Status: http.StatusUnauthorized,
+		Reason: authaudit.ReasonNoCredentials,
+	}: 2, {
+		Source: AuditSource,
+		Status: http.StatusUnauthorized,
+		Reason: authaudit.ReasonUntrustedIssuer,
+	}: 2}, counters.Snapshot())
+}
+
+func TestAuditSubject(t *testing.T) {
+	t.Parallel()
+	var sent []notify.Event
+	auditor := &authaudit.Auditor{
+		Dispatcher: notify.DispatcherFunc(func(
+			_ context.Context, event notify.Event, _ []notify.Recipient,
+		) error {
+			sent = append(sent, event)
+			return nil
+		}),
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	req.Header.Set("Authorization", "Bearer "+
+		makeFakeAuth(Identity{Subject: "user", Tenant: "tenant"}))
+	audit(auditor, DefaultTokenSource, req, "/test", ErrTokenExpired)
+
+	req.Header.Set("Authorization", "Bearer foo.bar")
+	audit(auditor, DefaultTokenSource, req, "/test", errors.New("malformed"))
+
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, "tenant", sent[0].TenantID)
+		assert.Equal(t, "user", sent[0].Data["subject"])
+		assert.Equal(t, "/test", sent[0].Data["route"])
+		assert.Equal(t, string(authaudit.ReasonExpiredCredentials),
+			sent[0].Data["reason"])
+		assert.Empty(t, sent[1].TenantID)
+		assert.Empty(t, sent[1].Data["subject"])
+	}
+
+	// The token is extracted with the source of the middleware.
+	sent = nil
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/test?jwt="+
+		makeFakeAuth(Identity{Subject: "device", Tenant: "tenant"}), nil)
+	source := TokenSourceFunc(func(r *http.Request) (string, error) {
+		return r.URL.Query().Get("jwt"), nil
+	})
+	audit(auditor, source, req, "/test", ErrTokenExpired)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, "tenant", sent[0].TenantID)
+		assert.Equal(t, "device", sent[0].Data["subject"])
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package identity
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTokenCacheSize = 1024
+	DefaultTokenCacheTTL  = time.Minute
+)
+
+// tokenCacheKey scopes the cached identities to the Issuers which
+// verified the token (nil if unverified), such that a decoded but
+// unverified token is never returned to a verifying parser.
+type tokenCacheKey struct {
+	issuers *Issuers
+	token   string
+}
+
+type tokenCacheEntry struct {
+	key     tokenCacheKey
+	id      Identity
+	expires time.Time
+}
+
+// TokenCache is a least-recently-used cache of the identities extracted
+// from tokens. Entries expire after the TTL regardless of how often they
+// are used. A TokenCache is safe for concurrent use and may be shared
+// between middlewares: the identities are cached per Issuers verifying
+// the tokens.
+type TokenCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[tokenCacheKey]*list.Element
+	lru     *list.List
+
+	now func() time.Time
+}
+
+// NewTokenCache creates a cache holding at most size identities for ttl.
+// Non-positive arguments are replaced with DefaultTokenCacheSize and
+// DefaultTokenCacheTTL respectively.
+func NewTokenCache(size int, ttl time.Duration) *TokenCache {
+	if size <= 0 {
+		size = DefaultTokenCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenCacheTTL
+	}
+	return &TokenCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[tokenCacheKey]*list.Element, size),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (cache *TokenCache) get(key tokenCacheKey) (Identity, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	elem, ok := cache.entries[key]
+	if !ok {
+		return Identity{}, false
+	}
+	entry := elem.Value.(*tokenCacheEntry)
+	if !cache.now().Before(entry.expires) {
+		cache.lru.Remove(elem)
+		delete(cache.entries, key)
+		return Identity{}, false
+	}
+	cache.lru.MoveToFront(elem)
+	return entry.id, true
+}
+
+func (cache *TokenCache) add(key tokenCacheKey, id Identity, notAfter time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	expires := cache.now().Add(cache.ttl)
+	if !notAfter.IsZero() && notAfter.Before(expires) {
+		expires = notAfter
+	}
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*tokenCacheEntry)
+		entry.id = id
+		entry.expires = expires
+		cache.lru.MoveToFront(elem)
+		return
+	}
+	for cache.lru.Len() >= cache.size {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+	cache.entries[key] = cache.lru.PushFront(&tokenCacheEntry{
+		key:     key,
+		id:      id,
+		expires: expires,
+	})
+}
+
+// Len returns the number of cached identities (including expired entries
+// not yet evicted).
+func (cache *TokenCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.lru.Len()
+}
+
+// extractToken extracts the identity from a token, verified by issuers if
+// not nil, and the time the token expires (zero if unknown).
+func extractToken(issuers *Issuers, token string) (Identity, time.Time, error) {
+	if issuers != nil {
+		return issuers.verify(token)
+	}
+	id, err := ExtractIdentity(token)
+	return id, time.Time{}, err
+}
+
+// ExtractIdentity returns the cached identity of the token or extracts it
+// using ExtractIdentity and caches the result. Tokens which cannot be
+// parsed are not cached. A nil cache is valid and simply calls
+// ExtractIdentity.
+func (cache *TokenCache) ExtractIdentity(token string) (Identity, error) {
+	return cache.extract(token, nil)
+}
+
+func (cache *TokenCache) extract(token string, issuers *Issuers) (Identity, error) {
+	if cache == nil {
+		id, _, err := extractToken(issuers, token)
+		return id, err
+	}
+	key := tokenCacheKey{issuers: issuers, token: token}
+	if id, ok := cache.get(key); ok {
+		// Copy the addons such that the caller cannot modify the
+		// cached identity.
+		if id.Addons != nil {
+			id.Addons = append(id.Addons[:0:0], id.Addons...)
+		}
+		return id, nil
+	}
+	id, expires, err := extractToken(issuers, token)
+	if err != nil {
+		return id, err
+	}
+	cached := id
+	if id.Addons != nil {
+		cached.Addons = append(id.Addons[:0:0], id.Addons...)
+	}
+	cache.add(key, cached, expires)
+	return id, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package identity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/addons"
+)
+
+func TestTokenCache(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	cache := NewTokenCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	first := makeFakeAuth(Identity{
+		Subject: "first",
+		Addons:  []addons.Addon{{Name: "troubleshoot", Enabled: true}},
+	})
+	second := makeFakeAuth(Identity{Subject: "second"})
+	third := makeFakeAuth(Identity{Subject: "third"})
+
+	id, err := cache.ExtractIdentity(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", id.Subject)
+	// Modifying the result must not affect the cache.
+	id.Addons[0].Enabled = false
+
+	id, err = cache.ExtractIdentity(first)
+	assert.NoError(t, err)
+	assert.True(t, id.Addons[0].Enabled)
+	assert.Equal(t, 1, cache.Len())
+
+	_, err = cache.ExtractIdentity("not.a.token")
+	assert.Error(t, err)
+	assert.Equal(t, 1, cache.Len())
+
+	// "second" is the least recently used when "third" is added.
+	_, _ = cache.ExtractIdentity(second)
+	_, _ = cache.ExtractIdentity(first)
+	_, _ = cache.ExtractIdentity(third)
+	assert.Equal(t, 2, cache.Len())
+	_, ok := cache.get(tokenCacheKey{token: second})
+	assert.False(t, ok)
+	_, ok = cache.get(tokenCacheKey{token: first})
+	assert.True(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok = cache.get(tokenCacheKey{token: first})
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+
+	var nilCache *TokenCache
+	id, err = nilCache.ExtractIdentity(second)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", id.Subject)
+}
+
+func TestGinMiddlewareTokenCache(t *testing.T) {
+	t.Parallel()
+	cache := NewTokenCache(0, 0)
+	router := gin.New()
+	router.Use(Middleware(NewMiddlewareOptions().SetTokenCache(cache)))
+	var subjects []string
+	router.GET("/test", func(c *gin.Context) {
+		subjects = append(subjects, FromContext(c.Request.Context()).Subject)
+	})
+
+	token := makeFakeAuth(Identity{Subject: "device", IsDevice: true})
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, []string{"device", "device", "device"}, subjects)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestTokenCacheShared(t *testing.T) {
+	t.Parallel()
+	issuers, _ := NewIssuers(&Issuer{
+		Name: "Mender",
+		Keys: StaticKeySet{"": testEdKey.Public()},
+	})
+	cache := NewTokenCache(0, 0)
+	decode := NewTokenParser(cache, nil)
+	verify := NewTokenParser(cache, issuers)
+
+	// A token decoded without verification must not be returned to a
+	// verifying parser sharing the cache.
+	forged := makeFakeAuth(Identity{Subject: "user"})
+	_, err := decode(forged)
+	assert.NoError(t, err)
+	_, err = verify(forged)
+	assert.Error(t, err)
+
+	token := signToken(t, "EdDSA", "", testEdKey, map[string]interface{}{
+		"iss": "Mender", "exp": time.Now().Add(time.Hour).Unix(), "sub": "user",
+	})
+	id, err := verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", id.Subject)
+	id, err = verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", id.Subject)
+	assert.Equal(t, 2, cache.Len())
+}
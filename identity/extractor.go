@@ -0,0 +1,263 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader carries the base64 encoded signature of the request
+	// body made with the private key of the device.
+	SignatureHeader = "X-MEN-Signature"
+
+	// DefaultMaxSignedBodySize is the default limit of the size of the
+	// body of signed requests.
+	DefaultMaxSignedBodySize = 1024 * 1024
+)
+
+var (
+	// ErrNoCredentials is returned by the extractors if the request does
+	// not carry the credentials they handle.
+	ErrNoCredentials = errors.New("identity: no credentials")
+
+	ErrSignedBodyTooLarge = errors.New("identity: signed request body too large")
+	ErrNoDeviceKey        = errors.New("identity: SignatureExtractor has no DeviceKey")
+)
+
+// noCredentialsError marks the error as ErrNoCredentials keeping the
+// message.
+type noCredentialsError struct {
+	error
+}
+
+func (err noCredentialsError) Is(target error) bool {
+	return target == ErrNoCredentials
+}
+
+func (err noCredentialsError) Unwrap() error {
+	return err.error
+}
+
+// IdentityExtractor extracts the identity from the credentials of a
+// request.
+type IdentityExtractor interface {
+	// ExtractIdentity returns the identity of the request. The error is
+	// ErrNoCredentials (errors.Is) if the request does not carry the
+	// credentials handled by the extractor.
+	ExtractIdentity(r *http.Request) (Identity, error)
+}
+
+// IdentityExtractorFunc is a function implementing IdentityExtractor.
+type IdentityExtractorFunc func(r *http.Request) (Identity, error)
+
+func (f IdentityExtractorFunc) ExtractIdentity(r *http.Request) (Identity, error) {
+	return f(r)
+}
+
+// JWTExtractor extracts the identity from the JWT of the Authorization
+// header or the "JWT" cookie like the middleware does by default: verified
+// by issuers, if not nil, and cached in cache, if not nil.
+func JWTExtractor(cache *TokenCache, issuers *Issuers) IdentityExtractor {
+	return TokenExtractor(DefaultTokenSource, cache, issuers)
+}
+
+// TokenExtractor is the JWTExtractor extracting the JWT from the source,
+// e.g. the TokenSources of the DefaultTokenSource and the
+// WebSocketProtocolToken. Requests without a valid token from the source
+// have no credentials (ErrNoCredentials).
+func TokenExtractor(source TokenSource, cache *TokenCache, issuers *Issuers) IdentityExtractor {
+	return jwtExtractor(source, newIdentityParser(cache, issuers))
+}
+
+func jwtExtractor(
+	source TokenSource,
+	parse func(string) (Identity, error),
+) IdentityExtractorFunc {
+	return func(r *http.Request) (Identity, error) {
+		jwt, err := source.ExtractToken(r)
+		if err != nil {
+			return Identity{}, noCredentialsError{err}
+		}
+		return parse(jwt)
+	}
+}
+
+// Extractors returns an IdentityExtractor trying the extractors in order
+// until one finds credentials in the request.
+func Extractors(extractors ...IdentityExtractor) IdentityExtractor {
+	return IdentityExtractorFunc(func(r *http.Request) (Identity, error) {
+		err := error(noCredentialsError{
+			errors.New("identity: no credentials in request"),
+		})
+		for _, extractor := range extractors {
+			var idty Identity
+			idty, err = extractor.ExtractIdentity(r)
+			if !errors.Is(err, ErrNoCredentials) {
+				return idty, err
+			}
+		}
+		return Identity{}, err
+	})
+}
+
+// SignatureExtractor extracts the identity of requests signed with the
+// key of the device in the X-MEN-Signature header instead of carrying a
+// JWT, like the authentication requests of devices which have not
+// obtained a token yet. The signature is verified over the body of the
+// request: RSA PKCS #1 v1.5 and ECDSA (ASN.1) signatures of the SHA256
+// digest or Ed25519 signatures of the body. The body is buffered and
+// restored for the handler.
+type SignatureExtractor struct {
+	// DeviceKey returns the public key verifying the signature and the
+	// identity of the device sending the body, see AuthRequestKey. The
+	// key and the identity must come from trusted storage (e.g. the
+	// preauthorized devices): a key taken from the signed body only
+	// proves that the sender has a key, not who it is. Required.
+	DeviceKey func(r *http.Request, body []byte) (crypto.PublicKey, Identity, error)
+
+	// MaxBodySize limits the size of the body of signed requests.
+	// Defaults to DefaultMaxSignedBodySize.
+	MaxBodySize int64
+}
+
+func (ex *SignatureExtractor) ExtractIdentity(r *http.Request) (Identity, error) {
+	header := r.Header.Get(SignatureHeader)
+	if header == "" {
+		return Identity{}, noCredentialsError{
+			errors.New("identity: signature not present in header"),
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return Identity{}, errors.Wrap(err,
+			"identity: failed to decode request signature")
+	}
+	maxSize := ex.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSignedBodySize
+	}
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+		r.Body.Close()
+		if err != nil {
+			return Identity{}, errors.Wrap(err,
+				"identity: failed to read signed request body")
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if int64(len(body)) > maxSize {
+		return Identity{}, ErrSignedBodyTooLarge
+	}
+
+	if ex.DeviceKey == nil {
+		return Identity{}, ErrNoDeviceKey
+	}
+	key, idty, err := ex.DeviceKey(r, body)
+	if err != nil {
+		return Identity{}, err
+	}
+	if err = verifyDeviceSignature(key, body, signature); err != nil {
+		return Identity{}, err
+	}
+	return idty, idty.Validate()
+}
+
+func verifyDeviceSignature(key crypto.PublicKey, body, signature []byte) error {
+	var valid bool
+	digest := sha256.Sum256(body)
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(pub, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(pub, body, signature)
+	default:
+		return errors.Wrapf(ErrUnsupportedAlgorithm, "device key %T", key)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// AuthRequest is the body of the device authentication request. None of
+// the fields are verified.
+type AuthRequest struct {
+	IdentityData string `json:"id_data"`
+	PublicKey    string `json:"pubkey"`
+	TenantToken  string `json:"tenant_token"`
+}
+
+// ParseAuthRequest decodes the device authentication request body.
+func ParseAuthRequest(body []byte) (AuthRequest, error) {
+	var req AuthRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, errors.Wrap(err,
+			"identity: failed to decode authentication request")
+	}
+	if req.IdentityData == "" {
+		return req, errors.New(
+			"identity: authentication request has no identity data")
+	}
+	return req, nil
+}
+
+// DeviceKeyLookup returns the public key and the identity of the device
+// sending the authentication request from trusted storage, e.g. the
+// preauthorized device with the identity data of the request. The
+// tenant of the identity must be taken from the storage or from a
+// verified tenant token, never from the unverified TenantToken.
+type DeviceKeyLookup func(
+	ctx context.Context,
+	req AuthRequest,
+) (crypto.PublicKey, Identity, error)
+
+// AuthRequestKey returns a SignatureExtractor.DeviceKey for the device
+// authentication requests: the request body is parsed and the key and
+// identity of the device are looked up with lookup.
+func AuthRequestKey(
+	lookup DeviceKeyLookup,
+) func(r *http.Request, body []byte) (crypto.PublicKey, Identity, error) {
+	return func(r *http.Request, body []byte) (crypto.PublicKey, Identity, error) {
+		req, err := ParseAuthRequest(body)
+		if err != nil {
+			return nil, Identity{}, err
+		}
+		key, idty, err := lookup(r.Context(), req)
+		if err != nil {
+			return nil, Identity{}, err
+		} else if key == nil {
+			return nil, Identity{}, errors.Wrap(ErrKeyNotFound,
+				"identity: device key")
+		}
+		idty.IsDevice = true
+		return key, idty, nil
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signBody(t *testing.T, key crypto.Signer, body []byte) string {
+	var (
+		signature []byte
+		err       error
+	)
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		signature, err = key.Sign(rand.Reader, body, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(body)
+		signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func newAuthRequest(t *testing.T, key crypto.Signer, tenantToken string) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	body, _ := json.Marshal(AuthRequest{
+		IdentityData: `{"mac":"00:11:22:33:44:55"}`,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{
+			Type: "PUBLIC KEY", Bytes: der,
+		})),
+		TenantToken: tenantToken,
+	})
+	return body
+}
+
+// trustedExtractor verifies the authentication requests of the test
+// device with the key from the "storage".
+func trustedExtractor(key crypto.Signer) *SignatureExtractor {
+	return &SignatureExtractor{
+		DeviceKey: AuthRequestKey(func(
+			_ context.Context, req AuthRequest,
+		) (crypto.PublicKey, Identity, error) {
+			if req.IdentityData != `{"mac":"00:11:22:33:44:55"}` {
+				return nil, Identity{}, ErrKeyNotFound
+			}
+			return key.Public(), Identity{
+				Subject: req.IdentityData,
+				Tenant:  "tenant1",
+			}, nil
+		}),
+	}
+}
+
+func TestSignatureExtractor(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	// The tenant token is not verified and must not be trusted.
+	tenantToken := makeFakeAuth(Identity{Subject: "tenant", Tenant: "forged"})
+
+	expected := Identity{
+		Subject:  `{"mac":"00:11:22:33:44:55"}`,
+		Tenant:   "tenant1",
+		IsDevice: true,
+	}
+	testCases := []struct {
+		Name string
+
+		Body      []byte
+		Signature string
+		Extractor *SignatureExtractor
+
+		Identity Identity
+		Error    error
+	}{{
+		Name: "ok, rsa",
+
+		Body: newAuthRequest(t, rsaKey, tenantToken),
+		Signature: signBody(t, rsaKey,
+			newAuthRequest(t, rsaKey, tenantToken)),
+		Extractor: trustedExtractor(rsaKey),
+		Identity:  expected,
+	}, {
+		Name: "ok, ecdsa",
+
+		Body: newAuthRequest(t, ecKey, tenantToken),
+		Signature: signBody(t, ecKey,
+			newAuthRequest(t, ecKey, tenantToken)),
+		Extractor: trustedExtractor(ecKey),
+		Identity:  expected,
+	}, {
+		Name: "ok, ed25519, custom key",
+
+		Body:      []byte("payload"),
+		Signature: signBody(t, edKey, []byte("payload")),
+		Extractor: &SignatureExtractor{
+			DeviceKey: func(r *http.Request, body []byte) (crypto.PublicKey, Identity, error) {
+				return edKey.Public(), Identity{Subject: "device", IsDevice: true}, nil
+			},
+		},
+		Identity: Identity{Subject: "device", IsDevice: true},
+	}, {
+		Name: "error, self-signed with an untrusted key",
+
+		Body: newAuthRequest(t, ecKey, tenantToken),
+		Signature: signBody(t, ecKey,
+			newAuthRequest(t, ecKey, tenantToken)),
+		Extractor: trustedExtractor(rsaKey),
+		Error:     ErrInvalidSignature,
+	}, {
+		Name: "error, unknown device",
+
+		Body:      []byte(`{"id_data":"{\"mac\":\"unknown\"}"}`),
+		Signature: signBody(t, rsaKey, []byte(`{"id_data":"{\"mac\":\"unknown\"}"}`)),
+		Extractor: trustedExtractor(rsaKey),
+		Error:     ErrKeyNotFound,
+	}, {
+		Name: "error, no device key",
+
+		Body:      newAuthRequest(t, rsaKey, ""),
+		Signature: signBody(t, rsaKey, newAuthRequest(t, rsaKey, "")),
+		Extractor: &SignatureExtractor{},
+		Error:     ErrNoDeviceKey,
+	}, {
+		Name: "error, no signature",
+
+		Body:      newAuthRequest(t, rsaKey, ""),
+		Extractor: trustedExtractor(rsaKey),
+		Error:     ErrNoCredentials,
+	}, {
+		Name: "error, invalid signature",
+
+		Body:      newAuthRequest(t, ecKey, ""),
+		Signature: signBody(t, ecKey, []byte("other")),
+		Extractor: trustedExtractor(ecKey),
+		Error:     ErrInvalidSignature,
+	}, {
+		Name: "error, body too large",
+
+		Body:      []byte(strings.Repeat("a", 11)),
+		Signature: signBody(t, edKey, []byte(strings.Repeat("a", 11))),
+		Extractor: &SignatureExtractor{
+			DeviceKey:   trustedExtractor(edKey).DeviceKey,
+			MaxBodySize: 10,
+		},
+		Error: ErrSignedBodyTooLarge,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequest(http.MethodPost,
+				"http://localhost/api/devices/v1/authentication/auth_requests",
+				bytes.NewReader(tc.Body))
+			if tc.Signature != "" {
+				req.Header.Set(SignatureHeader, tc.Signature)
+			}
+			idty, err := tc.Extractor.ExtractIdentity(req)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.Identity, idty)
+				body, _ := io.ReadAll(req.Body)
+				assert.Equal(t, tc.Body, body, "body must be restored")
+			}
+		})
+	}
+}
+
+func TestMiddlewareExtractors(t *testing.T) {
+	t.Parallel()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	body := newAuthRequest(t, key, "")
+
+	var got *Identity
+	handler := HTTPMiddleware(NewMiddlewareOptions().
+		SetExtractor(Extractors(
+			JWTExtractor(nil, nil),
+			trustedExtractor(key),
+		)))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/", bytes.NewReader(body))
+	req.Header.Set(SignatureHeader, signBody(t, key, body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	if assert.NotNil(t, got) {
+		assert.True(t, got.IsDevice)
+	}
+
+	user := Identity{Subject: "user", IsUser: true}
+	got = nil
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeFakeAuth(user))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, &user, got)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+// HTTPMiddleware is the net/http equivalent of Middleware. The PathRegex
+// is matched against the request path since net/http does not expose the
+// route pattern.
+func HTTPMiddleware(opts ...*MiddlewareOptions) func(http.Handler) http.Handler {
+	opt := mergeMiddlewareOptions(opts...)
+	extractor := opt.extractor()
+	updateLogger := *opt.UpdateLogger
+	var pathRegex *regexp.Regexp
+	if opt.PathRegex != nil {
+		pathRegex = regexp.MustCompile(*opt.PathRegex)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pathRegex != nil && !pathRegex.MatchString(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			idty, err := extractor.ExtractIdentity(r)
+			if err == nil {
+				ctx := WithContext(r.Context(), &idty)
+				if updateLogger {
+					ctx = log.WithContext(ctx,
+						log.FromContext(ctx).F(logFields(&idty)))
+				}
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			audit(opt.Auditor, opt.tokenSource(), r, "", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ManagementJWT"`)
+			urest.WriteError(w, r, http.StatusUnauthorized, err)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+	var got *Identity
+	handler := HTTPMiddleware(NewMiddlewareOptions().
+		SetPathRegex("^/api/management/"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	idty := Identity{Subject: "user", Tenant: "tenant", IsUser: true}
+
+	testCases := []struct {
+		Name     string
+		Path     string
+		Auth     string
+		Status   int
+		Identity *Identity
+	}{{
+		Name:     "ok",
+		Path:     "/api/management/v1/devices",
+		Auth:     "Bearer " + makeFakeAuth(idty),
+		Status:   http.StatusNoContent,
+		Identity: &idty,
+	}, {
+		Name:   "missing token",
+		Path:   "/api/management/v1/devices",
+		Status: http.StatusUnauthorized,
+	}, {
+		Name:   "malformed token",
+		Path:   "/api/management/v1/devices",
+		Auth:   "Bearer foo.bar",
+		Status: http.StatusUnauthorized,
+	}, {
+		Name:   "path not matching",
+		Path:   "/api/devices/v1/auth",
+		Status: http.StatusNoContent,
+	}}
+	for _, tc := range testCases {
+		got = nil
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+tc.Path, nil)
+		if tc.Auth != "" {
+			req.Header.Set("Authorization", tc.Auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, tc.Status, w.Code, tc.Name)
+		assert.Equal(t, tc.Identity, got, tc.Name)
+		if tc.Status == http.StatusUnauthorized {
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"), tc.Name)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/keys"
+)
+
+var (
+	ErrUnknownIssuer        = errors.New("identity: token issuer is not trusted")
+	ErrKeyNotFound          = errors.New("identity: signing key not found")
+	ErrUnsupportedAlgorithm = errors.New("identity: unsupported signing algorithm")
+	ErrInvalidSignature     = errors.New("identity: invalid token signature")
+	ErrTokenExpired         = errors.New("identity: token is expired")
+	ErrTokenNotValidYet     = errors.New("identity: token is not valid yet")
+	ErrInvalidAudience      = errors.New("identity: token audience is not accepted")
+)
+
+// KeySet provides the public keys for verifying the tokens of an issuer.
+type KeySet interface {
+	// Key returns the key with the given key ID (the "kid" header of
+	// the token, which may be empty).
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a KeySet mapping key IDs to public keys. Tokens without a
+// key ID are verified with the key with the empty ID or, if the set only
+// contains a single key, with that key.
+type StaticKeySet map[string]crypto.PublicKey
+
+func (set StaticKeySet) Key(kid string) (crypto.PublicKey, error) {
+	if key, ok := set[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(set) == 1 {
+		for _, key := range set {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Issuer is a trusted issuer of tokens.
+type Issuer struct {
+	// Name is the value of the "iss" claim of the issuer's tokens.
+	Name string
+	// Keys verifies the signature of the tokens.
+	Keys KeySet
+	// Audiences lists the accepted values of the "aud" claim; at least
+	// one of the token's audiences must be accepted. If empty, the
+	// audience is not checked.
+	Audiences []string
+	// Leeway is the accepted clock skew when checking the "exp" and
+	// "nbf" claims.
+	Leeway time.Duration
+}
+
+// IssuerConfig is the configuration of a trusted issuer.
+type IssuerConfig struct {
+	// Issuer is the value of the "iss" claim of the issuer's tokens.
+	Issuer string `json:"issuer" mapstructure:"issuer"`
+	// Audiences lists the accepted values of the "aud" claim.
+	Audiences []string `json:"audiences" mapstructure:"audiences"`
+	// Keys maps key IDs to paths of PEM encoded public keys.
+	Keys map[string]string `json:"keys" mapstructure:"keys"`
+	// Leeway is the accepted clock skew.
+	Leeway time.Duration `json:"leeway" mapstructure:"leeway"`
+}
+
+// Issuers verifies tokens with the trusted issuer selected by the "iss"
+// claim of the token.
+type Issuers struct {
+	issuers map[string]*Issuer
+
+	now func() time.Time
+}
+
+// NewIssuers creates the set of trusted issuers; the issuer names must be
+// unique.
+func NewIssuers(issuers ...*Issuer) (*Issuers, error) {
+	ret := &Issuers{
+		issuers: make(map[string]*Issuer, len(issuers)),
+		now:     time.Now,
+	}
+	for _, issuer := range issuers {
+		if issuer == nil {
+			continue
+		} else if issuer.Keys == nil {
+			return nil, errors.Errorf(
+				"identity: issuer %q has no keys", issuer.Name)
+		} else if _, dup := ret.issuers[issuer.Name]; dup {
+			return nil, errors.Errorf(
+				"identity: duplicate issuer %q", issuer.Name)
+		}
+		ret.issuers[issuer.Name] = issuer
+	}
+	return ret, nil
+}
+
+// LoadIssuers creates the set of trusted issuers from the configuration,
+// loading the keys from disk.
+func LoadIssuers(configs []IssuerConfig) (*Issuers, error) {
+	issuers := make([]*Issuer, 0, len(configs))
+	for _, config := range configs {
+		if len(config.Keys) == 0 {
+			return nil, errors.Errorf(
+				"identity: issuer %q has no keys", config.Issuer)
+		}
+		keySet := make(StaticKeySet, len(config.Keys))
+		for kid, path := range config.Keys {
+			key, err := keys.LoadPublic(path)
+			if err != nil {
+				return nil, errors.Wrapf(err,
+					"identity: failed to load key %q of issuer %q",
+					kid, config.Issuer)
+			}
+			keySet[kid] = key
+		}
+		issuers = append(issuers, &Issuer{
+			Name:      config.Issuer,
+			Keys:      keySet,
+			Audiences: config.Audiences,
+			Leeway:    config.Leeway,
+		})
+	}
+	return NewIssuers(issuers...)
+}
+
+type tokenHeader struct {
+	Algorithm string   `json:"alg"`
+	KeyID     string   `json:"kid"`
+	Critical  []string `json:"crit"`
+}
+
+// audience is the "aud" claim which is either a string or an array.
+type audience []string
+
+func (aud *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(aud))
+}
+
+type registeredClaims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+func numericDate(value float64) time.Time {
+	sec, frac := math.Modf(value)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Verify verifies the signature and the registered claims of the token
+// with the issuer named by its "iss" claim and returns the identity.
+// Tokens must have an "exp" claim.
+func (iss *Issuers) Verify(token string) (Identity, error) {
+	id, _, err := iss.verify(token)
+	return id, err
+}
+
+func (iss *Issuers) verify(token string) (id Identity, expires time.Time, err error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return id, expires, errors.New("identity: incorrect token format")
+	}
+	var (
+		header tokenHeader
+		claims registeredClaims
+	)
+	if err = decodeSegment(segments[0], &header); err != nil {
+		return id, expires, errors.Wrap(err,
+			"identity: failed to decode JWT header")
+	}
+	if err = decodeSegment(segments[1], &claims); err != nil {
+		return id, expires, errors.Wrap(err,
+			"identity: failed to decode JWT claims")
+	}
+	if len(header.Critical) > 0 {
+		return id, expires, errors.Errorf(
+			"identity: unsupported critical JWT header(s): %s",
+			strings.Join(header.Critical, ", "))
+	}
+	issuer, ok := iss.issuers[claims.Issuer]
+	if !ok {
+		return id, expires, errors.Wrapf(ErrUnknownIssuer,
+			"issuer %q", claims.Issuer)
+	}
+	key, err := issuer.Keys.Key(header.KeyID)
+	if err != nil {
+		return id, expires, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return id, expires, errors.Wrap(err,
+			"identity: failed to decode JWT signature")
+	}
+	signedLen := len(segments[0]) + 1 + len(segments[1])
+	err = verifySignature(header.Algorithm, key, []byte(token[:signedLen]), signature)
+	if err != nil {
+		return id, expires, err
+	}
+
+	now := iss.now()
+	if claims.ExpiresAt == nil {
+		return id, expires, errors.New("identity: claim \"exp\" is required")
+	}
+	expires = numericDate(*claims.ExpiresAt)
+	if !now.Before(expires.Add(issuer.Leeway)) {
+		return id, expires, ErrTokenExpired
+	}
+	if claims.NotBefore != nil &&
+		now.Add(issuer.Leeway).Before(numericDate(*claims.NotBefore)) {
+		return id, expires, ErrTokenNotValidYet
+	}
+	if !acceptsAudience(issuer.Audiences, claims.Audience) {
+		return id, expires, ErrInvalidAudience
+	}
+
+	if err = decodeSegment(segments[1], &id); err != nil {
+		return id, expires, errors.Wrap(err,
+			"identity: failed to decode JSON JWT claims")
+	}
+	return id, expires, id.Validate()
+}
+
+func acceptsAudience(accepted []string, aud audience) bool {
+	if len(accepted) == 0 {
+		return true
+	}
+	for _, a := range aud {
+		for _, b := range accepted {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errors.Wrapf(ErrUnsupportedAlgorithm, "%s with %T", alg, key)
+		}
+		if !ed25519.Verify(pub, signed, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return errors.Wrapf(ErrUnsupportedAlgorithm, "%q", alg)
+	}
+	h := hash.New()
+	_, _ = h.Write(signed)
+	digest := h.Sum(nil)
+
+	var valid bool
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[0] {
+		case 'R':
+			valid = rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+		case 'P':
+			valid = rsa.VerifyPSS(pub, hash, digest, signature,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		default:
+			return errors.Wrapf(ErrUnsupportedAlgorithm, "%s with RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' || pub.Curve != curveForHash(hash) {
+			return errors.Wrapf(ErrUnsupportedAlgorithm, "%s with ECDSA key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		valid = ecdsa.Verify(pub, digest, r, s)
+	default:
+		return errors.Wrapf(ErrUnsupportedAlgorithm, "%s with %T", alg, key)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func curveForHash(hash crypto.Hash) elliptic.Curve {
+	switch hash {
+	case crypto.SHA256:
+		return elliptic.P256()
+	case crypto.SHA384:
+		return elliptic.P384()
+	default:
+		return elliptic.P521()
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testRSAKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	testECDSAKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, testEdKey, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]interface{}{
+		"alg": alg, "typ": "JWT", "kid": kid,
+	})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	var (
+		sig []byte
+		err error
+	)
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case *ecdsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case *rsa.PrivateKey:
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		if alg == "PS256" {
+			sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest.Sum(nil),
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestIssuersVerify(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	issuers, err := NewIssuers(&Issuer{
+		Name: "Mender",
+		Keys: StaticKeySet{"": testRSAKey.Public()},
+	}, &Issuer{
+		Name: "https://sso.example.com",
+		Keys: StaticKeySet{
+			"ed":    testEdKey.Public(),
+			"ecdsa": testECDSAKey.Public(),
+		},
+		Audiences: []string{"mender", "hosted-mender"},
+		Leeway:    time.Minute,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	issuers.now = func() time.Time { return now }
+	exp := now.Add(time.Hour).Unix()
+
+	testCases := []struct {
+		Name  string
+		Token string
+
+		Identity Identity
+		Error    error
+	}{{
+		Name: "ok, mender RS256",
+		Token: signToken(t, "RS256", "", testRSAKey, map[string]interface{}{
+			"iss": "Mender", "exp": exp, "sub": "user", "mender.user": true,
+		}),
+		Identity: Identity{Subject: "user", IsUser: true},
+	}, {
+		Name: "ok, mender PS256",
+		Token: signToken(t, "PS256", "", testRSAKey, map[string]interface{}{
+			"iss": "Mender", "exp": exp, "sub": "user",
+		}),
+		Identity: Identity{Subject: "user"},
+	}, {
+		Name: "ok, sso EdDSA",
+		Token: signToken(t, "EdDSA", "ed", testEdKey, map[string]interface{}{
+			"iss": "https://sso.example.com", "exp": exp, "sub": "sso-user",
+			"aud": []string{"other", "mender"},
+		}),
+		Identity: Identity{Subject: "sso-user"},
+	}, {
+		Name: "ok, sso ES256 within leeway",
+		Token: signToken(t, "ES256", "ecdsa", testECDSAKey, map[string]interface{}{
+			"iss": "https://sso.example.com", "sub": "sso-user",
+			"aud": "hosted-mender",
+			"exp": now.Add(-30 * time.Second).Unix(),
+			"nbf": now.Add(30 * time.Second).Unix(),
+		}),
+		Identity: Identity{Subject: "sso-user"},
+	}, {
+		Name: "error, unknown issuer",
+		Token: signToken(t, "RS256", "", testRSAKey, map[string]interface{}{
+			"iss": "Mallory", "exp": exp, "sub": "user",
+		}),
+		Error: ErrUnknownIssuer,
+	}, {
+		Name: "error, signed with the key of another issuer",
+		Token: signToken(t, "EdDSA", "", testEdKey, map[string]interface{}{
+			"iss": "Mender", "exp": exp, "sub": "user",
+		}),
+		Error: ErrUnsupportedAlgorithm,
+	}, {
+		Name: "error, key not found",
+		Token: signToken(t, "EdDSA", "other", testEdKey, map[string]interface{}{
+			"iss": "https://sso.example.com", "exp": exp, "sub": "user",
+			"aud": "mender",
+		}),
+		Error: ErrKeyNotFound,
+	}, {
+		Name: "error, invalid signature",
+		Token: signToken(t, "RS256", "", testRSAKey, map[string]interface{}{
+			"iss": "Mender", "exp": exp, "sub": "user",
+		}) + "AAAA",
+		Error: ErrInvalidSignature,
+	}, {
+		Name: "error, alg none",
+		Token: signToken(t, "none", "", testRSAKey, map[string]interface{}{
+			"iss": "Mender", "exp": exp, "sub": "user",
+		}),
+		Error: ErrUnsupportedAlgorithm,
+	}, {
+		Name: "error, expired",
+		Token: signToken(t, "RS256", "", testRSAKey, map[string]interface{}{
+			"iss": "Mender", "exp": now.Unix(), "sub": "user",
+		}),
+		Error: ErrTokenExpired,
+	}, {
+		Name: "error, not valid yet",
+		Token: signToken(t, "EdDSA", "ed", testEdKey, map[string]interface{}{
+			"iss": "https://sso.example.com", "exp": exp, "sub": "user",
+			"aud": "mender", "nbf": now.Add(time.Hour).Unix(),
+		}),
+		Error: ErrTokenNotValidYet,
+	}, {
+		Name: "error, audience",
+		Token: signToken(t, "EdDSA", "ed", testEdKey, map[string]interface{}{
+			"iss": "https://sso.example.com", "exp": exp, "sub": "user",
+			"aud": "someone-else",
+		}),
+		Error: ErrInvalidAudience,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			id, err := issuers.Verify(tc.Token)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Identity, id)
+			}
+		})
+	}
+
+	_, err = issuers.Verify(signToken(t, "RS256", "", testRSAKey,
+		map[string]interface{}{"iss": "Mender", "sub": "user"}))
+	assert.EqualError(t, err, `identity: claim "exp" is required`)
+
+	_, err = issuers.Verify("foo.bar")
+	assert.EqualError(t, err, "identity: incorrect token format")
+}
+
+func TestNewIssuers(t *testing.T) {
+	t.Parallel()
+	_, err := NewIssuers(&Issuer{Name: "Mender"})
+	assert.EqualError(t, err, `identity: issuer "Mender" has no keys`)
+
+	keys := StaticKeySet{"": testRSAKey.Public()}
+	_, err = NewIssuers(&Issuer{Name: "Mender", Keys: keys},
+		&Issuer{Name: "Mender", Keys: keys})
+	assert.EqualError(t, err, `identity: duplicate issuer "Mender"`)
+
+	issuers, err := LoadIssuers([]IssuerConfig{{
+		Issuer: "Mender",
+		Keys:   map[string]string{"key": "../keys/testdata/public.pem"},
+	}})
+	if assert.NoError(t, err) {
+		_, err = issuers.issuers["Mender"].Keys.Key("")
+		assert.NoError(t, err)
+	}
+	_, err = LoadIssuers([]IssuerConfig{{
+		Issuer: "Mender",
+		Keys:   map[string]string{"key": "does-not-exist.pem"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestGinMiddlewareIssuers(t *testing.T) {
+	t.Parallel()
+	issuers, _ := NewIssuers(&Issuer{
+		Name: "Mender",
+		Keys: StaticKeySet{"": testEdKey.Public()},
+	})
+	router := gin.New()
+	router.Use(Middleware(NewMiddlewareOptions().
+		SetIssuers(issuers).
+		SetTokenCache(NewTokenCache(0, 0))))
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c.Request.Context()).Subject)
+	})
+
+	for _, tc := range []struct {
+		Token  string
+		Status int
+	}{{
+		Token: signToken(t, "EdDSA", "", testEdKey, map[string]interface{}{
+			"iss": "Mender", "exp": time.Now().Add(time.Hour).Unix(), "sub": "user",
+		}),
+		Status: http.StatusOK,
+	}, {
+		Token:  makeFakeAuth(Identity{Subject: "user"}),
+		Status: http.StatusUnauthorized,
+	}} {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.Token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.Status, w.Code)
+	}
+}
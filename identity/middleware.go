@@ -20,7 +20,9 @@ import (
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 
+	"github.com/mendersoftware/go-lib-micro/authaudit"
 	"github.com/mendersoftware/go-lib-micro/log"
 	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
 )
@@ -32,6 +34,32 @@ type MiddlewareOptions struct {
 
 	// UpdateLogger adds the decoded identity to the log context.
 	UpdateLogger *bool
+
+	// TokenCache caches the identities of recently seen tokens such
+	// that repeated requests with the same token skip decoding it.
+	TokenCache *TokenCache
+
+	// Issuers verifies the tokens with the trusted issuers. By default
+	// the signature of the token is not verified.
+	Issuers *Issuers
+
+	// TokenSource extracts the JWT of the requests. Defaults to the
+	// DefaultTokenSource.
+	TokenSource TokenSource
+
+	// Extractor extracts the identity of the requests, e.g. the
+	// Extractors of the JWTExtractor and a SignatureExtractor. Defaults
+	// to the TokenExtractor with the TokenSource, TokenCache and
+	// Issuers.
+	Extractor IdentityExtractor
+
+	// TenantFallback sets the sources of the tenant of identities
+	// without tenant of the default TokenExtractor; custom Extractors
+	// can use TenantFallback.TokenExtractor.
+	TenantFallback *TenantFallback
+
+	// Auditor emits the security events of the rejected requests.
+	Auditor *authaudit.Auditor
 }
 
 func NewMiddlewareOptions() *MiddlewareOptions {
@@ -48,59 +76,145 @@ func (opts *MiddlewareOptions) SetUpdateLogger(updateLogger bool) *MiddlewareOpt
 	return opts
 }
 
-func middlewareWithLogger(c *gin.Context) {
-	var (
-		err    error
-		jwt    string
-		idty   Identity
-		logCtx = log.Ctx{}
-		key    = "sub"
-		ctx    = c.Request.Context()
-		l      = log.FromContext(ctx)
-	)
-	jwt, err = ExtractJWTFromHeader(c.Request)
-	if err != nil {
-		goto exitUnauthorized
+func (opts *MiddlewareOptions) SetTokenCache(cache *TokenCache) *MiddlewareOptions {
+	opts.TokenCache = cache
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetIssuers(issuers *Issuers) *MiddlewareOptions {
+	opts.Issuers = issuers
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetTokenSource(source TokenSource) *MiddlewareOptions {
+	opts.TokenSource = source
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetExtractor(extractor IdentityExtractor) *MiddlewareOptions {
+	opts.Extractor = extractor
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetTenantFallback(fallback *TenantFallback) *MiddlewareOptions {
+	opts.TenantFallback = fallback
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetAuditor(auditor *authaudit.Auditor) *MiddlewareOptions {
+	opts.Auditor = auditor
+	return opts
+}
+
+func mergeMiddlewareOptions(opts ...*MiddlewareOptions) *MiddlewareOptions {
+	// Initialize default options
+	opt := NewMiddlewareOptions().
+		SetUpdateLogger(true)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.PathRegex != nil {
+			opt.PathRegex = o.PathRegex
+		}
+		if o.UpdateLogger != nil {
+			opt.UpdateLogger = o.UpdateLogger
+		}
+		if o.TokenCache != nil {
+			opt.TokenCache = o.TokenCache
+		}
+		if o.Issuers != nil {
+			opt.Issuers = o.Issuers
+		}
+		if o.TokenSource != nil {
+			opt.TokenSource = o.TokenSource
+		}
+		if o.Extractor != nil {
+			opt.Extractor = o.Extractor
+		}
+		if o.TenantFallback != nil {
+			opt.TenantFallback = o.TenantFallback
+		}
+		if o.Auditor != nil {
+			opt.Auditor = o.Auditor
+		}
 	}
-	idty, err = ExtractIdentity(jwt)
-	if err != nil {
-		goto exitUnauthorized
+	return opt
+}
+
+// tokenSource returns the TokenSource or the DefaultTokenSource.
+func (opts *MiddlewareOptions) tokenSource() TokenSource {
+	if opts.TokenSource == nil {
+		return DefaultTokenSource
 	}
-	ctx = WithContext(ctx, &idty)
+	return opts.TokenSource
+}
+
+// extractor returns the Extractor or the default TokenExtractor with the
+// TenantFallback.
+func (opts *MiddlewareOptions) extractor() IdentityExtractor {
+	if opts.Extractor != nil {
+		return opts.Extractor
+	}
+	return opts.TenantFallback.TokenExtractor(opts.tokenSource(), opts.TokenCache, opts.Issuers)
+}
+
+// logFields returns the log fields of the identity.
+func logFields(idty *Identity) log.Ctx {
+	key := "sub"
 	if idty.IsDevice {
 		key = "device_id"
 	} else if idty.IsUser {
 		key = "user_id"
 	}
-	logCtx[key] = idty.Subject
+	logCtx := log.Ctx{key: idty.Subject}
 	if idty.Tenant != "" {
 		logCtx["tenant_id"] = idty.Tenant
 	}
 	if idty.Plan != "" {
 		logCtx["plan"] = idty.Plan
 	}
-	ctx = log.WithContext(ctx, l.F(logCtx))
+	return logCtx
+}
+
+func middlewareWithLogger(
+	extractor IdentityExtractor,
+	opt *MiddlewareOptions,
+	c *gin.Context,
+) {
+	var (
+		err  error
+		idty Identity
+		ctx  = c.Request.Context()
+		l    = log.FromContext(ctx)
+	)
+	idty, err = extractor.ExtractIdentity(c.Request)
+	if err != nil {
+		goto exitUnauthorized
+	}
+	ctx = WithContext(ctx, &idty)
+	ctx = log.WithContext(ctx, l.F(logFields(&idty)))
 
 	c.Request = c.Request.WithContext(ctx)
 	return
 exitUnauthorized:
+	audit(opt.Auditor, opt.tokenSource(), c.Request, c.FullPath(), err)
 	c.Header("WWW-Authenticate", `Bearer realm="ManagementJWT"`)
 	urest.RenderError(c, http.StatusUnauthorized, err)
 	c.Abort()
 }
 
-func middlewareBase(c *gin.Context) {
+func middlewareBase(
+	extractor IdentityExtractor,
+	opt *MiddlewareOptions,
+	c *gin.Context,
+) {
 	var (
 		err  error
-		jwt  string
 		idty Identity
 		ctx  = c.Request.Context()
 	)
-	jwt, err = ExtractJWTFromHeader(c.Request)
-	if err != nil {
-		goto exitUnauthorized
-	}
-	idty, err = ExtractIdentity(jwt)
+	idty, err = extractor.ExtractIdentity(c.Request)
 	if err != nil {
 		goto exitUnauthorized
 	}
@@ -108,6 +222,7 @@ func middlewareBase(c *gin.Context) {
 	c.Request = c.Request.WithContext(ctx)
 	return
 exitUnauthorized:
+	audit(opt.Auditor, opt.tokenSource(), c.Request, c.FullPath(), err)
 	c.Header("WWW-Authenticate", `Bearer realm="ManagementJWT"`)
 	urest.RenderError(c, http.StatusUnauthorized, err)
 	c.Abort()
@@ -115,22 +230,10 @@ exitUnauthorized:
 
 func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
 
-	var middleware gin.HandlerFunc
+	var middleware func(IdentityExtractor, *MiddlewareOptions, *gin.Context)
 
-	// Initialize default options
-	opt := NewMiddlewareOptions().
-		SetUpdateLogger(true)
-	for _, o := range opts {
-		if o == nil {
-			continue
-		}
-		if o.PathRegex != nil {
-			opt.PathRegex = o.PathRegex
-		}
-		if o.UpdateLogger != nil {
-			opt.UpdateLogger = o.UpdateLogger
-		}
-	}
+	opt := mergeMiddlewareOptions(opts...)
+	extractor := opt.extractor()
 
 	if *opt.UpdateLogger {
 		middleware = middlewareWithLogger
@@ -144,10 +247,12 @@ func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
 			if !pathRegex.MatchString(c.FullPath()) {
 				return
 			}
-			middleware(c)
+			middleware(extractor, opt, c)
 		}
 	}
-	return middleware
+	return func(c *gin.Context) {
+		middleware(extractor, opt, c)
+	}
 }
 
 // IdentityMiddleware adds the identity extracted from JWT token to the request's context.
@@ -163,13 +268,51 @@ type IdentityMiddleware struct {
 	// is not a user or a device token, the middelware will add a 'sub'
 	// field to the logger
 	UpdateLogger bool
+
+	// TokenCache optionally caches the identities of recently seen
+	// tokens.
+	TokenCache *TokenCache
+
+	// Issuers optionally verifies the tokens with the trusted issuers.
+	Issuers *Issuers
+
+	// TokenSource optionally replaces the DefaultTokenSource.
+	TokenSource TokenSource
+
+	// Extractor optionally replaces the extraction of the identity from
+	// the JWT, see MiddlewareOptions.Extractor.
+	Extractor IdentityExtractor
+
+	// TenantFallback optionally sets the sources of the tenant of
+	// identities without tenant.
+	TenantFallback *TenantFallback
+}
+
+// NewTokenParser returns a function extracting the identity from a token
+// the same way as the middleware: verified by issuers, if not nil, and
+// cached in cache, if not nil.
+func NewTokenParser(cache *TokenCache, issuers *Issuers) func(token string) (Identity, error) {
+	return newIdentityParser(cache, issuers)
+}
+
+func newIdentityParser(cache *TokenCache, issuers *Issuers) func(string) (Identity, error) {
+	return func(token string) (Identity, error) {
+		return cache.extract(token, issuers)
+	}
 }
 
 // MiddlewareFunc makes IdentityMiddleware implement the Middleware interface.
 func (mw *IdentityMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	extractor := NewMiddlewareOptions().
+		SetTokenCache(mw.TokenCache).
+		SetIssuers(mw.Issuers).
+		SetTokenSource(mw.TokenSource).
+		SetExtractor(mw.Extractor).
+		SetTenantFallback(mw.TenantFallback).
+		extractor()
 	return func(w rest.ResponseWriter, r *rest.Request) {
-		jwt, err := ExtractJWTFromHeader(r.Request)
-		if err != nil {
+		identity, err := extractor.ExtractIdentity(r.Request)
+		if errors.Is(err, ErrNoCredentials) {
 			h(w, r)
 			return
 		}
@@ -177,9 +320,8 @@ func (mw *IdentityMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFun
 		ctx := r.Context()
 		l := log.FromContext(ctx)
 
-		identity, err := ExtractIdentity(jwt)
 		if err != nil {
-			l.Warnf("Failed to parse extracted JWT: %s",
+			l.Warnf("Failed to extract identity: %s",
 				err.Error(),
 			)
 		} else {
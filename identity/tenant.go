@@ -0,0 +1,117 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TenantFallback configures the sources of the tenant for tokens without
+// the "mender.tenant" claim, such as tokens of SSO providers using other
+// claim names. The tenant is taken from the first of the Claims present
+// in the token and, if none are present, from the Header. The
+// "mender.tenant" claim always takes precedence.
+//
+// The Header must only be used behind a gateway which sets it, since the
+// client is otherwise free to choose the tenant.
+type TenantFallback struct {
+	// Claims are the names of the claims holding the tenant in order of
+	// precedence, e.g. "tid" and "org_id". The values must be strings
+	// or numbers.
+	Claims []string `json:"claims" mapstructure:"claims"`
+	// Header is the name of the request header holding the tenant.
+	Header string `json:"header" mapstructure:"header"`
+}
+
+// TokenExtractor returns the TokenExtractor of the source (nil defaults
+// to the DefaultTokenSource) adding the fallback tenant to the identities
+// without tenant. The claims are read from the token the identity was
+// parsed from, once it was verified with the issuers (or, without issuers,
+// decoded as verified by the gateway). Identities of other extractors
+// never get the fallback tenant, since their requests may carry tokens
+// nobody verified.
+func (fb *TenantFallback) TokenExtractor(
+	source TokenSource,
+	cache *TokenCache,
+	issuers *Issuers,
+) IdentityExtractor {
+	if source == nil {
+		source = DefaultTokenSource
+	}
+	parse := newIdentityParser(cache, issuers)
+	if fb == nil || (len(fb.Claims) == 0 && fb.Header == "") {
+		return jwtExtractor(source, parse)
+	}
+	return IdentityExtractorFunc(func(r *http.Request) (Identity, error) {
+		jwt, err := source.ExtractToken(r)
+		if err != nil {
+			return Identity{}, noCredentialsError{err}
+		}
+		idty, err := parse(jwt)
+		if err != nil || idty.Tenant != "" {
+			return idty, err
+		}
+		idty.Tenant, err = fb.tenant(r, jwt)
+		return idty, err
+	})
+}
+
+func (fb *TenantFallback) tenant(r *http.Request, jwt string) (string, error) {
+	if len(fb.Claims) > 0 {
+		tenant, err := tenantFromClaims(jwt, fb.Claims)
+		if err != nil || tenant != "" {
+			return tenant, err
+		}
+	}
+	if fb.Header != "" {
+		return r.Header.Get(fb.Header), nil
+	}
+	return "", nil
+}
+
+func tenantFromClaims(token string, names []string) (string, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return "", errors.New("identity: incorrect token format")
+	}
+	var claims map[string]json.RawMessage
+	if err := decodeSegment(segments[1], &claims); err != nil {
+		return "", errors.Wrap(err, "identity: failed to decode JWT claims")
+	}
+	for _, name := range names {
+		raw, ok := claims[name]
+		if !ok || bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		var tenant string
+		if err := json.Unmarshal(raw, &tenant); err != nil {
+			var number json.Number
+			if json.Unmarshal(raw, &number) != nil {
+				return "", errors.Errorf(
+					"identity: claim %q is not a string or a number", name)
+			}
+			tenant = number.String()
+		}
+		if tenant != "" {
+			return tenant, nil
+		}
+	}
+	return "", nil
+}
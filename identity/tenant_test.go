@@ -0,0 +1,164 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeFakeClaims(claims map[string]interface{}) string {
+	b, _ := json.Marshal(claims)
+	return "aGVhZGVy." + base64.RawURLEncoding.EncodeToString(b) + ".c2lnbg"
+}
+
+func TestTenantFallback(t *testing.T) {
+	t.Parallel()
+	fallback := &TenantFallback{
+		Claims: []string{"tid", "org_id"},
+		Header: "X-Tenant-ID",
+	}
+	testCases := []struct {
+		Name string
+
+		Claims map[string]interface{}
+		Header string
+
+		Tenant string
+		Error  string
+	}{{
+		Name: "mender.tenant takes precedence",
+
+		Claims: map[string]interface{}{
+			"sub": "user", "mender.tenant": "tenant", "tid": "tid",
+		},
+		Header: "header",
+		Tenant: "tenant",
+	}, {
+		Name: "claims in order",
+
+		Claims: map[string]interface{}{
+			"sub": "user", "tid": "tid", "org_id": "org",
+		},
+		Header: "header",
+		Tenant: "tid",
+	}, {
+		Name: "numeric claim",
+
+		Claims: map[string]interface{}{
+			"sub": "user", "tid": nil, "org_id": 1234,
+		},
+		Tenant: "1234",
+	}, {
+		Name: "header",
+
+		Claims: map[string]interface{}{"sub": "user", "tid": ""},
+		Header: "header",
+		Tenant: "header",
+	}, {
+		Name: "no tenant",
+
+		Claims: map[string]interface{}{"sub": "user"},
+	}, {
+		Name: "invalid claim",
+
+		Claims: map[string]interface{}{"sub": "user", "tid": true},
+		Error:  `identity: claim "tid" is not a string or a number`,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+			req.Header.Set("Authorization", "Bearer "+makeFakeClaims(tc.Claims))
+			if tc.Header != "" {
+				req.Header.Set("X-Tenant-ID", tc.Header)
+			}
+			idty, err := fallback.TokenExtractor(nil, nil, nil).ExtractIdentity(req)
+			if tc.Error != "" {
+				assert.EqualError(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Tenant, idty.Tenant)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTenantFallback(t *testing.T) {
+	t.Parallel()
+	var got *Identity
+	handler := HTTPMiddleware(NewMiddlewareOptions().
+		SetTenantFallback(&TenantFallback{Claims: []string{"org_id"}}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+		}))
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeFakeClaims(
+		map[string]interface{}{"sub": "user", "org_id": "org"},
+	))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "org", got.Tenant)
+	}
+}
+
+func TestMiddlewareTenantFallbackTokenSource(t *testing.T) {
+	t.Parallel()
+	var got *Identity
+	handler := HTTPMiddleware(NewMiddlewareOptions().
+		SetTokenSource(WebSocketProtocolToken("jwt.")).
+		SetTenantFallback(&TenantFallback{Claims: []string{"org_id"}}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+		}))
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set("Sec-WebSocket-Protocol", "protomsg, jwt."+makeFakeClaims(
+		map[string]interface{}{"sub": "user", "org_id": "org"},
+	))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "org", got.Tenant)
+	}
+}
+
+func TestMiddlewareTenantFallbackCustomExtractor(t *testing.T) {
+	t.Parallel()
+	var got *Identity
+	handler := HTTPMiddleware(NewMiddlewareOptions().
+		SetExtractor(IdentityExtractorFunc(func(r *http.Request) (Identity, error) {
+			return Identity{Subject: "device", IsDevice: true}, nil
+		})).
+		SetTenantFallback(&TenantFallback{
+			Claims: []string{"org_id"},
+			Header: "X-Tenant-ID",
+		}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+		}))
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set("Authorization", "Bearer "+makeFakeClaims(
+		map[string]interface{}{"sub": "user", "org_id": "org"},
+	))
+	req.Header.Set("X-Tenant-ID", "header")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, got) {
+		assert.Empty(t, got.Tenant, "the fallback only applies to the token identities")
+	}
+}
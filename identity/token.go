@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 
@@ -34,49 +35,51 @@ type Identity struct {
 	Trial    bool           `json:"mender.trial"`
 }
 
-// ExtractJWTFromHeader inspect the Authorization header for a Bearer token and
-// if not present looks for a "JWT" cookie.
-func ExtractJWTFromHeader(r *http.Request) (jwt string, err error) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		jwtCookie, err := r.Cookie("JWT")
-		if err != nil {
-			return "", errors.New("Authorization not present in header")
-		}
-		jwt = jwtCookie.Value
-	} else {
-		auths := strings.Split(auth, " ")
+// maxPooledClaimsSize is the size of the pooled buffers for the base64
+// decoded JWT claims; larger claims are decoded in a dedicated buffer.
+const maxPooledClaimsSize = 4096
 
-		if len(auths) != 2 {
-			return "", errors.Errorf("malformed Authorization header")
-		}
+var claimsBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, maxPooledClaimsSize)
+		return &buf
+	},
+}
 
-		if !strings.EqualFold(auths[0], "Bearer") {
-			return "", errors.Errorf("unknown Authorization method %s", auths[0])
-		}
-		jwt = auths[1]
-	}
-	return jwt, nil
+// ExtractJWTFromHeader inspect the Authorization header for a Bearer token and
+// if not present looks for a "JWT" cookie, see DefaultTokenSource.
+func ExtractJWTFromHeader(r *http.Request) (jwt string, err error) {
+	return DefaultTokenSource.ExtractToken(r)
 }
 
 // Generate identity information from given JWT by extracting subject and tenant claims.
 // Note that this function does not perform any form of token signature
 // verification.
 func ExtractIdentity(token string) (id Identity, err error) {
-	var (
-		claims []byte
-		jwt    []string
-	)
-	jwt = strings.Split(token, ".")
-	if len(jwt) != 3 {
+	// Locate the claims of the token ("header.claims.signature").
+	start := strings.IndexByte(token, '.') + 1
+	end := strings.IndexByte(token[start:], '.') + start
+	if start == 0 || end < start ||
+		strings.IndexByte(token[end+1:], '.') >= 0 {
 		return id, errors.New("identity: incorrect token format")
 	}
-	claims, err = base64.RawURLEncoding.DecodeString(jwt[1])
+	rawClaims := token[start:end]
+
+	var claims []byte
+	n := base64.RawURLEncoding.DecodedLen(len(rawClaims))
+	if n <= maxPooledClaimsSize {
+		bufPtr := claimsBufferPool.Get().(*[]byte)
+		defer claimsBufferPool.Put(bufPtr)
+		claims = (*bufPtr)[:n]
+	} else {
+		claims = make([]byte, n)
+	}
+	n, err = base64.RawURLEncoding.Decode(claims, []byte(rawClaims))
 	if err != nil {
 		return id, errors.Wrap(err,
 			"identity: failed to decode base64 JWT claims")
 	}
-	err = json.Unmarshal(claims, &id)
+	err = json.Unmarshal(claims[:n], &id)
 	if err != nil {
 		return id, errors.Wrap(err,
 			"identity: failed to decode JSON JWT claims")
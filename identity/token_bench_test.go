@@ -0,0 +1,39 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package identity
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func BenchmarkExtractIdentity(b *testing.B) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{` +
+		`"exp":1735689600,"iat":1704067200,"iss":"Mender",` +
+		`"jti":"4a1a8e38-5bba-4e4b-a1b5-e6b4d9a0a3c2",` +
+		`"sub":"ddcf2b8f-07b9-4b2f-8a5e-0d4ebf2e2e0f",` +
+		`"mender.tenant":"5f0c1cd3f8f7a9b8e1c1e6f1",` +
+		`"mender.plan":"enterprise","mender.device":true,` +
+		`"mender.trial":false}`))
+	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." + claims +
+		".c2lnbmF0dXJlLXBsYWNlaG9sZGVyLWZvci1iZW5jaG1hcmtz"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := ExtractIdentity(token)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
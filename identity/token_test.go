@@ -143,3 +143,30 @@ func TestExtractIdentityFromHeaders(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, actualJWT, jwt)
 }
+
+func TestExtractIdentityTokenFormat(t *testing.T) {
+	rawclaims := makeClaimsPart("foobar", "tenant", "")
+	for _, token := range []string{
+		"",
+		".",
+		rawclaims,
+		"foo." + rawclaims,
+		rawclaims + ".bar",
+		"foo." + rawclaims + ".bar.baz",
+	} {
+		_, err := ExtractIdentity(token)
+		assert.EqualError(t, err, "identity: incorrect token format", token)
+	}
+
+	// The claims are decoded into a pooled buffer: make sure the
+	// (larger) claims of a previous token do not leak into the result.
+	large := makeClaimsFull("foobar", "tenant", "enterprise", true, false, true)
+	small := makeClaimsPart("baz", "", "")
+	for i := 0; i < 10; i++ {
+		_, err := ExtractIdentity("." + large + ".")
+		assert.NoError(t, err)
+		id, err := ExtractIdentity("." + small + ".")
+		assert.NoError(t, err)
+		assert.Equal(t, Identity{Subject: "baz"}, id)
+	}
+}
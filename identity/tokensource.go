@@ -0,0 +1,250 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// JWTCookieName is the name of the cookie of the DefaultTokenSource.
+	JWTCookieName = "JWT"
+
+	// WebSocketBearerProtocol is the Sec-WebSocket-Protocol entry
+	// preceding the token, e.g. "Sec-WebSocket-Protocol: bearer, <jwt>".
+	WebSocketBearerProtocol = "bearer"
+
+	// DefaultQueryParam is the default query parameter of the
+	// SignedQueryToken.
+	DefaultQueryParam = "jwt"
+
+	webSocketProtocolHeader = "Sec-WebSocket-Protocol"
+	querySuffixExpires      = "_expires"
+	querySuffixSignature    = "_signature"
+)
+
+var (
+	// ErrNoToken is returned by the token sources if the request does
+	// not carry the token. The message is kept for compatibility with
+	// the responses of the middlewares.
+	ErrNoToken = errors.New("Authorization not present in header")
+
+	ErrInvalidQuerySignature = errors.New("identity: invalid query signature")
+	ErrQueryTokenExpired     = errors.New("identity: query token expired")
+	ErrNoQuerySigningKey     = errors.New("identity: no query signing key")
+)
+
+// TokenSource extracts the JWT from the request. It returns ErrNoToken
+// (errors.Is) if the request does not carry the token.
+type TokenSource interface {
+	ExtractToken(r *http.Request) (string, error)
+}
+
+// TokenSourceFunc is an adapter for using a function as a TokenSource.
+type TokenSourceFunc func(r *http.Request) (string, error)
+
+func (f TokenSourceFunc) ExtractToken(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// DefaultTokenSource extracts the token from the Authorization header or
+// the JWT cookie, see ExtractJWTFromHeader.
+var DefaultTokenSource = TokenSources(
+	AuthorizationHeader(),
+	CookieToken(JWTCookieName),
+)
+
+// TokenSources returns a TokenSource trying the sources in order until one
+// finds the token. Errors other than ErrNoToken, e.g. a malformed
+// Authorization header, are returned without trying the remaining
+// sources.
+func TokenSources(sources ...TokenSource) TokenSource {
+	return TokenSourceFunc(func(r *http.Request) (string, error) {
+		for _, source := range sources {
+			token, err := source.ExtractToken(r)
+			if !errors.Is(err, ErrNoToken) {
+				return token, err
+			}
+		}
+		return "", ErrNoToken
+	})
+}
+
+// AuthorizationHeader extracts the Bearer token of the Authorization
+// header.
+func AuthorizationHeader() TokenSource {
+	return TokenSourceFunc(func(r *http.Request) (string, error) {
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			return "", ErrNoToken
+		}
+		auths := strings.Split(auth, " ")
+		if len(auths) != 2 {
+			return "", errors.Errorf("malformed Authorization header")
+		}
+		if !strings.EqualFold(auths[0], "Bearer") {
+			return "", errors.Errorf("unknown Authorization method %s", auths[0])
+		}
+		return auths[1], nil
+	})
+}
+
+// CookieToken extracts the token from the cookie with the given name.
+func CookieToken(name string) TokenSource {
+	return TokenSourceFunc(func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", ErrNoToken
+		}
+		return cookie.Value, nil
+	})
+}
+
+// WebSocketProtocolToken extracts the token from the Sec-WebSocket-Protocol
+// header of websocket upgrade requests from browsers, which cannot set the
+// Authorization header. The token is either the entry following the
+// WebSocketBearerProtocol ("bearer, <jwt>") or an entry with one of the
+// prefixes ("<prefix><jwt>"). The server must not echo these entries in
+// the handshake response.
+func WebSocketProtocolToken(prefixes ...string) TokenSource {
+	return TokenSourceFunc(func(r *http.Request) (string, error) {
+		var protocols []string
+		for _, value := range r.Header.Values(webSocketProtocolHeader) {
+			for _, protocol := range strings.Split(value, ",") {
+				protocols = append(protocols, strings.TrimSpace(protocol))
+			}
+		}
+		for i, protocol := range protocols {
+			if strings.EqualFold(protocol, WebSocketBearerProtocol) {
+				if i+1 < len(protocols) && protocols[i+1] != "" {
+					return protocols[i+1], nil
+				}
+				continue
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(protocol, prefix) {
+					return strings.TrimPrefix(protocol, prefix), nil
+				}
+			}
+		}
+		return "", ErrNoToken
+	})
+}
+
+// SignedQueryToken extracts the token from the query of URLs signed with
+// Sign, for clients which can set neither headers nor cookies. The query
+// contains the token and its expiration time signed with HMAC-SHA256
+// together with the URL path:
+//
+//	?jwt=<token>&jwt_expires=<unix time>&jwt_signature=<signature>
+//
+// The signature prevents using the token for other endpoints, but note
+// that the query (and the token) may still end up in logs; keep the
+// expiration short.
+type SignedQueryToken struct {
+	// Param is the query parameter of the token; the parameters of the
+	// expiration time and signature are suffixed "_expires" and
+	// "_signature". (default: DefaultQueryParam)
+	Param string
+	// Keys verify the signatures; the first key signs the URLs. Use
+	// multiple keys while rotating the keys.
+	Keys [][]byte
+
+	now func() time.Time
+}
+
+func NewSignedQueryToken(param string, keys ...[]byte) *SignedQueryToken {
+	return &SignedQueryToken{
+		Param: param,
+		Keys:  keys,
+		now:   time.Now,
+	}
+}
+
+func (q *SignedQueryToken) param() string {
+	if q.Param == "" {
+		return DefaultQueryParam
+	}
+	return q.Param
+}
+
+func querySignature(key []byte, path, token, expires string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(path + "\n" + token + "\n" + expires))
+	return mac.Sum(nil)
+}
+
+// Sign adds the token with the expiration time to the query of u. It
+// returns ErrNoQuerySigningKey if no (non-empty) key is configured.
+func (q *SignedQueryToken) Sign(u *url.URL, token string, expires time.Time) error {
+	if len(q.Keys) == 0 || len(q.Keys[0]) == 0 {
+		return ErrNoQuerySigningKey
+	}
+	param := q.param()
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := u.Query()
+	query.Set(param, token)
+	query.Set(param+querySuffixExpires, exp)
+	query.Set(param+querySuffixSignature, base64.RawURLEncoding.EncodeToString(
+		querySignature(q.Keys[0], u.EscapedPath(), token, exp)))
+	u.RawQuery = query.Encode()
+	return nil
+}
+
+func (q *SignedQueryToken) ExtractToken(r *http.Request) (string, error) {
+	param := q.param()
+	query := r.URL.Query()
+	token := query.Get(param)
+	if token == "" {
+		return "", ErrNoToken
+	}
+	exp := query.Get(param + querySuffixExpires)
+	sig, err := base64.RawURLEncoding.DecodeString(
+		query.Get(param + querySuffixSignature))
+	if err != nil || len(sig) == 0 {
+		return "", ErrInvalidQuerySignature
+	}
+	var valid bool
+	for _, key := range q.Keys {
+		if hmac.Equal(sig, querySignature(key, r.URL.EscapedPath(), token, exp)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrInvalidQuerySignature
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", ErrInvalidQuerySignature
+	}
+	now := time.Now
+	if q.now != nil {
+		now = q.now
+	}
+	if !now().Before(time.Unix(unix, 0)) {
+		return "", ErrQueryTokenExpired
+	}
+	return token, nil
+}
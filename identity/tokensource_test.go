@@ -0,0 +1,169 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package identity
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSources(t *testing.T) {
+	t.Parallel()
+	queryToken := NewSignedQueryToken("", []byte("new-key"), []byte("old-key"))
+	source := TokenSources(
+		AuthorizationHeader(),
+		CookieToken(JWTCookieName),
+		WebSocketProtocolToken("base64url.bearer."),
+		queryToken,
+	)
+	signed := func(path string, keys ...[]byte) string {
+		u := &url.URL{Scheme: "http", Host: "localhost", Path: path}
+		err := NewSignedQueryToken("", keys...).Sign(u, "q.r.s", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		// The requests target /ws
+		u.Path = "/ws"
+		return u.String()
+	}
+	expired := &url.URL{Scheme: "http", Host: "localhost", Path: "/ws"}
+	require.NoError(t, queryToken.Sign(expired, "q.r.s", time.Now().Add(-time.Second)))
+	assert.ErrorIs(t, NewSignedQueryToken("").Sign(expired, "q.r.s", time.Now()),
+		ErrNoQuerySigningKey)
+
+	testCases := []struct {
+		Name string
+
+		URL     string
+		Headers http.Header
+		Cookie  *http.Cookie
+
+		Token string
+		Error error
+	}{{
+		Name:  "no token",
+		Error: ErrNoToken,
+	}, {
+		Name:    "authorization header",
+		Headers: http.Header{"Authorization": {"Bearer a.b.c"}},
+		Token:   "a.b.c",
+	}, {
+		Name: "authorization header takes precedence",
+		Headers: http.Header{
+			"Authorization":          {"bearer a.b.c"},
+			"Sec-Websocket-Protocol": {"bearer, d.e.f"},
+		},
+		Token: "a.b.c",
+	}, {
+		Name:    "malformed authorization header",
+		Headers: http.Header{"Authorization": {"Basic Zm9vOmJhcg=="}},
+	}, {
+		Name:   "cookie",
+		Cookie: &http.Cookie{Name: JWTCookieName, Value: "d.e.f"},
+		Token:  "d.e.f",
+	}, {
+		Name:    "websocket protocol",
+		Headers: http.Header{"Sec-Websocket-Protocol": {"protomsg, Bearer, g.h.i"}},
+		Token:   "g.h.i",
+	}, {
+		Name: "websocket protocol, multiple headers",
+		Headers: http.Header{"Sec-Websocket-Protocol": {
+			"protomsg, bearer", "g.h.i",
+		}},
+		Token: "g.h.i",
+	}, {
+		Name:    "websocket protocol, prefix",
+		Headers: http.Header{"Sec-Websocket-Protocol": {"protomsg, base64url.bearer.j.k.l"}},
+		Token:   "j.k.l",
+	}, {
+		Name:    "websocket protocol, missing token",
+		Headers: http.Header{"Sec-Websocket-Protocol": {"protomsg, bearer"}},
+		Error:   ErrNoToken,
+	}, {
+		Name:  "signed query",
+		URL:   signed("/ws", []byte("new-key")),
+		Token: "q.r.s",
+	}, {
+		Name:  "signed query, rotated key",
+		URL:   signed("/ws", []byte("old-key")),
+		Token: "q.r.s",
+	}, {
+		Name:  "signed query, unknown key",
+		URL:   signed("/ws", []byte("other-key")),
+		Error: ErrInvalidQuerySignature,
+	}, {
+		Name:  "signed query, other path",
+		URL:   signed("/api", []byte("new-key")),
+		Error: ErrInvalidQuerySignature,
+	}, {
+		Name:  "signed query, not signed",
+		URL:   "http://localhost/ws?jwt=q.r.s",
+		Error: ErrInvalidQuerySignature,
+	}, {
+		Name:  "signed query, expired",
+		URL:   expired.String(),
+		Error: ErrQueryTokenExpired,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			u := tc.URL
+			if u == "" {
+				u = "http://localhost/ws"
+			}
+			req, _ := http.NewRequest(http.MethodGet, u, nil)
+			for key, values := range tc.Headers {
+				req.Header[key] = values
+			}
+			if tc.Cookie != nil {
+				req.AddCookie(tc.Cookie)
+			}
+			token, err := source.ExtractToken(req)
+			switch {
+			case tc.Error != nil:
+				assert.ErrorIs(t, err, tc.Error)
+			case tc.Token == "":
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrNoToken)
+			default:
+				if assert.NoError(t, err) {
+					assert.Equal(t, tc.Token, token)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenExtractor(t *testing.T) {
+	t.Parallel()
+	idty := Identity{Subject: "user", Tenant: "tenant", IsUser: true}
+	extractor := NewMiddlewareOptions().
+		SetTokenSource(TokenSources(DefaultTokenSource, WebSocketProtocolToken())).
+		extractor()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/ws", nil)
+	_, err := extractor.ExtractIdentity(req)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	req.Header.Set("Sec-WebSocket-Protocol", "bearer, "+makeFakeAuth(idty))
+	got, err := extractor.ExtractIdentity(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, idty, got)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package internalauth authenticates the requests to the internal API
+// with a shared bearer secret or a verified TLS client certificate instead
+// of trusting the network.
+package internalauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+)
+
+const (
+	// DefaultPathRegex matches the internal API routes.
+	DefaultPathRegex = "^/api/internal/"
+
+	// MethodSecret and MethodClientCert are the values of the
+	// LogFieldMethod field.
+	MethodSecret     = "secret"
+	MethodClientCert = "client_cert"
+
+	LogFieldMethod = "internal_auth"
+	LogFieldClient = "internal_client"
+)
+
+var (
+	ErrUnauthorized = errors.New("internalauth: request is not authenticated")
+	ErrInvalidToken = errors.New("internalauth: invalid bearer secret")
+	ErrClientCert   = errors.New("internalauth: client certificate is not allowed")
+)
+
+type MiddlewareOptions struct {
+	// PathRegex selects the routes requiring authentication
+	// (default: DefaultPathRegex).
+	PathRegex *string
+	// Secrets are the accepted bearer secrets; configure more than one
+	// while rotating the secret.
+	Secrets []string
+	// ClientCert accepts requests with a client certificate verified by
+	// the TLS server (tls.Config.ClientAuth must verify the
+	// certificates).
+	ClientCert *bool
+	// ClientSubjects restricts the accepted client certificates to the
+	// given common names or DNS names. If empty, any verified
+	// certificate is accepted.
+	ClientSubjects []string
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetPathRegex(regex string) *MiddlewareOptions {
+	opts.PathRegex = &regex
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetSecrets(secrets ...string) *MiddlewareOptions {
+	opts.Secrets = secrets
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetClientCert(enabled bool) *MiddlewareOptions {
+	opts.ClientCert = &enabled
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetClientSubjects(subjects ...string) *MiddlewareOptions {
+	opts.ClientSubjects = subjects
+	return opts
+}
+
+type authenticator struct {
+	pathRegex      *regexp.Regexp
+	secrets        [][sha256.Size]byte
+	clientCert     bool
+	clientSubjects map[string]struct{}
+}
+
+func newAuthenticator(opts ...*MiddlewareOptions) *authenticator {
+	opt := NewMiddlewareOptions().
+		SetPathRegex(DefaultPathRegex).
+		SetClientCert(false)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.PathRegex != nil {
+			opt.PathRegex = o.PathRegex
+		}
+		if o.Secrets != nil {
+			opt.Secrets = o.Secrets
+		}
+		if o.ClientCert != nil {
+			opt.ClientCert = o.ClientCert
+		}
+		if o.ClientSubjects != nil {
+			opt.ClientSubjects = o.ClientSubjects
+		}
+	}
+	auth := &authenticator{
+		pathRegex:  regexp.MustCompile(*opt.PathRegex),
+		clientCert: *opt.ClientCert,
+	}
+	for _, secret := range opt.Secrets {
+		if secret != "" {
+			auth.secrets = append(auth.secrets, sha256.Sum256([]byte(secret)))
+		}
+	}
+	if len(opt.ClientSubjects) > 0 {
+		auth.clientSubjects = make(map[string]struct{}, len(opt.ClientSubjects))
+		for _, subject := range opt.ClientSubjects {
+			auth.clientSubjects[subject] = struct{}{}
+		}
+	}
+	return auth
+}
+
+// checkSecret compares the digests of the secrets in constant time; the
+// digests also hide the length of the secrets.
+func (auth *authenticator) checkSecret(token string) bool {
+	digest := sha256.Sum256([]byte(token))
+	var match int
+	for i := range auth.secrets {
+		match |= subtle.ConstantTimeCompare(digest[:], auth.secrets[i][:])
+	}
+	return match == 1
+}
+
+func (auth *authenticator) allowedCert(cert *x509.Certificate) bool {
+	if auth.clientSubjects == nil {
+		return true
+	}
+	if _, ok := auth.clientSubjects[cert.Subject.CommonName]; ok {
+		return true
+	}
+	for _, name := range cert.DNSNames {
+		if _, ok := auth.clientSubjects[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate returns the authentication method and the client name.
+func (auth *authenticator) authenticate(r *http.Request) (method, client string, err error) {
+	if header := r.Header.Get("Authorization"); header != "" && len(auth.secrets) > 0 {
+		scheme, token, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") || !auth.checkSecret(token) {
+			return "", "", ErrInvalidToken
+		}
+		return MethodSecret, "", nil
+	}
+	if auth.clientCert && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		if !auth.allowedCert(cert) {
+			return "", cert.Subject.CommonName, ErrClientCert
+		}
+		return MethodClientCert, cert.Subject.CommonName, nil
+	}
+	return "", "", ErrUnauthorized
+}
+
+// audit authenticates the request and logs the outcome: failures are
+// logged as warnings, successes are added to the access log.
+func (auth *authenticator) audit(r *http.Request) error {
+	ctx := r.Context()
+	method, client, err := auth.authenticate(r)
+	if err != nil {
+		fields := log.Ctx{
+			"remote_addr": r.RemoteAddr,
+			"path":        r.URL.Path,
+		}
+		if client != "" {
+			fields[LogFieldClient] = client
+		}
+		log.FromContext(ctx).F(fields).
+			Warnf("internal API request rejected: %s", err)
+		return err
+	}
+	if lc := accesslog.GetContext(ctx); lc != nil {
+		lc.SetField(LogFieldMethod, method)
+		if client != "" {
+			lc.SetField(LogFieldClient, client)
+		}
+	}
+	return nil
+}
+
+// Middleware authenticates the requests to the routes matching the
+// PathRegex with one of the accepted bearer secrets or a verified client
+// certificate. Without secrets and client certificates, all requests to
+// internal routes are rejected.
+func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
+	auth := newAuthenticator(opts...)
+	return func(c *gin.Context) {
+		if !auth.pathRegex.MatchString(c.Request.URL.Path) {
+			return
+		}
+		if err := auth.audit(c.Request); err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="InternalAPI"`)
+			urest.RenderError(c, http.StatusUnauthorized, err)
+			c.Abort()
+		}
+	}
+}
+
+// InternalAuthMiddleware implements the go-json-rest Middleware interface
+// for the legacy APIs, see Middleware.
+type InternalAuthMiddleware struct {
+	Options *MiddlewareOptions
+}
+
+func (mw *InternalAuthMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	auth := newAuthenticator(mw.Options)
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		if auth.pathRegex.MatchString(r.URL.Path) {
+			if err := auth.audit(r.Request); err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="InternalAPI"`)
+				rest_utils.RestErrWithWarningMsg(w, r, log.FromContext(r.Context()),
+					err, http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package internalauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func withClientCert(req *http.Request, cn string, dnsNames ...string) *http.Request {
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{
+			Subject:  pkix.Name{CommonName: cn},
+			DNSNames: dnsNames,
+		}}},
+	}
+	return req
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	newRequest := func(path, auth string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return req
+	}
+	testCases := []struct {
+		Name    string
+		Options *MiddlewareOptions
+		Request *http.Request
+		Status  int
+	}{{
+		Name:    "public route",
+		Options: NewMiddlewareOptions().SetSecrets("s3cr3t"),
+		Request: newRequest("/api/management/v1/foo", ""),
+		Status:  http.StatusOK,
+	}, {
+		Name:    "no credentials",
+		Options: NewMiddlewareOptions().SetSecrets("s3cr3t"),
+		Request: newRequest("/api/internal/v1/foo", ""),
+		Status:  http.StatusUnauthorized,
+	}, {
+		Name:    "valid secret",
+		Options: NewMiddlewareOptions().SetSecrets("old", "s3cr3t"),
+		Request: newRequest("/api/internal/v1/foo", "Bearer s3cr3t"),
+		Status:  http.StatusOK,
+	}, {
+		Name:    "invalid secret",
+		Options: NewMiddlewareOptions().SetSecrets("s3cr3t"),
+		Request: newRequest("/api/internal/v1/foo", "Bearer s3cr3"),
+		Status:  http.StatusUnauthorized,
+	}, {
+		Name:    "wrong scheme",
+		Options: NewMiddlewareOptions().SetSecrets("s3cr3t"),
+		Request: newRequest("/api/internal/v1/foo", "Basic s3cr3t"),
+		Status:  http.StatusUnauthorized,
+	}, {
+		Name:    "no secrets configured",
+		Request: newRequest("/api/internal/v1/foo", "Bearer "),
+		Status:  http.StatusUnauthorized,
+	}, {
+		Name:    "client certificate",
+		Options: NewMiddlewareOptions().SetClientCert(true),
+		Request: withClientCert(newRequest("/api/internal/v1/foo", ""), "deployments"),
+		Status:  http.StatusOK,
+	}, {
+		Name:    "client certificate disabled",
+		Request: withClientCert(newRequest("/api/internal/v1/foo", ""), "deployments"),
+		Status:  http.StatusUnauthorized,
+	}, {
+		Name: "client certificate allowed by DNS name",
+		Options: NewMiddlewareOptions().SetClientCert(true).
+			SetClientSubjects("inventory", "deployments.mender.svc"),
+		Request: withClientCert(newRequest("/api/internal/v1/foo", ""),
+			"client", "deployments.mender.svc"),
+		Status: http.StatusOK,
+	}, {
+		Name: "client certificate not allowed",
+		Options: NewMiddlewareOptions().SetClientCert(true).
+			SetClientSubjects("inventory"),
+		Request: withClientCert(newRequest("/api/internal/v1/foo", ""), "deployments"),
+		Status:  http.StatusUnauthorized,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			router := gin.New()
+			router.Use(Middleware(tc.Options))
+			router.GET("/*path", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tc.Request)
+			assert.Equal(t, tc.Status, w.Code)
+			if tc.Status == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="InternalAPI"`,
+					w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestLegacyMiddleware(t *testing.T) {
+	t.Parallel()
+	app, err := rest.MakeRouter(rest.Get("/api/internal/v1/foo",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(&InternalAuthMiddleware{
+		Options: NewMiddlewareOptions().SetSecrets("s3cr3t"),
+	})
+	api.SetApp(app)
+	handler := api.MakeHandler()
+
+	for auth, status := range map[string]int{
+		"Bearer s3cr3t": http.StatusNoContent,
+		"Bearer wrong":  http.StatusUnauthorized,
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/api/internal/v1/foo", nil)
+		req.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, auth)
+	}
+}
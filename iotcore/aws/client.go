@@ -0,0 +1,268 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package aws implements iotcore.Client for AWS IoT Core using the AWS IoT
+// REST API. Devices are represented as things and the desired state is
+// written to the (classic) device shadow.
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/iotcore"
+)
+
+const (
+	signingNameIoT     = "iot"
+	signingNameIoTData = "iotdata"
+)
+
+var (
+	ErrRegionRequired       = errors.New("aws: region is required")
+	ErrCredentialsRequired  = errors.New("aws: credentials are required")
+	ErrDataEndpointRequired = errors.New(
+		"aws: data endpoint is required for updating the device shadow",
+	)
+)
+
+type Options struct {
+	// Client is the HTTP client used for the API requests.
+	Client *http.Client
+	// Endpoint overrides the AWS IoT control plane endpoint
+	// (default: https://iot.<region>.amazonaws.com).
+	Endpoint *string
+	// DataEndpoint is the account specific AWS IoT data plane endpoint
+	// (e.g. https://<prefix>-ats.iot.<region>.amazonaws.com) required for
+	// updating the device shadow.
+	DataEndpoint *string
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetClient(client *http.Client) *Options {
+	opts.Client = client
+	return opts
+}
+
+func (opts *Options) SetEndpoint(endpoint string) *Options {
+	opts.Endpoint = &endpoint
+	return opts
+}
+
+func (opts *Options) SetDataEndpoint(endpoint string) *Options {
+	opts.DataEndpoint = &endpoint
+	return opts
+}
+
+// Client implements iotcore.Client for AWS IoT Core.
+type Client struct {
+	region       string
+	creds        Credentials
+	client       *http.Client
+	endpoint     string
+	dataEndpoint string
+	now          func() time.Time
+}
+
+var _ iotcore.Client = &Client{}
+
+// NewClient creates a new AWS IoT client for the region.
+func NewClient(region string, creds Credentials, opts ...*Options) (*Client, error) {
+	if region == "" {
+		return nil, ErrRegionRequired
+	} else if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, ErrCredentialsRequired
+	}
+	opt := NewOptions().
+		SetClient(http.DefaultClient).
+		SetEndpoint("https://iot." + region + ".amazonaws.com")
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Client != nil {
+			opt.Client = o.Client
+		}
+		if o.Endpoint != nil {
+			opt.Endpoint = o.Endpoint
+		}
+		if o.DataEndpoint != nil {
+			opt.DataEndpoint = o.DataEndpoint
+		}
+	}
+	c := &Client{
+		region:   region,
+		creds:    creds,
+		client:   opt.Client,
+		endpoint: strings.TrimSuffix(*opt.Endpoint, "/"),
+		now:      time.Now,
+	}
+	if opt.DataEndpoint != nil {
+		c.dataEndpoint = strings.TrimSuffix(*opt.DataEndpoint, "/")
+	}
+	return c, nil
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method, endpoint, path, service string,
+	body interface{},
+) (*http.Response, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "aws: failed to encode request")
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method,
+		endpoint+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "aws: failed to prepare request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	signRequest(req, b, c.creds, c.region, service, c.now())
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "aws: failed to execute request")
+	}
+	return rsp, nil
+}
+
+func newAPIError(rsp *http.Response) *iotcore.APIError {
+	apiErr := &iotcore.APIError{StatusCode: rsp.StatusCode}
+	// The error type header is formatted as "<code>:<documentation URL>"
+	code := rsp.Header.Get("X-Amzn-Errortype")
+	if idx := strings.IndexByte(code, ':'); idx >= 0 {
+		code = code[:idx]
+	}
+	apiErr.Code = code
+	var errBody struct {
+		Message string `json:"message"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(rsp.Body, 64*1024))
+	if json.Unmarshal(b, &errBody) == nil {
+		apiErr.Message = errBody.Message
+	}
+	return apiErr
+}
+
+func thingPath(deviceID string) string {
+	return "/things/" + url.PathEscape(deviceID)
+}
+
+// UpsertDevice creates the thing if it does not exist.
+func (c *Client) UpsertDevice(ctx context.Context, deviceID string) error {
+	rsp, err := c.do(ctx, http.MethodPost, c.endpoint,
+		thingPath(deviceID), signingNameIoT, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusOK {
+		return nil
+	}
+	apiErr := newAPIError(rsp)
+	if apiErr.StatusCode == http.StatusConflict &&
+		apiErr.Code == "ResourceAlreadyExistsException" {
+		return nil
+	}
+	return apiErr
+}
+
+// SetTags merges the tags into the thing attributes.
+func (c *Client) SetTags(
+	ctx context.Context,
+	deviceID string,
+	tags map[string]string,
+) error {
+	rsp, err := c.do(ctx, http.MethodPatch, c.endpoint,
+		thingPath(deviceID), signingNameIoT, map[string]interface{}{
+			"attributePayload": map[string]interface{}{
+				"attributes": tags,
+				"merge":      true,
+			},
+		})
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return iotcore.ErrDeviceNotFound
+	}
+	return newAPIError(rsp)
+}
+
+// SetDesiredState updates the desired state of the classic thing shadow.
+func (c *Client) SetDesiredState(
+	ctx context.Context,
+	deviceID string,
+	state map[string]interface{},
+) error {
+	if c.dataEndpoint == "" {
+		return ErrDataEndpointRequired
+	}
+	rsp, err := c.do(ctx, http.MethodPost, c.dataEndpoint,
+		thingPath(deviceID)+"/shadow", signingNameIoTData,
+		map[string]interface{}{
+			"state": map[string]interface{}{
+				"desired": state,
+			},
+		})
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return iotcore.ErrDeviceNotFound
+	}
+	return newAPIError(rsp)
+}
+
+// DeleteDevice deletes the thing.
+func (c *Client) DeleteDevice(ctx context.Context, deviceID string) error {
+	rsp, err := c.do(ctx, http.MethodDelete, c.endpoint,
+		thingPath(deviceID), signingNameIoT, nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return iotcore.ErrDeviceNotFound
+	}
+	return newAPIError(rsp)
+}
@@ -0,0 +1,248 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/iotcore"
+)
+
+var testCreds = Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func TestSignRequest(t *testing.T) {
+	t.Parallel()
+	// Example from the AWS signature version 4 documentation.
+	req, _ := http.NewRequest(http.MethodGet,
+		"https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8")
+	signRequest(req, nil, testCreds, "us-east-1", "iam",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get(headerAmzDate))
+	assert.Equal(t, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
+
+type request struct {
+	Method  string
+	Path    string
+	Service string
+	Body    map[string]interface{}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	testCases := []struct {
+		Name string
+
+		Call       func(*Client) error
+		StatusCode int
+		ErrorType  string
+		RspBody    string
+
+		Request request
+		Error   error
+	}{{
+		Name: "upsert device",
+		Call: func(c *Client) error {
+			return c.UpsertDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusOK,
+		Request: request{
+			Method:  http.MethodPost,
+			Path:    "/things/dev1",
+			Service: signingNameIoT,
+			Body:    map[string]interface{}{},
+		},
+	}, {
+		Name: "upsert device, already exists",
+		Call: func(c *Client) error {
+			return c.UpsertDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusConflict,
+		ErrorType:  "ResourceAlreadyExistsException:http://internal.amazon.com/",
+		Request: request{
+			Method:  http.MethodPost,
+			Path:    "/things/dev1",
+			Service: signingNameIoT,
+			Body:    map[string]interface{}{},
+		},
+	}, {
+		Name: "set tags",
+		Call: func(c *Client) error {
+			return c.SetTags(context.Background(), "dev1",
+				map[string]string{"group": "prod"})
+		},
+		StatusCode: http.StatusOK,
+		Request: request{
+			Method:  http.MethodPatch,
+			Path:    "/things/dev1",
+			Service: signingNameIoT,
+			Body: map[string]interface{}{
+				"attributePayload": map[string]interface{}{
+					"attributes": map[string]interface{}{"group": "prod"},
+					"merge":      true,
+				},
+			},
+		},
+	}, {
+		Name: "set desired state",
+		Call: func(c *Client) error {
+			return c.SetDesiredState(context.Background(), "dev1",
+				map[string]interface{}{"foo": "bar"})
+		},
+		StatusCode: http.StatusOK,
+		Request: request{
+			Method:  http.MethodPost,
+			Path:    "/things/dev1/shadow",
+			Service: signingNameIoTData,
+			Body: map[string]interface{}{
+				"state": map[string]interface{}{
+					"desired": map[string]interface{}{"foo": "bar"},
+				},
+			},
+		},
+	}, {
+		Name: "delete device, not found",
+		Call: func(c *Client) error {
+			return c.DeleteDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusNotFound,
+		Request: request{
+			Method:  http.MethodDelete,
+			Path:    "/things/dev1",
+			Service: signingNameIoT,
+		},
+		Error: iotcore.ErrDeviceNotFound,
+	}, {
+		Name: "delete device, throttled",
+		Call: func(c *Client) error {
+			return c.DeleteDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusTooManyRequests,
+		ErrorType:  "ThrottlingException",
+		RspBody:    `{"message":"Rate exceeded"}`,
+		Request: request{
+			Method:  http.MethodDelete,
+			Path:    "/things/dev1",
+			Service: signingNameIoT,
+		},
+		Error: &iotcore.APIError{
+			StatusCode: http.StatusTooManyRequests,
+			Code:       "ThrottlingException",
+			Message:    "Rate exceeded",
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					req := request{
+						Method:  r.Method,
+						Path:    r.URL.EscapedPath(),
+						Service: signingNameIoT,
+					}
+					if len(body) > 0 {
+						_ = json.Unmarshal(body, &req.Body)
+					}
+					if r.Header.Get("X-Test-Data") != "" {
+						req.Service = signingNameIoTData
+					}
+
+					// Verify the signature by signing the received request
+					expected, _ := http.NewRequest(r.Method,
+						"http://"+r.Host+r.URL.RequestURI(), nil)
+					expected.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+					if expected.Header.Get("Content-Type") == "" {
+						expected.Header.Del("Content-Type")
+					}
+					signRequest(expected, body, testCreds, "eu-west-1",
+						req.Service, now)
+					assert.Equal(t,
+						expected.Header.Get("Authorization"),
+						r.Header.Get("Authorization"))
+
+					assert.Equal(t, tc.Request, req)
+					if tc.ErrorType != "" {
+						w.Header().Set("X-Amzn-Errortype", tc.ErrorType)
+					}
+					w.WriteHeader(tc.StatusCode)
+					_, _ = w.Write([]byte(tc.RspBody))
+				}))
+			defer srv.Close()
+
+			// Route the data plane requests through a proxy handler
+			// marking the requests.
+			dataSrv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					r.Header.Set("X-Test-Data", "true")
+					srv.Config.Handler.ServeHTTP(w, r)
+				}))
+			defer dataSrv.Close()
+
+			client, err := NewClient("eu-west-1", testCreds, NewOptions().
+				SetEndpoint(srv.URL).
+				SetDataEndpoint(dataSrv.URL))
+			if !assert.NoError(t, err) {
+				return
+			}
+			client.now = func() time.Time { return now }
+
+			err = tc.Call(client)
+			switch expected := tc.Error.(type) {
+			case nil:
+				assert.NoError(t, err)
+			case *iotcore.APIError:
+				assert.Equal(t, expected, err)
+			default:
+				assert.ErrorIs(t, err, expected)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+	_, err := NewClient("", testCreds)
+	assert.ErrorIs(t, err, ErrRegionRequired)
+	_, err = NewClient("eu-west-1", Credentials{})
+	assert.ErrorIs(t, err, ErrCredentialsRequired)
+
+	client, err := NewClient("eu-west-1", testCreds)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://iot.eu-west-1.amazonaws.com", client.endpoint)
+		err = client.SetDesiredState(context.Background(), "dev1", nil)
+		assert.ErrorIs(t, err, ErrDataEndpointRequired)
+	}
+}
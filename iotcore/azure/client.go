@@ -0,0 +1,316 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package azure implements iotcore.Client for Azure IoT Hub using the IoT
+// Hub service REST API.
+package azure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/iotcore"
+)
+
+const (
+	APIVersion = "2021-04-12"
+
+	DefaultTokenTTL = time.Hour
+)
+
+var (
+	ErrInvalidConnectionString = errors.New("azure: invalid connection string")
+)
+
+// ConnectionString holds the parsed IoT Hub (shared access policy)
+// connection string.
+type ConnectionString struct {
+	HostName            string
+	SharedAccessKeyName string
+	SharedAccessKey     []byte
+}
+
+// ParseConnectionString parses a connection string of the format
+// "HostName=<host>;SharedAccessKeyName=<policy>;SharedAccessKey=<key>".
+func ParseConnectionString(connStr string) (*ConnectionString, error) {
+	var (
+		cs  ConnectionString
+		err error
+	)
+	for _, attr := range strings.Split(connStr, ";") {
+		if attr == "" {
+			continue
+		}
+		idx := strings.IndexByte(attr, '=')
+		if idx < 0 {
+			return nil, errors.Wrapf(ErrInvalidConnectionString,
+				"malformed attribute %q", attr)
+		}
+		key, value := attr[:idx], attr[idx+1:]
+		switch key {
+		case "HostName":
+			cs.HostName = value
+		case "SharedAccessKeyName":
+			cs.SharedAccessKeyName = value
+		case "SharedAccessKey":
+			cs.SharedAccessKey, err = base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, errors.Wrap(ErrInvalidConnectionString,
+					"SharedAccessKey is not base64 encoded")
+			}
+		}
+	}
+	if cs.HostName == "" {
+		return nil, errors.Wrap(ErrInvalidConnectionString, "missing HostName")
+	} else if cs.SharedAccessKeyName == "" {
+		return nil, errors.Wrap(ErrInvalidConnectionString,
+			"missing SharedAccessKeyName")
+	} else if len(cs.SharedAccessKey) == 0 {
+		return nil, errors.Wrap(ErrInvalidConnectionString,
+			"missing SharedAccessKey")
+	}
+	return &cs, nil
+}
+
+// SharedAccessSignature generates a SAS token for the hub valid until
+// expiry.
+func (cs ConnectionString) SharedAccessSignature(expiry time.Time) string {
+	resource := url.QueryEscape(cs.HostName)
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, cs.SharedAccessKey)
+	mac.Write([]byte(resource + "\n" + se))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return "SharedAccessSignature sr=" + resource +
+		"&sig=" + url.QueryEscape(sig) +
+		"&se=" + se +
+		"&skn=" + url.QueryEscape(cs.SharedAccessKeyName)
+}
+
+type Options struct {
+	// Client is the HTTP client used for the API requests.
+	Client *http.Client
+	// TokenTTL is the validity of the generated SAS tokens
+	// (default: DefaultTokenTTL).
+	TokenTTL *time.Duration
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetClient(client *http.Client) *Options {
+	opts.Client = client
+	return opts
+}
+
+func (opts *Options) SetTokenTTL(ttl time.Duration) *Options {
+	opts.TokenTTL = &ttl
+	return opts
+}
+
+// Client implements iotcore.Client for Azure IoT Hub.
+type Client struct {
+	connStr  ConnectionString
+	baseURL  string
+	client   *http.Client
+	tokenTTL time.Duration
+}
+
+var _ iotcore.Client = &Client{}
+
+// NewClient creates a new IoT Hub client from the shared access policy
+// connection string.
+func NewClient(connStr string, opts ...*Options) (*Client, error) {
+	cs, err := ParseConnectionString(connStr)
+	if err != nil {
+		return nil, err
+	}
+	opt := NewOptions().
+		SetClient(http.DefaultClient).
+		SetTokenTTL(DefaultTokenTTL)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Client != nil {
+			opt.Client = o.Client
+		}
+		if o.TokenTTL != nil {
+			opt.TokenTTL = o.TokenTTL
+		}
+	}
+	return &Client{
+		connStr:  *cs,
+		baseURL:  "https://" + cs.HostName,
+		client:   opt.Client,
+		tokenTTL: *opt.TokenTTL,
+	}, nil
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method, path string,
+	body interface{},
+	ifMatch bool,
+) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "azure: failed to encode request")
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method,
+		c.baseURL+path+"?api-version="+APIVersion, bodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "azure: failed to prepare request")
+	}
+	req.Header.Set("Authorization",
+		c.connStr.SharedAccessSignature(time.Now().Add(c.tokenTTL)))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ifMatch {
+		req.Header.Set("If-Match", "*")
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "azure: failed to execute request")
+	}
+	return rsp, nil
+}
+
+func newAPIError(rsp *http.Response) error {
+	apiErr := &iotcore.APIError{StatusCode: rsp.StatusCode}
+	// The error message is formatted as "ErrorCode:<code>;<message>"
+	var errBody struct {
+		Message string `json:"Message"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(rsp.Body, 64*1024))
+	if json.Unmarshal(b, &errBody) == nil && errBody.Message != "" {
+		msg := errBody.Message
+		if strings.HasPrefix(msg, "ErrorCode:") {
+			msg = strings.TrimPrefix(msg, "ErrorCode:")
+			idx := strings.IndexByte(msg, ';')
+			if idx >= 0 {
+				apiErr.Code, msg = msg[:idx], msg[idx+1:]
+			} else {
+				apiErr.Code, msg = msg, ""
+			}
+		}
+		apiErr.Message = msg
+	}
+	return apiErr
+}
+
+func devicePath(deviceID string) string {
+	return "/devices/" + url.PathEscape(deviceID)
+}
+
+func twinPath(deviceID string) string {
+	return "/twins/" + url.PathEscape(deviceID)
+}
+
+// UpsertDevice creates the device identity with SAS authentication
+// (generated keys) if it does not exist.
+func (c *Client) UpsertDevice(ctx context.Context, deviceID string) error {
+	rsp, err := c.do(ctx, http.MethodPut, devicePath(deviceID), map[string]interface{}{
+		"deviceId": deviceID,
+		"authentication": map[string]string{
+			"type": "sas",
+		},
+	}, false)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusConflict:
+		// 409: the device already exists
+		return nil
+	}
+	return newAPIError(rsp)
+}
+
+func (c *Client) patchTwin(
+	ctx context.Context,
+	deviceID string,
+	patch map[string]interface{},
+) error {
+	rsp, err := c.do(ctx, http.MethodPatch, twinPath(deviceID), patch, true)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return iotcore.ErrDeviceNotFound
+	}
+	return newAPIError(rsp)
+}
+
+// SetTags updates the tags of the device twin.
+func (c *Client) SetTags(
+	ctx context.Context,
+	deviceID string,
+	tags map[string]string,
+) error {
+	return c.patchTwin(ctx, deviceID, map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// SetDesiredState updates the desired properties of the device twin.
+func (c *Client) SetDesiredState(
+	ctx context.Context,
+	deviceID string,
+	state map[string]interface{},
+) error {
+	return c.patchTwin(ctx, deviceID, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"desired": state,
+		},
+	})
+}
+
+// DeleteDevice deletes the device identity.
+func (c *Client) DeleteDevice(ctx context.Context, deviceID string) error {
+	rsp, err := c.do(ctx, http.MethodDelete, devicePath(deviceID), nil, true)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return iotcore.ErrDeviceNotFound
+	}
+	return newAPIError(rsp)
+}
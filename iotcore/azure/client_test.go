@@ -0,0 +1,209 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/iotcore"
+)
+
+const testConnStr = "HostName=mender.azure-devices.net;" +
+	"SharedAccessKeyName=iothubowner;" +
+	"SharedAccessKey=c2VjcmV0"
+
+func TestParseConnectionString(t *testing.T) {
+	t.Parallel()
+	cs, err := ParseConnectionString(testConnStr)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &ConnectionString{
+			HostName:            "mender.azure-devices.net",
+			SharedAccessKeyName: "iothubowner",
+			SharedAccessKey:     []byte("secret"),
+		}, cs)
+		sas := cs.SharedAccessSignature(time.Unix(1700000000, 0))
+		assert.True(t, strings.HasPrefix(sas,
+			"SharedAccessSignature sr=mender.azure-devices.net&sig="))
+		assert.True(t, strings.HasSuffix(sas, "&se=1700000000&skn=iothubowner"))
+	}
+
+	for _, connStr := range []string{
+		"",
+		"HostName=foo;SharedAccessKeyName=bar",
+		"HostName=foo;SharedAccessKeyName=bar;SharedAccessKey=%%%",
+		"HostName",
+	} {
+		_, err := ParseConnectionString(connStr)
+		assert.ErrorIs(t, err, ErrInvalidConnectionString, connStr)
+	}
+}
+
+type request struct {
+	Method  string
+	Path    string
+	IfMatch string
+	Body    map[string]interface{}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		Call       func(*Client) error
+		StatusCode int
+		RspBody    string
+
+		Request request
+		Error   error
+	}{{
+		Name: "upsert device",
+		Call: func(c *Client) error {
+			return c.UpsertDevice(context.Background(), "dev 1")
+		},
+		StatusCode: http.StatusOK,
+		Request: request{
+			Method: http.MethodPut,
+			Path:   "/devices/dev%201",
+			Body: map[string]interface{}{
+				"deviceId":       "dev 1",
+				"authentication": map[string]interface{}{"type": "sas"},
+			},
+		},
+	}, {
+		Name: "upsert device, already exists",
+		Call: func(c *Client) error {
+			return c.UpsertDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusConflict,
+		Request: request{
+			Method: http.MethodPut,
+			Path:   "/devices/dev1",
+			Body: map[string]interface{}{
+				"deviceId":       "dev1",
+				"authentication": map[string]interface{}{"type": "sas"},
+			},
+		},
+	}, {
+		Name: "set tags",
+		Call: func(c *Client) error {
+			return c.SetTags(context.Background(), "dev1",
+				map[string]string{"group": "prod"})
+		},
+		StatusCode: http.StatusOK,
+		Request: request{
+			Method:  http.MethodPatch,
+			Path:    "/twins/dev1",
+			IfMatch: "*",
+			Body: map[string]interface{}{
+				"tags": map[string]interface{}{"group": "prod"},
+			},
+		},
+	}, {
+		Name: "set desired state, not found",
+		Call: func(c *Client) error {
+			return c.SetDesiredState(context.Background(), "dev1",
+				map[string]interface{}{"foo": "bar"})
+		},
+		StatusCode: http.StatusNotFound,
+		Request: request{
+			Method:  http.MethodPatch,
+			Path:    "/twins/dev1",
+			IfMatch: "*",
+			Body: map[string]interface{}{
+				"properties": map[string]interface{}{
+					"desired": map[string]interface{}{"foo": "bar"},
+				},
+			},
+		},
+		Error: iotcore.ErrDeviceNotFound,
+	}, {
+		Name: "delete device",
+		Call: func(c *Client) error {
+			return c.DeleteDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusNoContent,
+		Request: request{
+			Method:  http.MethodDelete,
+			Path:    "/devices/dev1",
+			IfMatch: "*",
+		},
+	}, {
+		Name: "delete device, internal error",
+		Call: func(c *Client) error {
+			return c.DeleteDevice(context.Background(), "dev1")
+		},
+		StatusCode: http.StatusInternalServerError,
+		RspBody:    `{"Message":"ErrorCode:ServerError;something broke"}`,
+		Request: request{
+			Method:  http.MethodDelete,
+			Path:    "/devices/dev1",
+			IfMatch: "*",
+		},
+		Error: &iotcore.APIError{
+			StatusCode: http.StatusInternalServerError,
+			Code:       "ServerError",
+			Message:    "something broke",
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, APIVersion, r.URL.Query().Get("api-version"))
+					assert.True(t, strings.HasPrefix(
+						r.Header.Get("Authorization"),
+						"SharedAccessSignature sr=mender.azure-devices.net&"))
+					req := request{
+						Method:  r.Method,
+						Path:    r.URL.EscapedPath(),
+						IfMatch: r.Header.Get("If-Match"),
+					}
+					if r.ContentLength > 0 {
+						_ = json.NewDecoder(r.Body).Decode(&req.Body)
+					}
+					assert.Equal(t, tc.Request, req)
+					w.WriteHeader(tc.StatusCode)
+					_, _ = w.Write([]byte(tc.RspBody))
+				}))
+			defer srv.Close()
+			client, err := NewClient(testConnStr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			client.baseURL = srv.URL
+
+			err = tc.Call(client)
+			switch expected := tc.Error.(type) {
+			case nil:
+				assert.NoError(t, err)
+			case *iotcore.APIError:
+				assert.Equal(t, expected, err)
+			default:
+				assert.ErrorIs(t, err, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package iotcore abstracts the device operations on external IoT
+// platforms. The platform specific implementations are found in the aws
+// and azure sub-packages.
+package iotcore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("iotcore: device not found")
+)
+
+// Client manages the device representation on an external IoT platform.
+type Client interface {
+	// UpsertDevice creates the device if it does not exist.
+	UpsertDevice(ctx context.Context, deviceID string) error
+	// SetTags replaces the given tags (attributes) of the device. Tags
+	// not present in the map are left untouched.
+	SetTags(ctx context.Context, deviceID string, tags map[string]string) error
+	// SetDesiredState updates the desired state of the device twin
+	// (shadow).
+	SetDesiredState(
+		ctx context.Context,
+		deviceID string,
+		state map[string]interface{},
+	) error
+	// DeleteDevice removes the device. It returns ErrDeviceNotFound if
+	// the device does not exist.
+	DeleteDevice(ctx context.Context, deviceID string) error
+}
+
+// APIError is returned when the platform responds with an unexpected
+// status code.
+type APIError struct {
+	StatusCode int
+	// Code is the platform specific error code (if any).
+	Code    string
+	Message string
+}
+
+func (err *APIError) Error() string {
+	msg := fmt.Sprintf("iotcore: unexpected status code %d", err.StatusCode)
+	if err.Code != "" {
+		msg += ": " + err.Code
+	}
+	if err.Message != "" {
+		msg += ": " + err.Message
+	}
+	return msg
+}
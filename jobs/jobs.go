@@ -0,0 +1,542 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package jobs runs long-running tasks, such as exports and reports, in
+// the background while tracking their progress in MongoDB, such that HTTP
+// handlers can respond immediately and let the clients poll the status.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+	"github.com/mendersoftware/go-lib-micro/errreport"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/mendersoftware/go-lib-micro/workerpool"
+)
+
+const (
+	DefaultCollection       = "jobs"
+	DefaultProgressInterval = time.Second
+
+	// ParamJobID is the path parameter of the job ID used by
+	// StatusHandler.
+	ParamJobID = "id"
+
+	// finishTimeout bounds persisting the final state of a job, which
+	// must succeed even if the job context is canceled.
+	finishTimeout = 10 * time.Second
+)
+
+var (
+	ErrNotFound    = errors.New("jobs: job not found")
+	ErrUnknownKind = errors.New("jobs: unknown job kind")
+	ErrNoDelivery  = errors.New("jobs: no result delivery configured")
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Finished returns true if the job is done, successfully or not.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+type Progress struct {
+	// Done is the number of processed items.
+	Done int64 `json:"done" bson:"done"`
+	// Total is the number of items to process, if known.
+	Total int64 `json:"total,omitempty" bson:"total,omitempty"`
+}
+
+// Job is the persisted state of a job.
+type Job struct {
+	ID       string   `json:"id" bson:"_id"`
+	TenantID string   `json:"-" bson:"tenant_id,omitempty"`
+	Owner    string   `json:"-" bson:"owner,omitempty"`
+	Kind     string   `json:"kind" bson:"kind"`
+	Params   bson.Raw `json:"-" bson:"params,omitempty"`
+	Status   Status   `json:"status" bson:"status"`
+	Progress Progress `json:"progress" bson:"progress"`
+	Error    string   `json:"error,omitempty" bson:"error,omitempty"`
+	// ResultKey is the key of the delivered result, if any.
+	ResultKey string `json:"-" bson:"result_key,omitempty"`
+	// ResultURL is the download URL of the result, it is generated by
+	// the Delivery when the job is fetched and never persisted.
+	ResultURL  string     `json:"result_url,omitempty" bson:"-"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" bson:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// Delivery stores the results of the jobs and provides the download URLs.
+type Delivery interface {
+	// Deliver stores the result read from r under key.
+	Deliver(ctx context.Context, key string, r io.Reader) error
+	// URL returns the download URL of the result stored under key.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// ObjectStore is the subset of an object storage client needed to deliver
+// results.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, r io.Reader) error
+	// PresignGet returns a URL downloading the object which expires
+	// after the given duration.
+	PresignGet(ctx context.Context, key string, expire time.Duration) (string, error)
+}
+
+// ObjectStoreDelivery delivers results to an object store and provides
+// presigned URLs for downloading them.
+type ObjectStoreDelivery struct {
+	Store ObjectStore
+	// Prefix is prepended to the object keys.
+	Prefix string
+	// Expire is the lifetime of the download URLs.
+	Expire time.Duration
+}
+
+func NewObjectStoreDelivery(store ObjectStore, expire time.Duration) *ObjectStoreDelivery {
+	return &ObjectStoreDelivery{Store: store, Expire: expire}
+}
+
+func (d *ObjectStoreDelivery) Deliver(ctx context.Context, key string, r io.Reader) error {
+	return d.Store.PutObject(ctx, path.Join(d.Prefix, key), r)
+}
+
+func (d *ObjectStoreDelivery) URL(ctx context.Context, key string) (string, error) {
+	return d.Store.PresignGet(ctx, path.Join(d.Prefix, key), d.Expire)
+}
+
+// Func executes a job. The job is failed if Func returns an error or
+// panics, and succeeds otherwise.
+type Func func(ctx context.Context, task *Task) error
+
+type Options struct {
+	// Collection is the name of the collection storing the jobs
+	// (default: DefaultCollection).
+	Collection *string
+	// Delivery delivers the job results; without it jobs cannot produce
+	// results.
+	Delivery Delivery
+	// ProgressInterval limits how often progress updates are persisted
+	// (default: DefaultProgressInterval).
+	ProgressInterval *time.Duration
+	// Retention is the time finished jobs are kept; the TTL index is
+	// created by EnsureIndexes. Zero keeps the jobs forever (default).
+	Retention *time.Duration
+	// Pool configures the worker pool executing the jobs.
+	Pool *workerpool.Options
+	// OwnerScoped restricts users to the jobs they submitted; otherwise
+	// all users of a tenant can access its jobs (default: true).
+	OwnerScoped *bool
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetCollection(collection string) *Options {
+	opts.Collection = &collection
+	return opts
+}
+
+func (opts *Options) SetDelivery(delivery Delivery) *Options {
+	opts.Delivery = delivery
+	return opts
+}
+
+func (opts *Options) SetProgressInterval(interval time.Duration) *Options {
+	opts.ProgressInterval = &interval
+	return opts
+}
+
+func (opts *Options) SetRetention(retention time.Duration) *Options {
+	opts.Retention = &retention
+	return opts
+}
+
+func (opts *Options) SetPool(pool *workerpool.Options) *Options {
+	opts.Pool = pool
+	return opts
+}
+
+func (opts *Options) SetOwnerScoped(scoped bool) *Options {
+	opts.OwnerScoped = &scoped
+	return opts
+}
+
+// Manager submits jobs to a worker pool and tracks their state.
+type Manager struct {
+	collection       *mongo.Collection
+	delivery         Delivery
+	progressInterval time.Duration
+	retention        time.Duration
+	ownerScoped      bool
+	pool             *workerpool.Pool
+
+	mu    sync.RWMutex
+	funcs map[string]Func
+}
+
+func NewManager(db *mongo.Database, opts ...*Options) *Manager {
+	opt := NewOptions().
+		SetCollection(DefaultCollection).
+		SetProgressInterval(DefaultProgressInterval).
+		SetRetention(0).
+		SetOwnerScoped(true)
+	var poolOpts []*workerpool.Options
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Collection != nil {
+			opt.Collection = o.Collection
+		}
+		if o.Delivery != nil {
+			opt.Delivery = o.Delivery
+		}
+		if o.ProgressInterval != nil {
+			opt.ProgressInterval = o.ProgressInterval
+		}
+		if o.Retention != nil {
+			opt.Retention = o.Retention
+		}
+		if o.Pool != nil {
+			poolOpts = append(poolOpts, o.Pool)
+		}
+		if o.OwnerScoped != nil {
+			opt.OwnerScoped = o.OwnerScoped
+		}
+	}
+	return &Manager{
+		collection:       db.Collection(*opt.Collection),
+		delivery:         opt.Delivery,
+		progressInterval: *opt.ProgressInterval,
+		retention:        *opt.Retention,
+		ownerScoped:      *opt.OwnerScoped,
+		pool:             workerpool.New(poolOpts...),
+		funcs:            make(map[string]Func),
+	}
+}
+
+// Register registers the function executing jobs of the given kind.
+func (m *Manager) Register(kind string, fn Func) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funcs[kind] = fn
+}
+
+func (m *Manager) lookup(kind string) (Func, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	fn, ok := m.funcs[kind]
+	return fn, ok
+}
+
+// EnsureIndexes creates the index on the tenant and, if a retention is
+// configured, the TTL index expiring finished jobs.
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+	}}
+	if m.retention > 0 {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: mopts.Index().SetExpireAfterSeconds(0),
+		})
+	}
+	_, err := m.collection.Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return errors.Wrap(err, "jobs: failed to create indexes")
+	}
+	return nil
+}
+
+// Submit persists a pending job of the given kind owned by the identity
+// of the context and queues it for execution. The params must marshal to
+// a BSON document and are available to the job with Task.DecodeParams.
+// The job is executed with the values of ctx (identity, logger, ...), but
+// is not canceled with it. If the queue is full, workerpool.ErrQueueFull
+// is returned and the job is failed.
+func (m *Manager) Submit(ctx context.Context, kind string, params interface{}) (*Job, error) {
+	fn, ok := m.lookup(kind)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKind, "%q", kind)
+	}
+	now := clock.Now(ctx)
+	job := &Job{
+		ID:        uuid.NewString(),
+		Kind:      kind,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if id := identity.FromContext(ctx); id != nil {
+		job.TenantID = id.Tenant
+		job.Owner = id.Subject
+	}
+	if params != nil {
+		b, err := bson.Marshal(params)
+		if err != nil {
+			return nil, errors.Wrap(err, "jobs: failed to marshal job parameters")
+		}
+		job.Params = b
+	}
+	if _, err := m.collection.InsertOne(ctx, job); err != nil {
+		return nil, errors.Wrap(err, "jobs: failed to insert job")
+	}
+	queued := *job
+	err := m.pool.TrySubmit(ctx, func(ctx context.Context) error {
+		m.run(ctx, fn, &queued)
+		return nil
+	})
+	if err != nil {
+		m.finish(ctx, job, err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// Get returns the job with the given ID of the tenant of the context.
+// Unless owner scoping is disabled, users only get the jobs they
+// submitted and ErrNotFound for the jobs of other users.
+func (m *Manager) Get(ctx context.Context, id string) (*Job, error) {
+	filter := bson.D{{Key: "_id", Value: id}}
+	ident := identity.FromContext(ctx)
+	if ident != nil && ident.Tenant != "" {
+		filter = append(filter, bson.E{Key: "tenant_id", Value: ident.Tenant})
+	} else {
+		filter = append(filter, bson.E{
+			Key: "tenant_id", Value: bson.D{{Key: "$exists", Value: false}},
+		})
+	}
+	if m.ownerScoped && ident != nil && ident.IsUser {
+		filter = append(filter, bson.E{Key: "owner", Value: ident.Subject})
+	}
+	job := new(Job)
+	err := m.collection.FindOne(ctx, filter).Decode(job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "jobs: failed to get job")
+	}
+	if job.Status == StatusSucceeded && job.ResultKey != "" && m.delivery != nil {
+		job.ResultURL, err = m.delivery.URL(ctx, job.ResultKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "jobs: failed to get result URL")
+		}
+	}
+	return job, nil
+}
+
+// StatusHandler is a gin handler responding with the job identified by
+// the ParamJobID path parameter. The response includes the download URL of
+// the result once the job succeeded.
+func (m *Manager) StatusHandler(c *gin.Context) {
+	job, err := m.Get(c.Request.Context(), c.Param(ParamJobID))
+	if errors.Is(err, ErrNotFound) {
+		rest.RenderError(c, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		rest.RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Shutdown stops accepting jobs and waits for the running jobs to finish.
+// If ctx is done first, the context of the remaining jobs is canceled.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	return m.pool.Shutdown(ctx)
+}
+
+func (m *Manager) update(ctx context.Context, id string, set bson.D) error {
+	set = append(set, bson.E{Key: "updated_at", Value: clock.Now(ctx)})
+	_, err := m.collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: "$set", Value: set}},
+	)
+	return err
+}
+
+func (m *Manager) run(ctx context.Context, fn Func, job *Job) {
+	l := log.FromContext(ctx).F(log.Ctx{"job_id": job.ID, "job_kind": job.Kind})
+	ctx = log.WithContext(ctx, l)
+	err := m.update(ctx, job.ID, bson.D{{Key: "status", Value: StatusRunning}})
+	if err != nil {
+		l.Errorf("jobs: failed to start job: %s", err)
+		m.finish(ctx, job, err)
+		return
+	}
+	job.Status = StatusRunning
+	task := &Task{ctx: ctx, manager: m, job: job}
+	defer func() {
+		if r := recover(); r != nil {
+			stack := string(debug.Stack())
+			l.WithField("trace", stack).Errorf("jobs: job panicked: %v", r)
+			errreport.CapturePanic(ctx, r, stack)
+			task.closeResult(fmt.Errorf("jobs: job panicked: %v", r))
+			m.finish(ctx, job, fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+	err = fn(ctx, task)
+	if resultErr := task.closeResult(err); err == nil && resultErr != nil {
+		err = errors.Wrap(resultErr, "failed to deliver the result")
+	}
+	if err != nil {
+		l.Errorf("jobs: job failed: %s", err)
+	}
+	m.finish(ctx, job, err)
+}
+
+func (m *Manager) finish(ctx context.Context, job *Job, jobErr error) {
+	// Persist the final state even if the job context is canceled.
+	finishCtx, cancel := context.WithTimeout(
+		clock.WithContext(context.Background(), clock.FromContext(ctx)),
+		finishTimeout,
+	)
+	defer cancel()
+	now := clock.Now(finishCtx)
+	set := bson.D{{Key: "finished_at", Value: now}}
+	if jobErr != nil {
+		set = append(set,
+			bson.E{Key: "status", Value: StatusFailed},
+			bson.E{Key: "error", Value: jobErr.Error()})
+	} else {
+		set = append(set,
+			bson.E{Key: "status", Value: StatusSucceeded},
+			bson.E{Key: "progress", Value: job.Progress})
+		if job.ResultKey != "" {
+			set = append(set, bson.E{Key: "result_key", Value: job.ResultKey})
+		}
+	}
+	if m.retention > 0 {
+		set = append(set, bson.E{Key: "expires_at", Value: now.Add(m.retention)})
+	}
+	if err := m.update(finishCtx, job.ID, set); err != nil {
+		log.FromContext(ctx).Errorf("jobs: failed to persist job state: %s", err)
+	}
+}
+
+// Task is the handle of a running job.
+type Task struct {
+	ctx     context.Context
+	manager *Manager
+	job     *Job
+
+	lastProgress time.Time
+
+	result     *io.PipeWriter
+	resultDone chan error
+}
+
+// Job returns a copy of the job state.
+func (t *Task) Job() Job {
+	return *t.job
+}
+
+// DecodeParams decodes the job parameters into v.
+func (t *Task) DecodeParams(v interface{}) error {
+	if t.job.Params == nil {
+		return nil
+	}
+	return bson.Unmarshal(t.job.Params, v)
+}
+
+// SetProgress updates the progress of the job. Updates are persisted at
+// most every ProgressInterval, except when the job is complete
+// (done == total).
+func (t *Task) SetProgress(ctx context.Context, done, total int64) error {
+	t.job.Progress = Progress{Done: done, Total: total}
+	now := clock.Now(ctx)
+	if now.Sub(t.lastProgress) < t.manager.progressInterval && done != total {
+		return nil
+	}
+	t.lastProgress = now
+	err := t.manager.update(ctx, t.job.ID,
+		bson.D{{Key: "progress", Value: t.job.Progress}})
+	if err != nil {
+		return errors.Wrap(err, "jobs: failed to update progress")
+	}
+	return nil
+}
+
+// Result returns the writer of the job result, which is streamed to the
+// Delivery as it is written. Writes fail with ErrNoDelivery if the
+// Manager has no Delivery.
+func (t *Task) Result() io.Writer {
+	return resultWriter{t}
+}
+
+type resultWriter struct {
+	t *Task
+}
+
+func (w resultWriter) Write(p []byte) (int, error) {
+	t := w.t
+	if t.result == nil {
+		delivery := t.manager.delivery
+		if delivery == nil {
+			return 0, ErrNoDelivery
+		}
+		key := path.Join(t.job.TenantID, t.job.Kind, t.job.ID)
+		r, pw := io.Pipe()
+		t.result, t.resultDone = pw, make(chan error, 1)
+		go func() {
+			err := delivery.Deliver(t.ctx, key, r)
+			_ = r.CloseWithError(err)
+			t.resultDone <- err
+		}()
+		t.job.ResultKey = key
+	}
+	return t.result.Write(p)
+}
+
+// closeResult completes the result with the error of the job and waits
+// for the delivery.
+func (t *Task) closeResult(err error) error {
+	if t.result == nil {
+		return nil
+	}
+	_ = t.result.CloseWithError(err)
+	t.result = nil
+	if err = <-t.resultDone; err != nil {
+		t.job.ResultKey = ""
+	}
+	return err
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memoryStore) PutObject(ctx context.Context, key string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[key] = b
+	return nil
+}
+
+func (s *memoryStore) PresignGet(
+	ctx context.Context,
+	key string,
+	expire time.Duration,
+) (string, error) {
+	return "https://storage.example.com/" + key + "?expire=" + expire.String(), nil
+}
+
+func (s *memoryStore) get(key string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[key]
+}
+
+func TestObjectStoreDelivery(t *testing.T) {
+	t.Parallel()
+	store := &memoryStore{}
+	d := NewObjectStoreDelivery(store, time.Hour)
+	d.Prefix = "exports"
+	err := d.Deliver(context.Background(), "tenant/devices/1", bytes.NewReader([]byte("a,b\n")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a,b\n"), store.get("exports/tenant/devices/1"))
+	url, err := d.URL(context.Background(), "tenant/devices/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://storage.example.com/exports/tenant/devices/1?expire=1h0m0s", url)
+}
+
+func TestSubmitUnknownKind(t *testing.T) {
+	t.Parallel()
+	client, err := mongo.Connect(context.Background(),
+		mopts.Client().ApplyURI("mongodb://localhost"))
+	require.NoError(t, err)
+	m := NewManager(client.Database("test"))
+	defer m.Shutdown(context.Background())
+	_, err = m.Submit(context.Background(), "export", nil)
+	assert.ErrorIs(t, err, ErrUnknownKind)
+	assert.False(t, StatusRunning.Finished())
+	assert.True(t, StatusFailed.Finished())
+}
+
+func waitFinished(t *testing.T, m *Manager, ctx context.Context, id string) *Job {
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = m.Get(ctx, id)
+		require.NoError(t, err)
+		return job.Status.Finished()
+	}, 10*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestManager(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "jobs")
+		store := &memoryStore{}
+		m := NewManager(db.Database, NewOptions().
+			SetDelivery(NewObjectStoreDelivery(store, time.Hour)).
+			SetRetention(time.Hour))
+		defer m.Shutdown(context.Background())
+		require.NoError(t, m.EnsureIndexes(db.Context("")))
+
+		type params struct {
+			Rows int `bson:"rows"`
+		}
+		m.Register("export", func(ctx context.Context, task *Task) error {
+			var p params
+			if err := task.DecodeParams(&p); err != nil {
+				return err
+			}
+			for i := 0; i < p.Rows; i++ {
+				if _, err := task.Result().Write([]byte("row\n")); err != nil {
+					return err
+				}
+				if err := task.SetProgress(ctx, int64(i+1), int64(p.Rows)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		m.Register("fail", func(ctx context.Context, task *Task) error {
+			_, _ = task.Result().Write([]byte("partial"))
+			return errors.New("out of cheese")
+		})
+		m.Register("panic", func(ctx context.Context, task *Task) error {
+			panic("boom")
+		})
+
+		ctx := db.Context("tenant1")
+		job, err := m.Submit(ctx, "export", params{Rows: 3})
+		require.NoError(t, err)
+		assert.Equal(t, StatusPending, job.Status)
+
+		job = waitFinished(t, m, ctx, job.ID)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.Equal(t, Progress{Done: 3, Total: 3}, job.Progress)
+		assert.NotNil(t, job.FinishedAt)
+		assert.Equal(t, []byte("row\nrow\nrow\n"), store.get(job.ResultKey))
+		assert.Contains(t, job.ResultURL, "tenant1/export/"+job.ID)
+
+		// Other tenants cannot see the job.
+		_, err = m.Get(db.Context("tenant2"), job.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Users only see their own jobs unless owner scoping is disabled.
+		userCtx := func(subject string) context.Context {
+			return identity.WithContext(ctx, &identity.Identity{
+				Subject: subject, Tenant: "tenant1", IsUser: true,
+			})
+		}
+		userJob, err := m.Submit(userCtx("alice"), "export", params{Rows: 1})
+		require.NoError(t, err)
+		waitFinished(t, m, userCtx("alice"), userJob.ID)
+		_, err = m.Get(userCtx("bob"), userJob.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		shared := NewManager(db.Database, NewOptions().SetOwnerScoped(false))
+		defer shared.Shutdown(context.Background())
+		_, err = shared.Get(userCtx("bob"), userJob.ID)
+		assert.NoError(t, err)
+
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Request = c.Request.WithContext(ctx)
+		})
+		router.GET("/jobs/:id", m.StatusHandler)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/jobs/"+job.ID, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var rsp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		assert.Equal(t, "succeeded", rsp["status"])
+		assert.Equal(t, job.ResultURL, rsp["result_url"])
+		assert.NotContains(t, rsp, "tenant_id")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, "http://localhost/jobs/missing", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		for kind, msg := range map[string]string{
+			"fail":  "out of cheese",
+			"panic": "job panicked: boom",
+		} {
+			job, err = m.Submit(ctx, kind, nil)
+			require.NoError(t, err)
+			job = waitFinished(t, m, ctx, job.ID)
+			assert.Equal(t, StatusFailed, job.Status, kind)
+			assert.Equal(t, msg, job.Error)
+			assert.Empty(t, job.ResultURL)
+		}
+		return 0
+	}, nil)
+}
@@ -14,6 +14,7 @@
 package keys
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
@@ -25,6 +26,8 @@ import (
 const (
 	ErrMsgPrivKeyReadFailed    = "failed to read server private key file"
 	ErrMsgPrivKeyNotPEMEncoded = "server private key not PEM-encoded"
+	ErrMsgPubKeyReadFailed     = "failed to read public key file"
+	ErrMsgPubKeyNotPEMEncoded  = "public key not PEM-encoded"
 )
 
 func LoadRSAPrivate(privKeyPath string) (*rsa.PrivateKey, error) {
@@ -46,3 +49,31 @@ func LoadRSAPrivate(privKeyPath string) (*rsa.PrivateKey, error) {
 	// return parsed key
 	return x509.ParsePKCS1PrivateKey(block.Bytes)
 }
+
+// LoadPublic loads a PEM encoded PKIX ("PUBLIC KEY") or PKCS #1 ("RSA
+// PUBLIC KEY") public key. The result is one of *rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey.
+func LoadPublic(pubKeyPath string) (crypto.PublicKey, error) {
+	pemData, err := ioutil.ReadFile(pubKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgPubKeyReadFailed)
+	}
+	return ParsePublic(pemData)
+}
+
+// ParsePublic parses a PEM encoded public key, see LoadPublic.
+func ParsePublic(pemData []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New(ErrMsgPubKeyNotPEMEncoded)
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, errors.Errorf(
+			"unknown public key type; got: %s, want: PUBLIC KEY", block.Type)
+	}
+}
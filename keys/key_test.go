@@ -59,3 +59,22 @@ func TestLoadRsaPrivateKey(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadPublicKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := LoadPublic("testdata/public.pem")
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+
+	_, err = LoadPublic("wrong_path")
+	assert.EqualError(t, err,
+		ErrMsgPubKeyReadFailed+": open wrong_path: no such file or directory")
+
+	_, err = LoadPublic("testdata/private_broken.pem")
+	assert.EqualError(t, err, ErrMsgPubKeyNotPEMEncoded)
+
+	_, err = LoadPublic("testdata/private.pem")
+	assert.EqualError(t, err,
+		"unknown public key type; got: RSA PRIVATE KEY, want: PUBLIC KEY")
+}
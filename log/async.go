@@ -0,0 +1,231 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what an AsyncWriter does when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the logging goroutine until the buffer has
+	// room for the entry.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop discards the entry and increments the drop counter.
+	OverflowDrop
+)
+
+const DefaultAsyncBufferSize = 1024
+
+type AsyncOptions struct {
+	// BufferSize is the number of entries which can be queued, the
+	// default is DefaultAsyncBufferSize.
+	BufferSize *int
+	// Overflow is the policy when the buffer is full, the default is
+	// OverflowBlock.
+	Overflow *OverflowPolicy
+}
+
+func NewAsyncOptions() *AsyncOptions {
+	return new(AsyncOptions)
+}
+
+func (opts *AsyncOptions) SetBufferSize(size int) *AsyncOptions {
+	opts.BufferSize = &size
+	return opts
+}
+
+func (opts *AsyncOptions) SetOverflow(policy OverflowPolicy) *AsyncOptions {
+	opts.Overflow = &policy
+	return opts
+}
+
+type asyncEntry struct {
+	data []byte
+	// flushed is closed when all entries queued before this one are
+	// written; set for flush markers only.
+	flushed chan struct{}
+}
+
+// AsyncWriter queues the written entries and writes them to the
+// underlying writer from a background goroutine such that slow sinks do not
+// delay the logging goroutines.
+type AsyncWriter struct {
+	w        io.Writer
+	overflow OverflowPolicy
+	queue    chan asyncEntry
+	done     chan struct{}
+	dropped  uint64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter starts an AsyncWriter writing to w.
+func NewAsyncWriter(w io.Writer, opts ...*AsyncOptions) *AsyncWriter {
+	size := DefaultAsyncBufferSize
+	overflow := OverflowBlock
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.BufferSize != nil && *opt.BufferSize > 0 {
+			size = *opt.BufferSize
+		}
+		if opt.Overflow != nil {
+			overflow = *opt.Overflow
+		}
+	}
+	aw := &AsyncWriter{
+		w:        w,
+		overflow: overflow,
+		queue:    make(chan asyncEntry, size),
+		done:     make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+	for entry := range aw.queue {
+		if entry.flushed != nil {
+			close(entry.flushed)
+			continue
+		}
+		_, _ = aw.w.Write(entry.data)
+	}
+}
+
+// Write queues a copy of p. After the writer is closed, the entries are
+// written synchronously.
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	aw.mu.RLock()
+	defer aw.mu.RUnlock()
+	if aw.closed {
+		return aw.w.Write(p)
+	}
+	entry := asyncEntry{data: append([]byte(nil), p...)}
+	if aw.overflow == OverflowDrop {
+		select {
+		case aw.queue <- entry:
+		default:
+			atomic.AddUint64(&aw.dropped, 1)
+		}
+	} else {
+		aw.queue <- entry
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of entries discarded because the buffer was
+// full.
+func (aw *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&aw.dropped)
+}
+
+// Flush waits until the entries queued so far are written or the context
+// is done.
+func (aw *AsyncWriter) Flush(ctx context.Context) error {
+	aw.mu.RLock()
+	if aw.closed {
+		aw.mu.RUnlock()
+		return nil
+	}
+	flushed := make(chan struct{})
+	select {
+	case aw.queue <- asyncEntry{flushed: flushed}:
+		aw.mu.RUnlock()
+	case <-ctx.Done():
+		aw.mu.RUnlock()
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the queued entries and stops the background goroutine.
+// Subsequent writes are written synchronously.
+func (aw *AsyncWriter) Close(ctx context.Context) error {
+	if err := aw.Flush(ctx); err != nil {
+		return err
+	}
+	aw.mu.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.queue)
+	}
+	aw.mu.Unlock()
+	select {
+	case <-aw.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var asyncOutput struct {
+	sync.Mutex
+	w *AsyncWriter
+}
+
+// setAsyncOutput wraps the output of the global logger in an AsyncWriter
+// if opts is not nil, closing the writer of the previous configuration.
+func setAsyncOutput(opts *AsyncOptions) {
+	asyncOutput.Lock()
+	defer asyncOutput.Unlock()
+	if asyncOutput.w != nil {
+		_ = asyncOutput.w.Close(context.Background())
+		asyncOutput.w = nil
+	}
+	if opts != nil {
+		asyncOutput.w = NewAsyncWriter(Log.Out, opts)
+		Log.SetOutput(asyncOutput.w)
+	}
+}
+
+// Flush flushes the asynchronous output of the global logger configured
+// with Options.Async; it is a no-op otherwise. Call Flush before the
+// process exits so the queued entries are not lost.
+func Flush(ctx context.Context) error {
+	asyncOutput.Lock()
+	w := asyncOutput.w
+	asyncOutput.Unlock()
+	if w == nil {
+		return nil
+	}
+	return w.Flush(ctx)
+}
+
+// DroppedEntries returns the number of entries the global logger discarded
+// because the asynchronous output buffer was full.
+func DroppedEntries() uint64 {
+	asyncOutput.Lock()
+	w := asyncOutput.w
+	asyncOutput.Unlock()
+	if w == nil {
+		return 0
+	}
+	return w.Dropped()
+}
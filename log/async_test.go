@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// gate blocks the writes until it is closed, if not nil.
+	gate chan struct{}
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	if b.gate != nil {
+		<-b.gate
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriter(t *testing.T) {
+	t.Parallel()
+	out := &syncBuffer{}
+	w := log.NewAsyncWriter(out, nil, log.NewAsyncOptions().SetBufferSize(4))
+
+	var expected strings.Builder
+	p := make([]byte, 0, 16)
+	for i := 0; i < 100; i++ {
+		p = append(p[:0], fmt.Sprintf("line %d\n", i)...)
+		n, err := w.Write(p)
+		assert.NoError(t, err)
+		assert.Equal(t, len(p), n)
+		expected.Write(p)
+		// The writer must not retain the buffer.
+		p[0] = 'X'
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, w.Flush(ctx))
+	assert.Equal(t, expected.String(), out.String())
+	assert.Zero(t, w.Dropped())
+
+	assert.NoError(t, w.Close(ctx))
+	assert.NoError(t, w.Close(ctx))
+	_, _ = w.Write([]byte("after close\n"))
+	assert.True(t, strings.HasSuffix(out.String(), "after close\n"))
+}
+
+func TestAsyncWriterDrop(t *testing.T) {
+	t.Parallel()
+	out := &syncBuffer{gate: make(chan struct{})}
+	w := log.NewAsyncWriter(out, log.NewAsyncOptions().
+		SetBufferSize(2).
+		SetOverflow(log.OverflowDrop))
+
+	for i := 0; i < 10; i++ {
+		done := make(chan struct{})
+		go func() {
+			_, _ = w.Write([]byte("entry\n"))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("write blocked with OverflowDrop")
+		}
+	}
+	// One entry is held by the blocked writer, two are queued.
+	assert.GreaterOrEqual(t, w.Dropped(), uint64(7))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	assert.ErrorIs(t, w.Flush(ctx), context.DeadlineExceeded)
+	cancel()
+
+	close(out.gate)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, w.Close(ctx))
+	written := strings.Count(out.String(), "entry\n")
+	assert.Equal(t, uint64(10), uint64(written)+w.Dropped())
+}
+
+func TestConfigureAsync(t *testing.T) {
+	defer func(logger *logrus.Logger) { log.Log = logger }(log.Log)
+	out := &syncBuffer{}
+	log.Configure(log.Options{
+		Level:  log.LevelInfo,
+		Format: log.FormatJSON,
+		Output: out,
+		Async:  log.NewAsyncOptions(),
+	})
+	// Configure closes the async writer of the previous configuration.
+	defer log.Configure(log.Options{Output: out})
+
+	log.NewEmpty().Info("queued")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, log.Flush(ctx))
+	assert.Contains(t, out.String(), `"msg":"queued"`)
+	assert.Zero(t, log.DroppedEntries())
+}
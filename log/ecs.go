@@ -0,0 +1,189 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ECSVersion is the version of the Elastic Common Schema implemented by
+// ECSFormatter.
+const ECSVersion = "8.11.0"
+
+// ECSFieldMap maps the field names used by the library to Elastic Common
+// Schema field names.
+var ECSFieldMap = map[string]string{
+	"method":       "http.request.method",
+	"status":       "http.response.status_code",
+	"byteswritten": "http.response.body.bytes",
+	"request_id":   "http.request.id",
+	"path":         "url.path",
+	"qs":           "url.query",
+	"clientip":     "source.ip",
+	"useragent":    "user_agent.original",
+	"ts":           "event.start",
+	"responsetime": "event.duration",
+	"type":         "http.version",
+	"error":        "error.message",
+	"trace":        "error.stack_trace",
+	"stacktrace":   "error.stack_trace",
+	"user_id":      "user.id",
+	"device_id":    "device.id",
+	"tenant_id":    "organization.id",
+}
+
+// ECSFormatter formats the entries as JSON documents following the
+// Elastic Common Schema. Fields with an entry in FieldMap (or ECSFieldMap
+// if nil) are renamed and nested accordingly, the remaining fields are
+// kept at the top level.
+type ECSFormatter struct {
+	// TimestampFormat is the format of the "@timestamp" field, the
+	// default is time.RFC3339Nano.
+	TimestampFormat string
+	// FieldMap overrides ECSFieldMap.
+	FieldMap map[string]string
+}
+
+// ecsValue converts the values of the fields with special semantics; the
+// ECS event.duration is in nanoseconds and http.version does not include
+// the protocol name.
+func ecsValue(key string, value interface{}) interface{} {
+	switch key {
+	case "event.duration":
+		switch v := value.(type) {
+		case time.Duration:
+			return int64(v)
+		case string:
+			if d, err := time.ParseDuration(v); err == nil {
+				return int64(d)
+			}
+		}
+	case "http.version":
+		if v, ok := value.(string); ok {
+			return strings.TrimPrefix(v, "HTTP/")
+		}
+	}
+	return value
+}
+
+// setECSField sets the dotted key in the nested document. If the key
+// conflicts with an existing value, the value is stored with the "fields."
+// prefix instead (like logrus.JSONFormatter does).
+func setECSField(doc map[string]interface{}, key string, value interface{}) {
+	node := doc
+	path := strings.Split(key, ".")
+	for i, name := range path[:len(path)-1] {
+		switch child := node[name].(type) {
+		case map[string]interface{}:
+			node = child
+		case nil:
+			next := make(map[string]interface{})
+			node[name] = next
+			node = next
+		default:
+			doc["fields."+strings.Join(path[i:], ".")] = value
+			return
+		}
+	}
+	name := path[len(path)-1]
+	if _, exists := node[name]; exists {
+		doc["fields."+key] = value
+		return
+	}
+	node[name] = value
+}
+
+// setCallerFields splits the "caller" field (function@file:line) into the
+// ECS log.origin fields.
+func setCallerFields(doc map[string]interface{}, caller string) {
+	function, fileLine := caller, ""
+	if i := strings.LastIndexByte(caller, '@'); i >= 0 {
+		function, fileLine = caller[:i], caller[i+1:]
+	}
+	setECSField(doc, "log.origin.function", function)
+	if fileLine == "" {
+		return
+	}
+	file := fileLine
+	if i := strings.LastIndexByte(fileLine, ':'); i >= 0 {
+		if line, err := strconv.Atoi(fileLine[i+1:]); err == nil {
+			file = fileLine[:i]
+			setECSField(doc, "log.origin.file.line", line)
+		}
+	}
+	setECSField(doc, "log.origin.file.name", file)
+}
+
+func (f *ECSFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fieldMap := f.FieldMap
+	if fieldMap == nil {
+		fieldMap = ECSFieldMap
+	}
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339Nano
+	}
+	doc := make(map[string]interface{}, len(entry.Data)+4)
+	doc["@timestamp"] = entry.Time.Format(timestampFormat)
+	doc["message"] = entry.Message
+	doc["log"] = map[string]interface{}{"level": entry.Level.String()}
+	doc["ecs"] = map[string]interface{}{"version": ECSVersion}
+
+	// The mapped fields take precedence over conflicting unmapped fields.
+	var unmapped []string
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if key == logFieldCaller {
+			if caller, ok := value.(string); ok {
+				setCallerFields(doc, caller)
+				continue
+			}
+		}
+		if ecsKey, ok := fieldMap[key]; ok {
+			setECSField(doc, ecsKey, ecsValue(ecsKey, value))
+		} else {
+			unmapped = append(unmapped, key)
+		}
+	}
+	for _, key := range unmapped {
+		value := entry.Data[key]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		setECSField(doc, key, value)
+	}
+
+	var buf *bytes.Buffer
+	if entry.Buffer != nil {
+		buf = entry.Buffer
+	} else {
+		buf = &bytes.Buffer{}
+	}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, errors.Wrap(err, "log: failed to marshal fields to JSON")
+	}
+	return buf.Bytes(), nil
+}
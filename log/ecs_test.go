@@ -0,0 +1,84 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestECSFormatter(t *testing.T) {
+	t.Parallel()
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"method":       "GET",
+		"path":         "/api/devices",
+		"qs":           "page=2",
+		"status":       404,
+		"clientip":     "10.0.0.1",
+		"responsetime": "1.5ms",
+		"type":         "HTTP/1.1",
+		"request_id":   "1234",
+		"caller":       "main.handler@main.go:42",
+		"error":        errors.New("not found"),
+		"custom":       "value",
+		"url":          "clashes with url.path",
+	})
+	entry.Time = time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	entry.Level = logrus.WarnLevel
+	entry.Message = "request"
+
+	b, err := (&log.ECSFormatter{}).Format(entry)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"@timestamp": "2024-01-02T03:04:05.006Z",
+		"message": "request",
+		"ecs": {"version": "`+log.ECSVersion+`"},
+		"log": {
+			"level": "warning",
+			"origin": {
+				"function": "main.handler",
+				"file": {"name": "main.go", "line": 42}
+			}
+		},
+		"http": {
+			"version": "1.1",
+			"request": {"method": "GET", "id": "1234"},
+			"response": {"status_code": 404}
+		},
+		"url": {"path": "/api/devices", "query": "page=2"},
+		"source": {"ip": "10.0.0.1"},
+		"event": {"duration": 1500000},
+		"error": {"message": "not found"},
+		"custom": "value",
+		"fields.url": "clashes with url.path"
+	}`, string(b))
+
+	b, err = (&log.ECSFormatter{
+		FieldMap: map[string]string{"custom": "labels.custom"},
+	}).Format(entry)
+	require.NoError(t, err)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, map[string]interface{}{"custom": "value"}, doc["labels"])
+	assert.Equal(t, "/api/devices", doc["path"])
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EnvFields maps environment variables to the fields added to every entry
+// of the global logger (see Options.Fields).
+var EnvFields = map[string]string{
+	"HOSTNAME":      "hostname",
+	"POD_NAMESPACE": "namespace",
+	"SERVICE_NAME":  "service",
+}
+
+// FieldsFromEnv returns the fields of the EnvFields variables which are set.
+func FieldsFromEnv() Ctx {
+	fields := make(Ctx, len(EnvFields))
+	for env, key := range EnvFields {
+		if value := os.Getenv(env); value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// FieldsHook adds the fields to every entry, unless the entry already has
+// a field with the same key.
+type FieldsHook struct {
+	mu     sync.RWMutex
+	fields Ctx
+}
+
+func NewFieldsHook(fields Ctx) *FieldsHook {
+	hook := &FieldsHook{}
+	hook.Add(fields)
+	return hook
+}
+
+// Add adds fields to the hook.
+func (hook *FieldsHook) Add(fields Ctx) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	merged := make(Ctx, len(hook.fields)+len(fields))
+	for key, value := range hook.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	hook.fields = merged
+}
+
+func (hook *FieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *FieldsHook) Fire(entry *logrus.Entry) error {
+	hook.mu.RLock()
+	fields := hook.fields
+	hook.mu.RUnlock()
+	for key, value := range fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+// globalFields is the FieldsHook of the global logger.
+var globalFields *FieldsHook
+
+// SetupWithFields is Setup adding the fields to every entry of the global
+// logger, in addition to the fields of Options.Fields.
+func SetupWithFields(debug bool, fields Ctx) {
+	Setup(debug)
+	if globalFields == nil {
+		globalFields = NewFieldsHook(fields)
+		Log.AddHook(globalFields)
+	} else {
+		globalFields.Add(fields)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldsFromEnv(t *testing.T) {
+	t.Setenv("HOSTNAME", "deviceauth-5d8f7")
+	t.Setenv("POD_NAMESPACE", "mender")
+	t.Setenv("SERVICE_NAME", "")
+	assert.Equal(t, Ctx{
+		"hostname":  "deviceauth-5d8f7",
+		"namespace": "mender",
+	}, FieldsFromEnv())
+}
+
+func TestFieldsHook(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = buf
+	logger.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+	hook := NewFieldsHook(Ctx{"service": "deviceauth"})
+	logger.AddHook(hook)
+
+	NewFromLogger(logger, Ctx{}).Info("foo")
+	assert.Equal(t, "level=info msg=foo service=deviceauth\n", buf.String())
+
+	buf.Reset()
+	hook.Add(Ctx{"region": "eu"})
+	NewFromLogger(logger, Ctx{"service": "useradm"}).Info("foo")
+	assert.Equal(t, "level=info msg=foo region=eu service=useradm\n", buf.String())
+}
+
+func TestSetupWithFields(t *testing.T) {
+	defer Configure(Options{Level: LevelInfo})
+	buf := &bytes.Buffer{}
+	Configure(Options{
+		Level:         LevelInfo,
+		Output:        buf,
+		DisableCaller: true,
+		Fields:        Ctx{"hostname": "pod-0"},
+	})
+	Log.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+
+	SetupWithFields(true, Ctx{"service": "deviceauth"})
+	assert.Equal(t, logrus.DebugLevel, Log.Level)
+	NewEmpty().Debug("foo")
+	assert.Equal(t, "level=debug msg=foo hostname=pod-0 service=deviceauth\n", buf.String())
+
+	buf.Reset()
+	Configure(Options{Level: LevelInfo, Output: buf, DisableCaller: true})
+	Log.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+	SetupWithFields(false, Ctx{"service": "useradm"})
+	NewEmpty().Info("foo")
+	assert.Equal(t, "level=info msg=foo service=useradm\n", buf.String())
+}
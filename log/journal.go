@@ -0,0 +1,168 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultJournalSocket is the socket of the systemd journal for the
+// native protocol.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// JournalConfig configures the systemd journal sink.
+type JournalConfig struct {
+	// SocketPath is the path of the journal socket, the default is
+	// DefaultJournalSocket.
+	SocketPath string
+	// Identifier is the SYSLOG_IDENTIFIER of the entries, the default is
+	// the name of the executable.
+	Identifier string
+}
+
+// JournalHook sends the log entries to the systemd journal using the
+// native protocol. The message is sent as the MESSAGE field and the entry
+// fields are sent as journal fields with upper case names, e.g. the field
+// "request_id" becomes "REQUEST_ID".
+type JournalHook struct {
+	config JournalConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+func NewJournalHook(config JournalConfig) *JournalHook {
+	if config.SocketPath == "" {
+		config.SocketPath = DefaultJournalSocket
+	}
+	if config.Identifier == "" {
+		config.Identifier = filepath.Base(os.Args[0])
+	}
+	return &JournalHook{config: config}
+}
+
+func (hook *JournalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// journalFieldName converts the name to a valid journal field name which
+// consists of upper case letters, digits and underscores and does not
+// start with an underscore or a digit.
+func journalFieldName(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			b.WriteByte(c - 'a' + 'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	ret := strings.TrimLeft(b.String(), "_")
+	if ret == "" || (ret[0] >= '0' && ret[0] <= '9') {
+		ret = "F_" + ret
+	}
+	return ret
+}
+
+func (hook *JournalHook) writeField(name, value string) {
+	hook.buf.WriteString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		hook.buf.WriteByte('=')
+		hook.buf.WriteString(value)
+	} else {
+		// Values with newlines are prefixed by the little endian
+		// 64-bit length instead.
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+		hook.buf.WriteByte('\n')
+		hook.buf.Write(size[:])
+		hook.buf.WriteString(value)
+	}
+	hook.buf.WriteByte('\n')
+}
+
+func (hook *JournalHook) format(entry *logrus.Entry) []byte {
+	hook.buf.Reset()
+	hook.writeField("MESSAGE", entry.Message)
+	hook.writeField("PRIORITY", strconv.Itoa(severity(entry.Level)))
+	hook.writeField("SYSLOG_IDENTIFIER", hook.config.Identifier)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var value string
+		switch v := entry.Data[key].(type) {
+		case string:
+			value = v
+		case error:
+			value = v.Error()
+		default:
+			value = fmt.Sprint(v)
+		}
+		hook.writeField(journalFieldName(key), value)
+	}
+	return hook.buf.Bytes()
+}
+
+func (hook *JournalHook) Fire(entry *logrus.Entry) error {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if hook.conn == nil {
+		var err error
+		hook.conn, err = net.Dial(NetworkUnixgram, hook.config.SocketPath)
+		if err != nil {
+			return errors.Wrap(err, "log: failed to connect to the journal")
+		}
+	}
+	if _, err := hook.conn.Write(hook.format(entry)); err != nil {
+		_ = hook.conn.Close()
+		hook.conn = nil
+		return errors.Wrap(err, "log: failed to write to the journal")
+	}
+	return nil
+}
+
+// Close closes the connection to the journal.
+func (hook *JournalHook) Close() error {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if hook.conn == nil {
+		return nil
+	}
+	err := hook.conn.Close()
+	hook.conn = nil
+	return err
+}
@@ -53,9 +53,12 @@ const (
 	envLogFormat        = "LOG_FORMAT"
 	envLogLevel         = "LOG_LEVEL"
 	envLogDisableCaller = "LOG_DISABLE_CALLER_CONTEXT"
+	envLogStackTrace    = "LOG_STACK_TRACE"
+	envLogAsync         = "LOG_ASYNC"
 
 	logFormatJSON    = "json"
 	logFormatJSONAlt = "ndjson"
+	logFormatECS     = "ecs"
 
 	logFieldCaller    = "caller"
 	logFieldCallerFmt = "%s@%s:%d"
@@ -82,6 +85,8 @@ func init() {
 	switch strings.ToLower(os.Getenv(envLogFormat)) {
 	case logFormatJSON, logFormatJSONAlt:
 		opts.Format = FormatJSON
+	case logFormatECS:
+		opts.Format = FormatECS
 	default:
 		opts.Format = FormatConsole
 	}
@@ -94,6 +99,11 @@ func init() {
 	}
 	opts.TimestampFormat = time.RFC3339
 	opts.DisableCaller, _ = strconv.ParseBool(os.Getenv(envLogDisableCaller))
+	opts.StackTrace, _ = strconv.ParseBool(os.Getenv(envLogStackTrace))
+	if async, _ := strconv.ParseBool(os.Getenv(envLogAsync)); async {
+		opts.Async = NewAsyncOptions()
+	}
+	opts.Fields = FieldsFromEnv()
 	Configure(opts)
 
 	Log.ExitFunc = func(int) {}
@@ -116,6 +126,9 @@ type Format int
 const (
 	FormatConsole Format = iota
 	FormatJSON
+	// FormatECS formats the entries as JSON following the Elastic
+	// Common Schema (see ECSFormatter).
+	FormatECS
 )
 
 type Options struct {
@@ -125,9 +138,34 @@ type Options struct {
 
 	DisableCaller bool
 
+	// StackTrace adds the stack trace of the caller to entries of
+	// error level and above (see StackTraceHook).
+	StackTrace bool
+	// StackTraceDepth is the maximum number of frames in the stack
+	// trace, the default is DefaultStackTraceDepth.
+	StackTraceDepth int
+
 	Format Format
 
 	Output io.Writer
+
+	// Syslog sends the entries to a syslog server (see SyslogHook). If
+	// Syslog or Journal is set, the entries are only written to Output
+	// if it is set explicitly.
+	Syslog *SyslogConfig
+	// Journal sends the entries to the systemd journal (see
+	// JournalHook).
+	Journal *JournalConfig
+
+	// Async queues the entries and writes them to the output from a
+	// background goroutine (see AsyncWriter). Call Flush before exiting
+	// to write the queued entries.
+	Async *AsyncOptions
+
+	// Fields are added to every entry (see FieldsHook). The global
+	// logger is initialized with the fields from the environment (see
+	// FieldsFromEnv).
+	Fields Ctx
 }
 
 func Configure(opts Options) {
@@ -135,12 +173,29 @@ func Configure(opts Options) {
 
 	if opts.Output != nil {
 		Log.SetOutput(opts.Output)
+	} else if opts.Syslog != nil || opts.Journal != nil {
+		Log.SetOutput(io.Discard)
+	}
+	if opts.Syslog != nil {
+		Log.AddHook(NewSyslogHook(*opts.Syslog))
 	}
+	if opts.Journal != nil {
+		Log.AddHook(NewJournalHook(*opts.Journal))
+	}
+	setAsyncOutput(opts.Async)
 	Log.SetLevel(logrus.Level(opts.Level))
 
 	if !opts.DisableCaller {
 		Log.AddHook(ContextHook{})
 	}
+	if opts.StackTrace {
+		Log.AddHook(StackTraceHook{MaxDepth: opts.StackTraceDepth})
+	}
+	globalFields = nil
+	if len(opts.Fields) > 0 {
+		globalFields = NewFieldsHook(opts.Fields)
+		Log.AddHook(globalFields)
+	}
 
 	var formatter logrus.Formatter
 
@@ -154,6 +209,8 @@ func Configure(opts Options) {
 		formatter = &logrus.JSONFormatter{
 			TimestampFormat: opts.TimestampFormat,
 		}
+	case FormatECS:
+		formatter = &ECSFormatter{}
 	}
 	Log.Formatter = formatter
 }
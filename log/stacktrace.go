@@ -0,0 +1,112 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logFieldStackTrace = "stacktrace"
+
+	pkgLog = "github.com/mendersoftware/go-lib-micro/log."
+
+	// DefaultStackTraceDepth is the default number of frames of the
+	// stack traces added by StackTraceHook.
+	DefaultStackTraceDepth = 16
+	maxStackTraceDepth     = 64
+)
+
+var stackTracePool = sync.Pool{
+	New: func() interface{} {
+		pcs := make([]uintptr, maxStackTraceDepth)
+		return &pcs
+	},
+}
+
+// StackTraceHook adds a shortened stack trace (function@file:line per
+// frame) of the logging goroutine as the "stacktrace" field to entries of
+// error level and above.
+type StackTraceHook struct {
+	// MaxDepth limits the number of frames in the stack trace, the
+	// default is DefaultStackTraceDepth.
+	MaxDepth int
+}
+
+func (hook StackTraceHook) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.PanicLevel,
+		logrus.FatalLevel,
+		logrus.ErrorLevel,
+	}
+}
+
+func (hook StackTraceHook) Fire(entry *logrus.Entry) error {
+	if _, ok := entry.Data[logFieldStackTrace]; ok {
+		return nil
+	}
+	maxDepth := hook.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultStackTraceDepth
+	} else if maxDepth > maxStackTraceDepth {
+		maxDepth = maxStackTraceDepth
+	}
+	pcs := stackTracePool.Get().(*[]uintptr)
+	defer stackTracePool.Put(pcs)
+	// Skip runtime.Callers and StackTraceHook.Fire
+	n := runtime.Callers(2, *pcs)
+	frames := runtime.CallersFrames((*pcs)[:n])
+
+	var (
+		trace  strings.Builder
+		depth  int
+		inside = true
+	)
+	for frame, more := frames.Next(); depth < maxDepth; frame, more = frames.Next() {
+		if inside {
+			// Skip the frames of logrus and this package.
+			if strings.HasPrefix(frame.Function, pkgSirupsen) ||
+				strings.HasPrefix(frame.Function, pkgLog) {
+				if !more {
+					break
+				}
+				continue
+			}
+			inside = false
+		}
+		if depth > 0 {
+			trace.WriteByte('\n')
+		}
+		trace.WriteString(path.Base(frame.Function))
+		trace.WriteByte('@')
+		trace.WriteString(path.Base(frame.File))
+		trace.WriteByte(':')
+		trace.WriteString(strconv.Itoa(frame.Line))
+		depth++
+		if !more {
+			break
+		}
+	}
+	if depth > 0 {
+		entry.Data[logFieldStackTrace] = trace.String()
+	}
+	return nil
+}
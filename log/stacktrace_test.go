@@ -0,0 +1,78 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func logError(l *log.Logger) {
+	l.Error("failed")
+}
+
+func TestStackTraceHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(log.StackTraceHook{MaxDepth: 2})
+	l := log.NewFromLogger(logger, log.Ctx{})
+
+	l.Warn("not an error")
+	logError(l)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var entry map[string]interface{}
+	_ = json.Unmarshal([]byte(lines[0]), &entry)
+	assert.NotContains(t, entry, "stacktrace")
+
+	entry = nil
+	_ = json.Unmarshal([]byte(lines[1]), &entry)
+	trace, _ := entry["stacktrace"].(string)
+	frames := strings.Split(trace, "\n")
+	if assert.Len(t, frames, 2) {
+		assert.Regexp(t, `^log_test\.logError@stacktrace_test\.go:[0-9]+$`, frames[0])
+		assert.Regexp(t, `^log_test\.TestStackTraceHook@stacktrace_test\.go:[0-9]+$`, frames[1])
+	}
+
+	// Existing stack traces are left untouched
+	buf.Reset()
+	l.WithField("stacktrace", "custom").Error("failed")
+	assert.Contains(t, buf.String(), `"stacktrace":"custom"`)
+}
+
+func TestConfigureStackTrace(t *testing.T) {
+	defer func(logger *logrus.Logger) { log.Log = logger }(log.Log)
+	var buf bytes.Buffer
+	log.Configure(log.Options{
+		Level:      log.LevelInfo,
+		Output:     &buf,
+		Format:     log.FormatJSON,
+		StackTrace: true,
+	})
+	log.NewEmpty().Error("failed")
+	assert.Contains(t, buf.String(), `"stacktrace":"log_test.TestConfigureStackTrace@`)
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Facility is the syslog facility of the log entries.
+type Facility int
+
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+)
+
+const (
+	FacilityLocal0 Facility = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+const (
+	NetworkUDP      = "udp"
+	NetworkTCP      = "tcp"
+	NetworkUnix     = "unix"
+	NetworkUnixgram = "unixgram"
+
+	syslogNilValue = "-"
+	// maxSyslogAppName is the maximum length of the APP-NAME field.
+	maxSyslogAppName = 48
+)
+
+// severity maps the logrus level to the syslog severity.
+func severity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0 // emerg
+	case logrus.FatalLevel:
+		return 2 // crit
+	case logrus.ErrorLevel:
+		return 3 // err
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// SyslogConfig configures the syslog sink.
+type SyslogConfig struct {
+	// Network is one of NetworkUDP, NetworkTCP, NetworkUnix or
+	// NetworkUnixgram; the default is NetworkUDP. Messages sent over
+	// stream connections are framed with octet counting (RFC 6587).
+	Network string
+	// Address of the syslog server, e.g. "localhost:514" or "/dev/log".
+	Address string
+	// Facility of the messages, the default is FacilityUser.
+	Facility Facility
+	// AppName is the APP-NAME of the messages, the default is the name
+	// of the executable.
+	AppName string
+	// Hostname is the HOSTNAME of the messages, the default is the
+	// hostname reported by the kernel.
+	Hostname string
+	// Formatter formats the MSG part of the messages, the default is the
+	// formatter of the logger.
+	Formatter logrus.Formatter
+}
+
+// SyslogHook sends the log entries to a syslog server as RFC 5424
+// messages. The connection is established on the first entry and
+// re-established after write errors.
+type SyslogHook struct {
+	config SyslogConfig
+	header string
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+func NewSyslogHook(config SyslogConfig) *SyslogHook {
+	if config.Network == "" {
+		config.Network = NetworkUDP
+	}
+	if config.Facility == FacilityKern {
+		// The kernel facility is reserved for kernel messages.
+		config.Facility = FacilityUser
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if len(config.AppName) > maxSyslogAppName {
+		config.AppName = config.AppName[:maxSyslogAppName]
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+		if config.Hostname == "" {
+			config.Hostname = syslogNilValue
+		}
+	}
+	return &SyslogHook{
+		config: config,
+		// HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA
+		header: fmt.Sprintf(" %s %s %d %s %s ",
+			config.Hostname, config.AppName, os.Getpid(),
+			syslogNilValue, syslogNilValue),
+	}
+}
+
+func (hook *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *SyslogHook) isStream() bool {
+	return hook.config.Network == NetworkTCP || hook.config.Network == NetworkUnix
+}
+
+func (hook *SyslogHook) format(entry *logrus.Entry) ([]byte, error) {
+	formatter := hook.config.Formatter
+	if formatter == nil {
+		formatter = entry.Logger.Formatter
+	}
+	msg, err := formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	msg = bytes.TrimRight(msg, "\n")
+
+	hook.buf.Reset()
+	pri := int(hook.config.Facility)*8 + severity(entry.Level)
+	hook.buf.WriteByte('<')
+	hook.buf.WriteString(strconv.Itoa(pri))
+	hook.buf.WriteString(">1 ")
+	hook.buf.WriteString(entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"))
+	hook.buf.WriteString(hook.header)
+	hook.buf.Write(msg)
+	if !hook.isStream() {
+		return hook.buf.Bytes(), nil
+	}
+	frame := make([]byte, 0, hook.buf.Len()+8)
+	frame = strconv.AppendInt(frame, int64(hook.buf.Len()), 10)
+	frame = append(frame, ' ')
+	return append(frame, hook.buf.Bytes()...), nil
+}
+
+func (hook *SyslogHook) Fire(entry *logrus.Entry) error {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	msg, err := hook.format(entry)
+	if err != nil {
+		return errors.Wrap(err, "log: failed to format syslog message")
+	}
+	// Retry once with a new connection if the server went away.
+	for attempt := 0; ; attempt++ {
+		if hook.conn == nil {
+			hook.conn, err = net.DialTimeout(
+				hook.config.Network, hook.config.Address, 5*time.Second)
+			if err != nil {
+				return errors.Wrap(err, "log: failed to connect to syslog")
+			}
+		}
+		_, err = hook.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+		_ = hook.conn.Close()
+		hook.conn = nil
+		if attempt > 0 {
+			return errors.Wrap(err, "log: failed to write to syslog")
+		}
+	}
+}
+
+// Close closes the connection to the syslog server.
+func (hook *SyslogHook) Close() error {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if hook.conn == nil {
+		return nil
+	}
+	err := hook.conn.Close()
+	hook.conn = nil
+	return err
+}
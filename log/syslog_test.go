@@ -0,0 +1,167 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package log_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func newSinkLogger(hook logrus.Hook) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	return logger
+}
+
+var syslogPattern = regexp.MustCompile(
+	`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) ` +
+		`myhost myapp \d+ - - (.*)$`)
+
+func TestSyslogHookUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hook := log.NewSyslogHook(log.SyslogConfig{
+		Address:  conn.LocalAddr().String(),
+		Facility: log.FacilityLocal0,
+		AppName:  "myapp",
+		Hostname: "myhost",
+	})
+	defer hook.Close()
+	logger := newSinkLogger(hook)
+
+	logger.WithField("request_id", "1234").Warn("disk full")
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	m := syslogPattern.FindStringSubmatch(string(buf[:n]))
+	require.NotNil(t, m, string(buf[:n]))
+	// local0 (16) * 8 + warning (4)
+	assert.Equal(t, "132", m[1])
+	assert.Contains(t, m[3], `msg="disk full"`)
+	assert.Contains(t, m[3], "request_id=1234")
+	assert.False(t, strings.HasSuffix(m[3], "\n"))
+}
+
+func TestSyslogHookTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	frames := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			var size int
+			if _, err := fmt.Fscan(r, &size); err != nil {
+				return
+			}
+			_, _ = r.ReadByte() // space
+			b := make([]byte, size)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			frames <- string(b)
+		}
+	}()
+
+	hook := log.NewSyslogHook(log.SyslogConfig{
+		Network:  log.NetworkTCP,
+		Address:  l.Addr().String(),
+		AppName:  "myapp",
+		Hostname: "myhost",
+	})
+	defer hook.Close()
+	logger := newSinkLogger(hook)
+	logger.Error("first")
+	logger.Debug("second")
+
+	for _, expected := range []struct{ pri, msg string }{
+		{pri: "11", msg: "msg=first"},
+		{pri: "15", msg: "msg=second"},
+	} {
+		select {
+		case frame := <-frames:
+			m := syslogPattern.FindStringSubmatch(frame)
+			if assert.NotNil(t, m, frame) {
+				assert.Equal(t, expected.pri, m[1])
+				assert.Contains(t, m[3], expected.msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for syslog message")
+		}
+	}
+}
+
+func TestJournalHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	hook := log.NewJournalHook(log.JournalConfig{
+		SocketPath: path,
+		Identifier: "myapp",
+	})
+	defer hook.Close()
+	logger := newSinkLogger(hook)
+	logger.WithField("request-id", "1234").
+		WithField("stack", "a\nb").
+		Info("hello")
+
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, 3)
+	assert.Equal(t, "MESSAGE=hello\n"+
+		"PRIORITY=6\n"+
+		"SYSLOG_IDENTIFIER=myapp\n"+
+		"REQUEST_ID=1234\n"+
+		"STACK\n"+string(size)+"a\nb\n",
+		string(buf[:n]))
+}
+
+func TestJournalHookNoSocket(t *testing.T) {
+	hook := log.NewJournalHook(log.JournalConfig{
+		SocketPath: filepath.Join(t.TempDir(), "missing.sock"),
+	})
+	assert.Error(t, hook.Fire(logrus.NewEntry(logrus.New())))
+}
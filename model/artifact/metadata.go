@@ -0,0 +1,195 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package artifact contains the artifact metadata model shared between the
+// services.
+//
+// The structs in this package do not declare a tenant_id field; the tenant
+// is injected when persisting the documents using store/v2.WithTenantID.
+package artifact
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DependsDeviceType is the artifact depends key listing the compatible
+	// device types.
+	DependsDeviceType = "device_type"
+
+	// MaxNameLength is the maximum length of an artifact name.
+	MaxNameLength = 256
+	// MaxDeviceTypes is the maximum number of compatible device types.
+	MaxDeviceTypes = 256
+)
+
+var (
+	ErrNameRequired        = errors.New("artifact: name is required")
+	ErrNameTooLong         = errors.New("artifact: name too long")
+	ErrDeviceTypesRequired = errors.New(
+		"artifact: at least one compatible device type is required",
+	)
+	ErrTooManyDeviceTypes = errors.New("artifact: too many device types")
+	ErrInvalidDeviceType  = errors.New("artifact: invalid device type")
+	ErrInvalidKey         = errors.New("artifact: invalid key")
+	ErrInvalidDepends     = errors.New("artifact: invalid depends value")
+)
+
+// Info contains the artifact format information.
+type Info struct {
+	Format  string `json:"format" bson:"format"`
+	Version uint   `json:"version" bson:"version"`
+}
+
+// Metadata contains the artifact metadata as read from the artifact header.
+type Metadata struct {
+	// Name is the artifact name.
+	Name string `json:"name" bson:"name"`
+	// DeviceTypes lists the device types compatible with the artifact.
+	DeviceTypes []string `json:"device_types_compatible" bson:"device_types_compatible"`
+	// Info is the artifact format information.
+	Info *Info `json:"info,omitempty" bson:"info,omitempty"`
+	// Signed is true if the artifact is signed.
+	Signed bool `json:"signed" bson:"signed"`
+	// Provides are the key/values the artifact provides when installed.
+	Provides map[string]string `json:"artifact_provides,omitempty" bson:"provides,omitempty"`
+	// Depends are the key/values the artifact requires from the device.
+	// Values are either a string or a list of strings.
+	Depends map[string]interface{} `json:"artifact_depends,omitempty" bson:"depends,omitempty"`
+	// ClearsProvides lists (glob) patterns of provides keys to clear
+	// when the artifact is installed.
+	ClearsProvides []string `json:"clears_artifact_provides,omitempty" bson:"clears_provides,omitempty"`
+}
+
+// Validate checks that the metadata has a name, at least one compatible
+// device type and well-formed depends and provides.
+func (meta Metadata) Validate() error {
+	if meta.Name == "" {
+		return ErrNameRequired
+	} else if len(meta.Name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	if len(meta.DeviceTypes) == 0 {
+		return ErrDeviceTypesRequired
+	} else if len(meta.DeviceTypes) > MaxDeviceTypes {
+		return ErrTooManyDeviceTypes
+	}
+	for _, deviceType := range meta.DeviceTypes {
+		if strings.TrimSpace(deviceType) == "" {
+			return errors.Wrapf(ErrInvalidDeviceType, "%q", deviceType)
+		}
+	}
+	for key := range meta.Provides {
+		if err := validateKey(key); err != nil {
+			return errors.WithMessage(err, "provides")
+		}
+	}
+	for key, value := range meta.Depends {
+		if err := validateKey(key); err != nil {
+			return errors.WithMessage(err, "depends")
+		}
+		if _, err := dependsValues(value); err != nil {
+			return errors.WithMessagef(err, "depends %q", key)
+		}
+	}
+	return nil
+}
+
+// validateKey checks that key is not empty and is not interpreted as an
+// operator by MongoDB. Dots are allowed as provides keys are namespaced
+// with dots (e.g. rootfs-image.version).
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "$") {
+		return errors.Wrapf(ErrInvalidKey, "%q", key)
+	}
+	return nil
+}
+
+func dependsValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		ret := make([]string, len(v))
+		for i, elem := range v {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidDepends,
+					"unsupported element type %T", elem)
+			}
+			ret[i] = s
+		}
+		return ret, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidDepends, "unsupported type %T", value)
+}
+
+// DependsValues returns the values the artifact depends on for the given
+// key. The second return value is false if the artifact does not depend on
+// key.
+func (meta Metadata) DependsValues(key string) ([]string, bool) {
+	value, ok := meta.Depends[key]
+	if !ok {
+		return nil, false
+	}
+	values, err := dependsValues(value)
+	return values, err == nil
+}
+
+// IsCompatible returns true if the artifact is compatible with deviceType.
+func (meta Metadata) IsCompatible(deviceType string) bool {
+	for _, dt := range meta.DeviceTypes {
+		if dt == deviceType {
+			return true
+		}
+	}
+	return false
+}
+
+// SatisfiesDepends returns true if the given device provides satisfy all
+// the artifact depends. A depends key with a list of values is satisfied
+// if the device provides any of the values.
+func (meta Metadata) SatisfiesDepends(provides map[string]string) bool {
+	for key := range meta.Depends {
+		values, ok := meta.DependsValues(key)
+		if !ok {
+			return false
+		}
+		provided, ok := provides[key]
+		if !ok {
+			return false
+		}
+		var found bool
+		for _, v := range values {
+			if v == provided {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the artifact name and the compatible device types.
+func (meta Metadata) String() string {
+	return fmt.Sprintf("%s (%s)", meta.Name, strings.Join(meta.DeviceTypes, ", "))
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package artifact
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mstore "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+func TestMetadataValidate(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		Metadata Metadata
+		Error    error
+	}{{
+		Name: "ok",
+		Metadata: Metadata{
+			Name:        "release-1",
+			DeviceTypes: []string{"rpi4"},
+			Provides:    map[string]string{"rootfs-image.version": "1"},
+			Depends: map[string]interface{}{
+				DependsDeviceType: []interface{}{"rpi4"},
+				"rootfs-image":    "0",
+			},
+		},
+	}, {
+		Name:     "error, missing name",
+		Metadata: Metadata{DeviceTypes: []string{"rpi4"}},
+		Error:    ErrNameRequired,
+	}, {
+		Name: "error, name too long",
+		Metadata: Metadata{
+			Name:        strings.Repeat("a", MaxNameLength+1),
+			DeviceTypes: []string{"rpi4"},
+		},
+		Error: ErrNameTooLong,
+	}, {
+		Name:     "error, no device types",
+		Metadata: Metadata{Name: "release-1"},
+		Error:    ErrDeviceTypesRequired,
+	}, {
+		Name: "error, empty device type",
+		Metadata: Metadata{
+			Name:        "release-1",
+			DeviceTypes: []string{"rpi4", " "},
+		},
+		Error: ErrInvalidDeviceType,
+	}, {
+		Name: "error, invalid provides key",
+		Metadata: Metadata{
+			Name:        "release-1",
+			DeviceTypes: []string{"rpi4"},
+			Provides:    map[string]string{"$where": "1"},
+		},
+		Error: ErrInvalidKey,
+	}, {
+		Name: "error, invalid depends value",
+		Metadata: Metadata{
+			Name:        "release-1",
+			DeviceTypes: []string{"rpi4"},
+			Depends:     map[string]interface{}{"foo": 1},
+		},
+		Error: ErrInvalidDepends,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Metadata.Validate()
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMetadataDepends(t *testing.T) {
+	t.Parallel()
+	meta := Metadata{
+		Name:        "release-1",
+		DeviceTypes: []string{"rpi3", "rpi4"},
+		Depends: map[string]interface{}{
+			DependsDeviceType: []string{"rpi3", "rpi4"},
+			"rootfs-image":    "0",
+		},
+	}
+	assert.True(t, meta.IsCompatible("rpi4"))
+	assert.False(t, meta.IsCompatible("bbb"))
+
+	values, ok := meta.DependsValues(DependsDeviceType)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"rpi3", "rpi4"}, values)
+	_, ok = meta.DependsValues("foo")
+	assert.False(t, ok)
+
+	assert.True(t, meta.SatisfiesDepends(map[string]string{
+		DependsDeviceType: "rpi4",
+		"rootfs-image":    "0",
+		"foo":             "bar",
+	}))
+	assert.False(t, meta.SatisfiesDepends(map[string]string{
+		DependsDeviceType: "rpi4",
+	}))
+	assert.False(t, meta.SatisfiesDepends(map[string]string{
+		DependsDeviceType: "bbb",
+		"rootfs-image":    "0",
+	}))
+}
+
+func TestMetadataWithTenantID(t *testing.T) {
+	t.Parallel()
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "123456789012345678901234",
+	})
+	meta := Metadata{
+		Name:        "release-1",
+		DeviceTypes: []string{"rpi4"},
+	}
+	doc := mstore.WithTenantID(ctx, meta)
+	b, err := bson.Marshal(doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var res bson.M
+	if !assert.NoError(t, bson.Unmarshal(b, &res)) {
+		return
+	}
+	assert.Equal(t, "123456789012345678901234", res[mstore.FieldTenantID])
+	assert.Equal(t, "release-1", res["name"])
+	assert.NotContains(t, res, "provides")
+
+	var decoded Metadata
+	if assert.NoError(t, bson.Unmarshal(b, &decoded)) {
+		assert.Equal(t, meta, decoded)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package device contains the device data model shared between the
+// services.
+package device
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrIdentityDataEmpty   = errors.New("device: identity data is empty")
+	ErrIdentityDataInvalid = errors.New("device: identity data must be a JSON object")
+)
+
+// IdentityData holds the parsed device identity data (id_data) as submitted
+// by the device in the authentication request.
+type IdentityData map[string]interface{}
+
+// ParseIdentityData parses the JSON encoded identity data. The identity
+// data must be a non-empty JSON object.
+func ParseIdentityData(idData []byte) (IdentityData, error) {
+	var data IdentityData
+	dec := json.NewDecoder(bytes.NewReader(idData))
+	if err := dec.Decode(&data); err != nil {
+		return nil, errors.Wrap(ErrIdentityDataInvalid, err.Error())
+	}
+	if dec.More() {
+		return nil, errors.Wrap(ErrIdentityDataInvalid, "trailing data")
+	}
+	if len(data) == 0 {
+		return nil, ErrIdentityDataEmpty
+	}
+	return data, nil
+}
+
+// Canonical returns the canonical JSON representation of the identity data
+// with the object keys sorted (at all levels) and no insignificant
+// whitespace.
+func (data IdentityData) Canonical() ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrIdentityDataEmpty
+	}
+	// encoding/json sorts map keys and produces compact output.
+	return json.Marshal(map[string]interface{}(data))
+}
+
+// SHA256 returns the SHA256 checksum of the canonical identity data.
+func (data IdentityData) SHA256() ([]byte, error) {
+	canonical, err := data.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	return sum[:], nil
+}
+
+// CanonicalizeIdentityData parses the JSON encoded identity data and returns
+// the canonical representation (see IdentityData.Canonical).
+func CanonicalizeIdentityData(idData string) (string, error) {
+	data, err := ParseIdentityData([]byte(idData))
+	if err != nil {
+		return "", err
+	}
+	canonical, err := data.Canonical()
+	return string(canonical), err
+}
+
+// IdentityDataSHA256 computes the checksum of the canonical representation
+// of the JSON encoded identity data. Two identity data documents that only
+// differ in key order or whitespace produce the same checksum.
+func IdentityDataSHA256(idData string) ([]byte, error) {
+	data, err := ParseIdentityData([]byte(idData))
+	if err != nil {
+		return nil, err
+	}
+	return data.SHA256()
+}
+
+// IdentityDataHash returns the hex encoded IdentityDataSHA256.
+func IdentityDataHash(idData string) (string, error) {
+	sum, err := IdentityDataSHA256(idData)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
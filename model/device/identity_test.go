@@ -0,0 +1,85 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizeIdentityData(t *testing.T) {
+	t.Parallel()
+	const canonical = `{"mac":"00:11:22:33:44:55","sku":{"model":"rpi","rev":4}}`
+	testCases := []struct {
+		Name string
+
+		IdData string
+
+		Canonical string
+		Error     error
+	}{{
+		Name:      "ok, already canonical",
+		IdData:    canonical,
+		Canonical: canonical,
+	}, {
+		Name: "ok, unordered with whitespace",
+		IdData: `{
+			"sku": {"rev": 4, "model": "rpi"},
+			"mac": "00:11:22:33:44:55"
+		}`,
+		Canonical: canonical,
+	}, {
+		Name:   "error, empty object",
+		IdData: `{}`,
+		Error:  ErrIdentityDataEmpty,
+	}, {
+		Name:   "error, not an object",
+		IdData: `["mac", "00:11:22:33:44:55"]`,
+		Error:  ErrIdentityDataInvalid,
+	}, {
+		Name:   "error, trailing data",
+		IdData: `{"mac": "00:11:22:33:44:55"} {}`,
+		Error:  ErrIdentityDataInvalid,
+	}, {
+		Name:   "error, invalid JSON",
+		IdData: `{"mac": `,
+		Error:  ErrIdentityDataInvalid,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			res, err := CanonicalizeIdentityData(tc.IdData)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Canonical, res)
+
+			expected := sha256.Sum256([]byte(tc.Canonical))
+			sum, err := IdentityDataSHA256(tc.IdData)
+			assert.NoError(t, err)
+			assert.Equal(t, expected[:], sum)
+
+			hash, err := IdentityDataHash(tc.IdData)
+			assert.NoError(t, err)
+			assert.Equal(t, hex.EncodeToString(expected[:]), hash)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ids
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+type contextKey int
+
+const (
+	tenantIDContextKey contextKey = iota
+	deviceIDContextKey
+	userIDContextKey
+)
+
+// WithTenantID adds the tenant ID to the context, e.g. for background jobs
+// not authenticated with an identity.
+func WithTenantID(ctx context.Context, id TenantID) context.Context {
+	return context.WithValue(ctx, tenantIDContextKey, id)
+}
+
+// WithDeviceID adds the device ID to the context.
+func WithDeviceID(ctx context.Context, id DeviceID) context.Context {
+	return context.WithValue(ctx, deviceIDContextKey, id)
+}
+
+// WithUserID adds the user ID to the context.
+func WithUserID(ctx context.Context, id UserID) context.Context {
+	return context.WithValue(ctx, userIDContextKey, id)
+}
+
+// TenantIDFromContext returns the tenant ID added with WithTenantID or,
+// if not set, the tenant of the identity in the context.
+func TenantIDFromContext(ctx context.Context) (TenantID, bool) {
+	if id, ok := ctx.Value(tenantIDContextKey).(TenantID); ok {
+		return id, true
+	}
+	if id := identity.FromContext(ctx); id != nil && id.Tenant != "" {
+		return TenantID(id.Tenant), true
+	}
+	return "", false
+}
+
+// DeviceIDFromContext returns the device ID added with WithDeviceID or,
+// if not set, the subject of the device identity in the context.
+func DeviceIDFromContext(ctx context.Context) (DeviceID, bool) {
+	if id, ok := ctx.Value(deviceIDContextKey).(DeviceID); ok {
+		return id, true
+	}
+	if id := identity.FromContext(ctx); id != nil && id.IsDevice {
+		if deviceID, err := ParseDeviceID(id.Subject); err == nil {
+			return deviceID, !deviceID.IsZero()
+		}
+	}
+	return DeviceID{}, false
+}
+
+// UserIDFromContext returns the user ID added with WithUserID or, if not
+// set, the subject of the user identity in the context.
+func UserIDFromContext(ctx context.Context) (UserID, bool) {
+	if id, ok := ctx.Value(userIDContextKey).(UserID); ok {
+		return id, true
+	}
+	if id := identity.FromContext(ctx); id != nil && id.IsUser {
+		if userID, err := ParseUserID(id.Subject); err == nil {
+			return userID, !userID.IsZero()
+		}
+	}
+	return UserID{}, false
+}
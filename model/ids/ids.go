@@ -0,0 +1,255 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package ids contains typed identifiers of the devices, tenants and users
+// shared between the services, to avoid passing bare strings around.
+//
+// Device and user IDs are UUIDs; they are stored in BSON as binary UUIDs
+// (subtype 0x04) like uuid.UUID with the UUID codec of the mongo/codec
+// package, and are decoded from both the binary and the legacy string
+// representation. Tenant IDs are hex encoded ObjectIDs stored as strings.
+package ids
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+var (
+	ErrInvalidDeviceID = errors.New("ids: invalid device ID")
+	ErrInvalidTenantID = errors.New("ids: invalid tenant ID")
+	ErrInvalidUserID   = errors.New("ids: invalid user ID")
+)
+
+// DeviceID identifies a device.
+type DeviceID uuid.UUID
+
+// NewDeviceID generates a new random device ID.
+func NewDeviceID() DeviceID {
+	return DeviceID(uuid.New())
+}
+
+// ParseDeviceID parses the string representation of a device ID.
+func ParseDeviceID(s string) (DeviceID, error) {
+	uid, err := parseUUID(s)
+	if err != nil {
+		return DeviceID{}, errors.Wrap(ErrInvalidDeviceID, err.Error())
+	}
+	return DeviceID(uid), nil
+}
+
+func (id DeviceID) String() string {
+	return uuidString(uuid.UUID(id))
+}
+
+// IsZero returns true if the ID is not set.
+func (id DeviceID) IsZero() bool {
+	return uuid.UUID(id) == uuid.Nil
+}
+
+// Validate returns an error if the ID is not set.
+func (id DeviceID) Validate() error {
+	if id.IsZero() {
+		return errors.Wrap(ErrInvalidDeviceID, "cannot be empty")
+	}
+	return nil
+}
+
+func (id DeviceID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *DeviceID) UnmarshalText(b []byte) error {
+	uid, err := parseUUID(string(b))
+	if err != nil {
+		return errors.Wrap(ErrInvalidDeviceID, err.Error())
+	}
+	*id = DeviceID(uid)
+	return nil
+}
+
+func (id DeviceID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return marshalUUIDBSON(uuid.UUID(id))
+}
+
+func (id *DeviceID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	uid, err := unmarshalUUIDBSON(t, data)
+	if err != nil {
+		return errors.Wrap(ErrInvalidDeviceID, err.Error())
+	}
+	*id = DeviceID(uid)
+	return nil
+}
+
+// UserID identifies a user.
+type UserID uuid.UUID
+
+// NewUserID generates a new random user ID.
+func NewUserID() UserID {
+	return UserID(uuid.New())
+}
+
+// ParseUserID parses the string representation of a user ID.
+func ParseUserID(s string) (UserID, error) {
+	uid, err := parseUUID(s)
+	if err != nil {
+		return UserID{}, errors.Wrap(ErrInvalidUserID, err.Error())
+	}
+	return UserID(uid), nil
+}
+
+func (id UserID) String() string {
+	return uuidString(uuid.UUID(id))
+}
+
+// IsZero returns true if the ID is not set.
+func (id UserID) IsZero() bool {
+	return uuid.UUID(id) == uuid.Nil
+}
+
+// Validate returns an error if the ID is not set.
+func (id UserID) Validate() error {
+	if id.IsZero() {
+		return errors.Wrap(ErrInvalidUserID, "cannot be empty")
+	}
+	return nil
+}
+
+func (id UserID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *UserID) UnmarshalText(b []byte) error {
+	uid, err := parseUUID(string(b))
+	if err != nil {
+		return errors.Wrap(ErrInvalidUserID, err.Error())
+	}
+	*id = UserID(uid)
+	return nil
+}
+
+func (id UserID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return marshalUUIDBSON(uuid.UUID(id))
+}
+
+func (id *UserID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	uid, err := unmarshalUUIDBSON(t, data)
+	if err != nil {
+		return errors.Wrap(ErrInvalidUserID, err.Error())
+	}
+	*id = UserID(uid)
+	return nil
+}
+
+// TenantID identifies a tenant. The zero value is the empty ID of
+// the single tenant (open source) installations.
+type TenantID string
+
+// ParseTenantID parses a (non-empty) tenant ID.
+func ParseTenantID(s string) (TenantID, error) {
+	id := TenantID(s)
+	if err := id.Validate(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (id TenantID) String() string {
+	return string(id)
+}
+
+// IsZero returns true if the ID is not set.
+func (id TenantID) IsZero() bool {
+	return id == ""
+}
+
+// Validate returns an error if the ID is not a hex encoded ObjectID.
+func (id TenantID) Validate() error {
+	if id.IsZero() {
+		return errors.Wrap(ErrInvalidTenantID, "cannot be empty")
+	} else if !primitive.IsValidObjectID(string(id)) {
+		return errors.Wrapf(ErrInvalidTenantID, "%q is not an ObjectID", string(id))
+	}
+	return nil
+}
+
+func (id *TenantID) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*id = ""
+		return nil
+	}
+	tid, err := ParseTenantID(string(b))
+	if err != nil {
+		return err
+	}
+	*id = tid
+	return nil
+}
+
+// parseUUID parses a UUID, the empty string is parsed as the zero value.
+func parseUUID(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(s)
+}
+
+// uuidString formats the UUID, the zero value is formatted as the empty
+// string (and omitted by "omitempty" in BSON).
+func uuidString(uid uuid.UUID) string {
+	if uid == uuid.Nil {
+		return ""
+	}
+	return uid.String()
+}
+
+func marshalUUIDBSON(uid uuid.UUID) (bsontype.Type, []byte, error) {
+	if uid == uuid.Nil {
+		return bsontype.Null, nil, nil
+	}
+	return bsontype.Binary, bsoncore.AppendBinary(nil, bsontype.BinaryUUID, uid[:]), nil
+}
+
+func unmarshalUUIDBSON(t bsontype.Type, data []byte) (uuid.UUID, error) {
+	value := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.Binary:
+		subtype, b, ok := value.BinaryOK()
+		if !ok {
+			return uuid.Nil, errors.New("malformed binary value")
+		}
+		switch subtype {
+		case bsontype.BinaryGeneric, bsontype.BinaryUUID, bsontype.BinaryUUIDOld:
+		default:
+			return uuid.Nil, errors.Errorf("incorrect binary subtype 0x%02x", subtype)
+		}
+		return uuid.FromBytes(b)
+
+	case bsontype.String:
+		s, ok := value.StringValueOK()
+		if !ok {
+			return uuid.Nil, errors.New("malformed string value")
+		}
+		return parseUUID(s)
+
+	case bsontype.Null, bsontype.Undefined:
+		return uuid.Nil, nil
+
+	default:
+		return uuid.Nil, errors.Errorf("cannot decode %v as a UUID", t)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ids
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const testUUID = "b0e2c6d8-6f3c-4c0a-9f53-3dbb6a1d1f7e"
+
+func TestParseIDs(t *testing.T) {
+	t.Parallel()
+	deviceID, err := ParseDeviceID(testUUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testUUID, deviceID.String())
+		assert.NoError(t, deviceID.Validate())
+	}
+	_, err = ParseDeviceID("not-a-uuid")
+	assert.True(t, errors.Is(err, ErrInvalidDeviceID))
+
+	userID, err := ParseUserID(testUUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testUUID, userID.String())
+	}
+	_, err = ParseUserID("123")
+	assert.True(t, errors.Is(err, ErrInvalidUserID))
+
+	var zero DeviceID
+	assert.True(t, zero.IsZero())
+	assert.Equal(t, "", zero.String())
+	assert.True(t, errors.Is(zero.Validate(), ErrInvalidDeviceID))
+	assert.False(t, NewDeviceID().IsZero())
+	assert.False(t, NewUserID().IsZero())
+
+	tenantID, err := ParseTenantID("5abcb6de7ac3d2001a1b2c3d")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "5abcb6de7ac3d2001a1b2c3d", tenantID.String())
+	}
+	for _, s := range []string{"", "tenant1", "5abcb6de7ac3d2001a1b2c3"} {
+		_, err = ParseTenantID(s)
+		assert.True(t, errors.Is(err, ErrInvalidTenantID), s)
+	}
+}
+
+type testDocument struct {
+	DeviceID DeviceID `json:"device_id" bson:"device_id"`
+	UserID   UserID   `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	TenantID TenantID `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+	doc := testDocument{
+		DeviceID: DeviceID(uuid.MustParse(testUUID)),
+		TenantID: "5abcb6de7ac3d2001a1b2c3d",
+	}
+	b, err := json.Marshal(doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.JSONEq(t, `{"device_id": "`+testUUID+`", "user_id": "",`+
+		`"tenant_id": "5abcb6de7ac3d2001a1b2c3d"}`, string(b))
+
+	var decoded testDocument
+	if assert.NoError(t, json.Unmarshal(b, &decoded)) {
+		assert.Equal(t, doc, decoded)
+	}
+
+	err = json.Unmarshal([]byte(`{"device_id": "foo"}`), &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidDeviceID))
+	err = json.Unmarshal([]byte(`{"tenant_id": "foo"}`), &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidTenantID))
+}
+
+func TestBSON(t *testing.T) {
+	t.Parallel()
+	uid := uuid.MustParse(testUUID)
+	doc := testDocument{
+		DeviceID: DeviceID(uid),
+		TenantID: "5abcb6de7ac3d2001a1b2c3d",
+	}
+	b, err := bson.Marshal(doc)
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw := bson.Raw(b)
+	subtype, data := raw.Lookup("device_id").Binary()
+	assert.Equal(t, bsontype.BinaryUUID, subtype)
+	assert.Equal(t, uid[:], data)
+	assert.Equal(t, "5abcb6de7ac3d2001a1b2c3d", raw.Lookup("tenant_id").StringValue())
+
+	var decoded testDocument
+	if assert.NoError(t, bson.Unmarshal(b, &decoded)) {
+		assert.Equal(t, doc, decoded)
+	}
+
+	// Legacy documents store the IDs as strings.
+	b, _ = bson.Marshal(bson.M{"device_id": testUUID, "user_id": testUUID})
+	decoded = testDocument{}
+	if assert.NoError(t, bson.Unmarshal(b, &decoded)) {
+		assert.Equal(t, DeviceID(uid), decoded.DeviceID)
+		assert.Equal(t, UserID(uid), decoded.UserID)
+	}
+
+	b, _ = bson.Marshal(bson.M{"device_id": primitive.Binary{
+		Subtype: bsontype.BinaryUserDefined, Data: uid[:],
+	}})
+	err = bson.Unmarshal(b, &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidDeviceID))
+	b, _ = bson.Marshal(bson.M{"device_id": 1234})
+	err = bson.Unmarshal(b, &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidDeviceID))
+}
+
+func TestContext(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, ok := TenantIDFromContext(ctx)
+	assert.False(t, ok)
+	_, ok = DeviceIDFromContext(ctx)
+	assert.False(t, ok)
+	_, ok = UserIDFromContext(ctx)
+	assert.False(t, ok)
+
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject:  testUUID,
+		Tenant:   "5abcb6de7ac3d2001a1b2c3d",
+		IsDevice: true,
+	})
+	tenantID, ok := TenantIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, TenantID("5abcb6de7ac3d2001a1b2c3d"), tenantID)
+	deviceID, ok := DeviceIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, testUUID, deviceID.String())
+	_, ok = UserIDFromContext(ctx)
+	assert.False(t, ok)
+
+	userID := NewUserID()
+	ctx = WithUserID(WithTenantID(ctx, "6abcb6de7ac3d2001a1b2c3d"), userID)
+	tenantID, _ = TenantIDFromContext(ctx)
+	assert.Equal(t, TenantID("6abcb6de7ac3d2001a1b2c3d"), tenantID)
+	actual, ok := UserIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, userID, actual)
+}
@@ -0,0 +1,263 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package inventory contains the device inventory data model shared
+// between the services.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	ScopeIdentity  = "identity"
+	ScopeInventory = "inventory"
+	ScopeMonitor   = "monitor"
+	ScopeSystem    = "system"
+	ScopeTags      = "tags"
+
+	// MaxNameLength is the maximum length of an attribute name.
+	MaxNameLength = 1024
+	// MaxValueLength is the maximum length of a string attribute value and
+	// the maximum number of elements in an array attribute value.
+	MaxValueLength = 4096
+)
+
+var (
+	// KnownScopes lists all the valid attribute scopes.
+	KnownScopes = []string{
+		ScopeIdentity,
+		ScopeInventory,
+		ScopeMonitor,
+		ScopeSystem,
+		ScopeTags,
+	}
+
+	ErrNameRequired    = errors.New("inventory: attribute name is required")
+	ErrNameTooLong     = errors.New("inventory: attribute name too long")
+	ErrInvalidScope    = errors.New("inventory: invalid attribute scope")
+	ErrValueRequired   = errors.New("inventory: attribute value is required")
+	ErrValueTooLong    = errors.New("inventory: attribute value too long")
+	ErrInvalidValue    = errors.New("inventory: invalid attribute value")
+	ErrMixedArrayTypes = errors.New(
+		"inventory: array attribute values must be of the same type",
+	)
+)
+
+// DeviceAttribute is a single device attribute. The Value is normalized to
+// one of the following types: string, float64, []string or []float64.
+type DeviceAttribute struct {
+	Name        string      `json:"name" bson:"name"`
+	Scope       string      `json:"scope" bson:"scope"`
+	Value       interface{} `json:"value" bson:"value"`
+	Description *string     `json:"description,omitempty" bson:"description,omitempty"`
+	Timestamp   *time.Time  `json:"timestamp,omitempty" bson:"timestamp,omitempty"`
+}
+
+// NormalizeValue converts value to one of the supported attribute value
+// types. Numeric types are converted to float64 and arrays to []string or
+// []float64.
+func NormalizeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, ErrValueRequired
+	case string, float64, []string, []float64:
+		return v, nil
+	case []interface{}:
+		return normalizeArray(v)
+	case bson.A:
+		return normalizeArray(v)
+	}
+	if f, ok := toFloat(value); ok {
+		return f, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidValue, "unsupported type %T", value)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func normalizeArray(arr []interface{}) (interface{}, error) {
+	if len(arr) == 0 {
+		return []string{}, nil
+	}
+	if _, ok := arr[0].(string); ok {
+		ret := make([]string, len(arr))
+		for i, elem := range arr {
+			s, ok := elem.(string)
+			if !ok {
+				return nil, ErrMixedArrayTypes
+			}
+			ret[i] = s
+		}
+		return ret, nil
+	}
+	ret := make([]float64, len(arr))
+	for i, elem := range arr {
+		f, ok := toFloat(elem)
+		if !ok {
+			if _, isStr := elem.(string); isStr || i > 0 {
+				return nil, ErrMixedArrayTypes
+			}
+			return nil, errors.Wrapf(ErrInvalidValue,
+				"unsupported array element type %T", elem)
+		}
+		ret[i] = f
+	}
+	return ret, nil
+}
+
+// Validate checks that the attribute has a name, a known scope and a
+// value of a supported type.
+func (attr DeviceAttribute) Validate() error {
+	if attr.Name == "" {
+		return ErrNameRequired
+	} else if len(attr.Name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	if !IsValidScope(attr.Scope) {
+		return errors.Wrapf(ErrInvalidScope, "%q", attr.Scope)
+	}
+	value, err := NormalizeValue(attr.Value)
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		if len(v) > MaxValueLength {
+			return ErrValueTooLong
+		}
+	case []string:
+		if len(v) > MaxValueLength {
+			return ErrValueTooLong
+		}
+		for _, s := range v {
+			if len(s) > MaxValueLength {
+				return ErrValueTooLong
+			}
+		}
+	case []float64:
+		if len(v) > MaxValueLength {
+			return ErrValueTooLong
+		}
+	}
+	return nil
+}
+
+// IsValidScope returns true if scope is one of the KnownScopes.
+func IsValidScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if scope == s {
+			return true
+		}
+	}
+	return false
+}
+
+type deviceAttribute DeviceAttribute
+
+// UnmarshalJSON decodes and normalizes the attribute value.
+func (attr *DeviceAttribute) UnmarshalJSON(b []byte) error {
+	var a deviceAttribute
+	if err := json.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	if a.Value != nil {
+		value, err := NormalizeValue(a.Value)
+		if err != nil {
+			return err
+		}
+		a.Value = value
+	}
+	*attr = DeviceAttribute(a)
+	return nil
+}
+
+// UnmarshalBSON decodes and normalizes the attribute value.
+func (attr *DeviceAttribute) UnmarshalBSON(b []byte) error {
+	var a deviceAttribute
+	if err := bson.Unmarshal(b, &a); err != nil {
+		return err
+	}
+	if a.Value != nil {
+		value, err := NormalizeValue(a.Value)
+		if err != nil {
+			return err
+		}
+		a.Value = value
+	}
+	*attr = DeviceAttribute(a)
+	return nil
+}
+
+// DeviceAttributes is a list of device attributes.
+type DeviceAttributes []DeviceAttribute
+
+// Validate validates all the attributes and ensures there are no duplicate
+// attributes (same scope and name).
+func (attrs DeviceAttributes) Validate() error {
+	seen := make(map[string]struct{}, len(attrs))
+	for i, attr := range attrs {
+		if err := attr.Validate(); err != nil {
+			return errors.WithMessagef(err, "attribute %d", i)
+		}
+		key := attr.Scope + "/" + attr.Name
+		if _, dup := seen[key]; dup {
+			return fmt.Errorf(
+				"inventory: duplicate attribute %q in scope %q",
+				attr.Name, attr.Scope,
+			)
+		}
+		seen[key] = struct{}{}
+	}
+	return nil
+}
+
+// Get returns the attribute with the given scope and name or nil if it
+// does not exist.
+func (attrs DeviceAttributes) Get(scope, name string) *DeviceAttribute {
+	for i := range attrs {
+		if attrs[i].Scope == scope && attrs[i].Name == name {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
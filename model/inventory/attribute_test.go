@@ -0,0 +1,188 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDeviceAttributeValidate(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		Attribute DeviceAttribute
+		Error     error
+	}{{
+		Name: "ok, string",
+		Attribute: DeviceAttribute{
+			Name: "mac", Scope: ScopeIdentity, Value: "00:11:22:33:44:55",
+		},
+	}, {
+		Name: "ok, number",
+		Attribute: DeviceAttribute{
+			Name: "mem_total_kB", Scope: ScopeInventory, Value: 1024,
+		},
+	}, {
+		Name: "ok, string array",
+		Attribute: DeviceAttribute{
+			Name: "ipv4", Scope: ScopeInventory,
+			Value: []interface{}{"10.0.0.1", "192.168.0.1"},
+		},
+	}, {
+		Name: "error, missing name",
+		Attribute: DeviceAttribute{
+			Scope: ScopeInventory, Value: "foo",
+		},
+		Error: ErrNameRequired,
+	}, {
+		Name: "error, name too long",
+		Attribute: DeviceAttribute{
+			Name:  strings.Repeat("a", MaxNameLength+1),
+			Scope: ScopeInventory, Value: "foo",
+		},
+		Error: ErrNameTooLong,
+	}, {
+		Name: "error, invalid scope",
+		Attribute: DeviceAttribute{
+			Name: "foo", Scope: "bar", Value: "baz",
+		},
+		Error: ErrInvalidScope,
+	}, {
+		Name: "error, no value",
+		Attribute: DeviceAttribute{
+			Name: "foo", Scope: ScopeTags,
+		},
+		Error: ErrValueRequired,
+	}, {
+		Name: "error, value too long",
+		Attribute: DeviceAttribute{
+			Name: "foo", Scope: ScopeTags,
+			Value: strings.Repeat("a", MaxValueLength+1),
+		},
+		Error: ErrValueTooLong,
+	}, {
+		Name: "error, mixed array",
+		Attribute: DeviceAttribute{
+			Name: "foo", Scope: ScopeInventory,
+			Value: []interface{}{1.0, "two"},
+		},
+		Error: ErrMixedArrayTypes,
+	}, {
+		Name: "error, invalid type",
+		Attribute: DeviceAttribute{
+			Name: "foo", Scope: ScopeInventory,
+			Value: map[string]interface{}{"foo": "bar"},
+		},
+		Error: ErrInvalidValue,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Attribute.Validate()
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeviceAttributeMarshal(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name string
+
+		JSON  string
+		Value interface{}
+		Error error
+	}{{
+		Name:  "string",
+		JSON:  `{"name":"foo","scope":"inventory","value":"bar"}`,
+		Value: "bar",
+	}, {
+		Name:  "number",
+		JSON:  `{"name":"foo","scope":"inventory","value":123}`,
+		Value: float64(123),
+	}, {
+		Name:  "string array",
+		JSON:  `{"name":"foo","scope":"inventory","value":["a","b"]}`,
+		Value: []string{"a", "b"},
+	}, {
+		Name:  "number array",
+		JSON:  `{"name":"foo","scope":"inventory","value":[1,2.5]}`,
+		Value: []float64{1, 2.5},
+	}, {
+		Name:  "mixed array",
+		JSON:  `{"name":"foo","scope":"inventory","value":[1,"2"]}`,
+		Error: ErrMixedArrayTypes,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var attr DeviceAttribute
+			err := json.Unmarshal([]byte(tc.JSON), &attr)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.Value, attr.Value)
+
+			b, err := bson.Marshal(attr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var decoded DeviceAttribute
+			err = bson.Unmarshal(b, &decoded)
+			if assert.NoError(t, err) {
+				assert.Equal(t, attr, decoded)
+			}
+		})
+	}
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	t.Parallel()
+	attrs := DeviceAttributes{
+		{Name: "foo", Scope: ScopeInventory, Value: "bar"},
+		{Name: "foo", Scope: ScopeTags, Value: "baz"},
+	}
+	assert.NoError(t, attrs.Validate())
+	if attr := attrs.Get(ScopeTags, "foo"); assert.NotNil(t, attr) {
+		assert.Equal(t, "baz", attr.Value)
+	}
+	assert.Nil(t, attrs.Get(ScopeSystem, "foo"))
+
+	attrs = append(attrs, DeviceAttribute{
+		Name: "foo", Scope: ScopeTags, Value: "qux",
+	})
+	assert.EqualError(t, attrs.Validate(),
+		`inventory: duplicate attribute "foo" in scope "tags"`)
+
+	attrs = DeviceAttributes{{Name: "foo", Scope: ScopeInventory}}
+	assert.EqualError(t, attrs.Validate(),
+		"attribute 0: inventory: attribute value is required")
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package pat contains the personal access token (PAT) model shared
+// between the services issuing and authenticating the tokens.
+//
+// A token has the format "<prefix><id>.<secret>": the ID selects the stored
+// token and the secret is only stored as an Argon2id hash.
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/password"
+)
+
+const (
+	// TokenPrefix identifies personal access tokens, e.g. for secret
+	// scanners.
+	TokenPrefix = "mpat_"
+
+	// SecretSize is the number of random bytes of the secret.
+	SecretSize = 32
+
+	// MaxNameLength is the maximum length of the token name.
+	MaxNameLength = 256
+)
+
+var (
+	ErrInvalidToken = errors.New("pat: invalid token")
+	ErrTokenExpired = errors.New("pat: token expired")
+	ErrInvalidHash  = errors.New("pat: invalid hash")
+	ErrNameRequired = errors.New("pat: token name is required")
+	ErrNameTooLong  = errors.New("pat: token name too long")
+)
+
+// Token is a stored personal access token.
+type Token struct {
+	ID     string `json:"id" bson:"_id"`
+	Name   string `json:"name" bson:"name"`
+	UserID string `json:"-" bson:"user_id"`
+	// Hash is the encoded Argon2id hash of the secret, see HashSecret.
+	Hash string `json:"-" bson:"hash"`
+
+	CreatedTS      time.Time  `json:"created_ts" bson:"created_ts"`
+	ExpirationDate time.Time  `json:"expiration_date" bson:"expiration_date"`
+	LastUsed       *time.Time `json:"last_used,omitempty" bson:"last_used,omitempty"`
+}
+
+// Validate checks the name of the token.
+func (tok *Token) Validate() error {
+	if tok.Name == "" {
+		return ErrNameRequired
+	} else if len(tok.Name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
+// Expired returns true if the token is expired at time now.
+func (tok *Token) Expired(now time.Time) bool {
+	return !now.Before(tok.ExpirationDate)
+}
+
+// Verify checks the secret and the expiration of the token.
+func (tok *Token) Verify(secret string, now time.Time) error {
+	ok, err := VerifySecret(secret, tok.Hash)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrInvalidToken
+	}
+	if tok.Expired(now) {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// New generates a new token for the user returning the token to hand to
+// the user once and the Token to store.
+func New(userID, name string, now time.Time, ttl time.Duration) (string, *Token, error) {
+	tok := &Token{
+		ID:             uuid.NewString(),
+		Name:           name,
+		UserID:         userID,
+		CreatedTS:      now,
+		ExpirationDate: now.Add(ttl),
+	}
+	if err := tok.Validate(); err != nil {
+		return "", nil, err
+	}
+	b := make([]byte, SecretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, errors.Wrap(err, "pat: failed to generate secret")
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	hash, err := HashSecret(secret, DefaultHashParams)
+	if err != nil {
+		return "", nil, err
+	}
+	tok.Hash = hash
+	return TokenPrefix + tok.ID + "." + secret, tok, nil
+}
+
+// Parse splits the token into the ID and the secret.
+func Parse(token string) (id, secret string, err error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return "", "", ErrInvalidToken
+	}
+	id, secret, ok := strings.Cut(token[len(TokenPrefix):], ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidToken
+	}
+	return id, secret, nil
+}
+
+// HashParams are the parameters of the Argon2id hash.
+type HashParams = password.Argon2idParams
+
+// DefaultHashParams are the default parameters of password.Argon2id.
+var DefaultHashParams = password.DefaultArgon2idParams
+
+// HashSecret returns the Argon2id hash of the secret, see
+// password.Argon2id.
+func HashSecret(secret string, params HashParams) (string, error) {
+	return password.Argon2id{Params: &params}.Hash(secret)
+}
+
+// VerifySecret returns true if the secret matches the hash encoded by
+// HashSecret.
+func VerifySecret(secret, encoded string) (bool, error) {
+	ok, err := password.Argon2id{}.Verify(secret, encoded)
+	if errors.Is(err, password.ErrInvalidHash) {
+		return false, errors.Wrap(ErrInvalidHash, err.Error())
+	}
+	return ok, err
+}
+
+// LastUsedHook persists the last use of the token, e.g. by updating the
+// "last_used" field of the stored token.
+type LastUsedHook func(ctx context.Context, tok *Token, lastUsed time.Time) error
+
+// LastUsedTracker updates the last use of the tokens, calling the Hook at
+// most once per Interval for each token to avoid a write on every request.
+type LastUsedTracker struct {
+	Hook LastUsedHook
+	// Interval is the resolution of the last use. (default: 1 minute)
+	Interval time.Duration
+}
+
+// Touch records the use of the token at time now: if the last use of the
+// token is older than the interval, it is set to now and passed to the
+// Hook.
+func (tracker *LastUsedTracker) Touch(ctx context.Context, tok *Token, now time.Time) error {
+	interval := tracker.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if tok.LastUsed != nil && now.Sub(*tok.LastUsed) < interval {
+		return nil
+	}
+	tok.LastUsed = &now
+	if tracker.Hook == nil {
+		return nil
+	}
+	return tracker.Hook(ctx, tok, now)
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package pat
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testHashParams = HashParams{
+	Time:       1,
+	Memory:     1024,
+	Threads:    1,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	token, tok, err := New("user", "ci", now, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(token, TokenPrefix))
+	id, secret, err := Parse(token)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tok.ID, id)
+		assert.NoError(t, tok.Verify(secret, now))
+		assert.ErrorIs(t, tok.Verify(secret+"x", now), ErrInvalidToken)
+		assert.ErrorIs(t, tok.Verify(secret, now.Add(time.Hour)), ErrTokenExpired)
+	}
+	assert.NotContains(t, tok.Hash, secret)
+
+	_, _, err = New("user", "", now, time.Hour)
+	assert.ErrorIs(t, err, ErrNameRequired)
+	_, _, err = New("user", strings.Repeat("a", MaxNameLength+1), now, time.Hour)
+	assert.ErrorIs(t, err, ErrNameTooLong)
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for _, token := range []string{
+		"",
+		"id.secret",
+		TokenPrefix + "id",
+		TokenPrefix + ".secret",
+		TokenPrefix + "id.",
+	} {
+		_, _, err := Parse(token)
+		assert.ErrorIs(t, err, ErrInvalidToken, token)
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	t.Parallel()
+	hash, err := HashSecret("secret", testHashParams)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+	other, _ := HashSecret("secret", testHashParams)
+	assert.NotEqual(t, hash, other, "the salt must be random")
+
+	ok, err := VerifySecret("secret", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = VerifySecret("wrong", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5",
+	} {
+		_, err = VerifySecret("secret", invalid)
+		assert.ErrorIs(t, err, ErrInvalidHash, invalid)
+	}
+}
+
+func TestLastUsedTracker(t *testing.T) {
+	t.Parallel()
+	var calls int
+	tracker := &LastUsedTracker{
+		Hook: func(ctx context.Context, tok *Token, lastUsed time.Time) error {
+			calls++
+			return nil
+		},
+	}
+	ctx := context.Background()
+	now := time.Now()
+	tok := &Token{ID: "id"}
+
+	assert.NoError(t, tracker.Touch(ctx, tok, now))
+	assert.NoError(t, tracker.Touch(ctx, tok, now.Add(30*time.Second)))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, now, *tok.LastUsed)
+
+	assert.NoError(t, tracker.Touch(ctx, tok, now.Add(time.Minute)))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, now.Add(time.Minute), *tok.LastUsed)
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package diagnostics reports the index usage and storage statistics of
+// the collections of a database, flagging unused indexes and indexes
+// without the tenant_id prefix required by the shared collections of
+// multi-tenant deployments.
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+const (
+	idIndexName = "_id_"
+
+	WarningUnusedIndex         = "unused index"
+	WarningMissingTenantPrefix = "index is not prefixed by " + v2.FieldTenantID
+)
+
+type Options struct {
+	// Collections limits the report to the given collections, the
+	// default is all collections except the system collections.
+	Collections []string
+	// RequireTenantPrefix flags the indexes not starting with the
+	// tenant_id field.
+	RequireTenantPrefix *bool
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetCollections(collections ...string) *Options {
+	opts.Collections = collections
+	return opts
+}
+
+func (opts *Options) SetRequireTenantPrefix(require bool) *Options {
+	opts.RequireTenantPrefix = &require
+	return opts
+}
+
+// IndexUsage is the usage of an index since the server started (Since).
+type IndexUsage struct {
+	Name     string    `json:"name" bson:"name"`
+	Key      IndexKey  `json:"key" bson:"key"`
+	Ops      int64     `json:"ops" bson:"ops"`
+	Since    time.Time `json:"since" bson:"since"`
+	Warnings []string  `json:"warnings,omitempty" bson:"-"`
+}
+
+// IndexKey is the key specification of an index.
+type IndexKey bson.D
+
+// MarshalJSON encodes the key as a JSON object preserving the order of the
+// fields.
+func (key IndexKey) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{'{'})
+	for i, elem := range key {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(elem.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(elem.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type CollectionStats struct {
+	Name           string       `json:"name"`
+	Count          int64        `json:"count"`
+	Size           int64        `json:"size"`
+	StorageSize    int64        `json:"storage_size"`
+	TotalIndexSize int64        `json:"total_index_size"`
+	Indexes        []IndexUsage `json:"indexes"`
+}
+
+type Report struct {
+	Database    string            `json:"database"`
+	Collections []CollectionStats `json:"collections"`
+}
+
+// Warnings returns the number of flagged indexes.
+func (r *Report) Warnings() int {
+	var n int
+	for _, coll := range r.Collections {
+		for _, idx := range coll.Indexes {
+			n += len(idx.Warnings)
+		}
+	}
+	return n
+}
+
+type indexStats struct {
+	Name     string   `bson:"name"`
+	Key      IndexKey `bson:"key"`
+	Accesses struct {
+		Ops   int64     `bson:"ops"`
+		Since time.Time `bson:"since"`
+	} `bson:"accesses"`
+}
+
+type collStats struct {
+	StorageStats struct {
+		Count          int64 `bson:"count"`
+		Size           int64 `bson:"size"`
+		StorageSize    int64 `bson:"storageSize"`
+		TotalIndexSize int64 `bson:"totalIndexSize"`
+	} `bson:"storageStats"`
+}
+
+// analyzeIndexes merges the statistics of the hosts (a sharded collection
+// reports an entry per shard) and flags the indexes.
+func analyzeIndexes(stats []indexStats, requireTenantPrefix bool) []IndexUsage {
+	byName := make(map[string]*IndexUsage, len(stats))
+	ret := make([]IndexUsage, 0, len(stats))
+	for _, s := range stats {
+		if idx, ok := byName[s.Name]; ok {
+			idx.Ops += s.Accesses.Ops
+			if s.Accesses.Since.Before(idx.Since) {
+				idx.Since = s.Accesses.Since
+			}
+			continue
+		}
+		ret = append(ret, IndexUsage{
+			Name:  s.Name,
+			Key:   s.Key,
+			Ops:   s.Accesses.Ops,
+			Since: s.Accesses.Since,
+		})
+		byName[s.Name] = &ret[len(ret)-1]
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	for i := range ret {
+		idx := &ret[i]
+		if idx.Name == idIndexName {
+			continue
+		}
+		if idx.Ops == 0 {
+			idx.Warnings = append(idx.Warnings, WarningUnusedIndex)
+		}
+		if requireTenantPrefix &&
+			(len(idx.Key) == 0 || idx.Key[0].Key != v2.FieldTenantID) {
+			idx.Warnings = append(idx.Warnings, WarningMissingTenantPrefix)
+		}
+	}
+	return ret
+}
+
+func collectCollection(
+	ctx context.Context,
+	coll *mongo.Collection,
+	requireTenantPrefix bool,
+) (CollectionStats, error) {
+	ret := CollectionStats{Name: coll.Name()}
+	cur, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$indexStats", Value: bson.D{}}},
+	})
+	if err != nil {
+		return ret, errors.Wrapf(err,
+			"diagnostics: failed to get index stats of %q", coll.Name())
+	}
+	var idxStats []indexStats
+	if err = cur.All(ctx, &idxStats); err != nil {
+		return ret, errors.Wrapf(err,
+			"diagnostics: failed to decode index stats of %q", coll.Name())
+	}
+	ret.Indexes = analyzeIndexes(idxStats, requireTenantPrefix)
+
+	cur, err = coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.D{
+			{Key: "storageStats", Value: bson.D{}},
+		}}},
+	})
+	if err != nil {
+		return ret, errors.Wrapf(err,
+			"diagnostics: failed to get stats of %q", coll.Name())
+	}
+	var stats []collStats
+	if err = cur.All(ctx, &stats); err != nil {
+		return ret, errors.Wrapf(err,
+			"diagnostics: failed to decode stats of %q", coll.Name())
+	}
+	for _, s := range stats {
+		ret.Count += s.StorageStats.Count
+		ret.Size += s.StorageStats.Size
+		ret.StorageSize += s.StorageStats.StorageSize
+		ret.TotalIndexSize += s.StorageStats.TotalIndexSize
+	}
+	return ret, nil
+}
+
+// Collect runs $indexStats and $collStats on the collections of the
+// database.
+func Collect(ctx context.Context, db *mongo.Database, opts ...*Options) (*Report, error) {
+	var (
+		collections         []string
+		requireTenantPrefix bool
+	)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Collections != nil {
+			collections = opt.Collections
+		}
+		if opt.RequireTenantPrefix != nil {
+			requireTenantPrefix = *opt.RequireTenantPrefix
+		}
+	}
+	if collections == nil {
+		names, err := db.ListCollectionNames(ctx, bson.D{
+			{Key: "type", Value: "collection"},
+			{Key: "name", Value: bson.D{{Key: "$not", Value: bson.D{
+				{Key: "$regex", Value: "^system\\."},
+			}}}},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "diagnostics: failed to list collections")
+		}
+		sort.Strings(names)
+		collections = names
+	}
+	report := &Report{
+		Database:    db.Name(),
+		Collections: make([]CollectionStats, 0, len(collections)),
+	}
+	for _, name := range collections {
+		stats, err := collectCollection(ctx, db.Collection(name), requireTenantPrefix)
+		if err != nil {
+			return report, err
+		}
+		report.Collections = append(report.Collections, stats)
+	}
+	return report, nil
+}
+
+// Log writes the report to the logger: an info entry per collection and a
+// warning per flagged index.
+func (r *Report) Log(l *log.Logger) {
+	for _, coll := range r.Collections {
+		l.F(log.Ctx{
+			"collection":       coll.Name,
+			"count":            coll.Count,
+			"size":             coll.Size,
+			"storage_size":     coll.StorageSize,
+			"total_index_size": coll.TotalIndexSize,
+		}).Infof("diagnostics: collection %s.%s", r.Database, coll.Name)
+		for _, idx := range coll.Indexes {
+			for _, warning := range idx.Warnings {
+				l.F(log.Ctx{
+					"collection": coll.Name,
+					"index":      idx.Name,
+					"ops":        idx.Ops,
+				}).Warnf("diagnostics: %s", warning)
+			}
+		}
+	}
+}
+
+// Handler serves the report of the database as JSON, e.g. on an internal
+// endpoint.
+func Handler(db *mongo.Database, opts ...*Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := Collect(c.Request.Context(), db, opts...)
+		if err != nil {
+			rest.RenderError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package diagnostics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func newIndexStats(name string, key bson.D, ops int64, since time.Time) indexStats {
+	s := indexStats{Name: name, Key: IndexKey(key)}
+	s.Accesses.Ops = ops
+	s.Accesses.Since = since
+	return s
+}
+
+func TestAnalyzeIndexes(t *testing.T) {
+	t.Parallel()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	tenantKey := bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}}
+	stats := []indexStats{
+		newIndexStats("_id_", bson.D{{Key: "_id", Value: 1}}, 0, t0),
+		newIndexStats("name", bson.D{{Key: "name", Value: 1}}, 0, t1),
+		newIndexStats("tenant_name", tenantKey, 5, t1),
+		// Second shard
+		newIndexStats("tenant_name", tenantKey, 2, t0),
+	}
+
+	indexes := analyzeIndexes(stats, true)
+	require.Len(t, indexes, 3)
+	assert.Equal(t, "_id_", indexes[0].Name)
+	assert.Empty(t, indexes[0].Warnings)
+	assert.Equal(t, []string{WarningUnusedIndex, WarningMissingTenantPrefix},
+		indexes[1].Warnings)
+	assert.Equal(t, int64(7), indexes[2].Ops)
+	assert.Equal(t, t0, indexes[2].Since)
+	assert.Empty(t, indexes[2].Warnings)
+
+	indexes = analyzeIndexes(stats, false)
+	assert.Equal(t, []string{WarningUnusedIndex}, indexes[1].Warnings)
+
+	report := &Report{Collections: []CollectionStats{{Indexes: indexes}}}
+	assert.Equal(t, 1, report.Warnings())
+
+	b, err := json.Marshal(IndexKey(tenantKey))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"tenant_id":1,"name":1}`, string(b))
+}
+
+func TestCollect(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "diagnostics")
+		ctx := context.Background()
+		coll := db.Collection("devices")
+		_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "name", Value: 1}},
+		})
+		require.NoError(t, err)
+		_, err = coll.InsertOne(ctx, bson.D{{Key: "name", Value: "foo"}})
+		require.NoError(t, err)
+
+		report, err := Collect(ctx, db.Database, NewOptions().SetRequireTenantPrefix(true))
+		require.NoError(t, err)
+		require.Len(t, report.Collections, 1)
+		assert.Equal(t, int64(1), report.Collections[0].Count)
+		assert.Len(t, report.Collections[0].Indexes, 2)
+		assert.Equal(t, 2, report.Warnings())
+
+		router := gin.New()
+		router.GET("/diagnostics", Handler(db.Database))
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/diagnostics", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"key":{"name":1}`)
+		return 0
+	}, nil)
+}
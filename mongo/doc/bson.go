@@ -15,6 +15,7 @@
 package doc
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 
@@ -80,17 +81,60 @@ func DocumentFromStruct(
 	return doc
 }
 
+const maxDereference = 4
+
 func dereferenceValue(val reflect.Value) reflect.Value {
-	const maxDereference = 4
+	val, _ = dereferenceRef(val)
+	return val
+}
+
+// dereferenceRef dereferences val like dereferenceValue and returns the
+// address of the last non-nil pointer on the way, or 0.
+func dereferenceRef(val reflect.Value) (reflect.Value, uintptr) {
+	var ptr uintptr
 	for i := 0; i < maxDereference; i++ {
 		switch val.Kind() {
 		case reflect.Ptr:
+			if !val.IsNil() {
+				ptr = val.Pointer()
+			}
 			val = val.Elem()
 		case reflect.Interface:
 			val = val.Elem()
 		}
 	}
-	return val
+	return val, ptr
+}
+
+// DefaultFlattenMaxDepth is the default maximum nesting depth of the
+// documents accepted by FlattenDocument. It matches the maximum nesting
+// depth of documents supported by MongoDB.
+const DefaultFlattenMaxDepth = 100
+
+var (
+	// ErrMaxDepthExceeded is returned (wrapped in a FlattenError) by
+	// FlattenDocument if the document is nested deeper than the maximum
+	// depth.
+	ErrMaxDepthExceeded = errors.New("maximum nesting depth exceeded")
+	// ErrCyclicReference is returned (wrapped in a FlattenError) by
+	// FlattenDocument if the document contains itself.
+	ErrCyclicReference = errors.New("cyclic reference")
+)
+
+// FlattenError is returned by FlattenDocument if the document cannot be
+// flattened.
+type FlattenError struct {
+	// Key is the (flattened) key of the offending value.
+	Key string
+	Err error
+}
+
+func (err *FlattenError) Error() string {
+	return fmt.Sprintf("failed to flatten document at key %q: %s", err.Key, err.Err)
+}
+
+func (err *FlattenError) Unwrap() error {
+	return err.Err
 }
 
 type FlattenOptions struct {
@@ -99,6 +143,16 @@ type FlattenOptions struct {
 	// otherwise be added to the document. This can be useful for
 	// transforming query containing arrays to add an $in operator.
 	Transform func(key string, elem interface{}) (string, interface{})
+	// MaxDepth is the maximum nesting depth of the document, the
+	// default is DefaultFlattenMaxDepth.
+	MaxDepth int
+	// Sanitize validates the map keys (struct fields are trusted) and
+	// the keys inside the values of the document with ValidateKey and
+	// ValidateValue respectively. Use it when the document contains
+	// user supplied keys.
+	Sanitize bool
+	// AllowedKeys are the keys passing validation regardless.
+	AllowedKeys []string
 }
 
 func NewFlattenOptions() *FlattenOptions {
@@ -112,8 +166,23 @@ func (opts *FlattenOptions) SetTransform(
 	return opts
 }
 
+func (opts *FlattenOptions) SetMaxDepth(depth int) *FlattenOptions {
+	opts.MaxDepth = depth
+	return opts
+}
+
+// SetSanitize enables the validation of the user supplied keys, allowing
+// the given keys regardless.
+func (opts *FlattenOptions) SetSanitize(sanitize bool, allow ...string) *FlattenOptions {
+	opts.Sanitize = sanitize
+	opts.AllowedKeys = allow
+	return opts
+}
+
 func mergeFlattenOptions(opts []*FlattenOptions) *FlattenOptions {
-	var ret = &FlattenOptions{}
+	var ret = &FlattenOptions{
+		MaxDepth: DefaultFlattenMaxDepth,
+	}
 	for _, opt := range opts {
 		if opt == nil {
 			continue
@@ -121,6 +190,13 @@ func mergeFlattenOptions(opts []*FlattenOptions) *FlattenOptions {
 		if opt.Transform != nil {
 			ret.Transform = opt.Transform
 		}
+		if opt.MaxDepth > 0 {
+			ret.MaxDepth = opt.MaxDepth
+		}
+		if opt.Sanitize {
+			ret.Sanitize = true
+			ret.AllowedKeys = append(ret.AllowedKeys, opt.AllowedKeys...)
+		}
 	}
 	return ret
 }
@@ -144,6 +220,12 @@ func mergeFlattenOptions(opts []*FlattenOptions) *FlattenOptions {
 //	bson.D{
 //	  {Key: "bar.baz", Value: "foo"}
 //	}
+//
+// Documents nested deeper than the maximum depth or containing themselves
+// are rejected with a *FlattenError wrapping ErrMaxDepthExceeded or
+// ErrCyclicReference respectively. With the Sanitize option, keys that
+// could inject operators or paths are rejected with a *FlattenError
+// wrapping ErrOperatorKey, ErrDottedKey or ErrEmptyKey.
 func FlattenDocument(
 	mapping interface{}, options ...*FlattenOptions,
 ) (doc bson.D, err error) {
@@ -162,14 +244,11 @@ func FlattenDocument(
 	}()
 	opts := mergeFlattenOptions(options)
 
-	s := reflect.ValueOf(mapping)
-	s = dereferenceValue(s)
+	s, ptr := dereferenceRef(reflect.ValueOf(mapping))
 
 	switch s.Kind() {
-	case reflect.Struct:
-		return flattenStruct(s, "", opts), nil
-	case reflect.Map:
-		return flattenMap(s, "", opts), nil
+	case reflect.Struct, reflect.Map:
+		return flatten(s, ptr, opts)
 	}
 	return nil, errors.Errorf(
 		"[programming error] invalid argument type %s, "+
@@ -178,6 +257,155 @@ func FlattenDocument(
 	)
 }
 
+// flattenRef identifies a struct or map for detecting cycles.
+type flattenRef struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func newFlattenRef(val reflect.Value, ptr uintptr) flattenRef {
+	if val.Kind() == reflect.Map {
+		ptr = val.Pointer()
+	}
+	if ptr == 0 {
+		// Not addressable, thus cannot refer to itself.
+		return flattenRef{}
+	}
+	return flattenRef{ptr: ptr, typ: val.Type()}
+}
+
+// flattenFrame is the iteration state of a struct or map on the stack of
+// flatten.
+type flattenFrame struct {
+	value  reflect.Value
+	prefix string
+	depth  int
+	ref    flattenRef
+
+	keys []reflect.Value
+	next int
+}
+
+func newFlattenFrame(
+	val reflect.Value, ptr uintptr, prefix string, depth int,
+) *flattenFrame {
+	frame := &flattenFrame{
+		value:  val,
+		prefix: prefix,
+		depth:  depth,
+		ref:    newFlattenRef(val, ptr),
+	}
+	if val.Kind() == reflect.Map {
+		frame.keys = val.MapKeys()
+	}
+	return frame
+}
+
+func (frame *flattenFrame) key(name string) string {
+	if frame.prefix == "" {
+		return name
+	}
+	return frame.prefix + "." + name
+}
+
+// validate validates the user supplied key (of a map) and value of the
+// field.
+func (frame *flattenFrame) validate(key string, face interface{}, allow []string) error {
+	if frame.value.Kind() == reflect.Map {
+		name := key
+		if frame.prefix != "" {
+			name = key[len(frame.prefix)+1:]
+		}
+		if err := validateKey(name, allow); err != nil {
+			return &FlattenError{Key: key, Err: err}
+		}
+	}
+	if face != nil {
+		var keyErr *KeyError
+		if errors.As(ValidateValue(face, allow...), &keyErr) {
+			return &FlattenError{Key: joinKey(key, keyErr.Key), Err: keyErr.Err}
+		}
+	}
+	return nil
+}
+
+// nextField returns the next (flattened) key and the dereferenced value of
+// the frame. The returned interface is the value of struct fields; ok is
+// false when the frame is exhausted.
+func (frame *flattenFrame) nextField() (
+	key string, val reflect.Value, ptr uintptr, face interface{}, ok bool,
+) {
+	if frame.value.Kind() == reflect.Map {
+		if frame.next >= len(frame.keys) {
+			return "", reflect.Value{}, 0, nil, false
+		}
+		rKey := frame.keys[frame.next]
+		frame.next++
+		// NOTE: Will panic if map keys are not string!
+		val, ptr = dereferenceRef(frame.value.MapIndex(rKey))
+		if val.Kind() != reflect.Struct && val.Kind() != reflect.Map {
+			face = val.Interface()
+		}
+		return frame.key(rKey.String()), val, ptr, face, true
+	}
+	sType := frame.value.Type()
+	for frame.next < sType.NumField() {
+		i := frame.next
+		frame.next++
+		val, ptr = dereferenceRef(frame.value.Field(i))
+		fieldName, face, set := valueFromStructField(sType.Field(i), val)
+		if set {
+			return frame.key(fieldName), val, ptr, face, true
+		}
+	}
+	return "", reflect.Value{}, 0, nil, false
+}
+
+// flatten expands the struct or map depth first using an explicit stack
+// such that adversarial input cannot exhaust the goroutine stack.
+func flatten(
+	root reflect.Value, ptr uintptr, options *FlattenOptions,
+) (bson.D, error) {
+	doc := bson.D{}
+	active := make(map[flattenRef]struct{})
+	stack := []*flattenFrame{newFlattenFrame(root, ptr, "", 0)}
+	active[stack[0].ref] = struct{}{}
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		key, val, ptr, face, ok := frame.nextField()
+		if !ok {
+			delete(active, frame.ref)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if options.Sanitize {
+			if err := frame.validate(key, face, options.AllowedKeys); err != nil {
+				return nil, err
+			}
+		}
+		switch val.Kind() {
+		case reflect.Struct, reflect.Map:
+			if frame.depth >= options.MaxDepth {
+				return nil, &FlattenError{Key: key, Err: ErrMaxDepthExceeded}
+			}
+			child := newFlattenFrame(val, ptr, key, frame.depth+1)
+			if child.ref.ptr != 0 {
+				if _, cyclic := active[child.ref]; cyclic {
+					return nil, &FlattenError{Key: key, Err: ErrCyclicReference}
+				}
+				active[child.ref] = struct{}{}
+			}
+			stack = append(stack, child)
+		default:
+			if options.Transform != nil {
+				key, face = options.Transform(key, face)
+			}
+			doc = append(doc, bson.E{Key: key, Value: face})
+		}
+	}
+	return doc, nil
+}
+
 func valueFromStructField(
 	key reflect.StructField,
 	value reflect.Value,
@@ -202,82 +430,3 @@ func valueFromStructField(
 	}
 	return name, value.Interface(), true
 }
-
-func flattenStruct(
-	sct reflect.Value,
-	prefix string,
-	options *FlattenOptions,
-) (doc bson.D) {
-	doc = bson.D{}
-	sType := sct.Type()
-	numSFields := sct.NumField()
-	for i := 0; i < numSFields; i++ {
-		sVal := sct.Field(i)
-		sKey := sType.Field(i)
-
-		sVal = dereferenceValue(sVal)
-		fieldName, val, set := valueFromStructField(sKey, sVal)
-		if !set {
-			continue
-		}
-		if len(prefix) > 0 {
-			fieldName = prefix + "." + fieldName
-		}
-		switch sVal.Kind() {
-		case reflect.Struct:
-			ret := flattenStruct(sVal, fieldName, options)
-			if ret != nil {
-				doc = append(doc, ret...)
-			}
-		case reflect.Map:
-			ret := flattenMap(sVal, fieldName, options)
-			if ret != nil {
-				doc = append(doc, ret...)
-			}
-		default:
-			if options.Transform != nil {
-				fieldName, val = options.Transform(fieldName, val)
-			}
-			doc = append(doc, bson.E{
-				Key:   fieldName,
-				Value: val,
-			})
-		}
-	}
-	return doc
-}
-
-func flattenMap(
-	m reflect.Value, prefix string, options *FlattenOptions,
-) (doc bson.D) {
-	rKeys := m.MapKeys()
-	for _, rKey := range rKeys {
-		// NOTE: Will panic if map keys are not string!
-		key := rKey.String()
-		fieldName := key
-		if prefix != "" {
-			fieldName = prefix + "." + fieldName
-		}
-		rVal := m.MapIndex(rKey)
-		rVal = dereferenceValue(rVal)
-		switch rVal.Kind() {
-		case reflect.Struct:
-			ret := flattenStruct(rVal, fieldName, options)
-			if ret != nil {
-				doc = append(ret, doc...)
-			}
-		case reflect.Map:
-			ret := flattenMap(rVal, fieldName, options)
-			if ret != nil {
-				doc = append(ret, doc...)
-			}
-		default:
-			val := rVal.Interface()
-			if options.Transform != nil {
-				fieldName, val = options.Transform(fieldName, val)
-			}
-			doc = append(doc, bson.E{Key: fieldName, Value: val})
-		}
-	}
-	return doc
-}
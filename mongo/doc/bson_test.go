@@ -15,6 +15,7 @@
 package doc
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
@@ -325,3 +326,95 @@ func TestFlattenDocument(t *testing.T) {
 		})
 	}
 }
+
+type cyclicStruct struct {
+	Name string        `bson:"name"`
+	Next *cyclicStruct `bson:"next,omitempty"`
+}
+
+func TestFlattenDocumentLimits(t *testing.T) {
+	t.Parallel()
+
+	deep := map[string]interface{}{"leaf": true}
+	for i := 0; i < 10; i++ {
+		deep = map[string]interface{}{"a": deep}
+	}
+	_, err := FlattenDocument(deep, NewFlattenOptions().SetMaxDepth(10))
+	assert.NoError(t, err)
+	_, err = FlattenDocument(deep, NewFlattenOptions().SetMaxDepth(9))
+	var flatErr *FlattenError
+	if assert.ErrorAs(t, err, &flatErr) {
+		assert.ErrorIs(t, err, ErrMaxDepthExceeded)
+		assert.Equal(t, "a.a.a.a.a.a.a.a.a.a", flatErr.Key)
+	}
+
+	// Deeply nested document exceeding the default limit.
+	for i := 0; i < 2000; i++ {
+		deep = map[string]interface{}{"a": deep}
+	}
+	_, err = FlattenDocument(deep)
+	assert.ErrorIs(t, err, ErrMaxDepthExceeded)
+	doc, err := FlattenDocument(deep, NewFlattenOptions().SetMaxDepth(4096))
+	if assert.NoError(t, err) && assert.Len(t, doc, 1) {
+		assert.Equal(t, true, doc[0].Value)
+	}
+
+	self := map[string]interface{}{"key": "value"}
+	self["self"] = self
+	_, err = FlattenDocument(self)
+	if assert.ErrorAs(t, err, &flatErr) {
+		assert.ErrorIs(t, err, ErrCyclicReference)
+		assert.Equal(t, "self", flatErr.Key)
+	}
+
+	loop := &cyclicStruct{Name: "first", Next: &cyclicStruct{Name: "second"}}
+	loop.Next.Next = loop
+	_, err = FlattenDocument(loop)
+	assert.ErrorIs(t, err, ErrCyclicReference)
+
+	// The same value referenced twice without a cycle is fine.
+	shared := map[string]interface{}{"key": "value"}
+	doc, err = FlattenDocument(map[string]interface{}{
+		"a": shared,
+		"b": shared,
+	})
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, bson.D{
+			{Key: "a.key", Value: "value"},
+			{Key: "b.key", Value: "value"},
+		}, doc)
+	}
+}
+
+func FuzzFlattenDocument(f *testing.F) {
+	f.Add([]byte(`{"key": "value"}`), 4)
+	f.Add([]byte(`{"a": {"b": {"c": [1, 2, {"d": 3}]}}}`), 2)
+	f.Add([]byte(`{"a": {"a": {"a": {"a": {"a": {}}}}}}`), 3)
+	f.Add([]byte(`{"": {"": ""}, ".": {".": "."}}`), 1)
+	f.Add([]byte(`{"null": null}`), 8)
+	f.Fuzz(func(t *testing.T, data []byte, maxDepth int) {
+		var input map[string]interface{}
+		if json.Unmarshal(data, &input) != nil {
+			return
+		}
+		if maxDepth <= 0 || maxDepth > DefaultFlattenMaxDepth {
+			maxDepth = DefaultFlattenMaxDepth
+		}
+		// Tie the knot to make sure cycles never loop forever.
+		if len(input)%2 == 1 {
+			input["$self"] = input
+		}
+		doc, err := FlattenDocument(input,
+			NewFlattenOptions().SetMaxDepth(maxDepth))
+		if err != nil {
+			assert.Nil(t, doc)
+			return
+		}
+		for _, elem := range doc {
+			switch elem.Value.(type) {
+			case map[string]interface{}:
+				t.Errorf("unexpected map value for key %q", elem.Key)
+			}
+		}
+	})
+}
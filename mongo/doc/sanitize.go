@@ -0,0 +1,150 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package doc
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// ErrOperatorKey is returned for user supplied keys starting with
+	// '$', which MongoDB interprets as operators.
+	ErrOperatorKey = errors.New("key must not start with '$'")
+	// ErrDottedKey is returned for user supplied keys containing '.',
+	// which MongoDB interprets as paths into embedded documents.
+	ErrDottedKey = errors.New("key must not contain '.'")
+	// ErrEmptyKey is returned for empty user supplied keys.
+	ErrEmptyKey = errors.New("key must not be empty")
+)
+
+// KeyError is returned by ValidateKey and ValidateValue for keys that
+// could be used for injecting query operators or paths.
+type KeyError struct {
+	// Key is the path of the offending key.
+	Key string
+	Err error
+}
+
+func (err *KeyError) Error() string {
+	return "invalid key " + strconv.Quote(err.Key) + ": " + err.Err.Error()
+}
+
+func (err *KeyError) Unwrap() error {
+	return err.Err
+}
+
+func isAllowed(key string, allow []string) bool {
+	for _, a := range allow {
+		if key == a {
+			return true
+		}
+	}
+	return false
+}
+
+func validateKey(key string, allow []string) error {
+	if isAllowed(key, allow) {
+		return nil
+	} else if key == "" {
+		return ErrEmptyKey
+	} else if key[0] == '$' {
+		return ErrOperatorKey
+	} else if strings.ContainsRune(key, '.') {
+		return ErrDottedKey
+	}
+	return nil
+}
+
+// ValidateKey validates a user supplied field name used in a query: it
+// must not be empty, start with '$' or contain dots unless it is one of
+// the allowed keys.
+func ValidateKey(key string, allow ...string) error {
+	if err := validateKey(key, allow); err != nil {
+		return &KeyError{Key: key, Err: err}
+	}
+	return nil
+}
+
+var elemType = reflect.TypeOf(bson.E{})
+
+// ValidateValue validates the keys of the maps, bson.D and bson.E
+// (recursively, also inside arrays) in a user supplied value with
+// ValidateKey, such that a decoded value like {"$ne": null} cannot be
+// used as an operator. Structs other than bson.E are not inspected since
+// their keys are not user supplied.
+func ValidateValue(value interface{}, allow ...string) error {
+	return validateValue(reflect.ValueOf(value), "", allow, 0)
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func validateValue(val reflect.Value, path string, allow []string, depth int) error {
+	val = dereferenceValue(val)
+	if depth > DefaultFlattenMaxDepth {
+		return &KeyError{Key: path, Err: ErrMaxDepthExceeded}
+	}
+	switch val.Kind() {
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		iter := val.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if err := validateKey(key, allow); err != nil {
+				return &KeyError{Key: joinKey(path, key), Err: err}
+			}
+			err := validateValue(iter.Value(), joinKey(path, key), allow, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			// Binary data
+			return nil
+		}
+		for i := 0; i < val.Len(); i++ {
+			elem := val.Index(i)
+			elemPath := path
+			if elem.Type() != elemType {
+				elemPath = joinKey(path, strconv.Itoa(i))
+			}
+			if err := validateValue(elem, elemPath, allow, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if val.Type() != elemType {
+			return nil
+		}
+		e := val.Interface().(bson.E)
+		if err := validateKey(e.Key, allow); err != nil {
+			return &KeyError{Key: joinKey(path, e.Key), Err: err}
+		}
+		return validateValue(reflect.ValueOf(e.Value), joinKey(path, e.Key), allow, depth+1)
+	}
+	return nil
+}
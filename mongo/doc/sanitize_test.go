@@ -0,0 +1,187 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package doc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateKey(t *testing.T) {
+	assert.NoError(t, ValidateKey("name"))
+	assert.ErrorIs(t, ValidateKey("$where"), ErrOperatorKey)
+	assert.ErrorIs(t, ValidateKey("attributes.name"), ErrDottedKey)
+	assert.ErrorIs(t, ValidateKey(""), ErrEmptyKey)
+	assert.NoError(t, ValidateKey("attributes.name", "attributes.name"))
+	assert.EqualError(t, ValidateKey("$ne"),
+		`invalid key "$ne": key must not start with '$'`)
+}
+
+func TestValidateValue(t *testing.T) {
+	testCases := []struct {
+		Name  string
+		Value interface{}
+		Allow []string
+
+		Key   string
+		Error error
+	}{{
+		Name:  "scalar",
+		Value: "$ne",
+	}, {
+		Name:  "binary",
+		Value: []byte("$ne"),
+	}, {
+		Name: "nested map",
+		Value: map[string]interface{}{
+			"name": map[string]interface{}{"$ne": nil},
+		},
+		Key:   "name.$ne",
+		Error: ErrOperatorKey,
+	}, {
+		Name: "allowed",
+		Value: map[string]interface{}{
+			"name": map[string]interface{}{"$ne": nil},
+		},
+		Allow: []string{"$ne"},
+	}, {
+		Name:  "array",
+		Value: []interface{}{"foo", bson.M{"a.b": 1}},
+		Key:   "1.a.b",
+		Error: ErrDottedKey,
+	}, {
+		Name:  "document",
+		Value: bson.D{{Key: "foo", Value: bson.A{bson.D{{Key: "$gt", Value: 1}}}}},
+		Key:   "foo.0.$gt",
+		Error: ErrOperatorKey,
+	}, {
+		Name: "struct",
+		Value: struct {
+			Foo string `bson:"$foo"`
+		}{},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			err := ValidateValue(tc.Value, tc.Allow...)
+			if tc.Error == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var keyErr *KeyError
+			if assert.ErrorAs(t, err, &keyErr) {
+				assert.Equal(t, tc.Key, keyErr.Key)
+				assert.ErrorIs(t, err, tc.Error)
+			}
+		})
+	}
+}
+
+func TestFlattenDocumentSanitize(t *testing.T) {
+	type filter struct {
+		Status     string                 `bson:"status,omitempty"`
+		Attributes map[string]interface{} `bson:"attributes,omitempty"`
+	}
+	testCases := []struct {
+		Name    string
+		Filter  filter
+		Options *FlattenOptions
+
+		Expected bson.D
+		Key      string
+		Error    error
+	}{{
+		Name: "ok",
+		Filter: filter{
+			Status:     "accepted",
+			Attributes: map[string]interface{}{"name": "foo"},
+		},
+		Options: NewFlattenOptions().SetSanitize(true),
+
+		Expected: bson.D{
+			{Key: "status", Value: "accepted"},
+			{Key: "attributes.name", Value: "foo"},
+		},
+	}, {
+		Name: "operator key",
+		Filter: filter{
+			Attributes: map[string]interface{}{"$where": "sleep(1000)"},
+		},
+		Options: NewFlattenOptions().SetSanitize(true),
+
+		Key:   "attributes.$where",
+		Error: ErrOperatorKey,
+	}, {
+		Name: "dotted key",
+		Filter: filter{
+			Attributes: map[string]interface{}{"name.first": "foo"},
+		},
+		Options: NewFlattenOptions().SetSanitize(true),
+
+		Key:   "attributes.name.first",
+		Error: ErrDottedKey,
+	}, {
+		Name: "operator value",
+		Filter: filter{
+			Attributes: map[string]interface{}{
+				"name": bson.D{{Key: "$ne", Value: nil}},
+			},
+		},
+		Options: NewFlattenOptions().SetSanitize(true),
+
+		Key:   "attributes.name.$ne",
+		Error: ErrOperatorKey,
+	}, {
+		Name: "operator value allowed",
+		Filter: filter{
+			Attributes: map[string]interface{}{
+				"name": bson.D{{Key: "$in", Value: bson.A{"foo", "bar"}}},
+			},
+		},
+		Options: NewFlattenOptions().SetSanitize(true, "$in"),
+
+		Expected: bson.D{
+			{Key: "attributes.name", Value: bson.D{
+				{Key: "$in", Value: bson.A{"foo", "bar"}},
+			}},
+		},
+	}, {
+		Name: "not sanitized",
+		Filter: filter{
+			Attributes: map[string]interface{}{"$where": "sleep(1000)"},
+		},
+
+		Expected: bson.D{{Key: "attributes.$where", Value: "sleep(1000)"}},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			doc, err := FlattenDocument(tc.Filter, tc.Options)
+			if tc.Error == nil {
+				if assert.NoError(t, err) {
+					assert.Equal(t, tc.Expected, doc)
+				}
+				return
+			}
+			var flatErr *FlattenError
+			if assert.ErrorAs(t, err, &flatErr) {
+				assert.Equal(t, tc.Key, flatErr.Key)
+				assert.ErrorIs(t, err, tc.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package schema declares the $jsonSchema validators of collections in
+// code and applies them idempotently at startup.
+package schema
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// ValidationLevel determines which writes are validated.
+type ValidationLevel string
+
+const (
+	// LevelStrict validates all inserts and updates.
+	LevelStrict ValidationLevel = "strict"
+	// LevelModerate only validates updates of documents which are already
+	// valid.
+	LevelModerate ValidationLevel = "moderate"
+	// LevelOff disables validation.
+	LevelOff ValidationLevel = "off"
+)
+
+// ValidationAction determines what happens to invalid writes.
+type ValidationAction string
+
+const (
+	// ActionError rejects invalid writes.
+	ActionError ValidationAction = "error"
+	// ActionWarn accepts invalid writes but logs them on the server.
+	ActionWarn ValidationAction = "warn"
+)
+
+const (
+	DefaultLevel  = LevelStrict
+	DefaultAction = ActionError
+
+	// DefaultSampleSize is the default number of document IDs included
+	// in a Violations report.
+	DefaultSampleSize = 10
+)
+
+// Validator is the $jsonSchema validator of a collection.
+type Validator struct {
+	// Collection is the name of the validated collection.
+	Collection string
+	// Schema is the JSON schema, e.g.
+	//
+	//	bson.D{
+	//		{Key: "bsonType", Value: "object"},
+	//		{Key: "required", Value: bson.A{"tenant_id"}},
+	//	}
+	Schema bson.D
+	// Level defaults to DefaultLevel.
+	Level ValidationLevel
+	// Action defaults to DefaultAction.
+	Action ValidationAction
+}
+
+func (v Validator) level() ValidationLevel {
+	if v.Level == "" {
+		return DefaultLevel
+	}
+	return v.Level
+}
+
+func (v Validator) action() ValidationAction {
+	if v.Action == "" {
+		return DefaultAction
+	}
+	return v.Action
+}
+
+func (v Validator) validator() bson.D {
+	return bson.D{{Key: "$jsonSchema", Value: v.Schema}}
+}
+
+func (v Validator) collMod() bson.D {
+	return bson.D{
+		{Key: "collMod", Value: v.Collection},
+		{Key: "validator", Value: v.validator()},
+		{Key: "validationLevel", Value: string(v.level())},
+		{Key: "validationAction", Value: string(v.action())},
+	}
+}
+
+// collectionOptions are the validation options returned by listCollections.
+type collectionOptions struct {
+	Validator        bson.Raw         `bson:"validator"`
+	ValidationLevel  ValidationLevel  `bson:"validationLevel"`
+	ValidationAction ValidationAction `bson:"validationAction"`
+}
+
+// upToDate returns true if the collection options match the validator.
+func (v Validator) upToDate(current collectionOptions) (bool, error) {
+	if current.ValidationLevel != v.level() ||
+		current.ValidationAction != v.action() {
+		return false, nil
+	}
+	b, err := bson.Marshal(v.validator())
+	if err != nil {
+		return false, errors.Wrapf(err,
+			"schema: failed to encode the validator of %q", v.Collection)
+	}
+	return bytes.Equal(b, current.Validator), nil
+}
+
+func listOptions(ctx context.Context, db *mongo.Database) (map[string]collectionOptions, error) {
+	cur, err := db.ListCollections(ctx, bson.D{{Key: "type", Value: "collection"}})
+	if err != nil {
+		return nil, errors.Wrap(err, "schema: failed to list collections")
+	}
+	var colls []struct {
+		Name    string            `bson:"name"`
+		Options collectionOptions `bson:"options"`
+	}
+	if err = cur.All(ctx, &colls); err != nil {
+		return nil, errors.Wrap(err, "schema: failed to decode collections")
+	}
+	ret := make(map[string]collectionOptions, len(colls))
+	for _, coll := range colls {
+		ret[coll.Name] = coll.Options
+	}
+	return ret, nil
+}
+
+// Apply creates or updates (using collMod) the validators of the
+// collections. Collections whose validator is already up to date are left
+// untouched, so Apply can safely run on every startup.
+func Apply(ctx context.Context, db *mongo.Database, validators ...Validator) error {
+	current, err := listOptions(ctx, db)
+	if err != nil {
+		return err
+	}
+	l := log.FromContext(ctx)
+	for _, v := range validators {
+		opts, exists := current[v.Collection]
+		if !exists {
+			err = db.CreateCollection(ctx, v.Collection, mopts.CreateCollection().
+				SetValidator(v.validator()).
+				SetValidationLevel(string(v.level())).
+				SetValidationAction(string(v.action())))
+			if err != nil {
+				return errors.Wrapf(err,
+					"schema: failed to create collection %q", v.Collection)
+			}
+			l.Infof("schema: created collection %q with validator", v.Collection)
+			continue
+		}
+		ok, err := v.upToDate(opts)
+		if err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		err = db.RunCommand(ctx, v.collMod()).Err()
+		if err != nil {
+			return errors.Wrapf(err,
+				"schema: failed to update the validator of %q", v.Collection)
+		}
+		l.Infof("schema: updated the validator of %q", v.Collection)
+	}
+	return nil
+}
+
+// Violations reports the documents of a collection violating its schema.
+type Violations struct {
+	Collection string `json:"collection"`
+	// Count is the number of invalid documents.
+	Count int64 `json:"count"`
+	// Sample holds the _id of (up to the sample size) invalid documents.
+	Sample []interface{} `json:"sample"`
+}
+
+// FindViolations counts the documents of the collection which do not match
+// the schema of the validator and samples their IDs. sampleSize defaults to
+// DefaultSampleSize if not positive. Use it to find the documents written
+// before the validator was introduced, or with ActionWarn.
+func FindViolations(
+	ctx context.Context,
+	db *mongo.Database,
+	v Validator,
+	sampleSize int64,
+) (*Violations, error) {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	coll := db.Collection(v.Collection)
+	filter := bson.D{{Key: "$nor", Value: bson.A{v.validator()}}}
+	count, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"schema: failed to count invalid documents of %q", v.Collection)
+	}
+	ret := &Violations{
+		Collection: v.Collection,
+		Count:      count,
+		Sample:     []interface{}{},
+	}
+	if count == 0 {
+		return ret, nil
+	}
+	cur, err := coll.Find(ctx, filter, mopts.Find().
+		SetProjection(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(sampleSize))
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"schema: failed to find invalid documents of %q", v.Collection)
+	}
+	var docs []struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err = cur.All(ctx, &docs); err != nil {
+		return nil, errors.Wrapf(err,
+			"schema: failed to decode invalid documents of %q", v.Collection)
+	}
+	for _, doc := range docs {
+		ret.Sample = append(ret.Sample, doc.ID)
+	}
+	return ret, nil
+}
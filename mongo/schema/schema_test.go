@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+var testSchema = bson.D{
+	{Key: "bsonType", Value: "object"},
+	{Key: "required", Value: bson.A{"tenant_id"}},
+	{Key: "properties", Value: bson.D{
+		{Key: "tenant_id", Value: bson.D{{Key: "bsonType", Value: "string"}}},
+	}},
+}
+
+func TestUpToDate(t *testing.T) {
+	t.Parallel()
+	v := Validator{Collection: "devices", Schema: testSchema}
+	validator, err := bson.Marshal(v.validator())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Options collectionOptions
+		Result  bool
+	}{{
+		Name: "up to date",
+		Options: collectionOptions{
+			Validator:        validator,
+			ValidationLevel:  LevelStrict,
+			ValidationAction: ActionError,
+		},
+		Result: true,
+	}, {
+		Name: "no validator",
+		Options: collectionOptions{
+			ValidationLevel:  LevelStrict,
+			ValidationAction: ActionError,
+		},
+	}, {
+		Name: "different action",
+		Options: collectionOptions{
+			Validator:        validator,
+			ValidationLevel:  LevelStrict,
+			ValidationAction: ActionWarn,
+		},
+	}, {
+		Name: "different schema",
+		Options: collectionOptions{
+			Validator: func() bson.Raw {
+				b, _ := bson.Marshal(Validator{}.validator())
+				return b
+			}(),
+			ValidationLevel:  LevelStrict,
+			ValidationAction: ActionError,
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			ok, err := v.upToDate(tc.Options)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.Result, ok)
+		})
+	}
+
+	assert.Equal(t, bson.D{
+		{Key: "collMod", Value: "devices"},
+		{Key: "validator", Value: bson.D{{Key: "$jsonSchema", Value: testSchema}}},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}, Validator{
+		Collection: "devices",
+		Schema:     testSchema,
+		Level:      LevelModerate,
+	}.collMod())
+}
+
+func TestApply(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "schema")
+		ctx := context.Background()
+		_, err := db.Collection("devices").
+			InsertOne(ctx, bson.D{{Key: "_id", Value: "legacy"}})
+		require.NoError(t, err)
+
+		validators := []Validator{
+			{Collection: "devices", Schema: testSchema, Action: ActionWarn},
+			{Collection: "users", Schema: testSchema},
+		}
+		require.NoError(t, Apply(ctx, db.Database, validators...))
+		// Applying again is a no-op
+		require.NoError(t, Apply(ctx, db.Database, validators...))
+
+		_, err = db.Collection("users").InsertOne(ctx, bson.D{{Key: "name", Value: "foo"}})
+		var writeErr mongo.WriteException
+		if assert.ErrorAs(t, err, &writeErr) {
+			assert.True(t, writeErr.HasErrorCode(121)) // DocumentValidationFailure
+		}
+		_, err = db.Collection("devices").InsertOne(ctx, bson.D{{Key: "_id", Value: "new"}})
+		assert.NoError(t, err)
+
+		violations, err := FindViolations(ctx, db.Database, validators[0], 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), violations.Count)
+		assert.ElementsMatch(t, []interface{}{"legacy", "new"}, violations.Sample)
+		return 0
+	}, nil)
+}
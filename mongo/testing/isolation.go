@@ -0,0 +1,113 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package testing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const (
+	// maxDatabasePrefixLen keeps the unique database names (and the
+	// tenant databases derived from them) well below MongoDB's limit
+	// of 64 bytes.
+	maxDatabasePrefixLen = 24
+	databaseSuffixLen    = 8
+)
+
+// Database is a uniquely named database owned by a single test.
+type Database struct {
+	*mongo.Database
+
+	ctx context.Context
+}
+
+// UniqueDatabaseName returns prefix followed by an underscore and a random
+// suffix. The prefix is truncated to keep the name short.
+func UniqueDatabaseName(prefix string) string {
+	if len(prefix) > maxDatabasePrefixLen {
+		prefix = prefix[:maxDatabasePrefixLen]
+	}
+	suffix := make([]byte, databaseSuffixLen/2)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(err)
+	}
+	return prefix + "_" + hex.EncodeToString(suffix)
+}
+
+// NewDatabase creates a uniquely named database for the test t, such that
+// parallel tests using the same runner do not interfere. The database, and
+// all tenant databases derived from its name ("<name>-<tenant>"), are
+// dropped when the test completes.
+func NewDatabase(t testing.TB, runner TestDBRunner, prefix string) *Database {
+	t.Helper()
+	name := UniqueDatabaseName(prefix)
+	ctx, cancel := context.WithCancel(runner.CTX())
+	db := &Database{
+		Database: runner.Client().Database(name),
+		ctx:      ctx,
+	}
+	t.Cleanup(func() {
+		cancel()
+		if err := dropDatabases(runner.Client(), name); err != nil {
+			t.Errorf("failed to drop test database %q: %s", name, err)
+		}
+	})
+	return db
+}
+
+func dropDatabases(client *mongo.Client, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	names, err := client.ListDatabaseNames(ctx, bson.D{{
+		Key: "name", Value: bson.D{{
+			Key:   "$regex",
+			Value: "^" + regexp.QuoteMeta(name) + "(-|$)",
+		}},
+	}})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := client.Database(name).Drop(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Context returns a context for calling the store under test which is
+// cancelled when the test completes. If tenantID is not empty, the context
+// carries an identity with the tenant, so that the tenant-aware store
+// helpers (store.DbFromContext, store/v2.WithTenantID) resolve to the
+// tenant's data.
+func (db *Database) Context(tenantID string) context.Context {
+	if tenantID == "" {
+		return db.ctx
+	}
+	return identity.WithContext(db.ctx, &identity.Identity{
+		Subject: "test",
+		Tenant:  tenantID,
+	})
+}
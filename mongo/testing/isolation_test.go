@@ -0,0 +1,77 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package testing
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/store"
+)
+
+func TestUniqueDatabaseName(t *testing.T) {
+	t.Parallel()
+	name := UniqueDatabaseName("deviceauth")
+	assert.Regexp(t, "^deviceauth_[0-9a-f]{8}$", name)
+	assert.NotEqual(t, name, UniqueDatabaseName("deviceauth"))
+
+	name = UniqueDatabaseName(strings.Repeat("x", 100))
+	assert.Len(t, name, maxDatabasePrefixLen+1+databaseSuffixLen)
+}
+
+func TestNewDatabase(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+
+	_ = WithDB(func(runner TestDBRunner) int {
+		names := make([]string, 2)
+		t.Run("isolated", func(t *testing.T) {
+			for i, tenant := range []string{"", "tenant1"} {
+				i, tenant := i, tenant
+				t.Run("tenant="+tenant, func(t *testing.T) {
+					t.Parallel()
+					db := NewDatabase(t, runner, "isolation")
+					ctx := db.Context(tenant)
+					if tenant != "" {
+						assert.Equal(t, tenant, identity.FromContext(ctx).Tenant)
+					}
+
+					dbName := store.DbFromContext(ctx, db.Name())
+					_, err := runner.Client().Database(dbName).
+						Collection("test").
+						InsertOne(ctx, bson.M{"foo": "bar"})
+					assert.NoError(t, err)
+					names[i] = db.Name()
+				})
+			}
+		})
+		// All databases are dropped when the subtests complete.
+		existing, err := runner.Client().ListDatabaseNames(runner.CTX(), bson.D{})
+		if assert.NoError(t, err) {
+			for _, name := range names {
+				for _, dbName := range existing {
+					assert.False(t, strings.HasPrefix(dbName, name))
+				}
+			}
+		}
+		return 0
+	}, nil)
+}
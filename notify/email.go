@@ -0,0 +1,85 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"net/mail"
+
+	"github.com/pkg/errors"
+)
+
+// EmailMessage is the email passed to the Mailer.
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails; it is implemented by the service using the email
+// delivery mechanism of choice (SMTP relay, a workflow or a third-party
+// API).
+type Mailer interface {
+	SendMail(ctx context.Context, msg *EmailMessage) error
+}
+
+// MailerFunc is an adapter for using a function as a Mailer.
+type MailerFunc func(ctx context.Context, msg *EmailMessage) error
+
+func (f MailerFunc) SendMail(ctx context.Context, msg *EmailMessage) error {
+	return f(ctx, msg)
+}
+
+// EmailDispatcher sends the notification as a single email to all the
+// recipients with an email address.
+type EmailDispatcher struct {
+	mailer Mailer
+	from   string
+}
+
+// NewEmailDispatcher creates a dispatcher sending emails from the given
+// address.
+func NewEmailDispatcher(mailer Mailer, from string) *EmailDispatcher {
+	return &EmailDispatcher{
+		mailer: mailer,
+		from:   from,
+	}
+}
+
+func (d *EmailDispatcher) Send(
+	ctx context.Context,
+	event Event,
+	recipients []Recipient,
+) error {
+	to := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		if r.Email == "" {
+			continue
+		}
+		addr := mail.Address{Name: r.Name, Address: r.Email}
+		to = append(to, addr.String())
+	}
+	if len(to) == 0 {
+		return nil
+	}
+	err := d.mailer.SendMail(ctx, &EmailMessage{
+		From:    d.from,
+		To:      to,
+		Subject: event.Subject,
+		Body:    event.Message,
+	})
+	return errors.Wrap(err, "notify: failed to send email")
+}
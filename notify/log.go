@@ -0,0 +1,47 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package notify
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// LogDispatcher logs the notifications using the logger from the context.
+// It is useful for development and for disabling notifications without
+// changing the application logic.
+type LogDispatcher struct{}
+
+func NewLogDispatcher() LogDispatcher {
+	return LogDispatcher{}
+}
+
+func (LogDispatcher) Send(
+	ctx context.Context,
+	event Event,
+	recipients []Recipient,
+) error {
+	ids := make([]string, len(recipients))
+	for i, r := range recipients {
+		ids[i] = r.ID
+	}
+	log.FromContext(ctx).WithFields(map[string]interface{}{
+		"notification_type": event.Type,
+		"tenant_id":         event.TenantID,
+		"recipients":        ids,
+	}).Infof("notification: %s", event.Subject)
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package notify provides an abstraction for sending user notifications
+// with pluggable delivery backends (email, webhook and log).
+package notify
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Event is the notification to deliver.
+type Event struct {
+	// Type identifies the kind of notification, e.g.
+	// "deployment.finished".
+	Type string `json:"type"`
+	// TenantID is the tenant the notification belongs to.
+	TenantID string `json:"tenant_id,omitempty"`
+	// Subject is a short summary of the notification.
+	Subject string `json:"subject"`
+	// Message is the (plain text) notification message.
+	Message string `json:"message"`
+	// Data contains additional event specific data.
+	Data map[string]interface{} `json:"data,omitempty"`
+	// OccurredAt is the time the event occurred.
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Recipient is a user receiving the notification.
+type Recipient struct {
+	// ID is the user ID.
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Dispatcher delivers notifications to the recipients.
+type Dispatcher interface {
+	Send(ctx context.Context, event Event, recipients []Recipient) error
+}
+
+// DispatcherFunc is an adapter for using a function as a Dispatcher.
+type DispatcherFunc func(ctx context.Context, event Event, recipients []Recipient) error
+
+func (f DispatcherFunc) Send(
+	ctx context.Context,
+	event Event,
+	recipients []Recipient,
+) error {
+	return f(ctx, event, recipients)
+}
+
+// Errors collects the errors from multiple dispatchers.
+type Errors []error
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return "notify: " + strings.Join(msgs, "; ")
+}
+
+type multiDispatcher []Dispatcher
+
+// Multi returns a Dispatcher sending the notification using all the
+// dispatchers. All dispatchers are invoked even if one of them fails; the
+// errors are returned as Errors.
+func Multi(dispatchers ...Dispatcher) Dispatcher {
+	return multiDispatcher(dispatchers)
+}
+
+func (m multiDispatcher) Send(
+	ctx context.Context,
+	event Event,
+	recipients []Recipient,
+) error {
+	var errs Errors
+	for _, d := range m {
+		if err := d.Send(ctx, event, recipients); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
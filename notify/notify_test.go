@@ -0,0 +1,138 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/webhooks"
+)
+
+var (
+	testEvent = Event{
+		Type:     "deployment.finished",
+		TenantID: "tenant",
+		Subject:  "Deployment finished",
+		Message:  "The deployment finished successfully.",
+	}
+	testRecipients = []Recipient{
+		{ID: "user1", Name: "User One", Email: "user1@example.com"},
+		{ID: "user2"},
+		{ID: "user3", Email: "user3@example.com"},
+	}
+)
+
+func TestEmailDispatcher(t *testing.T) {
+	t.Parallel()
+	var sent *EmailMessage
+	d := NewEmailDispatcher(MailerFunc(
+		func(ctx context.Context, msg *EmailMessage) error {
+			sent = msg
+			return nil
+		}), "noreply@example.com")
+	err := d.Send(context.Background(), testEvent, testRecipients)
+	assert.NoError(t, err)
+	assert.Equal(t, &EmailMessage{
+		From: "noreply@example.com",
+		To: []string{
+			`"User One" <user1@example.com>`,
+			"<user3@example.com>",
+		},
+		Subject: testEvent.Subject,
+		Body:    testEvent.Message,
+	}, sent)
+
+	// No recipients with an email address
+	sent = nil
+	err = d.Send(context.Background(), testEvent, testRecipients[1:2])
+	assert.NoError(t, err)
+	assert.Nil(t, sent)
+
+	d = NewEmailDispatcher(MailerFunc(
+		func(ctx context.Context, msg *EmailMessage) error {
+			return errors.New("connection refused")
+		}), "noreply@example.com")
+	err = d.Send(context.Background(), testEvent, testRecipients)
+	assert.EqualError(t, err, "notify: failed to send email: connection refused")
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	t.Parallel()
+	var payload WebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer srv.Close()
+
+	d := NewWebhookDispatcher(
+		webhooks.NewDeliverer(webhooks.NewOptions().SetClient(srv.Client())),
+		func(ctx context.Context, event Event) ([]webhooks.Target, error) {
+			assert.Equal(t, "tenant", event.TenantID)
+			return []webhooks.Target{{
+				TenantID: event.TenantID,
+				URL:      srv.URL,
+			}}, nil
+		})
+	err := d.Send(context.Background(), testEvent, testRecipients)
+	assert.NoError(t, err)
+	assert.Equal(t, testEvent.Type, payload.Event.Type)
+	assert.Equal(t, testRecipients, payload.Recipients)
+
+	d = NewWebhookDispatcher(webhooks.NewDeliverer(),
+		func(ctx context.Context, event Event) ([]webhooks.Target, error) {
+			return nil, errors.New("db down")
+		})
+	err = d.Send(context.Background(), testEvent, testRecipients)
+	assert.EqualError(t, err, "notify: failed to get webhook targets: db down")
+}
+
+func TestMulti(t *testing.T) {
+	t.Parallel()
+	logBuf := bytes.NewBuffer(nil)
+	logger := log.NewEmpty()
+	logger.Logger.SetOutput(logBuf)
+	ctx := log.WithContext(context.Background(), logger)
+
+	var calls int
+	d := Multi(
+		NewLogDispatcher(),
+		DispatcherFunc(func(context.Context, Event, []Recipient) error {
+			calls++
+			return errors.New("failed")
+		}),
+		DispatcherFunc(func(context.Context, Event, []Recipient) error {
+			calls++
+			return nil
+		}),
+	)
+	err := d.Send(ctx, testEvent, testRecipients)
+	assert.EqualError(t, err, "notify: failed")
+	assert.Equal(t, 2, calls)
+	assert.Contains(t, logBuf.String(), "notification: Deployment finished")
+	assert.Contains(t, logBuf.String(), "notification_type=deployment.finished")
+
+	assert.NoError(t, Multi().Send(ctx, testEvent, testRecipients))
+}
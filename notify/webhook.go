@@ -0,0 +1,76 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package notify
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/webhooks"
+)
+
+// TargetsFunc returns the webhooks configured for the event (typically
+// looked up by the event tenant).
+type TargetsFunc func(ctx context.Context, event Event) ([]webhooks.Target, error)
+
+// WebhookPayload is the JSON payload delivered by the WebhookDispatcher.
+type WebhookPayload struct {
+	Event      Event       `json:"event"`
+	Recipients []Recipient `json:"recipients,omitempty"`
+}
+
+// WebhookDispatcher delivers the notification to webhooks.
+type WebhookDispatcher struct {
+	deliverer *webhooks.Deliverer
+	targets   TargetsFunc
+}
+
+// NewWebhookDispatcher creates a dispatcher delivering the notification to
+// the targets returned by the TargetsFunc.
+func NewWebhookDispatcher(
+	deliverer *webhooks.Deliverer,
+	targets TargetsFunc,
+) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		deliverer: deliverer,
+		targets:   targets,
+	}
+}
+
+func (d *WebhookDispatcher) Send(
+	ctx context.Context,
+	event Event,
+	recipients []Recipient,
+) error {
+	targets, err := d.targets(ctx, event)
+	if err != nil {
+		return errors.Wrap(err, "notify: failed to get webhook targets")
+	}
+	payload := WebhookPayload{
+		Event:      event,
+		Recipients: recipients,
+	}
+	var errs Errors
+	for _, target := range targets {
+		if err := d.deliverer.Deliver(ctx, target, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package password hashes the passwords of the users and checks them
+// against the password policy.
+//
+// The hashes are encoded with the identifier of the algorithm as prefix
+// ("$2a$" for bcrypt, "$argon2id$" for Argon2id) such that hashes of
+// different algorithms and parameters can be stored side by side and
+// migrated when the users log in, see Hashing.Verify.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidHash     = errors.New("password: invalid hash")
+	ErrUnsupportedHash = errors.New("password: unsupported hash algorithm")
+)
+
+// Hasher hashes passwords with one algorithm.
+type Hasher interface {
+	// Supports returns true if the hash was made by the algorithm of the
+	// Hasher.
+	Supports(hash string) bool
+	// Hash returns the encoded hash of the password.
+	Hash(password string) (string, error)
+	// Verify returns true if the password matches the hash.
+	Verify(password, hash string) (bool, error)
+	// NeedsRehash returns true if the hash was made with other
+	// parameters than the ones of the Hasher.
+	NeedsRehash(hash string) bool
+}
+
+// Bcrypt hashes passwords with bcrypt. Note that bcrypt only accepts
+// passwords up to 72 bytes.
+type Bcrypt struct {
+	// Cost is the bcrypt cost, defaults to bcrypt.DefaultCost.
+	Cost int
+}
+
+func (h Bcrypt) cost() int {
+	if h.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return h.Cost
+}
+
+func (h Bcrypt) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+func (h Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return "", errors.Wrap(err, "password: failed to hash password")
+	}
+	return string(hash), nil
+}
+
+func (h Bcrypt) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(ErrInvalidHash, err.Error())
+	}
+	return true, nil
+}
+
+func (h Bcrypt) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost()
+}
+
+// Argon2idParams are the parameters of the Argon2id hash.
+type Argon2idParams struct {
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the size of the memory in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+	// SaltLength and KeyLength are the sizes in bytes of the salt and
+	// the hash.
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2idParams are the parameters recommended by RFC 9106 for
+// memory constrained environments.
+var DefaultArgon2idParams = Argon2idParams{
+	Time:       3,
+	Memory:     64 * 1024,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// Argon2id hashes passwords with Argon2id encoding the hashes in the PHC
+// string format ("$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>").
+type Argon2id struct {
+	// Params defaults to DefaultArgon2idParams.
+	Params *Argon2idParams
+}
+
+func (h Argon2id) params() Argon2idParams {
+	if h.Params == nil {
+		return DefaultArgon2idParams
+	}
+	return *h.Params
+}
+
+func (h Argon2id) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2id) Hash(password string) (string, error) {
+	params := h.params()
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "password: failed to generate salt")
+	}
+	key := argon2.IDKey([]byte(password), salt,
+		params.Time, params.Memory, params.Threads, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil ||
+		version != argon2.Version {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, "unsupported version")
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d",
+		&params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, err.Error())
+	}
+	if params.Time < 1 || params.Threads < 1 {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, "invalid parameters")
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, err.Error())
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, err.Error())
+	}
+	if len(key) == 0 {
+		return params, nil, nil, errors.Wrap(ErrInvalidHash, "empty key")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+func (h Argon2id) Verify(password, hash string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt,
+		params.Time, params.Memory, params.Threads, params.KeyLength)
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (h Argon2id) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	return err != nil || params != h.params()
+}
+
+// Hashing hashes the passwords with the Current hasher and verifies the
+// hashes of the Current and the Legacy hashers.
+type Hashing struct {
+	Current Hasher
+	Legacy  []Hasher
+}
+
+// DefaultHashing hashes new passwords with Argon2id and verifies the
+// existing bcrypt hashes.
+var DefaultHashing = Hashing{
+	Current: Argon2id{},
+	Legacy:  []Hasher{Bcrypt{}},
+}
+
+func (hs Hashing) Hash(password string) (string, error) {
+	return hs.Current.Hash(password)
+}
+
+func (hs Hashing) hasher(hash string) (h Hasher, current bool) {
+	if hs.Current.Supports(hash) {
+		return hs.Current, true
+	}
+	for _, h := range hs.Legacy {
+		if h.Supports(hash) {
+			return h, false
+		}
+	}
+	return nil, false
+}
+
+// Verify checks the password against the hash. If the password matches
+// and the hash was made by a Legacy hasher or with outdated parameters,
+// rehash is the hash of the password made by the Current hasher, which
+// should replace the stored hash.
+func (hs Hashing) Verify(password, hash string) (ok bool, rehash string, err error) {
+	h, current := hs.hasher(hash)
+	if h == nil {
+		return false, "", ErrUnsupportedHash
+	}
+	ok, err = h.Verify(password, hash)
+	if err != nil || !ok {
+		return false, "", err
+	}
+	if !current || hs.Current.NeedsRehash(hash) {
+		rehash, err = hs.Current.Hash(password)
+		if err != nil {
+			return true, "", err
+		}
+	}
+	return true, rehash, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Time:       1,
+	Memory:     1024,
+	Threads:    1,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+func TestHashers(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name   string
+		Hasher Hasher
+		Prefix string
+	}{{
+		Name:   "bcrypt",
+		Hasher: Bcrypt{Cost: bcrypt.MinCost},
+		Prefix: "$2a$04$",
+	}, {
+		Name:   "argon2id",
+		Hasher: Argon2id{Params: &testArgon2idParams},
+		Prefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			hash, err := tc.Hasher.Hash("correct horse")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, strings.HasPrefix(hash, tc.Prefix), hash)
+			assert.True(t, tc.Hasher.Supports(hash))
+			assert.False(t, tc.Hasher.NeedsRehash(hash))
+
+			ok, err := tc.Hasher.Verify("correct horse", hash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = tc.Hasher.Verify("battery staple", hash)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			_, err = tc.Hasher.Verify("correct horse", tc.Prefix+"invalid")
+			assert.ErrorIs(t, err, ErrInvalidHash)
+		})
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	t.Parallel()
+	hash, _ := Argon2id{Params: &testArgon2idParams}.Hash("secret")
+	params := testArgon2idParams
+	params.Time = 2
+	assert.True(t, Argon2id{Params: &params}.NeedsRehash(hash))
+	assert.True(t, Bcrypt{Cost: bcrypt.MinCost + 1}.NeedsRehash(
+		func() string {
+			h, _ := Bcrypt{Cost: bcrypt.MinCost}.Hash("secret")
+			return h
+		}()))
+}
+
+func TestArgon2idVerifyInvalidParams(t *testing.T) {
+	t.Parallel()
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		ok, err := Argon2id{}.Verify("secret", hash)
+		assert.ErrorIs(t, err, ErrInvalidHash, hash)
+		assert.False(t, ok)
+	}
+}
+
+func TestHashingVerify(t *testing.T) {
+	t.Parallel()
+	hashing := Hashing{
+		Current: Argon2id{Params: &testArgon2idParams},
+		Legacy:  []Hasher{Bcrypt{Cost: bcrypt.MinCost}},
+	}
+	legacy, _ := Bcrypt{Cost: bcrypt.MinCost}.Hash("secret")
+
+	ok, rehash, err := hashing.Verify("secret", legacy)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, strings.HasPrefix(rehash, "$argon2id$"), "legacy hashes are migrated")
+
+	ok, again, err := hashing.Verify("secret", rehash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, again, "current hashes are not rehashed")
+
+	ok, rehash, err = hashing.Verify("wrong", legacy)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Empty(t, rehash)
+
+	_, _, err = hashing.Verify("secret", "$1$md5crypt")
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package password
+
+import (
+	"context"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMinLength = 8
+	// DefaultMaxLength is the maximum length of the passwords accepted
+	// by bcrypt (in bytes).
+	DefaultMaxLength = 72
+)
+
+var (
+	ErrTooShort      = errors.New("password: too short")
+	ErrTooLong       = errors.New("password: too long")
+	ErrMissingUpper  = errors.New("password: must contain an upper case letter")
+	ErrMissingLower  = errors.New("password: must contain a lower case letter")
+	ErrMissingDigit  = errors.New("password: must contain a digit")
+	ErrMissingSymbol = errors.New("password: must contain a symbol")
+	ErrBreached      = errors.New("password: found in a data breach")
+)
+
+// BreachChecker returns true if the password is known from a data breach,
+// e.g. by querying the k-anonymity API of Have I Been Pwned.
+type BreachChecker func(ctx context.Context, password string) (bool, error)
+
+// Policy is a password policy. The zero value only checks the default
+// lengths.
+type Policy struct {
+	// MinLength is the minimum number of characters.
+	// (default: DefaultMinLength)
+	MinLength int `json:"min_length" mapstructure:"min_length"`
+	// MaxLength is the maximum number of bytes.
+	// (default: DefaultMaxLength)
+	MaxLength int `json:"max_length" mapstructure:"max_length"`
+
+	RequireUpper  bool `json:"require_upper" mapstructure:"require_upper"`
+	RequireLower  bool `json:"require_lower" mapstructure:"require_lower"`
+	RequireDigit  bool `json:"require_digit" mapstructure:"require_digit"`
+	RequireSymbol bool `json:"require_symbol" mapstructure:"require_symbol"`
+
+	// Breached optionally rejects the passwords known from data
+	// breaches.
+	Breached BreachChecker `json:"-" mapstructure:"-"`
+}
+
+// Validate checks the password against the policy returning the first
+// violation. Errors of the BreachChecker are returned as is.
+func (p Policy) Validate(ctx context.Context, password string) error {
+	minLength, maxLength := p.MinLength, p.MaxLength
+	if minLength <= 0 {
+		minLength = DefaultMinLength
+	}
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLength
+	}
+	if utf8.RuneCountInString(password) < minLength {
+		return errors.Wrapf(ErrTooShort, "at least %d characters", minLength)
+	} else if len(password) > maxLength {
+		return errors.Wrapf(ErrTooLong, "at most %d bytes", maxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return ErrMissingUpper
+	case p.RequireLower && !lower:
+		return ErrMissingLower
+	case p.RequireDigit && !digit:
+		return ErrMissingDigit
+	case p.RequireSymbol && !symbol:
+		return ErrMissingSymbol
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached(ctx, password)
+		if err != nil {
+			return err
+		} else if breached {
+			return ErrBreached
+		}
+	}
+	return nil
+}
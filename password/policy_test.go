@@ -0,0 +1,80 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package password
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	t.Parallel()
+	strict := Policy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		Breached: func(ctx context.Context, password string) (bool, error) {
+			if password == "fail" {
+				return false, errors.New("service unavailable")
+			}
+			return password == "P@ssword1234", nil
+		},
+	}
+	testCases := []struct {
+		Name     string
+		Policy   Policy
+		Password string
+		Error    error
+	}{
+		{Name: "default ok", Password: "password"},
+		{Name: "default too short", Password: "passwor", Error: ErrTooShort},
+		{Name: "default unicode length", Password: "pässwörd"},
+		{
+			Name:     "default too long",
+			Password: strings.Repeat("a", DefaultMaxLength+1),
+			Error:    ErrTooLong,
+		},
+		{Name: "strict ok", Policy: strict, Password: "Correct horse 1"},
+		{Name: "strict short", Policy: strict, Password: "Short 1", Error: ErrTooShort},
+		{Name: "no upper", Policy: strict, Password: "correct horse 1", Error: ErrMissingUpper},
+		{Name: "no lower", Policy: strict, Password: "CORRECT HORSE 1", Error: ErrMissingLower},
+		{Name: "no digit", Policy: strict, Password: "Correct horse!", Error: ErrMissingDigit},
+		{Name: "no symbol", Policy: strict, Password: "Correcthorse1", Error: ErrMissingSymbol},
+		{Name: "breached", Policy: strict, Password: "P@ssword1234", Error: ErrBreached},
+	}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.Policy.Validate(context.Background(), tc.Password)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	strict.MinLength = 1
+	strict.RequireDigit, strict.RequireUpper, strict.RequireSymbol = false, false, false
+	err := strict.Validate(context.Background(), "fail")
+	assert.EqualError(t, err, "service unavailable")
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package ratelimits
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderRateLimitLimit is the maximum number of calls in the interval.
+	HeaderRateLimitLimit = "X-RateLimit-Limit"
+	// HeaderRateLimitRemaining is the number of calls left in the interval.
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	// HeaderRateLimitReset is the number of seconds until the quota resets.
+	HeaderRateLimitReset = "X-RateLimit-Reset"
+	// HeaderRetryAfter is set when no calls are remaining.
+	HeaderRetryAfter = "Retry-After"
+)
+
+// QuotaStatus describes the state of a rate limiter quota.
+type QuotaStatus struct {
+	// Limit is the maximum number of calls in the interval.
+	Limit int
+	// Remaining is the number of calls left in the current interval.
+	Remaining int
+	// Reset is the time when the current interval ends.
+	Reset time.Time
+}
+
+// Status computes the status of the quota given the number of calls
+// consumed in the interval starting at intervalStart.
+func (q ApiQuota) Status(calls int, intervalStart time.Time) QuotaStatus {
+	remaining := q.MaxCalls - calls
+	if remaining < 0 {
+		remaining = 0
+	}
+	return QuotaStatus{
+		Limit:     q.MaxCalls,
+		Remaining: remaining,
+		Reset: intervalStart.Add(
+			time.Duration(q.IntervalSec) * time.Second,
+		),
+	}
+}
+
+// Exceeded returns true if there are no calls left for the interval.
+func (s QuotaStatus) Exceeded() bool {
+	return s.Limit > 0 && s.Remaining <= 0
+}
+
+// ResetAfter returns the number of seconds (rounded up) until the quota
+// resets relative to now.
+func (s QuotaStatus) ResetAfter(now time.Time) int64 {
+	d := s.Reset.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// WriteHeaders sets the X-RateLimit-* headers on the response header hdr.
+// If the quota is exceeded the Retry-After header is set as well.
+// A status with no limit (Limit == 0) does not set any headers.
+func (s QuotaStatus) WriteHeaders(hdr http.Header, now time.Time) {
+	if s.Limit <= 0 {
+		return
+	}
+	resetAfter := strconv.FormatInt(s.ResetAfter(now), 10)
+	hdr.Set(HeaderRateLimitLimit, strconv.Itoa(s.Limit))
+	hdr.Set(HeaderRateLimitRemaining, strconv.Itoa(s.Remaining))
+	hdr.Set(HeaderRateLimitReset, resetAfter)
+	if s.Exceeded() {
+		hdr.Set(HeaderRetryAfter, resetAfter)
+	}
+}
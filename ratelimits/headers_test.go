@@ -0,0 +1,92 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package ratelimits
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaStatusWriteHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		Name string
+
+		Quota         ApiQuota
+		Calls         int
+		IntervalStart time.Time
+
+		Headers http.Header
+	}{{
+		Name: "ok",
+
+		Quota:         ApiQuota{MaxCalls: 100, IntervalSec: 60},
+		Calls:         40,
+		IntervalStart: now.Add(-time.Second * 30),
+
+		Headers: http.Header{
+			HeaderRateLimitLimit:     []string{"100"},
+			HeaderRateLimitRemaining: []string{"60"},
+			HeaderRateLimitReset:     []string{"30"},
+		},
+	}, {
+		Name: "ok, reset rounded up",
+
+		Quota:         ApiQuota{MaxCalls: 10, IntervalSec: 1},
+		Calls:         1,
+		IntervalStart: now.Add(-time.Millisecond * 100),
+
+		Headers: http.Header{
+			HeaderRateLimitLimit:     []string{"10"},
+			HeaderRateLimitRemaining: []string{"9"},
+			HeaderRateLimitReset:     []string{"1"},
+		},
+	}, {
+		Name: "quota exceeded",
+
+		Quota:         ApiQuota{MaxCalls: 10, IntervalSec: 60},
+		Calls:         12,
+		IntervalStart: now.Add(-time.Second * 50),
+
+		Headers: http.Header{
+			HeaderRateLimitLimit:     []string{"10"},
+			HeaderRateLimitRemaining: []string{"0"},
+			HeaderRateLimitReset:     []string{"10"},
+			HeaderRetryAfter:         []string{"10"},
+		},
+	}, {
+		Name: "no quota limit",
+
+		Quota:         ApiQuota{MaxCalls: 0},
+		Calls:         12,
+		IntervalStart: now,
+
+		Headers: http.Header{},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			hdr := http.Header{}
+			tc.Quota.Status(tc.Calls, tc.IntervalStart).
+				WriteHeaders(hdr, now)
+			assert.Len(t, hdr, len(tc.Headers))
+			for key, value := range tc.Headers {
+				assert.Equal(t, value, hdr.Values(key), key)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/mendersoftware/go-lib-micro/authaudit"
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+// AuditSource is the source of the security events of the middlewares.
+const AuditSource = "rbac"
+
+// audit emits the security event of the request rejected with status; the
+// subject is the identity set by the identity middleware, if any.
+func audit(
+	auditor *authaudit.Auditor,
+	r *http.Request,
+	route string,
+	status int,
+	err error,
+) {
+	if auditor == nil {
+		return
+	}
+	event := auditor.NewEvent(r, AuditSource,
+		status, authaudit.ReasonScopeLimit, err)
+	event.Route = route
+	if idty := identity.FromContext(r.Context()); idty != nil {
+		event.Subject = idty.Subject
+		event.Tenant = idty.Tenant
+	}
+	auditor.Emit(r.Context(), event)
+}
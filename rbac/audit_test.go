@@ -0,0 +1,79 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/authaudit"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/notify"
+)
+
+func TestMiddlewareAudit(t *testing.T) {
+	t.Parallel()
+	var sent []notify.Event
+	counters := authaudit.NewCounters()
+	opts := NewMiddlewareOptions().
+		SetMaxScopeValues(1).
+		SetAuditor(&authaudit.Auditor{
+			Metrics: counters,
+			Dispatcher: notify.DispatcherFunc(func(
+				_ context.Context, event notify.Event, _ []notify.Recipient,
+			) error {
+				sent = append(sent, event)
+				return nil
+			}),
+		})
+	router := gin.New()
+	router.Use(Middleware(opts))
+	router.GET("/test", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	handler := HTTPMiddleware(opts)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	for _, h := range []http.Handler{router, handler} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newScopeRequest("foo", ""))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		req := newScopeRequest("foo,bar", "")
+		req = req.WithContext(identity.WithContext(req.Context(),
+			&identity.Identity{Subject: "user", Tenant: "tenant"}))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, w.Code)
+	}
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, "tenant", sent[0].TenantID)
+		assert.Equal(t, "user", sent[0].Data["subject"])
+		assert.Equal(t, "/test", sent[0].Data["route"])
+		assert.Equal(t, "", sent[1].Data["route"])
+	}
+	assert.Equal(t, map[authaudit.MetricsLabels]uint64{{
+		Source: AuditSource,
+		Status: http.StatusRequestHeaderFieldsTooLarge,
+		Reason: authaudit.ReasonScopeLimit,
+	}: 2}, counters.Snapshot())
+}
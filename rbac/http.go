@@ -0,0 +1,48 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rbac
+
+import (
+	"net/http"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+// HTTPMiddleware is the net/http equivalent of Middleware.
+func HTTPMiddleware(opts ...*MiddlewareOptions) func(http.Handler) http.Handler {
+	opt := mergeMiddlewareOptions(opts...)
+	limit, updateLogger := *opt.MaxScopeValues, *opt.UpdateLogger
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, err := ExtractScopeFromHeaderWithLimit(r, limit)
+			if err != nil {
+				audit(opt.Auditor, r, "",
+					http.StatusRequestHeaderFieldsTooLarge, err)
+				urest.WriteError(w, r, http.StatusRequestHeaderFieldsTooLarge, err)
+				return
+			}
+			if scope != nil {
+				ctx := WithContext(r.Context(), scope)
+				if updateLogger {
+					ctx = log.WithContext(ctx,
+						log.FromContext(ctx).F(scope.LogFields()))
+				}
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+	var got *Scope
+	handler := HTTPMiddleware(NewMiddlewareOptions().SetMaxScopeValues(2))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = FromContext(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set(ScopeHeader, "foo,bar")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, &Scope{DeviceGroups: []string{"foo", "bar"}}, got)
+
+	req.Header.Set(ScopeHeader, "foo,bar,baz")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, w.Code)
+}
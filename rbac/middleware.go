@@ -14,28 +14,124 @@
 package rbac
 
 import (
+	"net/http"
+
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/authaudit"
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
 )
 
-func Middleware() gin.HandlerFunc {
+type MiddlewareOptions struct {
+	// MaxScopeValues limits the number of device groups and release
+	// tags in the scope headers; requests exceeding the limit are
+	// rejected with status 431 (Request Header Fields Too Large).
+	MaxScopeValues *int
+
+	// UpdateLogger adds the scope to the log context.
+	UpdateLogger *bool
+
+	// Auditor emits the security events of the rejected requests.
+	Auditor *authaudit.Auditor
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetMaxScopeValues(limit int) *MiddlewareOptions {
+	opts.MaxScopeValues = &limit
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetUpdateLogger(updateLogger bool) *MiddlewareOptions {
+	opts.UpdateLogger = &updateLogger
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetAuditor(auditor *authaudit.Auditor) *MiddlewareOptions {
+	opts.Auditor = auditor
+	return opts
+}
+
+func mergeMiddlewareOptions(opts ...*MiddlewareOptions) *MiddlewareOptions {
+	opt := NewMiddlewareOptions().
+		SetMaxScopeValues(0).
+		SetUpdateLogger(false)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.MaxScopeValues != nil {
+			opt.MaxScopeValues = o.MaxScopeValues
+		}
+		if o.UpdateLogger != nil {
+			opt.UpdateLogger = o.UpdateLogger
+		}
+		if o.Auditor != nil {
+			opt.Auditor = o.Auditor
+		}
+	}
+	return opt
+}
+
+func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
+	opt := mergeMiddlewareOptions(opts...)
+	limit, updateLogger := *opt.MaxScopeValues, *opt.UpdateLogger
 	return func(c *gin.Context) {
-		if scope := ExtractScopeFromHeader(c.Request); scope != nil {
+		scope, err := ExtractScopeFromHeaderWithLimit(c.Request, limit)
+		if err != nil {
+			audit(opt.Auditor, c.Request, c.FullPath(),
+				http.StatusRequestHeaderFieldsTooLarge, err)
+			urest.RenderError(c, http.StatusRequestHeaderFieldsTooLarge, err)
+			c.Abort()
+			return
+		}
+		if scope != nil {
 			ctx := c.Request.Context()
 			ctx = WithContext(ctx, scope)
+			if updateLogger {
+				ctx = log.WithContext(ctx,
+					log.FromContext(ctx).F(scope.LogFields()))
+			}
 			c.Request = c.Request.WithContext(ctx)
 		}
 	}
 }
 
 type RBACMiddleware struct {
+	// MaxScopeValues limits the number of device groups and release
+	// tags in the scope headers, see MiddlewareOptions.
+	MaxScopeValues int
+
+	// UpdateLogger adds the scope to the log context.
+	UpdateLogger bool
+
+	// Auditor optionally emits the security events of the rejected
+	// requests.
+	Auditor *authaudit.Auditor
 }
 
 func (mw *RBACMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
 	return func(w rest.ResponseWriter, r *rest.Request) {
-		if scope := ExtractScopeFromHeader(r.Request); scope != nil {
+		scope, err := ExtractScopeFromHeaderWithLimit(r.Request, mw.MaxScopeValues)
+		if err != nil {
+			audit(mw.Auditor, r.Request, "",
+				http.StatusRequestHeaderFieldsTooLarge, err)
+			rest_utils.RestErrWithWarningMsg(w, r, log.FromContext(r.Context()),
+				err, http.StatusRequestHeaderFieldsTooLarge, err.Error())
+			return
+		}
+		if scope != nil {
 			ctx := r.Context()
 			ctx = WithContext(ctx, scope)
+			if mw.UpdateLogger {
+				ctx = log.WithContext(ctx,
+					log.FromContext(ctx).F(scope.LogFields()))
+			}
 			r.Request = r.WithContext(ctx)
 		}
 
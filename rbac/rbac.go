@@ -15,8 +15,11 @@ package rbac
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/mendersoftware/go-lib-micro/log"
 )
 
 type scopeContextKeyType int
@@ -27,11 +30,44 @@ const (
 	ScopeReleaseTagsHeader                     = "X-MEN-RBAC-Releases-Tags"
 )
 
+const (
+	LogFieldDeviceGroups = "rbac_device_groups"
+	LogFieldReleaseTags  = "rbac_release_tags"
+)
+
 type Scope struct {
 	DeviceGroups []string
 	ReleaseTags  []string
 }
 
+// LogFields returns the scope as structured log fields.
+func (scope *Scope) LogFields() log.Ctx {
+	fields := log.Ctx{}
+	if scope == nil {
+		return fields
+	}
+	if scope.DeviceGroups != nil {
+		fields[LogFieldDeviceGroups] = scope.DeviceGroups
+	}
+	if scope.ReleaseTags != nil {
+		fields[LogFieldReleaseTags] = scope.ReleaseTags
+	}
+	return fields
+}
+
+// ScopeLimitError is returned by ExtractScopeFromHeaderWithLimit if a
+// scope header lists more values than the limit.
+type ScopeLimitError struct {
+	Header string
+	Count  int
+	Limit  int
+}
+
+func (err *ScopeLimitError) Error() string {
+	return fmt.Sprintf("rbac: header %s lists %d values, the limit is %d",
+		err.Header, err.Count, err.Limit)
+}
+
 // FromContext extracts current scope from context.Context
 func FromContext(ctx context.Context) *Scope {
 	val := ctx.Value(scopeContextKey)
@@ -46,18 +82,56 @@ func WithContext(ctx context.Context, scope *Scope) context.Context {
 	return context.WithValue(ctx, scopeContextKey, scope)
 }
 
+// ScopeFromRequest returns the scope added to the request context by the
+// middleware, or extracts the scope from the request headers if the
+// middleware has not been applied to the request.
+func ScopeFromRequest(r *http.Request) *Scope {
+	if scope := FromContext(r.Context()); scope != nil {
+		return scope
+	}
+	return ExtractScopeFromHeader(r)
+}
+
 func ExtractScopeFromHeader(r *http.Request) *Scope {
+	scope, _ := ExtractScopeFromHeaderWithLimit(r, 0)
+	return scope
+}
+
+// ExtractScopeFromHeaderWithLimit works like ExtractScopeFromHeader but
+// returns a *ScopeLimitError if any of the headers lists more than limit
+// values. The values are counted before splitting the header, so huge
+// headers are rejected cheaply. A non-positive limit disables the check.
+func ExtractScopeFromHeaderWithLimit(r *http.Request, limit int) (*Scope, error) {
 	groupStr := r.Header.Get(ScopeHeader)
 	tagsStr := r.Header.Get(ScopeReleaseTagsHeader)
 	if len(groupStr) > 0 || len(tagsStr) > 0 {
+		var err error
 		scope := Scope{}
 		if len(groupStr) > 0 {
-			scope.DeviceGroups = strings.Split(groupStr, ",")
+			scope.DeviceGroups, err = splitScope(ScopeHeader, groupStr, limit)
+			if err != nil {
+				return nil, err
+			}
 		}
 		if len(tagsStr) > 0 {
-			scope.ReleaseTags = strings.Split(tagsStr, ",")
+			scope.ReleaseTags, err = splitScope(ScopeReleaseTagsHeader, tagsStr, limit)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return &scope
+		return &scope, nil
 	}
-	return nil
+	return nil, nil
+}
+
+func splitScope(header, value string, limit int) ([]string, error) {
+	count := strings.Count(value, ",") + 1
+	if limit > 0 && count > limit {
+		return nil, &ScopeLimitError{
+			Header: header,
+			Count:  count,
+			Limit:  limit,
+		}
+	}
+	return strings.SplitN(value, ",", count), nil
 }
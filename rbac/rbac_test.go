@@ -0,0 +1,125 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func newScopeRequest(groups, tags string) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	if groups != "" {
+		req.Header.Set(ScopeHeader, groups)
+	}
+	if tags != "" {
+		req.Header.Set(ScopeReleaseTagsHeader, tags)
+	}
+	return req
+}
+
+func TestExtractScopeFromHeader(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, ExtractScopeFromHeader(newScopeRequest("", "")))
+
+	req := newScopeRequest("foo,bar", "v1")
+	assert.Equal(t, &Scope{
+		DeviceGroups: []string{"foo", "bar"},
+		ReleaseTags:  []string{"v1"},
+	}, ExtractScopeFromHeader(req))
+
+	scope, err := ExtractScopeFromHeaderWithLimit(req, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, scope.DeviceGroups)
+
+	_, err = ExtractScopeFromHeaderWithLimit(req, 1)
+	var limitErr *ScopeLimitError
+	if assert.ErrorAs(t, err, &limitErr) {
+		assert.Equal(t, ScopeLimitError{
+			Header: ScopeHeader,
+			Count:  2,
+			Limit:  1,
+		}, *limitErr)
+	}
+
+	assert.Equal(t, log.Ctx{
+		LogFieldDeviceGroups: []string{"foo", "bar"},
+		LogFieldReleaseTags:  []string{"v1"},
+	}, scope.LogFields())
+	assert.Equal(t, log.Ctx{}, (*Scope)(nil).LogFields())
+}
+
+func TestScopeFromRequest(t *testing.T) {
+	t.Parallel()
+	req := newScopeRequest("foo", "")
+	assert.Equal(t, []string{"foo"}, ScopeFromRequest(req).DeviceGroups)
+
+	scope := &Scope{DeviceGroups: []string{"bar"}}
+	req = req.WithContext(WithContext(req.Context(), scope))
+	assert.Same(t, scope, ScopeFromRequest(req))
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	router := gin.New()
+	router.Use(Middleware(NewMiddlewareOptions().
+		SetMaxScopeValues(2).
+		SetUpdateLogger(true)))
+	router.GET("/test", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		assert.Equal(t, []string{"foo", "bar"}, FromContext(ctx).DeviceGroups)
+		assert.Equal(t, []string{"foo", "bar"},
+			log.FromContext(ctx).Data[LogFieldDeviceGroups])
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newScopeRequest("foo,bar", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newScopeRequest("foo,bar,baz", ""))
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, w.Code)
+}
+
+func TestRBACMiddleware(t *testing.T) {
+	t.Parallel()
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			assert.Equal(t, []string{"v1"}, FromContext(r.Context()).ReleaseTags)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(&RBACMiddleware{MaxScopeValues: 1, UpdateLogger: true})
+	api.SetApp(app)
+	handler := api.MakeHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, newScopeRequest("", "v1"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, newScopeRequest("", "v1,v2"))
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, w.Code)
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// HealthStatus is the result of a health probe.
+type HealthStatus string
+
+const (
+	// StatusOK means the server replied within the latency threshold.
+	StatusOK HealthStatus = "ok"
+	// StatusSlow means the server replied, but slower than the latency
+	// threshold.
+	StatusSlow HealthStatus = "slow"
+	// StatusDown means the server did not reply within the timeout.
+	StatusDown HealthStatus = "down"
+)
+
+const (
+	DefaultHealthTimeout          = time.Second
+	DefaultHealthLatencyThreshold = 100 * time.Millisecond
+)
+
+type HealthOptions struct {
+	// Timeout of the probe (default: DefaultHealthTimeout).
+	Timeout *time.Duration
+	// LatencyThreshold is the latency above which the server is
+	// reported as slow (default: DefaultHealthLatencyThreshold).
+	LatencyThreshold *time.Duration
+}
+
+func NewHealthOptions() *HealthOptions {
+	return new(HealthOptions)
+}
+
+func (opts *HealthOptions) SetTimeout(timeout time.Duration) *HealthOptions {
+	opts.Timeout = &timeout
+	return opts
+}
+
+func (opts *HealthOptions) SetLatencyThreshold(threshold time.Duration) *HealthOptions {
+	opts.LatencyThreshold = &threshold
+	return opts
+}
+
+// HealthReport is the result of Health.
+type HealthReport struct {
+	Status  HealthStatus  `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Err     error         `json:"-"`
+}
+
+// Healthy returns true unless the server is down; a slow server still
+// serves the requests.
+func (r HealthReport) Healthy() bool {
+	return r.Status != StatusDown
+}
+
+// Health pings the server and classifies the latency.
+func Health(ctx context.Context, client redis.Cmdable, opts ...*HealthOptions) HealthReport {
+	timeout := DefaultHealthTimeout
+	threshold := DefaultHealthLatencyThreshold
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Timeout != nil {
+			timeout = *opt.Timeout
+		}
+		if opt.LatencyThreshold != nil {
+			threshold = *opt.LatencyThreshold
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := client.Ping(ctx).Err()
+	report := HealthReport{Latency: time.Since(start), Err: err}
+	switch {
+	case err != nil:
+		report.Status = StatusDown
+	case report.Latency > threshold:
+		report.Status = StatusSlow
+	default:
+		report.Status = StatusOK
+	}
+	return report
+}
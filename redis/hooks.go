@@ -0,0 +1,187 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// Metrics receives the latency of the commands, e.g. to export a histogram
+// per command. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Command is called after every command; pipelines are reported as
+	// a single "pipeline" command. err is nil for redis.Nil replies.
+	Command(ctx context.Context, name string, duration time.Duration, err error)
+}
+
+// Tracer creates the trace spans of the commands. It is a small adapter
+// interface so that the library does not depend on a tracing SDK; an
+// OpenTelemetry implementation starts a span with the tracer of the
+// service and ends it with the error recorded.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx and returns the
+	// function ending the span.
+	Start(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+type Options struct {
+	// SlowThreshold logs the commands taking longer than the threshold
+	// at warning level. Zero disables logging.
+	SlowThreshold *time.Duration
+	// Metrics receives the latency of the commands.
+	Metrics Metrics
+	// Tracer creates a span per command.
+	Tracer Tracer
+	// Hooks are additional go-redis hooks installed on the client.
+	Hooks []redis.Hook
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetSlowThreshold(threshold time.Duration) *Options {
+	opts.SlowThreshold = &threshold
+	return opts
+}
+
+func (opts *Options) SetMetrics(metrics Metrics) *Options {
+	opts.Metrics = metrics
+	return opts
+}
+
+func (opts *Options) SetTracer(tracer Tracer) *Options {
+	opts.Tracer = tracer
+	return opts
+}
+
+func (opts *Options) AddHook(hook redis.Hook) *Options {
+	opts.Hooks = append(opts.Hooks, hook)
+	return opts
+}
+
+func mergeOptions(opts ...*Options) *Options {
+	ret := NewOptions()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.SlowThreshold != nil {
+			ret.SlowThreshold = opt.SlowThreshold
+		}
+		if opt.Metrics != nil {
+			ret.Metrics = opt.Metrics
+		}
+		if opt.Tracer != nil {
+			ret.Tracer = opt.Tracer
+		}
+		ret.Hooks = append(ret.Hooks, opt.Hooks...)
+	}
+	return ret
+}
+
+// hooks returns the hooks to install on the client.
+func (opts *Options) hooks() []redis.Hook {
+	var hooks []redis.Hook
+	if opts.Tracer != nil || opts.Metrics != nil ||
+		(opts.SlowThreshold != nil && *opts.SlowThreshold > 0) {
+		h := &instrumentationHook{
+			metrics: opts.Metrics,
+			tracer:  opts.Tracer,
+		}
+		if opts.SlowThreshold != nil {
+			h.slowThreshold = *opts.SlowThreshold
+		}
+		hooks = append(hooks, h)
+	}
+	return append(hooks, opts.Hooks...)
+}
+
+type hookAdder interface {
+	AddHook(redis.Hook)
+}
+
+// instrumentationHook logs slow commands, records the latency metrics and
+// traces the commands.
+type instrumentationHook struct {
+	slowThreshold time.Duration
+	metrics       Metrics
+	tracer        Tracer
+}
+
+func (h *instrumentationHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *instrumentationHook) observe(
+	ctx context.Context,
+	name string,
+	fn func(ctx context.Context) error,
+) error {
+	end := func(error) {}
+	if h.tracer != nil {
+		ctx, end = h.tracer.Start(ctx, "redis."+name)
+	}
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+	cmdErr := err
+	if errors.Is(cmdErr, redis.Nil) {
+		cmdErr = nil
+	}
+	end(cmdErr)
+	if h.metrics != nil {
+		h.metrics.Command(ctx, name, duration, cmdErr)
+	}
+	if h.slowThreshold > 0 && duration >= h.slowThreshold {
+		fields := log.Ctx{
+			"command":  name,
+			"duration": duration.String(),
+		}
+		if reqID := requestid.FromContext(ctx); reqID != "" {
+			fields["request_id"] = reqID
+		}
+		log.FromContext(ctx).
+			F(fields).
+			Warnf("redis: slow command %s took %s", name, duration)
+	}
+	return err
+}
+
+func (h *instrumentationHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return h.observe(ctx, strings.ToLower(cmd.Name()), func(ctx context.Context) error {
+			return next(ctx, cmd)
+		})
+	}
+}
+
+func (h *instrumentationHook) ProcessPipelineHook(
+	next redis.ProcessPipelineHook,
+) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		return h.observe(ctx, "pipeline", func(ctx context.Context) error {
+			return next(ctx, cmds)
+		})
+	}
+}
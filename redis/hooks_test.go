@@ -0,0 +1,115 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+type command struct {
+	Name string
+	Err  error
+}
+
+type testMetrics struct {
+	mu       sync.Mutex
+	commands []command
+}
+
+func (m *testMetrics) Command(_ context.Context, name string, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = append(m.commands, command{Name: name, Err: err})
+}
+
+type testTracer struct {
+	spans []string
+	errs  []error
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, func(error)) {
+	t.spans = append(t.spans, name)
+	return ctx, func(err error) { t.errs = append(t.errs, err) }
+}
+
+func TestInstrumentationHook(t *testing.T) {
+	metrics := &testMetrics{}
+	tracer := &testTracer{}
+	opts := mergeOptions(
+		NewOptions().SetSlowThreshold(time.Millisecond),
+		nil,
+		NewOptions().SetMetrics(metrics).SetTracer(tracer),
+	)
+	hooks := opts.hooks()
+	require.Len(t, hooks, 1)
+	hook := hooks[0]
+
+	var logBuf bytes.Buffer
+	logger := log.NewEmpty()
+	logger.Logger.SetOutput(&logBuf)
+	logger.Logger.SetLevel(logrus.InfoLevel)
+	ctx := log.WithContext(context.Background(), logger)
+	ctx = requestid.WithContext(ctx, "req-1")
+
+	errFail := errors.New("connection refused")
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		switch cmd.Name() {
+		case "get":
+			return redis.Nil
+		case "set":
+			return errFail
+		}
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	})
+	// The errors are returned as is
+	assert.ErrorIs(t, process(ctx, redis.NewStringCmd(ctx, "GET", "foo")), redis.Nil)
+	assert.ErrorIs(t, process(ctx, redis.NewStatusCmd(ctx, "SET", "foo", "bar")), errFail)
+	assert.Empty(t, logBuf.String())
+	assert.NoError(t, process(ctx, redis.NewStringCmd(ctx, "EVALSHA", "sha", 0)))
+	assert.Contains(t, logBuf.String(), "redis: slow command evalsha")
+	assert.Contains(t, logBuf.String(), "request_id=req-1")
+
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		return nil
+	})
+	assert.NoError(t, pipeline(ctx, nil))
+
+	assert.Equal(t, []command{
+		{Name: "get"},
+		{Name: "set", Err: errFail},
+		{Name: "evalsha"},
+		{Name: "pipeline"},
+	}, metrics.commands)
+	assert.Equal(t, []string{
+		"redis.get", "redis.set", "redis.evalsha", "redis.pipeline",
+	}, tracer.spans)
+	assert.Equal(t, []error{nil, errFail, nil, nil}, tracer.errs)
+
+	assert.Empty(t, NewOptions().hooks())
+}
@@ -0,0 +1,534 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUnknownKeys is returned by the KeyPrefixHook for commands whose key
+// arguments are unknown: the command is not sent rather than accessing
+// keys outside of the prefix.
+var ErrUnknownKeys = errors.New("redis: key prefix: unknown key arguments of command")
+
+// keyPositions returns the indexes of the key arguments of a command.
+type keyPositions func(args []interface{}) []int
+
+func keysFrom(first int) keyPositions {
+	return func(args []interface{}) []int {
+		idx := make([]int, 0, len(args))
+		for i := first; i < len(args); i++ {
+			idx = append(idx, i)
+		}
+		return idx
+	}
+}
+
+func keysRange(first, last int) keyPositions {
+	return func(args []interface{}) []int {
+		idx := make([]int, 0, last-first+1)
+		for i := first; i <= last && i < len(args); i++ {
+			idx = append(idx, i)
+		}
+		return idx
+	}
+}
+
+// keysAllButLast are the keys of blocking commands, followed by the timeout.
+func keysAllButLast(args []interface{}) []int {
+	return keysRange(1, len(args)-2)(args)
+}
+
+// keysEveryOther are the keys of key value pairs.
+func keysEveryOther(args []interface{}) []int {
+	idx := make([]int, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// keysNumKeys are the keys following the numkeys argument at position pos,
+// optionally preceded by the destination key.
+func keysNumKeys(pos int, dest bool) keyPositions {
+	return func(args []interface{}) []int {
+		var idx []int
+		if dest {
+			idx = append(idx, 1)
+		}
+		if pos >= len(args) {
+			return idx
+		}
+		n, err := strconv.Atoi(fmt.Sprint(args[pos]))
+		if err != nil {
+			return idx
+		}
+		return append(idx, keysRange(pos+1, pos+n)(args)...)
+	}
+}
+
+// keysStreams are the keys of XREAD and XREADGROUP: the first half of the
+// arguments following STREAMS.
+func keysStreams(args []interface{}) []int {
+	for i := 1; i < len(args); i++ {
+		if s, ok := args[i].(string); ok && strings.EqualFold(s, "streams") {
+			n := (len(args) - i - 1) / 2
+			return keysRange(i+1, i+n)(args)
+		}
+	}
+	return nil
+}
+
+// firstKey is the key of the commands taking a single key as the first
+// argument.
+func firstKey(args []interface{}) []int {
+	return keysRange(1, 1)(args)
+}
+
+// keysOptions are the first key and the keys following the options (case
+// insensitive) unless the value is one of the exceptions: e.g. the STORE
+// destination of SORT and GEORADIUS and the BY and GET patterns of SORT.
+func keysOptions(options map[string][]string) keyPositions {
+	return func(args []interface{}) []int {
+		idx := firstKey(args)
+		for i := 2; i < len(args)-1; i++ {
+			s, ok := args[i].(string)
+			if !ok {
+				continue
+			}
+			except, ok := options[strings.ToLower(s)]
+			if !ok {
+				continue
+			}
+			i++
+			value := fmt.Sprint(args[i])
+			var skip bool
+			for _, e := range except {
+				skip = skip || strings.EqualFold(value, e)
+			}
+			if !skip {
+				idx = append(idx, i)
+			}
+		}
+		return idx
+	}
+}
+
+func noKeys([]interface{}) []int {
+	return nil
+}
+
+// subcommands are the commands whose key arguments depend on the
+// subcommand; the keys are listed in commandKeys as "command|subcommand".
+var subcommands = map[string]bool{
+	"memory": true,
+	"object": true,
+	"xgroup": true,
+	"xinfo":  true,
+}
+
+var (
+	sortOptions = map[string][]string{
+		"by": {"nosort"}, "get": {"#"}, "store": nil,
+	}
+	geoRadiusOptions = map[string][]string{
+		"store": nil, "storedist": nil,
+	}
+)
+
+var commandKeys = map[string]keyPositions{
+	"acl":               noKeys,
+	"auth":              noKeys,
+	"bgrewriteaof":      noKeys,
+	"bgsave":            noKeys,
+	"client":            noKeys,
+	"cluster":           noKeys,
+	"command":           noKeys,
+	"config":            noKeys,
+	"dbsize":            noKeys,
+	"discard":           noKeys,
+	"echo":              noKeys,
+	"exec":              noKeys,
+	"flushall":          noKeys,
+	"flushdb":           noKeys,
+	"function":          noKeys,
+	"hello":             noKeys,
+	"info":              noKeys,
+	"lastsave":          noKeys,
+	"latency":           noKeys,
+	"multi":             noKeys,
+	"ping":              noKeys,
+	"psubscribe":        noKeys,
+	"publish":           noKeys,
+	"pubsub":            noKeys,
+	"punsubscribe":      noKeys,
+	"quit":              noKeys,
+	"randomkey":         noKeys,
+	"readonly":          noKeys,
+	"readwrite":         noKeys,
+	"role":              noKeys,
+	"save":              noKeys,
+	"script":            noKeys,
+	"select":            noKeys,
+	"slowlog":           noKeys,
+	"spublish":          noKeys,
+	"ssubscribe":        noKeys,
+	"subscribe":         noKeys,
+	"sunsubscribe":      noKeys,
+	"time":              noKeys,
+	"unsubscribe":       noKeys,
+	"unwatch":           noKeys,
+	"wait":              noKeys,
+	"del":               keysFrom(1),
+	"exists":            keysFrom(1),
+	"mget":              keysFrom(1),
+	"pfcount":           keysFrom(1),
+	"pfmerge":           keysFrom(1),
+	"sdiff":             keysFrom(1),
+	"sdiffstore":        keysFrom(1),
+	"sinter":            keysFrom(1),
+	"sinterstore":       keysFrom(1),
+	"sunion":            keysFrom(1),
+	"sunionstore":       keysFrom(1),
+	"touch":             keysFrom(1),
+	"unlink":            keysFrom(1),
+	"watch":             keysFrom(1),
+	"blmove":            keysRange(1, 2),
+	"brpoplpush":        keysRange(1, 2),
+	"copy":              keysRange(1, 2),
+	"geosearchstore":    keysRange(1, 2),
+	"lmove":             keysRange(1, 2),
+	"rename":            keysRange(1, 2),
+	"renamenx":          keysRange(1, 2),
+	"rpoplpush":         keysRange(1, 2),
+	"smove":             keysRange(1, 2),
+	"zrangestore":       keysRange(1, 2),
+	"blpop":             keysAllButLast,
+	"brpop":             keysAllButLast,
+	"bzpopmax":          keysAllButLast,
+	"bzpopmin":          keysAllButLast,
+	"mset":              keysEveryOther,
+	"msetnx":            keysEveryOther,
+	"eval":              keysNumKeys(2, false),
+	"eval_ro":           keysNumKeys(2, false),
+	"evalsha":           keysNumKeys(2, false),
+	"evalsha_ro":        keysNumKeys(2, false),
+	"fcall":             keysNumKeys(2, false),
+	"fcall_ro":          keysNumKeys(2, false),
+	"blmpop":            keysNumKeys(2, false),
+	"bzmpop":            keysNumKeys(2, false),
+	"lmpop":             keysNumKeys(1, false),
+	"sintercard":        keysNumKeys(1, false),
+	"zdiff":             keysNumKeys(1, false),
+	"zinter":            keysNumKeys(1, false),
+	"zintercard":        keysNumKeys(1, false),
+	"zmpop":             keysNumKeys(1, false),
+	"zunion":            keysNumKeys(1, false),
+	"zdiffstore":        keysNumKeys(2, true),
+	"zinterstore":       keysNumKeys(2, true),
+	"zunionstore":       keysNumKeys(2, true),
+	"xread":             keysStreams,
+	"xreadgroup":        keysStreams,
+	"keys":              firstKey,
+	"scan":              noKeys,
+	"sscan":             firstKey,
+	"hscan":             firstKey,
+	"zscan":             firstKey,
+	"lcs":               keysRange(1, 2),
+	"bitop":             keysFrom(2),
+	"sort":              keysOptions(sortOptions),
+	"sort_ro":           keysOptions(sortOptions),
+	"georadius":         keysOptions(geoRadiusOptions),
+	"georadiusbymember": keysOptions(geoRadiusOptions),
+
+	"memory|doctor":         noKeys,
+	"memory|help":           noKeys,
+	"memory|malloc-stats":   noKeys,
+	"memory|purge":          noKeys,
+	"memory|stats":          noKeys,
+	"memory|usage":          keysRange(2, 2),
+	"object|encoding":       keysRange(2, 2),
+	"object|freq":           keysRange(2, 2),
+	"object|help":           noKeys,
+	"object|idletime":       keysRange(2, 2),
+	"object|refcount":       keysRange(2, 2),
+	"xgroup|create":         keysRange(2, 2),
+	"xgroup|createconsumer": keysRange(2, 2),
+	"xgroup|delconsumer":    keysRange(2, 2),
+	"xgroup|destroy":        keysRange(2, 2),
+	"xgroup|help":           noKeys,
+	"xgroup|setid":          keysRange(2, 2),
+	"xinfo|consumers":       keysRange(2, 2),
+	"xinfo|groups":          keysRange(2, 2),
+	"xinfo|help":            noKeys,
+	"xinfo|stream":          keysRange(2, 2),
+
+	// The commands taking a single key as the first argument.
+	"append":               firstKey,
+	"bitcount":             firstKey,
+	"bitfield":             firstKey,
+	"bitfield_ro":          firstKey,
+	"bitpos":               firstKey,
+	"decr":                 firstKey,
+	"decrby":               firstKey,
+	"dump":                 firstKey,
+	"expire":               firstKey,
+	"expireat":             firstKey,
+	"expiretime":           firstKey,
+	"geoadd":               firstKey,
+	"geodist":              firstKey,
+	"geohash":              firstKey,
+	"geopos":               firstKey,
+	"georadius_ro":         firstKey,
+	"georadiusbymember_ro": firstKey,
+	"geosearch":            firstKey,
+	"get":                  firstKey,
+	"getbit":               firstKey,
+	"getdel":               firstKey,
+	"getex":                firstKey,
+	"getrange":             firstKey,
+	"getset":               firstKey,
+	"hdel":                 firstKey,
+	"hexists":              firstKey,
+	"hget":                 firstKey,
+	"hgetall":              firstKey,
+	"hincrby":              firstKey,
+	"hincrbyfloat":         firstKey,
+	"hkeys":                firstKey,
+	"hlen":                 firstKey,
+	"hmget":                firstKey,
+	"hmset":                firstKey,
+	"hrandfield":           firstKey,
+	"hset":                 firstKey,
+	"hsetnx":               firstKey,
+	"hstrlen":              firstKey,
+	"hvals":                firstKey,
+	"incr":                 firstKey,
+	"incrby":               firstKey,
+	"incrbyfloat":          firstKey,
+	"lindex":               firstKey,
+	"linsert":              firstKey,
+	"llen":                 firstKey,
+	"lpop":                 firstKey,
+	"lpos":                 firstKey,
+	"lpush":                firstKey,
+	"lpushx":               firstKey,
+	"lrange":               firstKey,
+	"lrem":                 firstKey,
+	"lset":                 firstKey,
+	"ltrim":                firstKey,
+	"move":                 firstKey,
+	"persist":              firstKey,
+	"pexpire":              firstKey,
+	"pexpireat":            firstKey,
+	"pexpiretime":          firstKey,
+	"pfadd":                firstKey,
+	"psetex":               firstKey,
+	"pttl":                 firstKey,
+	"restore":              firstKey,
+	"rpop":                 firstKey,
+	"rpush":                firstKey,
+	"rpushx":               firstKey,
+	"sadd":                 firstKey,
+	"scard":                firstKey,
+	"set":                  firstKey,
+	"setbit":               firstKey,
+	"setex":                firstKey,
+	"setnx":                firstKey,
+	"setrange":             firstKey,
+	"sismember":            firstKey,
+	"smembers":             firstKey,
+	"smismember":           firstKey,
+	"spop":                 firstKey,
+	"srandmember":          firstKey,
+	"srem":                 firstKey,
+	"strlen":               firstKey,
+	"ttl":                  firstKey,
+	"type":                 firstKey,
+	"xack":                 firstKey,
+	"xadd":                 firstKey,
+	"xautoclaim":           firstKey,
+	"xclaim":               firstKey,
+	"xdel":                 firstKey,
+	"xlen":                 firstKey,
+	"xpending":             firstKey,
+	"xrange":               firstKey,
+	"xrevrange":            firstKey,
+	"xsetid":               firstKey,
+	"xtrim":                firstKey,
+	"zadd":                 firstKey,
+	"zcard":                firstKey,
+	"zcount":               firstKey,
+	"zincrby":              firstKey,
+	"zlexcount":            firstKey,
+	"zmscore":              firstKey,
+	"zpopmax":              firstKey,
+	"zpopmin":              firstKey,
+	"zrandmember":          firstKey,
+	"zrange":               firstKey,
+	"zrangebylex":          firstKey,
+	"zrangebyscore":        firstKey,
+	"zrank":                firstKey,
+	"zrem":                 firstKey,
+	"zremrangebylex":       firstKey,
+	"zremrangebyrank":      firstKey,
+	"zremrangebyscore":     firstKey,
+	"zrevrange":            firstKey,
+	"zrevrangebylex":       firstKey,
+	"zrevrangebyscore":     firstKey,
+	"zrevrank":             firstKey,
+	"zscore":               firstKey,
+}
+
+// keyPrefixHook prefixes the key arguments of the commands and removes the
+// prefix from the keys returned by KEYS, SCAN, BLPOP and BRPOP.
+type keyPrefixHook struct {
+	prefix string
+}
+
+// KeyPrefixHook returns a hook prefixing all the keys of the commands with
+// prefix, so that multiple services or environments can share a Redis
+// deployment. The key_prefix parameter of ClientFromConnectionString
+// installs the hook.
+//
+// The key patterns of KEYS and SCAN are prefixed and the prefix is removed
+// from their results; SCAN without a pattern only returns the keys with the
+// prefix. Commands with unknown key arguments fail with ErrUnknownKeys
+// without being sent. Channel names (PUBLISH, SUBSCRIBE) are not prefixed,
+// and neither are the keys built by Lua scripts: scripts must only use the
+// keys passed in KEYS.
+func KeyPrefixHook(prefix string) redis.Hook {
+	return &keyPrefixHook{prefix: prefix}
+}
+
+func (h *keyPrefixHook) prefixArg(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case string:
+		return h.prefix + v
+	case []byte:
+		return append([]byte(h.prefix), v...)
+	default:
+		return h.prefix + fmt.Sprint(v)
+	}
+}
+
+func (h *keyPrefixHook) rewrite(cmd redis.Cmder) error {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return nil
+	}
+	name := strings.ToLower(cmd.Name())
+	if name == "scan" {
+		h.rewriteScan(cmd)
+		return nil
+	} else if subcommands[name] {
+		name += "|" + strings.ToLower(fmt.Sprint(args[1]))
+	}
+	positions, ok := commandKeys[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKeys, name)
+	}
+	for _, i := range positions(args) {
+		args[i] = h.prefixArg(args[i])
+	}
+	return nil
+}
+
+// rewriteScan prefixes the MATCH pattern of SCAN.
+func (h *keyPrefixHook) rewriteScan(cmd redis.Cmder) {
+	args := cmd.Args()
+	for i := 2; i < len(args)-1; i++ {
+		if s, ok := args[i].(string); ok && strings.EqualFold(s, "match") {
+			args[i+1] = h.prefixArg(args[i+1])
+			return
+		}
+	}
+}
+
+func (h *keyPrefixHook) trim(cmd redis.Cmder) {
+	switch cmd := cmd.(type) {
+	case *redis.ScanCmd:
+		if strings.ToLower(cmd.Name()) != "scan" {
+			return
+		}
+		// Without a MATCH pattern, SCAN returns the keys of all
+		// prefixes: keep the keys with the prefix only. The pages may
+		// be empty, which SCAN allows anyway.
+		page, cursor := cmd.Val()
+		keys := page[:0]
+		for _, key := range page {
+			if strings.HasPrefix(key, h.prefix) {
+				keys = append(keys, strings.TrimPrefix(key, h.prefix))
+			}
+		}
+		cmd.SetVal(keys, cursor)
+	case *redis.StringSliceCmd:
+		switch strings.ToLower(cmd.Name()) {
+		case "keys":
+			val := cmd.Val()
+			for i := range val {
+				val[i] = strings.TrimPrefix(val[i], h.prefix)
+			}
+		case "blpop", "brpop":
+			if val := cmd.Val(); len(val) > 0 {
+				val[0] = strings.TrimPrefix(val[0], h.prefix)
+			}
+		}
+	}
+}
+
+func (h *keyPrefixHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *keyPrefixHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.rewrite(cmd); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		h.trim(cmd)
+		return err
+	}
+}
+
+func (h *keyPrefixHook) ProcessPipelineHook(
+	next redis.ProcessPipelineHook,
+) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := h.rewrite(cmd); err != nil {
+				// Do not send any command of the pipeline (or
+				// transaction).
+				for _, cmd := range cmds {
+					cmd.SetErr(err)
+				}
+				return err
+			}
+		}
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			h.trim(cmd)
+		}
+		return err
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPrefixHook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCases := []struct {
+		Name string
+		Cmd  redis.Cmder
+		Args []interface{}
+	}{{
+		Name: "single key",
+		Cmd:  redis.NewStringCmd(ctx, "GET", "foo"),
+		Args: []interface{}{"GET", "svc:foo"},
+	}, {
+		Name: "no keys",
+		Cmd:  redis.NewStatusCmd(ctx, "ping", "hello"),
+		Args: []interface{}{"ping", "hello"},
+	}, {
+		Name: "multiple keys",
+		Cmd:  redis.NewIntCmd(ctx, "del", "foo", "bar"),
+		Args: []interface{}{"del", "svc:foo", "svc:bar"},
+	}, {
+		Name: "key value pairs",
+		Cmd:  redis.NewStatusCmd(ctx, "mset", "foo", 1, "bar", 2),
+		Args: []interface{}{"mset", "svc:foo", 1, "svc:bar", 2},
+	}, {
+		Name: "blocking",
+		Cmd:  redis.NewStringSliceCmd(ctx, "blpop", "foo", "bar", 0),
+		Args: []interface{}{"blpop", "svc:foo", "svc:bar", 0},
+	}, {
+		Name: "script",
+		Cmd:  redis.NewCmd(ctx, "evalsha", "sha", 2, "foo", "bar", "arg"),
+		Args: []interface{}{"evalsha", "sha", 2, "svc:foo", "svc:bar", "arg"},
+	}, {
+		Name: "destination and numkeys",
+		Cmd:  redis.NewIntCmd(ctx, "zunionstore", "dst", 2, "foo", "bar", "weights", 1, 2),
+		Args: []interface{}{"zunionstore", "svc:dst", 2, "svc:foo", "svc:bar", "weights", 1, 2},
+	}, {
+		Name: "streams",
+		Cmd:  redis.NewXStreamSliceCmd(ctx, "xread", "count", 1, "streams", "foo", "bar", "0", "0"),
+		Args: []interface{}{"xread", "count", 1, "streams", "svc:foo", "svc:bar", "0", "0"},
+	}, {
+		Name: "scan",
+		Cmd:  redis.NewScanCmd(ctx, nil, "scan", 0, "match", "foo*", "count", 10),
+		Args: []interface{}{"scan", 0, "match", "svc:foo*", "count", 10},
+	}, {
+		Name: "set scan",
+		Cmd:  redis.NewScanCmd(ctx, nil, "sscan", "foo", 0, "match", "bar*"),
+		Args: []interface{}{"sscan", "svc:foo", 0, "match", "bar*"},
+	}, {
+		Name: "two keys",
+		Cmd:  redis.NewStringCmd(ctx, "lcs", "foo", "bar", "len"),
+		Args: []interface{}{"lcs", "svc:foo", "svc:bar", "len"},
+	}, {
+		Name: "sort",
+		Cmd: redis.NewIntCmd(ctx, "sort", "foo", "by", "w_*", "get", "#",
+			"get", "o_*", "store", "dst"),
+		Args: []interface{}{"sort", "svc:foo", "by", "svc:w_*", "get", "#",
+			"get", "svc:o_*", "store", "svc:dst"},
+	}, {
+		Name: "sort nosort",
+		Cmd:  redis.NewStringSliceCmd(ctx, "sort_ro", "foo", "BY", "nosort"),
+		Args: []interface{}{"sort_ro", "svc:foo", "BY", "nosort"},
+	}, {
+		Name: "georadius store",
+		Cmd: redis.NewIntCmd(ctx, "georadius", "foo", 15, 37, 200, "km",
+			"STORE", "dst"),
+		Args: []interface{}{"georadius", "svc:foo", 15, 37, 200, "km",
+			"STORE", "svc:dst"},
+	}, {
+		Name: "bitop",
+		Cmd:  redis.NewIntCmd(ctx, "bitop", "and", "dst", "foo", "bar"),
+		Args: []interface{}{"bitop", "and", "svc:dst", "svc:foo", "svc:bar"},
+	}, {
+		Name: "subcommand",
+		Cmd:  redis.NewIntCmd(ctx, "object", "freq", "foo"),
+		Args: []interface{}{"object", "freq", "svc:foo"},
+	}, {
+		Name: "stream group",
+		Cmd:  redis.NewStatusCmd(ctx, "xgroup", "create", "foo", "group", "$"),
+		Args: []interface{}{"xgroup", "create", "svc:foo", "group", "$"},
+	}, {
+		Name: "subcommand without keys",
+		Cmd:  redis.NewCmd(ctx, "memory", "stats"),
+		Args: []interface{}{"memory", "stats"},
+	}, {
+		Name: "bytes key",
+		Cmd:  redis.NewStringCmd(ctx, "get", []byte("foo")),
+		Args: []interface{}{"get", []byte("svc:foo")},
+	}}
+	hook := KeyPrefixHook("svc:")
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+				return nil
+			})
+			assert.NoError(t, process(ctx, tc.Cmd))
+			assert.Equal(t, tc.Args, tc.Cmd.Args())
+		})
+	}
+}
+
+func TestKeyPrefixHookUnknownCommand(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	hook := KeyPrefixHook("svc:")
+	var sent bool
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		sent = true
+		return nil
+	})
+	for _, cmd := range []redis.Cmder{
+		redis.NewCmd(ctx, "migrate", "host", 6379, "foo", 0, 1000),
+		redis.NewCmd(ctx, "object", "unknown", "foo"),
+	} {
+		err := process(ctx, cmd)
+		assert.ErrorIs(t, err, ErrUnknownKeys)
+		assert.ErrorIs(t, cmd.Err(), ErrUnknownKeys)
+	}
+	assert.False(t, sent)
+
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		sent = true
+		return nil
+	})
+	get := redis.NewStringCmd(ctx, "get", "foo")
+	err := pipeline(ctx, []redis.Cmder{get, redis.NewCmd(ctx, "migrate", "host")})
+	assert.ErrorIs(t, err, ErrUnknownKeys)
+	assert.ErrorIs(t, get.Err(), ErrUnknownKeys)
+	assert.False(t, sent)
+}
+
+func TestKeyPrefixHookResults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	hook := KeyPrefixHook("svc:")
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			switch cmd := cmd.(type) {
+			case *redis.ScanCmd:
+				cmd.SetVal([]string{"svc:foo", "other:foo", "svc:bar"}, 42)
+			case *redis.StringSliceCmd:
+				cmd.SetVal([]string{"svc:foo", "value"})
+			}
+		}
+		return nil
+	})
+	scan := redis.NewScanCmd(ctx, nil, "scan", 0)
+	sscan := redis.NewScanCmd(ctx, nil, "sscan", "foo", 0)
+	keys := redis.NewStringSliceCmd(ctx, "keys", "*")
+	blpop := redis.NewStringSliceCmd(ctx, "blpop", "foo", 0)
+	assert.NoError(t, pipeline(ctx, []redis.Cmder{scan, sscan, keys, blpop}))
+
+	page, cursor := scan.Val()
+	assert.Equal(t, []string{"foo", "bar"}, page)
+	assert.Equal(t, uint64(42), cursor)
+	page, _ = sscan.Val()
+	assert.Equal(t, []string{"svc:foo", "other:foo", "svc:bar"}, page)
+	assert.Equal(t, []interface{}{"keys", "svc:*"}, keys.Args())
+	assert.Equal(t, []string{"foo", "value"}, keys.Val())
+	assert.Equal(t, []string{"foo", "value"}, blpop.Val())
+}
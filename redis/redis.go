@@ -26,6 +26,9 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// ParamKeyPrefix is the connection string parameter prefixing all keys.
+const ParamKeyPrefix = "key_prefix"
+
 // nolint:lll
 // NewClient creates a new redis client (Cmdable) from the parameters in the
 // connectionString URL format:
@@ -51,9 +54,22 @@ import (
 // read_timeout        duration
 // tls                 bool
 // write_timeout       duration
+//
+// The key_prefix parameter prefixes all keys with the given string (see
+// KeyPrefixHook).
+//
+// Read-only commands are routed to replicas with the following parameters:
+// read_only, route_randomly and route_by_latency (cluster mode) or one or
+// more replica_addr=<host>:<port> (standalone mode). The replicas may lag
+// behind the primary, so only route reads which tolerate stale data, e.g.
+// rate limit counters.
+//
+// The options install hooks on the client logging slow commands, recording
+// the latency metrics and tracing the commands.
 func ClientFromConnectionString(
 	ctx context.Context,
 	connectionString string,
+	opts ...*Options,
 ) (redis.Cmdable, error) {
 	var (
 		redisurl   *url.URL
@@ -73,6 +89,13 @@ func ClientFromConnectionString(
 		}
 	}
 	q := redisurl.Query()
+	keyPrefix := q.Get(ParamKeyPrefix)
+	replicaAddrs := q[ParamReplicaAddr]
+	if q.Has(ParamKeyPrefix) || q.Has(ParamReplicaAddr) {
+		q.Del(ParamKeyPrefix)
+		q.Del(ParamReplicaAddr)
+		redisurl.RawQuery = q.Encode()
+	}
 	scheme := redisurl.Scheme
 	cname := redisurl.Hostname()
 	if strings.HasSuffix(scheme, "+srv") {
@@ -125,10 +148,18 @@ func ClientFromConnectionString(
 		redisurl.RawQuery = q.Encode()
 		redisurl.Host = redisurl.Host[idx+1:]
 	}
-	var cluster bool
+	var (
+		cluster     bool
+		replicaHook redis.Hook
+	)
 	if _, ok := q["addr"]; ok {
 		cluster = true
 	}
+	if cluster && len(replicaAddrs) > 0 {
+		return nil, fmt.Errorf("redis: invalid connection string: "+
+			"%s is not supported in cluster mode, use route_randomly",
+			ParamReplicaAddr)
+	}
 	if cluster {
 		var redisOpts *redis.ClusterOptions
 		redisOpts, err = redis.ParseClusterURL(redisurl.String())
@@ -143,11 +174,30 @@ func ClientFromConnectionString(
 		redisOpts, err = redis.ParseURL(redisurl.String())
 		if err == nil {
 			rdb = redis.NewClient(redisOpts)
+			if len(replicaAddrs) > 0 {
+				replicaHook = newReplicaHook(redisOpts, replicaAddrs)
+			}
 		}
 	}
 	if err != nil {
 		return nil, fmt.Errorf("redis: invalid connection string: %w", err)
 	}
+	hooks := mergeOptions(opts...).hooks()
+	if keyPrefix != "" {
+		// Keep the prefix hook last so the other hooks see the keys
+		// as used by the service.
+		hooks = append(hooks, KeyPrefixHook(keyPrefix))
+	}
+	if replicaHook != nil {
+		// The replica hook runs the commands on the replicas instead
+		// of the primary, so it must be the innermost hook.
+		hooks = append(hooks, replicaHook)
+	}
+	if client, ok := rdb.(hookAdder); ok {
+		for _, hook := range hooks {
+			client.AddHook(hook)
+		}
+	}
 	_, err = rdb.
 		Ping(ctx).
 		Result()
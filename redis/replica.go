@@ -0,0 +1,171 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ParamReplicaAddr is the connection string parameter adding a replica of
+// a standalone server.
+const ParamReplicaAddr = "replica_addr"
+
+var readOnlyCommands = map[string]bool{
+	"bitcount":         true,
+	"bitpos":           true,
+	"dbsize":           true,
+	"eval_ro":          true,
+	"evalsha_ro":       true,
+	"exists":           true,
+	"fcall_ro":         true,
+	"get":              true,
+	"getbit":           true,
+	"getrange":         true,
+	"hexists":          true,
+	"hget":             true,
+	"hgetall":          true,
+	"hkeys":            true,
+	"hlen":             true,
+	"hmget":            true,
+	"hscan":            true,
+	"hstrlen":          true,
+	"hvals":            true,
+	"keys":             true,
+	"lindex":           true,
+	"llen":             true,
+	"lpos":             true,
+	"lrange":           true,
+	"mget":             true,
+	"pfcount":          true,
+	"pttl":             true,
+	"scan":             true,
+	"scard":            true,
+	"sismember":        true,
+	"smembers":         true,
+	"smismember":       true,
+	"srandmember":      true,
+	"sscan":            true,
+	"strlen":           true,
+	"ttl":              true,
+	"type":             true,
+	"xlen":             true,
+	"xrange":           true,
+	"xrevrange":        true,
+	"zcard":            true,
+	"zcount":           true,
+	"zmscore":          true,
+	"zrange":           true,
+	"zrangebyscore":    true,
+	"zrank":            true,
+	"zrevrange":        true,
+	"zrevrangebyscore": true,
+	"zrevrank":         true,
+	"zscan":            true,
+	"zscore":           true,
+}
+
+func isReadOnly(cmd redis.Cmder) bool {
+	return readOnlyCommands[strings.ToLower(cmd.Name())]
+}
+
+// replica is the subset of redis.Client used by replicaHook.
+type replica interface {
+	Process(ctx context.Context, cmd redis.Cmder) error
+	Pipeline() redis.Pipeliner
+}
+
+// replicaHook runs the read-only commands on the replicas (round robin)
+// instead of the primary. Commands failing with a network error on the
+// replica are retried on the primary.
+type replicaHook struct {
+	replicas []replica
+	n        uint32
+}
+
+func newReplicaHook(primary *redis.Options, addrs []string) *replicaHook {
+	h := &replicaHook{replicas: make([]replica, len(addrs))}
+	for i, addr := range addrs {
+		opts := *primary
+		opts.Addr = addr
+		if primary.TLSConfig != nil {
+			opts.TLSConfig = primary.TLSConfig.Clone()
+			if host, _, err := net.SplitHostPort(addr); err == nil {
+				opts.TLSConfig.ServerName = host
+			}
+		}
+		h.replicas[i] = redis.NewClient(&opts)
+	}
+	return h
+}
+
+func (h *replicaHook) replica() replica {
+	n := atomic.AddUint32(&h.n, 1)
+	return h.replicas[int(n%uint32(len(h.replicas)))]
+}
+
+// isReplyError returns true if err is an error reply (including redis.Nil)
+// rather than a network error.
+func isReplyError(err error) bool {
+	var replyErr redis.Error
+	return errors.As(err, &replyErr)
+}
+
+func (h *replicaHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *replicaHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if !isReadOnly(cmd) {
+			return next(ctx, cmd)
+		}
+		err := h.replica().Process(ctx, cmd)
+		if err == nil || isReplyError(err) || ctx.Err() != nil {
+			return err
+		}
+		cmd.SetErr(nil)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *replicaHook) ProcessPipelineHook(
+	next redis.ProcessPipelineHook,
+) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if !isReadOnly(cmd) {
+				return next(ctx, cmds)
+			}
+		}
+		pipe := h.replica().Pipeline()
+		for _, cmd := range cmds {
+			_ = pipe.Process(ctx, cmd)
+		}
+		_, err := pipe.Exec(ctx)
+		if err == nil || isReplyError(err) || ctx.Err() != nil {
+			return err
+		}
+		for _, cmd := range cmds {
+			cmd.SetErr(nil)
+		}
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReplica struct {
+	redis.Pipeliner
+	err      error
+	commands []string
+}
+
+func (r *fakeReplica) Process(ctx context.Context, cmd redis.Cmder) error {
+	r.commands = append(r.commands, cmd.Name())
+	cmd.SetErr(r.err)
+	return r.err
+}
+
+func (r *fakeReplica) Pipeline() redis.Pipeliner {
+	return r.Pipeliner
+}
+
+func TestReplicaHook(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	r1, r2 := &fakeReplica{}, &fakeReplica{err: redis.Nil}
+	hook := &replicaHook{replicas: []replica{r1, r2}}
+
+	var primary []string
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		primary = append(primary, cmd.Name())
+		return nil
+	})
+	assert.NoError(t, process(ctx, redis.NewStatusCmd(ctx, "set", "foo", "bar")))
+	assert.ErrorIs(t, process(ctx, redis.NewStringCmd(ctx, "get", "foo")), redis.Nil)
+	assert.NoError(t, process(ctx, redis.NewStringCmd(ctx, "GET", "foo")))
+	assert.Equal(t, []string{"set"}, primary)
+	assert.Equal(t, []string{"get"}, r1.commands)
+	assert.Equal(t, []string{"get"}, r2.commands)
+
+	// Network errors fall back to the primary
+	r1.err = errors.New("connection refused")
+	r2.err = r1.err
+	cmd := redis.NewStringCmd(ctx, "get", "foo")
+	assert.NoError(t, process(ctx, cmd))
+	assert.NoError(t, cmd.Err())
+	assert.Equal(t, []string{"set", "get"}, primary)
+}
+
+func TestReplicaHookPipeline(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	// Nothing listens on port 1 of the loopback interface.
+	unreachable := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: time.Second,
+		MaxRetries:  -1,
+	})
+	defer unreachable.Close()
+	r := &fakeReplica{Pipeliner: unreachable.Pipeline()}
+	hook := &replicaHook{replicas: []replica{r}}
+
+	var primary [][]string
+	pipeline := hook.ProcessPipelineHook(func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		primary = append(primary, names)
+		return nil
+	})
+	cmds := []redis.Cmder{
+		redis.NewStringCmd(ctx, "get", "foo"),
+		redis.NewStatusCmd(ctx, "set", "foo", "bar"),
+	}
+	assert.NoError(t, pipeline(ctx, cmds))
+	assert.Equal(t, [][]string{{"get", "set"}}, primary)
+
+	// The read-only pipeline fails on the replica and is retried on the
+	// primary.
+	cmds = []redis.Cmder{
+		redis.NewStringCmd(ctx, "get", "foo"),
+		redis.NewStringCmd(ctx, "ttl", "foo"),
+	}
+	assert.NoError(t, pipeline(ctx, cmds))
+	assert.Equal(t, [][]string{{"get", "set"}, {"get", "ttl"}}, primary)
+	for _, cmd := range cmds {
+		assert.NoError(t, cmd.Err())
+	}
+}
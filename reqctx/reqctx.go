@@ -0,0 +1,130 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package reqctx stores request scoped values in a single context value
+// with typed keys, and provides one accessor for the values stored by the
+// identity, rbac and requestid packages.
+package reqctx
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// Key identifies a value of type T. Keys are compared by identity, so
+// two keys created with the same name are distinct.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey creates a key; the name is only used for debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (key *Key[T]) String() string {
+	return "reqctx." + key.name
+}
+
+// TraceIDKey is the key of the trace ID of the request.
+var TraceIDKey = NewKey[string]("trace_id")
+
+type bagKey struct{}
+
+// bag is immutable; Set copies the values of the parent bag such that
+// contexts derived from the same parent do not share values.
+type bag map[interface{}]interface{}
+
+func fromContext(ctx context.Context) bag {
+	b, _ := ctx.Value(bagKey{}).(bag)
+	return b
+}
+
+// Set returns a copy of ctx with the value stored under key.
+func Set[T any](ctx context.Context, key *Key[T], value T) context.Context {
+	parent := fromContext(ctx)
+	b := make(bag, len(parent)+1)
+	for k, v := range parent {
+		b[k] = v
+	}
+	b[key] = value
+	return context.WithValue(ctx, bagKey{}, b)
+}
+
+// Get returns the value stored under key, if any.
+func Get[T any](ctx context.Context, key *Key[T]) (T, bool) {
+	value, ok := fromContext(ctx)[key].(T)
+	return value, ok
+}
+
+// Lookup returns the value stored under key or the zero value.
+func Lookup[T any](ctx context.Context, key *Key[T]) T {
+	value, _ := Get(ctx, key)
+	return value
+}
+
+// WithTraceID returns a copy of ctx with the trace ID.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return Set(ctx, TraceIDKey, traceID)
+}
+
+// TraceID returns the trace ID of the request.
+func TraceID(ctx context.Context) string {
+	return Lookup(ctx, TraceIDKey)
+}
+
+// Request is a snapshot of the request scoped values.
+type Request struct {
+	Identity  *identity.Identity
+	Scope     *rbac.Scope
+	RequestID string
+	TraceID   string
+	// Plan is the plan of the tenant from the identity.
+	Plan string
+}
+
+// From returns the request scoped values of the context.
+func From(ctx context.Context) Request {
+	req := Request{
+		Identity:  identity.FromContext(ctx),
+		Scope:     rbac.FromContext(ctx),
+		RequestID: requestid.FromContext(ctx),
+		TraceID:   TraceID(ctx),
+	}
+	if req.Identity != nil {
+		req.Plan = req.Identity.Plan
+	}
+	return req
+}
+
+// With returns a copy of ctx carrying the non-zero values of req, e.g. to
+// restore the values of a request in a background task.
+func With(ctx context.Context, req Request) context.Context {
+	if req.Identity != nil {
+		ctx = identity.WithContext(ctx, req.Identity)
+	}
+	if req.Scope != nil {
+		ctx = rbac.WithContext(ctx, req.Scope)
+	}
+	if req.RequestID != "" {
+		ctx = requestid.WithContext(ctx, req.RequestID)
+	}
+	if req.TraceID != "" {
+		ctx = WithTraceID(ctx, req.TraceID)
+	}
+	return ctx
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package reqctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+type feature struct {
+	Enabled bool
+}
+
+func TestGetSet(t *testing.T) {
+	t.Parallel()
+	countKey := NewKey[int]("count")
+	featureKey := NewKey[*feature]("feature")
+	otherKey := NewKey[int]("count")
+	assert.Equal(t, "reqctx.count", countKey.String())
+
+	ctx := context.Background()
+	_, ok := Get(ctx, countKey)
+	assert.False(t, ok)
+	assert.Nil(t, Lookup(ctx, featureKey))
+
+	parent := Set(ctx, countKey, 1)
+	child := Set(parent, featureKey, &feature{Enabled: true})
+	sibling := Set(parent, countKey, 2)
+
+	assert.Equal(t, 1, Lookup(parent, countKey))
+	assert.Nil(t, Lookup(parent, featureKey))
+	assert.Equal(t, 1, Lookup(child, countKey))
+	assert.True(t, Lookup(child, featureKey).Enabled)
+	assert.Equal(t, 2, Lookup(sibling, countKey))
+	_, ok = Get(child, otherKey)
+	assert.False(t, ok)
+}
+
+func TestRequest(t *testing.T) {
+	t.Parallel()
+	id := &identity.Identity{Subject: "user", Tenant: "tenant", Plan: "enterprise"}
+	scope := &rbac.Scope{DeviceGroups: []string{"production"}}
+	ctx := identity.WithContext(context.Background(), id)
+	ctx = rbac.WithContext(ctx, scope)
+	ctx = requestid.WithContext(ctx, "req-1")
+	ctx = WithTraceID(ctx, "trace-1")
+
+	req := From(ctx)
+	assert.Equal(t, Request{
+		Identity:  id,
+		Scope:     scope,
+		RequestID: "req-1",
+		TraceID:   "trace-1",
+		Plan:      "enterprise",
+	}, req)
+	assert.Equal(t, req, From(With(context.Background(), req)))
+	assert.Equal(t, Request{}, From(context.Background()))
+}
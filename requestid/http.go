@@ -0,0 +1,54 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package requestid
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// HTTPMiddleware is the net/http equivalent of Middleware.
+func HTTPMiddleware(opts ...*MiddlewareOptions) func(http.Handler) http.Handler {
+	opt := NewMiddlewareOptions().
+		SetGenerateRequestID(true)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.GenerateRequestID != nil {
+			opt.GenerateRequestID = o.GenerateRequestID
+		}
+	}
+	generate := *opt.GenerateRequestID
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			requestID := r.Header.Get(RequestIdHeader)
+			if requestID == "" && generate {
+				requestID = uuid.NewString()
+			}
+			ctx = WithContext(ctx, requestID)
+			if logger := log.FromContext(ctx); logger != nil {
+				ctx = log.WithContext(ctx,
+					logger.F(log.Ctx{"request_id": requestID}))
+			}
+			w.Header().Set(RequestIdHeader, requestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
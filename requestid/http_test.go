@@ -0,0 +1,48 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set(RequestIdHeader, "1234")
+	w := httptest.NewRecorder()
+	HTTPMiddleware()(next).ServeHTTP(w, req)
+	assert.Equal(t, "1234", got)
+	assert.Equal(t, "1234", w.Header().Get(RequestIdHeader))
+
+	req.Header.Del(RequestIdHeader)
+	w = httptest.NewRecorder()
+	HTTPMiddleware()(next).ServeHTTP(w, req)
+	assert.Len(t, got, 36)
+	assert.Equal(t, got, w.Header().Get(RequestIdHeader))
+
+	HTTPMiddleware(NewMiddlewareOptions().SetGenerateRequestID(false))(next).
+		ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, got)
+}
@@ -29,19 +29,20 @@ import (
 type RequestLogMiddleware struct {
 	BaseLogger *logrus.Logger
 	LogContext log.Ctx
+	// Template adds deployment metadata fields (see FieldTemplate),
+	// LogContext takes precedence.
+	Template FieldTemplate
 }
 
 // MiddlewareFunc makes RequestLogMiddleware implement the Middleware interface.
 func (mw *RequestLogMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	newLogger := NewOptions().
+		SetBaseLogger(mw.BaseLogger).
+		SetFields(mw.LogContext).
+		SetTemplate(mw.Template).
+		newLogger()
 	return func(w rest.ResponseWriter, r *rest.Request) {
-		var l *log.Logger
-		if mw.BaseLogger == nil {
-			l = log.New(mw.LogContext)
-		} else {
-			l = log.NewFromLogger(mw.BaseLogger, mw.LogContext)
-		}
-
-		r = SetRequestLogger(r, l)
+		r = SetRequestLogger(r, newLogger())
 		h(w, r)
 	}
 }
@@ -78,3 +78,28 @@ func TestRequestLogMiddlewareWithCtx(t *testing.T) {
 
 	_ = test.RunRequest(t, handler, req)
 }
+
+func TestRequestLogMiddlewareWithTemplate(t *testing.T) {
+	t.Setenv("TEST_POD_NAME", "deviceauth-0")
+	api := rest.NewApi()
+
+	api.Use(&RequestLogMiddleware{
+		LogContext: log.Ctx{"foo": "bar"},
+		Template:   FieldTemplate{"pod": "${TEST_POD_NAME}"},
+	})
+
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		l := log.FromContext(r.Context())
+
+		assert.Equal(t, "bar", l.Data["foo"])
+		assert.Equal(t, "deviceauth-0", l.Data["pod"])
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	handler := api.MakeHandler()
+
+	req := test.MakeSimpleRequest("GET", "http://localhost/", nil)
+
+	_ = test.RunRequest(t, handler, req)
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package requestlog
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// FieldTemplate maps log fields to values which may reference environment
+// variables as $VAR or ${VAR}, e.g.:
+//
+//	FieldTemplate{
+//	    "service": "deviceauth",
+//	    "region":  "${REGION}",
+//	    "pod":     "${POD_NAME}",
+//	}
+//
+// The template is resolved once when the middleware is created; fields
+// that resolve to an empty value are omitted.
+type FieldTemplate map[string]string
+
+// Resolve expands the environment variables of the template.
+func (t FieldTemplate) Resolve() log.Ctx {
+	fields := make(log.Ctx, len(t))
+	for key, value := range t {
+		if value = os.ExpandEnv(value); value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+type Options struct {
+	// BaseLogger is the logger the request loggers derive from, the
+	// default is the global logger.
+	BaseLogger *logrus.Logger
+	// Fields are added to every request logger.
+	Fields log.Ctx
+	// Template adds deployment metadata fields to every request
+	// logger; Fields take precedence.
+	Template FieldTemplate
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetBaseLogger(logger *logrus.Logger) *Options {
+	opts.BaseLogger = logger
+	return opts
+}
+
+func (opts *Options) SetFields(fields log.Ctx) *Options {
+	opts.Fields = fields
+	return opts
+}
+
+func (opts *Options) SetTemplate(template FieldTemplate) *Options {
+	opts.Template = template
+	return opts
+}
+
+// newLogger resolves the options to a constructor of the request loggers.
+func (opts *Options) newLogger() func() *log.Logger {
+	fields := opts.Template.Resolve()
+	for key, value := range opts.Fields {
+		fields[key] = value
+	}
+	base := opts.BaseLogger
+	return func() *log.Logger {
+		if base == nil {
+			return log.New(fields)
+		}
+		return log.NewFromLogger(base, fields)
+	}
+}
+
+func mergeOptions(opts ...*Options) *Options {
+	opt := NewOptions()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.BaseLogger != nil {
+			opt.BaseLogger = o.BaseLogger
+		}
+		if o.Fields != nil {
+			opt.Fields = o.Fields
+		}
+		if o.Template != nil {
+			opt.Template = o.Template
+		}
+	}
+	return opt
+}
+
+// Middleware sets a request logger with the fields of the options in the
+// request context for the gin-gonic framework.
+func Middleware(opts ...*Options) gin.HandlerFunc {
+	newLogger := mergeOptions(opts...).newLogger()
+	return func(c *gin.Context) {
+		ctx := log.WithContext(c.Request.Context(), newLogger())
+		c.Request = c.Request.WithContext(ctx)
+	}
+}
+
+// HTTPMiddleware provides the requestlog middleware for net/http handlers,
+// see Middleware.
+func HTTPMiddleware(opts ...*Options) func(http.Handler) http.Handler {
+	newLogger := mergeOptions(opts...).newLogger()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := log.WithContext(r.Context(), newLogger())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package requestlog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func TestFieldTemplate(t *testing.T) {
+	t.Setenv("TEST_REGION", "eu-west-1")
+	t.Setenv("TEST_POD_NAME", "")
+	fields := FieldTemplate{
+		"service": "deviceauth",
+		"region":  "${TEST_REGION}",
+		"pod":     "$TEST_POD_NAME",
+		"zone":    "${TEST_REGION}a",
+	}.Resolve()
+	assert.Equal(t, log.Ctx{
+		"service": "deviceauth",
+		"region":  "eu-west-1",
+		"zone":    "eu-west-1a",
+	}, fields)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Setenv("TEST_REGION", "eu-west-1")
+	buf := &bytes.Buffer{}
+	base := logrus.New()
+	base.Out = buf
+	base.Formatter = &logrus.TextFormatter{DisableColors: true}
+	opts := NewOptions().
+		SetBaseLogger(base).
+		SetFields(log.Ctx{"service": "useradm"}).
+		SetTemplate(FieldTemplate{
+			"service": "ignored",
+			"region":  "${TEST_REGION}",
+		})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		log.FromContext(r.Context()).Info("foobar")
+	}
+
+	router := gin.New()
+	router.Use(Middleware(opts))
+	router.GET("/", func(c *gin.Context) {
+		handler(c.Writer, c.Request)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, buf.String(), "msg=foobar region=eu-west-1 service=useradm")
+
+	buf.Reset()
+	HTTPMiddleware(opts)(http.HandlerFunc(handler)).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, buf.String(), "msg=foobar region=eu-west-1 service=useradm")
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const hdrLocation = "Location"
+
+// Accepted is the body of 202 Accepted responses to requests starting a
+// long-running operation, e.g. a job submitted to jobs.Manager.
+type Accepted struct {
+	// ID identifies the operation.
+	ID string `json:"id"`
+	// StatusURL is the URL for polling the status of the operation.
+	StatusURL string `json:"status_url"`
+}
+
+// RenderAccepted responds with 202 Accepted, the Location header set to
+// the statusURL and an Accepted body.
+func RenderAccepted(c *gin.Context, id, statusURL string) {
+	c.Header(hdrLocation, statusURL)
+	c.JSON(http.StatusAccepted, Accepted{
+		ID:        id,
+		StatusURL: statusURL,
+	})
+}
+
+// WriteAccepted is the net/http equivalent of RenderAccepted.
+func WriteAccepted(w http.ResponseWriter, id, statusURL string) {
+	w.Header().Set(hdrLocation, statusURL)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(Accepted{
+		ID:        id,
+		StatusURL: statusURL,
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderAccepted(t *testing.T) {
+	const (
+		jobID     = "0c8b7d16-1b7f-4b44-8d6e-cbb5d77d9ae6"
+		statusURL = "/api/management/v1/devices/jobs/" + jobID
+		body      = `{"id":"` + jobID + `","status_url":"` + statusURL + `"}`
+	)
+	router := gin.New()
+	router.POST("/export", func(c *gin.Context) {
+		RenderAccepted(c, jobID, statusURL)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/export", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, statusURL, w.Header().Get("Location"))
+	assert.JSONEq(t, body, w.Body.String())
+
+	w = httptest.NewRecorder()
+	WriteAccepted(w, jobID, statusURL)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, statusURL, w.Header().Get("Location"))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, body, w.Body.String())
+}
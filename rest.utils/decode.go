@@ -0,0 +1,230 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/units"
+)
+
+const (
+	DefaultMaxBodyBytes = 1 * units.MiB
+	DefaultMaxDepth     = 32
+
+	CodeInvalidJSON     = "invalid_json"
+	CodeBodyTooLarge    = "body_too_large"
+	CodeMaxDepth        = "max_depth_exceeded"
+	CodeUnknownField    = "unknown_field"
+	CodeInvalidType     = "invalid_type"
+	CodeEmptyBody       = "empty_body"
+	unknownFieldMessage = "json: unknown field "
+)
+
+type DecodeOptions struct {
+	// MaxBytes is the maximum size of the body
+	// (default: DefaultMaxBodyBytes).
+	MaxBytes *int64
+	// MaxDepth is the maximum nesting depth of objects and arrays
+	// (default: DefaultMaxDepth).
+	MaxDepth *int
+	// DisallowUnknownFields rejects object keys that do not match a field
+	// of the destination struct (default: false).
+	DisallowUnknownFields *bool
+}
+
+func NewDecodeOptions() *DecodeOptions {
+	return new(DecodeOptions)
+}
+
+func (opts *DecodeOptions) SetMaxBytes(n int64) *DecodeOptions {
+	opts.MaxBytes = &n
+	return opts
+}
+
+func (opts *DecodeOptions) SetMaxDepth(depth int) *DecodeOptions {
+	opts.MaxDepth = &depth
+	return opts
+}
+
+func (opts *DecodeOptions) SetDisallowUnknownFields(disallow bool) *DecodeOptions {
+	opts.DisallowUnknownFields = &disallow
+	return opts
+}
+
+// DecodeError is returned by DecodeJSON. Status is the HTTP status to
+// respond with and Err the FieldErrors describing the problem.
+type DecodeError struct {
+	Status int
+	Err    error
+}
+
+func (err *DecodeError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+func newDecodeError(status int, field, code, msg string) *DecodeError {
+	return &DecodeError{
+		Status: status,
+		Err:    FieldErrors{{Field: field, Message: msg, Code: code}},
+	}
+}
+
+// checkDepth returns false if the arrays and objects of the JSON document
+// are nested deeper than maxDepth.
+func checkDepth(b []byte, maxDepth int) bool {
+	var (
+		depth    int
+		inString bool
+		escaped  bool
+	)
+	for _, c := range b {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return false
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return true
+}
+
+// DecodeJSON decodes a single JSON value from r into v enforcing the
+// limits of the options. The body is read before decoding, so that the
+// size and depth limits are enforced before allocating the result.
+// Failures are returned as *DecodeError.
+func DecodeJSON(r io.Reader, v interface{}, opts ...*DecodeOptions) error {
+	var (
+		maxBytes int64 = DefaultMaxBodyBytes
+		maxDepth       = DefaultMaxDepth
+		strict   bool
+	)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.MaxBytes != nil {
+			maxBytes = *opt.MaxBytes
+		}
+		if opt.MaxDepth != nil {
+			maxDepth = *opt.MaxDepth
+		}
+		if opt.DisallowUnknownFields != nil {
+			strict = *opt.DisallowUnknownFields
+		}
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return newDecodeError(http.StatusBadRequest, "", CodeInvalidJSON,
+			"failed to read request body: "+err.Error())
+	}
+	if int64(len(b)) > maxBytes {
+		return newDecodeError(http.StatusRequestEntityTooLarge, "", CodeBodyTooLarge,
+			"request body exceeds "+strconv.FormatInt(maxBytes, 10)+" bytes")
+	} else if len(bytes.TrimSpace(b)) == 0 {
+		return newDecodeError(http.StatusBadRequest, "", CodeEmptyBody,
+			"request body is empty")
+	} else if !checkDepth(b, maxDepth) {
+		return newDecodeError(http.StatusBadRequest, "", CodeMaxDepth,
+			"request body exceeds the maximum nesting depth of "+
+				strconv.Itoa(maxDepth))
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err = dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return newDecodeError(http.StatusBadRequest, "", CodeInvalidJSON,
+			"invalid JSON: unexpected data after the top-level value")
+	}
+	return nil
+}
+
+func decodeError(err error) *DecodeError {
+	var (
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &typeErr):
+		return newDecodeError(http.StatusBadRequest, typeErr.Field, CodeInvalidType,
+			"must be of type "+typeErr.Type.String())
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return newDecodeError(http.StatusBadRequest, "", CodeInvalidJSON,
+			"invalid JSON: "+err.Error())
+	case strings.HasPrefix(err.Error(), unknownFieldMessage):
+		// encoding/json has no error type for unknown fields.
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldMessage))
+		return newDecodeError(http.StatusBadRequest, field, CodeUnknownField,
+			"unknown field")
+	default:
+		return newDecodeError(http.StatusBadRequest, "", CodeInvalidJSON, err.Error())
+	}
+}
+
+// DecodeRequestJSON decodes the JSON body of the request with DecodeJSON.
+func DecodeRequestJSON(r *http.Request, v interface{}, opts ...*DecodeOptions) error {
+	if r.Body == nil {
+		return newDecodeError(http.StatusBadRequest, "", CodeEmptyBody,
+			"request body is empty")
+	}
+	return DecodeJSON(r.Body, v, opts...)
+}
+
+// BindJSON decodes the JSON body of the request with DecodeJSON. On failure
+// it renders the error and aborts the request.
+func BindJSON(c *gin.Context, v interface{}, opts ...*DecodeOptions) error {
+	err := DecodeRequestJSON(c.Request, v, opts...)
+	if err != nil {
+		status := http.StatusBadRequest
+		var decErr *DecodeError
+		if errors.As(err, &decErr) {
+			status = decErr.Status
+		}
+		RenderError(c, status, err)
+		c.Abort()
+	}
+	return err
+}
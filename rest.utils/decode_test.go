@@ -0,0 +1,171 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type decodeTestBody struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Tags  []struct {
+		Key string `json:"key"`
+	} `json:"tags"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Body    string
+		Options *DecodeOptions
+
+		Status int
+		Error  *FieldError
+	}{{
+		Name: "ok",
+		Body: `{"name": "foo", "count": 1, "tags": [{"key": "[{"}]}`,
+	}, {
+		Name:    "too large",
+		Body:    `{"name": "foobar"}`,
+		Options: NewDecodeOptions().SetMaxBytes(10),
+
+		Status: http.StatusRequestEntityTooLarge,
+		Error: &FieldError{
+			Message: "request body exceeds 10 bytes",
+			Code:    CodeBodyTooLarge,
+		},
+	}, {
+		Name:    "too deep",
+		Body:    `{"name": "foo", "tags": [{"key": "bar"}]}`,
+		Options: NewDecodeOptions().SetMaxDepth(2),
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Message: "request body exceeds the maximum nesting depth of 2",
+			Code:    CodeMaxDepth,
+		},
+	}, {
+		Name: "unknown field allowed",
+		Body: `{"name": "foo", "extra": true}`,
+	}, {
+		Name:    "unknown field",
+		Body:    `{"name": "foo", "extra": true}`,
+		Options: NewDecodeOptions().SetDisallowUnknownFields(true),
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Field:   "extra",
+			Message: "unknown field",
+			Code:    CodeUnknownField,
+		},
+	}, {
+		Name: "invalid type",
+		Body: `{"count": "one"}`,
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Field:   "count",
+			Message: "must be of type int",
+			Code:    CodeInvalidType,
+		},
+	}, {
+		Name: "syntax error",
+		Body: `{"name": `,
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Message: "invalid JSON: unexpected EOF",
+			Code:    CodeInvalidJSON,
+		},
+	}, {
+		Name: "trailing data",
+		Body: `{"name": "foo"} {}`,
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Message: "invalid JSON: unexpected data after the top-level value",
+			Code:    CodeInvalidJSON,
+		},
+	}, {
+		Name: "empty",
+		Body: " \n",
+
+		Status: http.StatusBadRequest,
+		Error: &FieldError{
+			Message: "request body is empty",
+			Code:    CodeEmptyBody,
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			var body decodeTestBody
+			err := DecodeJSON(strings.NewReader(tc.Body), &body, tc.Options)
+			if tc.Error == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var decErr *DecodeError
+			if assert.ErrorAs(t, err, &decErr) {
+				assert.Equal(t, tc.Status, decErr.Status)
+				assert.Equal(t, FieldErrors{*tc.Error}, decErr.Err)
+			}
+		})
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	router := gin.New()
+	router.POST("/test", func(c *gin.Context) {
+		var body decodeTestBody
+		if BindJSON(c, &body, NewDecodeOptions().SetMaxBytes(32)) != nil {
+			return
+		}
+		c.JSON(http.StatusOK, body)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/test",
+		strings.NewReader(`{"name": "foo"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/test",
+		strings.NewReader(`{"name": "`+strings.Repeat("a", 32)+`"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var apiErr Error
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr)) {
+		assert.Equal(t, "request body exceeds 32 bytes", apiErr.Err)
+		assert.Equal(t, []FieldError{{
+			Message: "request body exceeds 32 bytes",
+			Code:    CodeBodyTooLarge,
+		}}, apiErr.Errors)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost/test", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -14,11 +14,45 @@
 
 package rest
 
+import "strings"
+
 type Error struct {
 	Err       string `json:"error"`
 	RequestID string `json:"request_id,omitempty"`
+	// Errors optionally lists the individual problems with the request.
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
 func (err Error) Error() string {
 	return err.Err
 }
+
+// FieldError describes a single problem with the request, such as a
+// validation failure of a field.
+type FieldError struct {
+	// Field is the (JSON) path of the offending field, if applicable.
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Code is an optional machine readable error code.
+	Code string `json:"code,omitempty"`
+}
+
+func (err FieldError) Error() string {
+	if err.Field == "" {
+		return err.Message
+	}
+	return err.Field + ": " + err.Message
+}
+
+// FieldErrors is an error reporting multiple problems at once. When
+// rendering a FieldErrors (or an error wrapping it) the list is included
+// in the "errors" attribute of the response.
+type FieldErrors []FieldError
+
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
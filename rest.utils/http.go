@@ -0,0 +1,62 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+// errorRecorder is implemented by response writers recording the errors
+// of the request, such as the net/http access log middleware.
+type errorRecorder interface {
+	PushError(err error) bool
+}
+
+// WriteError is the net/http equivalent of RenderError: it records err
+// with the access log (if the ResponseWriter supports it) and writes it as
+// an Error with the given status code.
+func WriteError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	if rec, ok := w.(errorRecorder); ok {
+		rec.PushError(err)
+	}
+	writeError(w, r, code, err)
+}
+
+// WriteErrorStatus is the net/http equivalent of RenderErrorStatus.
+func WriteErrorStatus(w http.ResponseWriter, r *http.Request, err error) {
+	code := StatusFromError(err, http.StatusInternalServerError)
+	if rec, ok := w.(errorRecorder); ok {
+		rec.PushError(err)
+	}
+	writeError(w, r, code, publicError(code, err))
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	apiErr := &Error{
+		Err:       err.Error(),
+		RequestID: requestid.FromContext(r.Context()),
+	}
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		apiErr.Errors = fieldErrs
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(apiErr)
+}
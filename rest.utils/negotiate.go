@@ -0,0 +1,390 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MediaTypeJSON   = "application/json"
+	MediaTypeNDJSON = "application/x-ndjson"
+	MediaTypeCSV    = "text/csv"
+
+	// ColumnsQueryParam selects the CSV columns as a comma separated
+	// list of (dot separated paths of) JSON attributes.
+	ColumnsQueryParam = "columns"
+)
+
+var ErrNotAcceptable = errors.New("none of the supported media types are acceptable")
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			if mediaType != "*" {
+				continue
+			}
+			typ, subtype = "*", "*"
+		}
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// quality returns the quality of the media type according to the most
+// specific matching range, or -1 if no range matches.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	q, specificity := -1.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// Negotiate returns the offered media type best matching the Accept
+// header. The first offer is the default if the header is empty and wins
+// ties. If none of the offers is acceptable, the empty string is returned.
+func Negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return ""
+	}
+	ranges := parseAccept(accept)
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Iterator iterates the items of a list, e.g. a *mongo.Cursor.
+type Iterator interface {
+	Next(ctx context.Context) bool
+	Decode(v interface{}) error
+	Err() error
+}
+
+type RenderListOptions struct {
+	// Columns are the CSV columns. If nil, the columns are selected with
+	// the ColumnsQueryParam, defaulting to the attributes of the first
+	// item.
+	Columns []string
+}
+
+func NewRenderListOptions() *RenderListOptions {
+	return new(RenderListOptions)
+}
+
+func (opts *RenderListOptions) SetColumns(columns ...string) *RenderListOptions {
+	opts.Columns = columns
+	return opts
+}
+
+// RenderList renders the items (a slice) as JSON, NDJSON or CSV depending
+// on the Accept header of the request. It responds with 406 Not Acceptable
+// if none of the formats is acceptable.
+func RenderList(
+	c *gin.Context,
+	code int,
+	items interface{},
+	opts ...*RenderListOptions,
+) {
+	mediaType := Negotiate(c.GetHeader("Accept"),
+		MediaTypeJSON, MediaTypeNDJSON, MediaTypeCSV)
+	if mediaType == MediaTypeJSON {
+		c.JSON(code, items)
+		return
+	}
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		RenderError(c, http.StatusInternalServerError,
+			errors.New("rest: RenderList requires a slice"))
+		return
+	}
+	i := 0
+	renderItems(c, code, mediaType, func() (interface{}, bool, error) {
+		if i >= v.Len() {
+			return nil, false, nil
+		}
+		i++
+		return v.Index(i - 1).Interface(), true, nil
+	}, opts)
+}
+
+// RenderIterator renders the items of the iterator like RenderList while
+// streaming the NDJSON and CSV output. newItem returns the value the items
+// are decoded into.
+func RenderIterator(
+	c *gin.Context,
+	code int,
+	iter Iterator,
+	newItem func() interface{},
+	opts ...*RenderListOptions,
+) {
+	ctx := c.Request.Context()
+	next := func() (interface{}, bool, error) {
+		if !iter.Next(ctx) {
+			return nil, false, iter.Err()
+		}
+		item := newItem()
+		if err := iter.Decode(item); err != nil {
+			return nil, false, err
+		}
+		return item, true, nil
+	}
+	mediaType := Negotiate(c.GetHeader("Accept"),
+		MediaTypeJSON, MediaTypeNDJSON, MediaTypeCSV)
+	if mediaType == MediaTypeJSON {
+		// JSON arrays are buffered to report errors with the status.
+		items := []interface{}{}
+		for {
+			item, ok, err := next()
+			if err != nil {
+				RenderError(c, http.StatusInternalServerError, err)
+				return
+			} else if !ok {
+				break
+			}
+			items = append(items, item)
+		}
+		c.JSON(code, items)
+		return
+	}
+	renderItems(c, code, mediaType, next, opts)
+}
+
+type nextFunc func() (item interface{}, ok bool, err error)
+
+func renderItems(
+	c *gin.Context,
+	code int,
+	mediaType string,
+	next nextFunc,
+	opts []*RenderListOptions,
+) {
+	switch mediaType {
+	case MediaTypeNDJSON:
+		renderNDJSON(c, code, next)
+	case MediaTypeCSV:
+		var columns []string
+		for _, opt := range opts {
+			if opt != nil && opt.Columns != nil {
+				columns = opt.Columns
+			}
+		}
+		if columns == nil {
+			if q := c.Query(ColumnsQueryParam); q != "" {
+				for _, column := range strings.Split(q, ",") {
+					if column = strings.TrimSpace(column); column != "" {
+						columns = append(columns, column)
+					}
+				}
+			}
+		}
+		renderCSV(c, code, next, columns)
+	default:
+		RenderError(c, http.StatusNotAcceptable, ErrNotAcceptable)
+	}
+}
+
+// abortStream records an error after the response is committed; the
+// truncated body is the only signal left to the client.
+func abortStream(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func renderNDJSON(c *gin.Context, code int, next nextFunc) {
+	item, ok, err := next()
+	if err != nil {
+		RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Content-Type", MediaTypeNDJSON)
+	c.Status(code)
+	enc := json.NewEncoder(c.Writer)
+	for ok {
+		if err = enc.Encode(item); err != nil {
+			abortStream(c, err)
+			return
+		}
+		if item, ok, err = next(); err != nil {
+			abortStream(c, err)
+			return
+		}
+	}
+}
+
+// jsonObject decodes a JSON object preserving the order of the keys.
+func jsonObject(b []byte) ([]string, map[string]json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if tok, err := dec.Token(); err != nil {
+		return nil, nil, err
+	} else if tok != json.Delim('{') {
+		return nil, nil, errors.New("rest: CSV items must be JSON objects")
+	}
+	var keys []string
+	values := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := values[key]; !dup {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+	return keys, values, nil
+}
+
+// csvCell returns the value of the (dot separated) column path.
+func csvCell(values map[string]json.RawMessage, column string) string {
+	path := strings.Split(column, ".")
+	value, ok := values[path[0]]
+	for _, key := range path[1:] {
+		if !ok {
+			break
+		}
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(value, &nested) != nil {
+			return ""
+		}
+		value, ok = nested[key]
+	}
+	if !ok || len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+	if value[0] == '"' {
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			return s
+		}
+	}
+	return string(value)
+}
+
+func renderCSV(c *gin.Context, code int, next nextFunc, columns []string) {
+	item, ok, err := next()
+	if err != nil {
+		RenderError(c, http.StatusInternalServerError, err)
+		return
+	}
+	var (
+		keys   []string
+		values map[string]json.RawMessage
+	)
+	if ok {
+		b, err := json.Marshal(item)
+		if err == nil {
+			keys, values, err = jsonObject(b)
+		}
+		if err != nil {
+			RenderError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if columns == nil {
+		columns = keys
+	}
+	c.Header("Content-Type", MediaTypeCSV+"; charset=utf-8")
+	c.Status(code)
+	w := csv.NewWriter(c.Writer)
+	record := make([]string, len(columns))
+	if err = w.Write(columns); err != nil {
+		abortStream(c, err)
+		return
+	}
+	for ok {
+		for i, column := range columns {
+			record[i] = csvCell(values, column)
+		}
+		if err = w.Write(record); err != nil {
+			abortStream(c, err)
+			return
+		}
+		if item, ok, err = next(); err != nil {
+			abortStream(c, err)
+			return
+		} else if ok {
+			b, err := json.Marshal(item)
+			if err == nil {
+				_, values, err = jsonObject(b)
+			}
+			if err != nil {
+				abortStream(c, err)
+				return
+			}
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		abortStream(c, err)
+	}
+}
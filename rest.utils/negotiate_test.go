@@ -0,0 +1,185 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+	offers := []string{MediaTypeJSON, MediaTypeNDJSON, MediaTypeCSV}
+	testCases := []struct {
+		Accept   string
+		Expected string
+	}{
+		{Accept: "", Expected: MediaTypeJSON},
+		{Accept: "*/*", Expected: MediaTypeJSON},
+		{Accept: "text/csv", Expected: MediaTypeCSV},
+		{Accept: "text/*", Expected: MediaTypeCSV},
+		{Accept: "Application/X-NDJSON; q=0.9, */*;q=0.1", Expected: MediaTypeNDJSON},
+		{Accept: "text/csv;q=0.5, application/json", Expected: MediaTypeJSON},
+		{Accept: "*/*, application/json;q=0", Expected: MediaTypeNDJSON},
+		{Accept: "text/html", Expected: ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Expected, Negotiate(tc.Accept, offers...), tc.Accept)
+	}
+}
+
+type testDevice struct {
+	ID     string            `json:"id"`
+	Status string            `json:"status"`
+	Count  int               `json:"count"`
+	Attrs  map[string]string `json:"attributes,omitempty"`
+}
+
+var testDevices = []testDevice{
+	{ID: "1", Status: "accepted", Count: 2, Attrs: map[string]string{"os": "linux"}},
+	{ID: "2", Status: "pending, new", Count: 0},
+}
+
+type sliceIterator struct {
+	items []testDevice
+	i     int
+	err   error
+}
+
+func (it *sliceIterator) Next(context.Context) bool {
+	if it.i >= len(it.items) {
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *sliceIterator) Decode(v interface{}) error {
+	*(v.(*testDevice)) = it.items[it.i-1]
+	return nil
+}
+
+func (it *sliceIterator) Err() error {
+	return it.err
+}
+
+func TestRenderList(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name    string
+		Accept  string
+		Query   string
+		Options *RenderListOptions
+		Iter    *sliceIterator
+
+		Code        int
+		ContentType string
+		Body        string
+	}{{
+		Name:        "json",
+		Code:        http.StatusOK,
+		ContentType: MediaTypeJSON,
+		Body: `[{"id":"1","status":"accepted","count":2,"attributes":{"os":"linux"}},` +
+			`{"id":"2","status":"pending, new","count":0}]`,
+	}, {
+		Name:        "ndjson",
+		Accept:      MediaTypeNDJSON,
+		Code:        http.StatusOK,
+		ContentType: MediaTypeNDJSON,
+		Body: `{"id":"1","status":"accepted","count":2,"attributes":{"os":"linux"}}` + "\n" +
+			`{"id":"2","status":"pending, new","count":0}` + "\n",
+	}, {
+		Name:        "csv",
+		Accept:      MediaTypeCSV,
+		Code:        http.StatusOK,
+		ContentType: MediaTypeCSV,
+		Body: "id,status,count,attributes\n" +
+			"1,accepted,2,\"{\"\"os\"\":\"\"linux\"\"}\"\n" +
+			"2,\"pending, new\",0,\n",
+	}, {
+		Name:        "csv columns from query",
+		Accept:      MediaTypeCSV,
+		Query:       "?columns=attributes.os, id",
+		Code:        http.StatusOK,
+		ContentType: MediaTypeCSV,
+		Body:        "attributes.os,id\nlinux,1\n,2\n",
+	}, {
+		Name:        "csv columns from options",
+		Accept:      MediaTypeCSV,
+		Query:       "?columns=count",
+		Options:     NewRenderListOptions().SetColumns("status"),
+		Code:        http.StatusOK,
+		ContentType: MediaTypeCSV,
+		Body:        "status\naccepted\n\"pending, new\"\n",
+	}, {
+		Name:        "not acceptable",
+		Accept:      "application/xml",
+		Code:        http.StatusNotAcceptable,
+		ContentType: MediaTypeJSON,
+	}, {
+		Name:        "iterator ndjson",
+		Accept:      MediaTypeNDJSON,
+		Iter:        &sliceIterator{items: testDevices[1:]},
+		Code:        http.StatusOK,
+		ContentType: MediaTypeNDJSON,
+		Body:        `{"id":"2","status":"pending, new","count":0}` + "\n",
+	}, {
+		Name:        "iterator json",
+		Iter:        &sliceIterator{items: testDevices[:1]},
+		Code:        http.StatusOK,
+		ContentType: MediaTypeJSON,
+		Body:        `[{"id":"1","status":"accepted","count":2,"attributes":{"os":"linux"}}]`,
+	}, {
+		Name:        "iterator error",
+		Accept:      MediaTypeCSV,
+		Iter:        &sliceIterator{err: errors.New("cursor failed")},
+		Code:        http.StatusInternalServerError,
+		ContentType: MediaTypeJSON,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			router := gin.New()
+			router.GET("/devices", func(c *gin.Context) {
+				if tc.Iter != nil {
+					RenderIterator(c, http.StatusOK, tc.Iter,
+						func() interface{} { return new(testDevice) }, tc.Options)
+				} else {
+					RenderList(c, http.StatusOK, testDevices, tc.Options)
+				}
+			})
+			req, _ := http.NewRequest(http.MethodGet,
+				"http://localhost/devices"+tc.Query, nil)
+			if tc.Accept != "" {
+				req.Header.Set("Accept", tc.Accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.Code, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), tc.ContentType)
+			if tc.Body != "" {
+				assert.Equal(t, tc.Body, w.Body.String())
+			}
+		})
+	}
+}
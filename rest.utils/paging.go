@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -29,6 +30,15 @@ const (
 
 	pageQueryParam    = "page"
 	perPageQueryParam = "per_page"
+	CursorQueryParam  = "cursor"
+
+	hdrLink            = "Link"
+	hdrLastModified    = "Last-Modified"
+	hdrIfModifiedSince = "If-Modified-Since"
+	hdrIfNoneMatch     = "If-None-Match"
+
+	HeaderTotalCount          = "X-Total-Count"
+	HeaderTotalCountEstimated = "X-Total-Count-Estimated"
 )
 
 var (
@@ -63,25 +73,69 @@ func ParsePagingParameters(r *http.Request) (int64, int64, error) {
 		}
 	}
 
+	perPage, err = parsePerPage(q)
+	if err != nil && err != ErrPerPageLimit {
+		return -1, -1, err
+	}
+	return page, perPage, err
+}
+
+func parsePerPage(q url.Values) (int64, error) {
 	qPerPage := q.Get(perPageQueryParam)
 	if qPerPage == "" {
-		perPage = PerPageDefault
-	} else {
-		perPage, err = strconv.ParseInt(qPerPage, 10, 64)
-		if err != nil {
-			return -1, -1, errors.Errorf(
-				"invalid per_page query: \"%s\"",
-				qPerPage,
-			)
-		} else if perPage < 1 {
-			return -1, -1, errors.New("invalid per_page query: " +
-				"value must be a non-zero positive integer",
-			)
-		} else if perPage > PerPageMax {
-			return page, perPage, ErrPerPageLimit
-		}
+		return PerPageDefault, nil
+	}
+	perPage, err := strconv.ParseInt(qPerPage, 10, 64)
+	if err != nil {
+		return -1, errors.Errorf(
+			"invalid per_page query: \"%s\"",
+			qPerPage,
+		)
+	} else if perPage < 1 {
+		return -1, errors.New("invalid per_page query: " +
+			"value must be a non-zero positive integer",
+		)
+	} else if perPage > PerPageMax {
+		return perPage, ErrPerPageLimit
+	}
+	return perPage, nil
+}
+
+// ParseCursorParameters parses the parameters of search-after paginated
+// requests (see store/v2.SearchAfter) from the URL query string and returns
+// the opaque cursor, per_page or a parsing error respectively.
+func ParseCursorParameters(r *http.Request) (string, int64, error) {
+	q := r.URL.Query()
+	perPage, err := parsePerPage(q)
+	if err != nil && err != ErrPerPageLimit {
+		return "", -1, err
 	}
-	return page, perPage, nil
+	return q.Get(CursorQueryParam), perPage, err
+}
+
+// MakeCursorLinks returns the "first" and, unless the cursor of the next
+// page is empty, the "next" link of a search-after paginated request.
+func MakeCursorLinks(r *http.Request, next string) []string {
+	locationURL := url.URL{
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+		Fragment: r.URL.Fragment,
+	}
+	q := locationURL.Query()
+	q.Del(CursorQueryParam)
+	if perPage, _ := parsePerPage(q); perPage > 0 {
+		q.Set(perPageQueryParam, strconv.FormatInt(perPage, 10))
+	}
+	locationURL.RawQuery = q.Encode()
+	links := []string{fmt.Sprintf("<%s>; rel=\"first\"", locationURL.String())}
+	if next != "" {
+		q.Set(CursorQueryParam, next)
+		locationURL.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(
+			"<%s>; rel=\"next\"", locationURL.String(),
+		))
+	}
+	return links
 }
 
 type PagingHints struct {
@@ -89,10 +143,19 @@ type PagingHints struct {
 	// if provided adds another link to the last page available.
 	TotalCount *int64
 
+	// TotalCountEstimated marks TotalCount as an estimate or a lower
+	// bound (see store/v2.CountDocuments). The "last" link is omitted
+	// and HasNext decides the "next" link on the last estimated page.
+	TotalCountEstimated *bool
+
 	// HasNext instructs adding the "next" link header. This option
 	// has no effect if TotalCount is given.
 	HasNext *bool
 
+	// LastModified is the time the listed collection was last modified,
+	// it is sent as the Last-Modified header by WritePagingHeaders.
+	LastModified *time.Time
+
 	// Pagination parameters
 	Page, PerPage *int64
 }
@@ -106,6 +169,16 @@ func (h *PagingHints) SetTotalCount(totalCount int64) *PagingHints {
 	return h
 }
 
+func (h *PagingHints) SetTotalCountEstimated(estimated bool) *PagingHints {
+	h.TotalCountEstimated = &estimated
+	return h
+}
+
+func (h *PagingHints) SetLastModified(lastModified time.Time) *PagingHints {
+	h.LastModified = &lastModified
+	return h
+}
+
 func (h *PagingHints) SetHasNext(hasNext bool) *PagingHints {
 	h.HasNext = &hasNext
 	return h
@@ -121,8 +194,7 @@ func (h *PagingHints) SetPerPage(perPage int64) *PagingHints {
 	return h
 }
 
-func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error) {
-	// Parse hints
+func mergePagingHints(hints []*PagingHints) *PagingHints {
 	hint := new(PagingHints)
 	for _, h := range hints {
 		if h == nil {
@@ -134,6 +206,12 @@ func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error)
 		if h.TotalCount != nil {
 			hint.TotalCount = h.TotalCount
 		}
+		if h.TotalCountEstimated != nil {
+			hint.TotalCountEstimated = h.TotalCountEstimated
+		}
+		if h.LastModified != nil {
+			hint.LastModified = h.LastModified
+		}
 		if h.Page != nil {
 			hint.Page = h.Page
 		}
@@ -141,6 +219,11 @@ func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error)
 			hint.PerPage = h.PerPage
 		}
 	}
+	return hint
+}
+
+func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error) {
+	hint := mergePagingHints(hints)
 	if hint.Page == nil || hint.PerPage == nil {
 		page, perPage, err := ParsePagingParameters(r)
 		if err != nil {
@@ -170,10 +253,12 @@ func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error)
 		))
 	}
 
+	estimated := hint.TotalCountEstimated != nil && *hint.TotalCountEstimated
+	hasNext := hint.HasNext != nil && *hint.HasNext
 	// TotalCount takes precedence over HasNext
 	if hint.TotalCount != nil && *hint.TotalCount > 0 {
 		lastPage := (*hint.TotalCount-1) / *hint.PerPage + 1
-		if *hint.Page < lastPage {
+		if *hint.Page < lastPage || (estimated && hasNext) {
 			// Add "next" link
 			q.Set(pageQueryParam, strconv.FormatUint(uint64(*hint.Page)+1, 10))
 			locationURL.RawQuery = q.Encode()
@@ -181,13 +266,15 @@ func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error)
 				"<%s>; rel=\"next\"", locationURL.String(),
 			))
 		}
-		// Add "last" link
-		q.Set(pageQueryParam, strconv.FormatInt(lastPage, 10))
-		locationURL.RawQuery = q.Encode()
-		links = append(links, fmt.Sprintf(
-			"<%s>; rel=\"last\"", locationURL.String(),
-		))
-	} else if hint.HasNext != nil && *hint.HasNext {
+		if !estimated {
+			// Add "last" link
+			q.Set(pageQueryParam, strconv.FormatInt(lastPage, 10))
+			locationURL.RawQuery = q.Encode()
+			links = append(links, fmt.Sprintf(
+				"<%s>; rel=\"last\"", locationURL.String(),
+			))
+		}
+	} else if hasNext {
 		q.Set(pageQueryParam, strconv.FormatUint(uint64(*hint.Page)+1, 10))
 		locationURL.RawQuery = q.Encode()
 		links = append(links, fmt.Sprintf(
@@ -197,3 +284,56 @@ func MakePagingHeaders(r *http.Request, hints ...*PagingHints) ([]string, error)
 
 	return links, nil
 }
+
+// SetTotalCountHeaders sets the X-Total-Count header and, if the count is
+// an estimate or a lower bound, the X-Total-Count-Estimated header.
+func SetTotalCountHeaders(hdr http.Header, count int64, estimated bool) {
+	hdr.Set(HeaderTotalCount, strconv.FormatInt(count, 10))
+	if estimated {
+		hdr.Set(HeaderTotalCountEstimated, "true")
+	} else {
+		hdr.Del(HeaderTotalCountEstimated)
+	}
+}
+
+// WritePagingHeaders sets the Link headers (see MakePagingHeaders) and,
+// if given by the hints, the total count headers (see
+// SetTotalCountHeaders) and the Last-Modified header.
+func WritePagingHeaders(hdr http.Header, r *http.Request, hints ...*PagingHints) error {
+	hint := mergePagingHints(hints)
+	links, err := MakePagingHeaders(r, hint)
+	if err != nil {
+		return err
+	}
+	hdr.Del(hdrLink)
+	for _, link := range links {
+		hdr.Add(hdrLink, link)
+	}
+	if hint.TotalCount != nil {
+		SetTotalCountHeaders(hdr, *hint.TotalCount,
+			hint.TotalCountEstimated != nil && *hint.TotalCountEstimated)
+	}
+	if hint.LastModified != nil && !hint.LastModified.IsZero() {
+		hdr.Set(hdrLastModified, hint.LastModified.UTC().Format(http.TimeFormat))
+	}
+	return nil
+}
+
+// NotModified returns true if the request has an If-Modified-Since header
+// and the collection was not modified since, such that the handler can
+// respond with 304 Not Modified instead of listing the page. The
+// comparison has the one second precision of the header.
+func NotModified(r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	} else if r.Header.Get(hdrIfNoneMatch) != "" {
+		// If-None-Match takes precedence (RFC 9110, section 13.1.3).
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get(hdrIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
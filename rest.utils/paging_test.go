@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -144,6 +145,42 @@ func TestMakePagingHeaders(t *testing.T) {
 			`</foobar?page=4&per_page=10>; rel="next"`,
 			`</foobar?page=13&per_page=10>; rel="last"`,
 		},
+	}, {
+		Name: "ok, estimated",
+		URL:  url.URL{Path: "/foobar", RawQuery: "page=3&per_page=10"},
+		Hints: NewPagingHints().
+			SetTotalCount(100).
+			SetTotalCountEstimated(true),
+
+		Links: []string{
+			`</foobar?page=1&per_page=10>; rel="first"`,
+			`</foobar?page=2&per_page=10>; rel="prev"`,
+			`</foobar?page=4&per_page=10>; rel="next"`,
+		},
+	}, {
+		Name: "ok, estimated last page has next",
+		URL:  url.URL{Path: "/foobar", RawQuery: "page=10&per_page=10"},
+		Hints: NewPagingHints().
+			SetTotalCount(100).
+			SetTotalCountEstimated(true).
+			SetHasNext(true),
+
+		Links: []string{
+			`</foobar?page=1&per_page=10>; rel="first"`,
+			`</foobar?page=9&per_page=10>; rel="prev"`,
+			`</foobar?page=11&per_page=10>; rel="next"`,
+		},
+	}, {
+		Name: "ok, estimated last page",
+		URL:  url.URL{Path: "/foobar", RawQuery: "page=10&per_page=10"},
+		Hints: NewPagingHints().
+			SetTotalCount(100).
+			SetTotalCountEstimated(true),
+
+		Links: []string{
+			`</foobar?page=1&per_page=10>; rel="first"`,
+			`</foobar?page=9&per_page=10>; rel="prev"`,
+		},
 	}, {
 		Name: "ok, defaults",
 		URL:  url.URL{Path: "/foobar"},
@@ -184,3 +221,141 @@ func TestMakePagingHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTotalCountHeaders(t *testing.T) {
+	hdr := http.Header{}
+	SetTotalCountHeaders(hdr, 10000, true)
+	assert.Equal(t, "10000", hdr.Get(HeaderTotalCount))
+	assert.Equal(t, "true", hdr.Get(HeaderTotalCountEstimated))
+
+	SetTotalCountHeaders(hdr, 42, false)
+	assert.Equal(t, "42", hdr.Get(HeaderTotalCount))
+	assert.Empty(t, hdr.Values(HeaderTotalCountEstimated))
+}
+
+func TestParseCursorParameters(t *testing.T) {
+	req := &http.Request{URL: &url.URL{RawQuery: "cursor=abc&per_page=10"}}
+	cursor, perPage, err := ParseCursorParameters(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", cursor)
+	assert.Equal(t, int64(10), perPage)
+
+	req = &http.Request{URL: &url.URL{}}
+	cursor, perPage, err = ParseCursorParameters(req)
+	assert.NoError(t, err)
+	assert.Empty(t, cursor)
+	assert.Equal(t, int64(PerPageDefault), perPage)
+
+	req = &http.Request{URL: &url.URL{RawQuery: "per_page=1000"}}
+	_, perPage, err = ParseCursorParameters(req)
+	assert.ErrorIs(t, err, ErrPerPageLimit)
+	assert.Equal(t, int64(1000), perPage)
+
+	req = &http.Request{URL: &url.URL{RawQuery: "per_page=foo"}}
+	_, _, err = ParseCursorParameters(req)
+	assert.EqualError(t, err, `invalid per_page query: "foo"`)
+}
+
+func TestMakeCursorLinks(t *testing.T) {
+	req := &http.Request{URL: &url.URL{
+		Path:     "/foobar",
+		RawQuery: "cursor=abc&status=accepted",
+	}}
+	assert.Equal(t, []string{
+		`</foobar?per_page=20&status=accepted>; rel="first"`,
+		`</foobar?cursor=def&per_page=20&status=accepted>; rel="next"`,
+	}, MakeCursorLinks(req, "def"))
+	assert.Equal(t, []string{
+		`</foobar?per_page=20&status=accepted>; rel="first"`,
+	}, MakeCursorLinks(req, ""))
+}
+
+func TestWritePagingHeaders(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 12, 30, 15, 500, time.FixedZone("CET", 3600))
+	req := &http.Request{URL: &url.URL{Path: "/foobar", RawQuery: "page=2&per_page=10"}}
+	hdr := http.Header{}
+	err := WritePagingHeaders(hdr, req, NewPagingHints().
+		SetTotalCount(25).
+		SetLastModified(lastModified))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			`</foobar?page=1&per_page=10>; rel="first"`,
+			`</foobar?page=1&per_page=10>; rel="prev"`,
+			`</foobar?page=3&per_page=10>; rel="next"`,
+			`</foobar?page=3&per_page=10>; rel="last"`,
+		}, hdr.Values("Link"))
+		assert.Equal(t, "25", hdr.Get(HeaderTotalCount))
+		assert.Equal(t, "Fri, 01 Mar 2024 11:30:15 GMT", hdr.Get("Last-Modified"))
+	}
+
+	hdr = http.Header{}
+	err = WritePagingHeaders(hdr, req)
+	if assert.NoError(t, err) {
+		assert.Len(t, hdr.Values("Link"), 2)
+		assert.Empty(t, hdr.Get(HeaderTotalCount))
+		assert.Empty(t, hdr.Get("Last-Modified"))
+	}
+
+	req = &http.Request{URL: &url.URL{Path: "/foobar", RawQuery: "page=bad"}}
+	assert.Error(t, WritePagingHeaders(http.Header{}, req))
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 12, 30, 15, 500, time.UTC)
+	testCases := []struct {
+		Name    string
+		Method  string
+		Headers map[string]string
+
+		NotModified bool
+	}{{
+		Name:   "unconditional",
+		Method: http.MethodGet,
+	}, {
+		Name:   "not modified",
+		Method: http.MethodGet,
+		Headers: map[string]string{
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:30:15 GMT",
+		},
+		NotModified: true,
+	}, {
+		Name:   "modified",
+		Method: http.MethodGet,
+		Headers: map[string]string{
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:30:14 GMT",
+		},
+	}, {
+		Name:   "If-None-Match takes precedence",
+		Method: http.MethodGet,
+		Headers: map[string]string{
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:30:15 GMT",
+			"If-None-Match":     `"abc"`,
+		},
+	}, {
+		Name:   "not GET",
+		Method: http.MethodPost,
+		Headers: map[string]string{
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:30:15 GMT",
+		},
+	}, {
+		Name:   "invalid date",
+		Method: http.MethodGet,
+		Headers: map[string]string{
+			"If-Modified-Since": "yesterday",
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			req := &http.Request{Method: tc.Method, Header: http.Header{}}
+			for key, value := range tc.Headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tc.NotModified, NotModified(req, lastModified))
+		})
+	}
+	assert.False(t, NotModified(&http.Request{
+		Method: http.MethodGet,
+		Header: http.Header{"If-Modified-Since": {"Fri, 01 Mar 2024 12:30:15 GMT"}},
+	}, time.Time{}))
+}
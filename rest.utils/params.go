@@ -0,0 +1,121 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidUUID = errors.New("invalid UUID")
+)
+
+// ParamValidator validates the value of a path parameter; the error message
+// is rendered to the client.
+type ParamValidator func(value string) error
+
+// parseUUID parses the UUID in the canonical form
+// (xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx); uuid.Parse also accepts the
+// urn:uuid:, braced and undashed forms.
+func parseUUID(value string) (uuid.UUID, error) {
+	if len(value) != 36 {
+		return uuid.Nil, errInvalidUUID
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, errInvalidUUID
+	}
+	return id, nil
+}
+
+// UUIDParam validates the path parameter as a UUID in the canonical form.
+func UUIDParam(value string) error {
+	_, err := parseUUID(value)
+	return err
+}
+
+// MatchParam returns a ParamValidator matching the whole parameter against
+// the regular expression; the pattern is anchored at both ends.
+func MatchParam(pattern string) ParamValidator {
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	msg := "does not match " + pattern
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return errors.New(msg)
+		}
+		return nil
+	}
+}
+
+// ValidateParams returns a middleware validating the path parameters
+// before the handler runs. Requests with invalid parameters are rejected
+// with status 400 listing the invalid parameters as FieldErrors.
+// Parameters missing from the route are not validated.
+//
+//	devices.GET("/:id", rest.ValidateParams(map[string]rest.ParamValidator{
+//		"id": rest.UUIDParam,
+//	}), handler.GetDevice)
+func ValidateParams(validators map[string]ParamValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var errs FieldErrors
+		for _, param := range c.Params {
+			validate, ok := validators[param.Key]
+			if !ok {
+				continue
+			}
+			if err := validate(param.Value); err != nil {
+				errs = append(errs, FieldError{
+					Field:   param.Key,
+					Message: err.Error(),
+					Code:    CodeInvalidValue,
+				})
+			}
+		}
+		if len(errs) > 0 {
+			RenderError(c, http.StatusBadRequest,
+				errors.WithMessage(errs, "invalid path parameters"))
+			c.Abort()
+		}
+	}
+}
+
+// ValidateUUIDParams returns a middleware validating the path parameters
+// as UUIDs, see ValidateParams.
+func ValidateUUIDParams(names ...string) gin.HandlerFunc {
+	validators := make(map[string]ParamValidator, len(names))
+	for _, name := range names {
+		validators[name] = UUIDParam
+	}
+	return ValidateParams(validators)
+}
+
+// ParamUUID returns the path parameter parsed as UUID in the canonical
+// form. Invalid values are reported as FieldErrors.
+func ParamUUID(c *gin.Context, name string) (uuid.UUID, error) {
+	id, err := parseUUID(c.Param(name))
+	if err != nil {
+		return uuid.Nil, FieldErrors{{
+			Field:   name,
+			Message: errInvalidUUID.Error(),
+			Code:    CodeInvalidValue,
+		}}
+	}
+	return id, nil
+}
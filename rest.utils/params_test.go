@@ -0,0 +1,128 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParams(t *testing.T) {
+	t.Parallel()
+	router := gin.New()
+	router.GET("/devices/:id",
+		ValidateUUIDParams("id", "not_declared"),
+		func(c *gin.Context) {
+			id, err := ParamUUID(c, "id")
+			if assert.NoError(t, err) {
+				c.String(http.StatusOK, id.String())
+			}
+		})
+	router.GET("/devices/:id/artifacts/:name",
+		ValidateParams(map[string]ParamValidator{
+			"id":   UUIDParam,
+			"name": MatchParam("[a-z0-9-]+"),
+		}),
+		func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+
+	id := uuid.NewString()
+	testCases := []struct {
+		Name string
+		Path string
+
+		Status int
+		Fields []string
+	}{{
+		Name:   "ok",
+		Path:   "/devices/" + id,
+		Status: http.StatusOK,
+	}, {
+		Name:   "invalid UUID",
+		Path:   "/devices/123",
+		Status: http.StatusBadRequest,
+		Fields: []string{"id"},
+	}, {
+		Name:   "ok, multiple parameters",
+		Path:   "/devices/" + id + "/artifacts/foo-1",
+		Status: http.StatusNoContent,
+	}, {
+		Name:   "multiple invalid parameters",
+		Path:   "/devices/123/artifacts/Foo",
+		Status: http.StatusBadRequest,
+		Fields: []string{"id", "name"},
+	}, {
+		Name:   "partial match",
+		Path:   "/devices/" + id + "/artifacts/Foo-1",
+		Status: http.StatusBadRequest,
+		Fields: []string{"name"},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost"+tc.Path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.Status, w.Code)
+			if tc.Status == http.StatusOK {
+				assert.Equal(t, id, w.Body.String())
+			}
+			if tc.Fields == nil {
+				return
+			}
+			var apiErr Error
+			if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &apiErr)) {
+				fields := make([]string, len(apiErr.Errors))
+				for i, fieldErr := range apiErr.Errors {
+					fields[i] = fieldErr.Field
+					assert.Equal(t, CodeInvalidValue, fieldErr.Code)
+				}
+				assert.Equal(t, tc.Fields, fields)
+			}
+		})
+	}
+}
+
+func TestParamUUID(t *testing.T) {
+	t.Parallel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Params = gin.Params{{Key: "id", Value: "foo"}}
+	_, err := ParamUUID(c, "id")
+	assert.EqualError(t, err, "id: invalid UUID")
+}
+
+func TestUUIDParam(t *testing.T) {
+	t.Parallel()
+	id := uuid.New()
+	assert.NoError(t, UUIDParam(id.String()))
+	for _, invalid := range []string{
+		"",
+		"foo",
+		"urn:uuid:" + id.String(),
+		"{" + id.String() + "}",
+		strings.ReplaceAll(id.String(), "-", ""),
+	} {
+		assert.ErrorIs(t, UUIDParam(invalid), errInvalidUUID, invalid)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mendersoftware/go-lib-micro/units"
+)
+
+const (
+	CodeInvalidDuration = "invalid_duration"
+	CodeInvalidByteSize = "invalid_byte_size"
+	CodeRequired        = "required"
+	CodeInvalidValue    = "invalid_value"
+	CodeValueNotAllowed = "value_not_allowed"
+)
+
+// ParseDurationQuery parses the query parameter as a duration (see
+// units.ParseDuration), returning def if the parameter is absent. Invalid
+// values are reported as FieldErrors.
+func ParseDurationQuery(r *http.Request, name string, def time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := units.ParseDuration(value)
+	if err != nil {
+		return def, FieldErrors{{
+			Field:   name,
+			Message: err.Error(),
+			Code:    CodeInvalidDuration,
+		}}
+	}
+	return d, nil
+}
+
+// ParseByteSizeQuery parses the query parameter as a byte size (see
+// units.ParseByteSize), returning def if the parameter is absent. Invalid
+// values are reported as FieldErrors.
+func ParseByteSizeQuery(r *http.Request, name string, def int64) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := units.ParseByteSize(value)
+	if err != nil {
+		return def, FieldErrors{{
+			Field:   name,
+			Message: err.Error(),
+			Code:    CodeInvalidByteSize,
+		}}
+	}
+	return n, nil
+}
+
+// QueryValue are the types of the query parameters parsed by Query,
+// including enumerations based on strings or integers. Times are parsed as
+// RFC3339.
+type QueryValue interface {
+	~string | ~bool |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 |
+		uuid.UUID | time.Time
+}
+
+type QueryOptions[T QueryValue] struct {
+	// Required rejects requests without the parameter.
+	Required *bool
+	// Default is the value of absent parameters.
+	Default *T
+	// Allowed lists the accepted values, e.g. of an enumeration.
+	Allowed []T
+}
+
+func NewQueryOptions[T QueryValue]() *QueryOptions[T] {
+	return new(QueryOptions[T])
+}
+
+func (opts *QueryOptions[T]) SetRequired(required bool) *QueryOptions[T] {
+	opts.Required = &required
+	return opts
+}
+
+func (opts *QueryOptions[T]) SetDefault(value T) *QueryOptions[T] {
+	opts.Default = &value
+	return opts
+}
+
+func (opts *QueryOptions[T]) SetAllowed(values ...T) *QueryOptions[T] {
+	opts.Allowed = values
+	return opts
+}
+
+func mergeQueryOptions[T QueryValue](opts []*QueryOptions[T]) *QueryOptions[T] {
+	opt := NewQueryOptions[T]().
+		SetRequired(false)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Required != nil {
+			opt.Required = o.Required
+		}
+		if o.Default != nil {
+			opt.Default = o.Default
+		}
+		if o.Allowed != nil {
+			opt.Allowed = o.Allowed
+		}
+	}
+	return opt
+}
+
+func parseQueryValue(value string, ptr interface{}) error {
+	switch p := ptr.(type) {
+	case *uuid.UUID:
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return err
+		}
+		*p = id
+		return nil
+	case *time.Time:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		*p = t
+		return nil
+	}
+	v := reflect.ValueOf(ptr).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+func queryTypeName(ptr interface{}) string {
+	switch ptr.(type) {
+	case *uuid.UUID:
+		return "UUID"
+	case *time.Time:
+		return "RFC3339 time"
+	}
+	switch reflect.ValueOf(ptr).Elem().Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// Query parses the query parameter of the request (e.g. c.Request of gin
+// handlers) as T, returning the Default (or the zero value) if the
+// parameter is absent. Invalid values are reported as FieldErrors.
+//
+//	status, err := rest.Query(r, "status", rest.NewQueryOptions[model.Status]().
+//		SetAllowed(model.StatusPending, model.StatusDone))
+func Query[T QueryValue](r *http.Request, name string, opts ...*QueryOptions[T]) (T, error) {
+	opt := mergeQueryOptions(opts)
+	var value T
+	if opt.Default != nil {
+		value = *opt.Default
+	}
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		if *opt.Required {
+			return value, FieldErrors{{
+				Field:   name,
+				Message: "parameter is required",
+				Code:    CodeRequired,
+			}}
+		}
+		return value, nil
+	}
+	var parsed T
+	if err := parseQueryValue(raw, &parsed); err != nil {
+		return value, FieldErrors{{
+			Field:   name,
+			Message: "invalid " + queryTypeName(&parsed) + " value",
+			Code:    CodeInvalidValue,
+		}}
+	}
+	if opt.Allowed != nil {
+		var allowed bool
+		for _, a := range opt.Allowed {
+			if a == parsed {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			values := make([]string, len(opt.Allowed))
+			for i, a := range opt.Allowed {
+				values[i] = fmt.Sprint(a)
+			}
+			return value, FieldErrors{{
+				Field:   name,
+				Message: "must be one of: " + strings.Join(values, ", "),
+				Code:    CodeValueNotAllowed,
+			}}
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUnitsQuery(t *testing.T) {
+	t.Parallel()
+	req, _ := http.NewRequest(http.MethodGet,
+		"http://localhost/logs?since=1d&limit=1.5MB&bad=soon", nil)
+
+	d, err := ParseDurationQuery(req, "since", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, d)
+	d, err = ParseDurationQuery(req, "missing", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, d)
+	_, err = ParseDurationQuery(req, "bad", time.Hour)
+	var fieldErrs FieldErrors
+	if assert.True(t, errors.As(err, &fieldErrs)) {
+		assert.Equal(t, "bad", fieldErrs[0].Field)
+		assert.Equal(t, CodeInvalidDuration, fieldErrs[0].Code)
+	}
+
+	n, err := ParseByteSizeQuery(req, "limit", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500000), n)
+	n, err = ParseByteSizeQuery(req, "missing", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	_, err = ParseByteSizeQuery(req, "bad", 0)
+	if assert.True(t, errors.As(err, &fieldErrs)) {
+		assert.Equal(t, CodeInvalidByteSize, fieldErrs[0].Code)
+	}
+}
+
+type testStatus string
+
+const (
+	testStatusPending testStatus = "pending"
+	testStatusDone    testStatus = "done"
+)
+
+func assertQueryError(t *testing.T, err error, code string) {
+	t.Helper()
+	var fieldErrs FieldErrors
+	if assert.True(t, errors.As(err, &fieldErrs), "expected FieldErrors") &&
+		assert.Len(t, fieldErrs, 1) {
+		assert.Equal(t, code, fieldErrs[0].Code)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	id := uuid.New()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/devices?"+
+		"name=foo&page=2&negative=-1&verbose=true&id="+id.String()+
+		"&since=2024-01-02T03:04:05Z&ratio=0.5&status=done&bad=foo", nil)
+
+	name, err := Query[string](req, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", name)
+
+	page, err := Query[int](req, "page")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, page)
+	page, err = Query(req, "missing", NewQueryOptions[int]().SetDefault(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, page)
+	page, err = Query(req, "bad", NewQueryOptions[int]().SetDefault(1))
+	assertQueryError(t, err, CodeInvalidValue)
+	assert.Equal(t, 1, page)
+	_, err = Query[uint](req, "negative")
+	assertQueryError(t, err, CodeInvalidValue)
+	_, err = Query[int8](req, "since")
+	assertQueryError(t, err, CodeInvalidValue)
+
+	verbose, err := Query[bool](req, "verbose")
+	assert.NoError(t, err)
+	assert.True(t, verbose)
+	_, err = Query[bool](req, "bad")
+	assertQueryError(t, err, CodeInvalidValue)
+
+	gotID, err := Query[uuid.UUID](req, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, id, gotID)
+	_, err = Query[uuid.UUID](req, "bad")
+	assertQueryError(t, err, CodeInvalidValue)
+
+	since, err := Query[time.Time](req, "since")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), since)
+
+	ratio, err := Query[float64](req, "ratio")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, ratio)
+
+	statusOpts := NewQueryOptions[testStatus]().
+		SetAllowed(testStatusPending, testStatusDone)
+	status, err := Query(req, "status", statusOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, testStatusDone, status)
+	_, err = Query(req, "bad", statusOpts)
+	assertQueryError(t, err, CodeValueNotAllowed)
+	assert.EqualError(t, err, "bad: must be one of: pending, done")
+
+	_, err = Query(req, "missing", NewQueryOptions[string]().SetRequired(true))
+	assertQueryError(t, err, CodeRequired)
+}
+
+func TestQueryGin(t *testing.T) {
+	t.Parallel()
+	router := gin.New()
+	router.GET("/test", func(c *gin.Context) {
+		page, err := Query(c.Request, "page", NewQueryOptions[int]().SetDefault(1))
+		if err != nil {
+			RenderError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/test?page=3", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/test?page=x", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), CodeInvalidValue)
+}
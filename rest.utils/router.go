@@ -0,0 +1,225 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Router registers routes on a gin router answering HEAD requests for GET
+// routes and OPTIONS requests for all routes. HEAD requests replay the GET
+// handlers with the response body discarded. OPTIONS requests are answered
+// with 204 No Content and an Allow header listing the methods of the path.
+//
+// The OPTIONS route is registered on the router the path is first
+// registered with, so the middlewares of that router apply to it.
+type Router struct {
+	gin.IRouter
+	base    string
+	methods *routeMethods
+}
+
+type routeMethods struct {
+	sync.RWMutex
+	paths map[string]*routeEntry
+}
+
+type routeEntry struct {
+	methods  map[string]struct{}
+	autoHead bool
+}
+
+// NewRouter wraps the gin router (e.g. *gin.Engine or *gin.RouterGroup).
+func NewRouter(router gin.IRouter) *Router {
+	return &Router{
+		IRouter: router,
+		base:    basePath(router),
+		methods: &routeMethods{paths: make(map[string]*routeEntry)},
+	}
+}
+
+func basePath(router gin.IRouter) string {
+	if r, ok := router.(interface{ BasePath() string }); ok {
+		return r.BasePath()
+	}
+	return "/"
+}
+
+func joinPaths(base, relative string) string {
+	if relative == "" {
+		return base
+	}
+	joined := path.Join(base, relative)
+	if strings.HasSuffix(relative, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// Group creates a route group sharing the set of registered methods with
+// the router.
+func (r *Router) Group(relativePath string, handlers ...gin.HandlerFunc) *Router {
+	group := r.IRouter.Group(relativePath, handlers...)
+	return &Router{
+		IRouter: group,
+		base:    joinPaths(r.base, relativePath),
+		methods: r.methods,
+	}
+}
+
+// Allow returns the methods registered for the route path in the format
+// of the Allow header.
+func (r *Router) Allow(absolutePath string) string {
+	r.methods.RLock()
+	defer r.methods.RUnlock()
+	if entry, ok := r.methods.paths[absolutePath]; ok {
+		return allowHeader(entry.methods)
+	}
+	return ""
+}
+
+func allowHeader(methods map[string]struct{}) string {
+	allow := make([]string, 0, len(methods))
+	for method := range methods {
+		allow = append(allow, method)
+	}
+	sort.Strings(allow)
+	return strings.Join(allow, ", ")
+}
+
+func (r *Router) Handle(
+	method, relativePath string,
+	handlers ...gin.HandlerFunc,
+) gin.IRoutes {
+	absolutePath := joinPaths(r.base, relativePath)
+	r.methods.Lock()
+	entry, exists := r.methods.paths[absolutePath]
+	if !exists {
+		entry = &routeEntry{methods: make(map[string]struct{})}
+		r.methods.paths[absolutePath] = entry
+	}
+	if method == http.MethodHead && entry.autoHead {
+		r.methods.Unlock()
+		panic("rest: HEAD " + absolutePath +
+			" must be registered before the GET route")
+	}
+	_, hasHead := entry.methods[http.MethodHead]
+	entry.methods[method] = struct{}{}
+	addHead := method == http.MethodGet && !hasHead
+	if addHead {
+		entry.methods[http.MethodHead] = struct{}{}
+		entry.autoHead = true
+	}
+	addOptions := !exists && method != http.MethodOptions
+	if addOptions {
+		entry.methods[http.MethodOptions] = struct{}{}
+	}
+	r.methods.Unlock()
+
+	r.IRouter.Handle(method, relativePath, handlers...)
+	if addHead {
+		head := make(gin.HandlersChain, 0, len(handlers)+1)
+		head = append(head, discardBody)
+		head = append(head, handlers...)
+		r.IRouter.Handle(http.MethodHead, relativePath, head...)
+	}
+	if addOptions {
+		r.IRouter.Handle(http.MethodOptions, relativePath, func(c *gin.Context) {
+			c.Header("Allow", r.Allow(absolutePath))
+			c.Status(http.StatusNoContent)
+		})
+	}
+	return r
+}
+
+// anyMethods are the methods registered by Any; HEAD and OPTIONS come
+// first so they are not registered automatically.
+var anyMethods = []string{
+	http.MethodHead, http.MethodOptions,
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodTrace,
+}
+
+func (r *Router) Any(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Match(anyMethods, relativePath, handlers...)
+}
+
+func (r *Router) Match(
+	methods []string,
+	relativePath string,
+	handlers ...gin.HandlerFunc,
+) gin.IRoutes {
+	for _, method := range methods {
+		r.Handle(method, relativePath, handlers...)
+	}
+	return r
+}
+
+func (r *Router) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (r *Router) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (r *Router) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (r *Router) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (r *Router) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+// HEAD overrides the automatic HEAD handler; it must be registered before
+// the GET route.
+func (r *Router) HEAD(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodHead, relativePath, handlers...)
+}
+
+// OPTIONS overrides the automatic OPTIONS handler; it must be registered
+// before any other method of the path.
+func (r *Router) OPTIONS(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return r.Handle(http.MethodOptions, relativePath, handlers...)
+}
+
+// headWriter discards the response body of HEAD requests.
+type headWriter struct {
+	gin.ResponseWriter
+}
+
+func (w headWriter) Write(b []byte) (int, error) {
+	w.ResponseWriter.WriteHeaderNow()
+	return len(b), nil
+}
+
+func (w headWriter) WriteString(s string) (int, error) {
+	w.ResponseWriter.WriteHeaderNow()
+	return len(s), nil
+}
+
+func discardBody(c *gin.Context) {
+	c.Writer = headWriter{ResponseWriter: c.Writer}
+}
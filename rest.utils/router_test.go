@@ -0,0 +1,124 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	engine := gin.New()
+	router := NewRouter(engine)
+	var calledMiddleware int
+	api := router.Group("/api/v1", func(c *gin.Context) {
+		calledMiddleware++
+	})
+	api.GET("/devices/:id", func(c *gin.Context) {
+		c.Header("X-Device", c.Param("id"))
+		c.JSON(http.StatusOK, map[string]string{"id": c.Param("id")})
+	})
+	api.DELETE("/devices/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	api.POST("/devices", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	api.HEAD("/status", func(c *gin.Context) {
+		c.Header("X-Custom-Head", "true")
+		c.Status(http.StatusOK)
+	})
+	api.GET("/status", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	api.OPTIONS("/custom", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+	api.PUT("/custom", func(c *gin.Context) {})
+
+	testCases := []struct {
+		Name   string
+		Method string
+		Path   string
+
+		Status  int
+		Headers map[string]string
+		Body    string
+	}{{
+		Name:   "GET",
+		Method: http.MethodGet,
+		Path:   "/api/v1/devices/123",
+		Status: http.StatusOK,
+		Body:   `{"id":"123"}`,
+	}, {
+		Name:    "HEAD replays GET",
+		Method:  http.MethodHead,
+		Path:    "/api/v1/devices/123",
+		Status:  http.StatusOK,
+		Headers: map[string]string{"X-Device": "123"},
+	}, {
+		Name:    "OPTIONS",
+		Method:  http.MethodOptions,
+		Path:    "/api/v1/devices/123",
+		Status:  http.StatusNoContent,
+		Headers: map[string]string{"Allow": "DELETE, GET, HEAD, OPTIONS"},
+	}, {
+		Name:    "OPTIONS without GET",
+		Method:  http.MethodOptions,
+		Path:    "/api/v1/devices",
+		Status:  http.StatusNoContent,
+		Headers: map[string]string{"Allow": "OPTIONS, POST"},
+	}, {
+		Name:   "HEAD not allowed",
+		Method: http.MethodHead,
+		Path:   "/api/v1/devices",
+		Status: http.StatusNotFound,
+	}, {
+		Name:    "explicit HEAD",
+		Method:  http.MethodHead,
+		Path:    "/api/v1/status",
+		Status:  http.StatusOK,
+		Headers: map[string]string{"X-Custom-Head": "true"},
+	}, {
+		Name:   "explicit OPTIONS",
+		Method: http.MethodOptions,
+		Path:   "/api/v1/custom",
+		Status: http.StatusTeapot,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			calledMiddleware = 0
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.Method, "http://localhost"+tc.Path, nil)
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, tc.Status, w.Code)
+			for key, value := range tc.Headers {
+				assert.Equal(t, value, w.Header().Get(key))
+			}
+			if tc.Status != http.StatusNotFound {
+				assert.Equal(t, tc.Body, w.Body.String())
+				assert.Equal(t, 1, calledMiddleware)
+			}
+		})
+	}
+	assert.Equal(t, "OPTIONS, PUT", router.Allow("/api/v1/custom"))
+	assert.Panics(t, func() {
+		api.HEAD("/devices/:id", func(c *gin.Context) {})
+	})
+}
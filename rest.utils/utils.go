@@ -15,17 +15,82 @@
 package rest
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/mendersoftware/go-lib-micro/requestid"
 )
 
+// RenderError pushes err to the gin context and renders it as an Error
+// with the given status code. If err is (or wraps) FieldErrors, the
+// individual errors are included in the response.
 func RenderError(c *gin.Context, code int, err error) {
-	ctx := c.Request.Context()
 	_ = c.Error(err)
-	err = &Error{
+	renderError(c, code, err)
+}
+
+func renderError(c *gin.Context, code int, err error) {
+	ctx := c.Request.Context()
+	apiErr := &Error{
 		Err:       err.Error(),
 		RequestID: requestid.FromContext(ctx),
 	}
-	c.JSON(code, err)
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		apiErr.Errors = fieldErrs
+	}
+	c.JSON(code, apiErr)
+}
+
+// StatusCoder is implemented by errors suggesting the HTTP status of the
+// response, such as the errors returned by store/v2.MapError.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// StatusFromError returns the status suggested by err (see StatusCoder)
+// or def.
+func StatusFromError(err error, def int) int {
+	var coder StatusCoder
+	if errors.As(err, &coder) {
+		if code := coder.StatusCode(); code != 0 {
+			return code
+		}
+	}
+	return def
+}
+
+// publicError returns the error shown to the client for the status: server
+// errors are replaced by a generic error.
+func publicError(code int, err error) error {
+	if code >= http.StatusInternalServerError {
+		return &internalError{err}
+	}
+	return err
+}
+
+// internalError renders as "internal error" and unwraps to the cause,
+// which is logged by the access log.
+type internalError struct {
+	err error
+}
+
+func (err *internalError) Error() string {
+	return "internal error"
+}
+
+func (err *internalError) Unwrap() error {
+	return err.err
+}
+
+// RenderErrorStatus renders err with the status suggested by the error
+// (see StatusFromError), or 500 Internal Server Error. The message of
+// server errors is replaced by "internal error"; the error is still
+// pushed to the gin context for the access log.
+func RenderErrorStatus(c *gin.Context, err error) {
+	code := StatusFromError(err, http.StatusInternalServerError)
+	_ = c.Error(err)
+	renderError(c, code, publicError(code, err))
 }
@@ -41,3 +41,91 @@ func TestRenderError(t *testing.T) {
 	_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
 	assert.EqualError(t, apiErr, "test error")
 }
+
+func TestRenderFieldErrors(t *testing.T) {
+	fieldErrs := FieldErrors{
+		{Field: "name", Message: "is required"},
+		{Message: "too many attributes", Code: "limit"},
+	}
+	assert.EqualError(t, fieldErrs, "name: is required; too many attributes")
+
+	engine := gin.New()
+	engine.GET("/test", func(c *gin.Context) {
+		err := errors.Wrap(fieldErrs, "invalid request")
+		RenderError(c, http.StatusBadRequest, err)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost/test", nil)
+	engine.ServeHTTP(w, req)
+
+	apiErr := Error{}
+	_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.EqualError(t, apiErr,
+		"invalid request: name: is required; too many attributes")
+	assert.Equal(t, []FieldError(fieldErrs), apiErr.Errors)
+}
+
+type statusError struct {
+	status int
+}
+
+func (err statusError) Error() string {
+	return "status error"
+}
+
+func (err statusError) StatusCode() int {
+	return err.status
+}
+
+func TestRenderErrorStatus(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Err  error
+
+		Status  int
+		Message string
+	}{{
+		Name:    "client error",
+		Err:     errors.Wrap(statusError{status: http.StatusConflict}, "conflict"),
+		Status:  http.StatusConflict,
+		Message: "conflict: status error",
+	}, {
+		Name:    "server error",
+		Err:     statusError{status: http.StatusServiceUnavailable},
+		Status:  http.StatusServiceUnavailable,
+		Message: "internal error",
+	}, {
+		Name:    "no status",
+		Err:     errors.New("driver error"),
+		Status:  http.StatusInternalServerError,
+		Message: "internal error",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			var ginErrs []string
+			engine := gin.New()
+			engine.GET("/test", func(c *gin.Context) {
+				RenderErrorStatus(c, tc.Err)
+				ginErrs = c.Errors.Errors()
+			})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://localhost/test", nil)
+			engine.ServeHTTP(w, req)
+
+			apiErr := Error{}
+			_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
+			assert.Equal(t, tc.Status, w.Code)
+			assert.EqualError(t, apiErr, tc.Message)
+			assert.Equal(t, []string{tc.Err.Error()}, ginErrs)
+
+			w = httptest.NewRecorder()
+			WriteErrorStatus(w, req, tc.Err)
+			_ = json.Unmarshal(w.Body.Bytes(), &apiErr)
+			assert.Equal(t, tc.Status, w.Code)
+			assert.EqualError(t, apiErr, tc.Message)
+		})
+	}
+}
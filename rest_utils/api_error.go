@@ -16,12 +16,28 @@ package rest_utils
 import (
 	"encoding/json"
 	"io"
+
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
 )
 
+// FieldError describes a single problem with the request.
+type FieldError = rest.FieldError
+
+// FieldErrors is an error reporting multiple problems at once; the
+// RestErrWith* helpers include the list in the "errors" attribute of the
+// ApiError.
+type FieldErrors = rest.FieldErrors
+
 // ApiError wraps errors returned by our APIs
+//
+// Deprecated: ApiError is kept for the go-json-rest helpers; new code
+// should use rest.Error (package rest.utils) which has the same JSON
+// representation.
 type ApiError struct {
 	Err   string `json:"error"`
 	ReqId string `json:"request_id,omitempty"`
+	// Errors optionally lists the individual problems with the request.
+	Errors []FieldError `json:"errors,omitempty"`
 }
 
 func (ae *ApiError) Error() string {
@@ -62,6 +62,8 @@ func MsgQueryParmOneOf(name string, allowed []string) string {
 }
 
 // query param parsing/validation
+//
+// Deprecated: use rest.Query of the rest.utils package.
 func ParseQueryParmUInt(
 	r *rest.Request,
 	name string,
@@ -90,6 +92,7 @@ func ParseQueryParmUInt(
 	return uintVal, nil
 }
 
+// Deprecated: use rest.Query of the rest.utils package.
 func ParseQueryParmBool(r *rest.Request, name string, required bool, def *bool) (*bool, error) {
 	strVal := r.URL.Query().Get(name)
 
@@ -109,6 +112,7 @@ func ParseQueryParmBool(r *rest.Request, name string, required bool, def *bool)
 	return &boolVal, nil
 }
 
+// Deprecated: use rest.Query of the rest.utils package.
 func ParseQueryParmStr(
 	r *rest.Request,
 	name string,
@@ -165,11 +165,16 @@ func restErrWithLogMsg(w rest.ResponseWriter, r *rest.Request, l *log.Logger,
 		emitLog = !lc.PushError(err)
 	}
 
-	w.WriteHeader(code)
-	err := w.WriteJson(ApiError{
+	apiErr := ApiError{
 		Err:   msg,
 		ReqId: requestid.GetReqId(r),
-	})
+	}
+	var fieldErrs FieldErrors
+	if errors.As(e, &fieldErrs) {
+		apiErr.Errors = fieldErrs
+	}
+	w.WriteHeader(code)
+	err := w.WriteJson(apiErr)
 	if err != nil {
 		panic(err)
 	}
@@ -87,6 +87,31 @@ func TestResponseHelpers(t *testing.T) {
 			b, _ := json.Marshal(ApiError{Err: "bad request"})
 			return string(b)
 		}(),
+	}, {
+		Name: "field errors",
+
+		NumEntries: 1,
+		HandlerFunc: func(w rest.ResponseWriter, r *rest.Request) {
+			RestErrWithWarningMsg(w, r, log.NewEmpty(),
+				FieldErrors{
+					{Field: "name", Message: "is required"},
+					{Field: "age", Message: "must be positive", Code: "range"},
+				},
+				http.StatusBadRequest, "bad request")
+		},
+		Fields: []string{
+			`level=warn`,
+		},
+		ExpectedBody: func() string {
+			b, _ := json.Marshal(ApiError{
+				Err: "bad request",
+				Errors: []FieldError{
+					{Field: "name", Message: "is required"},
+					{Field: "age", Message: "must be positive", Code: "range"},
+				},
+			})
+			return string(b)
+		}(),
 	}, {
 		Name: "fallback to logger",
 
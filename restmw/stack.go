@@ -0,0 +1,234 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package restmw assembles the shared middlewares for go-json-rest
+// services.
+package restmw
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/mendersoftware/go-lib-micro/requestlog"
+)
+
+var (
+	ErrNilMiddleware          = errors.New("restmw: nil middleware")
+	ErrDuplicateMiddleware    = errors.New("restmw: duplicate middleware")
+	ErrMiddlewareOrder        = errors.New("restmw: middlewares out of order")
+	ErrIncompatibleMiddleware = errors.New("restmw: incompatible middlewares")
+)
+
+// The position of the shared middlewares in the stack, from the outermost
+// to the innermost:
+//   - requestlog creates the request logger, replacing any logger the
+//     previous middlewares enriched,
+//   - requestid adds the request ID to the logger,
+//   - accesslog logs the request with the logger of the innermost
+//     middleware and recovers panics,
+//   - rest.RecorderMiddleware records the status for the remaining
+//     go-json-rest middlewares,
+//   - identity and rbac add the identity and scope of the request which
+//     are not required by the other middlewares.
+const (
+	rankRequestLog = iota
+	rankRequestID
+	rankAccessLog
+	rankRecorder
+	rankIdentity
+	rankRBAC
+)
+
+func rankOf(mw rest.Middleware) (rank int, name string, ok bool) {
+	switch mw.(type) {
+	case *requestlog.RequestLogMiddleware:
+		return rankRequestLog, "requestlog", true
+	case *requestid.RequestIdMiddleware:
+		return rankRequestID, "requestid", true
+	case *accesslog.AccessLogMiddleware:
+		return rankAccessLog, "accesslog", true
+	case *rest.RecorderMiddleware:
+		return rankRecorder, "recorder", true
+	case *identity.IdentityMiddleware:
+		return rankIdentity, "identity", true
+	case *rbac.RBACMiddleware:
+		return rankRBAC, "rbac", true
+	}
+	return -1, "", false
+}
+
+// StackOptions selects the middlewares of the stack; the middlewares left
+// nil are not included.
+type StackOptions struct {
+	RequestLog *requestlog.RequestLogMiddleware
+	RequestID  *requestid.RequestIdMiddleware
+	AccessLog  *accesslog.AccessLogMiddleware
+	// Recorder includes rest.RecorderMiddleware for middlewares reading
+	// the "STATUS_CODE" and "BYTES_WRITTEN" values of the request Env.
+	Recorder *bool
+	Identity *identity.IdentityMiddleware
+	RBAC     *rbac.RBACMiddleware
+
+	// Middlewares are appended after the shared middlewares.
+	Middlewares []rest.Middleware
+}
+
+func NewStackOptions() *StackOptions {
+	return new(StackOptions)
+}
+
+func (opts *StackOptions) SetRequestLog(mw *requestlog.RequestLogMiddleware) *StackOptions {
+	opts.RequestLog = mw
+	return opts
+}
+
+func (opts *StackOptions) SetRequestID(mw *requestid.RequestIdMiddleware) *StackOptions {
+	opts.RequestID = mw
+	return opts
+}
+
+func (opts *StackOptions) SetAccessLog(mw *accesslog.AccessLogMiddleware) *StackOptions {
+	opts.AccessLog = mw
+	return opts
+}
+
+func (opts *StackOptions) SetRecorder(recorder bool) *StackOptions {
+	opts.Recorder = &recorder
+	return opts
+}
+
+func (opts *StackOptions) SetIdentity(mw *identity.IdentityMiddleware) *StackOptions {
+	opts.Identity = mw
+	return opts
+}
+
+func (opts *StackOptions) SetRBAC(mw *rbac.RBACMiddleware) *StackOptions {
+	opts.RBAC = mw
+	return opts
+}
+
+func (opts *StackOptions) AddMiddlewares(mws ...rest.Middleware) *StackOptions {
+	opts.Middlewares = append(opts.Middlewares, mws...)
+	return opts
+}
+
+// DefaultStackOptions returns the options of the stack used by most
+// services: all the shared middlewares with the identity added to the
+// log context.
+func DefaultStackOptions() *StackOptions {
+	return NewStackOptions().
+		SetRequestLog(&requestlog.RequestLogMiddleware{}).
+		SetRequestID(&requestid.RequestIdMiddleware{}).
+		SetAccessLog(&accesslog.AccessLogMiddleware{}).
+		SetIdentity(&identity.IdentityMiddleware{UpdateLogger: true}).
+		SetRBAC(&rbac.RBACMiddleware{})
+}
+
+// NewStack returns the middlewares selected by the options in the order
+// they must be used with rest.Api.Use. The middlewares of later options
+// take precedence, the additional Middlewares of all the options are
+// appended in order.
+func NewStack(opts ...*StackOptions) ([]rest.Middleware, error) {
+	opt := NewStackOptions()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.RequestLog != nil {
+			opt.RequestLog = o.RequestLog
+		}
+		if o.RequestID != nil {
+			opt.RequestID = o.RequestID
+		}
+		if o.AccessLog != nil {
+			opt.AccessLog = o.AccessLog
+		}
+		if o.Recorder != nil {
+			opt.Recorder = o.Recorder
+		}
+		if o.Identity != nil {
+			opt.Identity = o.Identity
+		}
+		if o.RBAC != nil {
+			opt.RBAC = o.RBAC
+		}
+		opt.Middlewares = append(opt.Middlewares, o.Middlewares...)
+	}
+	stack := make([]rest.Middleware, 0, rankRBAC+1+len(opt.Middlewares))
+	if opt.RequestLog != nil {
+		stack = append(stack, opt.RequestLog)
+	}
+	if opt.RequestID != nil {
+		stack = append(stack, opt.RequestID)
+	}
+	if opt.AccessLog != nil {
+		stack = append(stack, opt.AccessLog)
+	}
+	if opt.Recorder != nil && *opt.Recorder {
+		stack = append(stack, &rest.RecorderMiddleware{})
+	}
+	if opt.Identity != nil {
+		stack = append(stack, opt.Identity)
+	}
+	if opt.RBAC != nil {
+		stack = append(stack, opt.RBAC)
+	}
+	stack = append(stack, opt.Middlewares...)
+	if err := ValidateStack(stack); err != nil {
+		return nil, err
+	}
+	return stack, nil
+}
+
+// ValidateStack checks that the shared middlewares of the stack are used at
+// most once and in the order of NewStack, and that rest.RecoverMiddleware
+// is not used after accesslog, since it would prevent accesslog from
+// logging the panics. Other middlewares may be used anywhere.
+func ValidateStack(stack []rest.Middleware) error {
+	var (
+		seen       = make(map[int]bool)
+		lastRank   = -1
+		lastName   string
+		accessLogs bool
+	)
+	for i, mw := range stack {
+		if mw == nil {
+			return errors.Wrapf(ErrNilMiddleware, "index %d", i)
+		}
+		if _, ok := mw.(*rest.RecoverMiddleware); ok && accessLogs {
+			return errors.Wrap(ErrIncompatibleMiddleware,
+				"rest.RecoverMiddleware after accesslog prevents logging panics")
+		}
+		rank, name, ok := rankOf(mw)
+		if !ok {
+			continue
+		}
+		if seen[rank] {
+			return errors.Wrap(ErrDuplicateMiddleware, name)
+		} else if rank < lastRank {
+			return errors.Wrapf(ErrMiddlewareOrder,
+				"%s must be used before %s", name, lastName)
+		}
+		seen[rank] = true
+		lastRank, lastName = rank, name
+		if rank == rankAccessLog {
+			accessLogs = true
+		}
+	}
+	return nil
+}
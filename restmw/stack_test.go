@@ -0,0 +1,185 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package restmw
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/mendersoftware/go-lib-micro/requestlog"
+)
+
+func TestValidateStack(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Name  string
+		Stack []rest.Middleware
+		Error error
+	}{{
+		Name: "ok",
+		Stack: []rest.Middleware{
+			&requestlog.RequestLogMiddleware{},
+			&rest.TimerMiddleware{},
+			&requestid.RequestIdMiddleware{},
+			&accesslog.AccessLogMiddleware{},
+			&rest.RecorderMiddleware{},
+			&identity.IdentityMiddleware{},
+			&rbac.RBACMiddleware{},
+			&rest.JsonIndentMiddleware{},
+		},
+	}, {
+		Name: "ok, recover before accesslog",
+		Stack: []rest.Middleware{
+			&rest.RecoverMiddleware{},
+			&accesslog.AccessLogMiddleware{},
+		},
+	}, {
+		Name:  "empty",
+		Stack: nil,
+	}, {
+		Name: "requestid before requestlog",
+		Stack: []rest.Middleware{
+			&requestid.RequestIdMiddleware{},
+			&requestlog.RequestLogMiddleware{},
+		},
+		Error: ErrMiddlewareOrder,
+	}, {
+		Name: "identity before accesslog",
+		Stack: []rest.Middleware{
+			&identity.IdentityMiddleware{},
+			&accesslog.AccessLogMiddleware{},
+		},
+		Error: ErrMiddlewareOrder,
+	}, {
+		Name: "duplicate accesslog",
+		Stack: []rest.Middleware{
+			&accesslog.AccessLogMiddleware{},
+			&rest.TimerMiddleware{},
+			&accesslog.AccessLogMiddleware{},
+		},
+		Error: ErrDuplicateMiddleware,
+	}, {
+		Name: "recover after accesslog",
+		Stack: []rest.Middleware{
+			&accesslog.AccessLogMiddleware{},
+			&rest.RecoverMiddleware{},
+		},
+		Error: ErrIncompatibleMiddleware,
+	}, {
+		Name: "nil middleware",
+		Stack: []rest.Middleware{
+			&accesslog.AccessLogMiddleware{},
+			nil,
+		},
+		Error: ErrNilMiddleware,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateStack(tc.Stack)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewStack(t *testing.T) {
+	t.Parallel()
+	stack, err := NewStack(
+		DefaultStackOptions(),
+		nil,
+		NewStackOptions().
+			SetRecorder(true).
+			SetRBAC(&rbac.RBACMiddleware{UpdateLogger: true}).
+			AddMiddlewares(&rest.JsonIndentMiddleware{}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, stack, 7) {
+		assert.IsType(t, &requestlog.RequestLogMiddleware{}, stack[0])
+		assert.IsType(t, &requestid.RequestIdMiddleware{}, stack[1])
+		assert.IsType(t, &accesslog.AccessLogMiddleware{}, stack[2])
+		assert.IsType(t, &rest.RecorderMiddleware{}, stack[3])
+		assert.IsType(t, &identity.IdentityMiddleware{}, stack[4])
+		assert.Equal(t, &rbac.RBACMiddleware{UpdateLogger: true}, stack[5])
+		assert.IsType(t, &rest.JsonIndentMiddleware{}, stack[6])
+	}
+
+	stack, err = NewStack(NewStackOptions().
+		SetAccessLog(&accesslog.AccessLogMiddleware{}).
+		AddMiddlewares(&accesslog.AccessLogMiddleware{}))
+	assert.ErrorIs(t, err, ErrDuplicateMiddleware)
+	assert.Nil(t, stack)
+
+	_, err = NewStack(NewStackOptions().
+		SetIdentity(&identity.IdentityMiddleware{}).
+		AddMiddlewares(&requestlog.RequestLogMiddleware{}))
+	assert.ErrorIs(t, err, ErrMiddlewareOrder)
+}
+
+func TestStackHandler(t *testing.T) {
+	logBuf := bytes.NewBuffer(nil)
+	logger := logrus.New()
+	logger.SetOutput(logBuf)
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+
+	stack, err := NewStack(DefaultStackOptions().
+		SetRequestLog(&requestlog.RequestLogMiddleware{BaseLogger: logger}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	app, err := rest.MakeRouter(rest.Get("/test",
+		func(w rest.ResponseWriter, r *rest.Request) {
+			ctx := r.Context()
+			assert.Equal(t, "req-1", requestid.FromContext(ctx))
+			assert.Equal(t, []string{"production"}, rbac.FromContext(ctx).DeviceGroups)
+			log.FromContext(ctx).Info("handler")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	api := rest.NewApi()
+	api.Use(stack...)
+	api.SetApp(app)
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(requestid.RequestIdHeader, "req-1")
+	req.Header.Set(rbac.ScopeHeader, "production")
+	w := httptest.NewRecorder()
+	api.MakeHandler().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Contains(t, logBuf.String(), "msg=handler")
+	assert.Contains(t, logBuf.String(), "request_id=req-1")
+	assert.Contains(t, logBuf.String(), "status=204")
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package safego runs goroutines which recover, log and report panics
+// instead of crashing the process.
+package safego
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/mendersoftware/go-lib-micro/errreport"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+// Recover recovers a panic of the calling goroutine, logs it with the
+// traceback and reports it with errreport. It must be deferred directly:
+//
+//	defer safego.Recover(ctx)
+func Recover(ctx context.Context) {
+	if r := recover(); r != nil {
+		handlePanic(ctx, r)
+	}
+}
+
+func handlePanic(ctx context.Context, value interface{}) {
+	trace := string(debug.Stack())
+	log.FromContext(ctx).
+		WithField("panic", value).
+		WithField("trace", trace).
+		Error("recovered from panic")
+	errreport.CapturePanic(ctx, value, trace)
+}
+
+// Go runs fn in a new goroutine, recovering panics with Recover.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer Recover(ctx)
+		fn(ctx)
+	}()
+}
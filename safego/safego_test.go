@@ -0,0 +1,54 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package safego
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/errreport"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+)
+
+func TestGo(t *testing.T) {
+	events := make(chan *errreport.Event, 1)
+	ctx := errreport.WithContext(context.Background(),
+		errreport.ReporterFunc(func(_ context.Context, event *errreport.Event) error {
+			events <- event
+			return nil
+		}))
+	ctx = requestid.WithContext(ctx, "1234")
+
+	Go(ctx, func(context.Context) {
+		panic("boom")
+	})
+	select {
+	case event := <-events:
+		assert.Equal(t, "boom", event.Panic)
+		assert.EqualError(t, event.Err, "panic: boom")
+		assert.Equal(t, "1234", event.RequestID)
+		assert.Contains(t, event.Stack, "safego.TestGo")
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic was not reported")
+	}
+
+	done := make(chan struct{})
+	Go(ctx, func(context.Context) { close(done) })
+	<-done
+	assert.Empty(t, events)
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package session
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+type tokenSession struct {
+	Token string `json:"jwt"`
+}
+
+// SaveToken stores the JWT in the session cookie, e.g. for handing over
+// the authentication of a browser to a websocket endpoint. The session
+// should not outlive the token.
+func (s *Sessions) SaveToken(w http.ResponseWriter, token string) error {
+	return s.Save(w, tokenSession{Token: token})
+}
+
+// LoadToken returns the JWT stored in the session cookie by SaveToken.
+func (s *Sessions) LoadToken(r *http.Request) (string, error) {
+	var sess tokenSession
+	if err := s.Load(r, &sess); err != nil {
+		return "", err
+	}
+	if sess.Token == "" {
+		return "", ErrInvalidSession
+	}
+	return sess.Token, nil
+}
+
+// JWTExtractor extracts the identity from the JWT of the session cookie
+// like identity.JWTExtractor extracts it from the Authorization header or
+// the "JWT" cookie. Requests without the session cookie have no
+// credentials (identity.ErrNoCredentials), so the extractor can be
+// combined with the default extractor:
+//
+//	identity.NewMiddlewareOptions().
+//		SetExtractor(identity.Extractors(
+//			identity.JWTExtractor(cache, issuers),
+//			sessions.JWTExtractor(cache, issuers),
+//		))
+func (s *Sessions) JWTExtractor(
+	cache *identity.TokenCache,
+	issuers *identity.Issuers,
+) identity.IdentityExtractor {
+	parse := identity.NewTokenParser(cache, issuers)
+	return identity.IdentityExtractorFunc(
+		func(r *http.Request) (identity.Identity, error) {
+			token, err := s.LoadToken(r)
+			if errors.Is(err, http.ErrNoCookie) {
+				return identity.Identity{}, errors.Wrap(
+					identity.ErrNoCredentials, "session: no session cookie")
+			} else if err != nil {
+				return identity.Identity{}, err
+			}
+			return parse(token)
+		})
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package session encodes values in signed and encrypted cookies for the
+// endpoints which cannot use the Authorization header, e.g. the websocket
+// handshake of browsers.
+//
+// The values are encrypted with AES-256-GCM which also authenticates the
+// cookie name and the expiration time. Multiple keys can be configured for
+// rotating the keys: the first key encrypts new cookies and all the keys
+// decrypt the cookies.
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// DefaultCookieName is the default name of the session cookie.
+	DefaultCookieName = "mender-session"
+	// DefaultMaxAge is the default lifetime of the session.
+	DefaultMaxAge = 24 * time.Hour
+
+	// MaxCookieSize is the maximum size of the encoded cookie accepted by
+	// browsers.
+	MaxCookieSize = 4096
+
+	// MinKeySize is the minimum size of the keys.
+	MinKeySize = 32
+
+	hkdfInfo = "mender session cookie"
+)
+
+var (
+	ErrNoKeys         = errors.New("session: no keys")
+	ErrKeyTooShort    = errors.New("session: key is too short")
+	ErrInvalidSession = errors.New("session: invalid session")
+	ErrExpired        = errors.New("session: session expired")
+	ErrTooLarge       = errors.New("session: encoded session too large")
+)
+
+// Codec encrypts and decrypts the session values.
+type Codec struct {
+	aeads []cipher.AEAD
+
+	now func() time.Time
+}
+
+// NewCodec creates the codec with the keys; the first key encrypts the
+// values. The keys must be at least MinKeySize bytes of random data.
+func NewCodec(keys ...[]byte) (*Codec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	aeads := make([]cipher.AEAD, len(keys))
+	for i, key := range keys {
+		if len(key) < MinKeySize {
+			return nil, ErrKeyTooShort
+		}
+		var derived [32]byte
+		kdf := hkdf.New(sha256.New, key, nil, []byte(hkdfInfo))
+		if _, err := io.ReadFull(kdf, derived[:]); err != nil {
+			return nil, errors.Wrap(err, "session: failed to derive key")
+		}
+		block, err := aes.NewCipher(derived[:])
+		if err != nil {
+			return nil, errors.Wrap(err, "session: failed to create cipher")
+		}
+		aeads[i], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrap(err, "session: failed to create cipher")
+		}
+	}
+	return &Codec{aeads: aeads, now: time.Now}, nil
+}
+
+type payload struct {
+	ExpiresAt int64           `json:"exp"`
+	Value     json.RawMessage `json:"val"`
+}
+
+// Encode encrypts the JSON encoding of value for the cookie with the given
+// name expiring after maxAge.
+func (c *Codec) Encode(name string, value interface{}, maxAge time.Duration) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.Wrap(err, "session: failed to encode value")
+	}
+	b, err = json.Marshal(payload{
+		ExpiresAt: c.now().Add(maxAge).Unix(),
+		Value:     b,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "session: failed to encode value")
+	}
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(b)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "session: failed to generate nonce")
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(
+		aead.Seal(nonce, nonce, b, []byte(name)))
+	if len(name)+1+len(encoded) > MaxCookieSize {
+		return "", ErrTooLarge
+	}
+	return encoded, nil
+}
+
+// Decode decrypts the cookie with the given name into value.
+func (c *Codec) Decode(name, data string, value interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	var plain []byte
+	for _, aead := range c.aeads {
+		if len(b) < aead.NonceSize() {
+			return ErrInvalidSession
+		}
+		nonce, ciphertext := b[:aead.NonceSize()], b[aead.NonceSize():]
+		plain, err = aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return ErrInvalidSession
+	}
+	var p payload
+	if err := json.Unmarshal(plain, &p); err != nil {
+		return ErrInvalidSession
+	}
+	if !c.now().Before(time.Unix(p.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if err := json.Unmarshal(p.Value, value); err != nil {
+		return errors.Wrap(err, "session: failed to decode value")
+	}
+	return nil
+}
+
+// Sessions stores the session values in cookies.
+type Sessions struct {
+	Codec *Codec
+
+	// Name is the name of the cookie. (default: DefaultCookieName)
+	Name string
+	// MaxAge is the lifetime of the session. (default: DefaultMaxAge)
+	MaxAge time.Duration
+
+	// Path, Domain and SameSite are the attributes of the cookie. The
+	// cookies are always HttpOnly and Secure, unless Insecure is set
+	// (for development).
+	Path     string
+	Domain   string
+	SameSite http.SameSite
+	Insecure bool
+}
+
+func (s *Sessions) name() string {
+	if s.Name == "" {
+		return DefaultCookieName
+	}
+	return s.Name
+}
+
+func (s *Sessions) maxAge() time.Duration {
+	if s.MaxAge <= 0 {
+		return DefaultMaxAge
+	}
+	return s.MaxAge
+}
+
+func (s *Sessions) cookie(value string, maxAge int) *http.Cookie {
+	path := s.Path
+	if path == "" {
+		path = "/"
+	}
+	sameSite := s.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteStrictMode
+	}
+	return &http.Cookie{
+		Name:     s.name(),
+		Value:    value,
+		Path:     path,
+		Domain:   s.Domain,
+		MaxAge:   maxAge,
+		Secure:   !s.Insecure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
+
+// Save sets the session cookie with the value.
+func (s *Sessions) Save(w http.ResponseWriter, value interface{}) error {
+	maxAge := s.maxAge()
+	encoded, err := s.Codec.Encode(s.name(), value, maxAge)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(encoded, int(maxAge/time.Second)))
+	return nil
+}
+
+// Load decodes the session cookie of the request into value. It returns
+// http.ErrNoCookie if the request has no session.
+func (s *Sessions) Load(r *http.Request, value interface{}) error {
+	cookie, err := r.Cookie(s.name())
+	if err != nil {
+		return err
+	}
+	return s.Codec.Decode(s.name(), cookie.Value, value)
+}
+
+// Clear removes the session cookie.
+func (s *Sessions) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, s.cookie("", -1))
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, MinKeySize)
+	newKey = bytes.Repeat([]byte{2}, MinKeySize)
+)
+
+type testValue struct {
+	UserID string `json:"user_id"`
+}
+
+func TestNewCodec(t *testing.T) {
+	t.Parallel()
+	_, err := NewCodec()
+	assert.ErrorIs(t, err, ErrNoKeys)
+	_, err = NewCodec(newKey, []byte("short"))
+	assert.ErrorIs(t, err, ErrKeyTooShort)
+}
+
+func TestCodec(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	codec, err := NewCodec(newKey, oldKey)
+	require.NoError(t, err)
+	codec.now = func() time.Time { return now }
+	oldCodec, err := NewCodec(oldKey)
+	require.NoError(t, err)
+	oldCodec.now = codec.now
+	otherCodec, err := NewCodec(bytes.Repeat([]byte{3}, MinKeySize))
+	require.NoError(t, err)
+
+	encoded, err := codec.Encode("session", testValue{UserID: "user"}, time.Hour)
+	require.NoError(t, err)
+	assert.NotContains(t, encoded, "user")
+	oldEncoded, err := oldCodec.Encode("session", testValue{UserID: "old"}, time.Hour)
+	require.NoError(t, err)
+	tampered := []byte(encoded)
+	tampered[len(tampered)/2] ^= 'a' ^ 'b'
+
+	testCases := []struct {
+		Name  string
+		Codec *Codec
+		Key   string
+		Data  string
+		Now   time.Time
+
+		Value testValue
+		Error error
+	}{{
+		Name:  "ok",
+		Data:  encoded,
+		Value: testValue{UserID: "user"},
+	}, {
+		Name:  "ok, rotated key",
+		Data:  oldEncoded,
+		Value: testValue{UserID: "old"},
+	}, {
+		Name:  "error, unknown key",
+		Codec: otherCodec,
+		Data:  encoded,
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, retired key",
+		Codec: codecWithKeys(t, codec.now, newKey),
+		Data:  oldEncoded,
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, other cookie",
+		Key:   "other",
+		Data:  encoded,
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, tampered",
+		Data:  string(tampered),
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, truncated",
+		Data:  encoded[:8],
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, not base64",
+		Data:  "!!!",
+		Error: ErrInvalidSession,
+	}, {
+		Name:  "error, expired",
+		Data:  encoded,
+		Now:   now.Add(time.Hour),
+		Error: ErrExpired,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			c := codec
+			if tc.Codec != nil {
+				c = tc.Codec
+			}
+			if !tc.Now.IsZero() {
+				c = codecWithKeys(t, func() time.Time { return tc.Now }, newKey, oldKey)
+			}
+			key := "session"
+			if tc.Key != "" {
+				key = tc.Key
+			}
+			var value testValue
+			err := c.Decode(key, tc.Data, &value)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Value, value)
+			}
+		})
+	}
+
+	_, err = codec.Encode("session", strings.Repeat("a", MaxCookieSize), time.Hour)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func codecWithKeys(t *testing.T, now func() time.Time, keys ...[]byte) *Codec {
+	codec, err := NewCodec(keys...)
+	require.NoError(t, err)
+	codec.now = now
+	return codec
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	codec, err := NewCodec(newKey)
+	require.NoError(t, err)
+	sessions := &Sessions{Codec: codec, Path: "/api"}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, sessions.Save(w, testValue{UserID: "user"}))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, DefaultCookieName, cookie.Name)
+	assert.Equal(t, "/api", cookie.Path)
+	assert.Equal(t, int(DefaultMaxAge/time.Second), cookie.MaxAge)
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/api", nil)
+	var value testValue
+	assert.ErrorIs(t, sessions.Load(req, &value), http.ErrNoCookie)
+	req.AddCookie(cookie)
+	if assert.NoError(t, sessions.Load(req, &value)) {
+		assert.Equal(t, "user", value.UserID)
+	}
+
+	w = httptest.NewRecorder()
+	sessions.Clear(w)
+	cookies = w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, DefaultCookieName, cookies[0].Name)
+		assert.Less(t, cookies[0].MaxAge, 0)
+	}
+}
+
+func makeToken(idty identity.Identity) string {
+	b, _ := json.Marshal(idty)
+	return "eyJhbGciOiJub25lIn0." +
+		base64.RawURLEncoding.EncodeToString(b) + ".c2ln"
+}
+
+func TestJWTExtractor(t *testing.T) {
+	t.Parallel()
+	codec, err := NewCodec(newKey)
+	require.NoError(t, err)
+	sessions := &Sessions{Codec: codec}
+	idty := identity.Identity{Subject: "user", Tenant: "tenant", IsUser: true}
+
+	w := httptest.NewRecorder()
+	require.NoError(t, sessions.SaveToken(w, makeToken(idty)))
+
+	extractor := identity.Extractors(
+		identity.JWTExtractor(nil, nil),
+		sessions.JWTExtractor(nil, nil),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/ws", nil)
+	_, err = extractor.ExtractIdentity(req)
+	assert.ErrorIs(t, err, identity.ErrNoCredentials)
+
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	got, err := extractor.ExtractIdentity(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, idty, got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/ws", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: "forged"})
+	_, err = extractor.ExtractIdentity(req)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package signing
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/log"
+	urest "github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const (
+	// DefaultPathRegex matches the internal API routes.
+	DefaultPathRegex = "^/api/internal/"
+
+	// LogFieldKeyID is the field of the ID of the signing key.
+	LogFieldKeyID = "signing_key_id"
+)
+
+type MiddlewareOptions struct {
+	// PathRegex selects the routes requiring signed requests.
+	// (default: DefaultPathRegex)
+	PathRegex *string
+	// MaxSkew is the accepted difference between the time of signing
+	// and the time of verification. (default: DefaultMaxSkew)
+	MaxSkew *time.Duration
+	// MaxBodySize limits the size of the request bodies.
+	// (default: DefaultMaxBodySize)
+	MaxBodySize *int64
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetPathRegex(regex string) *MiddlewareOptions {
+	opts.PathRegex = &regex
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetMaxSkew(skew time.Duration) *MiddlewareOptions {
+	opts.MaxSkew = &skew
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetMaxBodySize(size int64) *MiddlewareOptions {
+	opts.MaxBodySize = &size
+	return opts
+}
+
+func mergeOptions(opts []*MiddlewareOptions) *MiddlewareOptions {
+	opt := NewMiddlewareOptions().
+		SetPathRegex(DefaultPathRegex).
+		SetMaxSkew(DefaultMaxSkew).
+		SetMaxBodySize(DefaultMaxBodySize)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.PathRegex != nil {
+			opt.PathRegex = o.PathRegex
+		}
+		if o.MaxSkew != nil {
+			opt.MaxSkew = o.MaxSkew
+		}
+		if o.MaxBodySize != nil {
+			opt.MaxBodySize = o.MaxBodySize
+		}
+	}
+	return opt
+}
+
+// audit verifies the request and logs the outcome: failures are logged as
+// warnings, the key ID of valid requests is added to the access log.
+func (v *Verifier) audit(r *http.Request) error {
+	ctx := r.Context()
+	keyID, err := v.Verify(r)
+	if err != nil {
+		log.FromContext(ctx).F(log.Ctx{
+			LogFieldKeyID: keyID,
+			"remote_addr": r.RemoteAddr,
+			"path":        r.URL.Path,
+		}).Warnf("signed request rejected: %s", err)
+		return err
+	}
+	if lc := accesslog.GetContext(ctx); lc != nil {
+		lc.SetField(LogFieldKeyID, keyID)
+	}
+	return nil
+}
+
+// Middleware rejects the requests to the routes matching the PathRegex
+// which are not signed with one of the keys, see Verifier.
+func Middleware(keys map[string][]byte, opts ...*MiddlewareOptions) gin.HandlerFunc {
+	pathRegex := regexp.MustCompile(*mergeOptions(opts).PathRegex)
+	verifier := NewVerifier(keys, opts...)
+	return func(c *gin.Context) {
+		if !pathRegex.MatchString(c.Request.URL.Path) {
+			return
+		}
+		if err := verifier.audit(c.Request); err != nil {
+			urest.RenderError(c, http.StatusUnauthorized, err)
+			c.Abort()
+		}
+	}
+}
+
+// HTTPMiddleware is the net/http equivalent of Middleware.
+func HTTPMiddleware(keys map[string][]byte, opts ...*MiddlewareOptions) func(http.Handler) http.Handler {
+	pathRegex := regexp.MustCompile(*mergeOptions(opts).PathRegex)
+	verifier := NewVerifier(keys, opts...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pathRegex.MatchString(r.URL.Path) {
+				if err := verifier.audit(r); err != nil {
+					urest.WriteError(w, r, http.StatusUnauthorized, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
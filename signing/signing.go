@@ -0,0 +1,223 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package signing signs the requests between the services with a shared
+// HMAC key and verifies the signatures, as defense in depth for the
+// internal APIs where mutual TLS is not available.
+//
+// The signature covers the method, the request URI (path and query), the
+// SHA256 digest of the body and the time of signing, which must be within
+// MaxSkew of the time of the verifier. Note that requests can be replayed
+// within MaxSkew.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HeaderSignature = "X-MEN-Request-Signature"
+	HeaderTimestamp = "X-MEN-Request-Timestamp"
+	HeaderKeyID     = "X-MEN-Request-Key-ID"
+
+	// DefaultMaxSkew is the default maximum difference between the
+	// time of signing and the time of verification.
+	DefaultMaxSkew = 5 * time.Minute
+	// DefaultMaxBodySize is the default limit of the size of the
+	// verified request bodies.
+	DefaultMaxBodySize = 10 * 1024 * 1024
+)
+
+var (
+	ErrMissingSignature = errors.New("signing: request is not signed")
+	ErrUnknownKey       = errors.New("signing: unknown signing key")
+	ErrInvalidSignature = errors.New("signing: invalid signature")
+	ErrInvalidTimestamp = errors.New("signing: invalid timestamp")
+	ErrExpired          = errors.New("signing: signature timestamp outside the accepted window")
+	ErrBodyTooLarge     = errors.New("signing: request body too large")
+)
+
+// StringToSign returns the canonical representation of the request which
+// is signed.
+func StringToSign(method, requestURI string, bodyDigest []byte, timestamp string) string {
+	return method + "\n" +
+		requestURI + "\n" +
+		hex.EncodeToString(bodyDigest) + "\n" +
+		timestamp
+}
+
+func signature(key []byte, stringToSign string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(stringToSign))
+	return mac.Sum(nil)
+}
+
+// Signer signs the requests with the key.
+type Signer struct {
+	keyID string
+	key   []byte
+	now   func() time.Time
+}
+
+// NewSigner creates a signer with the key identified by keyID for the
+// verifiers.
+func NewSigner(keyID string, key []byte) *Signer {
+	return &Signer{
+		keyID: keyID,
+		key:   key,
+		now:   time.Now,
+	}
+}
+
+// readBody returns the body of the outgoing request leaving the request
+// body readable.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return b, nil
+}
+
+// Sign adds the signature headers to the request.
+func (s *Signer) Sign(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return errors.Wrap(err, "signing: failed to read request body")
+	}
+	digest := sha256.Sum256(body)
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	sig := signature(s.key,
+		StringToSign(r.Method, r.URL.RequestURI(), digest[:], timestamp))
+	r.Header.Set(HeaderKeyID, s.keyID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+type transport struct {
+	signer *Signer
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request.
+	r = r.Clone(r.Context())
+	if err := t.signer.Sign(r); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(r)
+}
+
+// Transport returns an http.RoundTripper signing the requests sent with
+// base (http.DefaultTransport if nil).
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{signer: s, base: base}
+}
+
+// Verifier verifies the signatures of the requests.
+type Verifier struct {
+	keys        map[string][]byte
+	maxSkew     time.Duration
+	maxBodySize int64
+	now         func() time.Time
+}
+
+// NewVerifier creates a verifier accepting the keys by key ID; configure
+// more than one key while rotating the key.
+func NewVerifier(keys map[string][]byte, opts ...*MiddlewareOptions) *Verifier {
+	opt := mergeOptions(opts)
+	return &Verifier{
+		keys:        keys,
+		maxSkew:     *opt.MaxSkew,
+		maxBodySize: *opt.MaxBodySize,
+		now:         time.Now,
+	}
+}
+
+// Verify verifies the signature of the incoming request and returns the
+// ID of the key. The body is buffered and restored for the handler.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	header := r.Header.Get(HeaderSignature)
+	if header == "" {
+		return "", ErrMissingSignature
+	}
+	keyID := r.Header.Get(HeaderKeyID)
+	key, ok := v.keys[keyID]
+	if !ok {
+		return keyID, ErrUnknownKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return keyID, ErrInvalidSignature
+	}
+	timestamp := r.Header.Get(HeaderTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return keyID, ErrInvalidTimestamp
+	}
+	skew := v.now().Sub(time.Unix(unix, 0))
+	if skew > v.maxSkew || skew < -v.maxSkew {
+		return keyID, ErrExpired
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, v.maxBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			return keyID, errors.Wrap(err, "signing: failed to read request body")
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if int64(len(body)) > v.maxBodySize {
+		return keyID, ErrBodyTooLarge
+	}
+	digest := sha256.Sum256(body)
+	expected := signature(key,
+		StringToSign(r.Method, r.URL.RequestURI(), digest[:], timestamp))
+	if !hmac.Equal(sig, expected) {
+		return keyID, ErrInvalidSignature
+	}
+	return keyID, nil
+}
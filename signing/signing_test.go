@@ -0,0 +1,250 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package signing
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var testKeys = map[string][]byte{
+	"current":  []byte("current-secret"),
+	"previous": []byte("previous-secret"),
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(1700000000, 0)
+	testCases := []struct {
+		Name string
+
+		KeyID  string
+		Key    []byte
+		Body   string
+		Tamper func(r *http.Request)
+		Skew   time.Duration
+
+		Error error
+	}{{
+		Name:  "ok",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Body:  `{"foo":"bar"}`,
+	}, {
+		Name:  "ok, previous key",
+		KeyID: "previous",
+		Key:   testKeys["previous"],
+	}, {
+		Name:  "ok, within skew",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Skew:  -4 * time.Minute,
+	}, {
+		Name:  "error, not signed",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Tamper: func(r *http.Request) {
+			r.Header.Del(HeaderSignature)
+		},
+		Error: ErrMissingSignature,
+	}, {
+		Name:  "error, unknown key",
+		KeyID: "retired",
+		Key:   testKeys["current"],
+		Error: ErrUnknownKey,
+	}, {
+		Name:  "error, wrong key",
+		KeyID: "current",
+		Key:   testKeys["previous"],
+		Error: ErrInvalidSignature,
+	}, {
+		Name:  "error, body modified",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Body:  `{"foo":"bar"}`,
+		Tamper: func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"foo":"baz"}`))
+		},
+		Error: ErrInvalidSignature,
+	}, {
+		Name:  "error, query modified",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Tamper: func(r *http.Request) {
+			r.URL.RawQuery = "tenant=other"
+		},
+		Error: ErrInvalidSignature,
+	}, {
+		Name:  "error, method modified",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Tamper: func(r *http.Request) {
+			r.Method = http.MethodDelete
+		},
+		Error: ErrInvalidSignature,
+	}, {
+		Name:  "error, malformed signature",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Tamper: func(r *http.Request) {
+			r.Header.Set(HeaderSignature, "not base64!")
+		},
+		Error: ErrInvalidSignature,
+	}, {
+		Name:  "error, malformed timestamp",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Tamper: func(r *http.Request) {
+			r.Header.Set(HeaderTimestamp, "yesterday")
+		},
+		Error: ErrInvalidTimestamp,
+	}, {
+		Name:  "error, expired",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Skew:  -10 * time.Minute,
+		Error: ErrExpired,
+	}, {
+		Name:  "error, from the future",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Skew:  10 * time.Minute,
+		Error: ErrExpired,
+	}, {
+		Name:  "error, body too large",
+		KeyID: "current",
+		Key:   testKeys["current"],
+		Body:  strings.Repeat("a", 1025),
+		Error: ErrBodyTooLarge,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			signer := NewSigner(tc.KeyID, tc.Key)
+			signer.now = func() time.Time { return now.Add(tc.Skew) }
+			verifier := NewVerifier(testKeys,
+				NewMiddlewareOptions().SetMaxBodySize(1024))
+			verifier.now = func() time.Time { return now }
+
+			var body io.Reader
+			if tc.Body != "" {
+				body = strings.NewReader(tc.Body)
+			}
+			req, _ := http.NewRequest(http.MethodPost,
+				"http://localhost/api/internal/v1/foo?tenant=123", body)
+			if !assert.NoError(t, signer.Sign(req)) {
+				return
+			}
+			if tc.Tamper != nil {
+				tc.Tamper(req)
+			}
+			keyID, err := verifier.Verify(req)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.KeyID, keyID)
+				b, _ := io.ReadAll(req.Body)
+				assert.Equal(t, tc.Body, string(b),
+					"the body must be readable by the handler")
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	var (
+		handled bool
+		body    string
+	)
+	router := gin.New()
+	router.Use(Middleware(testKeys))
+	router.POST("/api/internal/v1/foo", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		handled, body = true, string(b)
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/api/management/v1/foo", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: NewSigner("current", testKeys["current"]).Transport(nil),
+	}
+	req, _ := http.NewRequest(http.MethodPost,
+		srv.URL+"/api/internal/v1/foo", bytes.NewReader([]byte("payload")))
+	rsp, err := client.Do(req)
+	if assert.NoError(t, err) {
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+		assert.True(t, handled)
+		assert.Equal(t, "payload", body)
+	}
+	assert.Empty(t, req.Header.Get(HeaderSignature),
+		"the transport must not modify the request")
+
+	// Unsigned requests to internal routes are rejected
+	rsp, err = http.Post(srv.URL+"/api/internal/v1/foo", "text/plain",
+		strings.NewReader("payload"))
+	if assert.NoError(t, err) {
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+	}
+	// ...other routes are not affected
+	rsp, err = http.Get(srv.URL + "/api/management/v1/foo")
+	if assert.NoError(t, err) {
+		rsp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+	handler := HTTPMiddleware(testKeys)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+	req, _ := http.NewRequest(http.MethodGet,
+		"http://localhost/api/internal/v1/foo", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	_ = NewSigner("previous", testKeys["previous"]).Sign(req)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req.Header.Set(HeaderTimestamp,
+		strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
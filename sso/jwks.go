@@ -0,0 +1,242 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const (
+	// minRefreshInterval limits how often the key set is fetched when
+	// tokens are signed with unknown keys.
+	minRefreshInterval = time.Minute
+
+	// maxJSONSize limits the size of the fetched JSON documents.
+	maxJSONSize = 1024 * 1024
+)
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("sso: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("sso: unsupported curve %q", jwk.Curve)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("sso: EC key is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, errors.Errorf("sso: unsupported curve %q", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		} else if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("sso: invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.Errorf("sso: unsupported key type %q", jwk.KeyType)
+}
+
+// ParseJWKS parses a JSON Web Key Set (RFC 7517) into a key set. Keys
+// which are not signing keys or of unsupported types are skipped.
+func ParseJWKS(b []byte) (identity.StaticKeySet, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, errors.Wrap(err, "sso: failed to decode JWKS")
+	}
+	keys := make(identity.StaticKeySet, len(jwks.Keys))
+	for i := range jwks.Keys {
+		jwk := &jwks.Keys[i]
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "sso: failed to prepare request")
+	}
+	req.Header.Set("Accept", "application/json")
+	rsp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "sso: failed to fetch %s", url)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return errors.Errorf("sso: unexpected status fetching %s: %s",
+			url, rsp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(io.LimitReader(rsp.Body, maxJSONSize)).Decode(v),
+		"sso: failed to decode %s", url)
+}
+
+// RemoteKeySet is an identity.KeySet fetching the keys from a JWKS URI.
+// The keys are fetched again when a token is signed with an unknown key,
+// which is how the providers rotate keys.
+type RemoteKeySet struct {
+	uri     string
+	client  *http.Client
+	timeout time.Duration
+
+	// refreshMu serializes the refreshes while mu guards the keys, so
+	// that lookups of known keys do not wait for the refreshes.
+	refreshMu sync.Mutex
+	mu        sync.RWMutex
+	keys      identity.StaticKeySet
+	refreshed time.Time
+	now       func() time.Time
+}
+
+// NewRemoteKeySet creates the key set and fetches the keys.
+func NewRemoteKeySet(ctx context.Context, client *http.Client, uri string) (*RemoteKeySet, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	set := &RemoteKeySet{
+		uri:     uri,
+		client:  client,
+		timeout: 10 * time.Second,
+		now:     time.Now,
+	}
+	if err := set.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// refresh fetches the keys; refreshed is the time of the attempt, also
+// if it fails, to rate limit the fetches.
+func (set *RemoteKeySet) refresh(ctx context.Context) error {
+	set.mu.Lock()
+	set.refreshed = set.now()
+	set.mu.Unlock()
+	var raw json.RawMessage
+	if err := getJSON(ctx, set.client, set.uri, &raw); err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return err
+	}
+	set.mu.Lock()
+	set.keys = keys
+	set.mu.Unlock()
+	return nil
+}
+
+func (set *RemoteKeySet) lookup(kid string) (crypto.PublicKey, time.Time, error) {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	key, err := set.keys.Key(kid)
+	return key, set.refreshed, err
+}
+
+func (set *RemoteKeySet) Key(kid string) (crypto.PublicKey, error) {
+	key, refreshed, err := set.lookup(kid)
+	if !errors.Is(err, identity.ErrKeyNotFound) ||
+		set.now().Sub(refreshed) < minRefreshInterval {
+		return key, err
+	}
+	set.refreshMu.Lock()
+	defer set.refreshMu.Unlock()
+	// Another lookup may have refreshed the keys meanwhile.
+	if key, current, err := set.lookup(kid); !current.Equal(refreshed) {
+		return key, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), set.timeout)
+	defer cancel()
+	if err = set.refresh(ctx); err != nil {
+		return nil, err
+	}
+	key, _, err = set.lookup(kid)
+	return key, err
+}
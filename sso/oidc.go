@@ -0,0 +1,204 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package sso maps the identities asserted by external identity providers
+// (OpenID Connect and SAML 2.0) onto identity.Identity for enterprise
+// single sign-on.
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const discoveryPath = "/.well-known/openid-configuration"
+
+var (
+	ErrIssuerMismatch = errors.New("sso: issuer does not match the discovery document")
+	ErrInvalidNonce   = errors.New("sso: invalid nonce")
+	ErrMissingClaim   = errors.New("sso: required claim missing")
+)
+
+// Discovery is the OpenID Provider metadata (OpenID Connect Discovery
+// 1.0).
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgorithms     []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Discover fetches the discovery document of the issuer. The issuer of the
+// document must be the requested issuer.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Discovery, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var doc Discovery
+	err := getJSON(ctx, client, strings.TrimRight(issuer, "/")+discoveryPath, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Issuer != issuer {
+		return nil, errors.Wrapf(ErrIssuerMismatch, "%q", doc.Issuer)
+	} else if doc.JWKSURI == "" {
+		return nil, errors.New("sso: discovery document has no jwks_uri")
+	}
+	return &doc, nil
+}
+
+// ClaimMapping maps the claims of the ID token onto the identity. The
+// identity is always a user identity.
+type ClaimMapping struct {
+	// Subject is the claim of the subject. (default: "sub")
+	Subject string `json:"subject" mapstructure:"subject"`
+	// Tenant lists the claims holding the tenant in order of
+	// precedence.
+	Tenant []string `json:"tenant" mapstructure:"tenant"`
+	// Plan is the claim holding the plan of the tenant.
+	Plan string `json:"plan" mapstructure:"plan"`
+
+	// RequireTenant rejects the tokens without tenant.
+	RequireTenant bool `json:"require_tenant" mapstructure:"require_tenant"`
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// Map returns the identity of the claims.
+func (m *ClaimMapping) Map(claims map[string]interface{}) (identity.Identity, error) {
+	subjectClaim := m.Subject
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+	idty := identity.Identity{
+		Subject: claimString(claims, subjectClaim),
+		IsUser:  true,
+	}
+	if idty.Subject == "" {
+		return idty, errors.Wrapf(ErrMissingClaim, "%q", subjectClaim)
+	}
+	for _, name := range m.Tenant {
+		if idty.Tenant = claimString(claims, name); idty.Tenant != "" {
+			break
+		}
+	}
+	if m.RequireTenant && idty.Tenant == "" {
+		return idty, errors.Wrap(ErrMissingClaim, "tenant")
+	}
+	if m.Plan != "" {
+		idty.Plan = claimString(claims, m.Plan)
+	}
+	return idty, nil
+}
+
+// OIDCConfig configures the verification of the ID tokens of a provider.
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the provider.
+	Issuer string `json:"issuer" mapstructure:"issuer"`
+	// ClientID is the client ID of the service, which must be an
+	// audience of the tokens.
+	ClientID string `json:"client_id" mapstructure:"client_id"`
+	// Leeway is the accepted clock skew.
+	Leeway time.Duration `json:"leeway" mapstructure:"leeway"`
+
+	Claims ClaimMapping `json:"claims" mapstructure:"claims"`
+
+	// HTTPClient fetches the discovery document and the keys.
+	// (default: http.DefaultClient)
+	HTTPClient *http.Client `json:"-" mapstructure:"-"`
+}
+
+// OIDCVerifier verifies the ID tokens of an OpenID provider.
+type OIDCVerifier struct {
+	Discovery *Discovery
+
+	issuers *identity.Issuers
+	claims  ClaimMapping
+}
+
+// NewOIDCVerifier discovers the provider and fetches its keys.
+func NewOIDCVerifier(ctx context.Context, config OIDCConfig) (*OIDCVerifier, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("sso: client ID is required")
+	}
+	doc, err := Discover(ctx, config.HTTPClient, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := NewRemoteKeySet(ctx, config.HTTPClient, doc.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	issuers, err := identity.NewIssuers(&identity.Issuer{
+		Name:      doc.Issuer,
+		Keys:      keys,
+		Audiences: []string{config.ClientID},
+		Leeway:    config.Leeway,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCVerifier{
+		Discovery: doc,
+		issuers:   issuers,
+		claims:    config.Claims,
+	}, nil
+}
+
+// Verify verifies the ID token (signature, issuer, audience and
+// expiration) and the nonce of the authentication request, if not empty,
+// and returns the mapped identity and the claims of the token.
+func (v *OIDCVerifier) Verify(
+	idToken, nonce string,
+) (identity.Identity, map[string]interface{}, error) {
+	if _, err := v.issuers.Verify(idToken); err != nil {
+		return identity.Identity{}, nil, err
+	}
+	segments := strings.Split(idToken, ".")
+	b, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return identity.Identity{}, nil, errors.Wrap(err,
+			"sso: failed to decode ID token claims")
+	}
+	var claims map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return identity.Identity{}, nil, errors.Wrap(err,
+			"sso: failed to decode ID token claims")
+	}
+	if nonce != "" && claimString(claims, "nonce") != nonce {
+		return identity.Identity{}, claims, ErrInvalidNonce
+	}
+	idty, err := v.claims.Map(claims)
+	return idty, claims, err
+}
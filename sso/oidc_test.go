@@ -0,0 +1,223 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+type testProvider struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys []map[string]string
+}
+
+func (p *testProvider) setKeys(keys ...map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	p := &testProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Discovery{
+			Issuer:  p.URL,
+			JWKSURI: p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": p.keys})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider := newTestProvider(t)
+	provider.setKeys(
+		map[string]string{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+		rsaJWK("key1", &key.PublicKey),
+	)
+
+	verifier, err := NewOIDCVerifier(context.Background(), OIDCConfig{
+		Issuer:   provider.URL,
+		ClientID: "mender",
+		Claims: ClaimMapping{
+			Tenant:        []string{"tid", "org_id"},
+			RequireTenant: true,
+		},
+	})
+	require.NoError(t, err)
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		ret := map[string]interface{}{
+			"iss":   provider.URL,
+			"aud":   "mender",
+			"sub":   "user1",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n-0S6_WzA2Mj",
+		}
+		for k, v := range extra {
+			ret[k] = v
+		}
+		return ret
+	}
+
+	token := signRS256(t, key, "key1", claims(map[string]interface{}{"org_id": 42}))
+	idty, raw, err := verifier.Verify(token, "n-0S6_WzA2Mj")
+	if assert.NoError(t, err) {
+		assert.Equal(t, identity.Identity{Subject: "user1", Tenant: "42", IsUser: true}, idty)
+		assert.Equal(t, "mender", raw["aud"])
+	}
+
+	_, _, err = verifier.Verify(token, "other")
+	assert.ErrorIs(t, err, ErrInvalidNonce)
+
+	token = signRS256(t, key, "key1", claims(nil))
+	_, _, err = verifier.Verify(token, "")
+	assert.ErrorIs(t, err, ErrMissingClaim)
+
+	token = signRS256(t, key, "key1", claims(map[string]interface{}{
+		"tid": "t", "aud": "other",
+	}))
+	_, _, err = verifier.Verify(token, "")
+	assert.ErrorIs(t, err, identity.ErrInvalidAudience)
+
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider := newTestProvider(t)
+	provider.setKeys(rsaJWK("key1", &key.PublicKey))
+
+	set, err := NewRemoteKeySet(context.Background(), nil, provider.URL+"/jwks")
+	require.NoError(t, err)
+	now := time.Now()
+	set.now = func() time.Time { return now }
+
+	_, err = set.Key("key1")
+	assert.NoError(t, err)
+
+	provider.setKeys(rsaJWK("key1", &key.PublicKey), rsaJWK("key2", &key.PublicKey))
+	_, err = set.Key("key2")
+	assert.ErrorIs(t, err, identity.ErrKeyNotFound, "refresh is rate limited")
+
+	now = now.Add(minRefreshInterval)
+	_, err = set.Key("key2")
+	assert.NoError(t, err)
+}
+
+func TestRemoteKeySetRefreshDoesNotBlock(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var (
+		fetches int
+		block   = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if fetches > 1 {
+			<-block
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{rsaJWK("key1", &key.PublicKey)},
+		})
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	set, err := NewRemoteKeySet(context.Background(), nil, srv.URL)
+	require.NoError(t, err)
+	now := time.Now().Add(minRefreshInterval)
+	set.now = func() time.Time { return now }
+
+	done := make(chan error)
+	go func() {
+		_, err := set.Key("unknown")
+		done <- err
+	}()
+	require.Eventually(t, func() bool {
+		set.mu.RLock()
+		defer set.mu.RUnlock()
+		return set.refreshed.Equal(now)
+	}, 5*time.Second, time.Millisecond, "refresh did not start")
+
+	_, err = set.Key("key1")
+	assert.NoError(t, err, "known keys are served during the refresh")
+	block <- struct{}{}
+	assert.ErrorIs(t, <-done, identity.ErrKeyNotFound)
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Discovery{
+			Issuer:  "https://evil.example.com",
+			JWKSURI: "https://evil.example.com/jwks",
+		})
+	}))
+	defer srv.Close()
+	_, err := Discover(context.Background(), nil, srv.URL)
+	assert.ErrorIs(t, err, ErrIssuerMismatch)
+}
@@ -0,0 +1,313 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package sso
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const (
+	samlStatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlProtocolNS    = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertionNS   = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	// MaxSAMLResponseSize limits the size of the decoded SAML responses.
+	MaxSAMLResponseSize = 512 * 1024
+)
+
+var (
+	ErrSAMLSignature       = errors.New("sso: SAML signature verification failed")
+	ErrSAMLStatus          = errors.New("sso: SAML authentication failed")
+	ErrSAMLIssuer          = errors.New("sso: SAML issuer is not trusted")
+	ErrSAMLAudience        = errors.New("sso: SAML audience does not match")
+	ErrSAMLDestination     = errors.New("sso: SAML destination does not match")
+	ErrSAMLInResponseTo    = errors.New("sso: SAML response to another request")
+	ErrSAMLExpired         = errors.New("sso: SAML assertion is expired")
+	ErrSAMLNotValidYet     = errors.New("sso: SAML assertion is not valid yet")
+	ErrSAMLNoAssertion     = errors.New("sso: SAML response must have exactly one assertion")
+	ErrSAMLEncrypted       = errors.New("sso: encrypted SAML assertions are not supported")
+	ErrSAMLResponseTooLong = errors.New("sso: SAML response too large")
+)
+
+// SAMLSignatureVerifier verifies the XML signature of the SAML response
+// (or of the assertion) with the certificate of the identity provider
+// and returns the serialized element covered by the signature: the
+// Response element or an Assertion. Only the returned element is
+// parsed, so unsigned content next to the signed element (XML signature
+// wrapping) is ignored. This package does not implement XML signature
+// canonicalization, the verifier is typically implemented with a
+// dedicated XML-DSig library.
+type SAMLSignatureVerifier interface {
+	VerifySAMLSignature(response []byte) (signed []byte, err error)
+}
+
+// SAMLSignatureVerifierFunc is a function implementing
+// SAMLSignatureVerifier.
+type SAMLSignatureVerifierFunc func(response []byte) ([]byte, error)
+
+func (f SAMLSignatureVerifierFunc) VerifySAMLSignature(response []byte) ([]byte, error) {
+	return f(response)
+}
+
+// SAMLConfig configures the validation of the SAML responses of an
+// identity provider.
+type SAMLConfig struct {
+	// IDPIssuer is the entity ID of the identity provider.
+	IDPIssuer string `json:"idp_issuer" mapstructure:"idp_issuer"`
+	// EntityID is the entity ID of the service provider, which must be
+	// an audience of the assertion.
+	EntityID string `json:"entity_id" mapstructure:"entity_id"`
+	// ACSURL is the assertion consumer service URL of the service
+	// provider; if the response has a destination it must match. If
+	// only the assertion is signed, its subject confirmation must have
+	// it as recipient.
+	ACSURL string `json:"acs_url" mapstructure:"acs_url"`
+	// Leeway is the accepted clock skew.
+	Leeway time.Duration `json:"leeway" mapstructure:"leeway"`
+
+	// Attributes maps the attributes of the assertion onto the
+	// identity, the subject defaults to the NameID.
+	Attributes ClaimMapping `json:"attributes" mapstructure:"attributes"`
+
+	// Verifier verifies the signature; it is required.
+	Verifier SAMLSignatureVerifier `json:"-" mapstructure:"-"`
+}
+
+type samlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	Destination  string   `xml:"Destination,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+	Assertions         []samlAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	EncryptedAssertion *struct{}       `xml:"urn:oasis:names:tc:SAML:2.0:assertion EncryptedAssertion"`
+
+	// signed is set if the signature covers the response, not only
+	// the assertion.
+	signed bool
+}
+
+type samlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID              string `xml:"NameID"`
+		SubjectConfirmation struct {
+			Data struct {
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				InResponseTo string    `xml:"InResponseTo,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Audiences    []string  `xml:"AudienceRestriction>Audience"`
+	} `xml:"Conditions"`
+	Attributes []struct {
+		Name   string   `xml:"Name,attr"`
+		Values []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+// SAMLAssertion is the validated content of a SAML response.
+type SAMLAssertion struct {
+	NameID     string
+	Attributes map[string][]string
+	// NotOnOrAfter is the end of the validity of the assertion, e.g. to
+	// reject replays of the response until then.
+	NotOnOrAfter time.Time
+}
+
+// ParseSAMLResponse validates the base64 encoded SAML response (the
+// SAMLResponse parameter of the HTTP-POST binding) and returns the mapped
+// identity. The signature is verified by the Verifier of the config; the
+// status, issuer, audience, destination, validity and, if requestID is not
+// empty, the request the response answers are validated by this function.
+// If only the assertion is signed, the destination and the request are
+// taken from its subject confirmation, the response attributes are not
+// trusted.
+func ParseSAMLResponse(
+	config *SAMLConfig, encoded, requestID string, now time.Time,
+) (identity.Identity, *SAMLAssertion, error) {
+	if config.Verifier == nil {
+		return identity.Identity{}, nil, errors.New("sso: SAML signature verifier is required")
+	}
+	if base64.StdEncoding.DecodedLen(len(encoded)) > MaxSAMLResponseSize {
+		return identity.Identity{}, nil, ErrSAMLResponseTooLong
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return identity.Identity{}, nil, errors.Wrap(err,
+			"sso: failed to decode SAML response")
+	}
+	signed, err := config.Verifier.VerifySAMLSignature(raw)
+	if err != nil {
+		return identity.Identity{}, nil, errors.Wrap(ErrSAMLSignature, err.Error())
+	}
+	rsp, err := parseSAMLResponse(raw, signed)
+	if err != nil {
+		return identity.Identity{}, nil, err
+	}
+	assertion, err := config.validate(rsp, requestID, now)
+	if err != nil {
+		return identity.Identity{}, nil, err
+	}
+
+	claims := make(map[string]interface{}, len(assertion.Attributes)+1)
+	for name, values := range assertion.Attributes {
+		if len(values) > 0 {
+			claims[name] = values[0]
+		}
+	}
+	mapping := config.Attributes
+	if mapping.Subject == "" {
+		mapping.Subject = "NameID"
+		claims["NameID"] = assertion.NameID
+	}
+	idty, err := mapping.Map(claims)
+	return idty, assertion, err
+}
+
+func decodeXML(b []byte, v interface{}) error {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrap(err, "sso: failed to parse SAML response")
+	}
+	return nil
+}
+
+// rootElement returns the name of the root element of the document.
+func rootElement(b []byte) (xml.Name, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, errors.Wrap(err, "sso: failed to parse SAML response")
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// parseSAMLResponse parses the response using only the assertion of the
+// signed element: if the signature covers the whole response, the
+// response must have a single assertion; if it covers an assertion, the
+// assertions of the (unsigned) response are replaced with it.
+func parseSAMLResponse(raw, signed []byte) (*samlResponse, error) {
+	root, err := rootElement(signed)
+	if err != nil {
+		return nil, errors.Wrap(ErrSAMLSignature, err.Error())
+	}
+	rsp := new(samlResponse)
+	switch root {
+	case xml.Name{Space: samlProtocolNS, Local: "Response"}:
+		if err = decodeXML(signed, rsp); err != nil {
+			return nil, err
+		}
+		rsp.signed = true
+
+	case xml.Name{Space: samlAssertionNS, Local: "Assertion"}:
+		var assertion samlAssertion
+		if err = decodeXML(signed, &assertion); err != nil {
+			return nil, err
+		}
+		if err = decodeXML(raw, rsp); err != nil {
+			return nil, err
+		}
+		rsp.Assertions = []samlAssertion{assertion}
+
+	default:
+		return nil, errors.Wrapf(ErrSAMLSignature,
+			"signed element %s is not a Response or an Assertion", root.Local)
+	}
+	return rsp, nil
+}
+
+func (config *SAMLConfig) validate(
+	rsp *samlResponse, requestID string, now time.Time,
+) (*SAMLAssertion, error) {
+	if rsp.Status.StatusCode.Value != samlStatusSuccess {
+		return nil, errors.Wrap(ErrSAMLStatus, rsp.Status.StatusCode.Value)
+	} else if rsp.EncryptedAssertion != nil {
+		return nil, ErrSAMLEncrypted
+	} else if len(rsp.Assertions) != 1 {
+		// Multiple assertions may hide an unsigned assertion next to
+		// the signed one (signature wrapping).
+		return nil, ErrSAMLNoAssertion
+	}
+	a := &rsp.Assertions[0]
+	if a.Issuer != config.IDPIssuer || (rsp.Issuer != "" && rsp.Issuer != a.Issuer) {
+		return nil, errors.Wrapf(ErrSAMLIssuer, "%q", a.Issuer)
+	}
+	if rsp.Destination != "" && rsp.Destination != config.ACSURL {
+		return nil, ErrSAMLDestination
+	}
+	data := &a.Subject.SubjectConfirmation.Data
+	if (data.Recipient != "" || (!rsp.signed && config.ACSURL != "")) &&
+		data.Recipient != config.ACSURL {
+		return nil, ErrSAMLDestination
+	}
+	if requestID != "" &&
+		(rsp.InResponseTo != requestID ||
+			((data.InResponseTo != "" || !rsp.signed) && data.InResponseTo != requestID)) {
+		return nil, ErrSAMLInResponseTo
+	}
+	var audience bool
+	for _, aud := range a.Conditions.Audiences {
+		if aud == config.EntityID {
+			audience = true
+			break
+		}
+	}
+	if !audience {
+		return nil, ErrSAMLAudience
+	}
+
+	notOnOrAfter := a.Conditions.NotOnOrAfter
+	if notOnOrAfter.IsZero() ||
+		(!data.NotOnOrAfter.IsZero() && data.NotOnOrAfter.Before(notOnOrAfter)) {
+		notOnOrAfter = data.NotOnOrAfter
+	}
+	if notOnOrAfter.IsZero() || !now.Before(notOnOrAfter.Add(config.Leeway)) {
+		return nil, ErrSAMLExpired
+	}
+	if now.Add(config.Leeway).Before(a.Conditions.NotBefore) {
+		return nil, ErrSAMLNotValidYet
+	}
+
+	attributes := make(map[string][]string, len(a.Attributes))
+	for _, attr := range a.Attributes {
+		attributes[attr.Name] = append(attributes[attr.Name], attr.Values...)
+	}
+	return &SAMLAssertion{
+		NameID:       a.Subject.NameID,
+		Attributes:   attributes,
+		NotOnOrAfter: notOnOrAfter,
+	}, nil
+}
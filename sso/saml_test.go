@@ -0,0 +1,279 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package sso
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+const testSAMLResponse = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"
+    xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"
+    ID="_response" Version="2.0" InResponseTo="_request"
+    Destination="https://mender.example.com/api/sso/acs">
+  <saml:Issuer>https://idp.example.com</saml:Issuer>
+  <samlp:Status>
+    <samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
+  </samlp:Status>
+  <saml:Assertion ID="_assertion" Version="2.0">
+    <saml:Issuer>https://idp.example.com</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID>user@example.com</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData InResponseTo="_request"
+            Recipient="https://mender.example.com/api/sso/acs"
+            NotOnOrAfter="2024-01-01T12:05:00Z"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="2024-01-01T11:55:00Z" NotOnOrAfter="2024-01-01T12:10:00Z">
+      <saml:AudienceRestriction>
+        <saml:Audience>https://mender.example.com</saml:Audience>
+      </saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="tenant">
+        <saml:AttributeValue>tenant1</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="groups">
+        <saml:AttributeValue>admins</saml:AttributeValue>
+        <saml:AttributeValue>users</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestParseSAMLResponse(t *testing.T) {
+	t.Parallel()
+	config := &SAMLConfig{
+		IDPIssuer: "https://idp.example.com",
+		EntityID:  "https://mender.example.com",
+		ACSURL:    "https://mender.example.com/api/sso/acs",
+		Attributes: ClaimMapping{
+			Tenant: []string{"tenant"},
+		},
+		Verifier: SAMLSignatureVerifierFunc(func(response []byte) ([]byte, error) {
+			return response, nil
+		}),
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	idty, assertion, err := ParseSAMLResponse(config, encode(testSAMLResponse), "_request", now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, identity.Identity{
+			Subject: "user@example.com",
+			Tenant:  "tenant1",
+			IsUser:  true,
+		}, idty)
+		assert.Equal(t, []string{"admins", "users"}, assertion.Attributes["groups"])
+		assert.Equal(t, time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC), assertion.NotOnOrAfter)
+	}
+
+	testCases := []struct {
+		Name      string
+		Response  string
+		RequestID string
+		Now       time.Time
+		Config    func(SAMLConfig) *SAMLConfig
+		Error     error
+	}{{
+		Name:  "expired",
+		Now:   now.Add(5 * time.Minute),
+		Error: ErrSAMLExpired,
+	}, {
+		Name:  "not valid yet",
+		Now:   now.Add(-10 * time.Minute),
+		Error: ErrSAMLNotValidYet,
+	}, {
+		Name:      "other request",
+		RequestID: "_other",
+		Error:     ErrSAMLInResponseTo,
+	}, {
+		Name: "wrong audience",
+		Config: func(c SAMLConfig) *SAMLConfig {
+			c.EntityID = "https://other.example.com"
+			return &c
+		},
+		Error: ErrSAMLAudience,
+	}, {
+		Name: "untrusted issuer",
+		Config: func(c SAMLConfig) *SAMLConfig {
+			c.IDPIssuer = "https://other.example.com"
+			return &c
+		},
+		Error: ErrSAMLIssuer,
+	}, {
+		Name: "wrong destination",
+		Config: func(c SAMLConfig) *SAMLConfig {
+			c.ACSURL = "https://other.example.com/acs"
+			return &c
+		},
+		Error: ErrSAMLDestination,
+	}, {
+		Name: "invalid signature",
+		Config: func(c SAMLConfig) *SAMLConfig {
+			c.Verifier = SAMLSignatureVerifierFunc(func([]byte) ([]byte, error) {
+				return nil, errors.New("digest mismatch")
+			})
+			return &c
+		},
+		Error: ErrSAMLSignature,
+	}, {
+		Name: "signed element is not an assertion",
+		Config: func(c SAMLConfig) *SAMLConfig {
+			c.Verifier = SAMLSignatureVerifierFunc(func([]byte) ([]byte, error) {
+				return []byte(`<Assertion/>`), nil
+			})
+			return &c
+		},
+		Error: ErrSAMLSignature,
+	}, {
+		Name: "unqualified issuer",
+		Response: strings.Replace(testSAMLResponse,
+			"<saml:Issuer>https://idp.example.com</saml:Issuer>\n    <saml:Subject>",
+			"<Issuer>https://idp.example.com</Issuer>\n    <saml:Subject>", 1),
+		Error: ErrSAMLIssuer,
+	}, {
+		Name: "failed status",
+		Response: strings.Replace(testSAMLResponse,
+			"status:Success", "status:Requester", 1),
+		Error: ErrSAMLStatus,
+	}, {
+		Name: "wrapped assertion",
+		Response: strings.Replace(testSAMLResponse,
+			"</samlp:Response>",
+			`<saml:Assertion><saml:Issuer>https://idp.example.com</saml:Issuer>`+
+				`</saml:Assertion></samlp:Response>`, 1),
+		Error: ErrSAMLNoAssertion,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			cfg := config
+			if tc.Config != nil {
+				cfg = tc.Config(*config)
+			}
+			response := tc.Response
+			if response == "" {
+				response = testSAMLResponse
+			}
+			requestID := tc.RequestID
+			if requestID == "" {
+				requestID = "_request"
+			}
+			at := tc.Now
+			if at.IsZero() {
+				at = now
+			}
+			_, _, err := ParseSAMLResponse(cfg, encode(response), requestID, at)
+			assert.ErrorIs(t, err, tc.Error)
+		})
+	}
+}
+
+func TestParseSAMLResponseSignedAssertion(t *testing.T) {
+	t.Parallel()
+	config := SAMLConfig{
+		IDPIssuer: "https://idp.example.com",
+		EntityID:  "https://mender.example.com",
+		ACSURL:    "https://mender.example.com/api/sso/acs",
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		Name    string
+		Replace [2]string
+		Error   error
+	}{{
+		Name: "ok",
+	}, {
+		Name: "no recipient",
+		Replace: [2]string{
+			`Recipient="https://mender.example.com/api/sso/acs"`, ""},
+		Error: ErrSAMLDestination,
+	}, {
+		Name: "no request",
+		Replace: [2]string{`<saml:SubjectConfirmationData InResponseTo="_request"`,
+			"<saml:SubjectConfirmationData"},
+		Error: ErrSAMLInResponseTo,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			response := testSAMLResponse
+			if tc.Replace[0] != "" {
+				response = strings.Replace(response, tc.Replace[0], tc.Replace[1], 1)
+			}
+			start := strings.Index(response, "<saml:Assertion ")
+			end := strings.Index(response, "</samlp:Response>")
+			signed := strings.Replace(response[start:end],
+				"<saml:Assertion ",
+				`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" `, 1)
+			cfg := config
+			cfg.Verifier = SAMLSignatureVerifierFunc(func([]byte) ([]byte, error) {
+				return []byte(signed), nil
+			})
+			_, _, err := ParseSAMLResponse(&cfg,
+				base64.StdEncoding.EncodeToString([]byte(response)), "_request", now)
+			if tc.Error == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.Error)
+			}
+		})
+	}
+}
+
+func TestParseSAMLResponseSignatureWrapping(t *testing.T) {
+	t.Parallel()
+	start := strings.Index(testSAMLResponse, "<saml:Assertion ")
+	end := strings.Index(testSAMLResponse, "</samlp:Response>")
+	// The verifier returns the signed assertion with the namespace
+	// declarations in scope.
+	signed := strings.Replace(testSAMLResponse[start:end],
+		"<saml:Assertion ",
+		`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" `, 1)
+	forged := strings.Replace(signed, "user@example.com", "admin@example.com", 1)
+	// The signed assertion is hidden in an unknown element and the forged
+	// one takes its place.
+	response := testSAMLResponse[:start] +
+		"<samlp:Extensions>" + testSAMLResponse[start:end] + "</samlp:Extensions>" +
+		forged + "</samlp:Response>"
+
+	config := &SAMLConfig{
+		IDPIssuer: "https://idp.example.com",
+		EntityID:  "https://mender.example.com",
+		ACSURL:    "https://mender.example.com/api/sso/acs",
+		Verifier: SAMLSignatureVerifierFunc(func([]byte) ([]byte, error) {
+			return []byte(signed), nil
+		}),
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	idty, _, err := ParseSAMLResponse(config,
+		base64.StdEncoding.EncodeToString([]byte(response)), "_request", now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "user@example.com", idty.Subject)
+	}
+}
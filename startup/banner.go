@@ -0,0 +1,257 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package startup logs a banner with the diagnostic information of the
+// service when it starts: the build metadata, the version of this library,
+// the configuration with the secrets redacted and the versions of the
+// servers the service depends on.
+package startup
+
+import (
+	"bufio"
+	"context"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/version"
+)
+
+const (
+	libraryPath = "github.com/mendersoftware/go-lib-micro"
+	redacted    = "[REDACTED]"
+
+	DefaultTimeout = 5 * time.Second
+)
+
+// DefaultSecretKeys are the (case-insensitive) substrings of the
+// configuration keys whose values are redacted.
+var DefaultSecretKeys = []string{
+	"password", "passwd", "secret", "token", "credential", "private",
+}
+
+// ConfigSource is the configuration logged by the banner, such as
+// config.Config.
+type ConfigSource interface {
+	AllKeys() []string
+	Get(key string) interface{}
+}
+
+// VersionFunc returns the version of a dependency.
+type VersionFunc func(ctx context.Context) (string, error)
+
+// Dependency is a server the service depends on.
+type Dependency struct {
+	Name    string
+	Version VersionFunc
+}
+
+type Options struct {
+	// Config is the configuration to summarize.
+	Config ConfigSource
+	// SecretKeys replaces DefaultSecretKeys.
+	SecretKeys []string
+	// Dependencies are the servers whose versions are logged.
+	Dependencies []Dependency
+	// Timeout limits the time for retrieving the version of each
+	// dependency (default: DefaultTimeout).
+	Timeout *time.Duration
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetConfig(config ConfigSource) *Options {
+	opts.Config = config
+	return opts
+}
+
+func (opts *Options) SetSecretKeys(keys ...string) *Options {
+	opts.SecretKeys = keys
+	return opts
+}
+
+func (opts *Options) AddDependency(name string, version VersionFunc) *Options {
+	opts.Dependencies = append(opts.Dependencies, Dependency{
+		Name:    name,
+		Version: version,
+	})
+	return opts
+}
+
+func (opts *Options) SetTimeout(timeout time.Duration) *Options {
+	opts.Timeout = &timeout
+	return opts
+}
+
+// MongoVersion returns the version of the MongoDB server.
+func MongoVersion(client *mongo.Client) VersionFunc {
+	return func(ctx context.Context) (string, error) {
+		var info struct {
+			Version string `bson:"version"`
+		}
+		err := client.Database("admin").
+			RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).
+			Decode(&info)
+		if err != nil {
+			return "", errors.Wrap(err, "startup: failed to get mongo build info")
+		}
+		return info.Version, nil
+	}
+}
+
+// RedisVersion returns the version of the Redis server.
+func RedisVersion(client redis.Cmdable) VersionFunc {
+	return func(ctx context.Context) (string, error) {
+		info, err := client.Info(ctx, "server").Result()
+		if err != nil {
+			return "", errors.Wrap(err, "startup: failed to get redis server info")
+		}
+		return parseRedisVersion(info)
+	}
+}
+
+func parseRedisVersion(info string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && key == "redis_version" {
+			return value, nil
+		}
+	}
+	return "", errors.New("startup: redis server info without redis_version")
+}
+
+// LibraryVersion returns the version of this library the service is built
+// with, or "unknown" if the binary carries no module information.
+func LibraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == libraryPath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == libraryPath {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+func isSecret(key string, secretKeys []string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, strings.ToLower(secret)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok || !strings.Contains(s, "@") {
+		return value
+	}
+	// Connection strings may embed credentials.
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return u.Redacted()
+		}
+	}
+	return value
+}
+
+// ConfigSummary returns the configuration with the values of the secret
+// keys and the passwords of URLs redacted.
+func ConfigSummary(config ConfigSource, secretKeys ...string) map[string]interface{} {
+	if len(secretKeys) == 0 {
+		secretKeys = DefaultSecretKeys
+	}
+	keys := config.AllKeys()
+	sort.Strings(keys)
+	summary := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if isSecret(key, secretKeys) {
+			summary[key] = redacted
+		} else {
+			summary[key] = redactValue(config.Get(key))
+		}
+	}
+	return summary
+}
+
+// LogBanner logs the startup banner with the logger of the context.
+// Failing to retrieve the version of a dependency is logged as a warning.
+func LogBanner(ctx context.Context, opts ...*Options) {
+	opt := NewOptions()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Config != nil {
+			opt.Config = o.Config
+		}
+		if o.SecretKeys != nil {
+			opt.SecretKeys = o.SecretKeys
+		}
+		opt.Dependencies = append(opt.Dependencies, o.Dependencies...)
+		if o.Timeout != nil {
+			opt.Timeout = o.Timeout
+		}
+	}
+	timeout := DefaultTimeout
+	if opt.Timeout != nil {
+		timeout = *opt.Timeout
+	}
+	l := log.FromContext(ctx)
+
+	build := version.Get()
+	fields := log.Ctx{
+		"version":     build.Version,
+		"commit":      build.Commit,
+		"build_date":  build.BuildDate,
+		"go_version":  build.GoVersion,
+		"lib_version": LibraryVersion(),
+	}
+	if opt.Config != nil {
+		fields["config"] = ConfigSummary(opt.Config, opt.SecretKeys...)
+	}
+	for _, dep := range opt.Dependencies {
+		depCtx, cancel := context.WithTimeout(ctx, timeout)
+		v, err := dep.Version(depCtx)
+		cancel()
+		if err != nil {
+			l.F(log.Ctx{"dependency": dep.Name}).
+				Warnf("failed to get dependency version: %s", err)
+			v = "unknown"
+		}
+		fields[dep.Name+"_version"] = v
+	}
+	l.F(fields).Info("service starting")
+}
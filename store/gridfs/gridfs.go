@@ -0,0 +1,268 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package gridfs stores objects larger than the 16MB document limit in
+// GridFS buckets scoped to the tenant of the context.
+package gridfs
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+var ErrNotFound = errors.New("gridfs: file not found")
+
+// File is the metadata of a stored file.
+type File struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Name       string             `bson:"filename"`
+	Length     int64              `bson:"length"`
+	ChunkSize  int32              `bson:"chunkSize"`
+	UploadDate time.Time          `bson:"uploadDate"`
+	Metadata   bson.Raw           `bson:"metadata,omitempty"`
+}
+
+type Options struct {
+	// ChunkSize is the size of the chunks in bytes, the default is
+	// 255KiB.
+	ChunkSize *int32
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetChunkSize(size int32) *Options {
+	opts.ChunkSize = &size
+	return opts
+}
+
+// Store stores files in the bucket of the tenant of the context, named
+// "<tenant ID>-<bucket>" (or "<bucket>" without a tenant). The metadata of
+// the files includes the tenant_id field.
+type Store struct {
+	db        *mongo.Database
+	bucket    string
+	chunkSize *int32
+}
+
+func New(db *mongo.Database, bucket string, opts ...*Options) *Store {
+	s := &Store{db: db, bucket: bucket}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.ChunkSize != nil {
+			s.chunkSize = opt.ChunkSize
+		}
+	}
+	return s
+}
+
+// BucketName returns the name of the tenant's bucket.
+func BucketName(tenantID, bucket string) string {
+	if tenantID == "" {
+		return bucket
+	}
+	return tenantID + "-" + bucket
+}
+
+// BucketName returns the name of the bucket of the tenant of the context.
+func (s *Store) BucketName(ctx context.Context) string {
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	return BucketName(tenantID, s.bucket)
+}
+
+// openBucket creates the bucket handle of the tenant with the deadlines of
+// the context. Bucket handles are cheap and not safe for concurrent use
+// with different deadlines, hence one is created per operation.
+func (s *Store) openBucket(ctx context.Context) (*gridfs.Bucket, error) {
+	opts := mopts.GridFSBucket().SetName(s.BucketName(ctx))
+	if s.chunkSize != nil {
+		opts.SetChunkSizeBytes(*s.chunkSize)
+	}
+	bucket, err := gridfs.NewBucket(s.db, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to open bucket")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetReadDeadline(deadline)
+		_ = bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+func uploadOptions(ctx context.Context, metadata interface{}) *mopts.UploadOptions {
+	if metadata == nil {
+		metadata = bson.D{}
+	}
+	return mopts.GridFSUpload().SetMetadata(v2.WithTenantID(ctx, metadata))
+}
+
+// Writer streams a file to the store; the file is complete when Close
+// returns without error.
+type Writer struct {
+	*gridfs.UploadStream
+}
+
+// ID returns the ID of the file.
+func (w *Writer) ID() primitive.ObjectID {
+	id, _ := w.FileID.(primitive.ObjectID)
+	return id
+}
+
+// NewWriter opens a stream for writing a new file. Abort the writer to
+// discard a partially written file.
+func (s *Store) NewWriter(
+	ctx context.Context,
+	filename string,
+	metadata interface{},
+) (*Writer, error) {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := bucket.OpenUploadStream(filename, uploadOptions(ctx, metadata))
+	if err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to open upload stream")
+	}
+	return &Writer{UploadStream: stream}, nil
+}
+
+// Write stores the contents of r as a new file and returns its ID.
+func (s *Store) Write(
+	ctx context.Context,
+	filename string,
+	r io.Reader,
+	metadata interface{},
+) (primitive.ObjectID, error) {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id, err := bucket.UploadFromStream(filename, r, uploadOptions(ctx, metadata))
+	if err != nil {
+		return primitive.NilObjectID, errors.Wrap(err, "gridfs: failed to upload file")
+	}
+	return id, nil
+}
+
+// Open opens the file for reading; the caller must close the reader.
+func (s *Store) Open(ctx context.Context, id primitive.ObjectID) (io.ReadCloser, error) {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := bucket.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to open download stream")
+	}
+	return stream, nil
+}
+
+// ReadTo writes the contents of the file to w.
+func (s *Store) ReadTo(ctx context.Context, id primitive.ObjectID, w io.Writer) (int64, error) {
+	r, err := s.Open(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return n, errors.Wrap(err, "gridfs: failed to read file")
+	}
+	return n, nil
+}
+
+// Stat returns the metadata of the file.
+func (s *Store) Stat(ctx context.Context, id primitive.ObjectID) (*File, error) {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	err = bucket.GetFilesCollection().
+		FindOne(ctx, bson.D{{Key: "_id", Value: id}}).
+		Decode(&file)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to get file")
+	}
+	return &file, nil
+}
+
+// Find returns the files matching the filter on the files collection,
+// e.g. bson.D{{Key: "metadata.kind", Value: "log"}}.
+func (s *Store) Find(ctx context.Context, filter interface{}) ([]File, error) {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	cur, err := bucket.FindContext(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to find files")
+	}
+	var files []File
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, errors.Wrap(err, "gridfs: failed to decode files")
+	}
+	return files, nil
+}
+
+// Delete deletes the file and its chunks.
+func (s *Store) Delete(ctx context.Context, id primitive.ObjectID) error {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return err
+	}
+	err = bucket.DeleteContext(ctx, id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return ErrNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "gridfs: failed to delete file")
+	}
+	return nil
+}
+
+// Drop deletes the bucket of the tenant of the context.
+func (s *Store) Drop(ctx context.Context) error {
+	bucket, err := s.openBucket(ctx)
+	if err != nil {
+		return err
+	}
+	if err = bucket.DropContext(ctx); err != nil {
+		return errors.Wrap(err, "gridfs: failed to drop bucket")
+	}
+	return nil
+}
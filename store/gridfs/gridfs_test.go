@@ -0,0 +1,90 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package gridfs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestBucketName(t *testing.T) {
+	t.Parallel()
+	s := New(nil, "artifacts")
+	assert.Equal(t, "artifacts", s.BucketName(context.Background()))
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Subject: "user", Tenant: "tenant1"})
+	assert.Equal(t, "tenant1-artifacts", s.BucketName(ctx))
+	assert.Equal(t, "tenant2-artifacts", BucketName("tenant2", "artifacts"))
+}
+
+func TestStore(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "gridfs")
+		s := New(db.Database, "artifacts", NewOptions().SetChunkSize(1024))
+		ctx := db.Context("tenant1")
+		otherCtx := db.Context("tenant2")
+
+		content := bytes.Repeat([]byte("0123456789"), 1000)
+		id, err := s.Write(ctx, "artifact.mender", bytes.NewReader(content),
+			bson.D{{Key: "kind", Value: "artifact"}})
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		n, err := s.ReadTo(ctx, id, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+
+		file, err := s.Stat(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, "artifact.mender", file.Name)
+		assert.Equal(t, "tenant1", file.Metadata.Lookup("tenant_id").StringValue())
+
+		// Other tenants do not see the file.
+		_, err = s.Open(otherCtx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+		files, err := s.Find(otherCtx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+
+		w, err := s.NewWriter(ctx, "log.txt", nil)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("streamed"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		files, err = s.Find(ctx, bson.D{{Key: "metadata.kind", Value: "artifact"}})
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+
+		assert.NoError(t, s.Delete(ctx, w.ID()))
+		assert.ErrorIs(t, s.Delete(ctx, w.ID()), ErrNotFound)
+		assert.ErrorIs(t, s.Delete(ctx, primitive.NewObjectID()), ErrNotFound)
+		assert.NoError(t, s.Drop(ctx))
+		return 0
+	}, nil)
+}
@@ -0,0 +1,397 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package tenant2field migrates the data of the tenant databases
+// ("<db>-<tenant ID>") into the shared database ("<db>"), scoping the
+// documents with the tenant_id field.
+//
+// The documents are copied in batches ordered by _id and the progress is
+// recorded in the ProgressCollection of the shared database, so an
+// interrupted migration resumes with the last incomplete batch. Resuming
+// relies on the _id values of a collection having the same BSON type.
+package tenant2field
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	v1 "github.com/mendersoftware/go-lib-micro/store"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+const (
+	DefaultBatchSize = 1000
+
+	// ProgressCollection is the collection of the shared database
+	// recording the progress of the migration.
+	ProgressCollection = "migration_tenant2field"
+)
+
+var (
+	ErrVerificationFailed = errors.New(
+		"tenant2field: migrated documents do not match the source")
+)
+
+type Options struct {
+	// BatchSize is the number of documents copied per batch, the
+	// default is DefaultBatchSize.
+	BatchSize *int
+	// Collections limits the migration to the given collections. By
+	// default, all collections except the system collections and the
+	// migration bookkeeping (migrate.DbMigrationsColl) are migrated.
+	Collections []string
+	// SkipVerify disables comparing the document counts and checksums
+	// of the source and migrated documents.
+	SkipVerify *bool
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetBatchSize(size int) *Options {
+	opts.BatchSize = &size
+	return opts
+}
+
+func (opts *Options) SetCollections(collections ...string) *Options {
+	opts.Collections = collections
+	return opts
+}
+
+func (opts *Options) SetSkipVerify(skip bool) *Options {
+	opts.SkipVerify = &skip
+	return opts
+}
+
+// CollectionReport is the result of migrating a collection of a tenant
+// database.
+type CollectionReport struct {
+	Database   string
+	Collection string
+	TenantID   string
+	// Copied is the number of documents copied, including the ones
+	// copied by previous runs.
+	Copied int64
+	// Count and Checksum of the source documents; set unless the
+	// verification is skipped.
+	Count    int64
+	Checksum uint64
+}
+
+type Report struct {
+	Collections []CollectionReport
+}
+
+type progress struct {
+	ID        string        `bson:"_id"`
+	LastID    bson.RawValue `bson:"last_id,omitempty"`
+	Copied    int64         `bson:"copied"`
+	Done      bool          `bson:"done"`
+	UpdatedTS time.Time     `bson:"updated_ts"`
+}
+
+type migrator struct {
+	client      *mongo.Client
+	baseDb      string
+	batchSize   int
+	collections []string
+	verify      bool
+}
+
+// Migrate copies the documents of all tenant databases of baseDb into the
+// shared database baseDb, adding the tenant_id field. The tenant databases
+// are left in place.
+func Migrate(
+	ctx context.Context,
+	client *mongo.Client,
+	baseDb string,
+	opts ...*Options,
+) (*Report, error) {
+	m := &migrator{
+		client:    client,
+		baseDb:    baseDb,
+		batchSize: DefaultBatchSize,
+		verify:    true,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.BatchSize != nil && *opt.BatchSize > 0 {
+			m.batchSize = *opt.BatchSize
+		}
+		if opt.Collections != nil {
+			m.collections = opt.Collections
+		}
+		if opt.SkipVerify != nil {
+			m.verify = !*opt.SkipVerify
+		}
+	}
+	names, err := client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, errors.Wrap(err, "tenant2field: failed to list databases")
+	}
+	isTenantDb := v1.IsTenantDb(baseDb)
+	report := &Report{}
+	sort.Strings(names)
+	for _, dbName := range names {
+		if !isTenantDb(dbName) {
+			continue
+		}
+		reports, err := m.migrateDatabase(ctx, dbName)
+		report.Collections = append(report.Collections, reports...)
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (m *migrator) collectionNames(ctx context.Context, db *mongo.Database) ([]string, error) {
+	if m.collections != nil {
+		return m.collections, nil
+	}
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"tenant2field: failed to list collections of %q", db.Name())
+	}
+	ret := names[:0]
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") ||
+			name == migrate.DbMigrationsColl {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (m *migrator) migrateDatabase(
+	ctx context.Context,
+	dbName string,
+) ([]CollectionReport, error) {
+	tenantID := v1.TenantFromDbName(dbName, m.baseDb)
+	source := m.client.Database(dbName)
+	collections, err := m.collectionNames(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]CollectionReport, 0, len(collections))
+	for _, coll := range collections {
+		report := CollectionReport{
+			Database:   dbName,
+			Collection: coll,
+			TenantID:   tenantID,
+		}
+		report.Copied, err = m.copyCollection(ctx, source.Collection(coll), tenantID)
+		if err == nil && m.verify {
+			report.Count, report.Checksum, err = m.verifyCollection(
+				ctx, source.Collection(coll), tenantID)
+		}
+		reports = append(reports, report)
+		if err != nil {
+			return reports, err
+		}
+		log.FromContext(ctx).Infof(
+			"tenant2field: migrated %d documents of %s.%s",
+			report.Copied, dbName, coll)
+	}
+	return reports, nil
+}
+
+// stripTenantID returns the elements of the document except tenant_id,
+// with spare capacity for appending it.
+func stripTenantID(doc bson.Raw) (bson.D, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(bson.D, 0, len(elems)+1)
+	for _, elem := range elems {
+		if elem.Key() == v2.FieldTenantID {
+			continue
+		}
+		ret = append(ret, bson.E{Key: elem.Key(), Value: elem.Value()})
+	}
+	return ret, nil
+}
+
+func (m *migrator) copyCollection(
+	ctx context.Context,
+	source *mongo.Collection,
+	tenantID string,
+) (int64, error) {
+	key := source.Database().Name() + "/" + source.Name()
+	progressColl := m.client.Database(m.baseDb).Collection(ProgressCollection)
+	state := progress{ID: key}
+	err := progressColl.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&state)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, errors.Wrapf(err,
+			"tenant2field: failed to load the progress of %s", key)
+	}
+	if state.Done {
+		return state.Copied, nil
+	}
+	target := m.client.Database(m.baseDb).Collection(source.Name())
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{Tenant: tenantID})
+	findOpts := mopts.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(m.batchSize))
+	for {
+		filter := bson.D{}
+		if state.LastID.Type != 0 {
+			filter = bson.D{{Key: "_id", Value: bson.D{
+				{Key: "$gt", Value: state.LastID},
+			}}}
+		}
+		cur, err := source.Find(ctx, filter, findOpts)
+		if err != nil {
+			return state.Copied, errors.Wrapf(err,
+				"tenant2field: failed to read %s", key)
+		}
+		var batch []bson.Raw
+		if err = cur.All(ctx, &batch); err != nil {
+			return state.Copied, errors.Wrapf(err,
+				"tenant2field: failed to read %s", key)
+		}
+		if len(batch) > 0 {
+			models := make([]mongo.WriteModel, len(batch))
+			for i, raw := range batch {
+				doc, err := stripTenantID(raw)
+				if err != nil {
+					return state.Copied, errors.Wrapf(err,
+						"tenant2field: invalid document in %s", key)
+				}
+				doc = v2.AppendTenantID(tenantCtx, doc)
+				// Replacing by _id and tenant_id makes retrying a
+				// batch idempotent, while an _id already used by
+				// another tenant fails with a duplicate key error.
+				models[i] = mongo.NewReplaceOneModel().
+					SetFilter(bson.D{
+						{Key: "_id", Value: raw.Lookup("_id")},
+						{Key: v2.FieldTenantID, Value: tenantID},
+					}).
+					SetReplacement(doc).
+					SetUpsert(true)
+			}
+			_, err = target.BulkWrite(ctx, models, mopts.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return state.Copied, errors.Wrapf(err,
+					"tenant2field: failed to write documents of %s", key)
+			}
+			state.LastID = batch[len(batch)-1].Lookup("_id")
+			state.Copied += int64(len(batch))
+		}
+		state.Done = len(batch) < m.batchSize
+		state.UpdatedTS = time.Now()
+		_, err = progressColl.ReplaceOne(ctx,
+			bson.D{{Key: "_id", Value: key}}, state,
+			mopts.Replace().SetUpsert(true))
+		if err != nil {
+			return state.Copied, errors.Wrapf(err,
+				"tenant2field: failed to save the progress of %s", key)
+		}
+		if state.Done {
+			return state.Copied, nil
+		}
+	}
+}
+
+// Checksum returns an order independent checksum of the documents
+// ignoring the tenant_id field, such that the checksum of the documents of
+// a tenant database equals the checksum of the migrated documents.
+func Checksum(docs ...bson.Raw) (uint64, error) {
+	var sum uint64
+	for _, doc := range docs {
+		h, err := checksum(doc)
+		if err != nil {
+			return 0, err
+		}
+		sum += h
+	}
+	return sum, nil
+}
+
+func checksum(doc bson.Raw) (uint64, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	for _, elem := range elems {
+		if elem.Key() == v2.FieldTenantID {
+			continue
+		}
+		_, _ = h.Write(elem)
+	}
+	return h.Sum64(), nil
+}
+
+func collectionChecksum(
+	ctx context.Context,
+	coll *mongo.Collection,
+	filter interface{},
+) (count int64, sum uint64, err error) {
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		h, err := checksum(cur.Current)
+		if err != nil {
+			return 0, 0, err
+		}
+		count++
+		sum += h
+	}
+	return count, sum, cur.Err()
+}
+
+func (m *migrator) verifyCollection(
+	ctx context.Context,
+	source *mongo.Collection,
+	tenantID string,
+) (int64, uint64, error) {
+	name := source.Database().Name() + "/" + source.Name()
+	count, sum, err := collectionChecksum(ctx, source, bson.D{})
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "tenant2field: failed to verify %s", name)
+	}
+	target := m.client.Database(m.baseDb).Collection(source.Name())
+	targetCount, targetSum, err := collectionChecksum(ctx, target,
+		bson.D{{Key: v2.FieldTenantID, Value: tenantID}})
+	if err != nil {
+		return count, sum, errors.Wrapf(err, "tenant2field: failed to verify %s", name)
+	}
+	if count != targetCount || sum != targetSum {
+		return count, sum, errors.Wrapf(ErrVerificationFailed,
+			"%s: %d source and %d migrated documents", name, count, targetCount)
+	}
+	return count, sum, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenant2field
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+	"github.com/mendersoftware/go-lib-micro/store"
+)
+
+func mustMarshal(t *testing.T, doc interface{}) bson.Raw {
+	b, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	return b
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+	a := mustMarshal(t, bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "a"}})
+	b := mustMarshal(t, bson.D{{Key: "_id", Value: 2}, {Key: "name", Value: "b"}})
+	migratedA := mustMarshal(t, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "name", Value: "a"},
+		{Key: "tenant_id", Value: "tenant1"},
+	})
+
+	sum, err := Checksum(a, b)
+	require.NoError(t, err)
+	reversed, err := Checksum(b, migratedA)
+	require.NoError(t, err)
+	assert.Equal(t, sum, reversed)
+
+	other, err := Checksum(a, mustMarshal(t, bson.D{
+		{Key: "_id", Value: 2}, {Key: "name", Value: "c"},
+	}))
+	require.NoError(t, err)
+	assert.NotEqual(t, sum, other)
+
+	_, err = Checksum(bson.Raw{0x01})
+	assert.Error(t, err)
+}
+
+func TestStripTenantID(t *testing.T) {
+	t.Parallel()
+	doc, err := stripTenantID(mustMarshal(t, bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "tenant_id", Value: "stale"},
+		{Key: "name", Value: "a"},
+	}))
+	require.NoError(t, err)
+	if assert.Len(t, doc, 2) {
+		assert.Equal(t, "_id", doc[0].Key)
+		assert.Equal(t, "name", doc[1].Key)
+	}
+	assert.Greater(t, cap(doc), len(doc))
+}
+
+func TestMigrate(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "tenant2field")
+		ctx := context.Background()
+		client := runner.Client()
+		for _, tenant := range []string{"tenant1", "tenant2"} {
+			coll := client.
+				Database(store.DbNameForTenant(tenant, db.Name())).
+				Collection("devices")
+			docs := make([]interface{}, 25)
+			for i := range docs {
+				docs[i] = bson.D{
+					{Key: "_id", Value: fmt.Sprintf("%s-%02d", tenant, i)},
+					{Key: "index", Value: i},
+				}
+			}
+			_, err := coll.InsertMany(ctx, docs)
+			require.NoError(t, err)
+		}
+
+		report, err := Migrate(ctx, client, db.Name(), NewOptions().SetBatchSize(10))
+		require.NoError(t, err)
+		require.Len(t, report.Collections, 2)
+		for _, coll := range report.Collections {
+			assert.Equal(t, int64(25), coll.Copied)
+			assert.Equal(t, int64(25), coll.Count)
+		}
+		n, err := db.Collection("devices").
+			CountDocuments(ctx, bson.D{{Key: "tenant_id", Value: "tenant2"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(25), n)
+
+		// Running again resumes from the recorded progress.
+		report, err = Migrate(ctx, client, db.Name())
+		require.NoError(t, err)
+		assert.Equal(t, int64(25), report.Collections[0].Copied)
+
+		// Verification detects modified documents.
+		_, err = db.Collection("devices").UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: "tenant1-00"}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "index", Value: -1}}}})
+		require.NoError(t, err)
+		_, err = Migrate(ctx, client, db.Name())
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		return 0
+	}, nil)
+}
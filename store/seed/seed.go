@@ -0,0 +1,151 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package seed inserts the initial documents of a service, such as default
+// roles and settings, once per database and tenant. The applied seed
+// versions are tracked in the database so the seeds can be applied on
+// every startup.
+package seed
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+const (
+	// DbSeedsColl holds the applied version of each seed.
+	DbSeedsColl = "seed_info"
+)
+
+// Seed is a set of documents inserted into a collection.
+type Seed struct {
+	// Name identifies the seed.
+	Name string
+	// Version of the seed; increase it to insert documents added to the
+	// seed. The documents are inserted if the applied version is lower.
+	Version int
+	// Collection is the name of the collection of the documents.
+	Collection string
+	// Documents are inserted with the tenant_id of the context. The
+	// documents should have a fixed _id (unique across the tenants of a
+	// shared collection): existing documents are never overwritten, so
+	// the changes made after seeding are preserved, and documents
+	// inserted by an earlier version are skipped.
+	Documents []interface{}
+}
+
+// Entry is the applied version of a seed.
+type Entry struct {
+	Name      string    `bson:"name"`
+	TenantID  string    `bson:"tenant_id"`
+	Version   int       `bson:"version"`
+	Timestamp time.Time `bson:"timestamp"`
+}
+
+func (s Seed) validate() error {
+	if s.Name == "" {
+		return errors.New("seed: name is required")
+	} else if s.Collection == "" {
+		return errors.Errorf("seed: %q: collection is required", s.Name)
+	}
+	return nil
+}
+
+// isDuplicateOnly returns true if all the write errors of err are
+// duplicate key errors.
+func isDuplicateOnly(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) ||
+		bulkErr.WriteConcernError != nil ||
+		len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(writeErr) {
+			return false
+		}
+	}
+	return true
+}
+
+func applied(ctx context.Context, db *mongo.Database, name string) (int, error) {
+	var entry Entry
+	err := db.Collection(DbSeedsColl).
+		FindOne(ctx, v2.WithTenantID(ctx, bson.D{{Key: "name", Value: name}})).
+		Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "seed: %q: failed to get seed info", name)
+	}
+	return entry.Version, nil
+}
+
+func apply(ctx context.Context, db *mongo.Database, s Seed) (bool, error) {
+	version, err := applied(ctx, db, s.Name)
+	if err != nil {
+		return false, err
+	} else if version >= s.Version {
+		return false, nil
+	}
+	if len(s.Documents) > 0 {
+		docs := make([]interface{}, len(s.Documents))
+		for i, doc := range s.Documents {
+			docs[i] = v2.WithTenantID(ctx, doc)
+		}
+		_, err = db.Collection(s.Collection).
+			InsertMany(ctx, docs, mopts.InsertMany().SetOrdered(false))
+		if err != nil && !isDuplicateOnly(err) {
+			return false, errors.Wrapf(err, "seed: %q: failed to insert documents", s.Name)
+		}
+	}
+	_, err = db.Collection(DbSeedsColl).UpdateOne(ctx,
+		v2.WithTenantID(ctx, bson.D{{Key: "name", Value: s.Name}}),
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "version", Value: s.Version},
+			{Key: "timestamp", Value: v2.Timestamp(nil)},
+		}}},
+		mopts.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "seed: %q: failed to update seed info", s.Name)
+	}
+	return true, nil
+}
+
+// Apply inserts the documents of the seeds which have not been applied
+// (in the given version) to the database for the tenant of the context.
+func Apply(ctx context.Context, db *mongo.Database, seeds ...Seed) error {
+	l := log.FromContext(ctx)
+	for _, s := range seeds {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		ok, err := apply(ctx, db, s)
+		if err != nil {
+			return err
+		} else if ok {
+			l.Infof("seed: applied %q version %d", s.Name, s.Version)
+		}
+	}
+	return nil
+}
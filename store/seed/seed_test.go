@@ -0,0 +1,98 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package seed
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestIsDuplicateOnly(t *testing.T) {
+	t.Parallel()
+	duplicate := mongo.BulkWriteError{WriteError: mongo.WriteError{Code: 11000}}
+	other := mongo.BulkWriteError{WriteError: mongo.WriteError{Code: 121}}
+
+	assert.True(t, isDuplicateOnly(mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{duplicate, duplicate},
+	}))
+	assert.False(t, isDuplicateOnly(mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{duplicate, other},
+	}))
+	assert.False(t, isDuplicateOnly(mongo.BulkWriteException{
+		WriteConcernError: &mongo.WriteConcernError{Code: 64},
+		WriteErrors:       []mongo.BulkWriteError{duplicate},
+	}))
+	assert.False(t, isDuplicateOnly(context.Canceled))
+}
+
+func TestApply(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "seed")
+		ctx := db.Context("tenant1")
+		roles := db.Collection("roles")
+
+		seed := Seed{
+			Name:       "roles",
+			Version:    1,
+			Collection: "roles",
+			Documents: []interface{}{
+				bson.D{{Key: "_id", Value: "tenant1-admin"}, {Key: "name", Value: "Admin"}},
+			},
+		}
+		require.NoError(t, Apply(ctx, db.Database, seed))
+
+		// Changes made after seeding are preserved
+		_, err := roles.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: "tenant1-admin"}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "Owner"}}}})
+		require.NoError(t, err)
+		require.NoError(t, Apply(ctx, db.Database, seed))
+
+		seed.Version = 2
+		seed.Documents = append(seed.Documents,
+			bson.D{{Key: "_id", Value: "tenant1-reader"}, {Key: "name", Value: "Reader"}})
+		require.NoError(t, Apply(ctx, db.Database, seed))
+
+		var docs []bson.M
+		cur, err := roles.Find(ctx, bson.D{}, nil)
+		require.NoError(t, err)
+		require.NoError(t, cur.All(ctx, &docs))
+		assert.Equal(t, []bson.M{
+			{"_id": "tenant1-admin", "name": "Owner", "tenant_id": "tenant1"},
+			{"_id": "tenant1-reader", "name": "Reader", "tenant_id": "tenant1"},
+		}, docs)
+
+		version, err := applied(ctx, db.Database, "roles")
+		require.NoError(t, err)
+		assert.Equal(t, 2, version)
+		version, err = applied(db.Context("tenant2"), db.Database, "roles")
+		require.NoError(t, err)
+		assert.Zero(t, version)
+
+		assert.Error(t, Apply(ctx, db.Database, Seed{Name: "invalid"}))
+		return 0
+	}, nil)
+}
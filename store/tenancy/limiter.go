@@ -0,0 +1,231 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenancy
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+type limiterWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+type limiterTenant struct {
+	active  int
+	waiters []*limiterWaiter
+}
+
+// Limiter limits the number of concurrent database operations in total and
+// per tenant, such that the heavy workload of a single tenant cannot
+// exhaust the connection pool shared by all tenants. The operations waiting
+// for capacity are queued per tenant and the tenants are served in a round
+// robin order; the operations of a tenant are served in FIFO order.
+//
+// The total limit should not exceed the maximum pool size of the client
+// (options.ClientOptions.SetMaxPoolSize).
+type Limiter struct {
+	maxTotal     int
+	maxPerTenant int
+
+	mu      sync.Mutex
+	active  int
+	tenants map[string]*limiterTenant
+	// queue lists the tenants with waiting operations in round robin
+	// order starting at next.
+	queue []string
+	next  int
+}
+
+// NewLimiter creates a limiter allowing maxTotal concurrent operations of
+// which at most maxPerTenant for a single tenant. Non-positive limits are
+// unlimited.
+func NewLimiter(maxTotal, maxPerTenant int) *Limiter {
+	return &Limiter{
+		maxTotal:     maxTotal,
+		maxPerTenant: maxPerTenant,
+		tenants:      make(map[string]*limiterTenant),
+	}
+}
+
+func (l *Limiter) available(t *limiterTenant) bool {
+	return (l.maxTotal <= 0 || l.active < l.maxTotal) &&
+		(l.maxPerTenant <= 0 || t.active < l.maxPerTenant)
+}
+
+func (l *Limiter) tenant(tenantID string) *limiterTenant {
+	t, ok := l.tenants[tenantID]
+	if !ok {
+		t = new(limiterTenant)
+		l.tenants[tenantID] = t
+	}
+	return t
+}
+
+func (l *Limiter) cleanup(tenantID string, t *limiterTenant) {
+	if t.active == 0 && len(t.waiters) == 0 {
+		delete(l.tenants, tenantID)
+	}
+}
+
+func (l *Limiter) dequeue(i int) {
+	l.queue = append(l.queue[:i], l.queue[i+1:]...)
+	if i < l.next {
+		l.next--
+	}
+	if l.next >= len(l.queue) {
+		l.next = 0
+	}
+}
+
+// dispatch grants the available capacity to the waiting operations.
+func (l *Limiter) dispatch() {
+	for len(l.queue) > 0 {
+		var granted bool
+		for i := 0; i < len(l.queue); i++ {
+			idx := (l.next + i) % len(l.queue)
+			t := l.tenants[l.queue[idx]]
+			if !l.available(t) {
+				continue
+			}
+			w := t.waiters[0]
+			t.waiters = t.waiters[1:]
+			w.granted = true
+			close(w.ready)
+			t.active++
+			l.active++
+			if len(t.waiters) == 0 {
+				l.next = idx
+				l.dequeue(idx)
+			} else {
+				l.next = (idx + 1) % len(l.queue)
+			}
+			granted = true
+			break
+		}
+		if !granted {
+			return
+		}
+	}
+}
+
+func (l *Limiter) release(tenantID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.tenants[tenantID]
+	t.active--
+	l.active--
+	l.dispatch()
+	l.cleanup(tenantID, t)
+}
+
+func (l *Limiter) releaseFunc(tenantID string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(tenantID) })
+	}
+}
+
+// Acquire waits until the operation of the tenant can proceed and returns
+// the function releasing the capacity when the operation is done. If the
+// context is done while waiting, the context error is returned.
+func (l *Limiter) Acquire(ctx context.Context, tenantID string) (func(), error) {
+	l.mu.Lock()
+	t := l.tenant(tenantID)
+	if len(t.waiters) == 0 && l.available(t) {
+		t.active++
+		l.active++
+		l.mu.Unlock()
+		return l.releaseFunc(tenantID), nil
+	}
+	w := &limiterWaiter{ready: make(chan struct{})}
+	if len(t.waiters) == 0 {
+		l.queue = append(l.queue, tenantID)
+	}
+	t.waiters = append(t.waiters, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaseFunc(tenantID), nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	if w.granted {
+		l.mu.Unlock()
+		l.release(tenantID)
+	} else {
+		for i, other := range t.waiters {
+			if other == w {
+				t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+				break
+			}
+		}
+		if len(t.waiters) == 0 {
+			for i, id := range l.queue {
+				if id == tenantID {
+					l.dequeue(i)
+					break
+				}
+			}
+		}
+		l.cleanup(tenantID, t)
+		l.mu.Unlock()
+	}
+	return nil, errors.Wrap(ctx.Err(),
+		"tenancy: timeout waiting for database capacity")
+}
+
+// Stats returns the number of active and waiting operations of the tenant.
+func (l *Limiter) Stats(tenantID string) (active, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.tenants[tenantID]; ok {
+		return t.active, len(t.waiters)
+	}
+	return 0, 0
+}
+
+// SetLimiter limits the concurrent operations per tenant, see Acquire.
+func (s *Store) SetLimiter(limiter *Limiter) *Store {
+	s.limiter = limiter
+	return s
+}
+
+// Acquire waits for the capacity of the Limiter for an operation of the
+// tenant of the context and returns the function to call when the
+// operation is done. Without a Limiter Acquire returns immediately.
+//
+//	release, err := store.Acquire(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer release()
+//	cur, err := store.Collection(ctx, "devices").Find(ctx, filter)
+func (s *Store) Acquire(ctx context.Context) (func(), error) {
+	if s.limiter == nil {
+		return func() {}, nil
+	}
+	var tenantID string
+	if id := identity.FromContext(ctx); id != nil {
+		tenantID = id.Tenant
+	}
+	return s.limiter.Acquire(ctx, tenantID)
+}
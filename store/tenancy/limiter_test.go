@@ -0,0 +1,154 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenancy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+func waitFor(t *testing.T, l *Limiter, tenantID string, waiting int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, n := l.Stats(tenantID); n == waiting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d queued operations of %q", waiting, tenantID)
+}
+
+func TestLimiterPerTenant(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(0, 1)
+	ctx := context.Background()
+
+	releaseA, err := l.Acquire(ctx, "a")
+	require.NoError(t, err)
+	// Other tenants are not affected
+	releaseB, err := l.Acquire(ctx, "b")
+	require.NoError(t, err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(timeoutCtx, "a")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	active, waiting := l.Stats("a")
+	assert.Equal(t, 1, active)
+	assert.Equal(t, 0, waiting)
+
+	done := make(chan struct{})
+	go func() {
+		release, err := l.Acquire(ctx, "a")
+		if assert.NoError(t, err) {
+			release()
+		}
+		close(done)
+	}()
+	waitFor(t, l, "a", 1)
+	releaseA()
+	releaseA() // release is idempotent
+	<-done
+	releaseB()
+
+	active, waiting = l.Stats("a")
+	assert.Equal(t, 0, active)
+	assert.Equal(t, 0, waiting)
+	assert.Empty(t, l.tenants, "idle tenants must be removed")
+}
+
+func TestLimiterFairness(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(1, 0)
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, "a")
+	require.NoError(t, err)
+
+	order := make(chan string, 4)
+	acquire := func(tenantID string) {
+		release, err := l.Acquire(ctx, tenantID)
+		if assert.NoError(t, err) {
+			order <- tenantID
+			release()
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		go acquire("a")
+		waitFor(t, l, "a", i)
+	}
+	go acquire("b")
+	waitFor(t, l, "b", 1)
+
+	// The busy tenant does not starve the other tenant
+	release()
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, <-order)
+	}
+	assert.Equal(t, []string{"a", "b", "a", "a"}, got)
+}
+
+func TestLimiterCancelled(t *testing.T) {
+	t.Parallel()
+	l := NewLimiter(1, 0)
+	ctx := context.Background()
+	release, err := l.Acquire(ctx, "a")
+	require.NoError(t, err)
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(cancelCtx, "b")
+		errs <- err
+	}()
+	waitFor(t, l, "b", 1)
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Empty(t, l.queue)
+
+	release()
+	release, err = l.Acquire(ctx, "c")
+	require.NoError(t, err)
+	release()
+}
+
+func TestStoreAcquire(t *testing.T) {
+	t.Parallel()
+	store, err := New(nil, "deviceauth", ModeMultiDB)
+	require.NoError(t, err)
+	release, err := store.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+
+	limiter := NewLimiter(0, 1)
+	store.SetLimiter(limiter)
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Subject: "user", Tenant: "tenant1"})
+	release, err = store.Acquire(ctx)
+	require.NoError(t, err)
+	active, _ := limiter.Stats("tenant1")
+	assert.Equal(t, 1, active)
+	release()
+	active, _ = limiter.Stats("tenant1")
+	assert.Equal(t, 0, active)
+}
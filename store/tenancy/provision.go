@@ -0,0 +1,134 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenancy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+var ErrTenantRequired = errors.New("tenancy: tenant ID is required")
+
+// TenantHook is the service specific part of provisioning and
+// deprovisioning a tenant, e.g. creating the indexes of the tenant
+// database or seeding the default documents. The hooks receive the
+// tenant's database and a context with the identity of the tenant, so
+// the Store helpers (Filter, Document) scope to the tenant. The hooks
+// must be idempotent: provisioning is retried on failure and may be
+// repeated for an existing tenant.
+type TenantHook struct {
+	// Name identifies the hook in the errors.
+	Name string
+	// Provision is called by ProvisionTenant, may be nil.
+	Provision func(ctx context.Context, db *mongo.Database) error
+	// Deprovision is called by DeprovisionTenant before the tenant's
+	// data is deleted, may be nil.
+	Deprovision func(ctx context.Context, db *mongo.Database) error
+}
+
+// AddTenantHooks registers hooks to run when (de)provisioning a tenant.
+// The hooks are provisioned in the order of registration and
+// deprovisioned in the reverse order.
+func (s *Store) AddTenantHooks(hooks ...TenantHook) *Store {
+	s.hooks = append(s.hooks, hooks...)
+	return s
+}
+
+// tenantContext returns ctx with the identity of the tenant; the other
+// properties of the identity of ctx are preserved.
+func tenantContext(ctx context.Context, tenantID string) context.Context {
+	var id identity.Identity
+	if current := identity.FromContext(ctx); current != nil {
+		id = *current
+	}
+	id.Tenant = tenantID
+	return identity.WithContext(ctx, &id)
+}
+
+// ProvisionTenant runs the Provision hooks for a new tenant. In
+// ModeMultiDB the tenant's database is created by the first write of the
+// hooks. ProvisionTenant is idempotent given idempotent hooks.
+func (s *Store) ProvisionTenant(ctx context.Context, tenantID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	ctx = tenantContext(ctx, tenantID)
+	db := s.Database(ctx)
+	for _, hook := range s.hooks {
+		if hook.Provision == nil {
+			continue
+		}
+		if err := hook.Provision(ctx, db); err != nil {
+			return errors.Wrapf(err,
+				"tenancy: failed to provision tenant %q (%s)",
+				tenantID, hook.Name)
+		}
+	}
+	return nil
+}
+
+// DeprovisionTenant runs the Deprovision hooks and deletes the tenant's
+// data: in ModeMultiDB the tenant's database is dropped and in ModeShared
+// the tenant's documents are deleted from all collections of the shared
+// database. Deprovisioning a tenant without data is not an error.
+func (s *Store) DeprovisionTenant(ctx context.Context, tenantID string) error {
+	if tenantID == "" {
+		return ErrTenantRequired
+	}
+	ctx = tenantContext(ctx, tenantID)
+	db := s.Database(ctx)
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		hook := s.hooks[i]
+		if hook.Deprovision == nil {
+			continue
+		}
+		if err := hook.Deprovision(ctx, db); err != nil {
+			return errors.Wrapf(err,
+				"tenancy: failed to deprovision tenant %q (%s)",
+				tenantID, hook.Name)
+		}
+	}
+	if !s.shared() {
+		if err := db.Drop(ctx); err != nil {
+			return errors.Wrapf(err,
+				"tenancy: failed to drop the database of tenant %q", tenantID)
+		}
+		return nil
+	}
+	names, err := db.ListCollectionNames(ctx,
+		bson.D{{Key: "type", Value: "collection"}})
+	if err != nil {
+		return errors.Wrap(err, "tenancy: failed to list collections")
+	}
+	filter := bson.D{{Key: v2.FieldTenantID, Value: tenantID}}
+	for _, name := range names {
+		if strings.HasPrefix(name, "system.") {
+			continue
+		}
+		if _, err := db.Collection(name).DeleteMany(ctx, filter); err != nil {
+			return errors.Wrapf(err,
+				"tenancy: failed to delete the documents of tenant %q from %q",
+				tenantID, name)
+		}
+	}
+	return nil
+}
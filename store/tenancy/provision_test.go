@@ -0,0 +1,122 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestProvisionTenant(t *testing.T) {
+	// The client does not connect until the first operation.
+	client, err := mongo.Connect(context.Background(),
+		options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+
+	store, err := New(client, "deviceauth", ModeMultiDB)
+	require.NoError(t, err)
+	var calls []string
+	hook := func(name string, err error) TenantHook {
+		return TenantHook{
+			Name: name,
+			Provision: func(ctx context.Context, db *mongo.Database) error {
+				assert.Equal(t, "deviceauth-tenant1", db.Name())
+				id := identity.FromContext(ctx)
+				if assert.NotNil(t, id) {
+					assert.Equal(t, "tenant1", id.Tenant)
+					assert.Equal(t, "admin", id.Subject)
+				}
+				calls = append(calls, name)
+				return err
+			},
+		}
+	}
+	store.AddTenantHooks(hook("indexes", nil), TenantHook{Name: "noop"}, hook("seed", nil))
+
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Subject: "admin"})
+	assert.NoError(t, store.ProvisionTenant(ctx, "tenant1"))
+	assert.Equal(t, []string{"indexes", "seed"}, calls)
+	assert.Empty(t, identity.FromContext(ctx).Tenant)
+
+	boom := errors.New("boom")
+	calls = nil
+	store.hooks = []TenantHook{hook("fail", boom), hook("skipped", nil)}
+	err = store.ProvisionTenant(ctx, "tenant1")
+	assert.ErrorIs(t, err, boom)
+	assert.Contains(t, err.Error(), "(fail)")
+	assert.Equal(t, []string{"fail"}, calls)
+
+	assert.ErrorIs(t, store.ProvisionTenant(ctx, ""), ErrTenantRequired)
+	assert.ErrorIs(t, store.DeprovisionTenant(ctx, ""), ErrTenantRequired)
+}
+
+func TestDeprovisionTenant(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		for _, mode := range []Mode{ModeMultiDB, ModeShared} {
+			db := mtesting.NewDatabase(t, runner, "tenancy")
+			store, err := New(runner.Client(), db.Name(), mode)
+			require.NoError(t, err)
+			var deprovisioned []string
+			store.AddTenantHooks(TenantHook{
+				Name: "devices",
+				Provision: func(ctx context.Context, db *mongo.Database) error {
+					_, err := db.Collection("devices").InsertOne(ctx,
+						store.Document(ctx, bson.D{{Key: "name", Value: "foo"}}))
+					return err
+				},
+				Deprovision: func(ctx context.Context, db *mongo.Database) error {
+					deprovisioned = append(deprovisioned, identity.FromContext(ctx).Tenant)
+					return nil
+				},
+			})
+
+			ctx := db.Context("")
+			require.NoError(t, store.ProvisionTenant(ctx, "tenant1"), mode)
+			require.NoError(t, store.ProvisionTenant(ctx, "tenant2"), mode)
+
+			count := func(tenantID string) int64 {
+				ctx := db.Context(tenantID)
+				n, err := store.Collection(ctx, "devices").
+					CountDocuments(ctx, store.Filter(ctx, nil))
+				require.NoError(t, err)
+				return n
+			}
+			require.NoError(t, store.DeprovisionTenant(ctx, "tenant1"), mode)
+			assert.Zero(t, count("tenant1"), mode)
+			assert.EqualValues(t, 1, count("tenant2"), mode)
+
+			// Deprovisioning is idempotent
+			require.NoError(t, store.DeprovisionTenant(ctx, "tenant1"), mode)
+			assert.Equal(t, []string{"tenant1", "tenant1"}, deprovisioned, mode)
+		}
+		return 0
+	}, nil)
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package tenancy provides a Store facade hiding whether the tenants' data
+// is kept in a database per tenant (store) or in shared collections scoped
+// by the tenant_id field (store/v2), so services can migrate between the
+// two layouts with a configuration switch.
+package tenancy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	v1 "github.com/mendersoftware/go-lib-micro/store"
+	v2 "github.com/mendersoftware/go-lib-micro/store/v2"
+)
+
+// Mode is the layout of the tenants' data.
+type Mode string
+
+const (
+	// ModeMultiDB keeps the data of each tenant in a separate database
+	// named "<db>-<tenant ID>".
+	ModeMultiDB Mode = "multi-db"
+	// ModeShared keeps the data of all tenants in the same database and
+	// scopes the documents with the tenant_id field.
+	ModeShared Mode = "shared"
+)
+
+var ErrInvalidMode = errors.New("tenancy: invalid mode")
+
+// ParseMode parses the mode from the configuration.
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case ModeMultiDB, ModeShared:
+		return mode, nil
+	default:
+		return "", errors.Wrapf(ErrInvalidMode, "%q", s)
+	}
+}
+
+// Store resolves the database of the tenant of the context and scopes the
+// queries and documents according to the mode.
+type Store struct {
+	client *mongo.Client
+	dbName string
+	mode   Mode
+
+	limiter *Limiter
+	hooks   []TenantHook
+}
+
+func New(client *mongo.Client, dbName string, mode Mode) (*Store, error) {
+	if _, err := ParseMode(string(mode)); err != nil {
+		return nil, err
+	}
+	return &Store{
+		client: client,
+		dbName: dbName,
+		mode:   mode,
+	}, nil
+}
+
+func (s *Store) Mode() Mode {
+	return s.mode
+}
+
+func (s *Store) Client() *mongo.Client {
+	return s.client
+}
+
+func (s *Store) shared() bool {
+	return s.mode == ModeShared
+}
+
+// DatabaseName returns the name of the database of the tenant of the
+// context.
+func (s *Store) DatabaseName(ctx context.Context) string {
+	if s.shared() {
+		return v2.DbFromContext(ctx, s.dbName)
+	}
+	return v1.DbFromContext(ctx, s.dbName)
+}
+
+// DatabaseNameForTenant returns the name of the database of the tenant.
+func (s *Store) DatabaseNameForTenant(tenantID string) string {
+	if s.shared() {
+		return v2.DbNameForTenant(tenantID, s.dbName)
+	}
+	return v1.DbNameForTenant(tenantID, s.dbName)
+}
+
+// Database returns the database of the tenant of the context.
+func (s *Store) Database(
+	ctx context.Context,
+	opts ...*options.DatabaseOptions,
+) *mongo.Database {
+	return s.client.Database(s.DatabaseName(ctx), opts...)
+}
+
+// Collection returns the collection of the tenant of the context.
+func (s *Store) Collection(
+	ctx context.Context,
+	name string,
+	opts ...*options.CollectionOptions,
+) *mongo.Collection {
+	return s.Database(ctx).Collection(name, opts...)
+}
+
+// Filter scopes the query filter to the tenant of the context. In
+// ModeMultiDB the filter is returned unchanged since the database is
+// already scoped to the tenant.
+func (s *Store) Filter(ctx context.Context, filter interface{}) interface{} {
+	if !s.shared() {
+		if filter == nil {
+			return bson.D{}
+		}
+		return filter
+	}
+	if filter == nil {
+		return v2.AppendTenantID(ctx, nil)
+	}
+	return v2.WithTenantID(ctx, filter)
+}
+
+// Document adds the tenant ID of the context to the document to insert in
+// ModeShared; in ModeMultiDB the document is returned unchanged.
+func (s *Store) Document(ctx context.Context, doc interface{}) interface{} {
+	if !s.shared() {
+		return doc
+	}
+	return v2.WithTenantID(ctx, doc)
+}
+
+// Documents is the Document equivalent for InsertMany.
+func (s *Store) Documents(ctx context.Context, docs []interface{}) []interface{} {
+	if !s.shared() {
+		return docs
+	}
+	ret := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		ret[i] = v2.WithTenantID(ctx, doc)
+	}
+	return ret
+}
+
+// TenantDatabases lists the databases of the tenants in ModeMultiDB. In
+// ModeShared the list only contains the shared database.
+func (s *Store) TenantDatabases(ctx context.Context) ([]string, error) {
+	if s.shared() {
+		return []string{s.dbName}, nil
+	}
+	names, err := s.client.ListDatabaseNames(ctx, bson.D{})
+	if err != nil {
+		return nil, errors.Wrap(err, "tenancy: failed to list databases")
+	}
+	isTenantDb := v1.IsTenantDb(s.dbName)
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == s.dbName || isTenantDb(name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret, nil
+}
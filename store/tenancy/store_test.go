@@ -0,0 +1,89 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package tenancy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode(" Multi-DB")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeMultiDB, mode)
+	mode, err = ParseMode("shared")
+	assert.NoError(t, err)
+	assert.Equal(t, ModeShared, mode)
+	_, err = ParseMode("single")
+	assert.ErrorIs(t, err, ErrInvalidMode)
+
+	_, err = New(nil, "db", Mode("single"))
+	assert.ErrorIs(t, err, ErrInvalidMode)
+}
+
+func TestStore(t *testing.T) {
+	// The client does not connect until the first operation.
+	client, err := mongo.Connect(context.Background(),
+		options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	defer client.Disconnect(context.Background())
+
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Subject: "user", Tenant: "tenant1"})
+	filter := bson.D{{Key: "name", Value: "foo"}}
+
+	multi, err := New(client, "deviceauth", ModeMultiDB)
+	require.NoError(t, err)
+	assert.Equal(t, "deviceauth-tenant1", multi.DatabaseName(ctx))
+	assert.Equal(t, "deviceauth", multi.DatabaseName(context.Background()))
+	assert.Equal(t, "deviceauth-tenant2", multi.DatabaseNameForTenant("tenant2"))
+	assert.Equal(t, "deviceauth-tenant1",
+		multi.Collection(ctx, "devices").Database().Name())
+	assert.Equal(t, filter, multi.Filter(ctx, filter))
+	assert.Equal(t, bson.D{}, multi.Filter(ctx, nil))
+	assert.Equal(t, filter, multi.Document(ctx, filter))
+	assert.Equal(t, []interface{}{filter}, multi.Documents(ctx, []interface{}{filter}))
+
+	shared, err := New(client, "deviceauth", ModeShared)
+	require.NoError(t, err)
+	assert.Equal(t, "deviceauth", shared.DatabaseName(ctx))
+	assert.Equal(t, "deviceauth", shared.DatabaseNameForTenant("tenant2"))
+	assert.Equal(t, "deviceauth",
+		shared.Collection(ctx, "devices").Database().Name())
+	scoped := bson.D{
+		{Key: "name", Value: "foo"},
+		{Key: "tenant_id", Value: "tenant1"},
+	}
+	assert.Equal(t, scoped, shared.Filter(ctx, filter))
+	assert.Equal(t, bson.D{{Key: "tenant_id", Value: "tenant1"}},
+		shared.Filter(ctx, nil))
+	assert.Equal(t, scoped, shared.Document(ctx, filter))
+	assert.Equal(t, []interface{}{scoped},
+		shared.Documents(ctx, []interface{}{filter}))
+	// The input is not modified.
+	assert.Len(t, filter, 1)
+
+	dbs, err := shared.TenantDatabases(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deviceauth"}, dbs)
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CountStrategy selects how CountDocuments counts the matching documents.
+type CountStrategy int
+
+const (
+	// CountExact counts all matching documents.
+	CountExact CountStrategy = iota
+	// CountCapped stops counting at the limit, the count is then a
+	// lower bound.
+	CountCapped
+	// CountEstimated uses the collection metadata and ignores the
+	// filter, it is only accurate for collections which are not shared
+	// between tenants and are not filtered.
+	CountEstimated
+)
+
+const DefaultCountLimit = 10000
+
+type CountOptions struct {
+	// Strategy is the counting strategy (default: CountExact).
+	Strategy *CountStrategy
+	// Limit is the maximum count of the CountCapped strategy
+	// (default: DefaultCountLimit).
+	Limit *int64
+}
+
+func NewCountOptions() *CountOptions {
+	return new(CountOptions)
+}
+
+func (opts *CountOptions) SetStrategy(strategy CountStrategy) *CountOptions {
+	opts.Strategy = &strategy
+	return opts
+}
+
+func (opts *CountOptions) SetLimit(limit int64) *CountOptions {
+	opts.Limit = &limit
+	return opts
+}
+
+// Count is the result of CountDocuments.
+type Count struct {
+	Value int64
+	// Estimated is true if Value is an estimate or, with the CountCapped
+	// strategy, a lower bound.
+	Estimated bool
+}
+
+func (c Count) String() string {
+	s := strconv.FormatInt(c.Value, 10)
+	if c.Estimated {
+		s += "+"
+	}
+	return s
+}
+
+// CountDocuments counts the documents in the collection matching the
+// filter using the strategy of the options, avoiding full scans of huge
+// collections with the CountCapped or CountEstimated strategies.
+func CountDocuments(
+	ctx context.Context,
+	collection *mongo.Collection,
+	filter interface{},
+	opts ...*CountOptions,
+) (Count, error) {
+	var (
+		strategy = CountExact
+		limit    = int64(DefaultCountLimit)
+	)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.Strategy != nil {
+			strategy = *opt.Strategy
+		}
+		if opt.Limit != nil {
+			limit = *opt.Limit
+		}
+	}
+	var (
+		count Count
+		err   error
+	)
+	switch strategy {
+	case CountEstimated:
+		count.Estimated = true
+		count.Value, err = collection.EstimatedDocumentCount(ctx)
+	case CountCapped:
+		count.Value, err = collection.CountDocuments(ctx, filter,
+			mopts.Count().SetLimit(limit))
+		count.Estimated = count.Value >= limit
+	default:
+		count.Value, err = collection.CountDocuments(ctx, filter)
+	}
+	if err != nil {
+		return Count{}, errors.Wrap(err, "store: failed to count documents")
+	}
+	return count, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestCountString(t *testing.T) {
+	assert.Equal(t, "42", Count{Value: 42}.String())
+	assert.Equal(t, "10000+", Count{Value: 10000, Estimated: true}.String())
+}
+
+func TestCountDocuments(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "count")
+		ctx := db.Context("")
+		collection := db.Collection("devices")
+		docs := make([]interface{}, 20)
+		for i := range docs {
+			docs[i] = bson.D{{Key: "status", Value: i % 2}}
+		}
+		_, err := collection.InsertMany(ctx, docs)
+		require.NoError(t, err)
+
+		filter := bson.D{{Key: "status", Value: 0}}
+		count, err := CountDocuments(ctx, collection, filter)
+		assert.NoError(t, err)
+		assert.Equal(t, Count{Value: 10}, count)
+
+		count, err = CountDocuments(ctx, collection, filter, NewCountOptions().
+			SetStrategy(CountCapped).
+			SetLimit(5))
+		assert.NoError(t, err)
+		assert.Equal(t, Count{Value: 5, Estimated: true}, count)
+
+		count, err = CountDocuments(ctx, collection, filter, NewCountOptions().
+			SetStrategy(CountCapped).
+			SetLimit(15))
+		assert.NoError(t, err)
+		assert.Equal(t, Count{Value: 10}, count)
+
+		count, err = CountDocuments(ctx, collection, bson.D{}, NewCountOptions().
+			SetStrategy(CountEstimated))
+		assert.NoError(t, err)
+		assert.Equal(t, Count{Value: 20, Estimated: true}, count)
+		return 0
+	}, nil)
+}
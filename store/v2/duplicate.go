@@ -0,0 +1,174 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const CodeDuplicate = "duplicate"
+
+var (
+	duplicateKeyIndexRegex = regexp.MustCompile(`index: (\S+) dup key: \{(.*)\}`)
+	duplicateKeyFieldRegex = regexp.MustCompile(`(?:^|,)\s*"?([^":,\s]+)"?:`)
+)
+
+// DuplicateKeyError describes the unique index violated by a write. It
+// matches ErrDuplicateKey with errors.Is, suggests 409 Conflict (see
+// rest.StatusFromError) and converts to rest.FieldErrors listing the
+// colliding fields with errors.As, such that rest.RenderError tells the
+// client which fields collided.
+type DuplicateKeyError struct {
+	// Index is the name of the violated index.
+	Index string
+	// Fields are the fields of the index, excluding the tenant_id.
+	Fields []string
+	// Values are the duplicate values of the fields; it is only
+	// available from MongoDB 4.4.
+	Values bson.D
+	// Err is the driver error.
+	Err error
+}
+
+func (err *DuplicateKeyError) Error() string {
+	msg := ErrDuplicateKey.Error()
+	if len(err.Fields) > 0 {
+		msg += ": " + strings.Join(err.Fields, ", ")
+	}
+	return msg
+}
+
+func (err *DuplicateKeyError) Unwrap() error {
+	return err.Err
+}
+
+func (err *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+func (err *DuplicateKeyError) StatusCode() int {
+	return http.StatusConflict
+}
+
+func (err *DuplicateKeyError) As(target interface{}) bool {
+	fieldErrs, ok := target.(*rest.FieldErrors)
+	if ok {
+		*fieldErrs = err.FieldErrors()
+	}
+	return ok
+}
+
+// FieldErrors returns a FieldError for each colliding field.
+func (err *DuplicateKeyError) FieldErrors() rest.FieldErrors {
+	fieldErrs := make(rest.FieldErrors, len(err.Fields))
+	for i, field := range err.Fields {
+		fieldErrs[i] = rest.FieldError{
+			Field:   field,
+			Message: "already exists",
+			Code:    CodeDuplicate,
+		}
+	}
+	return fieldErrs
+}
+
+func isDuplicateKeyCode(code int) bool {
+	return code == 11000 || code == 11001 || code == 12582
+}
+
+// duplicateKeyCause returns the server response and the message of the
+// duplicate key error.
+func duplicateKeyCause(err error) (bson.Raw, string, bool) {
+	var (
+		writeErr     mongo.WriteException
+		bulkWriteErr mongo.BulkWriteException
+		cmdErr       mongo.CommandError
+	)
+	switch {
+	case errors.As(err, &writeErr):
+		for _, we := range writeErr.WriteErrors {
+			if isDuplicateKeyCode(we.Code) {
+				return we.Raw, we.Message, true
+			}
+		}
+	case errors.As(err, &bulkWriteErr):
+		for _, we := range bulkWriteErr.WriteErrors {
+			if isDuplicateKeyCode(we.Code) {
+				return we.Raw, we.Message, true
+			}
+		}
+	case errors.As(err, &cmdErr):
+		if isDuplicateKeyCode(int(cmdErr.Code)) {
+			return cmdErr.Raw, cmdErr.Message, true
+		}
+	}
+	return nil, "", false
+}
+
+// DuplicateKey returns the details of a duplicate key error, or false if
+// err is not a duplicate key error. The fields are taken from the
+// keyPattern of the server response or, for older servers, parsed from the
+// error message.
+func DuplicateKey(err error) (*DuplicateKeyError, bool) {
+	var dupErr *DuplicateKeyError
+	if errors.As(err, &dupErr) {
+		return dupErr, true
+	}
+	raw, msg, ok := duplicateKeyCause(err)
+	if !ok {
+		return nil, false
+	}
+	dupErr = &DuplicateKeyError{Err: err}
+	if m := duplicateKeyIndexRegex.FindStringSubmatch(msg); m != nil {
+		dupErr.Index = m[1]
+		for _, field := range duplicateKeyFieldRegex.FindAllStringSubmatch(m[2], -1) {
+			dupErr.Fields = append(dupErr.Fields, field[1])
+		}
+	}
+	if keyPattern, ok := raw.Lookup("keyPattern").DocumentOK(); ok {
+		elems, _ := keyPattern.Elements()
+		dupErr.Fields = make([]string, 0, len(elems))
+		for _, elem := range elems {
+			dupErr.Fields = append(dupErr.Fields, elem.Key())
+		}
+	}
+	if keyValue, ok := raw.Lookup("keyValue").DocumentOK(); ok {
+		_ = bson.Unmarshal(keyValue, &dupErr.Values)
+	}
+	dupErr.Fields = removeTenantField(dupErr.Fields)
+	for i := 0; i < len(dupErr.Values); i++ {
+		if dupErr.Values[i].Key == FieldTenantID {
+			dupErr.Values = append(dupErr.Values[:i], dupErr.Values[i+1:]...)
+			break
+		}
+	}
+	return dupErr, true
+}
+
+func removeTenantField(fields []string) []string {
+	for i, field := range fields {
+		if field == FieldTenantID {
+			return append(fields[:i], fields[i+1:]...)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+func TestDuplicateKey(t *testing.T) {
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "index", Value: 0},
+		{Key: "code", Value: 11000},
+		{Key: "keyPattern", Value: bson.D{
+			{Key: "tenant_id", Value: 1},
+			{Key: "name", Value: 1},
+		}},
+		{Key: "keyValue", Value: bson.D{
+			{Key: "tenant_id", Value: "123"},
+			{Key: "name", Value: "foo"},
+		}},
+	})
+	const message = `E11000 duplicate key error collection: inventory.devices ` +
+		`index: tenant_id_1_name_1 dup key: { tenant_id: "123", name: "foo" }`
+	testCases := []struct {
+		Name string
+		Err  error
+
+		Expected *DuplicateKeyError
+	}{{
+		Name: "write exception",
+		Err: mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    11000,
+			Message: message,
+			Raw:     raw,
+		}}},
+		Expected: &DuplicateKeyError{
+			Index:  "tenant_id_1_name_1",
+			Fields: []string{"name"},
+			Values: bson.D{{Key: "name", Value: "foo"}},
+		},
+	}, {
+		Name: "command error without keyPattern",
+		Err: MapError(mongo.CommandError{
+			Code: 11000,
+			Message: `E11000 duplicate key error collection: useradm.users ` +
+				`index: email_1 dup key: { "email": "user@example.com" }`,
+		}),
+		Expected: &DuplicateKeyError{
+			Index:  "email_1",
+			Fields: []string{"email"},
+		},
+	}, {
+		Name: "bulk write exception",
+		Err: mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{
+			WriteError: mongo.WriteError{Code: 11000, Message: message},
+		}}},
+		Expected: &DuplicateKeyError{
+			Index:  "tenant_id_1_name_1",
+			Fields: []string{"name"},
+		},
+	}, {
+		Name: "other error",
+		Err:  mongo.CommandError{Code: 2, Message: "BadValue"},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			dupErr, ok := DuplicateKey(tc.Err)
+			if tc.Expected == nil {
+				assert.False(t, ok)
+				return
+			}
+			if !assert.True(t, ok) {
+				return
+			}
+			tc.Expected.Err = tc.Err
+			assert.Equal(t, tc.Expected, dupErr)
+			assert.ErrorIs(t, dupErr, ErrDuplicateKey)
+			assert.Equal(t, http.StatusConflict, rest.StatusFromError(dupErr, 0))
+
+			var fieldErrs rest.FieldErrors
+			if assert.True(t, errors.As(dupErr, &fieldErrs)) {
+				assert.Equal(t, dupErr.FieldErrors(), fieldErrs)
+			}
+			same, _ := DuplicateKey(dupErr)
+			assert.Same(t, dupErr, same)
+		})
+	}
+	dupErr := &DuplicateKeyError{Fields: []string{"name", "serial"}}
+	assert.EqualError(t, dupErr, "store: duplicate key: name, serial")
+	assert.Equal(t, rest.FieldErrors{
+		{Field: "name", Message: "already exists", Code: CodeDuplicate},
+		{Field: "serial", Message: "already exists", Code: CodeDuplicate},
+	}, dupErr.FieldErrors())
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound     = errors.New("store: document not found")
+	ErrDuplicateKey = errors.New("store: duplicate key")
+	ErrTimeout      = errors.New("store: operation timed out")
+	// ErrTransient is returned for errors which are likely to succeed
+	// when retried, e.g. network errors and transient transaction
+	// errors.
+	ErrTransient = errors.New("store: transient error")
+)
+
+// Error is the typed error returned by MapError. It matches its Kind with
+// errors.Is and unwraps to the driver error.
+type Error struct {
+	// Kind is one of ErrNotFound, ErrDuplicateKey, ErrTimeout or
+	// ErrTransient.
+	Kind error
+	// Err is the driver error.
+	Err error
+	// Status is the suggested HTTP status of the response.
+	Status int
+}
+
+func (err *Error) Error() string {
+	return err.Kind.Error() + ": " + err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+func (err *Error) Is(target error) bool {
+	return target == err.Kind
+}
+
+// StatusCode returns the suggested HTTP status (see rest.StatusFromError).
+func (err *Error) StatusCode() int {
+	return err.Status
+}
+
+const labelTransientTransaction = "TransientTransactionError"
+
+type labeledError interface {
+	HasErrorLabel(label string) bool
+}
+
+// MapError translates the driver errors to *Error:
+//
+//	ErrNotFound      mongo.ErrNoDocuments                      404
+//	ErrDuplicateKey  duplicate key errors                      409
+//	ErrTimeout       timeouts and exceeded context deadlines   503
+//	ErrTransient     network and transient transaction errors  503
+//
+// Other errors, nil and errors which are already mapped are returned
+// unchanged.
+func MapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var mapped *Error
+	if errors.As(err, &mapped) {
+		return err
+	}
+	var labeled labeledError
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &Error{Kind: ErrNotFound, Err: err, Status: http.StatusNotFound}
+	case mongo.IsDuplicateKeyError(err):
+		return &Error{Kind: ErrDuplicateKey, Err: err, Status: http.StatusConflict}
+	case mongo.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrTimeout, Err: err, Status: http.StatusServiceUnavailable}
+	case mongo.IsNetworkError(err),
+		errors.As(err, &labeled) && labeled.HasErrorLabel(labelTransientTransaction):
+		return &Error{Kind: ErrTransient, Err: err, Status: http.StatusServiceUnavailable}
+	}
+	return err
+}
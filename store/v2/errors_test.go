@@ -0,0 +1,85 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMapError(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Err  error
+
+		Kind   error
+		Status int
+	}{{
+		Name:   "not found",
+		Err:    fmt.Errorf("failed to get device: %w", mongo.ErrNoDocuments),
+		Kind:   ErrNotFound,
+		Status: http.StatusNotFound,
+	}, {
+		Name: "duplicate key",
+		Err: mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    11000,
+			Message: "E11000 duplicate key error",
+		}}},
+		Kind:   ErrDuplicateKey,
+		Status: http.StatusConflict,
+	}, {
+		Name:   "deadline exceeded",
+		Err:    context.DeadlineExceeded,
+		Kind:   ErrTimeout,
+		Status: http.StatusServiceUnavailable,
+	}, {
+		Name: "transient transaction",
+		Err: mongo.CommandError{
+			Code:    112,
+			Message: "WriteConflict",
+			Labels:  []string{"TransientTransactionError"},
+		},
+		Kind:   ErrTransient,
+		Status: http.StatusServiceUnavailable,
+	}, {
+		Name: "other",
+		Err:  errors.New("something else"),
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			err := MapError(tc.Err)
+			if tc.Kind == nil {
+				assert.Equal(t, tc.Err, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.Kind)
+			var storeErr *Error
+			if assert.ErrorAs(t, err, &storeErr) {
+				assert.Equal(t, tc.Err, storeErr.Unwrap())
+				assert.Equal(t, tc.Status, storeErr.StatusCode())
+			}
+			assert.Equal(t, tc.Kind.Error()+": "+tc.Err.Error(), err.Error())
+			assert.Equal(t, err, MapError(err))
+		})
+	}
+	assert.NoError(t, MapError(nil))
+}
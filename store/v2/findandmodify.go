@@ -0,0 +1,54 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOneAndUpdate is mongo.Collection.FindOneAndUpdate scoped to the
+// tenant of the context: the tenant_id is added to the filter, and thereby
+// to the document inserted on upsert since the equality conditions of the
+// filter are part of the inserted document.
+func FindOneAndUpdate(
+	ctx context.Context,
+	collection *mongo.Collection,
+	filter interface{},
+	update interface{},
+	opts ...*mopts.FindOneAndUpdateOptions,
+) *mongo.SingleResult {
+	return collection.FindOneAndUpdate(ctx, WithTenantID(ctx, filter), update, opts...)
+}
+
+// FindOneAndReplace is mongo.Collection.FindOneAndReplace scoped to the
+// tenant of the context: the tenant_id is added to both the filter and the
+// replacement, which is inserted as-is on upsert. The replacement must not
+// contain a tenant_id itself.
+func FindOneAndReplace(
+	ctx context.Context,
+	collection *mongo.Collection,
+	filter interface{},
+	replacement interface{},
+	opts ...*mopts.FindOneAndReplaceOptions,
+) *mongo.SingleResult {
+	return collection.FindOneAndReplace(ctx,
+		WithTenantID(ctx, filter),
+		WithTenantID(ctx, replacement),
+		opts...,
+	)
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestFindOneAndModify(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	type device struct {
+		ID       string `bson:"_id"`
+		Name     string `bson:"name"`
+		TenantID string `bson:"tenant_id"`
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "findandmodify")
+		ctx := db.Context("tenant1")
+		otherCtx := db.Context("tenant2")
+		collection := db.Collection("devices")
+
+		var dev device
+		err := FindOneAndUpdate(ctx, collection,
+			bson.D{{Key: "_id", Value: "1"}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "foo"}}}},
+			mopts.FindOneAndUpdate().
+				SetUpsert(true).
+				SetReturnDocument(mopts.After),
+		).Decode(&dev)
+		require.NoError(t, err)
+		assert.Equal(t, device{ID: "1", Name: "foo", TenantID: "tenant1"}, dev)
+
+		err = FindOneAndReplace(ctx, collection,
+			bson.D{{Key: "_id", Value: "2"}},
+			bson.D{{Key: "name", Value: "bar"}},
+			mopts.FindOneAndReplace().
+				SetUpsert(true).
+				SetReturnDocument(mopts.After),
+		).Decode(&dev)
+		require.NoError(t, err)
+		assert.Equal(t, device{ID: "2", Name: "bar", TenantID: "tenant1"}, dev)
+
+		// Documents of other tenants are not modified.
+		err = FindOneAndUpdate(otherCtx, collection,
+			bson.D{{Key: "_id", Value: "1"}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "baz"}}}},
+		).Err()
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+		err = FindOneAndReplace(otherCtx, collection,
+			bson.D{{Key: "_id", Value: "2"}},
+			bson.D{{Key: "name", Value: "baz"}},
+		).Err()
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+		return 0
+	}, nil)
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	fieldID = "_id"
+
+	// maxPageCapacity caps the capacity preallocated for the pages, the
+	// page size is usually controlled by the client.
+	maxPageCapacity = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("store: invalid cursor")
+	ErrInvalidLimit  = errors.New("store: invalid page limit")
+)
+
+// SearchAfter is a page of a keyset (search-after) paginated query: the
+// documents are sorted by the SortKey and the _id as tie breaker, and
+// each page continues after the last document of the previous page.
+// Unlike skipping, the pages remain consistent while documents are added
+// or removed and skip no index entries.
+//
+// The collection should have an index on the filter fields followed by
+// the SortKey and _id.
+type SearchAfter struct {
+	// SortKey is the (dotted) path of the sort field (default: _id).
+	SortKey string
+	// Descending reverses the sort order
+	Descending bool
+	// Limit is the page size, zero returns all documents.
+	Limit int64
+	// Cursor is the opaque cursor returned with the previous page, it
+	// is empty for the first page.
+	Cursor string
+}
+
+type cursorValue struct {
+	Value interface{} `bson:"v"`
+	ID    interface{} `bson:"id"`
+}
+
+func encodeCursor(value, id bson.RawValue) (string, error) {
+	b, err := bson.Marshal(bson.D{
+		{Key: "v", Value: value},
+		{Key: "id", Value: id},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "store: failed to encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(cursor string) (*cursorValue, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var value cursorValue
+	if err = bson.Unmarshal(b, &value); err != nil || value.ID == nil {
+		return nil, ErrInvalidCursor
+	}
+	// The cursors are provided by the clients, documents could inject
+	// query operators.
+	switch value.Value.(type) {
+	case bson.D, bson.A:
+		return nil, ErrInvalidCursor
+	}
+	return &value, nil
+}
+
+func (s SearchAfter) sortKey() string {
+	if s.SortKey == "" {
+		return fieldID
+	}
+	return s.SortKey
+}
+
+// Filter returns the filter selecting the documents after the cursor.
+// Documents without the sort key sort as null, i.e. first in ascending
+// and last in descending order.
+func (s SearchAfter) Filter(filter bson.D) (bson.D, error) {
+	if s.Cursor == "" {
+		return filter, nil
+	}
+	after, err := decodeCursor(s.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	op := "$gt"
+	if s.Descending {
+		op = "$lt"
+	}
+	ret := make(bson.D, len(filter), len(filter)+1)
+	copy(ret, filter)
+	key := s.sortKey()
+	if key == fieldID {
+		return append(ret, bson.E{Key: fieldID, Value: bson.D{{Key: op, Value: after.ID}}}), nil
+	}
+	// The comparison operators only match values of the same type, so
+	// null values are selected explicitly.
+	null := bson.D{{Key: key, Value: bson.D{{Key: "$eq", Value: nil}}}}
+	or := bson.A{bson.D{
+		{Key: key, Value: bson.D{{Key: "$eq", Value: after.Value}}},
+		{Key: fieldID, Value: bson.D{{Key: op, Value: after.ID}}},
+	}}
+	switch {
+	case after.Value == nil && !s.Descending:
+		or = append(or, bson.D{{Key: key, Value: bson.D{{Key: "$ne", Value: nil}}}})
+	case after.Value != nil:
+		or = append(or, bson.D{{Key: key, Value: bson.D{{Key: op, Value: after.Value}}}})
+		if s.Descending {
+			or = append(or, null)
+		}
+	}
+	return append(ret, bson.E{Key: "$or", Value: or}), nil
+}
+
+// FindOptions returns the sort and limit of the page. The limit is one
+// more than the page size for detecting whether there is a next page.
+func (s SearchAfter) FindOptions() *mopts.FindOptions {
+	order := 1
+	if s.Descending {
+		order = -1
+	}
+	sort := bson.D{{Key: fieldID, Value: order}}
+	if key := s.sortKey(); key != fieldID {
+		sort = append(bson.D{{Key: key, Value: order}}, sort...)
+	}
+	opts := mopts.Find().SetSort(sort)
+	if s.Limit > 0 {
+		opts.SetLimit(s.Limit + 1)
+	}
+	return opts
+}
+
+// FindAfter returns the page of documents matching the filter and the
+// cursor of the next page, which is empty on the last page. Invalid
+// cursors are rejected with ErrInvalidCursor and negative limits with
+// ErrInvalidLimit.
+func FindAfter[T any](
+	ctx context.Context,
+	collection *mongo.Collection,
+	filter bson.D,
+	page SearchAfter,
+) ([]T, string, error) {
+	if page.Limit < 0 {
+		return nil, "", ErrInvalidLimit
+	}
+	query, err := page.Filter(filter)
+	if err != nil {
+		return nil, "", err
+	}
+	cur, err := collection.Find(ctx, query, page.FindOptions())
+	if err != nil {
+		return nil, "", errors.Wrap(err, "store: failed to execute query")
+	}
+	defer cur.Close(ctx)
+
+	capacity := page.Limit
+	if capacity > maxPageCapacity {
+		capacity = maxPageCapacity
+	}
+	var (
+		items   = make([]T, 0, capacity)
+		last    bson.Raw
+		hasNext bool
+	)
+	for cur.Next(ctx) {
+		if page.Limit > 0 && int64(len(items)) == page.Limit {
+			hasNext = true
+			break
+		}
+		var item T
+		if err = cur.Decode(&item); err != nil {
+			return nil, "", errors.Wrap(err, "store: failed to decode document")
+		}
+		items = append(items, item)
+		last = append(last[:0], cur.Current...)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, "", errors.Wrap(err, "store: failed to retrieve documents")
+	}
+	if !hasNext {
+		return items, "", nil
+	}
+	value, err := last.LookupErr(strings.Split(page.sortKey(), ".")...)
+	if err != nil {
+		// Documents without the sort key sort as null.
+		value = bson.RawValue{Type: bson.TypeNull}
+	}
+	next, err := encodeCursor(value, last.Lookup(fieldID))
+	return items, next, err
+}
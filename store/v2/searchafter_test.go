@@ -0,0 +1,197 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestSearchAfterFilter(t *testing.T) {
+	filter := bson.D{{Key: "status", Value: "accepted"}}
+
+	query, err := SearchAfter{SortKey: "name"}.Filter(filter)
+	assert.NoError(t, err)
+	assert.Equal(t, filter, query)
+
+	cursor, err := encodeCursor(
+		bson.RawValue{Type: bson.TypeString, Value: stringValue("foo")},
+		bson.RawValue{Type: bson.TypeInt32, Value: []byte{42, 0, 0, 0}},
+	)
+	require.NoError(t, err)
+
+	query, err = SearchAfter{SortKey: "name", Cursor: cursor}.Filter(filter)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "status", Value: "accepted"},
+		{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "name", Value: bson.D{{Key: "$eq", Value: "foo"}}},
+				{Key: "_id", Value: bson.D{{Key: "$gt", Value: int32(42)}}},
+			},
+			bson.D{{Key: "name", Value: bson.D{{Key: "$gt", Value: "foo"}}}},
+		}},
+	}, query)
+	assert.Len(t, filter, 1)
+
+	query, err = SearchAfter{SortKey: "name", Descending: true, Cursor: cursor}.Filter(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "name", Value: bson.D{{Key: "$eq", Value: "foo"}}},
+				{Key: "_id", Value: bson.D{{Key: "$lt", Value: int32(42)}}},
+			},
+			bson.D{{Key: "name", Value: bson.D{{Key: "$lt", Value: "foo"}}}},
+			bson.D{{Key: "name", Value: bson.D{{Key: "$eq", Value: nil}}}},
+		}},
+	}, query)
+
+	null, err := encodeCursor(
+		bson.RawValue{Type: bson.TypeNull},
+		bson.RawValue{Type: bson.TypeInt32, Value: []byte{42, 0, 0, 0}},
+	)
+	require.NoError(t, err)
+	query, err = SearchAfter{SortKey: "name", Cursor: null}.Filter(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{
+				{Key: "name", Value: bson.D{{Key: "$eq", Value: nil}}},
+				{Key: "_id", Value: bson.D{{Key: "$gt", Value: int32(42)}}},
+			},
+			bson.D{{Key: "name", Value: bson.D{{Key: "$ne", Value: nil}}}},
+		}},
+	}, query)
+
+	query, err = SearchAfter{Descending: true, Cursor: cursor}.Filter(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$lt", Value: int32(42)}}},
+	}, query)
+
+	for _, cursor := range []string{"!", "Zm9v", ""} {
+		page := SearchAfter{Cursor: cursor}
+		if cursor == "" {
+			// An encoded document without an id
+			b, _ := bson.Marshal(bson.D{{Key: "v", Value: 1}})
+			page.Cursor = base64URL(b)
+		}
+		_, err = page.Filter(nil)
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	}
+
+	for _, value := range []interface{}{
+		bson.D{{Key: "$ne", Value: nil}},
+		bson.A{1, 2},
+	} {
+		b, _ := bson.Marshal(bson.D{{Key: "v", Value: value}, {Key: "id", Value: 1}})
+		_, err = SearchAfter{SortKey: "name", Cursor: base64URL(b)}.Filter(nil)
+		assert.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
+
+func TestSearchAfterFindOptions(t *testing.T) {
+	opts := SearchAfter{SortKey: "name", Descending: true, Limit: 10}.FindOptions()
+	assert.Equal(t, bson.D{
+		{Key: "name", Value: -1},
+		{Key: "_id", Value: -1},
+	}, opts.Sort)
+	assert.Equal(t, int64(11), *opts.Limit)
+
+	opts = SearchAfter{}.FindOptions()
+	assert.Equal(t, bson.D{{Key: "_id", Value: 1}}, opts.Sort)
+	assert.Nil(t, opts.Limit)
+}
+
+func TestFindAfterInvalidLimit(t *testing.T) {
+	_, _, err := FindAfter[bson.M](context.Background(), nil, nil, SearchAfter{Limit: -1})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+}
+
+func TestFindAfter(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	type device struct {
+		ID   int    `bson:"_id"`
+		Name string `bson:"name"`
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "searchafter")
+		ctx := db.Context("")
+		collection := db.Collection("devices")
+		_, err := collection.InsertMany(ctx, []interface{}{
+			device{ID: 1, Name: "b"},
+			device{ID: 2, Name: "a"},
+			device{ID: 3, Name: "b"},
+			device{ID: 4, Name: "c"},
+			device{ID: 5, Name: "a"},
+			bson.D{{Key: "_id", Value: 6}},
+			bson.D{{Key: "_id", Value: 0}},
+		})
+		require.NoError(t, err)
+
+		var (
+			ids  []int
+			page = SearchAfter{SortKey: "name", Limit: 2}
+		)
+		for i := 0; i < 5; i++ {
+			devices, next, err := FindAfter[device](ctx, collection, nil, page)
+			require.NoError(t, err)
+			for _, dev := range devices {
+				ids = append(ids, dev.ID)
+			}
+			if next == "" {
+				break
+			}
+			page.Cursor = next
+		}
+		assert.Equal(t, []int{0, 6, 2, 5, 1, 3, 4}, ids)
+
+		ids = nil
+		page = SearchAfter{SortKey: "name", Descending: true, Limit: 2}
+		for i := 0; i < 5; i++ {
+			devices, next, err := FindAfter[device](ctx, collection, nil, page)
+			require.NoError(t, err)
+			for _, dev := range devices {
+				ids = append(ids, dev.ID)
+			}
+			if next == "" {
+				break
+			}
+			page.Cursor = next
+		}
+		assert.Equal(t, []int{4, 3, 1, 5, 2, 6, 0}, ids)
+		return 0
+	}, nil)
+}
+
+func stringValue(s string) []byte {
+	_, b, _ := bson.MarshalValue(s)
+	return b
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+type transactionContextKey struct{}
+
+// StartSession starts a session and attaches it to the context; all the
+// operations using the returned context run in the session, which gives
+// causal consistency (read your own writes) by default. The returned
+// function ends the session.
+func StartSession(
+	ctx context.Context,
+	client *mongo.Client,
+	opts ...*mopts.SessionOptions,
+) (context.Context, func(), error) {
+	sess, err := client.StartSession(opts...)
+	if err != nil {
+		return ctx, func() {}, errors.Wrap(err, "store: failed to start session")
+	}
+	end := func() {
+		// The request context may be canceled at this point.
+		sess.EndSession(context.Background())
+	}
+	return mongo.NewSessionContext(ctx, sess), end, nil
+}
+
+// SessionFromContext returns the session attached to the context or nil.
+func SessionFromContext(ctx context.Context) mongo.Session {
+	return mongo.SessionFromContext(ctx)
+}
+
+// SessionMiddleware starts a session for each request; the handlers use
+// it by passing the request context to the store operations.
+func SessionMiddleware(client *mongo.Client, opts ...*mopts.SessionOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, end, err := StartSession(c.Request.Context(), client, opts...)
+		if err != nil {
+			log.FromContext(ctx).Error(err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		defer end()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// SessionHTTPMiddleware is the net/http counterpart of SessionMiddleware.
+func SessionHTTPMiddleware(
+	client *mongo.Client,
+	opts ...*mopts.SessionOptions,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, end, err := StartSession(r.Context(), client, opts...)
+			if err != nil {
+				log.FromContext(ctx).Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			defer end()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// WithTransaction runs fn in a transaction. The transaction uses the
+// session of the context if present (see SessionMiddleware), otherwise a
+// session is started for the transaction. Nested calls run fn in the
+// enclosing transaction. fn may be retried on transient errors, so it must
+// be idempotent.
+func WithTransaction(
+	ctx context.Context,
+	client *mongo.Client,
+	fn func(ctx context.Context) error,
+	opts ...*mopts.TransactionOptions,
+) error {
+	if ctx.Value(transactionContextKey{}) != nil {
+		return fn(ctx)
+	}
+	sess := mongo.SessionFromContext(ctx)
+	if sess == nil {
+		var (
+			end func()
+			err error
+		)
+		ctx, end, err = StartSession(ctx, client)
+		if err != nil {
+			return err
+		}
+		defer end()
+		sess = mongo.SessionFromContext(ctx)
+	}
+	_, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(context.WithValue(sessCtx, transactionContextKey{}, true))
+	}, opts...)
+	return err
+}
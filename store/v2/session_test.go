@@ -0,0 +1,96 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestSession(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "session")
+		client := db.Client()
+		collection := db.Collection("devices")
+		_, err := collection.InsertOne(context.Background(), bson.D{{Key: "_id", Value: "0"}})
+		require.NoError(t, err)
+
+		router := gin.New()
+		router.Use(SessionMiddleware(client))
+		router.POST("/devices", func(c *gin.Context) {
+			ctx := c.Request.Context()
+			assert.NotNil(t, SessionFromContext(ctx))
+			errAbort := errors.New("abort")
+			err := WithTransaction(ctx, client, func(ctx context.Context) error {
+				_, err := collection.InsertOne(ctx, bson.D{{Key: "_id", Value: "1"}})
+				if err != nil {
+					return err
+				}
+				// Nested transactions use the enclosing transaction
+				return WithTransaction(ctx, client, func(ctx context.Context) error {
+					return errAbort
+				})
+			})
+			assert.ErrorIs(t, err, errAbort)
+			err = WithTransaction(ctx, client, func(ctx context.Context) error {
+				_, err := collection.InsertOne(ctx, bson.D{{Key: "_id", Value: "2"}})
+				return err
+			})
+			assert.NoError(t, err)
+			c.Status(http.StatusNoContent)
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost/devices", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		var docs []bson.M
+		cur, err := collection.Find(context.Background(), bson.D{})
+		require.NoError(t, err)
+		require.NoError(t, cur.All(context.Background(), &docs))
+		assert.Equal(t, []bson.M{{"_id": "0"}, {"_id": "2"}}, docs)
+		return 0
+	}, nil)
+}
+
+func TestSessionHTTPMiddleware(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "session")
+		handler := SessionHTTPMiddleware(db.Client())(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.NotNil(t, SessionFromContext(r.Context()))
+			}))
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return 0
+	}, nil)
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package store
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+)
+
+const (
+	FieldCreatedTS = "created_ts"
+	FieldUpdatedTS = "updated_ts"
+	FieldDeletedTS = "deleted_ts"
+	FieldExpireTS  = "expire_ts"
+)
+
+// Timestamp returns the current time of the clock (clock.Real if nil) as
+// stored by MongoDB: in UTC and truncated to milliseconds. Use the result
+// for timestamps which are compared with values read from the database.
+func Timestamp(clk clock.Clock) time.Time {
+	return clock.OrReal(clk).Now().UTC().Truncate(time.Millisecond)
+}
+
+// ExpiresAt returns the value of a TTL index field for a document
+// expiring ttl from now.
+func ExpiresAt(clk clock.Clock, ttl time.Duration) time.Time {
+	return Timestamp(clk).Add(ttl)
+}
+
+// IsExpired returns true if the time expireTS of a TTL index field has
+// passed. MongoDB removes expired documents periodically, so the documents
+// can be read after they expire.
+func IsExpired(clk clock.Clock, expireTS time.Time) bool {
+	return !clock.OrReal(clk).Now().Before(expireTS)
+}
+
+// appendSet returns a copy of the $set operator value with elem appended.
+func appendSet(set interface{}, elem bson.E) (interface{}, bool) {
+	switch set := set.(type) {
+	case nil:
+		return bson.D{elem}, true
+	case bson.D:
+		return append(set[:len(set):len(set)], elem), true
+	case bson.M:
+		m := make(bson.M, len(set)+1)
+		for k, v := range set {
+			m[k] = v
+		}
+		m[elem.Key] = elem.Value
+		return m, true
+	}
+	return nil, false
+}
+
+// UpdateWithTimestamp adds the updated_ts field to the $set operator of
+// the update document, creating the operator if needed. Only bson.D and
+// bson.M updates (and $set values) are supported; other updates are
+// returned as is.
+func UpdateWithTimestamp(clk clock.Clock, update interface{}) interface{} {
+	elem := bson.E{Key: FieldUpdatedTS, Value: Timestamp(clk)}
+	switch u := update.(type) {
+	case bson.D:
+		res := make(bson.D, len(u), len(u)+1)
+		copy(res, u)
+		for i, op := range res {
+			if op.Key == "$set" {
+				set, ok := appendSet(op.Value, elem)
+				if !ok {
+					return update
+				}
+				res[i].Value = set
+				return res
+			}
+		}
+		return append(res, bson.E{Key: "$set", Value: bson.D{elem}})
+	case bson.M:
+		set, ok := appendSet(u["$set"], elem)
+		if !ok {
+			return update
+		}
+		res := make(bson.M, len(u)+1)
+		for k, v := range u {
+			res[k] = v
+		}
+		res["$set"] = set
+		return res
+	}
+	return update
+}
+
+// SoftDelete returns the update marking a document as deleted.
+func SoftDelete(clk clock.Clock) bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{
+		{Key: FieldDeletedTS, Value: Timestamp(clk)},
+	}}}
+}
+
+// NotDeleted returns the filter element excluding the documents marked as
+// deleted by SoftDelete.
+func NotDeleted() bson.E {
+	return bson.E{Key: FieldDeletedTS, Value: bson.D{{Key: "$exists", Value: false}}}
+}
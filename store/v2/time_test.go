@@ -0,0 +1,83 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+)
+
+func TestTimestamps(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 2, 29, 12, 0, 0, 123456789, time.FixedZone("CET", 3600))
+	clk := clock.NewMock(now)
+
+	ts := Timestamp(clk)
+	assert.Equal(t, time.UTC, ts.Location())
+	assert.Equal(t, time.Date(2024, 2, 29, 11, 0, 0, 123000000, time.UTC), ts)
+	assert.WithinDuration(t, time.Now(), Timestamp(nil), time.Minute)
+
+	expireTS := ExpiresAt(clk, time.Hour)
+	assert.Equal(t, ts.Add(time.Hour), expireTS)
+	assert.False(t, IsExpired(clk, expireTS))
+	clk.Advance(time.Hour)
+	assert.True(t, IsExpired(clk, expireTS))
+
+	assert.Equal(t, bson.D{{Key: "$set", Value: bson.D{
+		{Key: FieldDeletedTS, Value: Timestamp(clk)},
+	}}}, SoftDelete(clk))
+	assert.Equal(t, bson.E{
+		Key:   FieldDeletedTS,
+		Value: bson.D{{Key: "$exists", Value: false}},
+	}, NotDeleted())
+}
+
+func TestUpdateWithTimestamp(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ts := Timestamp(clk)
+	updated := bson.E{Key: FieldUpdatedTS, Value: ts}
+
+	set := bson.D{{Key: "name", Value: "foo"}}
+	update := bson.D{{Key: "$set", Value: set}}
+	assert.Equal(t, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "name", Value: "foo"}, updated,
+	}}}, UpdateWithTimestamp(clk, update))
+	// The input is not modified
+	assert.Len(t, set, 1)
+
+	assert.Equal(t, bson.D{
+		{Key: "$inc", Value: bson.M{"count": 1}},
+		{Key: "$set", Value: bson.D{updated}},
+	}, UpdateWithTimestamp(clk, bson.D{{Key: "$inc", Value: bson.M{"count": 1}}}))
+
+	assert.Equal(t, bson.M{
+		"$set": bson.M{"name": "foo", FieldUpdatedTS: ts},
+	}, UpdateWithTimestamp(clk, bson.M{"$set": bson.M{"name": "foo"}}))
+
+	assert.Equal(t, bson.M{
+		"$unset": bson.M{"name": ""},
+		"$set":   bson.D{updated},
+	}, UpdateWithTimestamp(clk, bson.M{"$unset": bson.M{"name": ""}}))
+
+	unsupported := bson.M{"$set": map[string]int{"count": 1}}
+	assert.Equal(t, unsupported, UpdateWithTimestamp(clk, unsupported))
+	assert.Equal(t, "update", UpdateWithTimestamp(clk, "update"))
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Granularity is the bucket granularity of a time-series collection; it
+// should match the interval between consecutive measurements of a series.
+type Granularity string
+
+const (
+	GranularitySeconds Granularity = "seconds"
+	GranularityMinutes Granularity = "minutes"
+	GranularityHours   Granularity = "hours"
+)
+
+const (
+	FieldTimestamp = "timestamp"
+
+	// errCodeNamespaceExists is returned when creating an existing
+	// collection.
+	errCodeNamespaceExists = 48
+)
+
+type TimeSeriesOptions struct {
+	// TimeField is the field holding the time of the measurements
+	// (default: FieldTimestamp).
+	TimeField *string
+	// MetaField is the field identifying the series (default:
+	// FieldTenantID). Measurements are bucketed by the meta field, so
+	// the default groups them by tenant and the tenant scoped filters
+	// are efficient.
+	MetaField *string
+	// Granularity of the buckets (default: GranularitySeconds). The
+	// granularity of an existing collection can only be increased.
+	Granularity *Granularity
+	// Retention removes measurements older than the duration, zero keeps
+	// them forever (default).
+	Retention *time.Duration
+}
+
+func NewTimeSeriesOptions() *TimeSeriesOptions {
+	return new(TimeSeriesOptions)
+}
+
+func (opts *TimeSeriesOptions) SetTimeField(field string) *TimeSeriesOptions {
+	opts.TimeField = &field
+	return opts
+}
+
+func (opts *TimeSeriesOptions) SetMetaField(field string) *TimeSeriesOptions {
+	opts.MetaField = &field
+	return opts
+}
+
+func (opts *TimeSeriesOptions) SetGranularity(granularity Granularity) *TimeSeriesOptions {
+	opts.Granularity = &granularity
+	return opts
+}
+
+func (opts *TimeSeriesOptions) SetRetention(retention time.Duration) *TimeSeriesOptions {
+	opts.Retention = &retention
+	return opts
+}
+
+func mergeTimeSeriesOptions(opts ...*TimeSeriesOptions) *TimeSeriesOptions {
+	ret := NewTimeSeriesOptions().
+		SetTimeField(FieldTimestamp).
+		SetMetaField(FieldTenantID).
+		SetGranularity(GranularitySeconds).
+		SetRetention(0)
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.TimeField != nil {
+			ret.TimeField = opt.TimeField
+		}
+		if opt.MetaField != nil {
+			ret.MetaField = opt.MetaField
+		}
+		if opt.Granularity != nil {
+			ret.Granularity = opt.Granularity
+		}
+		if opt.Retention != nil {
+			ret.Retention = opt.Retention
+		}
+	}
+	return ret
+}
+
+// expireAfterSeconds is the collMod value of the retention.
+func expireAfterSeconds(retention time.Duration) interface{} {
+	if retention <= 0 {
+		return "off"
+	}
+	return int64(retention / time.Second)
+}
+
+type timeSeriesInfo struct {
+	Options struct {
+		ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+		TimeSeries         struct {
+			Granularity Granularity `bson:"granularity"`
+		} `bson:"timeseries"`
+	} `bson:"options"`
+}
+
+// collModTimeSeries returns the collMod command updating the collection to
+// the options, or nil if it is up to date.
+func collModTimeSeries(name string, info timeSeriesInfo, opts *TimeSeriesOptions) bson.D {
+	cmd := bson.D{{Key: "collMod", Value: name}}
+	var current time.Duration
+	if info.Options.ExpireAfterSeconds != nil {
+		current = time.Duration(*info.Options.ExpireAfterSeconds) * time.Second
+	}
+	retention := *opts.Retention
+	if retention < 0 {
+		retention = 0
+	}
+	if current != retention.Truncate(time.Second) {
+		cmd = append(cmd, bson.E{
+			Key: "expireAfterSeconds", Value: expireAfterSeconds(retention),
+		})
+	}
+	if info.Options.TimeSeries.Granularity != *opts.Granularity {
+		cmd = append(cmd, bson.E{Key: "timeseries", Value: bson.D{
+			{Key: "granularity", Value: string(*opts.Granularity)},
+		}})
+	}
+	if len(cmd) == 1 {
+		return nil
+	}
+	return cmd
+}
+
+// EnsureTimeSeries creates the time-series collection or, if it exists,
+// updates its granularity and retention to the options. The time and meta
+// fields of an existing collection cannot be changed.
+func EnsureTimeSeries(
+	ctx context.Context,
+	db *mongo.Database,
+	name string,
+	opts ...*TimeSeriesOptions,
+) error {
+	opt := mergeTimeSeriesOptions(opts...)
+	createOpts := mopts.CreateCollection().
+		SetTimeSeriesOptions(mopts.TimeSeries().
+			SetTimeField(*opt.TimeField).
+			SetMetaField(*opt.MetaField).
+			SetGranularity(string(*opt.Granularity)))
+	if *opt.Retention > 0 {
+		createOpts.SetExpireAfterSeconds(int64(*opt.Retention / time.Second))
+	}
+	err := db.CreateCollection(ctx, name, createOpts)
+	var cmdErr mongo.CommandError
+	if err == nil {
+		return nil
+	} else if !errors.As(err, &cmdErr) || cmdErr.Code != errCodeNamespaceExists {
+		return errors.Wrapf(err, "store: failed to create time-series collection %q", name)
+	}
+
+	cur, err := db.ListCollections(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return errors.Wrapf(err, "store: failed to get options of collection %q", name)
+	}
+	var infos []timeSeriesInfo
+	if err = cur.All(ctx, &infos); err != nil {
+		return errors.Wrapf(err, "store: failed to decode options of collection %q", name)
+	} else if len(infos) == 0 {
+		return errors.Errorf("store: collection %q not found", name)
+	}
+	if cmd := collModTimeSeries(name, infos[0], opt); cmd != nil {
+		err = db.RunCommand(ctx, cmd).Err()
+		if err != nil {
+			return errors.Wrapf(err,
+				"store: failed to update time-series collection %q", name)
+		}
+	}
+	return nil
+}
+
+// InsertMeasurements inserts the documents into the time-series collection
+// adding the tenant_id of the context to each of them.
+func InsertMeasurements(
+	ctx context.Context,
+	collection *mongo.Collection,
+	measurements ...interface{},
+) error {
+	if len(measurements) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(measurements))
+	for i, m := range measurements {
+		docs[i] = WithTenantID(ctx, m)
+	}
+	_, err := collection.InsertMany(ctx, docs, mopts.InsertMany().SetOrdered(false))
+	if err != nil {
+		return errors.Wrap(err, "store: failed to insert measurements")
+	}
+	return nil
+}
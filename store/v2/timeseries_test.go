@@ -0,0 +1,117 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestCollModTimeSeries(t *testing.T) {
+	t.Parallel()
+	day := int64(24 * 3600)
+	newInfo := func(expire *int64, granularity Granularity) timeSeriesInfo {
+		var info timeSeriesInfo
+		info.Options.ExpireAfterSeconds = expire
+		info.Options.TimeSeries.Granularity = granularity
+		return info
+	}
+	testCases := []struct {
+		Name    string
+		Info    timeSeriesInfo
+		Options *TimeSeriesOptions
+
+		Command bson.D
+	}{{
+		Name:    "up to date",
+		Info:    newInfo(&day, GranularityMinutes),
+		Options: NewTimeSeriesOptions().SetRetention(24 * time.Hour).SetGranularity(GranularityMinutes),
+	}, {
+		Name:    "up to date without retention",
+		Info:    newInfo(nil, GranularitySeconds),
+		Options: NewTimeSeriesOptions(),
+	}, {
+		Name:    "set retention",
+		Info:    newInfo(nil, GranularitySeconds),
+		Options: NewTimeSeriesOptions().SetRetention(time.Hour),
+		Command: bson.D{
+			{Key: "collMod", Value: "metrics"},
+			{Key: "expireAfterSeconds", Value: int64(3600)},
+		},
+	}, {
+		Name:    "disable retention",
+		Info:    newInfo(&day, GranularitySeconds),
+		Options: NewTimeSeriesOptions(),
+		Command: bson.D{
+			{Key: "collMod", Value: "metrics"},
+			{Key: "expireAfterSeconds", Value: "off"},
+		},
+	}, {
+		Name:    "change granularity",
+		Info:    newInfo(nil, GranularitySeconds),
+		Options: NewTimeSeriesOptions().SetGranularity(GranularityHours),
+		Command: bson.D{
+			{Key: "collMod", Value: "metrics"},
+			{Key: "timeseries", Value: bson.D{{Key: "granularity", Value: "hours"}}},
+		},
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			opts := mergeTimeSeriesOptions(tc.Options)
+			assert.Equal(t, tc.Command, collModTimeSeries("metrics", tc.Info, opts))
+		})
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "timeseries")
+		ctx := db.Context("tenant1")
+
+		opts := NewTimeSeriesOptions().SetRetention(time.Hour)
+		require.NoError(t, EnsureTimeSeries(ctx, db.Database, "metrics", opts))
+		// Changing the retention of the existing collection
+		require.NoError(t, EnsureTimeSeries(ctx, db.Database, "metrics",
+			opts.SetRetention(2*time.Hour)))
+
+		collection := db.Collection("metrics")
+		now := Timestamp(nil)
+		err := InsertMeasurements(ctx, collection,
+			bson.D{{Key: FieldTimestamp, Value: now}, {Key: "value", Value: 1}},
+			bson.D{{Key: FieldTimestamp, Value: now}, {Key: "value", Value: 2}},
+		)
+		require.NoError(t, err)
+
+		count, err := collection.CountDocuments(ctx, WithTenantID(ctx, bson.D{}))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		count, err = collection.CountDocuments(ctx,
+			WithTenantID(db.Context("tenant2"), bson.D{}))
+		require.NoError(t, err)
+		assert.Zero(t, count)
+		return 0
+	}, nil)
+}
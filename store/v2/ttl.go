@@ -0,0 +1,100 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopts "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type indexInfo struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+}
+
+// ttlIndexName is the default name of an ascending single field index.
+func ttlIndexName(field string) string {
+	return field + "_1"
+}
+
+func findTTLIndex(indexes []indexInfo, field string) *indexInfo {
+	for i := range indexes {
+		key := indexes[i].Key
+		if len(key) == 1 && key[0].Key == field {
+			return &indexes[i]
+		}
+	}
+	return nil
+}
+
+// EnsureTTLIndex makes sure the collection has a TTL index on field
+// expiring the documents ttl after the time of the field (use a zero ttl
+// with an expiry time such as ExpiresAt). If the index exists with a
+// different TTL, e.g. after the TTL has changed in the configuration, the
+// index is updated with collMod rather than failing with an
+// IndexOptionsConflict error.
+func EnsureTTLIndex(
+	ctx context.Context,
+	collection *mongo.Collection,
+	field string,
+	ttl time.Duration,
+) error {
+	expireAfter := int64(ttl / time.Second)
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return errors.Wrapf(err,
+			"store: failed to list indexes of %q", collection.Name())
+	}
+	var indexes []indexInfo
+	if err = cur.All(ctx, &indexes); err != nil {
+		return errors.Wrapf(err,
+			"store: failed to decode indexes of %q", collection.Name())
+	}
+	index := findTTLIndex(indexes, field)
+	if index == nil {
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: mopts.Index().
+				SetName(ttlIndexName(field)).
+				SetExpireAfterSeconds(int32(expireAfter)),
+		})
+		if err != nil {
+			return errors.Wrapf(err,
+				"store: failed to create TTL index on %q", field)
+		}
+		return nil
+	} else if index.ExpireAfterSeconds != nil &&
+		*index.ExpireAfterSeconds == expireAfter {
+		return nil
+	}
+	err = collection.Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection.Name()},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: index.Name},
+			{Key: "expireAfterSeconds", Value: expireAfter},
+		}},
+	}).Err()
+	if err != nil {
+		return errors.Wrapf(err,
+			"store: failed to update TTL index %q", index.Name)
+	}
+	return nil
+}
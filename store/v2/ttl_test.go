@@ -0,0 +1,73 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	mtesting "github.com/mendersoftware/go-lib-micro/mongo/testing"
+)
+
+func TestFindTTLIndex(t *testing.T) {
+	t.Parallel()
+	indexes := []indexInfo{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: 1}}},
+		{Name: "compound", Key: bson.D{
+			{Key: FieldTenantID, Value: 1},
+			{Key: FieldExpireTS, Value: 1},
+		}},
+		{Name: "expire", Key: bson.D{{Key: FieldExpireTS, Value: 1}}},
+	}
+	if index := findTTLIndex(indexes, FieldExpireTS); assert.NotNil(t, index) {
+		assert.Equal(t, "expire", index.Name)
+	}
+	assert.Nil(t, findTTLIndex(indexes, FieldCreatedTS))
+}
+
+func TestEnsureTTLIndex(t *testing.T) {
+	if _, ok := os.LookupEnv("TEST_MONGO_URL"); !ok {
+		t.Skip("Test requires TEST_MONGO_URL to be set")
+	}
+	_ = mtesting.WithDB(func(runner mtesting.TestDBRunner) int {
+		db := mtesting.NewDatabase(t, runner, "ttl")
+		ctx := context.Background()
+		collection := db.Collection("sessions")
+
+		getTTL := func() int64 {
+			cur, err := collection.Indexes().List(ctx)
+			require.NoError(t, err)
+			var indexes []indexInfo
+			require.NoError(t, cur.All(ctx, &indexes))
+			index := findTTLIndex(indexes, FieldCreatedTS)
+			require.NotNil(t, index)
+			require.NotNil(t, index.ExpireAfterSeconds)
+			return *index.ExpireAfterSeconds
+		}
+
+		require.NoError(t, EnsureTTLIndex(ctx, collection, FieldCreatedTS, time.Hour))
+		assert.Equal(t, int64(3600), getTTL())
+		require.NoError(t, EnsureTTLIndex(ctx, collection, FieldCreatedTS, time.Hour))
+		require.NoError(t, EnsureTTLIndex(ctx, collection, FieldCreatedTS, time.Minute))
+		assert.Equal(t, int64(60), getTTL())
+		return 0
+	}, nil)
+}
@@ -27,19 +27,19 @@ import (
 
 const FieldTenantID = "tenant_id"
 
+func tenantElement(ctx context.Context) bson.E {
+	var tenantID string
+	if identity := identity.FromContext(ctx); identity != nil {
+		tenantID = identity.Tenant
+	}
+	return bson.E{Key: FieldTenantID, Value: tenantID}
+}
+
 // WithTenantID adds the tenant_id field to a bson document using the value extracted
 // from the identity of the context
 func WithTenantID(ctx context.Context, doc interface{}) bson.D {
-	var (
-		tenantID string
-		res      bson.D
-	)
-
-	identity := identity.FromContext(ctx)
-	if identity != nil {
-		tenantID = identity.Tenant
-	}
-	tenantElem := bson.E{Key: FieldTenantID, Value: tenantID}
+	var res bson.D
+	tenantElem := tenantElement(ctx)
 
 	switch v := doc.(type) {
 	case map[string]interface{}:
@@ -55,6 +55,17 @@ func WithTenantID(ctx context.Context, doc interface{}) bson.D {
 	case bson.D:
 		res = make(bson.D, len(v), len(v)+1)
 		copy(res, v)
+	case bson.Raw:
+		// Keep the values encoded: the driver copies bson.RawValues
+		// verbatim when marshaling the result.
+		elems, err := v.Elements()
+		if err != nil {
+			return nil
+		}
+		res = make(bson.D, len(elems), len(elems)+1)
+		for i, elem := range elems {
+			res[i] = bson.E{Key: elem.Key(), Value: elem.Value()}
+		}
 
 	case bson.Marshaler:
 		b, err := v.MarshalBSON()
@@ -73,6 +84,28 @@ func WithTenantID(ctx context.Context, doc interface{}) bson.D {
 	return res
 }
 
+// AppendTenantID appends the tenant_id element to doc in place and returns
+// the resulting document. Unlike WithTenantID, the document is not copied,
+// so it is the fast path for documents built by the caller for a single
+// operation. If doc has spare capacity, the returned document shares the
+// underlying array with doc.
+func AppendTenantID(ctx context.Context, doc bson.D) bson.D {
+	return append(doc, tenantElement(ctx))
+}
+
+// SetTenantID sets the tenant_id key of doc in place and returns doc.
+// A nil doc is allocated. Unlike WithTenantID, the map is not converted to
+// a bson.D, so it is the fast path for documents built by the caller for a
+// single operation.
+func SetTenantID(ctx context.Context, doc bson.M) bson.M {
+	if doc == nil {
+		doc = make(bson.M, 1)
+	}
+	elem := tenantElement(ctx)
+	doc[elem.Key] = elem.Value
+	return doc
+}
+
 // ArrayWithTenantID adds the tenant_id field to an array of bson documents
 // using the value extracted from the identity of the context
 func ArrayWithTenantID(ctx context.Context, doc bson.A) bson.A {
@@ -0,0 +1,104 @@
+// Copyright 2024 Northern.tech AS
+//
+//	Licensed under the Apache License, Version 2.0 (the "License");
+//	you may not use this file except in compliance with the License.
+//	You may obtain a copy of the License at
+//
+//	    http://www.apache.org/licenses/LICENSE-2.0
+//
+//	Unless required by applicable law or agreed to in writing, software
+//	distributed under the License is distributed on an "AS IS" BASIS,
+//	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//	See the License for the specific language governing permissions and
+//	limitations under the License.
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+)
+
+type benchDocument struct {
+	ID         string            `bson:"_id"`
+	Name       string            `bson:"name"`
+	Status     string            `bson:"status"`
+	Attributes map[string]string `bson:"attributes"`
+}
+
+func (d benchDocument) MarshalBSON() ([]byte, error) {
+	type doc benchDocument
+	return bson.Marshal(doc(d))
+}
+
+func newBenchContext() context.Context {
+	return identity.WithContext(context.Background(), &identity.Identity{
+		Subject: "subject",
+		Tenant:  "tenant",
+	})
+}
+
+func newBenchDocument() bson.D {
+	return bson.D{
+		{Key: "_id", Value: "0d5a79cd-fd9f-4b86-a8ae-5a1a2ac12781"},
+		{Key: "name", Value: "device"},
+		{Key: "status", Value: "accepted"},
+		{Key: "attributes", Value: bson.M{"foo": "bar"}},
+	}
+}
+
+func BenchmarkWithTenantID(b *testing.B) {
+	ctx := newBenchContext()
+	doc := newBenchDocument()
+	docM := doc.Map()
+	raw, _ := bson.Marshal(doc)
+	sct := benchDocument{
+		ID:         "0d5a79cd-fd9f-4b86-a8ae-5a1a2ac12781",
+		Name:       "device",
+		Status:     "accepted",
+		Attributes: map[string]string{"foo": "bar"},
+	}
+	type plainDocument benchDocument
+	benchmarks := []struct {
+		Name string
+		Doc  interface{}
+	}{
+		{Name: "bson.D", Doc: doc},
+		{Name: "bson.M", Doc: docM},
+		{Name: "bson.Raw", Doc: bson.Raw(raw)},
+		{Name: "struct", Doc: plainDocument(sct)},
+		{Name: "bson.Marshaler", Doc: sct},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = WithTenantID(ctx, bm.Doc)
+			}
+		})
+	}
+}
+
+func BenchmarkAppendTenantID(b *testing.B) {
+	ctx := newBenchContext()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = AppendTenantID(ctx, newBenchDocument())
+	}
+}
+
+func BenchmarkSetTenantID(b *testing.B) {
+	ctx := newBenchContext()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = SetTenantID(ctx, bson.M{
+			"_id":        "0d5a79cd-fd9f-4b86-a8ae-5a1a2ac12781",
+			"name":       "device",
+			"status":     "accepted",
+			"attributes": bson.M{"foo": "bar"},
+		})
+	}
+}
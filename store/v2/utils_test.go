@@ -107,6 +107,58 @@ func TestWithTenantID(t *testing.T) {
 	assert.Nil(t, res)
 }
 
+func TestWithTenantIDRaw(t *testing.T) {
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "bar",
+	})
+	raw, _ := bson.Marshal(bson.D{
+		{Key: "key", Value: "value"},
+		{Key: "nested", Value: bson.D{{Key: "foo", Value: 1}}},
+	})
+	res := WithTenantID(ctx, bson.Raw(raw))
+	if assert.Len(t, res, 3) {
+		assert.Equal(t, bson.E{Key: FieldTenantID, Value: "bar"}, res[2])
+	}
+	b, err := bson.Marshal(res)
+	if assert.NoError(t, err) {
+		var actual bson.D
+		_ = bson.Unmarshal(b, &actual)
+		assert.Equal(t, bson.D{
+			{Key: "key", Value: "value"},
+			{Key: "nested", Value: bson.D{{Key: "foo", Value: int32(1)}}},
+			{Key: FieldTenantID, Value: "bar"},
+		}, actual)
+	}
+
+	res = WithTenantID(ctx, bson.Raw("invalid"))
+	assert.Nil(t, res)
+}
+
+func TestAppendTenantID(t *testing.T) {
+	ctx := context.Background()
+	res := AppendTenantID(ctx, bson.D{{Key: "key", Value: "value"}})
+	assert.Equal(t, bson.D{{Key: "key", Value: "value"}, {Key: FieldTenantID, Value: ""}}, res)
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: "bar"})
+	res = AppendTenantID(ctx, nil)
+	assert.Equal(t, bson.D{{Key: FieldTenantID, Value: "bar"}}, res)
+}
+
+func TestSetTenantID(t *testing.T) {
+	ctx := context.Background()
+	doc := bson.M{"key": "value"}
+	res := SetTenantID(ctx, doc)
+	assert.Equal(t, bson.M{"key": "value", FieldTenantID: ""}, res)
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: "bar"})
+	res = SetTenantID(ctx, doc)
+	assert.Equal(t, bson.M{"key": "value", FieldTenantID: "bar"}, res)
+	assert.Equal(t, "bar", doc[FieldTenantID])
+
+	res = SetTenantID(ctx, nil)
+	assert.Equal(t, bson.M{FieldTenantID: "bar"}, res)
+}
+
 func TestArrayWithTenantID(t *testing.T) {
 	ctx := context.Background()
 
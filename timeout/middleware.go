@@ -0,0 +1,138 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package timeout provides a middleware bounding the time spent processing
+// a request.
+package timeout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const (
+	DefaultTimeout = time.Second * 30
+)
+
+var (
+	ErrRequestTimeout = errors.New("request timed out")
+)
+
+type MiddlewareOptions struct {
+	// Timeout is the default timeout applied to all routes
+	// (default: DefaultTimeout).
+	Timeout *time.Duration
+
+	// RouteTimeouts overrides the timeout for the given routes. The key
+	// is the route pattern as returned by gin.Context.FullPath and a
+	// non-positive value disables the timeout for the route.
+	RouteTimeouts map[string]time.Duration
+
+	// StatusCode is the status returned when the request times out
+	// (default: 503 Service Unavailable).
+	StatusCode *int
+}
+
+func NewMiddlewareOptions() *MiddlewareOptions {
+	return new(MiddlewareOptions)
+}
+
+func (opts *MiddlewareOptions) SetTimeout(timeout time.Duration) *MiddlewareOptions {
+	opts.Timeout = &timeout
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetRouteTimeout(
+	route string,
+	timeout time.Duration,
+) *MiddlewareOptions {
+	if opts.RouteTimeouts == nil {
+		opts.RouteTimeouts = make(map[string]time.Duration)
+	}
+	opts.RouteTimeouts[route] = timeout
+	return opts
+}
+
+func (opts *MiddlewareOptions) SetStatusCode(code int) *MiddlewareOptions {
+	opts.StatusCode = &code
+	return opts
+}
+
+// Remaining returns the time remaining until the context deadline
+// (the request budget). If the context has no deadline, ok is false.
+func Remaining(ctx context.Context) (remaining time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// Middleware applies a deadline to the request context. The timeout is
+// cooperative: handlers and the data layer are expected to abort when the
+// context is done. If the handler returns after the deadline without
+// writing a response, the middleware responds with an error using the
+// configured status code. If the request context already has a shorter
+// deadline, it is left unchanged.
+func Middleware(opts ...*MiddlewareOptions) gin.HandlerFunc {
+	opt := NewMiddlewareOptions().
+		SetTimeout(DefaultTimeout).
+		SetStatusCode(http.StatusServiceUnavailable)
+	routes := make(map[string]time.Duration)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Timeout != nil {
+			opt.Timeout = o.Timeout
+		}
+		if o.StatusCode != nil {
+			opt.StatusCode = o.StatusCode
+		}
+		for route, timeout := range o.RouteTimeouts {
+			routes[route] = timeout
+		}
+	}
+	defaultTimeout := *opt.Timeout
+	statusCode := *opt.StatusCode
+	return func(c *gin.Context) {
+		timeout := defaultTimeout
+		if routeTimeout, ok := routes[c.FullPath()]; ok {
+			timeout = routeTimeout
+		}
+		if timeout <= 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			if lc := accesslog.GetContext(ctx); lc != nil {
+				lc.SetField("timeout", timeout.String())
+			}
+			if !c.Writer.Written() {
+				rest.RenderError(c, statusCode, ErrRequestTimeout)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package timeout
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/accesslog"
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	waitForDeadline := func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	}
+	testCases := []struct {
+		Name string
+
+		Options *MiddlewareOptions
+		Path    string
+		Handler gin.HandlerFunc
+
+		StatusCode int
+		Body       string
+		LogFields  []string
+	}{{
+		Name: "ok",
+
+		Options: NewMiddlewareOptions().SetTimeout(time.Minute),
+		Handler: func(c *gin.Context) {
+			remaining, ok := Remaining(c.Request.Context())
+			assert.True(t, ok)
+			assert.Greater(t, remaining, time.Second*59)
+			c.Status(http.StatusNoContent)
+		},
+
+		StatusCode: http.StatusNoContent,
+	}, {
+		Name: "timeout",
+
+		Options: NewMiddlewareOptions().SetTimeout(time.Millisecond * 10),
+		Handler: waitForDeadline,
+
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       `{"error":"request timed out"}`,
+		LogFields: []string{
+			"status=503",
+			"timeout=10ms",
+			`error="request timed out"`,
+		},
+	}, {
+		Name: "timeout, custom status code",
+
+		Options: NewMiddlewareOptions().
+			SetTimeout(time.Millisecond * 10).
+			SetStatusCode(http.StatusGatewayTimeout),
+		Handler: waitForDeadline,
+
+		StatusCode: http.StatusGatewayTimeout,
+		Body:       `{"error":"request timed out"}`,
+	}, {
+		Name: "timeout, response already written",
+
+		Options: NewMiddlewareOptions().SetTimeout(time.Millisecond * 10),
+		Handler: func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			c.String(http.StatusOK, "late")
+		},
+
+		StatusCode: http.StatusOK,
+		Body:       "late",
+	}, {
+		Name: "route override",
+
+		Options: NewMiddlewareOptions().
+			SetTimeout(time.Millisecond).
+			SetRouteTimeout("/test/:id", time.Millisecond*10),
+		Path: "/test/123",
+		Handler: func(c *gin.Context) {
+			remaining, _ := Remaining(c.Request.Context())
+			assert.Greater(t, remaining, time.Millisecond*2)
+			c.Status(http.StatusNoContent)
+		},
+		StatusCode: http.StatusNoContent,
+	}, {
+		Name: "route override, disabled",
+
+		Options: NewMiddlewareOptions().
+			SetTimeout(time.Millisecond).
+			SetRouteTimeout("/test/:id", 0),
+		Path: "/test/123",
+		Handler: func(c *gin.Context) {
+			_, ok := Remaining(c.Request.Context())
+			assert.False(t, ok)
+			c.Status(http.StatusNoContent)
+		},
+		StatusCode: http.StatusNoContent,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			logBuf := bytes.NewBuffer(nil)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				logger := log.NewEmpty()
+				logger.Logger.SetOutput(logBuf)
+				logger.Logger.SetFormatter(&logrus.TextFormatter{
+					DisableColors: true,
+				})
+				ctx := log.WithContext(c.Request.Context(), logger)
+				c.Request = c.Request.WithContext(ctx)
+			})
+			router.Use(accesslog.Middleware())
+			router.Use(Middleware(tc.Options))
+			router.GET("/test", tc.Handler)
+			router.GET("/test/:id", tc.Handler)
+
+			path := tc.Path
+			if path == "" {
+				path = "/test"
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.StatusCode, w.Code)
+			if tc.Body != "" {
+				assert.Equal(t, tc.Body, w.Body.String())
+			}
+			for _, field := range tc.LogFields {
+				assert.Contains(t, logBuf.String(), field)
+			}
+		})
+	}
+}
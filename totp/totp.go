@@ -0,0 +1,256 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package totp implements time-based one-time passwords (RFC 6238) for
+// two-factor authentication.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+	// MinDigits and MaxDigits are the supported number of digits of the
+	// codes: RFC 4226 requires at least 6 digits and the 31 bit value
+	// of the HOTP truncation has 10 digits.
+	MinDigits = 6
+	MaxDigits = 10
+	// DefaultSecretSize is the size of the generated secrets, the size
+	// of the SHA1 digest recommended by RFC 4226.
+	DefaultSecretSize = 20
+)
+
+var (
+	ErrInvalidSecret    = errors.New("totp: invalid secret")
+	ErrUnknownAlgorithm = errors.New("totp: unknown algorithm")
+	ErrInvalidDigits    = errors.New("totp: digits must be between 6 and 10")
+	ErrInvalidPeriod    = errors.New("totp: period must be a whole number of seconds")
+)
+
+// Algorithm is the HMAC algorithm of the key.
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+func (alg Algorithm) hash() (func() hash.Hash, error) {
+	switch alg {
+	case "", AlgorithmSHA1:
+		return sha1.New, nil
+	case AlgorithmSHA256:
+		return sha256.New, nil
+	case AlgorithmSHA512:
+		return sha512.New, nil
+	}
+	return nil, errors.Wrapf(ErrUnknownAlgorithm, "%q", string(alg))
+}
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is the TOTP key of an account. The zero values of Algorithm, Digits
+// and Period select SHA1, 6 digits and 30 seconds, the values supported by
+// all authenticator apps. Keys with invalid parameters (see CheckParams)
+// fail to produce and validate codes.
+type Key struct {
+	Secret []byte
+
+	// Issuer and AccountName identify the key in the authenticator
+	// app, e.g. "Mender" and the email address of the user.
+	Issuer      string
+	AccountName string
+
+	Algorithm Algorithm
+	Digits    int
+	Period    time.Duration
+}
+
+// GenerateKey generates a key with a random secret.
+func GenerateKey(issuer, accountName string) (*Key, error) {
+	secret := make([]byte, DefaultSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrap(err, "totp: failed to generate secret")
+	}
+	return &Key{
+		Secret:      secret,
+		Issuer:      issuer,
+		AccountName: accountName,
+	}, nil
+}
+
+// DecodeSecret decodes the base32 encoded secret (case insensitive, with or
+// without padding and spaces).
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	b, err := secretEncoding.DecodeString(secret)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return b, nil
+}
+
+// EncodedSecret returns the base32 encoded secret to store or to enter in
+// the authenticator app manually.
+func (key *Key) EncodedSecret() string {
+	return secretEncoding.EncodeToString(key.Secret)
+}
+
+func (key *Key) digits() int {
+	if key.Digits <= 0 {
+		return DefaultDigits
+	}
+	return key.Digits
+}
+
+func (key *Key) period() time.Duration {
+	if key.Period <= 0 {
+		return DefaultPeriod
+	}
+	return key.Period
+}
+
+// CheckParams returns an error if the algorithm, the number of digits
+// (MinDigits to MaxDigits) or the period (a positive number of seconds)
+// of the key is not supported.
+func (key *Key) CheckParams() error {
+	if _, err := key.Algorithm.hash(); err != nil {
+		return err
+	}
+	if digits := key.digits(); digits < MinDigits || digits > MaxDigits {
+		return errors.Wrapf(ErrInvalidDigits, "%d", digits)
+	}
+	if period := key.period(); period < time.Second || period%time.Second != 0 {
+		return errors.Wrapf(ErrInvalidPeriod, "%s", period)
+	}
+	return nil
+}
+
+// Counter returns the time step of the time.
+func (key *Key) Counter(t time.Time) (int64, error) {
+	if err := key.CheckParams(); err != nil {
+		return 0, err
+	}
+	return t.Unix() / int64(key.period()/time.Second), nil
+}
+
+// CodeAt returns the code of the time step (HOTP, RFC 4226).
+func (key *Key) CodeAt(counter int64) (string, error) {
+	if err := key.CheckParams(); err != nil {
+		return "", err
+	}
+	newHash, err := key.Algorithm.hash()
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(newHash, key.Secret)
+	_, _ = mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := int64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+
+	digits := key.digits()
+	mod := int64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	code := strconv.FormatInt(value%mod, 10)
+	if len(code) < digits {
+		code = strings.Repeat("0", digits-len(code)) + code
+	}
+	return code, nil
+}
+
+// Code returns the code at time t.
+func (key *Key) Code(t time.Time) (string, error) {
+	counter, err := key.Counter(t)
+	if err != nil {
+		return "", err
+	}
+	return key.CodeAt(counter)
+}
+
+// Validate checks the code at time t accepting the codes of up to skew
+// time steps before and after t to tolerate clock drift. On success it
+// returns the time step of the code which should be stored to reject
+// replays of the code: pass it as the lastCounter of the next validation.
+// Use a negative lastCounter if no code was accepted before.
+func (key *Key) Validate(code string, t time.Time, skew uint, lastCounter int64) (int64, bool) {
+	if len(code) != key.digits() {
+		return 0, false
+	}
+	counter, err := key.Counter(t)
+	if err != nil {
+		return 0, false
+	}
+	var (
+		matched int64
+		ok      bool
+	)
+	// Compare against all the codes of the window to not leak the
+	// matching step through the timing.
+	for step := counter - int64(skew); step <= counter+int64(skew); step++ {
+		expected, err := key.CodeAt(step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 &&
+			step > lastCounter && !ok {
+			matched, ok = step, true
+		}
+	}
+	return matched, ok
+}
+
+// URI returns the "otpauth://" key URI for provisioning the key in the
+// authenticator app, typically rendered as a QR code.
+func (key *Key) URI() string {
+	label := url.PathEscape(key.AccountName)
+	if key.Issuer != "" {
+		label = url.PathEscape(key.Issuer) + ":" + label
+	}
+	q := url.Values{}
+	q.Set("secret", key.EncodedSecret())
+	if key.Issuer != "" {
+		q.Set("issuer", key.Issuer)
+	}
+	alg := key.Algorithm
+	if alg == "" {
+		alg = AlgorithmSHA1
+	}
+	q.Set("algorithm", string(alg))
+	q.Set("digits", strconv.Itoa(key.digits()))
+	q.Set("period", strconv.Itoa(int(key.period()/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCodeRFC6238 checks the test vectors of RFC 6238 appendix B.
+func TestCodeRFC6238(t *testing.T) {
+	t.Parallel()
+	seeds := map[Algorithm][]byte{
+		AlgorithmSHA1:   []byte("12345678901234567890"),
+		AlgorithmSHA256: []byte("12345678901234567890123456789012"),
+		AlgorithmSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	testCases := []struct {
+		Time      int64
+		Algorithm Algorithm
+		Code      string
+	}{
+		{59, AlgorithmSHA1, "94287082"},
+		{59, AlgorithmSHA256, "46119246"},
+		{59, AlgorithmSHA512, "90693936"},
+		{1111111109, AlgorithmSHA1, "07081804"},
+		{1111111109, AlgorithmSHA256, "68084774"},
+		{1111111109, AlgorithmSHA512, "25091201"},
+		{1234567890, AlgorithmSHA1, "89005924"},
+		{2000000000, AlgorithmSHA256, "90698825"},
+		{20000000000, AlgorithmSHA512, "47863826"},
+	}
+	for _, tc := range testCases {
+		key := &Key{
+			Secret:    seeds[tc.Algorithm],
+			Algorithm: tc.Algorithm,
+			Digits:    8,
+		}
+		code, err := key.Code(time.Unix(tc.Time, 0))
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.Code, code, "%d %s", tc.Time, tc.Algorithm)
+		}
+	}
+
+	_, err := (&Key{Algorithm: "MD5"}).Code(time.Now())
+	assert.ErrorIs(t, err, ErrUnknownAlgorithm)
+}
+
+func TestCheckParams(t *testing.T) {
+	t.Parallel()
+	secret := []byte("12345678901234567890")
+	testCases := []struct {
+		Key   Key
+		Error error
+	}{
+		{Key: Key{}},
+		{Key: Key{Digits: 10, Period: time.Minute}},
+		{Key: Key{Digits: 5}, Error: ErrInvalidDigits},
+		{Key: Key{Digits: 19}, Error: ErrInvalidDigits},
+		{Key: Key{Period: time.Millisecond}, Error: ErrInvalidPeriod},
+		{Key: Key{Period: 1500 * time.Millisecond}, Error: ErrInvalidPeriod},
+		{Key: Key{Algorithm: "MD5"}, Error: ErrUnknownAlgorithm},
+	}
+	for _, tc := range testCases {
+		key := tc.Key
+		key.Secret = secret
+		err := key.CheckParams()
+		_, codeErr := key.Code(time.Now())
+		_, ok := key.Validate("123456", time.Now(), 1, -1)
+		if tc.Error != nil {
+			assert.ErrorIs(t, err, tc.Error, "%+v", tc.Key)
+			assert.ErrorIs(t, codeErr, tc.Error, "%+v", tc.Key)
+			assert.False(t, ok)
+		} else {
+			assert.NoError(t, err, "%+v", tc.Key)
+			assert.NoError(t, codeErr, "%+v", tc.Key)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	key, err := GenerateKey("Mender", "user@example.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := key.Code(now)
+
+	counter, ok := key.Validate(code, now, 0, -1)
+	assert.True(t, ok)
+	expected, _ := key.Counter(now)
+	assert.Equal(t, expected, counter)
+
+	_, ok = key.Validate(code, now, 0, counter)
+	assert.False(t, ok, "replayed code")
+
+	later := now.Add(DefaultPeriod)
+	_, ok = key.Validate(code, later, 0, -1)
+	assert.False(t, ok, "code outside the window")
+	_, ok = key.Validate(code, later, 1, -1)
+	assert.True(t, ok, "code within the skew")
+
+	_, ok = key.Validate("12345", now, 1, -1)
+	assert.False(t, ok, "wrong length")
+}
+
+func TestSecretEncoding(t *testing.T) {
+	t.Parallel()
+	key := &Key{Secret: []byte("12345678901234567890")}
+	encoded := key.EncodedSecret()
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", encoded)
+
+	secret, err := DecodeSecret(strings.ToLower("GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, key.Secret, secret)
+	}
+	_, err = DecodeSecret("not base32!")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+	_, err = DecodeSecret("")
+	assert.ErrorIs(t, err, ErrInvalidSecret)
+}
+
+func TestURI(t *testing.T) {
+	t.Parallel()
+	key := &Key{
+		Secret:      []byte("12345678901234567890"),
+		Issuer:      "Mender",
+		AccountName: "user@example.com",
+	}
+	assert.Equal(t,
+		"otpauth://totp/Mender:user@example.com?algorithm=SHA1&digits=6"+
+			"&issuer=Mender&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		key.URI())
+}
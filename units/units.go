@@ -0,0 +1,190 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package units parses human-friendly durations ("15m", "1d12h") and byte
+// sizes ("512KiB", "1.5GB").
+package units
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+// Byte size units; the SI units are powers of 1000 and the IEC units are
+// powers of 1024.
+const (
+	Byte int64 = 1
+
+	KB = 1000 * Byte
+	MB = 1000 * KB
+	GB = 1000 * MB
+	TB = 1000 * GB
+	PB = 1000 * TB
+
+	KiB = 1024 * Byte
+	MiB = 1024 * KiB
+	GiB = 1024 * MiB
+	TiB = 1024 * GiB
+	PiB = 1024 * TiB
+)
+
+var (
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrInvalidByteSize = errors.New("invalid byte size")
+	ErrOutOfRange      = errors.New("value out of range")
+)
+
+// ParseDuration parses a duration in the format of time.ParseDuration
+// with the additional units "d" (24h) and "w" (7d), e.g. "1d12h". A plain
+// "0" is accepted as well.
+func ParseDuration(s string) (time.Duration, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.Wrapf(ErrInvalidDuration, "%q", orig)
+	}
+	// Split off the leading day and week components which
+	// time.ParseDuration does not support.
+	var (
+		days float64
+		neg  bool
+	)
+	if s[0] == '-' || s[0] == '+' {
+		neg = s[0] == '-'
+		s = s[1:]
+		if s == "" {
+			return 0, errors.Wrapf(ErrInvalidDuration, "%q", orig)
+		}
+	}
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] == '.' || (rest[i] >= '0' && rest[i] <= '9')) {
+			i++
+		}
+		if i == 0 || i == len(rest) || (rest[i] != 'd' && rest[i] != 'w') {
+			break
+		}
+		n, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return 0, errors.Wrapf(ErrInvalidDuration, "%q", orig)
+		}
+		if rest[i] == 'w' {
+			n *= 7
+		}
+		days += n
+		rest = rest[i+1:]
+	}
+	var d time.Duration
+	if rest != "" {
+		var err error
+		d, err = time.ParseDuration(rest)
+		if err != nil || d < 0 {
+			return 0, errors.Wrapf(ErrInvalidDuration, "%q", orig)
+		}
+	}
+	total := days*float64(Day) + float64(d)
+	if total > math.MaxInt64 {
+		return 0, errors.Wrapf(ErrOutOfRange, "%q", orig)
+	}
+	if neg {
+		total = -total
+	}
+	return time.Duration(total), nil
+}
+
+var byteUnits = map[string]int64{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KB,
+	"kb":  KB,
+	"m":   MB,
+	"mb":  MB,
+	"g":   GB,
+	"gb":  GB,
+	"t":   TB,
+	"tb":  TB,
+	"p":   PB,
+	"pb":  PB,
+	"ki":  KiB,
+	"kib": KiB,
+	"mi":  MiB,
+	"mib": MiB,
+	"gi":  GiB,
+	"gib": GiB,
+	"ti":  TiB,
+	"tib": TiB,
+	"pi":  PiB,
+	"pib": PiB,
+}
+
+// ParseByteSize parses a non-negative byte size with an optional SI (KB,
+// MB, ...) or IEC (KiB, MiB, ...) unit; the units are case-insensitive and
+// the "B" suffix is optional. Fractions are rounded down to whole bytes.
+func ParseByteSize(s string) (int64, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] == '.' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	if i == 0 {
+		return 0, errors.Wrapf(ErrInvalidByteSize, "%q", orig)
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, errors.Wrapf(ErrInvalidByteSize, "%q: unknown unit", orig)
+	}
+	if n, err := strconv.ParseInt(s[:i], 10, 64); err == nil {
+		if n > math.MaxInt64/unit {
+			return 0, errors.Wrapf(ErrOutOfRange, "%q", orig)
+		}
+		return n * unit, nil
+	}
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalidByteSize, "%q", orig)
+	}
+	f *= float64(unit)
+	if f >= math.MaxInt64 {
+		return 0, errors.Wrapf(ErrOutOfRange, "%q", orig)
+	}
+	return int64(f), nil
+}
+
+// FormatByteSize formats the size with the largest IEC unit the size is a
+// multiple of, e.g. "512KiB"; it is the inverse of ParseByteSize.
+func FormatByteSize(size int64) string {
+	units := []struct {
+		name string
+		size int64
+	}{
+		{"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	}
+	for _, u := range units {
+		if size != 0 && size%u.size == 0 {
+			return strconv.FormatInt(size/u.size, 10) + u.name
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
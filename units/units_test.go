@@ -0,0 +1,107 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package units
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Value    string
+		Expected time.Duration
+		Error    error
+	}{
+		{Value: "15m", Expected: 15 * time.Minute},
+		{Value: " 1h30m ", Expected: 90 * time.Minute},
+		{Value: "0", Expected: 0},
+		{Value: "1d", Expected: Day},
+		{Value: "1.5d", Expected: 36 * time.Hour},
+		{Value: "2w", Expected: 2 * Week},
+		{Value: "1w2d3h", Expected: Week + 2*Day + 3*time.Hour},
+		{Value: "-1d1h", Expected: -25 * time.Hour},
+		{Value: "", Error: ErrInvalidDuration},
+		{Value: "-", Error: ErrInvalidDuration},
+		{Value: "15", Error: ErrInvalidDuration},
+		{Value: "1x", Error: ErrInvalidDuration},
+		{Value: "d", Error: ErrInvalidDuration},
+		{Value: "1d-1h", Error: ErrInvalidDuration},
+		{Value: "1..5d", Error: ErrInvalidDuration},
+		{Value: "1000000w", Error: ErrOutOfRange},
+	}
+	for _, tc := range testCases {
+		d, err := ParseDuration(tc.Value)
+		if tc.Error != nil {
+			assert.ErrorIs(t, err, tc.Error, tc.Value)
+		} else if assert.NoError(t, err, tc.Value) {
+			assert.Equal(t, tc.Expected, d, tc.Value)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		Value    string
+		Expected int64
+		Error    error
+	}{
+		{Value: "0", Expected: 0},
+		{Value: "512", Expected: 512},
+		{Value: "512B", Expected: 512},
+		{Value: "1.5GB", Expected: 1500 * MB},
+		{Value: "1.5 gb", Expected: 1500 * MB},
+		{Value: "10k", Expected: 10 * KB},
+		{Value: "512KiB", Expected: 512 * KiB},
+		{Value: "1Gi", Expected: GiB},
+		{Value: "0.5KiB", Expected: 512},
+		{Value: "8191PiB", Expected: 8191 * PiB},
+		{Value: "", Error: ErrInvalidByteSize},
+		{Value: "GB", Error: ErrInvalidByteSize},
+		{Value: "-1MB", Error: ErrInvalidByteSize},
+		{Value: "1XB", Error: ErrInvalidByteSize},
+		{Value: "1.2.3MB", Error: ErrInvalidByteSize},
+		{Value: "8192PiB", Error: ErrOutOfRange},
+		{Value: "9999999999PB", Error: ErrOutOfRange},
+	}
+	for _, tc := range testCases {
+		n, err := ParseByteSize(tc.Value)
+		if tc.Error != nil {
+			assert.ErrorIs(t, err, tc.Error, tc.Value)
+		} else if assert.NoError(t, err, tc.Value) {
+			assert.Equal(t, tc.Expected, n, tc.Value)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	t.Parallel()
+	for size, expected := range map[int64]string{
+		0:          "0B",
+		1000:       "1000B",
+		512 * KiB:  "512KiB",
+		1536 * MiB: "1536MiB",
+		2 * GiB:    "2GiB",
+	} {
+		assert.Equal(t, expected, FormatByteSize(size))
+		n, err := ParseByteSize(expected)
+		assert.NoError(t, err)
+		assert.Equal(t, size, n)
+	}
+}
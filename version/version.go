@@ -0,0 +1,95 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package version exposes the build metadata of the service. The metadata
+// is set at build time with the linker flags, e.g.:
+//
+//	go build -ldflags "\
+//	  -X github.com/mendersoftware/go-lib-micro/version.Version=1.2.3 \
+//	  -X github.com/mendersoftware/go-lib-micro/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/mendersoftware/go-lib-micro/version.BuildDate=$(date -u +%FT%TZ)"
+package version
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build metadata set with the linker flags.
+var (
+	Version   = "unknown"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info is the build metadata of the service.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func (info Info) String() string {
+	s := info.Version
+	if info.Commit != "" {
+		s += " (" + info.Commit + ")"
+	}
+	if info.BuildDate != "" {
+		s += " built " + info.BuildDate
+	}
+	return fmt.Sprintf("%s with %s", s, info.GoVersion)
+}
+
+var readBuildInfo = debug.ReadBuildInfo
+
+// Get returns the build metadata. If the commit and build date are not set
+// with the linker flags, they are taken from the version control
+// information embedded by the go command, if any.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+	if info.Commit != "" && info.BuildDate != "" {
+		return info
+	}
+	if buildInfo, ok := readBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// Handler responds with the build metadata; it serves the
+// /api/internal/v1/<service>/version endpoints.
+func Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, Get())
+}
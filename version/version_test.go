@@ -0,0 +1,121 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setBuildInfo(t *testing.T, version, commit, buildDate string, settings ...debug.BuildSetting) {
+	oldVersion, oldCommit, oldBuildDate := Version, Commit, BuildDate
+	oldReadBuildInfo := readBuildInfo
+	t.Cleanup(func() {
+		Version, Commit, BuildDate = oldVersion, oldCommit, oldBuildDate
+		readBuildInfo = oldReadBuildInfo
+	})
+	Version, Commit, BuildDate = version, commit, buildDate
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: settings}, true
+	}
+}
+
+func TestGet(t *testing.T) {
+	testCases := []struct {
+		Name string
+
+		Version   string
+		Commit    string
+		BuildDate string
+		Settings  []debug.BuildSetting
+
+		Expected Info
+		String   string
+	}{{
+		Name: "ldflags",
+
+		Version:   "1.2.3",
+		Commit:    "abcdef",
+		BuildDate: "2024-01-02T03:04:05Z",
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "123456"},
+		},
+
+		Expected: Info{
+			Version:   "1.2.3",
+			Commit:    "abcdef",
+			BuildDate: "2024-01-02T03:04:05Z",
+		},
+		String: "1.2.3 (abcdef) built 2024-01-02T03:04:05Z with ",
+	}, {
+		Name: "vcs fallback",
+
+		Version: "1.2.3",
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "123456"},
+			{Key: "vcs.time", Value: "2024-01-01T00:00:00Z"},
+		},
+
+		Expected: Info{
+			Version:   "1.2.3",
+			Commit:    "123456",
+			BuildDate: "2024-01-01T00:00:00Z",
+		},
+		String: "1.2.3 (123456) built 2024-01-01T00:00:00Z with ",
+	}, {
+		Name: "no metadata",
+
+		Version: "unknown",
+
+		Expected: Info{Version: "unknown"},
+		String:   "unknown with ",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			setBuildInfo(t, tc.Version, tc.Commit, tc.BuildDate, tc.Settings...)
+			tc.Expected.GoVersion = runtime.Version()
+			info := Get()
+			assert.Equal(t, tc.Expected, info)
+			assert.Equal(t, tc.String+runtime.Version(), info.String())
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	setBuildInfo(t, "1.2.3", "abcdef", "")
+	router := gin.New()
+	router.GET("/version", Handler)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/version", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body)) {
+		assert.Equal(t, map[string]interface{}{
+			"version":    "1.2.3",
+			"commit":     "abcdef",
+			"go_version": runtime.Version(),
+		}, body)
+	}
+}
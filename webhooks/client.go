@@ -0,0 +1,84 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package webhooks
+
+import (
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const maxRedirects = 10
+
+var ErrForbiddenAddress = errors.New("webhooks: destination address is not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which is
+// not covered by net.IP.IsPrivate.
+var sharedAddressSpace = &net.IPNet{
+	IP:   net.IPv4(100, 64, 0, 0),
+	Mask: net.CIDRMask(10, 32),
+}
+
+// isPublicIP reports whether the IP is a global unicast address, i.e. not
+// a loopback, private, link-local (cloud metadata) or multicast address.
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() &&
+		!ip.IsPrivate() &&
+		!sharedAddressSpace.Contains(ip) &&
+		!ip.Equal(net.IPv4bcast)
+}
+
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return errors.Wrap(ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// NewClient returns the default HTTP client of the Deliverer. The
+// webhook URLs are configured by the customers, so the client only
+// connects to public IP addresses, checked after the name resolution and
+// for every redirect, and does not use proxies.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: DefaultTimeout,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+			IdleConnTimeout:     90 * time.Second,
+			MaxIdleConns:        100,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("webhooks: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.Wrap(ErrForbiddenAddress, req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
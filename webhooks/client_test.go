@@ -0,0 +1,88 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package webhooks
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	t.Parallel()
+	for addr, public := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"100.64.0.1":       false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00:ec2::254":    false,
+		"0.0.0.0":          false,
+		"::":               false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+	} {
+		assert.Equal(t, public, isPublicIP(net.ParseIP(addr)), addr)
+	}
+}
+
+func TestDeliverForbiddenAddress(t *testing.T) {
+	t.Parallel()
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer srv.Close()
+	var redirects int
+	redirect := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			redirects++
+			http.Redirect(w, r, srv.URL, http.StatusFound)
+		}))
+	defer redirect.Close()
+
+	d := NewDeliverer()
+	err := d.Deliver(context.Background(), Target{URL: srv.URL}, "ping")
+	assert.ErrorIs(t, err, ErrDeliveryFailed)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Zero(t, calls, "loopback addresses are rejected")
+
+	client := NewClient()
+	transport := client.Transport.(*http.Transport)
+	dial := transport.DialContext
+	// Allow the first hop only.
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == redirect.Listener.Addr().String() {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		return dial(ctx, network, addr)
+	}
+	d = NewDeliverer(NewOptions().SetClient(client))
+	err = d.Deliver(context.Background(), Target{URL: redirect.URL}, "ping")
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Equal(t, 1, redirects)
+	assert.Zero(t, calls, "redirects to loopback addresses are rejected")
+}
@@ -0,0 +1,456 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package webhooks delivers signed JSON payloads to customer configured
+// URLs.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/clock"
+)
+
+const (
+	// HeaderSignature contains the HMAC-SHA256 signature of the request
+	// formatted as "sha256=<hex digest>".
+	HeaderSignature = "X-Men-Signature"
+	// HeaderTimestamp contains the UNIX time the request was signed.
+	HeaderTimestamp = "X-Men-Timestamp"
+
+	signaturePrefix = "sha256="
+
+	DefaultMaxAttempts = 5
+	DefaultMinBackoff  = time.Second
+	DefaultMaxBackoff  = time.Minute
+	DefaultTimeout     = 10 * time.Second
+)
+
+var (
+	ErrDeliveryFailed   = errors.New("webhooks: delivery failed")
+	ErrInvalidSignature = errors.New("webhooks: invalid signature")
+)
+
+// DeliveryError is returned by Deliver if the delivery failed. It
+// matches ErrDeliveryFailed and wraps the error of the last attempt.
+type DeliveryError struct {
+	Err error
+}
+
+func (err *DeliveryError) Error() string {
+	return ErrDeliveryFailed.Error() + ": " + err.Err.Error()
+}
+
+func (err *DeliveryError) Unwrap() error {
+	return err.Err
+}
+
+func (err *DeliveryError) Is(target error) bool {
+	return target == ErrDeliveryFailed
+}
+
+// Sign computes the signature of the body sent at timestamp. The signed
+// message is the decimal timestamp and the body separated by a '.'.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of the body sent at timestamp.
+func Verify(secret []byte, timestamp int64, body []byte, signature string) error {
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Target is the customer configured webhook endpoint.
+type Target struct {
+	// TenantID is the tenant owning the webhook; deliveries are rate
+	// limited per tenant.
+	TenantID string
+	// URL is the URL the payload is POSTed to.
+	URL string
+	// Secret is the key used for signing the request. The request is
+	// not signed if the secret is empty.
+	Secret []byte
+	// Header contains additional request headers.
+	Header http.Header
+}
+
+// Delivery describes a (failed) delivery passed to the DeadLetterFunc.
+type Delivery struct {
+	Target Target
+	// Body is the JSON encoded payload.
+	Body []byte
+	// Attempts is the number of delivery attempts.
+	Attempts int
+	// StatusCode is the status code of the last response or zero if no
+	// response was received.
+	StatusCode int
+}
+
+// DeadLetterFunc is called when a payload could not be delivered after
+// exhausting all attempts or encountering a permanent error.
+type DeadLetterFunc func(ctx context.Context, delivery *Delivery, err error)
+
+type Options struct {
+	// Client is the HTTP client used for delivering the requests
+	// (default: NewClient()). Custom clients must not connect to
+	// internal services on behalf of the customers.
+	Client *http.Client
+	// MaxAttempts is the maximum number of delivery attempts
+	// (default: DefaultMaxAttempts).
+	MaxAttempts *int
+	// MinBackoff is the delay before the first retry. The delay doubles
+	// for every retry (default: DefaultMinBackoff).
+	MinBackoff *time.Duration
+	// MaxBackoff limits the delay between retries
+	// (default: DefaultMaxBackoff).
+	MaxBackoff *time.Duration
+	// RatePerTenant limits the number of requests per second per tenant.
+	// A value of zero disables rate limiting (default).
+	RatePerTenant *float64
+	// Burst is the number of requests a tenant can make in a burst
+	// exceeding RatePerTenant (default: 1).
+	Burst *int
+	// DeadLetter is called for deliveries that failed.
+	DeadLetter DeadLetterFunc
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetClient(client *http.Client) *Options {
+	opts.Client = client
+	return opts
+}
+
+func (opts *Options) SetMaxAttempts(attempts int) *Options {
+	opts.MaxAttempts = &attempts
+	return opts
+}
+
+func (opts *Options) SetMinBackoff(backoff time.Duration) *Options {
+	opts.MinBackoff = &backoff
+	return opts
+}
+
+func (opts *Options) SetMaxBackoff(backoff time.Duration) *Options {
+	opts.MaxBackoff = &backoff
+	return opts
+}
+
+func (opts *Options) SetRatePerTenant(rate float64) *Options {
+	opts.RatePerTenant = &rate
+	return opts
+}
+
+func (opts *Options) SetBurst(burst int) *Options {
+	opts.Burst = &burst
+	return opts
+}
+
+func (opts *Options) SetDeadLetter(deadLetter DeadLetterFunc) *Options {
+	opts.DeadLetter = deadLetter
+	return opts
+}
+
+// Deliverer delivers webhook payloads.
+type Deliverer struct {
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	deadLetter  DeadLetterFunc
+	limiter     *tenantLimiter
+}
+
+// NewDeliverer creates a new Deliverer.
+func NewDeliverer(opts ...*Options) *Deliverer {
+	opt := NewOptions().
+		SetClient(NewClient()).
+		SetMaxAttempts(DefaultMaxAttempts).
+		SetMinBackoff(DefaultMinBackoff).
+		SetMaxBackoff(DefaultMaxBackoff).
+		SetRatePerTenant(0).
+		SetBurst(1)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Client != nil {
+			opt.Client = o.Client
+		}
+		if o.MaxAttempts != nil {
+			opt.MaxAttempts = o.MaxAttempts
+		}
+		if o.MinBackoff != nil {
+			opt.MinBackoff = o.MinBackoff
+		}
+		if o.MaxBackoff != nil {
+			opt.MaxBackoff = o.MaxBackoff
+		}
+		if o.RatePerTenant != nil {
+			opt.RatePerTenant = o.RatePerTenant
+		}
+		if o.Burst != nil {
+			opt.Burst = o.Burst
+		}
+		if o.DeadLetter != nil {
+			opt.DeadLetter = o.DeadLetter
+		}
+	}
+	d := &Deliverer{
+		client:      opt.Client,
+		maxAttempts: *opt.MaxAttempts,
+		minBackoff:  *opt.MinBackoff,
+		maxBackoff:  *opt.MaxBackoff,
+		deadLetter:  opt.DeadLetter,
+	}
+	if d.maxAttempts < 1 {
+		d.maxAttempts = 1
+	}
+	if *opt.RatePerTenant > 0 {
+		d.limiter = newTenantLimiter(*opt.RatePerTenant, *opt.Burst)
+	}
+	return d
+}
+
+// Deliver encodes payload as JSON and POSTs it to the target. Failed
+// attempts (network errors, 408, 429 and 5xx responses) are retried with
+// exponential backoff; other responses are considered permanent errors.
+// If the delivery fails, the DeadLetterFunc is called and a
+// *DeliveryError is returned.
+func (d *Deliverer) Deliver(ctx context.Context, target Target, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "webhooks: failed to encode payload")
+	}
+	delivery := &Delivery{
+		Target: target,
+		Body:   body,
+	}
+	err = d.deliver(ctx, delivery)
+	if err != nil {
+		err = &DeliveryError{Err: err}
+		if d.deadLetter != nil {
+			d.deadLetter(ctx, delivery, err)
+		}
+	}
+	return err
+}
+
+func (d *Deliverer) deliver(ctx context.Context, delivery *Delivery) error {
+	backoff := d.minBackoff
+	for {
+		if d.limiter != nil {
+			err := d.limiter.wait(ctx, delivery.Target.TenantID)
+			if err != nil {
+				return err
+			}
+		}
+		delivery.Attempts++
+		retryAfter, err := d.attempt(ctx, delivery)
+		if err == nil {
+			return nil
+		} else if retryAfter < 0 || delivery.Attempts >= d.maxAttempts {
+			return err
+		}
+		delay := backoff
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if delay > d.maxBackoff {
+			delay = d.maxBackoff
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// attempt makes a single delivery attempt. A negative retryAfter signals
+// that the error is permanent.
+func (d *Deliverer) attempt(
+	ctx context.Context,
+	delivery *Delivery,
+) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx,
+		http.MethodPost, delivery.Target.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return -1, err
+	}
+	for key, values := range delivery.Target.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(delivery.Target.Secret) > 0 {
+		timestamp := clock.Now(ctx).Unix()
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(HeaderSignature,
+			Sign(delivery.Target.Secret, timestamp, delivery.Body))
+	}
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		} else if errors.Is(err, ErrForbiddenAddress) {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(rsp.Body, 4096))
+	delivery.StatusCode = rsp.StatusCode
+	switch {
+	case rsp.StatusCode >= 200 && rsp.StatusCode < 300:
+		return 0, nil
+	case rsp.StatusCode == http.StatusTooManyRequests,
+		rsp.StatusCode == http.StatusServiceUnavailable:
+		retryAfter = parseRetryAfter(rsp.Header.Get("Retry-After"))
+	case rsp.StatusCode == http.StatusRequestTimeout,
+		rsp.StatusCode >= 500:
+	default:
+		retryAfter = -1
+	}
+	return retryAfter, fmt.Errorf("unexpected status code %d", rsp.StatusCode)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tenantLimiter is a token bucket rate limiter per tenant. Buckets which
+// refilled completely are evicted, they are equal to new buckets.
+type tenantLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	evicted time.Time
+}
+
+func newTenantLimiter(rate float64, burst int) *tenantLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tenantLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// reserve takes a token from the tenant's bucket and returns the time to
+// wait before the token is available.
+func (l *tenantLimiter) reserve(tenantID string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evict(now)
+	bucket, ok := l.buckets[tenantID]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[tenantID] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	bucket.last = now
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / l.rate * float64(time.Second))
+}
+
+// evict removes the full buckets, at most once per the refill time of
+// an empty bucket.
+func (l *tenantLimiter) evict(now time.Time) {
+	if now.Sub(l.evicted).Seconds()*l.rate < l.burst {
+		return
+	}
+	l.evicted = now
+	for tenantID, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, tenantID)
+		}
+	}
+}
+
+func (l *tenantLimiter) wait(ctx context.Context, tenantID string) error {
+	delay := l.reserve(tenantID)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
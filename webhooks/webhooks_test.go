@@ -0,0 +1,185 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+	secret := []byte("secret")
+	body := []byte(`{"foo":"bar"}`)
+	sig := Sign(secret, 1700000000, body)
+	assert.Regexp(t, "^sha256=[0-9a-f]{64}$", sig)
+	assert.NoError(t, Verify(secret, 1700000000, body, sig))
+	assert.ErrorIs(t,
+		Verify(secret, 1700000001, body, sig),
+		ErrInvalidSignature)
+	assert.ErrorIs(t,
+		Verify([]byte("other"), 1700000000, body, sig),
+		ErrInvalidSignature)
+}
+
+func TestDeliver(t *testing.T) {
+	t.Parallel()
+	secret := []byte("secret")
+	testCases := []struct {
+		Name string
+
+		Responses []int
+
+		Attempts   int
+		Error      error
+		DeadLetter bool
+	}{{
+		Name:      "ok",
+		Responses: []int{http.StatusNoContent},
+		Attempts:  1,
+	}, {
+		Name: "ok, after retries",
+		Responses: []int{
+			http.StatusBadGateway,
+			http.StatusTooManyRequests,
+			http.StatusOK,
+		},
+		Attempts: 3,
+	}, {
+		Name: "error, attempts exhausted",
+		Responses: []int{
+			http.StatusInternalServerError,
+			http.StatusInternalServerError,
+			http.StatusInternalServerError,
+		},
+		Attempts:   3,
+		Error:      ErrDeliveryFailed,
+		DeadLetter: true,
+	}, {
+		Name:       "error, permanent",
+		Responses:  []int{http.StatusNotFound},
+		Attempts:   1,
+		Error:      ErrDeliveryFailed,
+		DeadLetter: true,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					n := atomic.AddInt32(&calls, 1)
+					body, _ := io.ReadAll(r.Body)
+					assert.Equal(t, `{"foo":"bar"}`, string(body))
+					assert.Equal(t, "value", r.Header.Get("X-Custom"))
+					ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+					assert.NoError(t, err)
+					assert.NoError(t, Verify(secret, ts, body,
+						r.Header.Get(HeaderSignature)))
+					w.WriteHeader(tc.Responses[n-1])
+				}))
+			defer srv.Close()
+
+			var deadLetter *Delivery
+			d := NewDeliverer(NewOptions().
+				SetClient(srv.Client()).
+				SetMaxAttempts(3).
+				SetMinBackoff(time.Millisecond).
+				SetMaxBackoff(time.Millisecond * 5).
+				SetDeadLetter(func(_ context.Context, d *Delivery, err error) {
+					assert.ErrorIs(t, err, ErrDeliveryFailed)
+					assert.Contains(t, err.Error(), "unexpected status code")
+					deadLetter = d
+				}))
+			err := d.Deliver(context.Background(), Target{
+				TenantID: "tenant",
+				URL:      srv.URL,
+				Secret:   secret,
+				Header:   http.Header{"X-Custom": []string{"value"}},
+			}, map[string]string{"foo": "bar"})
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.Attempts, int(atomic.LoadInt32(&calls)))
+			if tc.DeadLetter {
+				if assert.NotNil(t, deadLetter) {
+					assert.Equal(t, tc.Attempts, deadLetter.Attempts)
+					assert.Equal(t,
+						tc.Responses[tc.Attempts-1],
+						deadLetter.StatusCode)
+				}
+			} else {
+				assert.Nil(t, deadLetter)
+			}
+		})
+	}
+}
+
+func TestDeliverRateLimit(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	defer srv.Close()
+
+	d := NewDeliverer(NewOptions().
+		SetClient(srv.Client()).
+		SetRatePerTenant(20).
+		SetBurst(1))
+	target := Target{TenantID: "tenant", URL: srv.URL}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, d.Deliver(context.Background(), target, "ping"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*90)
+
+	// Other tenants are not affected.
+	start = time.Now()
+	assert.NoError(t, d.Deliver(context.Background(),
+		Target{TenantID: "other", URL: srv.URL}, "ping"))
+	assert.Less(t, time.Since(start), time.Millisecond*50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := d.Deliver(ctx, target, "ping")
+	assert.ErrorIs(t, err, ErrDeliveryFailed)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTenantLimiterEviction(t *testing.T) {
+	t.Parallel()
+	l := newTenantLimiter(1000, 1)
+	for _, tenantID := range []string{"a", "b", "c"} {
+		l.reserve(tenantID)
+	}
+	time.Sleep(5 * time.Millisecond)
+	l.reserve("d")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Len(t, l.buckets, 1, "idle buckets are evicted")
+	assert.Contains(t, l.buckets, "d")
+}
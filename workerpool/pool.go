@@ -0,0 +1,350 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package workerpool implements a bounded pool of goroutines processing
+// tasks from a bounded queue.
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+)
+
+const (
+	DefaultQueueSize = 128
+)
+
+var (
+	ErrPoolClosed = errors.New("workerpool: pool is closed")
+	ErrQueueFull  = errors.New("workerpool: queue is full")
+)
+
+// Task is a unit of work executed by the pool.
+type Task func(ctx context.Context) error
+
+// PanicError is passed to the ErrorHandler when a task panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("workerpool: task panicked: %v", err.Value)
+}
+
+// ErrorHandler is called with the task context when a task returns an
+// error or panics.
+type ErrorHandler func(ctx context.Context, err error)
+
+func logError(ctx context.Context, err error) {
+	l := log.FromContext(ctx)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		l.WithField("trace", string(panicErr.Stack)).Error(err.Error())
+		return
+	}
+	l.Error(err.Error())
+}
+
+type Options struct {
+	// Workers is the number of goroutines processing tasks
+	// (default: runtime.NumCPU()).
+	Workers *int
+	// QueueSize is the number of tasks that can be queued waiting for a
+	// worker (default: DefaultQueueSize).
+	QueueSize *int
+	// TaskTimeout sets a deadline on the task context. A value of zero
+	// disables the timeout (default).
+	TaskTimeout *time.Duration
+	// ErrorHandler handles task errors and panics (default: log the error
+	// using the logger from the task context).
+	ErrorHandler ErrorHandler
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetWorkers(workers int) *Options {
+	opts.Workers = &workers
+	return opts
+}
+
+func (opts *Options) SetQueueSize(size int) *Options {
+	opts.QueueSize = &size
+	return opts
+}
+
+func (opts *Options) SetTaskTimeout(timeout time.Duration) *Options {
+	opts.TaskTimeout = &timeout
+	return opts
+}
+
+func (opts *Options) SetErrorHandler(handler ErrorHandler) *Options {
+	opts.ErrorHandler = handler
+	return opts
+}
+
+// Stats is a snapshot of the pool gauges and counters.
+type Stats struct {
+	// Workers is the number of workers in the pool.
+	Workers int
+	// QueueCapacity is the maximum number of queued tasks.
+	QueueCapacity int
+	// Queued is the number of tasks waiting for a worker.
+	Queued int
+	// Running is the number of tasks currently executing.
+	Running int64
+	// Completed is the number of tasks that returned without error.
+	Completed int64
+	// Failed is the number of tasks that returned an error.
+	Failed int64
+	// Panicked is the number of tasks that panicked.
+	Panicked int64
+}
+
+type queuedTask struct {
+	ctx  context.Context
+	task Task
+}
+
+// Pool is a bounded worker pool.
+type Pool struct {
+	// counters are accessed atomically, keep them 64-bit aligned.
+	running   int64
+	completed int64
+	failed    int64
+	panicked  int64
+
+	workers      int
+	taskTimeout  time.Duration
+	errorHandler ErrorHandler
+
+	queue   chan queuedTask
+	quit    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	drained chan struct{}
+
+	mu         sync.RWMutex
+	closed     bool
+	submitters sync.WaitGroup
+}
+
+// New creates a new pool and starts the workers.
+func New(opts ...*Options) *Pool {
+	opt := NewOptions().
+		SetWorkers(runtime.NumCPU()).
+		SetQueueSize(DefaultQueueSize).
+		SetTaskTimeout(0).
+		SetErrorHandler(logError)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Workers != nil {
+			opt.Workers = o.Workers
+		}
+		if o.QueueSize != nil {
+			opt.QueueSize = o.QueueSize
+		}
+		if o.TaskTimeout != nil {
+			opt.TaskTimeout = o.TaskTimeout
+		}
+		if o.ErrorHandler != nil {
+			opt.ErrorHandler = o.ErrorHandler
+		}
+	}
+	workers := *opt.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := *opt.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		workers:      workers,
+		taskTimeout:  *opt.TaskTimeout,
+		errorHandler: opt.ErrorHandler,
+		queue:        make(chan queuedTask, queueSize),
+		quit:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		drained:      make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.drained)
+	}()
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t queuedTask) {
+	ctx := t.ctx
+	var cancel context.CancelFunc
+	if p.taskTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.taskTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	atomic.AddInt64(&p.running, 1)
+	defer atomic.AddInt64(&p.running, -1)
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&p.panicked, 1)
+			p.errorHandler(ctx, &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			})
+		}
+	}()
+	if err := t.task(ctx); err != nil {
+		atomic.AddInt64(&p.failed, 1)
+		p.errorHandler(ctx, err)
+	} else {
+		atomic.AddInt64(&p.completed, 1)
+	}
+}
+
+// taskContext carries the values of the submitting context while being
+// canceled only by the pool; the task outlives the submitter (e.g. the
+// HTTP request).
+type taskContext struct {
+	context.Context
+	values context.Context
+}
+
+func (ctx taskContext) Value(key interface{}) interface{} {
+	if v := ctx.values.Value(key); v != nil {
+		return v
+	}
+	return ctx.Context.Value(key)
+}
+
+func (p *Pool) enqueue(
+	ctx context.Context,
+	task Task,
+	block bool,
+) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPoolClosed
+	}
+	p.submitters.Add(1)
+	p.mu.RUnlock()
+	defer p.submitters.Done()
+
+	t := queuedTask{
+		ctx:  taskContext{Context: p.ctx, values: ctx},
+		task: task,
+	}
+	if !block {
+		select {
+		case p.queue <- t:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	}
+	select {
+	case p.queue <- t:
+		return nil
+	case <-p.quit:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Submit queues the task, blocking while the queue is full until the
+// context is done or the pool shuts down. The task context carries the
+// values from ctx, but is not canceled with ctx.
+func (p *Pool) Submit(ctx context.Context, task Task) error {
+	return p.enqueue(ctx, task, true)
+}
+
+// TrySubmit queues the task without blocking. It returns ErrQueueFull if
+// the queue is full.
+func (p *Pool) TrySubmit(ctx context.Context, task Task) error {
+	return p.enqueue(ctx, task, false)
+}
+
+// QueueLength returns the number of tasks waiting for a worker.
+func (p *Pool) QueueLength() int {
+	return len(p.queue)
+}
+
+// Stats returns a snapshot of the pool gauges and counters.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Workers:       p.workers,
+		QueueCapacity: cap(p.queue),
+		Queued:        len(p.queue),
+		Running:       atomic.LoadInt64(&p.running),
+		Completed:     atomic.LoadInt64(&p.completed),
+		Failed:        atomic.LoadInt64(&p.failed),
+		Panicked:      atomic.LoadInt64(&p.panicked),
+	}
+}
+
+// Shutdown stops accepting new tasks and waits for the queued and running
+// tasks to finish. If ctx is done before the pool is drained, the context
+// of the remaining tasks is canceled and ctx.Err() is returned; the
+// queued tasks are still executed (with a canceled context).
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.quit)
+		go func() {
+			p.submitters.Wait()
+			close(p.queue)
+		}()
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.drained:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	p := New(NewOptions().
+		SetWorkers(2).
+		SetQueueSize(4).
+		SetErrorHandler(func(ctx context.Context, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}))
+
+	reqCtx, cancelReq := context.WithCancel(
+		context.WithValue(context.Background(), ctxKey{}, "value"))
+	var executed int32
+	err := p.Submit(reqCtx, func(ctx context.Context) error {
+		// Values are propagated, but not the cancellation.
+		assert.Equal(t, "value", ctx.Value(ctxKey{}))
+		assert.NoError(t, ctx.Err())
+		atomic.AddInt32(&executed, 1)
+		return nil
+	})
+	cancelReq()
+	assert.NoError(t, err)
+	assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+		atomic.AddInt32(&executed, 1)
+		return errors.New("task failed")
+	}))
+	assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+		atomic.AddInt32(&executed, 1)
+		panic("oh no")
+	}))
+	assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+		atomic.AddInt32(&executed, 1)
+		return nil
+	}))
+
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&executed))
+	assert.Equal(t, Stats{
+		Workers:       2,
+		QueueCapacity: 4,
+		Completed:     2,
+		Failed:        1,
+		Panicked:      1,
+	}, p.Stats())
+	if assert.Len(t, errs, 2) {
+		var panicErr *PanicError
+		for _, err := range errs {
+			if errors.As(err, &panicErr) {
+				break
+			}
+		}
+		if assert.NotNil(t, panicErr) {
+			assert.Equal(t, "oh no", panicErr.Value)
+			assert.NotEmpty(t, panicErr.Stack)
+		}
+	}
+
+	assert.ErrorIs(t,
+		p.Submit(context.Background(), func(context.Context) error { return nil }),
+		ErrPoolClosed)
+}
+
+func TestPoolBackPressure(t *testing.T) {
+	t.Parallel()
+	p := New(NewOptions().
+		SetWorkers(1).
+		SetQueueSize(1))
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+	assert.NoError(t, p.Submit(context.Background(), blocking))
+	<-started
+	assert.NoError(t, p.TrySubmit(context.Background(), blocking))
+	assert.Equal(t, 1, p.QueueLength())
+	assert.Equal(t, int64(1), p.Stats().Running)
+
+	assert.ErrorIs(t, p.TrySubmit(context.Background(), blocking), ErrQueueFull)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.ErrorIs(t, p.Submit(ctx, blocking), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, int64(2), p.Stats().Completed)
+}
+
+func TestPoolShutdownTimeout(t *testing.T) {
+	t.Parallel()
+	p := New(NewOptions().SetWorkers(1))
+	started := make(chan struct{})
+	var canceled int32
+	assert.NoError(t, p.Submit(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&canceled, 1)
+		return ctx.Err()
+	}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.ErrorIs(t, p.Shutdown(ctx), context.DeadlineExceeded)
+
+	// The task context is canceled on forced shutdown.
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&canceled))
+}
+
+func TestPoolTaskTimeout(t *testing.T) {
+	t.Parallel()
+	p := New(NewOptions().
+		SetWorkers(1).
+		SetTaskTimeout(time.Millisecond * 10).
+		SetErrorHandler(func(context.Context, error) {}))
+	assert.NoError(t, p.Submit(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	assert.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, int64(1), p.Stats().Failed)
+}
@@ -0,0 +1,327 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+	rest "github.com/mendersoftware/go-lib-micro/rest.utils"
+)
+
+const (
+	// TokenProtocolPrefix prefixes the JWT passed in the
+	// Sec-WebSocket-Protocol header by browsers, which cannot set the
+	// Authorization header on websocket requests. The server must not
+	// echo this protocol in the handshake response.
+	TokenProtocolPrefix = "bearer.authorization.mender.io."
+
+	protocolHeader = "Sec-WebSocket-Protocol"
+)
+
+var (
+	ErrNoToken          = errors.New("ws: authorization token not present")
+	ErrDeviceNotInScope = errors.New("ws: device is not in the RBAC scope")
+	ErrTokenNotVerified = errors.New(
+		"ws: tokens of the Sec-WebSocket-Protocol header require Issuers")
+	ErrScopeUnknown = errors.New("ws: the RBAC scope of the user is unknown")
+)
+
+// AuthError is returned by Authenticate with the HTTP status to reject the
+// upgrade request with.
+type AuthError struct {
+	Status int
+	Err    error
+}
+
+func (err *AuthError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *AuthError) Unwrap() error {
+	return err.Err
+}
+
+// DeviceGroupsFunc returns the groups of the device, e.g. from the
+// inventory. The context carries the identity and the RBAC scope of the
+// request.
+type DeviceGroupsFunc func(ctx context.Context, deviceID string) ([]string, error)
+
+// ScopeFunc returns the RBAC scope of the identity of the context, e.g.
+// from the user administration; a nil scope is unrestricted.
+type ScopeFunc func(ctx context.Context) (*rbac.Scope, error)
+
+type AuthOptions struct {
+	// Issuers verifies the tokens. Without Issuers, the tokens of the
+	// Authorization header and the JWT cookie are decoded assuming the
+	// gateway already verified them, and the tokens passed in the
+	// Sec-WebSocket-Protocol header, which the gateway does not verify,
+	// are rejected with ErrTokenNotVerified.
+	Issuers *identity.Issuers
+	// TokenCache caches the identities of recently seen tokens.
+	TokenCache *identity.TokenCache
+	// DeviceGroups looks up the groups of the target device if the
+	// RBAC scope of the user is restricted to device groups. Without it,
+	// users with a restricted scope are rejected.
+	DeviceGroups DeviceGroupsFunc
+	// Scope computes the RBAC scope of the users authenticated with
+	// tokens of the Sec-WebSocket-Protocol header; these requests bypass
+	// the gateway, which sets the scope headers otherwise. Without it,
+	// such users are rejected with ErrScopeUnknown.
+	Scope ScopeFunc
+	// UpdateLogger adds the identity to the log context (default: true).
+	UpdateLogger *bool
+}
+
+func NewAuthOptions() *AuthOptions {
+	return new(AuthOptions)
+}
+
+func (opts *AuthOptions) SetIssuers(issuers *identity.Issuers) *AuthOptions {
+	opts.Issuers = issuers
+	return opts
+}
+
+func (opts *AuthOptions) SetTokenCache(cache *identity.TokenCache) *AuthOptions {
+	opts.TokenCache = cache
+	return opts
+}
+
+func (opts *AuthOptions) SetDeviceGroups(fn DeviceGroupsFunc) *AuthOptions {
+	opts.DeviceGroups = fn
+	return opts
+}
+
+func (opts *AuthOptions) SetScope(fn ScopeFunc) *AuthOptions {
+	opts.Scope = fn
+	return opts
+}
+
+func (opts *AuthOptions) SetUpdateLogger(updateLogger bool) *AuthOptions {
+	opts.UpdateLogger = &updateLogger
+	return opts
+}
+
+func mergeAuthOptions(opts ...*AuthOptions) *AuthOptions {
+	opt := NewAuthOptions().
+		SetUpdateLogger(true)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.Issuers != nil {
+			opt.Issuers = o.Issuers
+		}
+		if o.TokenCache != nil {
+			opt.TokenCache = o.TokenCache
+		}
+		if o.DeviceGroups != nil {
+			opt.DeviceGroups = o.DeviceGroups
+		}
+		if o.Scope != nil {
+			opt.Scope = o.Scope
+		}
+		if o.UpdateLogger != nil {
+			opt.UpdateLogger = o.UpdateLogger
+		}
+	}
+	return opt
+}
+
+var protocolTokenSource = identity.WebSocketProtocolToken(TokenProtocolPrefix)
+
+// TokenSource extracts the JWT of the upgrade requests from the
+// Authorization header or the JWT cookie, falling back to the
+// Sec-WebSocket-Protocol entry prefixed by TokenProtocolPrefix or
+// following the identity.WebSocketBearerProtocol.
+var TokenSource = identity.TokenSources(
+	identity.DefaultTokenSource,
+	protocolTokenSource,
+)
+
+// ExtractToken returns the JWT of the upgrade request, see TokenSource.
+func ExtractToken(r *http.Request) (string, error) {
+	jwt, _, err := extractToken(r)
+	return jwt, err
+}
+
+// extractToken returns the JWT of the upgrade request and whether it was
+// passed in the Sec-WebSocket-Protocol header.
+func extractToken(r *http.Request) (jwt string, fromProtocol bool, err error) {
+	jwt, err = identity.DefaultTokenSource.ExtractToken(r)
+	if errors.Is(err, identity.ErrNoToken) {
+		fromProtocol = true
+		jwt, err = protocolTokenSource.ExtractToken(r)
+	}
+	if errors.Is(err, identity.ErrNoToken) {
+		return "", false, ErrNoToken
+	}
+	return jwt, fromProtocol, err
+}
+
+func authorizeDevice(
+	ctx context.Context,
+	id *identity.Identity,
+	scope *rbac.Scope,
+	deviceID string,
+	deviceGroups DeviceGroupsFunc,
+) error {
+	if deviceID == "" {
+		return nil
+	}
+	if id.IsDevice {
+		if id.Subject != deviceID {
+			return &AuthError{
+				Status: http.StatusForbidden,
+				Err:    errors.New("ws: devices can only connect as themselves"),
+			}
+		}
+		return nil
+	}
+	if scope == nil || scope.DeviceGroups == nil {
+		return nil
+	}
+	if deviceGroups == nil {
+		return &AuthError{Status: http.StatusForbidden, Err: ErrDeviceNotInScope}
+	}
+	groups, err := deviceGroups(ctx, deviceID)
+	if err != nil {
+		return &AuthError{
+			Status: http.StatusInternalServerError,
+			Err:    fmt.Errorf("ws: failed to look up device groups: %w", err),
+		}
+	}
+	for _, group := range groups {
+		for _, allowed := range scope.DeviceGroups {
+			if group == allowed {
+				return nil
+			}
+		}
+	}
+	return &AuthError{Status: http.StatusForbidden, Err: ErrDeviceNotInScope}
+}
+
+// Authenticate authenticates the websocket upgrade request targeting the
+// device (which may be empty if the connection is not bound to a device),
+// checking that the RBAC device group scope of the request includes the
+// device. It returns the request context with the identity and the scope,
+// to be passed to the Connection with ConnectionOptions.SetContext.
+// Errors are *AuthError.
+func Authenticate(
+	r *http.Request,
+	deviceID string,
+	opts ...*AuthOptions,
+) (context.Context, error) {
+	opt := mergeAuthOptions(opts...)
+	return authenticate(r, deviceID, opt,
+		identity.NewTokenParser(opt.TokenCache, opt.Issuers))
+}
+
+func authenticate(
+	r *http.Request,
+	deviceID string,
+	opt *AuthOptions,
+	parse func(string) (identity.Identity, error),
+) (context.Context, error) {
+	ctx := r.Context()
+	jwt, fromProtocol, err := extractToken(r)
+	if err != nil {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Err: err}
+	} else if fromProtocol && opt.Issuers == nil {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Err: ErrTokenNotVerified}
+	}
+	id, err := parse(jwt)
+	if err != nil {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Err: err}
+	}
+	// The scope and device groups lookups may be scoped to the tenant of
+	// the identity.
+	ctx = identity.WithContext(ctx, &id)
+	var scope *rbac.Scope
+	if !fromProtocol {
+		scope = rbac.ScopeFromRequest(r)
+	} else if !id.IsDevice {
+		// The scope headers are not set by the gateway.
+		if opt.Scope == nil {
+			return nil, &AuthError{Status: http.StatusForbidden, Err: ErrScopeUnknown}
+		}
+		scope, err = opt.Scope(ctx)
+		if err != nil {
+			return nil, &AuthError{
+				Status: http.StatusInternalServerError,
+				Err:    fmt.Errorf("ws: failed to look up the RBAC scope: %w", err),
+			}
+		}
+	}
+	if scope != nil {
+		ctx = rbac.WithContext(ctx, scope)
+	}
+	err = authorizeDevice(ctx, &id, scope, deviceID, opt.DeviceGroups)
+	if err != nil {
+		return nil, err
+	}
+	if *opt.UpdateLogger {
+		fields := log.Ctx{}
+		if id.IsDevice {
+			fields["device_id"] = id.Subject
+		} else if id.IsUser {
+			fields["user_id"] = id.Subject
+		} else {
+			fields["sub"] = id.Subject
+		}
+		if id.Tenant != "" {
+			fields["tenant_id"] = id.Tenant
+		}
+		ctx = log.WithContext(ctx, log.FromContext(ctx).F(fields))
+	}
+	return ctx, nil
+}
+
+// AuthMiddleware authenticates websocket upgrade requests with
+// Authenticate, taking the device ID from the path parameter deviceParam
+// (if not empty). Rejected requests are aborted with the status of the
+// AuthError.
+func AuthMiddleware(deviceParam string, opts ...*AuthOptions) gin.HandlerFunc {
+	opt := mergeAuthOptions(opts...)
+	parse := identity.NewTokenParser(opt.TokenCache, opt.Issuers)
+	return func(c *gin.Context) {
+		var deviceID string
+		if deviceParam != "" {
+			deviceID = c.Param(deviceParam)
+		}
+		ctx, err := authenticate(c.Request, deviceID, opt, parse)
+		if err != nil {
+			status := http.StatusUnauthorized
+			var authErr *AuthError
+			if errors.As(err, &authErr) {
+				status = authErr.Status
+			}
+			if status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", `Bearer realm="ManagementJWT"`)
+			}
+			rest.RenderError(c, status, err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/rbac"
+)
+
+var testIssuerKey = func() ed25519.PrivateKey {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	return key
+}()
+
+func signTestToken(id identity.Identity) string {
+	claims, _ := json.Marshal(struct {
+		identity.Identity
+		Issuer    string `json:"iss"`
+		ExpiresAt int64  `json:"exp"`
+	}{id, "Mender", time.Now().Add(time.Hour).Unix()})
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(
+		ed25519.Sign(testIssuerKey, []byte(signed)))
+}
+
+func makeTestToken(id identity.Identity) string {
+	claims, _ := json.Marshal(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+}
+
+func TestExtractToken(t *testing.T) {
+	t.Parallel()
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/ws", nil)
+	_, err := ExtractToken(req)
+	assert.ErrorIs(t, err, ErrNoToken)
+
+	req.Header.Add(protocolHeader, "protomsg, "+TokenProtocolPrefix+"a.b.c")
+	jwt, err := ExtractToken(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.b.c", jwt)
+
+	req.Header.Set(protocolHeader, "protomsg, bearer, g.h.i")
+	jwt, err = ExtractToken(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "g.h.i", jwt)
+
+	req.Header.Set("Authorization", "Bearer d.e.f")
+	jwt, err = ExtractToken(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "d.e.f", jwt)
+
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	_, err = ExtractToken(req)
+	assert.Error(t, err)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Parallel()
+	user := makeTestToken(identity.Identity{Subject: "user-1", Tenant: "tenant", IsUser: true})
+	device := makeTestToken(identity.Identity{Subject: "dev-1", Tenant: "tenant", IsDevice: true})
+	groups := map[string][]string{
+		"dev-1": {"production"},
+		"dev-2": {"testing"},
+	}
+	issuers, _ := identity.NewIssuers(&identity.Issuer{
+		Name: "Mender",
+		Keys: identity.StaticKeySet{"": testIssuerKey.Public()},
+	})
+	lookup := func(ctx context.Context, deviceID string) ([]string, error) {
+		if deviceID == "broken" {
+			return nil, errors.New("inventory unavailable")
+		}
+		if id := identity.FromContext(ctx); id == nil || id.Tenant != "tenant" {
+			return nil, errors.New("lookup without tenant")
+		}
+		return groups[deviceID], nil
+	}
+	unrestricted := func(ctx context.Context) (*rbac.Scope, error) {
+		return nil, nil
+	}
+	restricted := func(ctx context.Context) (*rbac.Scope, error) {
+		if id := identity.FromContext(ctx); id == nil || id.Subject != "user-1" {
+			return nil, errors.New("lookup without identity")
+		}
+		return &rbac.Scope{DeviceGroups: []string{"testing"}}, nil
+	}
+	protocolUser := signTestToken(
+		identity.Identity{Subject: "user-1", Tenant: "tenant", IsUser: true})
+	testCases := []struct {
+		Name     string
+		Options  *AuthOptions
+		Device   string
+		Header   http.Header
+		Expected int
+	}{{
+		Name:     "no token",
+		Device:   "dev-1",
+		Expected: http.StatusUnauthorized,
+	}, {
+		Name:     "malformed token",
+		Device:   "dev-1",
+		Header:   http.Header{"Authorization": {"Bearer garbage"}},
+		Expected: http.StatusUnauthorized,
+	}, {
+		Name:     "unrestricted user",
+		Device:   "dev-2",
+		Header:   http.Header{"Authorization": {"Bearer " + user}},
+		Expected: http.StatusOK,
+	}, {
+		Name:    "browser subprotocol token",
+		Options: NewAuthOptions().SetIssuers(issuers).SetScope(unrestricted),
+		Device:  "dev-1",
+		Header: http.Header{
+			protocolHeader: {"protomsg, " + TokenProtocolPrefix + protocolUser},
+		},
+		Expected: http.StatusOK,
+	}, {
+		Name:    "subprotocol token without scope",
+		Options: NewAuthOptions().SetIssuers(issuers),
+		Device:  "dev-1",
+		Header: http.Header{
+			protocolHeader: {"protomsg, " + TokenProtocolPrefix + protocolUser},
+		},
+		Expected: http.StatusForbidden,
+	}, {
+		Name: "subprotocol token with restricted scope",
+		Options: NewAuthOptions().SetIssuers(issuers).
+			SetScope(restricted).SetDeviceGroups(lookup),
+		Device: "dev-1",
+		Header: http.Header{
+			protocolHeader:   {"protomsg, " + TokenProtocolPrefix + protocolUser},
+			rbac.ScopeHeader: {"production"},
+		},
+		Expected: http.StatusForbidden,
+	}, {
+		Name:    "subprotocol device token",
+		Options: NewAuthOptions().SetIssuers(issuers),
+		Device:  "dev-1",
+		Header: http.Header{
+			protocolHeader: {"protomsg, " + TokenProtocolPrefix + signTestToken(
+				identity.Identity{Subject: "dev-1", Tenant: "tenant", IsDevice: true})},
+		},
+		Expected: http.StatusOK,
+	}, {
+		Name:    "forged subprotocol token",
+		Options: NewAuthOptions().SetIssuers(issuers),
+		Device:  "dev-1",
+		Header: http.Header{
+			protocolHeader: {"protomsg, " + TokenProtocolPrefix + user},
+		},
+		Expected: http.StatusUnauthorized,
+	}, {
+		Name:   "unverified subprotocol token",
+		Device: "dev-1",
+		Header: http.Header{
+			protocolHeader: {"protomsg, " + TokenProtocolPrefix + user},
+		},
+		Expected: http.StatusUnauthorized,
+	}, {
+		Name:    "device in scope",
+		Options: NewAuthOptions().SetDeviceGroups(lookup),
+		Device:  "dev-1",
+		Header: http.Header{
+			"Authorization":  {"Bearer " + user},
+			rbac.ScopeHeader: {"production,staging"},
+		},
+		Expected: http.StatusOK,
+	}, {
+		Name:    "device not in scope",
+		Options: NewAuthOptions().SetDeviceGroups(lookup),
+		Device:  "dev-2",
+		Header: http.Header{
+			"Authorization":  {"Bearer " + user},
+			rbac.ScopeHeader: {"production,staging"},
+		},
+		Expected: http.StatusForbidden,
+	}, {
+		Name:   "restricted scope without lookup",
+		Device: "dev-1",
+		Header: http.Header{
+			"Authorization":  {"Bearer " + user},
+			rbac.ScopeHeader: {"production"},
+		},
+		Expected: http.StatusForbidden,
+	}, {
+		Name:    "lookup error",
+		Options: NewAuthOptions().SetDeviceGroups(lookup),
+		Device:  "broken",
+		Header: http.Header{
+			"Authorization":  {"Bearer " + user},
+			rbac.ScopeHeader: {"production"},
+		},
+		Expected: http.StatusInternalServerError,
+	}, {
+		Name:     "device connecting as itself",
+		Device:   "dev-1",
+		Header:   http.Header{"Authorization": {"Bearer " + device}},
+		Expected: http.StatusOK,
+	}, {
+		Name:     "device connecting as another device",
+		Device:   "dev-2",
+		Header:   http.Header{"Authorization": {"Bearer " + device}},
+		Expected: http.StatusForbidden,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			router := gin.New()
+			router.GET("/devices/:id/connect", AuthMiddleware("id", tc.Options),
+				func(c *gin.Context) {
+					conn := NewConnection(newMockConn(),
+						NewConnectionOptions().SetContext(c.Request.Context()))
+					id := identity.FromContext(conn.Context())
+					if assert.NotNil(t, id) {
+						assert.Equal(t, "tenant", id.Tenant)
+					}
+					c.Status(http.StatusOK)
+				})
+			req, _ := http.NewRequest(http.MethodGet,
+				"http://localhost/devices/"+tc.Device+"/connect", nil)
+			for key, values := range tc.Header {
+				req.Header[http.CanonicalHeaderKey(key)] = values
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.Expected, w.Code)
+			if tc.Expected == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
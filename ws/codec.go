@@ -0,0 +1,395 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// DefaultMaxBodySize is the default maximum length of ProtoMsg.Body.
+	DefaultMaxBodySize = 4 * 1024 * 1024
+	// DefaultMaxProperties is the default maximum number of entries in
+	// ProtoHdr.Properties.
+	DefaultMaxProperties = 128
+	// DefaultMaxDepth is the default maximum nesting depth of maps and
+	// arrays in a ProtoMsg, counting the message itself.
+	DefaultMaxDepth = 16
+)
+
+var (
+	// ErrMalformedMessage is returned if the message is not valid msgpack.
+	ErrMalformedMessage = errors.New("ws: malformed message")
+
+	// ErrBodyTooLarge is returned if the message body exceeds MaxBodySize.
+	ErrBodyTooLarge = errors.New("ws: message body exceeds limit")
+	// ErrTooManyProperties is returned if the header properties exceeds
+	// MaxProperties.
+	ErrTooManyProperties = errors.New("ws: number of header properties exceeds limit")
+	// ErrMaxDepthExceeded is returned if the message nesting exceeds
+	// MaxDepth.
+	ErrMaxDepthExceeded = errors.New("ws: message nesting depth exceeds limit")
+)
+
+// LimitError is returned when a message exceeds one of the DecodeLimits.
+// The Err field contains one of ErrBodyTooLarge, ErrTooManyProperties or
+// ErrMaxDepthExceeded.
+type LimitError struct {
+	Err   error
+	Limit int
+	Size  int
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("%s (%d > %d)", err.Err.Error(), err.Size, err.Limit)
+}
+
+func (err *LimitError) Unwrap() error {
+	return err.Err
+}
+
+// DecodeLimits restricts the size and complexity of decoded ProtoMsgs.
+// A zero or negative value disables the respective limit.
+type DecodeLimits struct {
+	// MaxBodySize sets the maximum length of ProtoMsg.Body
+	// (default: DefaultMaxBodySize).
+	MaxBodySize *int
+	// MaxProperties sets the maximum number of entries in
+	// ProtoHdr.Properties (default: DefaultMaxProperties).
+	MaxProperties *int
+	// MaxDepth sets the maximum nesting depth of the message
+	// (default: DefaultMaxDepth).
+	MaxDepth *int
+}
+
+func NewDecodeLimits() *DecodeLimits {
+	return new(DecodeLimits)
+}
+
+func (l *DecodeLimits) SetMaxBodySize(size int) *DecodeLimits {
+	l.MaxBodySize = &size
+	return l
+}
+
+func (l *DecodeLimits) SetMaxProperties(n int) *DecodeLimits {
+	l.MaxProperties = &n
+	return l
+}
+
+func (l *DecodeLimits) SetMaxDepth(depth int) *DecodeLimits {
+	l.MaxDepth = &depth
+	return l
+}
+
+func mergeDecodeLimits(limits ...*DecodeLimits) *DecodeLimits {
+	ret := NewDecodeLimits().
+		SetMaxBodySize(DefaultMaxBodySize).
+		SetMaxProperties(DefaultMaxProperties).
+		SetMaxDepth(DefaultMaxDepth)
+	for _, l := range limits {
+		if l == nil {
+			continue
+		}
+		if l.MaxBodySize != nil {
+			ret.MaxBodySize = l.MaxBodySize
+		}
+		if l.MaxProperties != nil {
+			ret.MaxProperties = l.MaxProperties
+		}
+		if l.MaxDepth != nil {
+			ret.MaxDepth = l.MaxDepth
+		}
+	}
+	return ret
+}
+
+// UnmarshalProtoMsg decodes a msgpack encoded ProtoMsg. Before decoding, the
+// message structure is validated against the limits (merged with the
+// defaults) without allocating memory for the content, protecting the
+// caller from pathological payloads.
+func UnmarshalProtoMsg(data []byte, limits ...*DecodeLimits) (*ProtoMsg, error) {
+	l := mergeDecodeLimits(limits...)
+	s := &msgScanner{
+		data:          data,
+		maxBodySize:   *l.MaxBodySize,
+		maxProperties: *l.MaxProperties,
+		maxDepth:      *l.MaxDepth,
+	}
+	if err := s.scanMessage(); err != nil {
+		return nil, err
+	}
+	msg := new(ProtoMsg)
+	if err := msgpack.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedMessage, err.Error())
+	}
+	return msg, nil
+}
+
+type msgKind int
+
+const (
+	kindScalar msgKind = iota
+	kindNil
+	kindString
+	kindBinary
+	kindExt
+	kindArray
+	kindMap
+)
+
+// msgScanner walks the msgpack encoding of a ProtoMsg, validating the
+// structure against the limits.
+type msgScanner struct {
+	data []byte
+	pos  int
+
+	maxBodySize   int
+	maxProperties int
+	maxDepth      int
+}
+
+func (s *msgScanner) malformed(reason string) error {
+	return fmt.Errorf("%w: %s at offset %d", ErrMalformedMessage, reason, s.pos)
+}
+
+func (s *msgScanner) read(n int) ([]byte, error) {
+	if n < 0 || len(s.data)-s.pos < n {
+		return nil, s.malformed("unexpected end of data")
+	}
+	b := s.data[s.pos : s.pos+n]
+	s.pos += n
+	return b, nil
+}
+
+func (s *msgScanner) readUint(size int) (int, error) {
+	b, err := s.read(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	switch size {
+	case 1:
+		n = uint64(b[0])
+	case 2:
+		n = uint64(binary.BigEndian.Uint16(b))
+	case 4:
+		n = uint64(binary.BigEndian.Uint32(b))
+	}
+	if n > uint64(len(s.data)) {
+		// No length can exceed the size of the message.
+		return 0, s.malformed("length exceeds message size")
+	}
+	return int(n), nil
+}
+
+// next reads the header of the next value. Scalars are consumed entirely,
+// for strings, binary and ext types the length of the payload is returned,
+// and for arrays and maps the number of elements.
+func (s *msgScanner) next() (kind msgKind, n int, err error) {
+	b, err := s.read(1)
+	if err != nil {
+		return kindScalar, 0, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f, c >= 0xe0:
+		return kindScalar, 0, nil
+	case c <= 0x8f:
+		return kindMap, int(c & 0x0f), nil
+	case c <= 0x9f:
+		return kindArray, int(c & 0x0f), nil
+	case c <= 0xbf:
+		return kindString, int(c & 0x1f), nil
+	}
+	switch c {
+	case 0xc0:
+		return kindNil, 0, nil
+	case 0xc2, 0xc3:
+		return kindScalar, 0, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err = s.readUint(1 << (c - 0xc4))
+		return kindBinary, n, err
+	case 0xc7, 0xc8, 0xc9:
+		n, err = s.readUint(1 << (c - 0xc7))
+		return kindExt, n + 1, err
+	case 0xca, 0xce, 0xd2:
+		_, err = s.read(4)
+	case 0xcb, 0xcf, 0xd3:
+		_, err = s.read(8)
+	case 0xcc, 0xd0:
+		_, err = s.read(1)
+	case 0xcd, 0xd1:
+		_, err = s.read(2)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return kindExt, 1 + (1 << (c - 0xd4)), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err = s.readUint(1 << (c - 0xd9))
+		return kindString, n, err
+	case 0xdc, 0xdd:
+		n, err = s.readUint(2 << (c - 0xdc))
+		return kindArray, n, err
+	case 0xde, 0xdf:
+		n, err = s.readUint(2 << (c - 0xde))
+		return kindMap, n, err
+	default:
+		return kindScalar, 0, s.malformed(fmt.Sprintf("invalid code 0x%02x", c))
+	}
+	return kindScalar, 0, err
+}
+
+func (s *msgScanner) enter(depth int) error {
+	if s.maxDepth > 0 && depth > s.maxDepth {
+		return &LimitError{
+			Err:   ErrMaxDepthExceeded,
+			Limit: s.maxDepth,
+			Size:  depth,
+		}
+	}
+	return nil
+}
+
+// skip skips over the payload of a value with the given header.
+func (s *msgScanner) skip(kind msgKind, n, depth int) error {
+	switch kind {
+	case kindString, kindBinary, kindExt:
+		_, err := s.read(n)
+		return err
+	case kindArray, kindMap:
+		if err := s.enter(depth + 1); err != nil {
+			return err
+		}
+		if kind == kindMap {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			k, m, err := s.next()
+			if err != nil {
+				return err
+			}
+			if err = s.skip(k, m, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readKey reads a map key, returning the key if it is a string.
+func (s *msgScanner) readKey(depth int) (string, error) {
+	kind, n, err := s.next()
+	if err != nil {
+		return "", err
+	}
+	if kind != kindString {
+		return "", s.skip(kind, n, depth)
+	}
+	b, err := s.read(n)
+	return string(b), err
+}
+
+// scanMap iterates over the entries of a map at the given depth calling
+// field for each entry with a string key.
+func (s *msgScanner) scanMap(
+	depth int,
+	field func(key string) error,
+) error {
+	kind, n, err := s.next()
+	if err != nil {
+		return err
+	}
+	if kind == kindNil {
+		return nil
+	} else if kind != kindMap {
+		return s.skip(kind, n, depth-1)
+	}
+	if err = s.enter(depth); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		key, err := s.readKey(depth)
+		if err != nil {
+			return err
+		}
+		if err = field(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *msgScanner) skipNext(depth int) error {
+	kind, n, err := s.next()
+	if err != nil {
+		return err
+	}
+	return s.skip(kind, n, depth)
+}
+
+func (s *msgScanner) scanProperties(depth int) error {
+	kind, n, err := s.next()
+	if err != nil {
+		return err
+	}
+	if kind == kindMap && s.maxProperties > 0 && n > s.maxProperties {
+		return &LimitError{
+			Err:   ErrTooManyProperties,
+			Limit: s.maxProperties,
+			Size:  n,
+		}
+	}
+	return s.skip(kind, n, depth)
+}
+
+func (s *msgScanner) scanBody(depth int) error {
+	kind, n, err := s.next()
+	if err != nil {
+		return err
+	}
+	if (kind == kindBinary || kind == kindString) &&
+		s.maxBodySize > 0 && n > s.maxBodySize {
+		return &LimitError{
+			Err:   ErrBodyTooLarge,
+			Limit: s.maxBodySize,
+			Size:  n,
+		}
+	}
+	return s.skip(kind, n, depth)
+}
+
+func (s *msgScanner) scanMessage() error {
+	err := s.scanMap(1, func(key string) error {
+		switch key {
+		case "hdr":
+			return s.scanMap(2, func(key string) error {
+				if key == "props" {
+					return s.scanProperties(2)
+				}
+				return s.skipNext(2)
+			})
+		case "body":
+			return s.scanBody(1)
+		default:
+			return s.skipNext(1)
+		}
+	})
+	if err == nil && s.pos != len(s.data) {
+		err = s.malformed("trailing data")
+	}
+	return err
+}
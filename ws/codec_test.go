@@ -0,0 +1,153 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func nestedMap(depth int) interface{} {
+	var v interface{} = "leaf"
+	for i := 0; i < depth; i++ {
+		v = map[string]interface{}{"nested": v}
+	}
+	return v
+}
+
+func TestUnmarshalProtoMsg(t *testing.T) {
+	t.Parallel()
+	props := make(map[string]interface{}, DefaultMaxProperties+1)
+	for i := 0; i <= DefaultMaxProperties; i++ {
+		props[fmt.Sprintf("prop%d", i)] = i
+	}
+	testCases := []struct {
+		Name string
+
+		Data   []byte
+		Limits *DecodeLimits
+
+		Message *ProtoMsg
+		Error   error
+	}{{
+		Name: "ok",
+		Data: mustMarshal(ProtoMsg{
+			Header: ProtoHdr{
+				Proto:     ProtoTypeFileTransfer,
+				MsgType:   "file_chunk",
+				SessionID: "1234",
+				Properties: map[string]interface{}{
+					"offset": int64(1024),
+					"nested": map[string]interface{}{
+						"array": []interface{}{"a", true, nil, 1.5},
+					},
+				},
+			},
+			Body: []byte("chunk"),
+		}),
+		Message: &ProtoMsg{
+			Header: ProtoHdr{
+				Proto:     ProtoTypeFileTransfer,
+				MsgType:   "file_chunk",
+				SessionID: "1234",
+				Properties: map[string]interface{}{
+					"offset": int64(1024),
+					"nested": map[string]interface{}{
+						"array": []interface{}{"a", true, nil, 1.5},
+					},
+				},
+			},
+			Body: []byte("chunk"),
+		},
+	}, {
+		Name: "error, body too large",
+		Data: mustMarshal(ProtoMsg{
+			Header: ProtoHdr{Proto: ProtoTypeShell},
+			Body:   bytes.Repeat([]byte{'x'}, 33),
+		}),
+		Limits: NewDecodeLimits().SetMaxBodySize(32),
+		Error:  ErrBodyTooLarge,
+	}, {
+		Name: "ok, body limit disabled",
+		Data: mustMarshal(ProtoMsg{
+			Header: ProtoHdr{Proto: ProtoTypeShell},
+			Body:   bytes.Repeat([]byte{'x'}, 33),
+		}),
+		Limits: NewDecodeLimits().SetMaxBodySize(0),
+		Message: &ProtoMsg{
+			Header: ProtoHdr{Proto: ProtoTypeShell},
+			Body:   bytes.Repeat([]byte{'x'}, 33),
+		},
+	}, {
+		Name: "error, too many properties",
+		Data: mustMarshal(ProtoMsg{
+			Header: ProtoHdr{
+				Proto:      ProtoTypeShell,
+				Properties: props,
+			},
+		}),
+		Error: ErrTooManyProperties,
+	}, {
+		Name: "error, nesting too deep",
+		Data: mustMarshal(ProtoMsg{
+			Header: ProtoHdr{
+				Proto: ProtoTypeShell,
+				Properties: map[string]interface{}{
+					"deep": nestedMap(DefaultMaxDepth),
+				},
+			},
+		}),
+		Error: ErrMaxDepthExceeded,
+	}, {
+		Name:  "error, truncated message",
+		Data:  mustMarshal(ProtoMsg{Body: []byte("truncated")})[:12],
+		Error: ErrMalformedMessage,
+	}, {
+		Name: "error, container length exceeds message size",
+		// map32 header claiming 2^32-1 entries
+		Data:  []byte{0xdf, 0xff, 0xff, 0xff, 0xff},
+		Error: ErrMalformedMessage,
+	}, {
+		Name:  "error, invalid code",
+		Data:  []byte{0x81, 0xa3, 'h', 'd', 'r', 0xc1},
+		Error: ErrMalformedMessage,
+	}, {
+		Name:  "error, trailing data",
+		Data:  append(mustMarshal(ProtoMsg{}), 0x00),
+		Error: ErrMalformedMessage,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			msg, err := UnmarshalProtoMsg(tc.Data, tc.Limits)
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+				var limitErr *LimitError
+				if errors.Is(tc.Error, ErrMalformedMessage) {
+					assert.False(t, errors.As(err, &limitErr))
+				} else {
+					assert.ErrorAs(t, err, &limitErr)
+				}
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.Message, msg)
+			}
+		})
+	}
+}
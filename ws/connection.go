@@ -0,0 +1,212 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// TextMessage and BinaryMessage are the websocket data frame
+	// opcodes as defined in RFC 6455, section 11.8.
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+var (
+	// ErrConnectionClosed is returned when operating on a closed Connection.
+	ErrConnectionClosed = errors.New("ws: connection closed")
+)
+
+// MessageConn is the message oriented transport underlying a Connection.
+// The interface is satisfied by *websocket.Conn from the
+// github.com/gorilla/websocket package.
+type MessageConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+}
+
+type ConnectionOptions struct {
+	// DecodeLimits restricts the size and complexity of the messages
+	// read from the connection (see UnmarshalProtoMsg).
+	DecodeLimits *DecodeLimits
+	// Context is the context of the connection, e.g. carrying the
+	// identity authenticated during the handshake (see Authenticate).
+	Context context.Context
+	// Metrics receives the message counters of the connection.
+	Metrics Metrics
+	// Registry validates the messages written to the connection (see
+	// Registry.Validate), e.g. DefaultRegistry(). If nil, the messages
+	// are not validated.
+	Registry *Registry
+}
+
+func NewConnectionOptions() *ConnectionOptions {
+	return new(ConnectionOptions)
+}
+
+func (opts *ConnectionOptions) SetDecodeLimits(limits *DecodeLimits) *ConnectionOptions {
+	opts.DecodeLimits = limits
+	return opts
+}
+
+func (opts *ConnectionOptions) SetMetrics(metrics Metrics) *ConnectionOptions {
+	opts.Metrics = metrics
+	return opts
+}
+
+func (opts *ConnectionOptions) SetRegistry(registry *Registry) *ConnectionOptions {
+	opts.Registry = registry
+	return opts
+}
+
+func (opts *ConnectionOptions) SetContext(ctx context.Context) *ConnectionOptions {
+	opts.Context = ctx
+	return opts
+}
+
+// Connection wraps a MessageConn and exchanges msgpack encoded ProtoMsgs
+// over it. It is safe to call WriteMessage from multiple goroutines,
+// while there may be at most one concurrent reader.
+type Connection struct {
+	conn     MessageConn
+	limits   *DecodeLimits
+	ctx      context.Context
+	metrics  Metrics
+	registry *Registry
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+// NewConnection initializes a new Connection on top of conn.
+func NewConnection(conn MessageConn, opts ...*ConnectionOptions) *Connection {
+	var limits []*DecodeLimits
+	ctx := context.Background()
+	var metrics Metrics = nopMetrics{}
+	var registry *Registry
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.DecodeLimits != nil {
+			limits = append(limits, opt.DecodeLimits)
+		}
+		if opt.Context != nil {
+			ctx = opt.Context
+		}
+		if opt.Metrics != nil {
+			metrics = opt.Metrics
+		}
+		if opt.Registry != nil {
+			registry = opt.Registry
+		}
+	}
+	return &Connection{
+		conn:     conn,
+		limits:   mergeDecodeLimits(limits...),
+		ctx:      ctx,
+		metrics:  metrics,
+		registry: registry,
+		done:     make(chan struct{}),
+	}
+}
+
+// ReadMessage reads the next ProtoMsg from the connection.
+func (c *Connection) ReadMessage() (*ProtoMsg, error) {
+	msgType, data, err := c.conn.ReadMessage()
+	if err != nil {
+		select {
+		case <-c.done:
+			return nil, ErrConnectionClosed
+		default:
+		}
+		c.metrics.Error(DirectionReceived, ProtoInvalid, "", err)
+		return nil, err
+	}
+	if msgType != BinaryMessage {
+		err = fmt.Errorf(
+			"ws: unexpected websocket message type: %d", msgType,
+		)
+		c.metrics.Error(DirectionReceived, ProtoInvalid, "", err)
+		return nil, err
+	}
+	msg, err := UnmarshalProtoMsg(data, c.limits)
+	if err != nil {
+		c.metrics.Error(DirectionReceived, ProtoInvalid, "", err)
+		return nil, err
+	}
+	c.metrics.Message(DirectionReceived, msg.Header.Proto, msg.Header.MsgType, len(data))
+	return msg, nil
+}
+
+// WriteMessage encodes msg and writes it to the connection. If the
+// connection has a Registry, the message is validated first.
+func (c *Connection) WriteMessage(msg *ProtoMsg) error {
+	if c.registry != nil {
+		if err := c.registry.Validate(msg); err != nil {
+			c.metrics.Error(DirectionSent, msg.Header.Proto, msg.Header.MsgType, err)
+			return err
+		}
+	}
+	data, err := msgpack.Marshal(msg)
+	if err != nil {
+		err = fmt.Errorf("ws: failed to encode message: %w", err)
+		c.metrics.Error(DirectionSent, msg.Header.Proto, msg.Header.MsgType, err)
+		return err
+	}
+	select {
+	case <-c.done:
+		return ErrConnectionClosed
+	default:
+	}
+	c.writeMu.Lock()
+	err = c.conn.WriteMessage(BinaryMessage, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.metrics.Error(DirectionSent, msg.Header.Proto, msg.Header.MsgType, err)
+		return err
+	}
+	c.metrics.Message(DirectionSent, msg.Header.Proto, msg.Header.MsgType, len(data))
+	return nil
+}
+
+// Context returns the context of the connection.
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the underlying connection. It is safe to call Close
+// multiple times, subsequent calls return the result of the first.
+func (c *Connection) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
@@ -0,0 +1,202 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type frame struct {
+	typ  int
+	data []byte
+}
+
+type mockConn struct {
+	frames  chan frame
+	written []frame
+	closed  bool
+	err     error
+}
+
+func newMockConn(frames ...frame) *mockConn {
+	c := &mockConn{frames: make(chan frame, len(frames))}
+	for _, f := range frames {
+		c.frames <- f
+	}
+	close(c.frames)
+	return c
+}
+
+func (c *mockConn) ReadMessage() (int, []byte, error) {
+	f, ok := <-c.frames
+	if !ok {
+		return 0, nil, io.EOF
+	}
+	return f.typ, f.data, nil
+}
+
+func (c *mockConn) WriteMessage(typ int, data []byte) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.written = append(c.written, frame{typ: typ, data: data})
+	return nil
+}
+
+func (c *mockConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := msgpack.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestConnectionReadMessage(t *testing.T) {
+	t.Parallel()
+	msg := ProtoMsg{
+		Header: ProtoHdr{
+			Proto:     ProtoTypeShell,
+			MsgType:   "shell",
+			SessionID: "1234",
+		},
+		Body: []byte("ls -l"),
+	}
+	testCases := []struct {
+		Name string
+
+		Frame frame
+
+		Message *ProtoMsg
+		Error   string
+	}{{
+		Name:    "ok",
+		Frame:   frame{typ: BinaryMessage, data: mustMarshal(msg)},
+		Message: &msg,
+	}, {
+		Name:  "error, text message",
+		Frame: frame{typ: TextMessage, data: []byte("hello")},
+		Error: "ws: unexpected websocket message type: 1",
+	}, {
+		Name:  "error, malformed message",
+		Frame: frame{typ: BinaryMessage, data: []byte{0xc1}},
+		Error: "ws: malformed message: ",
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			conn := NewConnection(newMockConn(tc.Frame))
+			res, err := conn.ReadMessage()
+			if tc.Error != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.Error)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.Message, res)
+			}
+		})
+	}
+}
+
+func TestConnectionWriteMessage(t *testing.T) {
+	t.Parallel()
+	mc := newMockConn()
+	conn := NewConnection(mc)
+	msg := &ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeFileTransfer},
+		Body:   []byte("data"),
+	}
+	err := conn.WriteMessage(msg)
+	assert.NoError(t, err)
+	if assert.Len(t, mc.written, 1) {
+		assert.Equal(t, BinaryMessage, mc.written[0].typ)
+		var res ProtoMsg
+		_ = msgpack.Unmarshal(mc.written[0].data, &res)
+		assert.Equal(t, *msg, res)
+	}
+
+	mc.err = errors.New("broken pipe")
+	err = conn.WriteMessage(msg)
+	assert.EqualError(t, err, "broken pipe")
+
+	assert.NoError(t, conn.Close())
+	assert.True(t, mc.closed)
+	err = conn.WriteMessage(msg)
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+	select {
+	case <-conn.Done():
+	default:
+		t.Error("Done channel not closed after calling Close")
+	}
+}
+
+func TestConnectionWriteMessageValidate(t *testing.T) {
+	t.Parallel()
+	mc := newMockConn()
+	conn := NewConnection(mc, NewConnectionOptions().SetRegistry(DefaultRegistry()))
+	err := conn.WriteMessage(&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeFileTransfer, MsgType: "shell"},
+	})
+	assert.ErrorIs(t, err, ErrUnknownMessageType)
+	assert.Empty(t, mc.written)
+
+	err = conn.WriteMessage(&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeFileTransfer, MsgType: "get_file"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, mc.written, 1)
+}
+
+func TestConnectionMetrics(t *testing.T) {
+	t.Parallel()
+	msg := ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeShell, MsgType: "shell"},
+		Body:   []byte("ls -l"),
+	}
+	data := mustMarshal(msg)
+	mc := newMockConn(
+		frame{typ: BinaryMessage, data: data},
+		frame{typ: BinaryMessage, data: data},
+		frame{typ: TextMessage, data: []byte("hello")},
+	)
+	counters := NewCounters()
+	conn := NewConnection(mc, NewConnectionOptions().SetMetrics(counters))
+	for i := 0; i < 3; i++ {
+		_, _ = conn.ReadMessage()
+	}
+	_ = conn.WriteMessage(&msg)
+	mc.err = errors.New("broken pipe")
+	_ = conn.WriteMessage(&msg)
+
+	shell := MetricsLabels{Proto: ProtoTypeShell, MsgType: "shell"}
+	received, sent := shell, shell
+	received.Direction, sent.Direction = DirectionReceived, DirectionSent
+	assert.Equal(t, map[MetricsLabels]MessageStats{
+		received:                       {Messages: 2, Bytes: uint64(2 * len(data))},
+		sent:                           {Messages: 1, Bytes: uint64(len(data)), Errors: 1},
+		{Direction: DirectionReceived}: {Errors: 1},
+	}, counters.Snapshot())
+}
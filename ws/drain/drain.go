@@ -0,0 +1,238 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package drain implements graceful draining of websocket connections when
+// shutting down a service.
+package drain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/ws"
+)
+
+const (
+	DefaultGracePeriod = 30 * time.Second
+)
+
+var (
+	// ErrDraining is returned by Track when the Drainer is draining.
+	ErrDraining = errors.New("drain: draining connections")
+)
+
+// ForceClosedError is returned by Drain when connections did not close
+// within the grace period.
+type ForceClosedError struct {
+	// Count is the number of connections that were closed forcefully.
+	Count int
+}
+
+func (err *ForceClosedError) Error() string {
+	return fmt.Sprintf(
+		"drain: grace period exceeded: force closed %d connection(s)",
+		err.Count,
+	)
+}
+
+// CloseMessageFunc returns the message sent to the connection when
+// draining starts. A nil message skips notifying the connection.
+type CloseMessageFunc func(conn *ws.Connection) *ws.ProtoMsg
+
+// CloseMessage returns a session control close message.
+func CloseMessage(*ws.Connection) *ws.ProtoMsg {
+	return &ws.ProtoMsg{
+		Header: ws.ProtoHdr{
+			Proto:   ws.ProtoTypeControl,
+			MsgType: ws.MessageTypeClose,
+		},
+	}
+}
+
+type Options struct {
+	// GracePeriod is the time to wait for the connections to close
+	// before closing them forcefully (default: DefaultGracePeriod).
+	GracePeriod *time.Duration
+	// CloseMessage creates the message sent to the connections when
+	// draining starts (default: CloseMessage).
+	CloseMessage CloseMessageFunc
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetGracePeriod(period time.Duration) *Options {
+	opts.GracePeriod = &period
+	return opts
+}
+
+func (opts *Options) SetCloseMessage(f CloseMessageFunc) *Options {
+	opts.CloseMessage = f
+	return opts
+}
+
+// Drainer keeps track of the open connections and drains them on
+// shutdown.
+type Drainer struct {
+	gracePeriod  time.Duration
+	closeMessage CloseMessageFunc
+
+	mu       sync.Mutex
+	conns    map[*ws.Connection]struct{}
+	draining bool
+	empty    chan struct{}
+}
+
+// New creates a new Drainer.
+func New(opts ...*Options) *Drainer {
+	opt := NewOptions().
+		SetGracePeriod(DefaultGracePeriod).
+		SetCloseMessage(CloseMessage)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if o.GracePeriod != nil {
+			opt.GracePeriod = o.GracePeriod
+		}
+		if o.CloseMessage != nil {
+			opt.CloseMessage = o.CloseMessage
+		}
+	}
+	return &Drainer{
+		gracePeriod:  *opt.GracePeriod,
+		closeMessage: opt.CloseMessage,
+		conns:        make(map[*ws.Connection]struct{}),
+	}
+}
+
+// Track registers the connection with the Drainer. The connection is
+// untracked when it is closed. It returns ErrDraining if the Drainer is
+// draining; the caller should refuse the connection.
+func (d *Drainer) Track(conn *ws.Connection) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ErrDraining
+	}
+	d.conns[conn] = struct{}{}
+	go func() {
+		<-conn.Done()
+		d.untrack(conn)
+	}()
+	return nil
+}
+
+func (d *Drainer) untrack(conn *ws.Connection) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.conns, conn)
+	if d.empty != nil && len(d.conns) == 0 {
+		close(d.empty)
+		d.empty = nil
+	}
+}
+
+// Len returns the number of tracked connections.
+func (d *Drainer) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+// Draining returns true after Drain has been called.
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Drain stops accepting new connections, sends the close message to all
+// tracked connections and waits for them to close. Connections that are
+// still open after the grace period (or when ctx is done) are closed and
+// a *ForceClosedError is returned.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	conns := make([]*ws.Connection, 0, len(d.conns))
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	var empty chan struct{}
+	if len(d.conns) > 0 {
+		if d.empty == nil {
+			d.empty = make(chan struct{})
+		}
+		empty = d.empty
+	}
+	d.mu.Unlock()
+	if empty == nil {
+		return nil
+	}
+
+	for _, conn := range conns {
+		if msg := d.closeMessage(conn); msg != nil {
+			// Errors only mean the connection is already broken.
+			_ = conn.WriteMessage(msg)
+		}
+	}
+
+	timer := time.NewTimer(d.gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-empty:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	conns = conns[:0]
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	d.mu.Unlock()
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	if len(conns) == 0 {
+		return nil
+	}
+	return &ForceClosedError{Count: len(conns)}
+}
+
+// DrainOnSignal blocks until one of the signals (default: SIGTERM and
+// SIGINT) is received and drains the connections. It returns ctx.Err()
+// without draining if ctx is done before receiving a signal.
+func (d *Drainer) DrainOnSignal(ctx context.Context, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+	select {
+	case <-ch:
+		return d.Drain(context.Background())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package drain
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/mendersoftware/go-lib-micro/ws"
+)
+
+// mockConn is a ws.MessageConn invoking onWrite for every message
+// written to the connection.
+type mockConn struct {
+	mu      sync.Mutex
+	written []*ws.ProtoMsg
+	onWrite func(msg *ws.ProtoMsg)
+	closed  bool
+}
+
+func (c *mockConn) ReadMessage() (int, []byte, error) {
+	return 0, nil, errors.New("not implemented")
+}
+
+func (c *mockConn) WriteMessage(_ int, data []byte) error {
+	var msg ws.ProtoMsg
+	if err := msgpack.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.written = append(c.written, &msg)
+	onWrite := c.onWrite
+	c.mu.Unlock()
+	if onWrite != nil {
+		go onWrite(&msg)
+	}
+	return nil
+}
+
+func (c *mockConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *mockConn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+	d := New(NewOptions().SetGracePeriod(time.Second * 10))
+
+	// well behaved connection closing on close message
+	good := &mockConn{}
+	goodConn := ws.NewConnection(good)
+	good.onWrite = func(msg *ws.ProtoMsg) {
+		if msg.Header.Proto == ws.ProtoTypeControl &&
+			msg.Header.MsgType == ws.MessageTypeClose {
+			goodConn.Close()
+		}
+	}
+	assert.NoError(t, d.Track(goodConn))
+
+	// connection closed before draining
+	closed := ws.NewConnection(&mockConn{})
+	assert.NoError(t, d.Track(closed))
+	closed.Close()
+	assert.Eventually(t, func() bool { return d.Len() == 1 },
+		time.Second, time.Millisecond)
+
+	assert.NoError(t, d.Drain(context.Background()))
+	assert.True(t, d.Draining())
+	assert.True(t, good.Closed())
+	assert.Len(t, good.written, 1)
+	assert.Equal(t, 0, d.Len())
+
+	assert.ErrorIs(t, d.Track(ws.NewConnection(&mockConn{})), ErrDraining)
+}
+
+func TestDrainForceClose(t *testing.T) {
+	t.Parallel()
+	d := New(NewOptions().
+		SetGracePeriod(time.Millisecond * 10).
+		SetCloseMessage(func(*ws.Connection) *ws.ProtoMsg {
+			return &ws.ProtoMsg{Header: ws.ProtoHdr{
+				Proto:   ws.ProtoTypeShell,
+				MsgType: "stop",
+			}}
+		}))
+	stuck := &mockConn{}
+	assert.NoError(t, d.Track(ws.NewConnection(stuck)))
+
+	err := d.Drain(context.Background())
+	var forceErr *ForceClosedError
+	if assert.ErrorAs(t, err, &forceErr) {
+		assert.Equal(t, 1, forceErr.Count)
+	}
+	assert.True(t, stuck.Closed())
+	if assert.Len(t, stuck.written, 1) {
+		assert.Equal(t, "stop", stuck.written[0].Header.MsgType)
+	}
+	assert.Eventually(t, func() bool { return d.Len() == 0 },
+		time.Second, time.Millisecond)
+}
+
+func TestDrainOnSignal(t *testing.T) {
+	// Make sure the signal never terminates the test process.
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGUSR1)
+	defer signal.Stop(guard)
+
+	d := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, d.DrainOnSignal(ctx, syscall.SIGUSR1), context.Canceled)
+	assert.False(t, d.Draining())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.DrainOnSignal(context.Background(), syscall.SIGUSR1)
+	}()
+	assert.Eventually(t, func() bool {
+		_ = syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+			return true
+		default:
+			return false
+		}
+	}, time.Second*5, time.Millisecond*50)
+	assert.True(t, d.Draining())
+}
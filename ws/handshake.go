@@ -0,0 +1,225 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// PropertyStatus is the header property of the "open" reply of legacy
+// (version 0) peers, see IsLegacyOpen.
+const PropertyStatus = "status"
+
+var (
+	ErrVersionNotSupported = errors.New("ws: no common protocol version")
+	ErrUnexpectedMessage   = errors.New("ws: unexpected handshake message")
+)
+
+// HandshakeError is returned by ParseAccept when the peer replies to the
+// "open" message with an error.
+type HandshakeError struct {
+	Reply Error
+}
+
+func (err *HandshakeError) Error() string {
+	return "ws: handshake rejected by peer: " + err.Reply.Error
+}
+
+// SupportedVersions are the ProtoMsg versions implemented by this package.
+var SupportedVersions = []int{ProtocolVersion}
+
+// compatibility lists the protocols available in each version; version 0
+// peers (Mender 2.6 and older) only speak the shell protocol.
+var compatibility = map[int][]ProtoType{
+	0: {ProtoTypeShell},
+	1: {
+		ProtoTypeShell,
+		ProtoTypeFileTransfer,
+		ProtoTypePortForward,
+		ProtoTypeMenderClient,
+	},
+}
+
+// IsCompatible returns true if the protocol is available in the version.
+// Control messages are available in all versions.
+func IsCompatible(version int, proto ProtoType) bool {
+	if proto == ProtoTypeControl {
+		return true
+	}
+	for _, p := range compatibility[version] {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
+
+// NegotiateVersion returns the highest version in both offered and
+// supported (default: SupportedVersions).
+func NegotiateVersion(offered []int, supported ...int) (int, error) {
+	if len(supported) == 0 {
+		supported = SupportedVersions
+	}
+	sorted := make([]int, len(offered))
+	copy(sorted, offered)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	for _, v := range sorted {
+		for _, s := range supported {
+			if v == s {
+				return v, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: offered %v, supported %v",
+		ErrVersionNotSupported, offered, supported)
+}
+
+// NewOpenMessage returns the "open" control message initiating the
+// handshake of a session, offering the versions (default:
+// SupportedVersions).
+func NewOpenMessage(sessionID string, versions ...int) (*ProtoMsg, error) {
+	if len(versions) == 0 {
+		versions = SupportedVersions
+	}
+	body, err := msgpack.Marshal(Open{Versions: versions})
+	if err != nil {
+		return nil, fmt.Errorf("ws: failed to encode open message: %w", err)
+	}
+	return &ProtoMsg{
+		Header: ProtoHdr{
+			Proto:     ProtoTypeControl,
+			MsgType:   MessageTypeOpen,
+			SessionID: sessionID,
+		},
+		Body: body,
+	}, nil
+}
+
+// AcceptOpen handles the "open" message of the peer: it negotiates the
+// version with the supported versions (default: SupportedVersions) and
+// returns the "accept" reply listing the protocols compatible with the
+// version. If no version is shared, the reply is an error message closing
+// the session, which the caller should send before returning the error.
+func AcceptOpen(
+	msg *ProtoMsg,
+	protocols []ProtoType,
+	supported ...int,
+) (*ProtoMsg, *Accept, error) {
+	if msg.Header.Proto != ProtoTypeControl || msg.Header.MsgType != MessageTypeOpen {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnexpectedMessage, msg.Header.MsgType)
+	}
+	var open Open
+	// Fields added by newer versions are ignored.
+	if err := msgpack.Unmarshal(msg.Body, &open); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMalformedMessage, err.Error())
+	}
+	version, err := NegotiateVersion(open.Versions, supported...)
+	if err != nil {
+		reply, encErr := newErrorMessage(msg, Error{
+			Error: err.Error(),
+			Close: true,
+		})
+		if encErr != nil {
+			return nil, nil, encErr
+		}
+		return reply, nil, err
+	}
+	accept := &Accept{Version: version, Protocols: []ProtoType{}}
+	for _, proto := range protocols {
+		if IsCompatible(version, proto) {
+			accept.Protocols = append(accept.Protocols, proto)
+		}
+	}
+	body, err := msgpack.Marshal(accept)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ws: failed to encode accept message: %w", err)
+	}
+	return &ProtoMsg{
+		Header: ProtoHdr{
+			Proto:     ProtoTypeControl,
+			MsgType:   MessageTypeAccept,
+			SessionID: msg.Header.SessionID,
+		},
+		Body: body,
+	}, accept, nil
+}
+
+func newErrorMessage(cause *ProtoMsg, e Error) (*ProtoMsg, error) {
+	e.MessageProto = cause.Header.Proto
+	e.MessageType = cause.Header.MsgType
+	body, err := msgpack.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("ws: failed to encode error message: %w", err)
+	}
+	return &ProtoMsg{
+		Header: ProtoHdr{
+			Proto:     ProtoTypeControl,
+			MsgType:   MessageTypeError,
+			SessionID: cause.Header.SessionID,
+		},
+		Body: body,
+	}, nil
+}
+
+// IsLegacyOpen returns true if the message is the reply of a version 0
+// peer to an "open" message: an "open" message with the status property
+// equal to 1.
+func IsLegacyOpen(msg *ProtoMsg) bool {
+	if msg.Header.MsgType != MessageTypeOpen {
+		return false
+	}
+	status, ok := propertyUint(msg.Header.Properties[PropertyStatus])
+	return ok && status == 1
+}
+
+// ParseAccept handles the reply of the peer to an "open" message. It
+// returns the accepted version and protocols, or version 0 with the shell
+// protocol for legacy peers. Error replies are returned as HandshakeError,
+// and accepted versions which were not offered as ErrVersionNotSupported.
+func ParseAccept(msg *ProtoMsg, offered ...int) (*Accept, error) {
+	if len(offered) == 0 {
+		offered = SupportedVersions
+	}
+	if IsLegacyOpen(msg) {
+		return &Accept{Version: 0, Protocols: []ProtoType{ProtoTypeShell}}, nil
+	} else if msg.Header.Proto != ProtoTypeControl {
+		return nil, fmt.Errorf("%w: proto %d", ErrUnexpectedMessage, msg.Header.Proto)
+	}
+	switch msg.Header.MsgType {
+	case MessageTypeAccept:
+		var accept Accept
+		if err := msgpack.Unmarshal(msg.Body, &accept); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformedMessage, err.Error())
+		}
+		for _, v := range offered {
+			if v == accept.Version {
+				return &accept, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: peer accepted version %d, offered %v",
+			ErrVersionNotSupported, accept.Version, offered)
+	case MessageTypeError:
+		var e Error
+		if err := msgpack.Unmarshal(msg.Body, &e); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformedMessage, err.Error())
+		}
+		return nil, &HandshakeError{Reply: e}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnexpectedMessage, msg.Header.MsgType)
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	t.Parallel()
+	v, err := NegotiateVersion([]int{0, 1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	v, err = NegotiateVersion([]int{1, 3, 2}, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+	_, err = NegotiateVersion([]int{2})
+	assert.ErrorIs(t, err, ErrVersionNotSupported)
+
+	assert.True(t, IsCompatible(0, ProtoTypeShell))
+	assert.True(t, IsCompatible(0, ProtoTypeControl))
+	assert.False(t, IsCompatible(0, ProtoTypePortForward))
+	assert.True(t, IsCompatible(1, ProtoTypePortForward))
+	assert.False(t, IsCompatible(2, ProtoTypeShell))
+}
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+	open, err := NewOpenMessage("sid")
+	require.NoError(t, err)
+	reply, accept, err := AcceptOpen(open,
+		[]ProtoType{ProtoTypeShell, ProtoTypePortForward, ProtoType(42)})
+	require.NoError(t, err)
+	assert.Equal(t, &Accept{
+		Version:   1,
+		Protocols: []ProtoType{ProtoTypeShell, ProtoTypePortForward},
+	}, accept)
+	assert.Equal(t, "sid", reply.Header.SessionID)
+
+	parsed, err := ParseAccept(reply)
+	assert.NoError(t, err)
+	assert.Equal(t, accept, parsed)
+
+	// The peer does not share a version
+	open, err = NewOpenMessage("sid", 2, 3)
+	require.NoError(t, err)
+	reply, _, err = AcceptOpen(open, []ProtoType{ProtoTypeShell})
+	assert.ErrorIs(t, err, ErrVersionNotSupported)
+	require.NotNil(t, reply)
+	assert.Equal(t, MessageTypeError, reply.Header.MsgType)
+	_, err = ParseAccept(reply, 2, 3)
+	var handshakeErr *HandshakeError
+	if assert.True(t, errors.As(err, &handshakeErr)) {
+		assert.True(t, handshakeErr.Reply.Close)
+		assert.Equal(t, MessageTypeOpen, handshakeErr.Reply.MessageType)
+	}
+
+	// The peer accepts a version which was not offered
+	_, err = ParseAccept(reply)
+	assert.Error(t, err)
+	body, _ := msgpack.Marshal(Accept{Version: 2})
+	_, err = ParseAccept(&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeControl, MsgType: MessageTypeAccept},
+		Body:   body,
+	})
+	assert.ErrorIs(t, err, ErrVersionNotSupported)
+
+	_, _, err = AcceptOpen(reply, nil)
+	assert.ErrorIs(t, err, ErrUnexpectedMessage)
+}
+
+func TestHandshakeCompatibility(t *testing.T) {
+	t.Parallel()
+	// Fields added by future versions are ignored
+	body, _ := msgpack.Marshal(map[string]interface{}{
+		"versions": []int{1, 2},
+		"features": []string{"compression"},
+	})
+	_, accept, err := AcceptOpen(&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeControl, MsgType: MessageTypeOpen},
+		Body:   body,
+	}, []ProtoType{ProtoTypeShell})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accept.Version)
+
+	// Legacy peers reply with an open message
+	accept, err = ParseAccept(&ProtoMsg{
+		Header: ProtoHdr{
+			Proto:      ProtoTypeShell,
+			MsgType:    MessageTypeOpen,
+			Properties: map[string]interface{}{PropertyStatus: int8(1)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Accept{Version: 0, Protocols: []ProtoType{ProtoTypeShell}}, accept)
+
+	_, err = ParseAccept(&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeShell, MsgType: MessageTypeOpen},
+	})
+	assert.ErrorIs(t, err, ErrUnexpectedMessage)
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import "sync"
+
+// Direction is the direction of a message relative to the local end of
+// the connection.
+type Direction string
+
+const (
+	DirectionReceived Direction = "received"
+	DirectionSent     Direction = "sent"
+)
+
+// Metrics receives the instrumentation of the connections, e.g. to export
+// the counters to a metrics backend. The message type and proto type are
+// the zero values if an error occurs before the message is decoded.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Message is called for every message sent or received with the
+	// size of the encoded message in bytes.
+	Message(dir Direction, proto ProtoType, msgType string, size int)
+	// Error is called when reading, decoding, encoding or writing a
+	// message fails.
+	Error(dir Direction, proto ProtoType, msgType string, err error)
+}
+
+// MetricsLabels identifies a set of counters of Counters.
+type MetricsLabels struct {
+	Direction Direction
+	Proto     ProtoType
+	MsgType   string
+}
+
+// MessageStats are the counters of a set of labels.
+type MessageStats struct {
+	Messages uint64
+	Bytes    uint64
+	Errors   uint64
+}
+
+// Counters is an in-memory Metrics implementation counting the messages,
+// bytes and errors per labels.
+type Counters struct {
+	mu    sync.Mutex
+	stats map[MetricsLabels]*MessageStats
+}
+
+func NewCounters() *Counters {
+	return &Counters{stats: make(map[MetricsLabels]*MessageStats)}
+}
+
+func (c *Counters) get(labels MetricsLabels) *MessageStats {
+	stats, ok := c.stats[labels]
+	if !ok {
+		stats = new(MessageStats)
+		c.stats[labels] = stats
+	}
+	return stats
+}
+
+func (c *Counters) Message(dir Direction, proto ProtoType, msgType string, size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.get(MetricsLabels{Direction: dir, Proto: proto, MsgType: msgType})
+	stats.Messages++
+	stats.Bytes += uint64(size)
+}
+
+func (c *Counters) Error(dir Direction, proto ProtoType, msgType string, _ error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(MetricsLabels{Direction: dir, Proto: proto, MsgType: msgType}).Errors++
+}
+
+// Snapshot returns a copy of the counters.
+func (c *Counters) Snapshot() map[MetricsLabels]MessageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make(map[MetricsLabels]MessageStats, len(c.stats))
+	for labels, stats := range c.stats {
+		snapshot[labels] = *stats
+	}
+	return snapshot
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Message(Direction, ProtoType, string, int) {}
+func (nopMetrics) Error(Direction, ProtoType, string, error) {}
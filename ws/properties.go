@@ -0,0 +1,132 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"math"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/ws/shell"
+)
+
+// Well-known ProtoHdr properties.
+const (
+	// PropertyOffset is the byte offset of the data of the message, e.g.
+	// of a file chunk.
+	PropertyOffset = "offset"
+	// PropertyTotalSize is the total size in bytes of the data streamed
+	// by the messages of the session.
+	PropertyTotalSize = "total_size"
+	// PropertyUserID is the ID of the user of the session.
+	PropertyUserID = shell.PropertyUserID
+	// PropertyTimeout is a timeout in seconds, e.g. the keepalive
+	// interval of shell sessions.
+	PropertyTimeout = shell.PropertyTimeout
+)
+
+// SetProperty sets the header property key to value.
+func (m *ProtoMsg) SetProperty(key string, value interface{}) {
+	if m.Header.Properties == nil {
+		m.Header.Properties = make(map[string]interface{})
+	}
+	m.Header.Properties[key] = value
+}
+
+// StringProperty returns the string property key, if present.
+func (m *ProtoMsg) StringProperty(key string) (string, bool) {
+	switch v := m.Header.Properties[key].(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
+
+// BoolProperty returns the boolean property key, if present.
+func (m *ProtoMsg) BoolProperty(key string) (bool, bool) {
+	v, ok := m.Header.Properties[key].(bool)
+	return v, ok
+}
+
+// Uint64Property returns the non-negative integer property key, if
+// present. msgpack decodes integers as the smallest type holding the value,
+// so all the integer types are accepted.
+func (m *ProtoMsg) Uint64Property(key string) (uint64, bool) {
+	return propertyUint(m.Header.Properties[key])
+}
+
+// Int64Property returns the integer property key, if present.
+func (m *ProtoMsg) Int64Property(key string) (int64, bool) {
+	switch v := m.Header.Properties[key].(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	}
+	u, ok := m.Uint64Property(key)
+	if !ok || u > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(u), true
+}
+
+// Offset returns the PropertyOffset of the message.
+func (m *ProtoMsg) Offset() (int64, bool) {
+	return m.Int64Property(PropertyOffset)
+}
+
+func (m *ProtoMsg) SetOffset(offset int64) {
+	m.SetProperty(PropertyOffset, offset)
+}
+
+// TotalSize returns the PropertyTotalSize of the message.
+func (m *ProtoMsg) TotalSize() (int64, bool) {
+	return m.Int64Property(PropertyTotalSize)
+}
+
+func (m *ProtoMsg) SetTotalSize(size int64) {
+	m.SetProperty(PropertyTotalSize, size)
+}
+
+// UserID returns the PropertyUserID of the message.
+func (m *ProtoMsg) UserID() (string, bool) {
+	return m.StringProperty(PropertyUserID)
+}
+
+func (m *ProtoMsg) SetUserID(userID string) {
+	m.SetProperty(PropertyUserID, userID)
+}
+
+// Timeout returns the PropertyTimeout of the message.
+func (m *ProtoMsg) Timeout() (time.Duration, bool) {
+	seconds, ok := m.Int64Property(PropertyTimeout)
+	if !ok || seconds < 0 || seconds > math.MaxInt64/int64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// SetTimeout sets the PropertyTimeout of the message, truncated to
+// seconds.
+func (m *ProtoMsg) SetTimeout(timeout time.Duration) {
+	m.SetProperty(PropertyTimeout, int64(timeout/time.Second))
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestProperties(t *testing.T) {
+	t.Parallel()
+	msg := &ProtoMsg{Header: ProtoHdr{Proto: ProtoTypeFileTransfer}}
+	_, ok := msg.Offset()
+	assert.False(t, ok)
+
+	msg.SetOffset(4096)
+	msg.SetTotalSize(1 << 40)
+	msg.SetUserID("user")
+	msg.SetTimeout(90*time.Second + time.Millisecond)
+	msg.SetProperty("enabled", true)
+	msg.SetProperty("negative", -1)
+
+	// The accessors work on the decoded message, where msgpack picks
+	// the smallest integer types.
+	b, err := msgpack.Marshal(msg)
+	require.NoError(t, err)
+	var decoded ProtoMsg
+	require.NoError(t, msgpack.Unmarshal(b, &decoded))
+	for _, m := range []*ProtoMsg{msg, &decoded} {
+		offset, ok := m.Offset()
+		assert.True(t, ok)
+		assert.Equal(t, int64(4096), offset)
+		size, ok := m.TotalSize()
+		assert.True(t, ok)
+		assert.Equal(t, int64(1<<40), size)
+		userID, ok := m.UserID()
+		assert.True(t, ok)
+		assert.Equal(t, "user", userID)
+		timeout, ok := m.Timeout()
+		assert.True(t, ok)
+		assert.Equal(t, 90*time.Second, timeout)
+		enabled, ok := m.BoolProperty("enabled")
+		assert.True(t, ok)
+		assert.True(t, enabled)
+
+		negative, ok := m.Int64Property("negative")
+		assert.True(t, ok)
+		assert.Equal(t, int64(-1), negative)
+		_, ok = m.Uint64Property("negative")
+		assert.False(t, ok)
+		_, ok = m.StringProperty(PropertyOffset)
+		assert.False(t, ok)
+		_, ok = m.Int64Property(PropertyUserID)
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package proxy
+
+import (
+	"io"
+	"sync"
+
+	"github.com/mendersoftware/go-lib-micro/ws"
+)
+
+// ChanEndpoint is an Endpoint backed by a pair of channels. Messages
+// forwarded to the endpoint are sent on Out and messages received on In are
+// forwarded to the other endpoint. Closing In terminates the pipe without
+// error (io.EOF).
+type ChanEndpoint struct {
+	In  <-chan *ws.ProtoMsg
+	Out chan<- *ws.ProtoMsg
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewChanEndpoint creates a new endpoint reading messages from in and
+// writing messages to out.
+func NewChanEndpoint(in <-chan *ws.ProtoMsg, out chan<- *ws.ProtoMsg) *ChanEndpoint {
+	return &ChanEndpoint{
+		In:   in,
+		Out:  out,
+		done: make(chan struct{}),
+	}
+}
+
+func (e *ChanEndpoint) ReadMessage() (*ws.ProtoMsg, error) {
+	select {
+	case msg, ok := <-e.In:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-e.done:
+		return nil, ws.ErrConnectionClosed
+	}
+}
+
+func (e *ChanEndpoint) WriteMessage(msg *ws.ProtoMsg) error {
+	select {
+	case e.Out <- msg:
+		return nil
+	case <-e.done:
+		return ws.ErrConnectionClosed
+	}
+}
+
+// Close unblocks pending reads and writes. The channels are left open and
+// are owned by the caller.
+func (e *ChanEndpoint) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.done)
+	})
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package proxy implements relaying of ProtoMsg traffic between two
+// endpoints, such as a user facing and a device facing websocket.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/ws"
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message body exceeds the
+	// maximum message size configured for the direction.
+	ErrMessageTooLarge = errors.New("proxy: message exceeds size limit")
+)
+
+// Endpoint is one end of the proxied stream. *ws.Connection implements
+// this interface. If the Endpoint also implements io.Closer, Close is
+// called when the proxy terminates.
+type Endpoint interface {
+	ReadMessage() (*ws.ProtoMsg, error)
+	WriteMessage(msg *ws.ProtoMsg) error
+}
+
+// DirectionError wraps an error with the direction it originated from.
+type DirectionError struct {
+	// Direction is either "upstream" (a -> b) or "downstream" (b -> a).
+	Direction string
+	Err       error
+}
+
+func (err *DirectionError) Error() string {
+	return fmt.Sprintf("proxy: %s: %s", err.Direction, err.Err.Error())
+}
+
+func (err *DirectionError) Unwrap() error {
+	return err.Err
+}
+
+const (
+	DirectionUpstream   = "upstream"
+	DirectionDownstream = "downstream"
+)
+
+// Limits restricts the traffic flowing in one direction of the proxy.
+type Limits struct {
+	// MaxMessageSize sets the maximum accepted length of the message body.
+	// A value of zero disables the limit.
+	MaxMessageSize *int
+
+	// MessagesPerSecond throttles the number of messages forwarded per
+	// second. A value of zero disables throttling.
+	MessagesPerSecond *float64
+
+	// Burst sets the number of messages that can be forwarded in a burst
+	// exceeding MessagesPerSecond (default: 1).
+	Burst *int
+}
+
+func NewLimits() *Limits {
+	return new(Limits)
+}
+
+func (l *Limits) SetMaxMessageSize(size int) *Limits {
+	l.MaxMessageSize = &size
+	return l
+}
+
+func (l *Limits) SetMessagesPerSecond(rate float64) *Limits {
+	l.MessagesPerSecond = &rate
+	return l
+}
+
+func (l *Limits) SetBurst(burst int) *Limits {
+	l.Burst = &burst
+	return l
+}
+
+type Options struct {
+	// Upstream limits the traffic from endpoint a to b.
+	Upstream *Limits
+	// Downstream limits the traffic from endpoint b to a.
+	Downstream *Limits
+}
+
+func NewOptions() *Options {
+	return new(Options)
+}
+
+func (opts *Options) SetUpstream(limits *Limits) *Options {
+	opts.Upstream = limits
+	return opts
+}
+
+func (opts *Options) SetDownstream(limits *Limits) *Options {
+	opts.Downstream = limits
+	return opts
+}
+
+func mergeLimits(dst, src *Limits) *Limits {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = NewLimits()
+	}
+	if src.MaxMessageSize != nil {
+		dst.MaxMessageSize = src.MaxMessageSize
+	}
+	if src.MessagesPerSecond != nil {
+		dst.MessagesPerSecond = src.MessagesPerSecond
+	}
+	if src.Burst != nil {
+		dst.Burst = src.Burst
+	}
+	return dst
+}
+
+// Pipe forwards messages from a to b and from b to a until either of the
+// endpoints returns an error, a limit is violated or the context is
+// canceled. When the first direction terminates, both endpoints are closed
+// (if they implement io.Closer) and Pipe waits for the other direction to
+// finish. An endpoint returning io.EOF from ReadMessage terminates the pipe
+// without error; other errors are returned as a *DirectionError.
+func Pipe(ctx context.Context, a, b Endpoint, opts ...*Options) error {
+	opt := NewOptions()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		opt.Upstream = mergeLimits(opt.Upstream, o.Upstream)
+		opt.Downstream = mergeLimits(opt.Downstream, o.Downstream)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	terminate := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+			closeEndpoint(a)
+			closeEndpoint(b)
+		})
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		terminate(forward(ctx, DirectionUpstream, a, b, opt.Upstream))
+	}()
+	go func() {
+		defer wg.Done()
+		terminate(forward(ctx, DirectionDownstream, b, a, opt.Downstream))
+	}()
+	<-ctx.Done()
+	terminate(nil)
+	wg.Wait()
+	return firstErr
+}
+
+func closeEndpoint(e Endpoint) {
+	if closer, ok := e.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func forward(
+	ctx context.Context,
+	direction string,
+	src, dst Endpoint,
+	limits *Limits,
+) error {
+	var (
+		maxSize int
+		bucket  *tokenBucket
+	)
+	if limits != nil {
+		if limits.MaxMessageSize != nil {
+			maxSize = *limits.MaxMessageSize
+		}
+		if limits.MessagesPerSecond != nil && *limits.MessagesPerSecond > 0 {
+			burst := 1
+			if limits.Burst != nil && *limits.Burst > 0 {
+				burst = *limits.Burst
+			}
+			bucket = newTokenBucket(*limits.MessagesPerSecond, burst)
+		}
+	}
+	for {
+		msg, err := src.ReadMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return &DirectionError{Direction: direction, Err: err}
+		}
+		if maxSize > 0 && len(msg.Body) > maxSize {
+			return &DirectionError{
+				Direction: direction,
+				Err:       ErrMessageTooLarge,
+			}
+		}
+		if bucket != nil {
+			if err := bucket.wait(ctx); err != nil {
+				return nil
+			}
+		}
+		err = dst.WriteMessage(msg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return &DirectionError{Direction: direction, Err: err}
+		}
+	}
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available or the context is canceled.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return nil
+	}
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/go-lib-micro/ws"
+)
+
+func newMessage(body string) *ws.ProtoMsg {
+	return &ws.ProtoMsg{
+		Header: ws.ProtoHdr{Proto: ws.ProtoTypeShell},
+		Body:   []byte(body),
+	}
+}
+
+type errEndpoint struct {
+	err error
+}
+
+func (e errEndpoint) ReadMessage() (*ws.ProtoMsg, error) {
+	return nil, e.err
+}
+
+func (e errEndpoint) WriteMessage(*ws.ProtoMsg) error {
+	return e.err
+}
+
+func TestPipe(t *testing.T) {
+	t.Parallel()
+
+	aIn, aOut := make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg, 1)
+	bIn, bOut := make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg, 1)
+	a := NewChanEndpoint(aIn, aOut)
+	b := NewChanEndpoint(bIn, bOut)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Pipe(context.Background(), a, b)
+	}()
+
+	aIn <- newMessage("upstream")
+	assert.Equal(t, newMessage("upstream"), <-bOut)
+	bIn <- newMessage("downstream")
+	assert.Equal(t, newMessage("downstream"), <-aOut)
+
+	close(aIn)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for pipe to terminate")
+	}
+}
+
+func TestPipeError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("message too large", func(t *testing.T) {
+		t.Parallel()
+		aIn := make(chan *ws.ProtoMsg, 1)
+		a := NewChanEndpoint(aIn, make(chan *ws.ProtoMsg))
+		b := NewChanEndpoint(
+			make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg, 1),
+		)
+		aIn <- newMessage("this message exceeds the limit")
+		err := Pipe(context.Background(), a, b, NewOptions().
+			SetUpstream(NewLimits().SetMaxMessageSize(10)))
+		assert.ErrorIs(t, err, ErrMessageTooLarge)
+		var dirErr *DirectionError
+		if assert.ErrorAs(t, err, &dirErr) {
+			assert.Equal(t, DirectionUpstream, dirErr.Direction)
+		}
+	})
+
+	t.Run("endpoint error", func(t *testing.T) {
+		t.Parallel()
+		errBroken := errors.New("broken pipe")
+		a := NewChanEndpoint(
+			make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg),
+		)
+		err := Pipe(context.Background(), a, errEndpoint{err: errBroken})
+		assert.ErrorIs(t, err, errBroken)
+		assert.EqualError(t, err, "proxy: downstream: broken pipe")
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		t.Parallel()
+		a := NewChanEndpoint(
+			make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg),
+		)
+		b := NewChanEndpoint(
+			make(chan *ws.ProtoMsg), make(chan *ws.ProtoMsg),
+		)
+		ctx, cancel := context.WithTimeout(
+			context.Background(), time.Millisecond*10,
+		)
+		defer cancel()
+		err := Pipe(ctx, a, b)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPipeRateLimit(t *testing.T) {
+	t.Parallel()
+	const numMessages = 4
+	aIn := make(chan *ws.ProtoMsg, numMessages)
+	bOut := make(chan *ws.ProtoMsg, numMessages)
+	a := NewChanEndpoint(aIn, make(chan *ws.ProtoMsg))
+	b := NewChanEndpoint(make(chan *ws.ProtoMsg), bOut)
+	for i := 0; i < numMessages; i++ {
+		aIn <- newMessage("msg")
+	}
+	close(aIn)
+
+	start := time.Now()
+	err := Pipe(context.Background(), a, b, NewOptions().
+		SetUpstream(NewLimits().
+			SetMessagesPerSecond(100).
+			SetBurst(1)))
+	assert.NoError(t, err)
+	assert.Len(t, bOut, numMessages)
+	// 1 message in burst + 3 throttled messages at 10ms intervals
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*25)
+}
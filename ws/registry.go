@@ -0,0 +1,254 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/mendersoftware/go-lib-micro/ws/filetransfer"
+	"github.com/mendersoftware/go-lib-micro/ws/menderclient"
+	"github.com/mendersoftware/go-lib-micro/ws/portforward"
+	"github.com/mendersoftware/go-lib-micro/ws/shell"
+)
+
+var (
+	ErrProtocolRegistered = errors.New("ws: protocol already registered")
+
+	ErrUnknownProtocol    = errors.New("ws: unknown protocol")
+	ErrUnknownMessageType = errors.New("ws: unknown message type")
+	ErrInvalidSessionID   = errors.New("ws: invalid session ID")
+)
+
+// Protocol describes a protocol carried by ProtoMsgs.
+type Protocol struct {
+	// Type is the ProtoType of the messages of the protocol.
+	Type ProtoType
+	// Name is a human readable name of the protocol.
+	Name string
+	// MessageTypes lists the message types of the protocol. If empty,
+	// the message types are not validated.
+	MessageTypes []string
+	// RequireSessionID rejects messages without a session ID.
+	RequireSessionID bool
+	// SessionIDPattern is the format of the session IDs, if set.
+	SessionIDPattern *regexp.Regexp
+	// MaxProperties is the maximum number of header properties of the
+	// messages (default: DefaultMaxProperties).
+	MaxProperties int
+}
+
+// Registry is a set of protocols. It is safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	protocols map[ProtoType]Protocol
+}
+
+// NewRegistry returns a registry with the given protocols. Use a registry
+// per test instead of the global functions to avoid sharing state between
+// tests.
+func NewRegistry(protocols ...Protocol) (*Registry, error) {
+	r := &Registry{protocols: make(map[ProtoType]Protocol, len(protocols))}
+	for _, p := range protocols {
+		if err := r.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds the protocol to the registry; registering a ProtoType
+// twice returns ErrProtocolRegistered.
+func (r *Registry) Register(p Protocol) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.protocols[p.Type]; ok {
+		return fmt.Errorf("%w: %d (%s)", ErrProtocolRegistered, p.Type, existing.Name)
+	}
+	msgTypes := make([]string, len(p.MessageTypes))
+	copy(msgTypes, p.MessageTypes)
+	p.MessageTypes = msgTypes
+	r.protocols[p.Type] = p
+	return nil
+}
+
+// Unregister removes the protocol from the registry.
+func (r *Registry) Unregister(proto ProtoType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.protocols, proto)
+}
+
+// Lookup returns the registered protocol.
+func (r *Registry) Lookup(proto ProtoType) (Protocol, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.protocols[proto]
+	return p, ok
+}
+
+// Protocols returns the registered protocols ordered by ProtoType.
+func (r *Registry) Protocols() []Protocol {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := make([]Protocol, 0, len(r.protocols))
+	for _, p := range r.protocols {
+		ret = append(ret, p)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Type < ret[j].Type })
+	return ret
+}
+
+// Validate checks the header of the message against its protocol: the
+// protocol must be registered, the message type must be one of the
+// protocol's, the session ID must be present and match the format if
+// required, and the number of properties must not exceed the limit.
+func (r *Registry) Validate(msg *ProtoMsg) error {
+	p, ok := r.Lookup(msg.Header.Proto)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownProtocol, msg.Header.Proto)
+	}
+	if len(p.MessageTypes) > 0 {
+		var known bool
+		for _, msgType := range p.MessageTypes {
+			if msgType == msg.Header.MsgType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %q for protocol %s",
+				ErrUnknownMessageType, msg.Header.MsgType, p.Name)
+		}
+	}
+	sid := msg.Header.SessionID
+	if sid == "" && p.RequireSessionID {
+		return fmt.Errorf("%w: %s messages require a session ID",
+			ErrInvalidSessionID, p.Name)
+	} else if sid != "" && p.SessionIDPattern != nil &&
+		!p.SessionIDPattern.MatchString(sid) {
+		return fmt.Errorf("%w: %q does not match %s",
+			ErrInvalidSessionID, sid, p.SessionIDPattern.String())
+	}
+	maxProperties := p.MaxProperties
+	if maxProperties <= 0 {
+		maxProperties = DefaultMaxProperties
+	}
+	if len(msg.Header.Properties) > maxProperties {
+		return &LimitError{
+			Err:   ErrTooManyProperties,
+			Limit: maxProperties,
+			Size:  len(msg.Header.Properties),
+		}
+	}
+	return nil
+}
+
+// BuiltinProtocols are the protocols defined by this package and its
+// subpackages.
+func BuiltinProtocols() []Protocol {
+	return []Protocol{{
+		Type: ProtoTypeShell,
+		Name: "shell",
+		MessageTypes: []string{
+			shell.MessageTypePingShell,
+			shell.MessageTypePongShell,
+			shell.MessageTypeResizeShell,
+			shell.MessageTypeShellCommand,
+			shell.MessageTypeSpawnShell,
+			shell.MessageTypeStopShell,
+			shell.MessageTypeExitShell,
+		},
+	}, {
+		Type: ProtoTypeFileTransfer,
+		Name: "filetransfer",
+		MessageTypes: []string{
+			filetransfer.MessageTypeGet,
+			filetransfer.MessageTypePut,
+			filetransfer.MessageTypeACK,
+			filetransfer.MessageTypeStat,
+			filetransfer.MessageTypeFileInfo,
+			filetransfer.MessageTypeChunk,
+			filetransfer.MessageTypeError,
+		},
+	}, {
+		Type: ProtoTypePortForward,
+		Name: "portforward",
+		MessageTypes: []string{
+			portforward.MessageTypePortForwardNew,
+			portforward.MessageTypePortForwardStop,
+			portforward.MessageTypePortForward,
+			portforward.MessageTypePortForwardAck,
+			portforward.MessageTypeError,
+		},
+	}, {
+		Type: ProtoTypeMenderClient,
+		Name: "menderclient",
+		MessageTypes: []string{
+			menderclient.MessageTypeMenderClientCheckUpdate,
+			menderclient.MessageTypeMenderClientSendInventory,
+		},
+	}, {
+		Type: ProtoTypeControl,
+		Name: "control",
+		MessageTypes: []string{
+			MessageTypePing,
+			MessageTypePong,
+			MessageTypeOpen,
+			MessageTypeAccept,
+			MessageTypeClose,
+			MessageTypeError,
+		},
+	}}
+}
+
+var defaultRegistry = func() *Registry {
+	r, err := NewRegistry(BuiltinProtocols()...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}()
+
+// DefaultRegistry returns the global registry holding the builtin
+// protocols.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterProtocol adds the protocol to the global registry.
+func RegisterProtocol(p Protocol) error {
+	return defaultRegistry.Register(p)
+}
+
+// UnregisterProtocol removes the protocol from the global registry; it is
+// meant for tests registering their own protocols.
+func UnregisterProtocol(proto ProtoType) {
+	defaultRegistry.Unregister(proto)
+}
+
+// LookupProtocol returns the protocol of the global registry.
+func LookupProtocol(proto ProtoType) (Protocol, bool) {
+	return defaultRegistry.Lookup(proto)
+}
+
+// Validate checks the message against its protocol in the global registry
+// (see Registry.Validate).
+func (m *ProtoMsg) Validate() error {
+	return defaultRegistry.Validate(m)
+}
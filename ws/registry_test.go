@@ -0,0 +1,136 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	r, err := NewRegistry()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, r.Register(Protocol{
+				Type: ProtoType(100 + i),
+				Name: fmt.Sprintf("proto%d", i),
+			}))
+			_, _ = r.Lookup(ProtoType(100 + i))
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, r.Protocols(), 16)
+
+	err = r.Register(Protocol{Type: 100, Name: "duplicate"})
+	assert.ErrorIs(t, err, ErrProtocolRegistered)
+	p, ok := r.Lookup(100)
+	assert.True(t, ok)
+	assert.Equal(t, "proto0", p.Name)
+
+	r.Unregister(100)
+	_, ok = r.Lookup(100)
+	assert.False(t, ok)
+	assert.NoError(t, r.Register(Protocol{Type: 100, Name: "replacement"}))
+
+	_, err = NewRegistry(Protocol{Type: 1}, Protocol{Type: 1})
+	assert.ErrorIs(t, err, ErrProtocolRegistered)
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	p, ok := LookupProtocol(ProtoTypeShell)
+	assert.True(t, ok)
+	assert.Contains(t, p.MessageTypes, "resize")
+
+	assert.ErrorIs(t, RegisterProtocol(Protocol{Type: ProtoTypeShell}),
+		ErrProtocolRegistered)
+	custom := Protocol{Type: 1000, Name: "custom"}
+	assert.NoError(t, RegisterProtocol(custom))
+	UnregisterProtocol(custom.Type)
+	_, ok = LookupProtocol(custom.Type)
+	assert.False(t, ok)
+	assert.Len(t, DefaultRegistry().Protocols(), len(BuiltinProtocols()))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	r, err := NewRegistry(Protocol{
+		Type:             100,
+		Name:             "test",
+		MessageTypes:     []string{"data"},
+		RequireSessionID: true,
+		SessionIDPattern: regexp.MustCompile("^[0-9a-f-]{36}$"),
+		MaxProperties:    2,
+	})
+	require.NoError(t, err)
+	const sid = "c5a36b0b-6f35-4a4e-9b4b-8f5dd7a1e6a6"
+	testCases := []struct {
+		Name   string
+		Header ProtoHdr
+		Error  error
+	}{{
+		Name:   "ok",
+		Header: ProtoHdr{Proto: 100, MsgType: "data", SessionID: sid},
+	}, {
+		Name:   "unknown protocol",
+		Header: ProtoHdr{Proto: 101, MsgType: "data", SessionID: sid},
+		Error:  ErrUnknownProtocol,
+	}, {
+		Name:   "unknown message type",
+		Header: ProtoHdr{Proto: 100, MsgType: "control", SessionID: sid},
+		Error:  ErrUnknownMessageType,
+	}, {
+		Name:   "missing session ID",
+		Header: ProtoHdr{Proto: 100, MsgType: "data"},
+		Error:  ErrInvalidSessionID,
+	}, {
+		Name:   "malformed session ID",
+		Header: ProtoHdr{Proto: 100, MsgType: "data", SessionID: "1234"},
+		Error:  ErrInvalidSessionID,
+	}, {
+		Name: "too many properties",
+		Header: ProtoHdr{Proto: 100, MsgType: "data", SessionID: sid,
+			Properties: map[string]interface{}{"a": 1, "b": 2, "c": 3}},
+		Error: ErrTooManyProperties,
+	}}
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.Name, func(t *testing.T) {
+			err := r.Validate(&ProtoMsg{Header: tc.Header})
+			if tc.Error != nil {
+				assert.ErrorIs(t, err, tc.Error)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.NoError(t, (&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeShell, MsgType: "resize"},
+	}).Validate())
+	assert.ErrorIs(t, (&ProtoMsg{
+		Header: ProtoHdr{Proto: ProtoTypeShell, MsgType: "get_file"},
+	}).Validate(), ErrUnknownMessageType)
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// PropertySequence is the ProtoHdr property carrying the sequence number
+// of the message within its session. Sequence numbers start at 1 and
+// increase by one for every message of the session.
+const PropertySequence = "seq"
+
+var (
+	ErrSequenceGap       = errors.New("ws: messages missing from sequence")
+	ErrSequenceDuplicate = errors.New("ws: duplicate or replayed message")
+)
+
+// SequenceError is returned by SequenceTracker.Check if the sequence
+// number is not the expected one. It wraps ErrSequenceGap or
+// ErrSequenceDuplicate.
+type SequenceError struct {
+	SessionID string
+	Expected  uint64
+	Got       uint64
+}
+
+func (err *SequenceError) Error() string {
+	return fmt.Sprintf("%s: session %q expected sequence number %d, got %d",
+		err.Unwrap().Error(), err.SessionID, err.Expected, err.Got)
+}
+
+func (err *SequenceError) Unwrap() error {
+	if err.Got < err.Expected {
+		return ErrSequenceDuplicate
+	}
+	return ErrSequenceGap
+}
+
+// SetSequence sets the sequence number property of the message.
+func (m *ProtoMsg) SetSequence(seq uint64) {
+	m.SetProperty(PropertySequence, seq)
+}
+
+// Sequence returns the sequence number of the message, if present.
+func (m *ProtoMsg) Sequence() (uint64, bool) {
+	return m.Uint64Property(PropertySequence)
+}
+
+// propertyUint converts a non-negative integer property, decoded by
+// msgpack as any of the integer types, to uint64.
+func propertyUint(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint8:
+		return uint64(v), true
+	case uint:
+		return uint64(v), true
+	case int64:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int8:
+		return uint64(v), v >= 0
+	case int:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// Sequencer numbers the outgoing messages per session. It is safe for
+// concurrent use.
+type Sequencer struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+func NewSequencer() *Sequencer {
+	return &Sequencer{last: make(map[string]uint64)}
+}
+
+// Stamp sets the next sequence number of the message's session on the
+// message and returns it.
+func (s *Sequencer) Stamp(msg *ProtoMsg) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := s.last[msg.Header.SessionID] + 1
+	s.last[msg.Header.SessionID] = seq
+	msg.SetSequence(seq)
+	return seq
+}
+
+// Forget releases the state of a closed session.
+func (s *Sequencer) Forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.last, sessionID)
+}
+
+// SequenceTracker checks the sequence numbers of incoming messages per
+// session. It is safe for concurrent use.
+type SequenceTracker struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{last: make(map[string]uint64)}
+}
+
+// Check verifies the sequence number of the message. Messages without a
+// sequence number are not checked. A gap (messages were lost) returns a
+// *SequenceError wrapping ErrSequenceGap and continues from the received
+// number, while a duplicate or replayed message returns a *SequenceError
+// wrapping ErrSequenceDuplicate and should be discarded.
+func (t *SequenceTracker) Check(msg *ProtoMsg) error {
+	seq, ok := msg.Sequence()
+	if !ok {
+		return nil
+	}
+	sessionID := msg.Header.SessionID
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expected := t.last[sessionID] + 1
+	if seq < expected {
+		return &SequenceError{SessionID: sessionID, Expected: expected, Got: seq}
+	}
+	t.last[sessionID] = seq
+	if seq > expected {
+		return &SequenceError{SessionID: sessionID, Expected: expected, Got: seq}
+	}
+	return nil
+}
+
+// Forget releases the state of a closed session.
+func (t *SequenceTracker) Forget(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.last, sessionID)
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestSequence(t *testing.T) {
+	t.Parallel()
+	seq := NewSequencer()
+	tracker := NewSequenceTracker()
+
+	roundTrip := func(msg *ProtoMsg) *ProtoMsg {
+		data, err := msgpack.Marshal(msg)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		res, err := UnmarshalProtoMsg(data)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return res
+	}
+	var msgs []*ProtoMsg
+	for i := 0; i < 4; i++ {
+		msg := &ProtoMsg{Header: ProtoHdr{Proto: ProtoTypeShell, SessionID: "a"}}
+		assert.Equal(t, uint64(i+1), seq.Stamp(msg))
+		msgs = append(msgs, roundTrip(msg))
+	}
+	other := &ProtoMsg{Header: ProtoHdr{Proto: ProtoTypeShell, SessionID: "b"}}
+	assert.Equal(t, uint64(1), seq.Stamp(other))
+
+	n, ok := msgs[3].Sequence()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), n)
+
+	assert.NoError(t, tracker.Check(msgs[0]))
+	assert.NoError(t, tracker.Check(msgs[1]))
+	assert.NoError(t, tracker.Check(roundTrip(other)))
+
+	err := tracker.Check(msgs[1])
+	assert.ErrorIs(t, err, ErrSequenceDuplicate)
+	assert.EqualError(t, err, `ws: duplicate or replayed message: `+
+		`session "a" expected sequence number 3, got 2`)
+
+	err = tracker.Check(msgs[3])
+	assert.ErrorIs(t, err, ErrSequenceGap)
+	var seqErr *SequenceError
+	if assert.ErrorAs(t, err, &seqErr) {
+		assert.Equal(t, uint64(3), seqErr.Expected)
+		assert.Equal(t, uint64(4), seqErr.Got)
+	}
+	// The late message is a duplicate once the gap is skipped.
+	assert.ErrorIs(t, tracker.Check(msgs[2]), ErrSequenceDuplicate)
+
+	// Messages without sequence numbers are not checked.
+	assert.NoError(t, tracker.Check(&ProtoMsg{Header: ProtoHdr{SessionID: "a"}}))
+	_, ok = (&ProtoMsg{}).Sequence()
+	assert.False(t, ok)
+
+	tracker.Forget("a")
+	seq.Forget("a")
+	msg := &ProtoMsg{Header: ProtoHdr{SessionID: "a"}}
+	assert.Equal(t, uint64(1), seq.Stamp(msg))
+	assert.NoError(t, tracker.Check(msg))
+}
@@ -23,6 +23,25 @@ const (
 	MessageTypeShellCommand = "shell"
 	MessageTypeSpawnShell   = "new"
 	MessageTypeStopShell    = "stop"
+	// MessageTypeExitShell is sent by the device when the shell process
+	// exits. The body MUST contain an Exit object.
+	MessageTypeExitShell = "exit"
+)
+
+// Header properties of the shell messages.
+const (
+	// PropertyStatus holds the MenderShellMessageStatus of the message.
+	PropertyStatus = "status"
+	// PropertyTerminalWidth and PropertyTerminalHeight hold the size of
+	// the terminal of the "new" and "resize" messages.
+	PropertyTerminalWidth  = "terminal_width"
+	PropertyTerminalHeight = "terminal_height"
+	// PropertyUserID holds the ID of the user who started the session.
+	PropertyUserID = "user_id"
+	// PropertyTimeout holds the keepalive timeout (in seconds) of the
+	// "ping" messages: the session expires if no ping is received
+	// within the timeout.
+	PropertyTimeout = "timeout"
 )
 
 const (
@@ -30,3 +49,30 @@ const (
 	ErrorMessage
 	ControlMessage
 )
+
+// Resize is the body of MessageTypeResizeShell (and optionally
+// MessageTypeSpawnShell) messages with the size of the terminal.
+type Resize struct {
+	// Rows is the height of the terminal in characters.
+	Rows uint16 `msgpack:"rows" json:"rows"`
+	// Cols is the width of the terminal in characters.
+	Cols uint16 `msgpack:"cols" json:"cols"`
+}
+
+// KeepAlive is the body of MessageTypePingShell messages.
+type KeepAlive struct {
+	// Timeout is the number of seconds after which the session expires
+	// unless another ping is received.
+	Timeout int `msgpack:"timeout" json:"timeout"`
+}
+
+// Exit is the body of MessageTypeExitShell messages.
+type Exit struct {
+	// Code is the exit status of the shell process, or -1 if the
+	// process was killed by a signal.
+	Code int `msgpack:"code" json:"code"`
+	// Signal is the name of the signal which killed the process.
+	Signal string `msgpack:"signal,omitempty" json:"signal,omitempty"`
+	// Error describes why the shell terminated abnormally.
+	Error string `msgpack:"err,omitempty" json:"error,omitempty"`
+}